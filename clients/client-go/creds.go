@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
@@ -65,6 +66,11 @@ type Client struct {
 	HTTPClient ReducedHTTPClient
 	// Context that aborts all requests with this client
 	Context context.Context
+	// HTTPRetry, if not nil, makes the http calls of requests with this
+	// client, retrying them as it sees fit, instead of the default exponential
+	// backoff. It must behave like httpbackoff.Retry, including returning an
+	// httpbackoff.BadHttpResponseCode error for a non-2xx response.
+	HTTPRetry func(httpCall func() (resp *http.Response, tempError error, permError error)) (*http.Response, int, error)
 }
 
 // Certificate represents the certificate used in Temporary Credentials. See
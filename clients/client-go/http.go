@@ -167,9 +167,14 @@ func (client *Client) Request(rawPayload []byte, method, route string, query url
 		return resp, err, nil
 	}
 
-	// Make HTTP API calls using an exponential backoff algorithm...
+	// Make HTTP API calls using an exponential backoff algorithm, unless the
+	// client retries them itself...
 	var err error
-	callSummary.HTTPResponse, callSummary.Attempts, err = defaultBackoff.Retry(httpCall)
+	if client.HTTPRetry != nil {
+		callSummary.HTTPResponse, callSummary.Attempts, err = client.HTTPRetry(httpCall)
+	} else {
+		callSummary.HTTPResponse, callSummary.Attempts, err = defaultBackoff.Retry(httpCall)
+	}
 
 	// read response into memory, so that we can return the body
 	if callSummary.HTTPResponse != nil {
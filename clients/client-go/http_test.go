@@ -501,3 +501,32 @@ func TestRetryFailure(t *testing.T) {
 	_, _, err := client.APICall(nil, "GET", "/whatever", nil, nil)
 	require.Error(t, err)
 }
+
+func TestHTTPRetry(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		_, _ = w.Write([]byte(`{"value": "hello world"}`))
+	}))
+	defer s.Close()
+	calls := 0
+	client := Client{
+		RootURL:      s.URL,
+		Authenticate: false,
+		HTTPRetry: func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+			calls++
+			resp, tempError, permError := httpCall()
+			require.NoError(t, tempError)
+			require.NoError(t, permError)
+			return resp, 1, nil
+		},
+	}
+
+	var result struct {
+		Value string `json:"value"`
+	}
+	_, cs, err := client.APICall(nil, "GET", "/whatever", &result, nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, calls)
+	require.Equal(t, 1, cs.Attempts)
+	require.Equal(t, "hello world", result.Value)
+}
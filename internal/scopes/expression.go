@@ -0,0 +1,216 @@
+package scopes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type (
+	// `Expression` is a scope expression, built from `Scope`, `AllOf` and
+	// `AnyOf` values, describing the scopes that are needed in order to
+	// perform an action. For example:
+	//
+	//  expression := scopes.AllOf{
+	//  	scopes.Scope("abc:def"),
+	//  	scopes.AnyOf{
+	//  		scopes.Scope("123:4:5"),
+	//  		scopes.Scope("Xxyz"),
+	//  	},
+	//  }
+	//
+	// represents the requirement that the following scopes are "satisfied":
+	//
+	//  "abc:def" AND ("123:4:5" OR "Xxyz")
+	//
+	// `Required` is also an `Expression`, in disjunctive normal form.
+	Expression interface {
+		fmt.Stringer
+		// unsatisfied returns the part of the expression that is not
+		// satisfied by the given scopes, or nil if the expression is
+		// satisfied.
+		unsatisfied(given Given) Expression
+		// format returns the expression in English; nested is true if the
+		// expression is part of an enclosing expression, and therefore
+		// needs to be parenthesised if it is compound.
+		format(nested bool) string
+	}
+	// `Scope` is an expression that is satisfied by a single required scope.
+	Scope string
+	// `AllOf` is an expression that is satisfied if all of its
+	// subexpressions are satisfied. An empty `AllOf` is always satisfied.
+	AllOf []Expression
+	// `AnyOf` is an expression that is satisfied if at least one of its
+	// subexpressions is satisfied. An empty `AnyOf` is never satisfied.
+	AnyOf []Expression
+	// `Pattern` is a scope containing named parameters in angle brackets,
+	// for example:
+	//
+	//  scopes.Pattern("generic-worker:cache:<cacheName>")
+	//
+	// Parameters are substituted with `Pattern.Scope` in order to produce
+	// the required scope.
+	Pattern string
+)
+
+var patternParameter = regexp.MustCompile(`<[^<>]+>`)
+
+// Returns `nil` if the given scopes satisfy the expression, otherwise the
+// part of the expression that is not satisfied, which can be used to tell a
+// client precisely which scopes it is missing. Scopes are only expanded (with
+// the given scope expander) if the expression is not satisfied by the given
+// scopes as they are.
+func (given Given) Missing(expression Expression, scopeExpander ScopeExpander) (Expression, error) {
+	missing := expression.unsatisfied(given)
+	if missing == nil {
+		return nil, nil
+	}
+	expandedGiven, err := given.Expand(scopeExpander)
+	if err != nil {
+		return nil, err
+	}
+	return expression.unsatisfied(expandedGiven), nil
+}
+
+// Returns `true` if the given scope pattern satisfies the required scope.
+func (given Given) satisfiedBy(scope string) bool {
+	for _, pattern := range given {
+		if scope == pattern || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(scope, pattern[0:len(pattern)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (scope Scope) unsatisfied(given Given) Expression {
+	if given.satisfiedBy(string(scope)) {
+		return nil
+	}
+	return scope
+}
+
+func (scope Scope) format(nested bool) string {
+	return string(scope)
+}
+
+// Returns a description of the scope expression in English.
+func (scope Scope) String() string {
+	return scope.format(false)
+}
+
+func (allOf AllOf) unsatisfied(given Given) Expression {
+	missing := AllOf{}
+	for _, expression := range allOf {
+		if m := expression.unsatisfied(given); m != nil {
+			missing = append(missing, m)
+		}
+	}
+	switch len(missing) {
+	case 0:
+		return nil
+	case 1:
+		return missing[0]
+	}
+	return missing
+}
+
+func (allOf AllOf) format(nested bool) string {
+	return formatCompound([]Expression(allOf), "and", nested)
+}
+
+// Returns a description of the scope expression in English.
+func (allOf AllOf) String() string {
+	return allOf.format(false)
+}
+
+func (anyOf AnyOf) unsatisfied(given Given) Expression {
+	missing := AnyOf{}
+	for _, expression := range anyOf {
+		m := expression.unsatisfied(given)
+		if m == nil {
+			return nil
+		}
+		missing = append(missing, m)
+	}
+	if len(missing) == 1 {
+		return missing[0]
+	}
+	return missing
+}
+
+func (anyOf AnyOf) format(nested bool) string {
+	return formatCompound([]Expression(anyOf), "or", nested)
+}
+
+// Returns a description of the scope expression in English.
+func (anyOf AnyOf) String() string {
+	return anyOf.format(false)
+}
+
+func formatCompound(expressions []Expression, operator string, nested bool) string {
+	if len(expressions) == 0 {
+		return "<no scopes>"
+	}
+	parts := make([]string, len(expressions))
+	for i, expression := range expressions {
+		parts[i] = expression.format(true)
+	}
+	if !nested {
+		return strings.Join(parts, ", "+operator+"\n")
+	}
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	return "(" + strings.Join(parts, " "+operator+" ") + ")"
+}
+
+// expression returns the equivalent `AnyOf` of `AllOf` expressions
+func (required Required) expression() Expression {
+	// special case: no required scopes is always satisfied
+	if len(required) == 0 {
+		return AllOf{}
+	}
+	anyOf := make(AnyOf, len(required))
+	for i, set := range required {
+		allOf := make(AllOf, len(set))
+		for j, scope := range set {
+			allOf[j] = Scope(scope)
+		}
+		anyOf[i] = allOf
+	}
+	return anyOf
+}
+
+func (required Required) unsatisfied(given Given) Expression {
+	return required.expression().unsatisfied(given)
+}
+
+func (required Required) format(nested bool) string {
+	return required.expression().format(nested)
+}
+
+// Scope returns the scope with the parameters of the pattern substituted by
+// the given values. Parameters and values are given as name/value pairs:
+//
+//  scopes.Pattern("generic-worker:cache:<cacheName>").Scope("cacheName", "hg")
+//
+// returns the scope "generic-worker:cache:hg". Scope panics if a value is not
+// given for every parameter in the pattern, since patterns are defined in
+// code.
+func (pattern Pattern) Scope(nameValuePairs ...string) Scope {
+	if len(nameValuePairs)%2 != 0 {
+		panic(fmt.Sprintf("Odd number of arguments when substituting parameters of scope pattern %q: %q", pattern, nameValuePairs))
+	}
+	values := map[string]string{}
+	for i := 0; i < len(nameValuePairs); i += 2 {
+		values["<"+nameValuePairs[i]+">"] = nameValuePairs[i+1]
+	}
+	scope := patternParameter.ReplaceAllStringFunc(string(pattern), func(parameter string) string {
+		value, given := values[parameter]
+		if !given {
+			panic(fmt.Sprintf("No value given for parameter %v of scope pattern %q", parameter, pattern))
+		}
+		return value
+	})
+	return Scope(scope)
+}
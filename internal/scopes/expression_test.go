@@ -0,0 +1,75 @@
+package scopes
+
+import (
+	"testing"
+)
+
+func missing(t *testing.T, given Given, expression Expression, expected string) {
+	// no assume: scopes are given, so no scope expander is needed
+	m, err := given.Missing(expression, nil)
+	if err != nil {
+		t.Fatalf("Hit error: %v", err)
+	}
+	if m == nil {
+		if expected != "" {
+			t.Errorf("Expected given scopes %q to be missing %q from %v, but none were missing.", given, expected, expression)
+		}
+		return
+	}
+	if actual := m.format(false); actual != expected {
+		t.Errorf("Expected given scopes %q to be missing %q from %v, but was missing %q.", given, expected, expression, actual)
+	}
+}
+
+func TestMissingScope(t *testing.T) {
+	missing(t, Given{"abc:*"}, Scope("abc:def"), "")
+	missing(t, Given{"abc:d"}, Scope("abc:def"), "abc:def")
+}
+
+func TestMissingAllOf(t *testing.T) {
+	missing(t, Given{"abc"}, AllOf{}, "")
+	missing(t, Given{"abc"}, AllOf{Scope("abc"), Scope("def"), Scope("ghi")}, "def, and\nghi")
+	missing(t, Given{"abc"}, AllOf{Scope("abc"), Scope("def")}, "def")
+}
+
+func TestMissingAnyOf(t *testing.T) {
+	missing(t, Given{"abc"}, AnyOf{}, "<no scopes>")
+	missing(t, Given{"abc"}, AnyOf{Scope("def"), Scope("abc")}, "")
+	missing(t, Given{"abc"}, AnyOf{Scope("def"), Scope("ghi")}, "def, or\nghi")
+}
+
+func TestMissingNested(t *testing.T) {
+	expression := AllOf{
+		Scope("abc:def"),
+		AnyOf{
+			Scope("123:4:5"),
+			AllOf{Scope("Xxyz"), Scope("abc:ghi")},
+		},
+	}
+	missing(t, Given{"abc:*", "Xxyz"}, expression, "")
+	missing(t, Given{"abc:*"}, expression, "123:4:5, or\nXxyz")
+	missing(t, Given{"123:*"}, expression, "abc:def")
+	missing(t, Given{}, expression, "abc:def, and\n(123:4:5 or (Xxyz and abc:ghi))")
+}
+
+func TestMissingRequired(t *testing.T) {
+	missing(t, Given{"abc"}, Required{}, "")
+	missing(t, Given{"abc"}, Required{{}}, "")
+	missing(t, Given{"abc"}, Required{{"abc", "def"}, {"ghi"}}, "def, or\nghi")
+}
+
+func TestPatternScope(t *testing.T) {
+	scope := Pattern("generic-worker:os-group:<provisionerId>/<workerType>/<osGroup>").Scope("provisionerId", "p", "workerType", "w", "osGroup", "<osGroup>")
+	if scope != "generic-worker:os-group:p/w/<osGroup>" {
+		t.Fatalf("Pattern substituted incorrectly: %v", scope)
+	}
+}
+
+func TestPatternScopeMissingParameter(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Was expecting a panic when a pattern parameter has no value")
+		}
+	}()
+	Pattern("generic-worker:cache:<cacheName>").Scope("name", "hg")
+}
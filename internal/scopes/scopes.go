@@ -54,45 +54,11 @@ type ScopeExpander interface {
 	ExpandScopes(*tcauth.SetOfScopes) (*tcauth.SetOfScopes, error)
 }
 
-// Returns `true` if the given scopes satisfy the required scopes.
-//
-// This function is ported from
-// https://github.com/taskcluster/taskcluster-base/blob/218225942212e24596cee211389c276b2b985ffe/utils.js#L37-L68
+// Returns `true` if the given scopes satisfy the required scopes. See
+// `Given.Missing` for finding out which required scopes are not satisfied.
 func (given Given) Satisfies(required Required, scopeExpander ScopeExpander) (bool, error) {
-	// special case: no required scopes is always satisfied
-	if len(required) == 0 {
-		return true, nil
-	}
-	checkFunc := func(given Given, required Required) bool {
-	checkRequired:
-		// outer loop - any scope set can pass in order to pass scope sets
-		for _, set := range required {
-			// inner loop - all scopes have to pass in order to pass scope set
-			for _, scope := range set {
-				// just need to find one given scope to satisfy required scope
-				for _, pattern := range given {
-					if scope == pattern || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(scope, pattern[0:len(pattern)-1])) {
-						goto scopeMatch
-					}
-				}
-				continue checkRequired
-			scopeMatch:
-			}
-			return true
-		}
-		return false
-	}
-	// Only expand scopes if we have to. First try with non-expanded scopes,
-	// and if required is already satisfied, no need to do the extra work of
-	// expanding given.
-	if checkFunc(given, required) {
-		return true, nil
-	}
-	expandedGiven, err := given.Expand(scopeExpander)
-	if err != nil {
-		return false, err
-	}
-	return checkFunc(expandedGiven, required), nil
+	missing, err := given.Missing(required, scopeExpander)
+	return missing == nil, err
 }
 
 func (given Given) Expand(scopeExpander ScopeExpander) (expanded Given, err error) {
@@ -101,7 +67,7 @@ func (given Given) Expand(scopeExpander ScopeExpander) (expanded Given, err erro
 			goto hasAssume
 		}
 	}
-	expanded = make(Given, 0, len(given))
+	expanded = make(Given, len(given))
 	copy(expanded, given)
 	return
 
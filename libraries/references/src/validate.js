@@ -28,6 +28,7 @@ const UNREFERENCED_SCHEMAS = [
   {service: 'generic-worker', schema: 'multiuser_windows.json#'},
   {service: 'generic-worker', schema: 'multiuser_posix.json#'},
   {service: 'generic-worker', schema: 'docker_posix.json#'},
+  {service: 'generic-worker', schema: 'kubernetes_posix.json#'},
 ];
 
 /**
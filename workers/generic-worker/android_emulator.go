@@ -0,0 +1,272 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+const (
+	// scope required by tasks in order to use the feature
+	androidEmulatorScope scopes.Pattern = "generic-worker:android-emulator:<provisionerId>/<workerType>"
+	logcatArtifactName                  = "public/logs/logcat.txt"
+	// relative to task directory
+	logcatPath = "generic-worker/logcat.txt"
+	// default port of the adb server, which task commands connect to
+	adbServerPort = 5037
+)
+
+// AndroidEmulatorFeature boots the configured Android emulator for tasks that
+// request it. The emulator is booted from the configured snapshot for each
+// task, and shut down without saving its state afterwards, so that every task
+// starts from the same snapshot.
+type AndroidEmulatorFeature struct {
+	emulator string
+	adb      string
+}
+
+func (feature *AndroidEmulatorFeature) Name() string {
+	return "Android Emulator"
+}
+
+func (feature *AndroidEmulatorFeature) PayloadName() string {
+	return "androidEmulator"
+}
+
+func (feature *AndroidEmulatorFeature) ScopePattern() scopes.Pattern {
+	return androidEmulatorScope
+}
+
+func (feature *AndroidEmulatorFeature) Initialise() error {
+	if !payloadFeatureEnabled(feature.PayloadName()) {
+		return nil
+	}
+	if config.AndroidEmulatorAVD == "" {
+		return fmt.Errorf("Config setting androidEmulatorAVD must be set when enabledFeatures includes %q", feature.PayloadName())
+	}
+	sdkRoot := config.AndroidSDKRoot
+	if sdkRoot == "" {
+		sdkRoot = os.Getenv("ANDROID_SDK_ROOT")
+	}
+	if sdkRoot == "" {
+		return fmt.Errorf("Config setting androidSDKRoot must be set when enabledFeatures includes %q, if ANDROID_SDK_ROOT is not set", feature.PayloadName())
+	}
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	feature.emulator = filepath.Join(sdkRoot, "emulator", "emulator"+exe)
+	feature.adb = filepath.Join(sdkRoot, "platform-tools", "adb"+exe)
+	for _, tool := range []string{feature.emulator, feature.adb} {
+		if _, err := os.Stat(tool); err != nil {
+			return fmt.Errorf("Android SDK tool %v not found: %v", tool, err)
+		}
+	}
+	return nil
+}
+
+func (feature *AndroidEmulatorFeature) PersistState() error {
+	return nil
+}
+
+func (feature *AndroidEmulatorFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.AndroidEmulator
+}
+
+type AndroidEmulatorTask struct {
+	task     *TaskRun
+	feature  *AndroidEmulatorFeature
+	serial   string
+	emulator *exec.Cmd
+	exited   chan error
+	logcat   *exec.Cmd
+	// closed once logcat has exited and its output file is closed
+	logcatExited chan struct{}
+}
+
+func (feature *AndroidEmulatorFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &AndroidEmulatorTask{
+		task:    task,
+		feature: feature,
+		serial:  fmt.Sprintf("emulator-%v", config.AndroidEmulatorPort),
+	}
+}
+
+func (l *AndroidEmulatorTask) RequiredScopes() scopes.Expression {
+	return workerScope(androidEmulatorScope)
+}
+
+func (l *AndroidEmulatorTask) ReservedArtifacts() []string {
+	return []string{
+		logcatArtifactName,
+	}
+}
+
+func (l *AndroidEmulatorTask) Start() *CommandExecutionError {
+	// the adb server must be started by the worker, so that it outlives
+	// task commands, and task commands of any task user can connect to it
+	out, err := host.CombinedOutput(l.feature.adb, "start-server")
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[android] Could not start adb server: %v\n%v", err, out))
+	}
+	args := androidEmulatorArgs()
+	l.task.Infof("[android] Booting Android emulator %v (%v)", config.AndroidEmulatorAVD, l.serial)
+	logcatFile := filepath.Join(taskContext.TaskDir, logcatPath)
+	err = os.MkdirAll(filepath.Dir(logcatFile), 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[android] Could not create directory for emulator logs: %v", err))
+	}
+	l.emulator = exec.Command(l.feature.emulator, args...)
+	emulatorLog, err := os.Create(filepath.Join(filepath.Dir(logcatFile), "emulator.log"))
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[android] Could not create emulator log: %v", err))
+	}
+	l.emulator.Stdout = emulatorLog
+	l.emulator.Stderr = emulatorLog
+	err = l.emulator.Start()
+	if err != nil {
+		emulatorLog.Close()
+		l.emulator = nil
+		return ResourceUnavailable(fmt.Errorf("[android] Could not start Android emulator: %v", err))
+	}
+	l.exited = make(chan error, 1)
+	go func() {
+		l.exited <- l.emulator.Wait()
+		emulatorLog.Close()
+	}()
+	started := time.Now()
+	err = l.waitForBoot(time.Duration(config.AndroidEmulatorBootTimeoutSecs) * time.Second)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[android] Android emulator %v did not boot: %v", l.serial, err))
+	}
+	l.task.Infof("[android] Android emulator %v booted in %v", l.serial, time.Since(started))
+
+	_, _ = host.CombinedOutput(l.feature.adb, "-s", l.serial, "logcat", "-c")
+	logcat, err := os.Create(logcatFile)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[android] Could not create logcat file: %v", err))
+	}
+	l.logcat = exec.Command(l.feature.adb, "-s", l.serial, "logcat", "-v", "threadtime")
+	l.logcat.Stdout = logcat
+	l.logcat.Stderr = logcat
+	l.logcatExited = make(chan struct{})
+	err = l.logcat.Start()
+	if err != nil {
+		logcat.Close()
+		l.logcat = nil
+		l.task.Warnf("[android] Could not capture logcat: %v", err)
+	} else {
+		go func() {
+			_ = l.logcat.Wait()
+			logcat.Close()
+			close(l.logcatExited)
+		}()
+	}
+
+	for name, value := range map[string]string{
+		"ANDROID_SERIAL":                l.serial,
+		"ANDROID_ADB_SERVER_PORT":       strconv.Itoa(adbServerPort),
+		"ANDROID_EMULATOR_CONSOLE_PORT": strconv.Itoa(int(config.AndroidEmulatorPort)),
+	} {
+		err = l.task.setVariable(name, value)
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[android] Could not set %v: %v", name, err))
+		}
+	}
+	return nil
+}
+
+// androidEmulatorArgs returns the command line arguments of the emulator,
+// which boots headless from the configured snapshot (or cold boots, if there
+// is none) and never saves its state
+func androidEmulatorArgs() []string {
+	args := []string{
+		"-avd", config.AndroidEmulatorAVD,
+		"-port", strconv.Itoa(int(config.AndroidEmulatorPort)),
+		"-no-snapshot-save",
+		"-no-window",
+		"-no-audio",
+		"-no-boot-anim",
+	}
+	if config.AndroidEmulatorSnapshot != "" {
+		return append(args, "-snapshot", config.AndroidEmulatorSnapshot)
+	}
+	return append(args, "-no-snapshot-load")
+}
+
+// waitForBoot waits for the emulator to report that it has finished booting
+func (l *AndroidEmulatorTask) waitForBoot(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-l.exited:
+			l.exited <- err
+			return fmt.Errorf("emulator exited: %v", err)
+		default:
+		}
+		out, err := host.CombinedOutput(l.feature.adb, "-s", l.serial, "shell", "getprop", "sys.boot_completed")
+		if err == nil && strings.TrimSpace(out) == "1" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %v", timeout)
+		}
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (l *AndroidEmulatorTask) Stop(err *ExecutionErrors) {
+	if l.emulator == nil {
+		return
+	}
+	// killing the emulator ends logcat too, but it's better to stop it
+	// first, so that the log doesn't end with disconnection errors
+	if l.logcat != nil {
+		_ = l.logcat.Process.Kill()
+		<-l.logcatExited
+	}
+	l.shutdownEmulator()
+	if l.logcat == nil {
+		return
+	}
+	err.add(l.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    logcatArtifactName,
+				Expires: l.task.Definition.Expires,
+			},
+			ContentType:     "text/plain; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            logcatPath,
+		},
+	))
+}
+
+// shutdownEmulator asks the emulator to exit, and kills it if it doesn't.
+// Since the emulator was started with -no-snapshot-save, the next task boots
+// from the same snapshot.
+func (l *AndroidEmulatorTask) shutdownEmulator() {
+	out, e := host.CombinedOutput(l.feature.adb, "-s", l.serial, "emu", "kill")
+	if e != nil {
+		log.Printf("WARNING: could not ask Android emulator %v to exit: %v\n%v", l.serial, e, out)
+	}
+	select {
+	case <-l.exited:
+	case <-time.After(30 * time.Second):
+		log.Printf("WARNING: Android emulator %v did not exit within 30 seconds - killing it", l.serial)
+		_ = l.emulator.Process.Kill()
+		<-l.exited
+	}
+	l.task.Infof("[android] Shut down Android emulator %v", l.serial)
+}
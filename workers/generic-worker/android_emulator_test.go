@@ -0,0 +1,111 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestAndroidEmulatorConfig(t *testing.T) {
+	sdkRoot, err := ioutil.TempDir("", "android-sdk")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(sdkRoot)
+	defer os.Setenv("ANDROID_SDK_ROOT", os.Getenv("ANDROID_SDK_ROOT"))
+	os.Unsetenv("ANDROID_SDK_ROOT")
+
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	feature := &AndroidEmulatorFeature{}
+	if err := feature.Initialise(); err != nil {
+		t.Fatalf("Was not expecting a disabled feature to require any config, but got: %v", err)
+	}
+
+	config.EnabledFeatures = []string{"androidEmulator"}
+	for _, test := range []struct {
+		avd     string
+		sdkRoot string
+		err     string
+	}{
+		{"", sdkRoot, "androidEmulatorAVD must be set"},
+		{"Pixel_4_API_30", "", "androidSDKRoot must be set"},
+		{"Pixel_4_API_30", sdkRoot, "not found"},
+	} {
+		config.AndroidEmulatorAVD = test.avd
+		config.AndroidSDKRoot = test.sdkRoot
+		err := feature.Initialise()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Was expecting AVD %q and SDK root %q to fail with %q, but got: %v", test.avd, test.sdkRoot, test.err, err)
+		}
+	}
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	emulator := filepath.Join(sdkRoot, "emulator", "emulator"+exe)
+	adb := filepath.Join(sdkRoot, "platform-tools", "adb"+exe)
+	for _, tool := range []string{emulator, adb} {
+		err = os.MkdirAll(filepath.Dir(tool), 0700)
+		if err == nil {
+			err = ioutil.WriteFile(tool, []byte{}, 0700)
+		}
+		if err != nil {
+			t.Fatalf("Could not create fake Android SDK tool %v: %v", tool, err)
+		}
+	}
+	// the SDK root can also be given by ANDROID_SDK_ROOT
+	config.AndroidSDKRoot = ""
+	os.Setenv("ANDROID_SDK_ROOT", sdkRoot)
+	err = feature.Initialise()
+	if err != nil {
+		t.Fatalf("Could not initialise Android emulator feature: %v", err)
+	}
+	if feature.emulator != emulator || feature.adb != adb {
+		t.Fatalf("Was expecting emulator %v and adb %v, but got %v and %v", emulator, adb, feature.emulator, feature.adb)
+	}
+}
+
+func TestAndroidEmulatorArgs(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			AndroidEmulatorAVD:  "Pixel_4_API_30",
+			AndroidEmulatorPort: 5556,
+		},
+	}
+	defer func() { config = nil }()
+	expected := []string{"-avd", "Pixel_4_API_30", "-port", "5556", "-no-snapshot-save", "-no-window", "-no-audio", "-no-boot-anim"}
+	if args := androidEmulatorArgs(); !reflect.DeepEqual(args, append(expected, "-no-snapshot-load")) {
+		t.Errorf("Was expecting emulator to cold boot without a snapshot, but got args %q", args)
+	}
+	config.AndroidEmulatorSnapshot = "ready"
+	if args := androidEmulatorArgs(); !reflect.DeepEqual(args, append(expected, "-snapshot", "ready")) {
+		t.Errorf("Was expecting emulator to boot from snapshot, but got args %q", args)
+	}
+}
+
+func TestAndroidEmulatorPayload(t *testing.T) {
+	ensureValidPayload(t, taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [`+rawHelloGoodbye()+`],
+  "features": {
+    "androidEmulator": true
+  }
+}`))
+	ensureMalformedPayload(t, taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [`+rawHelloGoodbye()+`],
+  "features": {
+    "androidEmulator": "yes"
+  }
+}`))
+}
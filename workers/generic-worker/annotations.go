@@ -0,0 +1,270 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const (
+	annotationsArtifactName = "public/annotations.json"
+	// maximum number of annotations published, so that the artifact stays
+	// small enough for CI user interfaces to load
+	maxAnnotations = 1000
+	// maximum length of the message of an annotation
+	maxAnnotationMessageLength = 1000
+)
+
+var (
+	// file, relative to task directory, that annotations are written to
+	// before they are uploaded
+	annotationsFile = filepath.Join("generic-worker", "annotations.json")
+	// TAP test failures and bail outs
+	tapFailure = regexp.MustCompile(`^\s*(not ok\b.*|Bail out!.*)$`)
+	// TAP directives that mark a failed test as expected
+	tapDirective = regexp.MustCompile(`(?i)#\s*(TODO|SKIP)\b`)
+)
+
+type (
+	// AnnotationsFeature publishes artifact public/annotations.json, which
+	// summarizes the errors and warnings of tasks that configure
+	// task.payload.annotations, found in the task log and in JUnit XML
+	// reports
+	AnnotationsFeature struct {
+	}
+
+	AnnotationsTask struct {
+		task            *TaskRun
+		errorPatterns   []*regexp.Regexp
+		warningPatterns []*regexp.Regexp
+	}
+
+	// annotations is the content of artifact public/annotations.json
+	annotations struct {
+		// total number of errors and warnings found, including those that
+		// are not listed because maxAnnotations was reached
+		Errors   uint `json:"errors"`
+		Warnings uint `json:"warnings"`
+		// true if not all errors and warnings are listed
+		Truncated   bool          `json:"truncated"`
+		Annotations []*annotation `json:"annotations"`
+	}
+
+	annotation struct {
+		// "error" or "warning"
+		Level string `json:"level"`
+		// "pattern", "tap" or "junit"
+		Source string `json:"source"`
+		// line number (from 1) and byte offset of the line in the task log,
+		// for annotations found in the task log
+		Line   uint   `json:"line,omitempty"`
+		Offset *int64 `json:"offset,omitempty"`
+		// path of the JUnit XML report, relative to the task directory, and
+		// name of the failed test case, for annotations found in a JUnit
+		// XML report
+		File    string `json:"file,omitempty"`
+		Test    string `json:"test,omitempty"`
+		Message string `json:"message"`
+	}
+)
+
+func (feature *AnnotationsFeature) Name() string {
+	return "Annotations"
+}
+
+func (feature *AnnotationsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *AnnotationsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *AnnotationsFeature) IsEnabled(task *TaskRun) bool {
+	a := task.Payload.Annotations
+	return len(a.ErrorPatterns) > 0 || len(a.WarningPatterns) > 0 || a.Tap || len(a.JunitReports) > 0
+}
+
+func (feature *AnnotationsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &AnnotationsTask{
+		task: task,
+	}
+}
+
+func (at *AnnotationsTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (at *AnnotationsTask) ReservedArtifacts() []string {
+	return []string{
+		annotationsArtifactName,
+	}
+}
+
+func (at *AnnotationsTask) Start() *CommandExecutionError {
+	var err error
+	at.errorPatterns, err = compilePatterns("errorPatterns", at.task.Payload.Annotations.ErrorPatterns)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	at.warningPatterns, err = compilePatterns("warningPatterns", at.task.Payload.Annotations.WarningPatterns)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	return nil
+}
+
+func compilePatterns(property string, patterns []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("[annotations] task.payload.annotations.%v contains invalid regular expression %q: %v", property, pattern, err)
+		}
+		regexps[i] = re
+	}
+	return regexps, nil
+}
+
+// Stop publishes the annotations found in the task log so far, which includes
+// all output of the task commands, and in the JUnit XML reports
+func (at *AnnotationsTask) Stop(err *ExecutionErrors) {
+	// Start() failed
+	if at.errorPatterns == nil || at.warningPatterns == nil {
+		return
+	}
+	a := &annotations{
+		Annotations: []*annotation{},
+	}
+	if e := at.annotateLog(a); e != nil {
+		at.task.Warnf("[annotations] Could not read task log: %v", e)
+	}
+	for _, report := range at.task.Payload.Annotations.JunitReports {
+		if e := annotateJUnitReport(a, report); e != nil {
+			at.task.Warnf("[annotations] Could not read JUnit XML report %v: %v", report, e)
+		}
+	}
+	at.task.Infof("[annotations] Found %v errors and %v warnings", a.Errors, a.Warnings)
+	e := fileutil.WriteToFileAsJSON(a, filepath.Join(taskContext.TaskDir, annotationsFile))
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[annotations] Could not write %v: %v", annotationsFile, e)))
+		return
+	}
+	err.add(at.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    annotationsArtifactName,
+				Expires: at.task.Definition.Expires,
+			},
+			ContentType: "application/json",
+			Path:        annotationsFile,
+		},
+	))
+}
+
+// annotateLog adds the errors and warnings in the task log to a
+func (at *AnnotationsTask) annotateLog(a *annotations) error {
+	file, err := os.Open(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return at.annotateLines(a, file)
+}
+
+func (at *AnnotationsTask) annotateLines(a *annotations, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	var offset int64
+	for line := uint(1); ; line++ {
+		text, err := reader.ReadString('\n')
+		if text != "" {
+			message := strings.TrimRight(text, "\r\n")
+			if level, source := at.classify(message); level != "" {
+				lineOffset := offset
+				a.add(&annotation{
+					Level:   level,
+					Source:  source,
+					Line:    line,
+					Offset:  &lineOffset,
+					Message: message,
+				})
+			}
+			offset += int64(len(text))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// classify returns the level ("error" or "warning") and source ("pattern" or
+// "tap") of the annotation for the given line of the task log, or "" if the
+// line isn't annotated
+func (at *AnnotationsTask) classify(line string) (level, source string) {
+	for _, re := range at.errorPatterns {
+		if re.MatchString(line) {
+			return "error", "pattern"
+		}
+	}
+	if at.task.Payload.Annotations.Tap && tapFailure.MatchString(line) && !tapDirective.MatchString(line) {
+		return "error", "tap"
+	}
+	for _, re := range at.warningPatterns {
+		if re.MatchString(line) {
+			return "warning", "pattern"
+		}
+	}
+	return "", ""
+}
+
+// annotateJUnitReport adds the failed test cases of the JUnit XML report at
+// the given path, relative to the task directory, to a
+func annotateJUnitReport(a *annotations, report string) error {
+	suite, err := readJUnitReport(filepath.Join(taskContext.TaskDir, report))
+	if err != nil {
+		return err
+	}
+	suite.eachCase(func(c *junitCase) {
+		for _, problem := range c.problems() {
+			a.add(&annotation{
+				Level:   "error",
+				Source:  "junit",
+				File:    report,
+				Test:    c.test(),
+				Message: problem.message(),
+			})
+		}
+	})
+	return nil
+}
+
+// add counts the given annotation, and lists it, unless maxAnnotations have
+// already been listed
+func (a *annotations) add(an *annotation) {
+	switch an.Level {
+	case "error":
+		a.Errors++
+	case "warning":
+		a.Warnings++
+	}
+	if len(a.Annotations) >= maxAnnotations {
+		a.Truncated = true
+		return
+	}
+	if len(an.Message) > maxAnnotationMessageLength {
+		an.Message = an.Message[:maxAnnotationMessageLength] + "..."
+	}
+	a.Annotations = append(a.Annotations, an)
+}
@@ -0,0 +1,126 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateLines(t *testing.T) {
+	task := &TaskRun{}
+	task.Payload.Annotations.Tap = true
+	at := &AnnotationsTask{
+		task: task,
+	}
+	var err error
+	at.errorPatterns, err = compilePatterns("errorPatterns", []string{`^error: `})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	at.warningPatterns, err = compilePatterns("warningPatterns", []string{`warning`})
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	log := strings.Join([]string{
+		"compiling",
+		"error: undefined: foo",
+		"warning: unused variable",
+		"error: warning treated as error",
+		"ok 1 - parses",
+		"not ok 2 - formats",
+		"not ok 3 - unicode # TODO not implemented",
+		"Bail out! database unavailable",
+	}, "\n")
+	a := &annotations{}
+	err = at.annotateLines(a, strings.NewReader(log))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expected := []struct {
+		level, source string
+		line          uint
+		offset        int64
+	}{
+		{"error", "pattern", 2, 10},
+		{"warning", "pattern", 3, 32},
+		{"error", "pattern", 4, 57},
+		{"error", "tap", 6, 103},
+		{"error", "tap", 8, 164},
+	}
+	if len(a.Annotations) != len(expected) {
+		t.Fatalf("Was expecting %v annotations but got %v: %#v", len(expected), len(a.Annotations), a.Annotations)
+	}
+	for i, e := range expected {
+		an := a.Annotations[i]
+		if an.Level != e.level || an.Source != e.source || an.Line != e.line || *an.Offset != e.offset {
+			t.Errorf("Was expecting annotation %v to be %v/%v at line %v offset %v but got %v/%v at line %v offset %v", i, e.level, e.source, e.line, e.offset, an.Level, an.Source, an.Line, *an.Offset)
+		}
+	}
+	if a.Errors != 4 || a.Warnings != 1 {
+		t.Fatalf("Was expecting 4 errors and 1 warning but got %v errors and %v warnings", a.Errors, a.Warnings)
+	}
+}
+
+func TestAnnotateJUnitReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(taskDir string) {
+		taskContext.TaskDir = taskDir
+	}(taskContext.TaskDir)
+	taskContext.TaskDir = dir
+	report := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="parser">
+    <testcase classname="parser.Lexer" name="testTokens"/>
+    <testcase classname="parser.Lexer" name="testUnicode">
+      <failure message="expected 3 tokens, got 2"/>
+    </testcase>
+    <testsuite name="nested">
+      <testcase name="testCrash">
+        <error>NullPointerException</error>
+      </testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>`
+	err = ioutil.WriteFile(filepath.Join(dir, "results.xml"), []byte(report), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	a := &annotations{}
+	err = annotateJUnitReport(a, "results.xml")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(a.Annotations) != 2 || a.Errors != 2 {
+		t.Fatalf("Was expecting 2 error annotations but got %#v", a)
+	}
+	if an := a.Annotations[0]; an.Test != "parser.Lexer.testUnicode" || an.Message != "expected 3 tokens, got 2" || an.File != "results.xml" {
+		t.Errorf("Unexpected annotation for failure: %#v", an)
+	}
+	if an := a.Annotations[1]; an.Test != "testCrash" || an.Message != "NullPointerException" {
+		t.Errorf("Unexpected annotation for error: %#v", an)
+	}
+	if err := annotateJUnitReport(a, "missing.xml"); err == nil {
+		t.Fatal("Was expecting missing JUnit XML report to be reported")
+	}
+}
+
+func TestAnnotationsTruncated(t *testing.T) {
+	a := &annotations{}
+	for i := 0; i < maxAnnotations+5; i++ {
+		a.add(&annotation{Level: "warning", Message: strings.Repeat("x", maxAnnotationMessageLength+1)})
+	}
+	if len(a.Annotations) != maxAnnotations || !a.Truncated || a.Warnings != maxAnnotations+5 {
+		t.Fatalf("Was expecting %v of %v annotations to be listed, but %v were listed (truncated: %v, warnings: %v)", maxAnnotations, maxAnnotations+5, len(a.Annotations), a.Truncated, a.Warnings)
+	}
+	if len(a.Annotations[0].Message) != maxAnnotationMessageLength+3 {
+		t.Fatalf("Was expecting long messages to be truncated, but message has length %v", len(a.Annotations[0].Message))
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+)
+
+const (
+	// backoff between retries of a Taskcluster API call, which doubles
+	// with each retry, up to apiRetryMaxBackoff
+	apiRetryInitialBackoff = 500 * time.Millisecond
+	apiRetryMaxBackoff     = 60 * time.Second
+)
+
+// apiRetrier makes the http calls of the Taskcluster API calls of the worker
+var apiRetrier *APIRetrier
+
+// APIRetrier makes the http calls of all Taskcluster API calls of the worker
+// (see gwconfig.Config.HTTPRetry). It retries calls that fail with a network
+// error, or HTTP status 5xx or 429, with exponential backoff that honours the
+// Retry-After header of the response, for up to the retry budget of the call
+// (config setting apiRetryBudgetSecs). When consecutive calls have exhausted
+// their retry budget (config setting apiCircuitBreakerThreshold), the circuit
+// breaker opens, and calls fail immediately for a cooldown period (config
+// setting apiCircuitBreakerCooldownSecs), during which the worker reports
+// degraded health, rather than hammering the deployment during an outage.
+type APIRetrier struct {
+	budget    time.Duration
+	threshold uint
+	cooldown  time.Duration
+	// overridden in tests
+	now   func() time.Time
+	sleep func(time.Duration)
+
+	mutex sync.Mutex
+	// number of consecutive calls that exhausted their retry budget
+	failures uint
+	// zero unless the circuit breaker has opened, since the last successful
+	// call
+	openUntil time.Time
+	lastError error
+}
+
+func NewAPIRetrier(budget time.Duration, threshold uint, cooldown time.Duration) *APIRetrier {
+	return &APIRetrier{
+		budget:    budget,
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+}
+
+// Retry makes the given http call, retrying it as described for APIRetrier,
+// and behaves like httpbackoff.Retry
+func (r *APIRetrier) Retry(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+	if err := r.open(); err != nil {
+		return nil, 0, err
+	}
+	started := r.now()
+	attempts := 0
+	for {
+		resp, tempError, permError := httpCall()
+		attempts++
+		if permError != nil {
+			return resp, attempts, permError
+		}
+		wait := apiRetryBackoff(attempts)
+		if tempError == nil {
+			switch code := resp.StatusCode; {
+			case code/100 == 2:
+				r.succeeded()
+				return resp, attempts, nil
+			case code/100 == 5 || code == http.StatusTooManyRequests:
+				tempError = httpbackoff.BadHttpResponseCode{
+					HttpResponseCode: code,
+					Message:          "(Intermittent) HTTP response code " + strconv.Itoa(code),
+				}
+				if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), r.now()); retryAfter > wait {
+					wait = retryAfter
+				}
+			default:
+				// the deployment is up, but rejected the call
+				r.succeeded()
+				return resp, attempts, httpbackoff.BadHttpResponseCode{
+					HttpResponseCode: code,
+					Message:          "(Permanent) HTTP response code " + strconv.Itoa(code),
+				}
+			}
+		}
+		if r.now().Sub(started)+wait > r.budget {
+			r.exhausted(tempError)
+			return resp, attempts, tempError
+		}
+		log.Printf("Retrying Taskcluster API call in %v after attempt %v failed: %v", wait, attempts, tempError)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		r.sleep(wait)
+	}
+}
+
+// Degraded returns whether the circuit breaker is open, and if so, why. It is
+// not open once its cooldown has passed, so that the worker calls the
+// Taskcluster API again.
+func (r *APIRetrier) Degraded() (bool, string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.now().Before(r.openUntil) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("%v consecutive Taskcluster API calls failed, most recently with: %v", r.failures, r.lastError)
+}
+
+// open returns an error if the circuit breaker is open, i.e. if its cooldown
+// hasn't passed yet. After the cooldown, calls are made again, until one
+// succeeds, which closes the circuit breaker, or one fails, which reopens it.
+func (r *APIRetrier) open() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.now().Before(r.openUntil) {
+		return fmt.Errorf("Not calling Taskcluster API since the circuit breaker is open until %v, after %v consecutive calls failed, most recently with: %v", r.openUntil.UTC().Format(time.RFC3339), r.failures, r.lastError)
+	}
+	return nil
+}
+
+func (r *APIRetrier) succeeded() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.openUntil.IsZero() {
+		log.Print("Taskcluster API call succeeded - closing circuit breaker")
+		logEventWithFields("apiCircuitBreakerClosed", nil, r.now(), nil)
+	}
+	r.failures = 0
+	r.openUntil = time.Time{}
+	r.lastError = nil
+}
+
+func (r *APIRetrier) exhausted(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failures++
+	r.lastError = err
+	if r.threshold == 0 || r.failures < r.threshold {
+		return
+	}
+	r.openUntil = r.now().Add(r.cooldown)
+	log.Printf("WARNING: %v consecutive Taskcluster API calls failed - opening circuit breaker until %v", r.failures, r.openUntil)
+	logEventWithFields("apiCircuitBreakerOpened", nil, r.now(), map[string]interface{}{
+		"consecutiveFailures": r.failures,
+		"cooldownSecs":        int64(r.cooldown / time.Second),
+	})
+}
+
+// apiRetryBackoff returns how long to wait after the given number of failed
+// attempts, with up to 25% jitter, so that workers don't retry in lockstep
+func apiRetryBackoff(attempts int) time.Duration {
+	backoff := apiRetryInitialBackoff
+	for i := 1; i < attempts && backoff < apiRetryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > apiRetryMaxBackoff {
+		backoff = apiRetryMaxBackoff
+	}
+	return backoff - time.Duration(rand.Int63n(int64(backoff/4)+1))
+}
+
+// parseRetryAfter returns how long the given Retry-After header value asks
+// clients to wait, which is either a number of seconds or an HTTP date, or 0
+// if it is empty or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// fakeAPIRetrier returns an APIRetrier whose clock only advances when it
+// sleeps
+func fakeAPIRetrier(budget time.Duration, threshold uint, cooldown time.Duration) (*APIRetrier, *time.Time) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	r := NewAPIRetrier(budget, threshold, cooldown)
+	r.now = func() time.Time {
+		return now
+	}
+	r.sleep = func(d time.Duration) {
+		now = now.Add(d)
+	}
+	return r, &now
+}
+
+// apiResponses returns an http call that responds with the given status codes
+// in turn, repeating the last one, and a counter of the calls made
+func apiResponses(header http.Header, codes ...int) (func() (*http.Response, error, error), *int) {
+	calls := 0
+	return func() (*http.Response, error, error) {
+		code := codes[len(codes)-1]
+		if calls < len(codes) {
+			code = codes[calls]
+		}
+		calls++
+		return &http.Response{
+			StatusCode: code,
+			Header:     header,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil, nil
+	}, &calls
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"-1":                            0,
+		"soon":                          0,
+		"Wed, 01 Jan 2020 00:00:30 GMT": 30 * time.Second,
+		"Tue, 31 Dec 2019 23:59:00 GMT": 0,
+	} {
+		if actual := parseRetryAfter(value, now); actual != expected {
+			t.Errorf("Was expecting Retry-After %q to be %v but got %v", value, expected, actual)
+		}
+	}
+}
+
+func TestAPIRetrySucceeds(t *testing.T) {
+	r, _ := fakeAPIRetrier(time.Minute, 5, time.Minute)
+	httpCall, calls := apiResponses(nil, 500, 429, 200)
+	resp, attempts, err := r.Retry(httpCall)
+	if err != nil {
+		t.Fatalf("Was expecting call to succeed, but got: %v", err)
+	}
+	if resp.StatusCode != 200 || attempts != 3 || *calls != 3 {
+		t.Fatalf("Was expecting status 200 after 3 attempts but got status %v after %v attempts", resp.StatusCode, attempts)
+	}
+}
+
+func TestAPIRetryPermanentFailure(t *testing.T) {
+	r, _ := fakeAPIRetrier(time.Minute, 5, time.Minute)
+	httpCall, calls := apiResponses(nil, 404)
+	_, _, err := r.Retry(httpCall)
+	if e, ok := err.(httpbackoff.BadHttpResponseCode); !ok || e.HttpResponseCode != 404 {
+		t.Fatalf("Was expecting BadHttpResponseCode 404 but got: %#v", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("Was expecting a 404 not to be retried, but call was made %v times", *calls)
+	}
+
+	permError := errors.New("bad request")
+	_, _, err = r.Retry(func() (*http.Response, error, error) {
+		return nil, nil, permError
+	})
+	if err != permError {
+		t.Fatalf("Was expecting permanent error to be returned, but got: %v", err)
+	}
+}
+
+func TestAPIRetryHonoursRetryAfter(t *testing.T) {
+	r, now := fakeAPIRetrier(time.Hour, 5, time.Minute)
+	started := *now
+	httpCall, _ := apiResponses(http.Header{"Retry-After": {"90"}}, 503, 200)
+	_, _, err := r.Retry(httpCall)
+	if err != nil {
+		t.Fatalf("Was expecting call to succeed, but got: %v", err)
+	}
+	if waited := now.Sub(started); waited != 90*time.Second {
+		t.Fatalf("Was expecting to wait 90s, as requested by Retry-After, but waited %v", waited)
+	}
+}
+
+func TestAPIRetryBudget(t *testing.T) {
+	r, now := fakeAPIRetrier(5*time.Minute, 5, time.Minute)
+	started := *now
+	httpCall, _ := apiResponses(nil, 500)
+	_, _, err := r.Retry(httpCall)
+	if e, ok := err.(httpbackoff.BadHttpResponseCode); !ok || e.HttpResponseCode != 500 {
+		t.Fatalf("Was expecting BadHttpResponseCode 500 but got: %#v", err)
+	}
+	if waited := now.Sub(started); waited > 5*time.Minute {
+		t.Fatalf("Was expecting retries to stop within budget of 5m, but waited %v", waited)
+	}
+
+	// a Retry-After beyond the budget isn't waited for
+	started = *now
+	httpCall, calls := apiResponses(http.Header{"Retry-After": {"3600"}}, 429)
+	_, _, _ = r.Retry(httpCall)
+	if *calls != 1 || *now != started {
+		t.Fatalf("Was expecting call not to be retried, but it was made %v times, after waiting %v", *calls, now.Sub(started))
+	}
+}
+
+func TestAPICircuitBreaker(t *testing.T) {
+	// events are logged when the circuit breaker opens and closes
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	r, now := fakeAPIRetrier(0, 2, time.Minute)
+	failing, _ := apiResponses(nil, 503)
+	for i := 0; i < 2; i++ {
+		if degraded, _ := r.Degraded(); degraded {
+			t.Fatalf("Was not expecting circuit breaker to open after %v failed calls", i)
+		}
+		_, _, _ = r.Retry(failing)
+	}
+	degraded, reason := r.Degraded()
+	if !degraded || !strings.Contains(reason, "2 consecutive") {
+		t.Fatalf("Was expecting circuit breaker to open after 2 failed calls, but got %v %q", degraded, reason)
+	}
+
+	succeeding, calls := apiResponses(nil, 200)
+	if _, _, err := r.Retry(succeeding); err == nil || *calls != 0 {
+		t.Fatalf("Was expecting call to fail immediately while circuit breaker is open, but got %v after %v calls", err, *calls)
+	}
+
+	// after the cooldown, calls are made again
+	*now = now.Add(time.Minute)
+	if degraded, _ := r.Degraded(); degraded {
+		t.Fatal("Was expecting circuit breaker not to be open after its cooldown")
+	}
+	if _, _, err := r.Retry(succeeding); err != nil || *calls != 1 {
+		t.Fatalf("Was expecting call to succeed after cooldown, but got %v after %v calls", err, *calls)
+	}
+
+	// one more failure doesn't reopen the circuit breaker, since the
+	// successful call closed it
+	_, _, _ = r.Retry(failing)
+	if degraded, _ := r.Degraded(); degraded {
+		t.Fatal("Was not expecting circuit breaker to reopen after a single failure")
+	}
+}
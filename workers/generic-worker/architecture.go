@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+const (
+	archARM64  = "arm64"
+	archX86_64 = "x86_64"
+)
+
+var (
+	// architectures that tasks can run as on this worker, native first,
+	// determined once, since they don't change while the worker runs
+	architecturesOnce      sync.Once
+	supportedArchitectures []string
+)
+
+// workerArchitectures returns the CPU architectures that tasks can run as on
+// this worker: its native architecture, followed by x86_64 if Rosetta is
+// available to translate it
+func workerArchitectures() []string {
+	architecturesOnce.Do(func() {
+		native := nativeArchitecture()
+		supportedArchitectures = []string{native}
+		if native == archARM64 && rosettaAvailable() {
+			supportedArchitectures = append(supportedArchitectures, archX86_64)
+		}
+	})
+	return supportedArchitectures
+}
+
+// goArchitecture returns the name of the given GOARCH, as named in
+// task.payload.architectures
+func goArchitecture(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return archX86_64
+	case "arm64":
+		return archARM64
+	}
+	return goarch
+}
+
+// selectArchitecture determines the CPU architecture that the task runs as,
+// from task.payload.architectures, and drops the mounts and fetches of the
+// task that declare other architectures, so that the features that process
+// them only see those that apply to the task
+func (task *TaskRun) selectArchitecture() *CommandExecutionError {
+	supported := workerArchitectures()
+	task.architecture = supported[0]
+	if len(task.Payload.Architectures) > 0 {
+		task.architecture = ""
+		for _, arch := range task.Payload.Architectures {
+			if containsArchitecture(supported, arch) {
+				task.architecture = arch
+				break
+			}
+		}
+		if task.architecture == "" {
+			return MalformedPayloadError(fmt.Errorf("Task requires one of the architectures %v, but this worker only supports %v", strings.Join(task.Payload.Architectures, ", "), strings.Join(supported, ", ")))
+		}
+	}
+	mounts := task.Payload.Mounts[:0]
+	for _, m := range task.Payload.Mounts {
+		var mount struct {
+			Architectures []string `json:"architectures"`
+		}
+		// invalid mounts are reported by the Mounts feature
+		if json.Unmarshal(m, &mount) != nil || appliesToArchitecture(mount.Architectures, task.architecture) {
+			mounts = append(mounts, m)
+		}
+	}
+	task.Payload.Mounts = mounts
+	fetches := task.Payload.Fetches[:0]
+	for _, fetch := range task.Payload.Fetches {
+		if appliesToArchitecture(fetch.Architectures, task.architecture) {
+			fetches = append(fetches, fetch)
+		}
+	}
+	task.Payload.Fetches = fetches
+	if task.architecture != supported[0] {
+		task.Infof("Running task as %v, which this %v worker supports with Rosetta", task.architecture, supported[0])
+	}
+	return nil
+}
+
+// appliesToArchitecture returns whether a mount or fetch with the given
+// architectures applies to a task that runs as the given architecture
+func appliesToArchitecture(architectures []string, arch string) bool {
+	return len(architectures) == 0 || containsArchitecture(architectures, arch)
+}
+
+func containsArchitecture(architectures []string, arch string) bool {
+	for _, a := range architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// architectureMetadata returns the CPU architecture information of the
+// worker that is published in its workerTypeMetadata
+func architectureMetadata() map[string]interface{} {
+	architectures := workerArchitectures()
+	return map[string]interface{}{
+		"architecture":  architectures[0],
+		"architectures": architectures,
+		"rosetta":       len(architectures) > 1,
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// nativeArchitecture returns the CPU architecture of the Mac, which is
+// arm64 if the worker is an x86_64 build that is itself translated by
+// Rosetta
+func nativeArchitecture() string {
+	if runtime.GOARCH == "amd64" {
+		out, err := exec.Command("/usr/sbin/sysctl", "-n", "sysctl.proc_translated").Output()
+		if err == nil && strings.TrimSpace(string(out)) == "1" {
+			return archARM64
+		}
+	}
+	return goArchitecture(runtime.GOARCH)
+}
+
+// rosettaAvailable returns whether Rosetta 2 is installed, so that x86_64
+// binaries run on Apple silicon
+func rosettaAvailable() bool {
+	_, err := os.Stat("/Library/Apple/usr/libexec/oah/libRosettaRuntime")
+	return err == nil
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"os"
+	"runtime"
+)
+
+func nativeArchitecture() string {
+	return goArchitecture(runtime.GOARCH)
+}
+
+// rosettaAvailable returns whether Rosetta for Linux (in virtual machines on
+// Apple silicon) is registered to run x86_64 binaries
+func rosettaAvailable() bool {
+	_, err := os.Stat("/proc/sys/fs/binfmt_misc/rosetta")
+	return err == nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSelectArchitecture(t *testing.T) {
+	// run detection first, so that it doesn't override the architectures
+	// of the test
+	workerArchitectures()
+	oldArchitectures := supportedArchitectures
+	defer func() { supportedArchitectures = oldArchitectures }()
+	supportedArchitectures = []string{archARM64, archX86_64}
+
+	task := &TaskRun{}
+	task.Payload.Architectures = []string{archX86_64}
+	task.Payload.Mounts = []json.RawMessage{
+		json.RawMessage(`{"file": "a", "content": {"url": "https://example.com/arm64"}, "architectures": ["arm64"]}`),
+		json.RawMessage(`{"file": "b", "content": {"url": "https://example.com/x86_64"}, "architectures": ["x86_64"]}`),
+		json.RawMessage(`{"file": "c", "content": {"url": "https://example.com/any"}}`),
+	}
+	task.Payload.Fetches = []Fetch{
+		{Artifact: "public/arm64.tar.gz", Architectures: []string{archARM64}},
+		{Artifact: "public/any.tar.gz"},
+	}
+	if cee := task.selectArchitecture(); cee != nil {
+		t.Fatalf("Could not select architecture: %v", cee)
+	}
+	if task.architecture != archX86_64 {
+		t.Fatalf("Expected task to run as %v, but got %v", archX86_64, task.architecture)
+	}
+	if len(task.Payload.Mounts) != 2 || string(task.Payload.Mounts[0]) != `{"file": "b", "content": {"url": "https://example.com/x86_64"}, "architectures": ["x86_64"]}` {
+		t.Fatalf("Expected mounts b and c, but got %s", task.Payload.Mounts)
+	}
+	if len(task.Payload.Fetches) != 1 || task.Payload.Fetches[0].Artifact != "public/any.tar.gz" {
+		t.Fatalf("Expected only fetch public/any.tar.gz, but got %#v", task.Payload.Fetches)
+	}
+
+	task = &TaskRun{}
+	if cee := task.selectArchitecture(); cee != nil || task.architecture != archARM64 {
+		t.Fatalf("Expected task without architectures to run as %v, but got %v (%v)", archARM64, task.architecture, cee)
+	}
+
+	supportedArchitectures = []string{archX86_64}
+	task = &TaskRun{}
+	task.Payload.Architectures = []string{archARM64}
+	if cee := task.selectArchitecture(); cee == nil || cee.TaskStatus != errored {
+		t.Fatalf("Expected malformed payload for unsupported architecture, but got %v", cee)
+	}
+}
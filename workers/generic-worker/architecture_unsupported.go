@@ -0,0 +1,15 @@
+// +build !darwin,!linux
+
+package main
+
+import (
+	"runtime"
+)
+
+func nativeArchitecture() string {
+	return goArchitecture(runtime.GOARCH)
+}
+
+func rosettaAvailable() bool {
+	return false
+}
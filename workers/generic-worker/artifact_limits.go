@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maximum number of artifacts that are listed when the artifacts of a task
+// exceed the size limit
+const maxArtifactsSizeOffenders = 10
+
+// maxArtifactsMB returns the limit of the total size of the artifacts of
+// task.payload.artifacts in megabytes, which is the lower of config setting
+// maxTaskArtifactsMB and task.payload.maxArtifactsMB, or 0 if neither is set
+func (task *TaskRun) maxArtifactsMB() uint64 {
+	max := uint64(config.MaxTaskArtifactsMB)
+	if taskMax := uint64(task.Payload.MaxArtifactsMB); taskMax > 0 && (max == 0 || taskMax < max) {
+		max = taskMax
+	}
+	return max
+}
+
+// checkArtifactsSize returns a task failure listing the largest of the given
+// artifacts, if their total size exceeds the limit of maxArtifactsMB
+func (task *TaskRun) checkArtifactsSize(artifacts []TaskArtifact) *CommandExecutionError {
+	maxMB := task.maxArtifactsMB()
+	if maxMB == 0 {
+		return nil
+	}
+	type artifactSize struct {
+		name  string
+		bytes int64
+	}
+	sizes := []artifactSize{}
+	total := int64(0)
+	for _, artifact := range artifacts {
+		s3Artifact, isS3 := artifact.(*S3Artifact)
+		if !isS3 {
+			continue
+		}
+		// artifacts that can't be read become error artifacts when they are
+		// uploaded, so don't count towards the limit
+		fileInfo, err := os.Stat(filepath.Join(taskContext.TaskDir, s3Artifact.Path))
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, artifactSize{
+			name:  s3Artifact.Name,
+			bytes: fileInfo.Size(),
+		})
+		total += fileInfo.Size()
+	}
+	if uint64(total) <= maxMB*1024*1024 {
+		return nil
+	}
+	sort.Slice(sizes, func(i, j int) bool {
+		if sizes[i].bytes != sizes[j].bytes {
+			return sizes[i].bytes > sizes[j].bytes
+		}
+		return sizes[i].name < sizes[j].name
+	})
+	if len(sizes) > maxArtifactsSizeOffenders {
+		sizes = sizes[:maxArtifactsSizeOffenders]
+	}
+	largest := make([]string, len(sizes))
+	for i, size := range sizes {
+		largest[i] = fmt.Sprintf("  %v: %v", size.name, megabytes(size.bytes))
+	}
+	return Failure(fmt.Errorf("The artifacts of task.payload.artifacts total %v, which exceeds the limit of %v MB of this task (config setting maxTaskArtifactsMB, or task.payload.maxArtifactsMB), so none of them were uploaded. The largest artifacts are:\n%v", megabytes(total), maxMB, strings.Join(largest, "\n")))
+}
+
+func megabytes(bytes int64) string {
+	return fmt.Sprintf("%.1f MB", float64(bytes)/(1024*1024))
+}
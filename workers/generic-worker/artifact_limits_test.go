@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestMaxArtifactsMB(t *testing.T) {
+	defer func() {
+		config = nil
+	}()
+	for _, test := range []struct {
+		configMax uint
+		taskMax   int64
+		max       uint64
+	}{
+		{0, 0, 0},
+		{100, 0, 100},
+		{0, 50, 50},
+		{100, 50, 50},
+		// tasks can't raise the limit of the worker
+		{100, 200, 100},
+	} {
+		config = &gwconfig.Config{
+			PublicConfig: gwconfig.PublicConfig{
+				MaxTaskArtifactsMB: test.configMax,
+			},
+		}
+		task := &TaskRun{}
+		task.Payload.MaxArtifactsMB = test.taskMax
+		if max := task.maxArtifactsMB(); max != test.max {
+			t.Errorf("Was expecting limit %v for config limit %v and task limit %v, but got %v", test.max, test.configMax, test.taskMax, max)
+		}
+	}
+}
+
+func TestCheckArtifactsSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: dir,
+	}
+	config = &gwconfig.Config{}
+	defer func() {
+		taskContext = oldTaskContext
+		config = nil
+	}()
+	artifacts := []TaskArtifact{}
+	for name, size := range map[string]int{"small": 1024, "medium": 512 * 1024, "large": 1024 * 1024} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), make([]byte, size), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		artifacts = append(artifacts, &S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name: "public/" + name,
+			},
+			Path: name,
+		})
+	}
+	artifacts = append(artifacts, &ErrorArtifact{
+		BaseArtifact: &BaseArtifact{
+			Name: "public/missing",
+		},
+	})
+	task := &TaskRun{}
+
+	task.Payload.MaxArtifactsMB = 2
+	if fail := task.checkArtifactsSize(artifacts); fail != nil {
+		t.Fatalf("Was not expecting artifacts totalling 1.5 MB to exceed limit of 2 MB: %v", fail)
+	}
+
+	task.Payload.MaxArtifactsMB = 1
+	fail := task.checkArtifactsSize(artifacts)
+	if fail == nil {
+		t.Fatal("Was expecting artifacts totalling 1.5 MB to exceed limit of 1 MB")
+	}
+	if fail.TaskStatus != failed {
+		t.Fatalf("Was expecting task to fail, but got %v", fail.TaskStatus)
+	}
+	message := fail.Cause.Error()
+	large := strings.Index(message, "public/large: 1.0 MB")
+	medium := strings.Index(message, "public/medium: 0.5 MB")
+	if large == -1 || medium == -1 || medium < large {
+		t.Fatalf("Was expecting largest artifacts to be listed, largest first, but got:\n%v", message)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/cenkalti/backoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// artifactMirrorTimeout is the time allowed for mirroring all of the
+// artifacts of a task, including retries
+const artifactMirrorTimeout = 15 * time.Minute
+
+// secondary store that uploaded artifacts are copied to, or nil if
+// config.ArtifactMirror is not set
+var artifactMirror ArtifactMirror
+
+// ArtifactMirror is a secondary store, in addition to the queue, that
+// artifacts are copied to for data-residency or disaster-recovery purposes.
+type ArtifactMirror interface {
+	// Put stores the given file under the given key, giving up when ctx is
+	// done
+	Put(ctx context.Context, key, file, contentType string) error
+	String() string
+}
+
+// S3ArtifactMirror mirrors artifacts to an Amazon S3 bucket, or a bucket in
+// any S3-compatible store (including Google Cloud Storage)
+type S3ArtifactMirror struct {
+	URL      string
+	Bucket   string
+	Prefix   string
+	uploader *s3manager.Uploader
+}
+
+// MirroredArtifact is an uploaded artifact that is waiting to be copied to
+// the artifact mirror
+type MirroredArtifact struct {
+	Name        string
+	File        string
+	ContentType string
+}
+
+// FileArtifactMirror mirrors artifacts to a local directory, such as a
+// mounted NAS path
+type FileArtifactMirror struct {
+	Directory string
+}
+
+// initialiseArtifactMirror sets artifactMirror from the worker config
+func initialiseArtifactMirror() (err error) {
+	artifactMirror = nil
+	if config.ArtifactMirror == "" {
+		return nil
+	}
+	artifactMirror, err = newArtifactMirror(config.ArtifactMirror)
+	return
+}
+
+func newArtifactMirror(mirrorURL string) (ArtifactMirror, error) {
+	u, err := url.Parse(mirrorURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "file":
+		dir := u.Path
+		switch {
+		case u.Host != "":
+			// UNC path, e.g. file://server/share
+			dir = "//" + u.Host + dir
+		case len(dir) >= 3 && dir[0] == '/' && dir[2] == ':':
+			// windows drive letter, e.g. file:///C:/artifacts
+			dir = dir[1:]
+		}
+		return &FileArtifactMirror{
+			Directory: filepath.FromSlash(dir),
+		}, nil
+	case "s3", "gs":
+		awsConfig := aws.NewConfig().WithRegion(config.ArtifactMirrorRegion)
+		// retries are handled by mirrorArtifact
+		awsConfig = awsConfig.WithMaxRetries(0)
+		endpoint := config.ArtifactMirrorEndpoint
+		if u.Scheme == "gs" {
+			// See https://cloud.google.com/storage/docs/interoperability
+			endpoint = "https://storage.googleapis.com"
+			awsConfig = awsConfig.WithRegion("auto")
+		}
+		if endpoint != "" {
+			awsConfig = awsConfig.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+		}
+		if config.ArtifactMirrorAccessKeyID != "" {
+			awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(config.ArtifactMirrorAccessKeyID, config.ArtifactMirrorSecretAccessKey, ""))
+		}
+		sess, err := session.NewSession(awsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create session for artifact mirror %v: %v", mirrorURL, err)
+		}
+		return &S3ArtifactMirror{
+			URL:      mirrorURL,
+			Bucket:   u.Host,
+			Prefix:   strings.Trim(u.Path, "/"),
+			uploader: s3manager.NewUploader(sess),
+		}, nil
+	}
+	return nil, fmt.Errorf("Unsupported artifact mirror %v", mirrorURL)
+}
+
+func (m *S3ArtifactMirror) Put(ctx context.Context, key, file, contentType string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = m.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(m.Bucket),
+		Key:         aws.String(path.Join(m.Prefix, key)),
+		Body:        f,
+		ContentType: aws.String(contentType),
+	})
+	return err
+}
+
+func (m *S3ArtifactMirror) String() string {
+	return m.URL
+}
+
+// Put copies the file to a temporary file alongside its destination, and
+// then renames it, so that partially copied files are never visible.
+func (m *FileArtifactMirror) Put(ctx context.Context, key, file, contentType string) error {
+	dest := filepath.Join(m.Directory, filepath.FromSlash(key))
+	err := os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return err
+	}
+	_, err = fileutil.Copy(dest+".partial", file)
+	if err != nil {
+		return err
+	}
+	return os.Rename(dest+".partial", dest)
+}
+
+func (m *FileArtifactMirror) String() string {
+	return "file://" + filepath.ToSlash(m.Directory)
+}
+
+// queueArtifactMirror records that the given uploaded artifact file is to be
+// copied to the artifact mirror, if one is configured, once the task has been
+// resolved, so that mirroring doesn't delay the task.
+func (task *TaskRun) queueArtifactMirror(name, file, contentType string) {
+	if artifactMirror == nil {
+		return
+	}
+	task.artifactsMux.Lock()
+	defer task.artifactsMux.Unlock()
+	task.mirroredArtifacts = append(task.mirroredArtifacts, &MirroredArtifact{
+		Name:        name,
+		File:        file,
+		ContentType: contentType,
+	})
+}
+
+// mirrorArtifacts copies the uploaded artifacts of the task to the artifact
+// mirror, giving up after artifactMirrorTimeout in total. It is called after
+// the task has been resolved, while the artifact files still exist.
+func (task *TaskRun) mirrorArtifacts() {
+	task.artifactsMux.Lock()
+	artifacts := task.mirroredArtifacts
+	task.mirroredArtifacts = nil
+	task.artifactsMux.Unlock()
+	if len(artifacts) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), artifactMirrorTimeout)
+	defer cancel()
+	for i, artifact := range artifacts {
+		if ctx.Err() != nil {
+			log.Printf("WARNING: giving up mirroring %v artifact(s) to %v, since mirroring took longer than %v", len(artifacts)-i, artifactMirror, artifactMirrorTimeout)
+			return
+		}
+		task.mirrorArtifact(ctx, artifact.Name, artifact.File, artifact.ContentType)
+	}
+}
+
+// mirrorArtifact copies the given artifact file to the artifact mirror.
+// Mirroring is retried independently of the upload to the queue, and failures
+// are only logged, since the artifact has already been uploaded successfully.
+func (task *TaskRun) mirrorArtifact(ctx context.Context, name, file, contentType string) {
+	key := path.Join(task.TaskID, strconv.Itoa(int(task.RunID)), name)
+	operation := func() error {
+		return artifactMirror.Put(ctx, key, file, contentType)
+	}
+	notify := func(err error, wait time.Duration) {
+		log.Printf("WARNING: could not mirror artifact %v to %v (will retry in %v): %v", name, artifactMirror, wait, err)
+	}
+	b := backoff.WithContext(backoff.WithMaxRetries(backoff.NewExponentialBackOff(), uint64(config.ArtifactMirrorRetries)), ctx)
+	err := backoff.RetryNotify(operation, b, notify)
+	if err != nil {
+		log.Printf("WARNING: giving up mirroring artifact %v to %v: %v", name, artifactMirror, err)
+		return
+	}
+	log.Printf("Mirrored artifact %v to %v", name, artifactMirror)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestFileArtifactMirror(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ArtifactMirrorRetries: 0,
+		},
+	}
+	artifactMirror = &FileArtifactMirror{
+		Directory: filepath.Join(dir, "mirror"),
+	}
+	defer func() {
+		config = nil
+		artifactMirror = nil
+	}()
+	src := filepath.Join(dir, "artifact.txt")
+	err = ioutil.WriteFile(src, []byte("mirrored content"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write %v: %v", src, err)
+	}
+
+	task := &TaskRun{
+		TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		RunID:  2,
+	}
+	task.queueArtifactMirror("public/build/artifact.txt", src, "text/plain")
+	task.mirrorArtifacts()
+
+	mirrored := filepath.Join(dir, "mirror", "KTBKfEgxR5GdfIIREQIvFQ", "2", "public", "build", "artifact.txt")
+	content, err := ioutil.ReadFile(mirrored)
+	if err != nil {
+		t.Fatalf("Could not read mirrored artifact: %v", err)
+	}
+	if string(content) != "mirrored content" {
+		t.Fatalf("Was expecting mirrored artifact to contain %q but it contains %q", "mirrored content", string(content))
+	}
+}
+
+func TestNewFileArtifactMirror(t *testing.T) {
+	for mirrorURL, expected := range map[string]string{
+		"file:///mnt/nas/artifacts":  filepath.FromSlash("/mnt/nas/artifacts"),
+		"file:///C:/artifacts":       filepath.FromSlash("C:/artifacts"),
+		"file://server/share/mirror": filepath.FromSlash("//server/share/mirror"),
+	} {
+		m, err := newArtifactMirror(mirrorURL)
+		if err != nil {
+			t.Fatalf("Could not create artifact mirror %v: %v", mirrorURL, err)
+		}
+		if actual := m.(*FileArtifactMirror).Directory; actual != expected {
+			t.Errorf("Was expecting artifact mirror %v to have directory %q but got %q", mirrorURL, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// +build multiuser
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+const (
+	artifactSigningScope = scopes.Pattern("generic-worker:signing-key:<provisionerId>/<workerType>/<key>")
+	// time allowed for a signing command to sign an artifact
+	signingCommandTimeout = 5 * time.Minute
+)
+
+var (
+	// directory, relative to task directory, that signatures are written to
+	// before they are uploaded
+	signaturesDir = filepath.Join("generic-worker", "signatures")
+)
+
+type (
+	// ArtifactSigningFeature signs the artifacts listed in
+	// task.payload.signArtifacts with keys that the worker holds (see config
+	// setting artifactSigningKeys), and publishes detached signatures of
+	// them, so that release signing can run on dedicated worker pools,
+	// without tasks having access to the keys.
+	ArtifactSigningFeature struct {
+		signers map[string]artifactSigner
+	}
+
+	ArtifactSigningTask struct {
+		task    *TaskRun
+		signers map[string]artifactSigner
+	}
+
+	// artifactSigner returns the detached signature of the given content
+	artifactSigner func(content []byte) ([]byte, error)
+)
+
+func (feature *ArtifactSigningFeature) Name() string {
+	return "Artifact Signing"
+}
+
+func (feature *ArtifactSigningFeature) PayloadName() string {
+	return "signArtifacts"
+}
+
+func (feature *ArtifactSigningFeature) ScopePattern() scopes.Pattern {
+	return artifactSigningScope
+}
+
+// Initialise reads the private key files of config setting
+// artifactSigningKeys, and locks down their file permissions, so that task
+// users cannot read them
+func (feature *ArtifactSigningFeature) Initialise() error {
+	feature.signers = map[string]artifactSigner{}
+	for id, key := range config.ArtifactSigningKeys {
+		if len(key.Command) > 0 {
+			feature.signers[id] = commandSigner(key)
+			continue
+		}
+		privateKey, err := readSigningKey(key.File)
+		if err != nil {
+			return fmt.Errorf("could not read signing key %v from %v: %v", id, key.File, err)
+		}
+		err = fileutil.SecureFiles(key.File)
+		if err != nil {
+			return fmt.Errorf("could not secure signing key %v file %v: %v", id, key.File, err)
+		}
+		feature.signers[id] = func(content []byte) ([]byte, error) {
+			return ed25519.Sign(privateKey, content), nil
+		}
+	}
+	return nil
+}
+
+func (feature *ArtifactSigningFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ArtifactSigningFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.SignArtifacts) > 0
+}
+
+func (feature *ArtifactSigningFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ArtifactSigningTask{
+		task:    task,
+		signers: feature.signers,
+	}
+}
+
+func (ast *ArtifactSigningTask) RequiredScopes() scopes.Expression {
+	requiredScopes := scopes.AllOf{}
+	keys := map[string]bool{}
+	for _, a := range ast.task.Payload.SignArtifacts {
+		if !keys[a.Key] {
+			keys[a.Key] = true
+			requiredScopes = append(requiredScopes, workerScope(artifactSigningScope, "key", a.Key))
+		}
+	}
+	return requiredScopes
+}
+
+func (ast *ArtifactSigningTask) ReservedArtifacts() []string {
+	names := []string{}
+	for _, a := range ast.task.Payload.SignArtifacts {
+		names = append(names, a.Name+".sig")
+	}
+	return names
+}
+
+func (ast *ArtifactSigningTask) Start() *CommandExecutionError {
+	for _, a := range ast.task.Payload.SignArtifacts {
+		if _, exists := ast.signers[a.Key]; !exists {
+			return MalformedPayloadError(fmt.Errorf("[signing] task.payload.signArtifacts entry %v refers to key %q, but this worker only has keys %v (see config setting artifactSigningKeys)", a.Name, a.Key, signingKeyIDs()))
+		}
+	}
+	return nil
+}
+
+// Stop signs the artifacts of task.payload.signArtifacts, once they have
+// been uploaded, and before chain of trust certificates are created, so that
+// the signatures are covered by them
+func (ast *ArtifactSigningTask) Stop(err *ExecutionErrors) {
+	if err.Occurred() {
+		ast.task.Warn("[signing] Not signing artifacts, since the task did not succeed")
+		return
+	}
+	e := os.MkdirAll(filepath.Join(taskContext.TaskDir, signaturesDir), 0700)
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[signing] Could not create directory %v: %v", signaturesDir, e)))
+		return
+	}
+	ast.task.artifactSignatures = map[string]string{}
+	for i, a := range ast.task.Payload.SignArtifacts {
+		ast.task.artifactsMux.Lock()
+		artifact, uploaded := ast.task.Artifacts[a.Name].(*S3Artifact)
+		ast.task.artifactsMux.Unlock()
+		if !uploaded {
+			err.add(Failure(fmt.Errorf("[signing] Cannot sign artifact %v, since the task did not upload it as a file", a.Name)))
+			continue
+		}
+		content, e := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, artifact.Path))
+		if e != nil {
+			err.add(executionError(internalError, errored, fmt.Errorf("[signing] Could not read artifact %v: %v", a.Name, e)))
+			continue
+		}
+		signature, e := ast.signers[a.Key](content)
+		if e != nil {
+			err.add(executionError(internalError, errored, fmt.Errorf("[signing] Could not sign artifact %v with key %v: %v", a.Name, a.Key, e)))
+			continue
+		}
+		signatureFile := filepath.Join(signaturesDir, strconv.Itoa(i)+".sig")
+		e = ioutil.WriteFile(filepath.Join(taskContext.TaskDir, signatureFile), signature, 0644)
+		if e != nil {
+			err.add(executionError(internalError, errored, fmt.Errorf("[signing] Could not write signature of artifact %v: %v", a.Name, e)))
+			continue
+		}
+		ast.task.Infof("[signing] Signed artifact %v with key %v", a.Name, a.Key)
+		uploadErr := ast.task.uploadArtifact(
+			&S3Artifact{
+				BaseArtifact: &BaseArtifact{
+					Name:    a.Name + ".sig",
+					Expires: artifact.Expires,
+				},
+				ContentType: "application/octet-stream",
+				Path:        signatureFile,
+			},
+		)
+		if uploadErr != nil {
+			err.add(uploadErr)
+			continue
+		}
+		ast.task.artifactSignatures[a.Name] = a.Key
+	}
+}
+
+// readSigningKey reads an ed25519 private key seed file, as written by
+// generic-worker new-ed25519-keypair
+func readSigningKey(file string) (ed25519.PrivateKey, error) {
+	base64Seed, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(base64Seed)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("not a base64 encoded ed25519 private key seed")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// commandSigner returns a signer that runs the command of the given key,
+// with the content to sign on standard input, and the signature on standard
+// output
+func commandSigner(key gwconfig.SigningKey) artifactSigner {
+	return func(content []byte) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), signingCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, key.Command[0], key.Command[1:]...)
+		cmd.Stdin = bytes.NewReader(content)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		signature, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("signing command %q failed: %v: %v", strings.Join(key.Command, " "), err, strings.TrimSpace(stderr.String()))
+		}
+		if len(signature) == 0 {
+			return nil, fmt.Errorf("signing command %q wrote no signature", strings.Join(key.Command, " "))
+		}
+		return signature, nil
+	}
+}
+
+func signingKeyIDs() []string {
+	ids := []string{}
+	for id := range config.ArtifactSigningKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,74 @@
+// +build multiuser
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestArtifactSigners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifact-signing")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatalf("Could not generate key: %v", err)
+	}
+	keyFile := filepath.Join(dir, "release.key")
+	err = writeEd25519PrivateKeyToFile(privateKey, keyFile)
+	if err != nil {
+		t.Fatalf("Could not write key: %v", err)
+	}
+	notAKey := filepath.Join(dir, "not-a.key")
+	err = ioutil.WriteFile(notAKey, []byte("bm90IGEga2V5"), 0600)
+	if err != nil {
+		t.Fatalf("Could not write %v: %v", notAKey, err)
+	}
+
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	config.ArtifactSigningKeys = map[string]gwconfig.SigningKey{
+		"release": {File: keyFile},
+	}
+	feature := &ArtifactSigningFeature{}
+	err = feature.Initialise()
+	if err != nil {
+		t.Fatalf("Could not initialise artifact signing: %v", err)
+	}
+	content := []byte("installer")
+	signature, err := feature.signers["release"](content)
+	if err != nil {
+		t.Fatalf("Could not sign: %v", err)
+	}
+	if !ed25519.Verify(publicKey, content, signature) {
+		t.Fatal("Signature does not verify with the public key")
+	}
+
+	config.ArtifactSigningKeys["broken"] = gwconfig.SigningKey{File: notAKey}
+	if err := (&ArtifactSigningFeature{}).Initialise(); err == nil {
+		t.Fatalf("Expected initialisation to fail for key file %v", notAKey)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	// a signing command that "signs" by echoing the content
+	signature, err = commandSigner(gwconfig.SigningKey{Command: []string{"cat"}})(content)
+	if err != nil || string(signature) != string(content) {
+		t.Fatalf("Expected signing command to return %q, but got %q (%v)", content, signature, err)
+	}
+	_, err = commandSigner(gwconfig.SigningKey{Command: []string{"false"}})(content)
+	if err == nil {
+		t.Fatal("Expected failing signing command to return an error")
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"mime"
 	"net"
@@ -21,6 +20,7 @@ import (
 	"github.com/taskcluster/httpbackoff/v3"
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 )
 
 var (
@@ -145,63 +145,122 @@ func (errArtifact *ErrorArtifact) String() string {
 	return fmt.Sprintf("%v", *errArtifact)
 }
 
-// createTempFileForPUTBody gzip-compresses the file at path rawContentFile and writes
-// it to a temporary file. The file path of the generated temporary file is returned.
-// It is the responsibility of the caller to delete the temporary file.
-func (s3Artifact *S3Artifact) CreateTempFileForPUTBody() string {
-	rawContentFile := filepath.Join(taskContext.TaskDir, s3Artifact.Path)
-	baseName := filepath.Base(rawContentFile)
-	tmpFile, err := ioutil.TempFile("", baseName)
+// compress writes the content of the file at path rawContentFile to w,
+// compressed according to the content encoding of the artifact
+func (s3Artifact *S3Artifact) compress(w io.Writer, rawContentFile string) error {
+	source, err := os.Open(rawContentFile)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer tmpFile.Close()
-	var target io.Writer = tmpFile
-	if s3Artifact.ContentEncoding == "gzip" {
-		gzipLogWriter := gzip.NewWriter(tmpFile)
-		defer gzipLogWriter.Close()
-		gzipLogWriter.Name = baseName
-		target = gzipLogWriter
+	defer source.Close()
+	if s3Artifact.ContentEncoding != "gzip" {
+		_, err = io.Copy(w, source)
+		return err
 	}
-	source, err := os.Open(rawContentFile)
+	gzipLogWriter := gzip.NewWriter(w)
+	gzipLogWriter.Name = filepath.Base(rawContentFile)
+	_, err = io.Copy(gzipLogWriter, source)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer source.Close()
-	_, _ = io.Copy(target, source)
-	return tmpFile.Name()
+	return gzipLogWriter.Close()
+}
+
+// PUTBody returns a reader that streams the content of the artifact,
+// compressing it on the fly, for the body of the http PUT request that
+// uploads it, together with the length of the body. Since gzip output is
+// deterministic, the length of a compressed body is calculated by compressing
+// the content once without keeping the output, so that neither the file nor
+// its compressed content needs to be buffered in memory or on disk. If chunked
+// is true, this step is skipped, and the returned length is -1, so that the
+// body is sent with chunked transfer encoding.
+//
+// The caller must close the returned reader.
+func (s3Artifact *S3Artifact) PUTBody(chunked bool) (body io.ReadCloser, length int64, err error) {
+	rawContentFile := filepath.Join(taskContext.TaskDir, s3Artifact.Path)
+	switch {
+	case s3Artifact.ContentEncoding != "gzip":
+		var fileInfo os.FileInfo
+		fileInfo, err = os.Stat(rawContentFile)
+		if err != nil {
+			return
+		}
+		length = fileInfo.Size()
+	case chunked:
+		length = -1
+	default:
+		counter := &countingWriter{}
+		err = s3Artifact.compress(counter, rawContentFile)
+		if err != nil {
+			return
+		}
+		length = counter.bytes
+	}
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		// if the request is abandoned, the reader is closed, which causes
+		// writes to fail, so this goroutine always terminates
+		_ = pipeWriter.CloseWithError(s3Artifact.compress(pipeWriter, rawContentFile))
+	}()
+	body = pipeReader
+	return
+}
+
+// countingWriter discards what is written to it, counting the bytes
+type countingWriter struct {
+	bytes int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.bytes += int64(len(p))
+	return len(p), nil
+}
+
+// countingReader counts the bytes read from an underlying reader
+type countingReader struct {
+	reader io.Reader
+	bytes  int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.bytes += int64(n)
+	return n, err
 }
 
 func (s3Artifact *S3Artifact) ProcessResponse(resp interface{}, task *TaskRun) (err error) {
 	response := resp.(*tcqueue.S3ArtifactResponse)
 
 	task.Infof("Uploading artifact %v from file %v with content encoding %q, mime type %q and expiry %v", s3Artifact.Name, s3Artifact.Path, s3Artifact.ContentEncoding, s3Artifact.ContentType, s3Artifact.Expires)
-	transferContentFile := s3Artifact.CreateTempFileForPUTBody()
-	defer os.Remove(transferContentFile)
 
 	// perform http PUT to upload to S3...
 	httpClient := &http.Client{}
+	var transferContentLength int64
 	httpCall := func() (putResp *http.Response, tempError error, permError error) {
-		var transferContent *os.File
-		transferContent, permError = os.Open(transferContentFile)
+		var transferContent io.ReadCloser
+		transferContent, transferContentLength, permError = s3Artifact.PUTBody(config.ChunkedArtifactUploads)
 		if permError != nil {
 			return
 		}
 		defer transferContent.Close()
-		var transferContentFileInfo os.FileInfo
-		transferContentFileInfo, permError = transferContent.Stat()
-		if permError != nil {
-			return
-		}
-		transferContentLength := transferContentFileInfo.Size()
+		counter := &countingReader{reader: transferContent}
+		defer func() {
+			transferContentLength = counter.bytes
+		}()
 
 		var httpRequest *http.Request
-		httpRequest, permError = http.NewRequest("PUT", response.PutURL, transferContent)
+		// the claim expiry watchdog cancels uploads that would otherwise
+		// outlive the task claim
+		httpRequest, permError = http.NewRequestWithContext(task.uploadContext(), "PUT", response.PutURL, throttledReader(counter, task.uploadThrottles))
 		if permError != nil {
 			return
 		}
 		httpRequest.Header.Set("Content-Type", response.ContentType)
 		httpRequest.ContentLength = transferContentLength
+		if transferContentLength == 0 {
+			// otherwise the body would be sent with chunked transfer encoding
+			httpRequest.Body = http.NoBody
+		}
 		if enc := s3Artifact.ContentEncoding; enc != "" {
 			httpRequest.Header.Set("Content-Encoding", enc)
 		}
@@ -214,6 +273,9 @@ func (s3Artifact *S3Artifact) ProcessResponse(resp interface{}, task *TaskRun) (
 		}
 		putResp, tempError = httpClient.Do(httpRequest)
 		if tempError != nil {
+			if task.uploadsCancelled() {
+				permError, tempError = tempError, nil
+			}
 			return
 		}
 		// bug 1394557: s3 incorrectly returns HTTP 400 for connection inactivity,
@@ -225,6 +287,10 @@ func (s3Artifact *S3Artifact) ProcessResponse(resp interface{}, task *TaskRun) (
 	}
 	putResp, putAttempts, err := httpbackoff.Retry(httpCall)
 	log.Printf("%v put requests issued to %v", putAttempts, response.PutURL)
+	if err == nil {
+		task.resourceUsage.addUploaded(transferContentLength)
+		task.queueArtifactMirror(s3Artifact.Name, filepath.Join(taskContext.TaskDir, s3Artifact.Path), s3Artifact.ContentType)
+	}
 	if putResp != nil {
 		defer putResp.Body.Close()
 		respBody, dumpError := httputil.DumpResponse(putResp, true)
@@ -326,6 +392,15 @@ func (task *TaskRun) PayloadArtifacts() []TaskArtifact {
 // TODO: need to also handle "too-large-file-on-worker"
 func resolve(base *BaseArtifact, artifactType string, path string, contentType string, contentEncoding string) TaskArtifact {
 	fullPath := filepath.Join(taskContext.TaskDir, path)
+	// e.g. a file called nul, which Windows would open as a device
+	if err := fileutil.ValidatePath(path); err != nil {
+		return &ErrorArtifact{
+			BaseArtifact: base,
+			Message:      fmt.Sprintf("Cannot publish %s '%s': %v", artifactType, fullPath, err),
+			Reason:       "invalid-resource-on-worker",
+			Path:         path,
+		}
+	}
 	fileReader, err := os.Open(fullPath)
 	if err != nil {
 		// cannot read file/dir, create an error artifact
@@ -450,7 +525,13 @@ func (task *TaskRun) uploadLog(name, path string) *CommandExecutionError {
 }
 
 func (task *TaskRun) uploadArtifact(artifact TaskArtifact) *CommandExecutionError {
+	artifact.Base().Name = publishedArtifactName(artifact.Base().Name)
+	if task.uploadsCancelled() {
+		return ClaimExpiring(fmt.Errorf("Not uploading artifact %v since the task claim is about to expire", artifact.Base().Name))
+	}
+	task.artifactsMux.Lock()
 	task.Artifacts[artifact.Base().Name] = artifact
+	task.artifactsMux.Unlock()
 	payload, err := json.Marshal(artifact.RequestObject())
 	if err != nil {
 		panic(err)
@@ -518,6 +599,11 @@ func (task *TaskRun) uploadArtifact(artifact TaskArtifact) *CommandExecutionErro
 	e = artifact.ProcessResponse(resp, task)
 	if e != nil {
 		task.Errorf("Error uploading artifact: %v", e)
+		if task.uploadsCancelled() {
+			return ClaimExpiring(fmt.Errorf("Aborted upload of artifact %v since the task claim is about to expire", artifact.Base().Name))
+		}
+	} else {
+		task.auditArtifact(artifact)
 	}
 	// note: ResourceUnavailable(nil) returns nil, so this only returns an error if e != nil
 	return ResourceUnavailable(e)
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -711,3 +714,68 @@ func TestEmptyContentEncoding(t *testing.T) {
 		t.Fatalf("Was expecting log file to explain that contentEncoding was invalid, but it doesn't: \n%v", logtext)
 	}
 }
+
+func TestS3ArtifactPUTBody(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: dir,
+	}
+	defer func() {
+		taskContext = oldTaskContext
+	}()
+	content := strings.Repeat("hello world!\n", 100000)
+	err = ioutil.WriteFile(filepath.Join(dir, "live_backing.log"), []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		contentEncoding string
+		chunked         bool
+	}{
+		{"gzip", false},
+		{"gzip", true},
+		{"identity", false},
+	} {
+		artifact := &S3Artifact{
+			Path:            "live_backing.log",
+			ContentEncoding: test.contentEncoding,
+		}
+		body, length, err := artifact.PUTBody(test.chunked)
+		if err != nil {
+			t.Fatalf("Could not create PUT body for content encoding %v: %v", test.contentEncoding, err)
+		}
+		data, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case test.chunked && length != -1:
+			t.Errorf("Was expecting unknown length for chunked upload, but got %v", length)
+		case !test.chunked && length != int64(len(data)):
+			t.Errorf("Content encoding %v: reported length %v does not match length %v of body", test.contentEncoding, length, len(data))
+		}
+		if test.contentEncoding == "gzip" {
+			if len(data) >= len(content) {
+				t.Errorf("Body of %v bytes was not compressed", len(data))
+			}
+			reader, err := gzip.NewReader(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err = ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if string(data) != content {
+			t.Errorf("Content encoding %v: body does not match file content", test.contentEncoding)
+		}
+	}
+}
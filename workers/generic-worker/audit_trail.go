@@ -0,0 +1,285 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const auditTrailArtifactName = "public/logs/audit-trail.jsonl"
+
+// actions recorded in the audit trail
+const (
+	auditTaskStarted      = "task-started"
+	auditCredentialsUsed  = "credentials-used"
+	auditContentMounted   = "content-mounted"
+	auditSecretFetched    = "secret-fetched"
+	auditCommandStarted   = "command-started"
+	auditCommandFinished  = "command-finished"
+	auditArtifactUploaded = "artifact-uploaded"
+	auditTaskFinished     = "task-finished"
+)
+
+// path, relative to task directory, of the audit trail
+var auditTrailPath = filepath.Join("generic-worker", "audit-trail.jsonl")
+
+type (
+	// AuditTrailFeature records the significant actions of tasks in an
+	// append-only audit trail, if enabled in the worker config
+	AuditTrailFeature struct {
+	}
+
+	AuditTrailTask struct {
+		task *TaskRun
+	}
+
+	// AuditTrail is a hash chain of the actions of a task. Each entry is
+	// written as a single line of JSON, and includes the SHA256 of the line
+	// of the previous entry, so that removing, reordering or modifying
+	// entries breaks the chain. The SHA256 of the line of the last entry is
+	// included in the chain of trust certificate.
+	AuditTrail struct {
+		mutex   sync.Mutex
+		file    *os.File
+		entries uint
+		head    string
+		closed  bool
+	}
+
+	// AuditEntry is a line of the audit trail
+	AuditEntry struct {
+		Sequence uint        `json:"sequence"`
+		Time     time.Time   `json:"time"`
+		Action   string      `json:"action"`
+		Details  interface{} `json:"details,omitempty"`
+		// SHA256 of the line of the previous entry, or "" for the first
+		// entry
+		PreviousSHA256 string `json:"previousSha256"`
+	}
+
+	// AuditTrailSummary is included in the chain of trust certificate
+	AuditTrailSummary struct {
+		Artifact string `json:"artifact"`
+		Entries  uint   `json:"entries"`
+		// SHA256 of the line of the last entry
+		HeadSHA256 string `json:"headSha256"`
+	}
+)
+
+func (feature *AuditTrailFeature) Name() string {
+	return "Audit Trail"
+}
+
+func (feature *AuditTrailFeature) Initialise() error {
+	return nil
+}
+
+func (feature *AuditTrailFeature) PersistState() error {
+	return nil
+}
+
+// Audit trails are enabled for all tasks by the worker config
+func (feature *AuditTrailFeature) IsEnabled(task *TaskRun) bool {
+	return config.EnableAuditTrail
+}
+
+// NewTaskFeature creates the audit trail of the task straight away, rather
+// than in Start(), since task features are all created before any are
+// started, so that the features started before this one can record their
+// actions too
+func (feature *AuditTrailFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	file := filepath.Join(taskContext.TaskDir, auditTrailPath)
+	err := os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		panic(err)
+	}
+	trail, err := NewAuditTrail(file)
+	if err != nil {
+		panic(err)
+	}
+	task.auditTrail = trail
+	task.audit(auditTaskStarted, map[string]interface{}{
+		"taskId":      task.TaskID,
+		"runId":       task.RunID,
+		"workerGroup": config.WorkerGroup,
+		"workerId":    config.WorkerID,
+	})
+	task.audit(auditCredentialsUsed, map[string]interface{}{
+		"clientId": task.TaskClaimResponse.Credentials.ClientID,
+		"purpose":  "task",
+	})
+	return &AuditTrailTask{
+		task: task,
+	}
+}
+
+func (at *AuditTrailTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (at *AuditTrailTask) ReservedArtifacts() []string {
+	return []string{
+		auditTrailArtifactName,
+	}
+}
+
+func (at *AuditTrailTask) Start() *CommandExecutionError {
+	at.task.beforeCommand = append(at.task.beforeCommand, func(index int) {
+		at.task.audit(auditCommandStarted, map[string]interface{}{
+			"index":   index,
+			"command": at.task.formatCommand(index),
+		})
+	})
+	at.task.afterCommand = append(at.task.afterCommand, func(index int, result *process.Result) {
+		at.task.audit(auditCommandFinished, map[string]interface{}{
+			"index":    index,
+			"exitCode": result.ExitCode(),
+		})
+	})
+	return nil
+}
+
+// Stop closes the audit trail and publishes it. The audit trail feature is
+// stopped before the chain of trust feature, so that the audit trail is
+// covered by the chain of trust certificate. Artifacts uploaded after it has
+// been closed are therefore not recorded.
+func (at *AuditTrailTask) Stop(err *ExecutionErrors) {
+	at.task.audit(auditTaskFinished, nil)
+	e := at.task.auditTrail.Close()
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[audit] Could not write audit trail: %v", e)))
+		return
+	}
+	at.task.Infof("[audit] Publishing audit trail with %v entries as %v", at.task.auditTrail.Summary().Entries, auditTrailArtifactName)
+	err.add(at.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    auditTrailArtifactName,
+				Expires: at.task.Definition.Expires,
+			},
+			ContentType:     "text/plain; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            auditTrailPath,
+		},
+	))
+}
+
+// NewAuditTrail creates an empty audit trail that is written to the given
+// file
+func NewAuditTrail(file string) (*AuditTrail, error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditTrail{
+		file: f,
+	}, nil
+}
+
+// Record appends an entry for the given action to the audit trail. Entries
+// recorded after the audit trail has been closed are dropped.
+func (trail *AuditTrail) Record(action string, details interface{}) error {
+	trail.mutex.Lock()
+	defer trail.mutex.Unlock()
+	if trail.closed {
+		return nil
+	}
+	line, err := json.Marshal(&AuditEntry{
+		Sequence:       trail.entries,
+		Time:           time.Now().UTC(),
+		Action:         action,
+		Details:        details,
+		PreviousSHA256: trail.head,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = trail.file.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(line)
+	trail.head = hex.EncodeToString(hash[:])
+	trail.entries++
+	return nil
+}
+
+// Close stops recording entries, and closes the file of the audit trail
+func (trail *AuditTrail) Close() error {
+	trail.mutex.Lock()
+	defer trail.mutex.Unlock()
+	if trail.closed {
+		return nil
+	}
+	trail.closed = true
+	return trail.file.Close()
+}
+
+// Summary returns the summary of the audit trail for the chain of trust
+// certificate
+func (trail *AuditTrail) Summary() *AuditTrailSummary {
+	trail.mutex.Lock()
+	defer trail.mutex.Unlock()
+	return &AuditTrailSummary{
+		Artifact:   auditTrailArtifactName,
+		Entries:    trail.entries,
+		HeadSHA256: trail.head,
+	}
+}
+
+// audit records the given action in the audit trail of the task, if it has
+// one. The audit trail is additional evidence, so problems writing it are
+// logged rather than failing the task.
+func (task *TaskRun) audit(action string, details interface{}) {
+	if task.auditTrail == nil {
+		return
+	}
+	if err := task.auditTrail.Record(action, details); err != nil {
+		task.Warnf("[audit] Could not record %v in audit trail: %v", action, err)
+	}
+}
+
+// auditMount records the given mount in the audit trail of the task, with
+// the SHA256 of its content, if the content has been downloaded
+func (task *TaskRun) auditMount(mount MountEntry) {
+	if task.auditTrail == nil {
+		return
+	}
+	details := map[string]interface{}{
+		"mount": mount,
+	}
+	if c, err := mount.FSContent(); err == nil && c != nil {
+		if cache, inCache := fileCaches[c.UniqueKey()]; inCache {
+			details["sha256"] = cache.SHA256
+		}
+	}
+	task.audit(auditContentMounted, details)
+}
+
+// auditArtifact records the given uploaded artifact in the audit trail of
+// the task, with the SHA256 of its content, if it is stored by the queue
+func (task *TaskRun) auditArtifact(artifact TaskArtifact) {
+	if task.auditTrail == nil {
+		return
+	}
+	details := map[string]interface{}{
+		"name": artifact.Base().Name,
+	}
+	if a, isS3 := artifact.(*S3Artifact); isS3 {
+		hash, err := fileutil.CalculateSHA256(filepath.Join(taskContext.TaskDir, a.Path))
+		if err != nil {
+			task.Warnf("[audit] Could not calculate SHA256 of artifact %v: %v", a.Name, err)
+		}
+		details["sha256"] = hash
+	}
+	task.audit(auditArtifactUploaded, details)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// verifyAuditTrail checks the hash chain of the given audit trail, and
+// returns its entries
+func verifyAuditTrail(t *testing.T, data []byte) []AuditEntry {
+	t.Helper()
+	entries := []AuditEntry{}
+	previous := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Could not read audit trail entry %v: %v", len(entries), err)
+		}
+		if entry.Sequence != uint(len(entries)) || entry.PreviousSHA256 != previous {
+			t.Fatalf("Audit trail hash chain is broken at entry %v", len(entries))
+		}
+		hash := sha256.Sum256(scanner.Bytes())
+		previous = hex.EncodeToString(hash[:])
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditTrail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit-trail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "audit-trail.jsonl")
+	trail, err := NewAuditTrail(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{auditTaskStarted, auditCommandStarted, auditArtifactUploaded} {
+		if err := trail.Record(action, map[string]interface{}{"action": action}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trail.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// dropped, since the audit trail is closed
+	if err := trail.Record(auditTaskFinished, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := verifyAuditTrail(t, data)
+	if len(entries) != 3 || entries[1].Action != auditCommandStarted {
+		t.Fatalf("Was expecting 3 entries in the audit trail, but got %#v", entries)
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	hash := sha256.Sum256(bytes.TrimSuffix(lines[2], []byte("\n")))
+	summary := trail.Summary()
+	if summary.Entries != 3 || summary.HeadSHA256 != hex.EncodeToString(hash[:]) {
+		t.Fatalf("Was expecting summary of audit trail to reference its last entry, but got %#v", summary)
+	}
+
+	// modifying an entry breaks the chain
+	tampered := bytes.Replace(data, []byte(auditCommandStarted), []byte(auditCommandFinished), 1)
+	tamperedEntries := []AuditEntry{}
+	previous := ""
+	for _, line := range bytes.Split(bytes.TrimSuffix(tampered, []byte("\n")), []byte("\n")) {
+		var entry AuditEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.PreviousSHA256 != previous {
+			break
+		}
+		h := sha256.Sum256(line)
+		previous = hex.EncodeToString(h[:])
+		tamperedEntries = append(tamperedEntries, entry)
+	}
+	if len(tamperedEntries) != 2 {
+		t.Fatalf("Was expecting hash chain to break after modified entry, but %v entries were intact", len(tamperedEntries))
+	}
+}
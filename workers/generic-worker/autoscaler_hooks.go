@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+)
+
+// Lifecycle events of the worker that are signalled to the autoscaler hook of
+// config setting autoscalerHook
+const (
+	// the worker has no task to run, so can be terminated
+	lifecycleBecameIdle = "became-idle"
+	// the worker has claimed a task, so must not be terminated until it
+	// finishes
+	lifecycleStartedTask = "started-task"
+	// the worker has resolved its task
+	lifecycleFinishedTask = "finished-task"
+	// the worker has found itself unable to run tasks, and should be replaced
+	lifecycleUnhealthy = "unhealthy"
+)
+
+// maximum time that an autoscaler hook command may take
+const autoscalerHookCommandTimeout = time.Minute
+
+// the hook of config setting autoscalerHook, or nil if not set
+var autoscalerHook AutoscalerHook
+
+// the lifecycle event that was last signalled to autoscalerHook
+var lastLifecycleEvent string
+
+// AutoscalerHook tells the autoscaler of the worker pool about lifecycle
+// events of the worker, so that it never terminates the worker while it runs
+// a task
+type AutoscalerHook interface {
+	Signal(event string) error
+	String() string
+}
+
+// AWSAutoscalerHook toggles the scale-in protection of the EC2 instance of the
+// worker in its Auto Scaling group, and reports the instance as unhealthy,
+// so that the Auto Scaling group replaces it
+type AWSAutoscalerHook struct {
+	InstanceID  string
+	autoScaling autoscalingiface.AutoScalingAPI
+	// looked up on first use
+	group string
+}
+
+// CommandAutoscalerHook runs a command for each lifecycle event, with the
+// event as its last argument, e.g. to notify a host agent
+type CommandAutoscalerHook struct {
+	Command []string
+}
+
+// initialiseAutoscalerHook sets autoscalerHook from the worker config
+func initialiseAutoscalerHook() error {
+	autoscalerHook = nil
+	lastLifecycleEvent = ""
+	switch config.AutoscalerHook {
+	case "":
+		return nil
+	case "aws":
+		if config.InstanceID == "" || config.Region == "" {
+			return fmt.Errorf(`Config settings "instanceId" and "region" must be defined when "autoscalerHook" is "aws"`)
+		}
+		sess, err := session.NewSession(aws.NewConfig().WithRegion(config.Region))
+		if err != nil {
+			return fmt.Errorf("Could not create AWS session for autoscaler hook: %v", err)
+		}
+		autoscalerHook = &AWSAutoscalerHook{
+			InstanceID:  config.InstanceID,
+			autoScaling: autoscaling.New(sess),
+		}
+	case "command":
+		if len(config.AutoscalerHookCommand) == 0 {
+			return fmt.Errorf(`Config setting "autoscalerHookCommand" must be defined when "autoscalerHook" is "command"`)
+		}
+		autoscalerHook = &CommandAutoscalerHook{
+			Command: config.AutoscalerHookCommand,
+		}
+	default:
+		return fmt.Errorf(`Config setting "autoscalerHook" has unsupported value %q - allowed values are "", "aws" and "command"`, config.AutoscalerHook)
+	}
+	log.Printf("Signalling lifecycle events to autoscaler hook %v", autoscalerHook)
+	return nil
+}
+
+// signalAutoscaler signals the given lifecycle event to autoscalerHook, if
+// set. The worker only becomes idle once until it starts another task. A
+// failure to signal the autoscaler is logged, but doesn't stop the worker.
+func signalAutoscaler(event string) {
+	if autoscalerHook == nil {
+		return
+	}
+	if event == lifecycleBecameIdle && lastLifecycleEvent == lifecycleBecameIdle {
+		return
+	}
+	lastLifecycleEvent = event
+	err := autoscalerHook.Signal(event)
+	if err != nil {
+		log.Printf("WARNING: Could not signal lifecycle event %v to autoscaler hook %v: %v", event, autoscalerHook, err)
+	}
+}
+
+func (h *AWSAutoscalerHook) Signal(event string) error {
+	switch event {
+	case lifecycleStartedTask, lifecycleBecameIdle:
+		group, err := h.autoScalingGroup()
+		if err != nil {
+			return err
+		}
+		_, err = h.autoScaling.SetInstanceProtection(&autoscaling.SetInstanceProtectionInput{
+			AutoScalingGroupName: aws.String(group),
+			InstanceIds:          []*string{aws.String(h.InstanceID)},
+			ProtectedFromScaleIn: aws.Bool(event == lifecycleStartedTask),
+		})
+		return err
+	case lifecycleUnhealthy:
+		_, err := h.autoScaling.SetInstanceHealth(&autoscaling.SetInstanceHealthInput{
+			InstanceId:               aws.String(h.InstanceID),
+			HealthStatus:             aws.String("Unhealthy"),
+			ShouldRespectGracePeriod: aws.Bool(false),
+		})
+		return err
+	}
+	// the instance stays protected between consecutive tasks, until the
+	// worker becomes idle
+	return nil
+}
+
+// autoScalingGroup returns the name of the Auto Scaling group of the instance
+func (h *AWSAutoscalerHook) autoScalingGroup() (string, error) {
+	if h.group != "" {
+		return h.group, nil
+	}
+	out, err := h.autoScaling.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []*string{aws.String(h.InstanceID)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.AutoScalingInstances) == 0 {
+		return "", fmt.Errorf("Instance %v is not in an Auto Scaling group", h.InstanceID)
+	}
+	h.group = aws.StringValue(out.AutoScalingInstances[0].AutoScalingGroupName)
+	return h.group, nil
+}
+
+func (h *AWSAutoscalerHook) String() string {
+	return "aws"
+}
+
+func (h *CommandAutoscalerHook) Signal(event string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), autoscalerHookCommandTimeout)
+	defer cancel()
+	args := append(append([]string{}, h.Command[1:]...), event)
+	out, err := exec.CommandContext(ctx, h.Command[0], args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v (output: %q)", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (h *CommandAutoscalerHook) String() string {
+	return fmt.Sprintf("%q", h.Command)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/autoscaling/autoscalingiface"
+)
+
+// fakeAutoScaling records the calls of AWSAutoscalerHook
+type fakeAutoScaling struct {
+	autoscalingiface.AutoScalingAPI
+	describeCalls int
+	protected     []bool
+	unhealthy     int
+}
+
+func (f *fakeAutoScaling) DescribeAutoScalingInstances(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	f.describeCalls++
+	return &autoscaling.DescribeAutoScalingInstancesOutput{
+		AutoScalingInstances: []*autoscaling.InstanceDetails{
+			{
+				AutoScalingGroupName: aws.String("workers"),
+				InstanceId:           input.InstanceIds[0],
+			},
+		},
+	}, nil
+}
+
+func (f *fakeAutoScaling) SetInstanceProtection(input *autoscaling.SetInstanceProtectionInput) (*autoscaling.SetInstanceProtectionOutput, error) {
+	if aws.StringValue(input.AutoScalingGroupName) != "workers" || aws.StringValue(input.InstanceIds[0]) != "i-123" {
+		panic("unexpected instance " + input.String())
+	}
+	f.protected = append(f.protected, aws.BoolValue(input.ProtectedFromScaleIn))
+	return &autoscaling.SetInstanceProtectionOutput{}, nil
+}
+
+func (f *fakeAutoScaling) SetInstanceHealth(input *autoscaling.SetInstanceHealthInput) (*autoscaling.SetInstanceHealthOutput, error) {
+	if aws.StringValue(input.HealthStatus) == "Unhealthy" {
+		f.unhealthy++
+	}
+	return &autoscaling.SetInstanceHealthOutput{}, nil
+}
+
+func TestAWSAutoscalerHook(t *testing.T) {
+	fake := &fakeAutoScaling{}
+	autoscalerHook = &AWSAutoscalerHook{
+		InstanceID:  "i-123",
+		autoScaling: fake,
+	}
+	lastLifecycleEvent = ""
+	defer func() {
+		autoscalerHook = nil
+	}()
+	for _, event := range []string{
+		lifecycleBecameIdle,
+		lifecycleBecameIdle,
+		lifecycleStartedTask,
+		lifecycleFinishedTask,
+		lifecycleStartedTask,
+		lifecycleFinishedTask,
+		lifecycleBecameIdle,
+		lifecycleUnhealthy,
+	} {
+		signalAutoscaler(event)
+	}
+	// protection is only toggled when the worker becomes idle or starts a
+	// task, and the worker only becomes idle once until it starts a task
+	expected := []bool{false, true, true, false}
+	if len(fake.protected) != len(expected) {
+		t.Fatalf("Was expecting instance protection %v but got %v", expected, fake.protected)
+	}
+	for i := range expected {
+		if fake.protected[i] != expected[i] {
+			t.Fatalf("Was expecting instance protection %v but got %v", expected, fake.protected)
+		}
+	}
+	if fake.describeCalls != 1 {
+		t.Fatalf("Was expecting Auto Scaling group to be looked up once, but was looked up %v times", fake.describeCalls)
+	}
+	if fake.unhealthy != 1 {
+		t.Fatalf("Was expecting instance to be set unhealthy once, but was set unhealthy %v times", fake.unhealthy)
+	}
+}
+
+func TestCommandAutoscalerHook(t *testing.T) {
+	hook := &CommandAutoscalerHook{
+		Command: []string{"go", "version"},
+	}
+	if err := hook.Signal(lifecycleStartedTask); err == nil {
+		t.Fatal("Was expecting an error from a command that rejects the event argument")
+	}
+	hook = &CommandAutoscalerHook{
+		Command: []string{"go", "env"},
+	}
+	if err := hook.Signal("GOOS"); err != nil {
+		t.Fatalf("Was expecting command to succeed, but got: %v", err)
+	}
+}
@@ -90,6 +90,7 @@ func AWSUpdateConfig(c *gwconfig.Config) (awsMetadata map[string][]byte, err err
 	c.PrivateIP = net.ParseIP(iid.PrivateIP)
 	c.InstanceID = iid.InstanceID
 	c.InstanceType = iid.InstanceType
+	c.ImageID = iid.ImageID
 	c.AvailabilityZone = iid.AvailabilityZone
 
 	// Don't override WorkerLocation if configuration specifies an explicit
@@ -33,6 +33,16 @@ type (
 			Location   string `json:"location"`
 			VMID       string `json:"vmId"`
 			VMSize     string `json:"vmSize"`
+			// StorageProfile.ImageReference.ID is only set for custom images
+			StorageProfile struct {
+				ImageReference struct {
+					ID        string `json:"id"`
+					Offer     string `json:"offer"`
+					Publisher string `json:"publisher"`
+					SKU       string `json:"sku"`
+					Version   string `json:"version"`
+				} `json:"imageReference"`
+			} `json:"storageProfile"`
 		} `json:"compute"`
 		Network struct {
 			Interface []struct {
@@ -52,6 +62,19 @@ type (
 	}
 )
 
+// ImageID returns the resource ID of the custom image of the instance, or the
+// URN (publisher:offer:sku:version) of its marketplace image
+func (md *AzureMetaData) ImageID() string {
+	image := md.Compute.StorageProfile.ImageReference
+	if image.ID != "" {
+		return image.ID
+	}
+	if image.Publisher == "" {
+		return ""
+	}
+	return image.Publisher + ":" + image.Offer + ":" + image.SKU + ":" + image.Version
+}
+
 func queryAzureMetaData(client *http.Client, path string, apiVersion string) ([]byte, error) {
 	req, err := http.NewRequest("GET", AzureMetadataBaseURL+path+"?api-version="+apiVersion, nil)
 
@@ -111,6 +134,7 @@ func (g *AzureConfigProvider) UpdateConfig(c *gwconfig.Config) error {
 	}
 	c.InstanceID = azureMetaData.Compute.VMID
 	c.InstanceType = azureMetaData.Compute.VMSize
+	c.ImageID = azureMetaData.ImageID()
 	c.AvailabilityZone = azureMetaData.Compute.Location
 	c.Region = azureMetaData.Compute.Location
 
@@ -76,6 +76,7 @@ if ${ALL_PLATFORMS}; then
 
   install multiuser linux   amd64
   install docker    linux   amd64
+  install kubernetes linux  amd64
   install simple    linux   amd64
   install simple    linux   arm
   install simple    linux   arm64
@@ -86,6 +87,7 @@ else
       linux) install simple    "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
              install multiuser "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
              install docker    "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
+             install kubernetes "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
              ;;
      darwin) install simple    "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
              install multiuser "${MY_GOHOSTOS}" "${MY_GOHOSTARCH}"
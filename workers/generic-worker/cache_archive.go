@@ -0,0 +1,574 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// A cache archive holds a writable directory cache that is mounted with
+// paths, so that only those paths need to be extracted when the cache is
+// mounted, rather than the whole cache. It is a tar stream (without the
+// end-of-archive marker) compressed as a sequence of independent zstd frames,
+// in the seekable zstd format, see
+// https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+// so `zstd -d` decompresses the whole cache. The last frame before the seek
+// table is a skippable frame with the index of the archive entries, which
+// records the frame and offset of the tar header of each entry.
+//
+// A new frame is started after an entry once the current frame holds
+// cacheArchiveFrameSize bytes of tar stream, and large files are split
+// across frames of cacheArchiveMaxFrameSize bytes. Since frames that start
+// with a tar header only hold whole entries, together with the frames that
+// continue them, they can be copied to a new cache archive without
+// recompressing them when none of their entries have changed.
+const (
+	cacheArchiveFrameSize    = 4 << 20
+	cacheArchiveMaxFrameSize = 16 << 20
+	// skippable frame magic numbers
+	cacheArchiveIndexMagic = 0x184D2A50
+	zstdSeekTableMagic     = 0x184D2A5E
+	// magic number of the seek table footer
+	zstdSeekableMagic = 0x8F92EAB1
+	// size of the seek table footer
+	zstdSeekTableFooterSize = 9
+)
+
+type (
+	// cacheArchiveIndex lists the entries of a cache archive, in the order of
+	// the tar stream
+	cacheArchiveIndex struct {
+		Entries []cacheArchiveEntry `json:"entries"`
+	}
+
+	cacheArchiveEntry struct {
+		// slash separated path relative to the cache directory
+		Name string `json:"name"`
+		// the frame, and offset in the decompressed frame, of the tar header
+		// of the entry
+		Frame  int   `json:"frame"`
+		Offset int64 `json:"offset"`
+	}
+
+	// cacheArchiveFrame is an entry of the seek table of a cache archive
+	cacheArchiveFrame struct {
+		CompressedSize   uint32
+		DecompressedSize uint32
+	}
+
+	// cacheArchive is a cache archive that has been opened for reading
+	cacheArchive struct {
+		file *os.File
+		// the frames of the tar stream, and their offsets in the file
+		frames  []cacheArchiveFrame
+		offsets []int64
+		index   cacheArchiveIndex
+		// the decompressed frame that is being read, and reading position
+		frame int
+		data  []byte
+		pos   int64
+	}
+
+	// cacheArchiveWriter writes a new cache archive. Its Write method is
+	// called by its tar writer, with the tar stream.
+	cacheArchiveWriter struct {
+		file   *os.File
+		tar    *tar.Writer
+		buf    bytes.Buffer
+		frames []cacheArchiveFrame
+		index  cacheArchiveIndex
+	}
+)
+
+// checkZstd returns an error if the zstd command, which compresses and
+// decompresses cache archives, is not installed
+func checkZstd() error {
+	_, err := exec.LookPath("zstd")
+	if err != nil {
+		return fmt.Errorf("zstd is required for cache archives, but is not installed on the worker: %v", err)
+	}
+	return nil
+}
+
+// zstd runs the zstd command with the given arguments, on the given input
+func zstd(input []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("zstd", append([]string{"-q", "-c"}, args...)...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("zstd %v: %v: %v", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// inCachePaths returns true if the archive entry name is one of the given
+// paths, or inside one of them
+func inCachePaths(name string, paths []string) bool {
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+		if name == p || strings.HasPrefix(name, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// openCacheArchive opens the given cache archive, and reads its seek table
+// and index
+func openCacheArchive(file string) (ca *cacheArchive, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			err = fmt.Errorf("invalid cache archive %v: %v", file, err)
+		}
+	}()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, zstdSeekTableFooterSize)
+	if info.Size() < 8+int64(len(footer)) {
+		return nil, fmt.Errorf("file is too small")
+	}
+	_, err = f.ReadAt(footer, info.Size()-int64(len(footer)))
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != zstdSeekableMagic || footer[4] != 0 {
+		return nil, fmt.Errorf("no seek table")
+	}
+	n := int64(binary.LittleEndian.Uint32(footer))
+	tableSize := 8 + 8*n + zstdSeekTableFooterSize
+	if n < 1 || tableSize > info.Size() {
+		return nil, fmt.Errorf("seek table of %v frames doesn't fit in %v bytes", n, info.Size())
+	}
+	table := make([]byte, tableSize)
+	_, err = f.ReadAt(table, info.Size()-tableSize)
+	if err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(table) != zstdSeekTableMagic || int64(binary.LittleEndian.Uint32(table[4:])) != tableSize-8 {
+		return nil, fmt.Errorf("invalid seek table header")
+	}
+	ca = &cacheArchive{
+		file:  f,
+		frame: -1,
+	}
+	var offset int64
+	for i := int64(0); i < n; i++ {
+		frame := cacheArchiveFrame{
+			CompressedSize:   binary.LittleEndian.Uint32(table[8+8*i:]),
+			DecompressedSize: binary.LittleEndian.Uint32(table[12+8*i:]),
+		}
+		ca.frames = append(ca.frames, frame)
+		ca.offsets = append(ca.offsets, offset)
+		offset += int64(frame.CompressedSize)
+	}
+	if offset != info.Size()-tableSize {
+		return nil, fmt.Errorf("frames of seek table take %v bytes, but file has %v bytes before seek table", offset, info.Size()-tableSize)
+	}
+	// the last frame is the index
+	indexFrame, err := ca.rawFrames(int(n)-1, int(n))
+	if err != nil {
+		return nil, err
+	}
+	if len(indexFrame) < 8 || binary.LittleEndian.Uint32(indexFrame) != cacheArchiveIndexMagic {
+		return nil, fmt.Errorf("no index")
+	}
+	err = json.Unmarshal(indexFrame[8:], &ca.index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index: %v", err)
+	}
+	ca.frames, ca.offsets = ca.frames[:n-1], ca.offsets[:n-1]
+	for _, entry := range ca.index.Entries {
+		if entry.Frame < 0 || entry.Frame >= len(ca.frames) || entry.Offset < 0 || entry.Offset >= int64(ca.frames[entry.Frame].DecompressedSize) {
+			return nil, fmt.Errorf("index entry %v is outside of the archive", entry.Name)
+		}
+	}
+	return ca, nil
+}
+
+func (ca *cacheArchive) Close() error {
+	return ca.file.Close()
+}
+
+// rawFrames returns the compressed frames from first up to (but not
+// including) last
+func (ca *cacheArchive) rawFrames(first, last int) ([]byte, error) {
+	size := int64(0)
+	for _, frame := range ca.frames[first:last] {
+		size += int64(frame.CompressedSize)
+	}
+	data := make([]byte, size)
+	_, err := ca.file.ReadAt(data, ca.offsets[first])
+	return data, err
+}
+
+// seek positions the tar stream at the given offset of the given frame
+func (ca *cacheArchive) seek(frame int, offset int64) error {
+	if frame != ca.frame {
+		raw, err := ca.rawFrames(frame, frame+1)
+		if err != nil {
+			return err
+		}
+		ca.data, err = zstd(raw, "-d")
+		if err != nil {
+			return err
+		}
+		if len(ca.data) != int(ca.frames[frame].DecompressedSize) {
+			return fmt.Errorf("frame %v has %v bytes, but seek table says %v", frame, len(ca.data), ca.frames[frame].DecompressedSize)
+		}
+		ca.frame = frame
+	}
+	ca.pos = offset
+	return nil
+}
+
+// Read reads the tar stream from the current position, continuing into the
+// following frames
+func (ca *cacheArchive) Read(p []byte) (int, error) {
+	for ca.pos >= int64(len(ca.data)) {
+		if ca.frame+1 >= len(ca.frames) {
+			return 0, io.EOF
+		}
+		err := ca.seek(ca.frame+1, 0)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, ca.data[ca.pos:])
+	ca.pos += int64(n)
+	return n, nil
+}
+
+// entry returns the tar reader of the given archive entry, positioned at its
+// content
+func (ca *cacheArchive) entry(entry cacheArchiveEntry) (*tar.Reader, *tar.Header, error) {
+	err := ca.seek(entry.Frame, entry.Offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	tr := tar.NewReader(ca)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%v: %v", entry.Name, err)
+	}
+	if path.Clean(hdr.Name) != entry.Name {
+		return nil, nil, fmt.Errorf("index entry %v is archive entry %v", entry.Name, hdr.Name)
+	}
+	return tr, hdr, nil
+}
+
+// extract extracts the archive entries that are inside the given paths into
+// dir, which must be inside the task directory, or all archive entries if no
+// paths are given, and returns how many it extracted
+func (ca *cacheArchive) extract(dir string, paths []string) (extracted int, err error) {
+	for _, entry := range ca.index.Entries {
+		if len(paths) > 0 && !inCachePaths(entry.Name, paths) {
+			continue
+		}
+		// an earlier entry could be a symbolic link to a directory
+		// elsewhere on the worker
+		rel, err := filepath.Rel(taskContext.TaskDir, filepath.Join(dir, filepath.FromSlash(entry.Name)))
+		if err == nil {
+			_, err = resolveTaskPath(rel)
+		}
+		if err != nil {
+			return extracted, err
+		}
+		tr, hdr, err := ca.entry(entry)
+		if err != nil {
+			return extracted, err
+		}
+		err = fileutil.ExtractTarEntry(tr, hdr, fileutil.LongPath(dir))
+		if err != nil {
+			return extracted, fmt.Errorf("%v: %v", entry.Name, err)
+		}
+		extracted++
+	}
+	return extracted, nil
+}
+
+// writeCacheArchive writes a new cache archive of dir to file. If old is not
+// nil, the entries of the old cache archive that are outside of the given
+// paths are added too, unless dir holds the same path, or one of its parent
+// directories as something other than a directory.
+func writeCacheArchive(file, dir string, old *cacheArchive, paths []string) (err error) {
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	w := &cacheArchiveWriter{
+		file: f,
+	}
+	w.tar = tar.NewWriter(w)
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	root := fileutil.LongPath(dir)
+	// whether each path of dir is a directory
+	written := map[string]bool{}
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		written[name] = info.IsDir()
+		return w.addFile(p, name, info)
+	})
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		err = w.copyEntries(old, func(name string) bool {
+			if inCachePaths(name, paths) {
+				return false
+			}
+			if _, exists := written[name]; exists {
+				return false
+			}
+			for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+				if isDir, exists := written[parent]; exists && !isDir {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
+
+// Write adds tar stream data to the current frame, writing out frames of
+// cacheArchiveMaxFrameSize bytes
+func (w *cacheArchiveWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for w.buf.Len() >= cacheArchiveMaxFrameSize {
+		err := w.writeFrame(w.buf.Next(cacheArchiveMaxFrameSize))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// writeFrame compresses the given tar stream data as a new frame
+func (w *cacheArchiveWriter) writeFrame(data []byte) error {
+	compressed, err := zstd(data)
+	if err != nil {
+		return err
+	}
+	return w.writeRawFrames(compressed, cacheArchiveFrame{
+		CompressedSize:   uint32(len(compressed)),
+		DecompressedSize: uint32(len(data)),
+	})
+}
+
+func (w *cacheArchiveWriter) writeRawFrames(data []byte, frames ...cacheArchiveFrame) error {
+	_, err := w.file.Write(data)
+	if err != nil {
+		return err
+	}
+	w.frames = append(w.frames, frames...)
+	return nil
+}
+
+// flush writes out the current frame, if it has any data
+func (w *cacheArchiveWriter) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	w.buf.Reset()
+	return w.writeFrame(data)
+}
+
+// addEntry adds an archive entry with the given header and content
+func (w *cacheArchiveWriter) addEntry(name string, hdr *tar.Header, content io.Reader) error {
+	w.index.Entries = append(w.index.Entries, cacheArchiveEntry{
+		Name:   name,
+		Frame:  len(w.frames),
+		Offset: int64(w.buf.Len()),
+	})
+	err := w.tar.WriteHeader(hdr)
+	if err != nil {
+		return err
+	}
+	if content != nil {
+		_, err = io.CopyN(w.tar, content, hdr.Size)
+		if err != nil {
+			return err
+		}
+	}
+	err = w.tar.Flush()
+	if err != nil || w.buf.Len() < cacheArchiveFrameSize {
+		return err
+	}
+	return w.flush()
+}
+
+// addFile adds the file p of dir as archive entry name. Files other than
+// regular files, directories and symbolic links, such as sockets, are not
+// added, and hard links are added as separate files.
+func (w *cacheArchiveWriter) addFile(p, name string, info os.FileInfo) error {
+	link := ""
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		var err error
+		link, err = os.Readlink(p)
+		if err != nil {
+			return err
+		}
+	case !info.IsDir() && !info.Mode().IsRegular():
+		return nil
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	// the cache is owned by the task user of the task that mounts it
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if !info.Mode().IsRegular() {
+		return w.addEntry(name, hdr, nil)
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// the task could have replaced the file in the meantime, for example
+	// with a symbolic link to a file that it can't read
+	opened, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, opened) {
+		return fmt.Errorf("%v was replaced while archiving it", p)
+	}
+	return w.addEntry(name, hdr, file)
+}
+
+// copyEntries adds the entries of the old cache archive that keep returns
+// true for. Frames whose entries are all kept are copied without
+// decompressing them.
+func (w *cacheArchiveWriter) copyEntries(old *cacheArchive, keep func(name string) bool) error {
+	entries := old.index.Entries
+	for len(entries) > 0 {
+		// the entries of the frames up to the next frame that starts with a
+		// tar header
+		first := entries[0].Frame
+		n := 1
+		for n < len(entries) && (entries[n].Frame == first || entries[n].Offset != 0) {
+			n++
+		}
+		last := len(old.frames)
+		if n < len(entries) {
+			last = entries[n].Frame
+		}
+		kept := 0
+		for _, entry := range entries[:n] {
+			if keep(entry.Name) {
+				kept++
+			}
+		}
+		switch {
+		case kept == n && entries[0].Offset == 0:
+			err := w.flush()
+			if err != nil {
+				return err
+			}
+			raw, err := old.rawFrames(first, last)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries[:n] {
+				entry.Frame += len(w.frames) - first
+				w.index.Entries = append(w.index.Entries, entry)
+			}
+			err = w.writeRawFrames(raw, old.frames[first:last]...)
+			if err != nil {
+				return err
+			}
+		case kept > 0:
+			for _, entry := range entries[:n] {
+				if !keep(entry.Name) {
+					continue
+				}
+				tr, hdr, err := old.entry(entry)
+				if err != nil {
+					return err
+				}
+				err = w.addEntry(entry.Name, hdr, tr)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// Close writes out the current frame, the index, and the seek table
+func (w *cacheArchiveWriter) Close() error {
+	err := w.flush()
+	if err != nil {
+		return err
+	}
+	index, err := json.Marshal(&w.index)
+	if err != nil {
+		return err
+	}
+	indexFrame := make([]byte, 8, 8+len(index))
+	binary.LittleEndian.PutUint32(indexFrame, cacheArchiveIndexMagic)
+	binary.LittleEndian.PutUint32(indexFrame[4:], uint32(len(index)))
+	err = w.writeRawFrames(append(indexFrame, index...), cacheArchiveFrame{
+		CompressedSize: uint32(8 + len(index)),
+	})
+	if err != nil {
+		return err
+	}
+	table := make([]byte, 8, 8+8*len(w.frames)+zstdSeekTableFooterSize)
+	binary.LittleEndian.PutUint32(table, zstdSeekTableMagic)
+	binary.LittleEndian.PutUint32(table[4:], uint32(8*len(w.frames)+zstdSeekTableFooterSize))
+	entry := make([]byte, 8)
+	for _, frame := range w.frames {
+		binary.LittleEndian.PutUint32(entry, frame.CompressedSize)
+		binary.LittleEndian.PutUint32(entry[4:], frame.DecompressedSize)
+		table = append(table, entry...)
+	}
+	footer := make([]byte, zstdSeekTableFooterSize)
+	binary.LittleEndian.PutUint32(footer, uint32(len(w.frames)))
+	binary.LittleEndian.PutUint32(footer[5:], zstdSeekableMagic)
+	_, err = w.file.Write(append(table, footer...))
+	return err
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func skipWithoutZstd(t *testing.T) {
+	if err := checkZstd(); err != nil {
+		t.Skip(err)
+	}
+}
+
+// cacheArchiveTestDir creates a task directory and sets taskContext to it,
+// and returns it, and a function that restores taskContext and removes it
+func cacheArchiveTestDir(t *testing.T) (string, func()) {
+	t.Helper()
+	taskDir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: taskDir,
+	}
+	return taskDir, func() {
+		taskContext = oldTaskContext
+		os.RemoveAll(taskDir)
+	}
+}
+
+// writeTestFiles creates the given files in dir, with their content
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for file, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readTestFiles returns the content of the files in dir, keyed by their slash
+// separated relative path
+func readTestFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func extractTestCacheArchive(t *testing.T, file, dir string, paths ...string) (extracted int) {
+	t.Helper()
+	ca, err := openCacheArchive(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Close()
+	extracted, err = ca.extract(dir, paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return extracted
+}
+
+func TestCacheArchive(t *testing.T) {
+	skipWithoutZstd(t)
+	taskDir, cleanup := cacheArchiveTestDir(t)
+	defer cleanup()
+	// larger than a frame, so that it is split across frames
+	large := make([]byte, cacheArchiveMaxFrameSize+cacheArchiveFrameSize)
+	rand.New(rand.NewSource(1)).Read(large)
+	files := map[string]string{
+		"a/1.txt":   "one",
+		"a/b/2.txt": "two",
+		"c/3.txt":   "three",
+		"large.bin": string(large),
+		"z.txt":     "last",
+	}
+	cacheDir := filepath.Join(taskDir, "cache")
+	writeTestFiles(t, cacheDir, files)
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink("a/1.txt", filepath.Join(cacheDir, "link")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive := filepath.Join(taskDir, "cache.tar.zst")
+	if err := writeCacheArchive(archive, cacheDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// zstd decompresses the whole cache archive as a tar stream
+	data, err := ioutil.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = zstd(data, "-d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	expected := []string{"a/", "a/1.txt", "a/b/", "a/b/2.txt", "c/", "c/3.txt", "large.bin", "link", "z.txt"}
+	if runtime.GOOS == "windows" {
+		expected = []string{"a/", "a/1.txt", "a/b/", "a/b/2.txt", "c/", "c/3.txt", "large.bin", "z.txt"}
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Was expecting decompressed cache archive to have entries %q but got %q", expected, names)
+	}
+
+	partial := filepath.Join(taskDir, "partial")
+	if n := extractTestCacheArchive(t, archive, partial, "a/b", "z.txt"); n != 3 {
+		t.Errorf("Was expecting 3 entries to be extracted, but %v were", n)
+	}
+	if got := readTestFiles(t, partial); !reflect.DeepEqual(got, map[string]string{"a/b/2.txt": "two", "z.txt": "last"}) {
+		t.Fatalf("Unexpected files extracted for paths a/b and z.txt: %q", got)
+	}
+
+	whole := filepath.Join(taskDir, "whole")
+	extractTestCacheArchive(t, archive, whole)
+	if got := readTestFiles(t, whole); !reflect.DeepEqual(got, files) {
+		t.Fatalf("Whole cache archive was not extracted correctly, got files %v", sortedKeys(got))
+	}
+	if runtime.GOOS != "windows" {
+		if link, err := os.Readlink(filepath.Join(whole, "link")); err != nil || link != "a/1.txt" {
+			t.Fatalf("Was expecting symbolic link to a/1.txt, but got %q (%v)", link, err)
+		}
+	}
+}
+
+func TestCacheArchiveUpdate(t *testing.T) {
+	skipWithoutZstd(t)
+	taskDir, cleanup := cacheArchiveTestDir(t)
+	defer cleanup()
+	cacheDir := filepath.Join(taskDir, "cache")
+	// enough files to fill several frames, whose frames are copied unchanged
+	large := make([]byte, cacheArchiveFrameSize/2)
+	rand.New(rand.NewSource(2)).Read(large)
+	writeTestFiles(t, cacheDir, map[string]string{
+		"src/main.go":   "package main",
+		"src/old.go":    "package old",
+		"deps/1.bin":    string(large),
+		"deps/2.bin":    string(large),
+		"deps/3.bin":    string(large),
+		"file/kept.txt": "replaced by a file",
+		"same.txt":      "old",
+	})
+	archive := filepath.Join(taskDir, "cache.tar.zst")
+	if err := writeCacheArchive(archive, cacheDir, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	old, err := openCacheArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer old.Close()
+
+	// a task that mounted path src, removed src/old.go, and also wrote
+	// other files of the cache
+	taskCacheDir := filepath.Join(taskDir, "task-cache")
+	writeTestFiles(t, taskCacheDir, map[string]string{
+		"src/main.go": "package main // changed",
+		"src/new.go":  "package new",
+		"file":        "a file",
+		"same.txt":    "new",
+	})
+	updated := filepath.Join(taskDir, "updated.tar.zst")
+	if err := writeCacheArchive(updated, taskCacheDir, old, []string{"src"}); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(taskDir, "extracted")
+	extractTestCacheArchive(t, updated, dir)
+	expected := map[string]string{
+		"src/main.go": "package main // changed",
+		"src/new.go":  "package new",
+		"deps/1.bin":  string(large),
+		"deps/2.bin":  string(large),
+		"deps/3.bin":  string(large),
+		"file":        "a file",
+		"same.txt":    "new",
+	}
+	if got := readTestFiles(t, dir); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Updated cache archive was not correct, got files %v", sortedKeys(got))
+	}
+
+	// the unchanged frames of deps are copied
+	data, err := ioutil.ReadFile(updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range old.index.Entries {
+		if entry.Name != "deps/2.bin" {
+			continue
+		}
+		raw, err := old.rawFrames(entry.Frame, entry.Frame+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, raw) {
+			t.Fatal("Was expecting unchanged frame of deps/2.bin to be copied to updated cache archive")
+		}
+	}
+}
+
+func TestCacheArchiveOutsideTaskDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symbolic links requires a privilege on Windows")
+	}
+	skipWithoutZstd(t)
+	taskDir, cleanup := cacheArchiveTestDir(t)
+	defer cleanup()
+	outside, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	// a cache archive that can't be created from a directory, with a file
+	// inside a symbolic link to a directory outside of the task directory
+	archive := filepath.Join(taskDir, "cache.tar.zst")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &cacheArchiveWriter{
+		file: f,
+	}
+	w.tar = tar.NewWriter(w)
+	if err := w.addEntry("link", &tar.Header{Typeflag: tar.TypeSymlink, Name: "link", Linkname: outside}, nil); err != nil {
+		t.Fatal(err)
+	}
+	content := "escaped"
+	if err := w.addEntry("link/file", &tar.Header{Typeflag: tar.TypeReg, Name: "link/file", Mode: 0644, Size: int64(len(content))}, bytes.NewBufferString(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ca, err := openCacheArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ca.Close()
+	if _, err := ca.extract(filepath.Join(taskDir, "cache"), nil); err == nil {
+		t.Fatal("Was expecting extracting a file through a symbolic link outside of the task directory to fail")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "file")); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting no file to be written outside of the task directory, but got %v", err)
+	}
+}
+
+func TestInvalidCacheArchive(t *testing.T) {
+	taskDir, cleanup := cacheArchiveTestDir(t)
+	defer cleanup()
+	archive := filepath.Join(taskDir, "cache.tar.zst")
+	if err := ioutil.WriteFile(archive, []byte("not a seekable zstd archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openCacheArchive(archive); err == nil {
+		t.Fatal("Was expecting an invalid cache archive not to be opened")
+	}
+}
+
+func TestInCachePaths(t *testing.T) {
+	for name, in := range map[string]bool{
+		"src":        true,
+		"src/a/b.go": true,
+		"srcs":       false,
+		"lib/x":      true,
+		"lib":        false,
+		"other":      false,
+	} {
+		if inCachePaths(name, []string{"src/", filepath.Join("lib", "x")}) != in {
+			t.Errorf("Was expecting inCachePaths(%q) to be %v", name, in)
+		}
+	}
+}
+
+func TestWritableDirectoryCachePathsValidation(t *testing.T) {
+	for paths, valid := range map[string]bool{
+		`["src", "deps/lib"]`: true,
+		`["../outside"]`:      false,
+		`["."]`:               false,
+		`["src/../.."]`:       false,
+	} {
+		task := &TaskRun{}
+		task.Payload.Mounts = []json.RawMessage{
+			json.RawMessage(`{"cacheName": "build", "directory": "build", "paths": ` + paths + `}`),
+		}
+		tm := (&MountsFeature{}).NewTaskFeature(task).(*TaskMount)
+		if (tm.payloadError == nil) != valid {
+			t.Errorf("Was expecting paths %v to be valid: %v, but got error: %v", paths, valid, tm.payloadError)
+		}
+	}
+}
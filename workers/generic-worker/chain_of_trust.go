@@ -40,23 +40,43 @@ type ArtifactHash struct {
 	SHA256 string `json:"sha256"`
 }
 
+// ArtifactSignature is a detached signature of an artifact, published by the
+// Artifact Signing feature
+type ArtifactSignature struct {
+	// ID of the key of config setting artifactSigningKeys that signed the
+	// artifact
+	KeyID string `json:"keyId"`
+	// name of the artifact with the signature
+	Signature string `json:"signature"`
+}
+
 type CoTEnvironment struct {
 	PublicIPAddress  string `json:"publicIpAddress"`
 	PrivateIPAddress string `json:"privateIpAddress"`
 	InstanceID       string `json:"instanceId"`
 	InstanceType     string `json:"instanceType"`
 	Region           string `json:"region"`
+	// only set if known, for backward compatibility
+	ImageID          string `json:"imageId,omitempty"`
+	AvailabilityZone string `json:"availabilityZone,omitempty"`
+	// SHA256 of artifact public/machine-inventory.json, if published
+	MachineInventorySHA256 string `json:"machineInventorySha256,omitempty"`
 }
 
 type ChainOfTrustData struct {
-	Version     int                            `json:"chainOfTrustVersion"`
-	Artifacts   map[string]ArtifactHash        `json:"artifacts"`
-	Task        tcqueue.TaskDefinitionResponse `json:"task"`
-	TaskID      string                         `json:"taskId"`
-	RunID       uint                           `json:"runId"`
-	WorkerGroup string                         `json:"workerGroup"`
-	WorkerID    string                         `json:"workerId"`
-	Environment CoTEnvironment                 `json:"environment"`
+	Version      int                            `json:"chainOfTrustVersion"`
+	Artifacts    map[string]ArtifactHash        `json:"artifacts"`
+	Task         tcqueue.TaskDefinitionResponse `json:"task"`
+	TaskID       string                         `json:"taskId"`
+	RunID        uint                           `json:"runId"`
+	WorkerGroup  string                         `json:"workerGroup"`
+	WorkerID     string                         `json:"workerId"`
+	Environment  CoTEnvironment                 `json:"environment"`
+	Fetches      []ResolvedFetch                `json:"fetches,omitempty"`
+	Reproducible *ReproducibleSettings          `json:"reproducible,omitempty"`
+	AuditTrail   *AuditTrailSummary             `json:"auditTrail,omitempty"`
+	// artifact signatures, by name of the signed artifact
+	Signatures map[string]ArtifactSignature `json:"signatures,omitempty"`
 }
 
 type ChainOfTrustTaskFeature struct {
@@ -68,6 +88,14 @@ func (feature *ChainOfTrustFeature) Name() string {
 	return "Chain of Trust"
 }
 
+func (feature *ChainOfTrustFeature) PayloadName() string {
+	return "chainOfTrust"
+}
+
+func (feature *ChainOfTrustFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
 func (feature *ChainOfTrustFeature) PersistState() error {
 	return nil
 }
@@ -103,9 +131,9 @@ func (feature *ChainOfTrustTaskFeature) ReservedArtifacts() []string {
 	}
 }
 
-func (feature *ChainOfTrustTaskFeature) RequiredScopes() scopes.Required {
+func (feature *ChainOfTrustTaskFeature) RequiredScopes() scopes.Expression {
 	// let's not require any scopes, as I see no reason to control access to this feature
-	return scopes.Required{}
+	return scopes.AllOf{}
 }
 
 func (feature *ChainOfTrustTaskFeature) Start() *CommandExecutionError {
@@ -161,7 +189,25 @@ func (feature *ChainOfTrustTaskFeature) Stop(err *ExecutionErrors) {
 			InstanceID:       config.InstanceID,
 			InstanceType:     config.InstanceType,
 			Region:           config.Region,
+			ImageID:          config.ImageID,
+			AvailabilityZone: config.AvailabilityZone,
+			// machine inventory is published when the task starts
+			MachineInventorySHA256: feature.task.machineInventorySHA256,
 		},
+		Fetches:      feature.task.resolvedFetches,
+		Reproducible: feature.task.reproducible,
+	}
+	if feature.task.auditTrail != nil {
+		cotCert.AuditTrail = feature.task.auditTrail.Summary()
+	}
+	for name, keyID := range feature.task.artifactSignatures {
+		if cotCert.Signatures == nil {
+			cotCert.Signatures = map[string]ArtifactSignature{}
+		}
+		cotCert.Signatures[name] = ArtifactSignature{
+			KeyID:     keyID,
+			Signature: name + ".sig",
+		}
 	}
 
 	certBytes, e := json.MarshalIndent(cotCert, "", "  ")
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// file that holds the number of consecutive tasks that have failed with
+// infrastructure problems, since the worker may reboot between tasks
+const circuitBreakerFile = "consecutive-infra-failures.txt"
+
+// mount failures that suggest a problem with the disk or network of the
+// worker, rather than with the content that the task mounts (such as a
+// missing artifact or a SHA256 mismatch)
+var transientMountFailure = regexp.MustCompile(`(?i)no space left on device|connection refused|connection reset|i/o timeout|no such host|network is unreachable|TLS handshake timeout|Could not persist cache`)
+
+// CircuitBreaker quarantines the worker in the queue when too many
+// consecutive tasks fail in a way that suggests the worker itself is broken
+// (see config setting circuitBreakerThreshold), so that a broken machine
+// doesn't resolve every pending task as a failure
+type CircuitBreaker struct {
+	threshold uint
+	duration  time.Duration
+	patterns  []*regexp.Regexp
+	failures  uint
+}
+
+func NewCircuitBreaker(threshold uint, duration time.Duration, patterns []string) *CircuitBreaker {
+	cb := &CircuitBreaker{
+		threshold: threshold,
+		duration:  duration,
+	}
+	for _, pattern := range patterns {
+		// patterns have already been validated by config.Validate()
+		cb.patterns = append(cb.patterns, regexp.MustCompile(pattern))
+	}
+	if b, err := ioutil.ReadFile(circuitBreakerFile); err == nil {
+		if i, err := strconv.Atoi(strings.TrimSpace(string(b))); err == nil && i > 0 {
+			cb.failures = uint(i)
+		}
+	}
+	return cb
+}
+
+// infraFailure returns whether the given task errors look like a problem with
+// the worker rather than with the task
+func (cb *CircuitBreaker) infraFailure(errors *ExecutionErrors) bool {
+	if !errors.Occurred() {
+		return false
+	}
+	for _, err := range *errors {
+		// task authors may map exit codes to any reason, including
+		// internal-error
+		if err.exitStatusMapping {
+			continue
+		}
+		switch err.Reason {
+		case internalError, resourceUnavailable:
+			return true
+		case malformedPayload, workerShutdown, superseded:
+			continue
+		}
+		if err.Cause == nil {
+			continue
+		}
+		message := err.Cause.Error()
+		if strings.HasPrefix(message, "[mounts] ") && transientMountFailure.MatchString(message) {
+			return true
+		}
+		for _, pattern := range cb.patterns {
+			if pattern.MatchString(message) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Record records the outcome of a task (or a crash of the worker, which counts
+// as an infrastructure failure), returning true if the worker has been
+// quarantined as a result
+func (cb *CircuitBreaker) Record(infraFailure bool) (tripped bool) {
+	if cb.threshold == 0 {
+		return false
+	}
+	if !infraFailure {
+		cb.setFailures(0)
+		return false
+	}
+	cb.setFailures(cb.failures + 1)
+	if cb.failures < cb.threshold {
+		log.Printf("WARNING: %v consecutive task(s) failed with infrastructure problems (circuit breaker threshold %v)", cb.failures, cb.threshold)
+		return false
+	}
+	log.Printf("WARNING: %v consecutive tasks failed with infrastructure problems - quarantining worker for %v", cb.failures, cb.duration)
+	logEventWithFields("workerCircuitBreakerTripped", nil, time.Now(), map[string]interface{}{
+		"consecutiveFailures": cb.failures,
+		"quarantineSecs":      int64(cb.duration / time.Second),
+	})
+	err := quarantine(config.Queue(), cb.duration)
+	if err != nil {
+		log.Printf("WARNING: Could not quarantine worker: %v", err)
+		return false
+	}
+	cb.setFailures(0)
+	return true
+}
+
+func (cb *CircuitBreaker) setFailures(failures uint) {
+	if cb.failures == failures {
+		return
+	}
+	cb.failures = failures
+	err := ioutil.WriteFile(circuitBreakerFile, []byte(strconv.Itoa(int(failures))), 0600)
+	if err == nil {
+		err = fileutil.SecureFiles(circuitBreakerFile)
+	}
+	if err != nil {
+		log.Printf("WARNING: Could not write %v: %v", circuitBreakerFile, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestCircuitBreakerInfraFailure(t *testing.T) {
+	cb := NewCircuitBreaker(3, time.Hour, []string{"^No space left"})
+	defer os.Remove(circuitBreakerFile)
+	for _, test := range []struct {
+		errors ExecutionErrors
+		infra  bool
+	}{
+		{ExecutionErrors{}, false},
+		{ExecutionErrors{&CommandExecutionError{TaskStatus: failed, Cause: fmt.Errorf("exit code 1")}}, false},
+		{ExecutionErrors{MalformedPayloadError(fmt.Errorf("[mounts] task.dependencies needs to include abc"))}, false},
+		{ExecutionErrors{Failure(fmt.Errorf("[mounts] Could not fetch from task abc"))}, false},
+		{ExecutionErrors{Failure(fmt.Errorf("[mounts] Download of x has SHA256 abc but task definition explicitly requires def"))}, false},
+		{ExecutionErrors{Failure(fmt.Errorf("[mounts] Could not fetch from https://example.com/x: dial tcp: connection refused"))}, true},
+		{ExecutionErrors{Failure(fmt.Errorf("[mounts] Could not persist cache \"x\" due to rename failed"))}, true},
+		{ExecutionErrors{&CommandExecutionError{TaskStatus: errored, Reason: internalError, Cause: fmt.Errorf("Exit code 7 found in task payload.onExitStatus.exception list"), exitStatusMapping: true}}, false},
+		{ExecutionErrors{executionError(internalError, errored, fmt.Errorf("oops"))}, true},
+		{ExecutionErrors{ResourceUnavailable(fmt.Errorf("no ports"))}, true},
+		{ExecutionErrors{Failure(fmt.Errorf("No space left on device"))}, true},
+	} {
+		if infra := cb.infraFailure(&test.errors); infra != test.infra {
+			t.Errorf("Was expecting infraFailure(%v) to be %v but was %v", test.errors.Error(), test.infra, infra)
+		}
+	}
+}
+
+func TestCircuitBreakerTrips(t *testing.T) {
+	quarantined := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/api/queue/v1/provisioners/test-provisioner/worker-types/test-worker-type/workers/test-worker-group/test-worker-id" {
+			t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		quarantined++
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ProvisionerID: "test-provisioner",
+			RootURL:       server.URL,
+			WorkerGroup:   "test-worker-group",
+			WorkerID:      "test-worker-id",
+			WorkerType:    "test-worker-type",
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	defer os.Remove(circuitBreakerFile)
+
+	cb := NewCircuitBreaker(3, time.Hour, nil)
+	if cb.Record(true) || cb.Record(false) || cb.Record(true) || cb.Record(true) {
+		t.Fatal("Circuit breaker should only trip after 3 consecutive infrastructure failures")
+	}
+	// the count survives a restart of the worker
+	cb = NewCircuitBreaker(3, time.Hour, nil)
+	if !cb.Record(true) {
+		t.Fatal("Was expecting circuit breaker to trip")
+	}
+	if quarantined != 1 {
+		t.Fatalf("Was expecting worker to be quarantined once, but was quarantined %v times", quarantined)
+	}
+	if cb.failures != 0 {
+		t.Fatalf("Was expecting failure count to be reset after tripping, but is %v", cb.failures)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+// Claim Expiry Watchdog
+// ---------------------
+// If the claim of a task expires, the queue resolves the run as
+// exception/claim-expired and may schedule a new run of the task on another
+// worker, even though this worker may still be running it. The claim is
+// renewed by the reclaim go routine, but reclaims can fail, and artifact
+// uploads can hang, so a separate watchdog guarantees that the task is
+// aborted config.ClaimExpiryMarginSecs before the claim expires, unless the
+// claim has been renewed by then. This leaves enough time to resolve the run
+// as exception/worker-shutdown, so that the queue retries the task straight
+// away.
+
+// watchClaimExpiry aborts the task margin before the claim that expires at
+// takenUntil expires, unless a renewed claim is received on tsm.claimRenewed
+// first, or tsm.stopWatchingClaim is closed.
+func (tsm *TaskStatusManager) watchClaimExpiry(takenUntil tcclient.Time, margin time.Duration) {
+	for {
+		// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+		deadline := time.Time(takenUntil).Add(-margin).Round(0)
+		log.Printf("Claim expiry watchdog will abort task %v at %v unless the claim is renewed", tsm.task.TaskID, deadline)
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-tsm.stopWatchingClaim:
+			timer.Stop()
+			return
+		case takenUntil = <-tsm.claimRenewed:
+			timer.Stop()
+		case <-timer.C:
+			tsm.claimExpiring(takenUntil)
+			return
+		}
+	}
+}
+
+// notifyClaimRenewed passes the expiry of a renewed claim to the claim expiry
+// watchdog, replacing any earlier renewal that it has not seen yet. It must
+// only be called when tsm.Lock() is held by caller.
+func (tsm *TaskStatusManager) notifyClaimRenewed(takenUntil tcclient.Time) {
+	select {
+	case <-tsm.claimRenewed:
+	default:
+	}
+	tsm.claimRenewed <- takenUntil
+}
+
+// stopWatchingClaimExpiry stops the claim expiry watchdog. It must only be
+// called when tsm.Lock() is held by caller.
+func (tsm *TaskStatusManager) stopWatchingClaimExpiry() {
+	// don't wait for the watchdog to exit, since it may be waiting for
+	// tsm.Lock() in order to abort the task
+	if !tsm.finishedWatchingClaim {
+		close(tsm.stopWatchingClaim)
+		tsm.finishedWatchingClaim = true
+	}
+}
+
+// claimExpiring aborts the task, and any artifact uploads in progress, since
+// the claim that expires at takenUntil has not been renewed in time
+func (tsm *TaskStatusManager) claimExpiring(takenUntil tcclient.Time) {
+	log.Printf("WARNING: claim of task %v run %v expires at %v and has not been renewed - aborting task", tsm.task.TaskID, tsm.task.RunID, takenUntil)
+	logEvent("claimExpiring", tsm.task, time.Now())
+	// cancelling uploads doesn't require tsm.Lock(), which a hanging reclaim
+	// may be holding
+	tsm.cancelUploads()
+	err := tsm.Abort(ClaimExpiring(fmt.Errorf("[claim expiry watchdog] Task claim expires at %v and could not be renewed - aborting task", takenUntil)))
+	if err != nil {
+		log.Printf("WARNING: could not abort task %v before its claim expires: %v", tsm.task.TaskID, err)
+	}
+}
+
+// ClaimExpiring returns an error that resolves the task as
+// exception/worker-shutdown, so that the queue retries it, because its claim
+// is about to expire
+func ClaimExpiring(err error) *CommandExecutionError {
+	return executionError(workerShutdown, errored, err)
+}
+
+// uploadContext returns the context of artifact uploads of the task, which is
+// cancelled by the claim expiry watchdog
+func (task *TaskRun) uploadContext() context.Context {
+	// e.g. orphaned runs have no status manager
+	if task.StatusManager == nil {
+		return context.Background()
+	}
+	return task.StatusManager.uploads
+}
+
+// uploadsCancelled returns whether artifact uploads of the task have been
+// cancelled by the claim expiry watchdog
+func (task *TaskRun) uploadsCancelled() bool {
+	return task.uploadContext().Err() != nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// claimedTask returns a claimed task whose claim expires in the given
+// duration, with the claim expiry watchdog aborting it a second before then
+func claimedTask(expiresIn time.Duration) (task *TaskRun, teardown func()) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ClaimExpiryMarginSecs: 1,
+		},
+	}
+	task = &TaskRun{
+		TaskID:    "KTBKfEgxR5GdfIIREQIvFQ",
+		Status:    claimed,
+		logWriter: &bytes.Buffer{},
+	}
+	task.TaskClaimResponse.TakenUntil = tcclient.Time(time.Now().Add(expiresIn))
+	task.StatusManager = NewTaskStatusManager(task)
+	return task, func() {
+		task.StatusManager.Lock()
+		task.StatusManager.stopReclaims()
+		task.StatusManager.Unlock()
+		config = nil
+	}
+}
+
+func waitForAbort(task *TaskRun, timeout time.Duration) *CommandExecutionError {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if ae := task.StatusManager.AbortException(); ae != nil {
+			return ae
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return nil
+}
+
+func TestClaimExpiryWatchdogAbortsTask(t *testing.T) {
+	task, teardown := claimedTask(2*time.Second)
+	defer teardown()
+	ae := waitForAbort(task, 5*time.Second)
+	if ae == nil {
+		t.Fatal("Was expecting task to be aborted before its claim expires")
+	}
+	if ae.Reason != workerShutdown || ae.TaskStatus != errored {
+		t.Fatalf("Was expecting task to be resolved as exception/worker-shutdown, but got %v/%v", ae.TaskStatus, ae.Reason)
+	}
+	if !task.uploadsCancelled() {
+		t.Fatal("Was expecting artifact uploads to be cancelled")
+	}
+	if cee := task.uploadArtifact(&S3Artifact{BaseArtifact: &BaseArtifact{Name: "public/build/a.txt"}}); cee == nil || cee.Reason != workerShutdown {
+		t.Fatalf("Was expecting artifact upload to be refused, but got %v", cee)
+	}
+}
+
+func TestClaimExpiryWatchdogRenewedClaim(t *testing.T) {
+	task, teardown := claimedTask(2*time.Second)
+	defer teardown()
+	task.StatusManager.Lock()
+	task.StatusManager.notifyClaimRenewed(tcclient.Time(time.Now().Add(time.Hour)))
+	task.StatusManager.Unlock()
+	if ae := waitForAbort(task, 3*time.Second); ae != nil {
+		t.Fatalf("Was not expecting task with renewed claim to be aborted, but got %v", ae)
+	}
+	if task.uploadsCancelled() {
+		t.Fatal("Was not expecting artifact uploads to be cancelled")
+	}
+}
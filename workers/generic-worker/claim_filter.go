@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// claimFilterMismatch returns why the given task doesn't match the
+// claimFilterRoutes and claimFilterTags config settings, or the empty string
+// if it does
+func claimFilterMismatch(definition *tcqueue.TaskDefinitionResponse) string {
+	routes := map[string]bool{}
+	for _, route := range definition.Routes {
+		routes[route] = true
+	}
+	for _, route := range config.ClaimFilterRoutes {
+		if !routes[route] {
+			return fmt.Sprintf("task does not have route %q", route)
+		}
+	}
+	// sorted, so that the reported mismatch is deterministic
+	keys := make([]string, 0, len(config.ClaimFilterTags))
+	for key := range config.ClaimFilterTags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, exists := definition.Tags[key]; !exists || value != config.ClaimFilterTags[key] {
+			return fmt.Sprintf("task does not have tag %v=%q", key, config.ClaimFilterTags[key])
+		}
+	}
+	return ""
+}
+
+// declineTask hands a claimed task that this worker shouldn't run back to the
+// queue. The queue has no way to release a claim, and resolving the run as
+// exception with reason worker-shutdown would count against the retries of
+// the task, so instead the run is resolved as exception with reason
+// resource-unavailable, and the task is rerun, which creates a new pending
+// run without affecting its retries.
+func declineTask(task *TaskRun, mismatch string) {
+	log.Printf("Declining task %v run %v since %v", task.TaskID, task.RunID, mismatch)
+	logEventWithFields("taskDeclined", task, time.Now(), map[string]interface{}{
+		"reason": mismatch,
+	})
+	err := task.StatusManager.ReportException(resourceUnavailable)
+	if err != nil {
+		log.Printf("WARNING: Could not resolve declined task %v: %v", task.TaskID, err)
+		return
+	}
+	_, err = config.Queue().RerunTask(task.TaskID)
+	if err != nil {
+		log.Printf("WARNING: Could not rerun declined task %v - it will need to be rerun manually: %v", task.TaskID, err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestClaimFilterMismatch(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ClaimFilterRoutes: []string{"index.hardware.gpu"},
+			ClaimFilterTags: map[string]string{
+				"peripheral": "gpu",
+			},
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	for _, test := range []struct {
+		routes   []string
+		tags     map[string]string
+		mismatch string
+	}{
+		{
+			routes: []string{"notify.email.a@b.c", "index.hardware.gpu"},
+			tags:   map[string]string{"peripheral": "gpu", "kind": "test"},
+		},
+		{
+			tags:     map[string]string{"peripheral": "gpu"},
+			mismatch: `task does not have route "index.hardware.gpu"`,
+		},
+		{
+			routes:   []string{"index.hardware.gpu"},
+			tags:     map[string]string{"peripheral": "usb"},
+			mismatch: `task does not have tag peripheral="gpu"`,
+		},
+		{
+			routes:   []string{"index.hardware.gpu"},
+			mismatch: `task does not have tag peripheral="gpu"`,
+		},
+	} {
+		definition := &tcqueue.TaskDefinitionResponse{
+			Routes: test.routes,
+			Tags:   test.tags,
+		}
+		if mismatch := claimFilterMismatch(definition); mismatch != test.mismatch {
+			t.Errorf("Was expecting mismatch %q for routes %v and tags %v but got %q", test.mismatch, test.routes, test.tags, mismatch)
+		}
+	}
+
+	// no filters match every task
+	config.ClaimFilterRoutes = nil
+	config.ClaimFilterTags = nil
+	if mismatch := claimFilterMismatch(&tcqueue.TaskDefinitionResponse{}); mismatch != "" {
+		t.Errorf("Was expecting task to match when no claim filters are configured, but got %q", mismatch)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// cloudInstance is the identity of the cloud instance that the worker runs
+// on, as reported by the metadata service of the cloud
+type cloudInstance struct {
+	// key of the worker type metadata of the instance
+	cloud            string
+	metadata         map[string]interface{}
+	instanceID       string
+	instanceType     string
+	imageID          string
+	region           string
+	availabilityZone string
+	publicIP         net.IP
+	privateIP        net.IP
+	workerLocation   interface{}
+}
+
+// cloudInstances are the functions that query the metadata service of each
+// cloud that config setting cloudMetadata supports
+var cloudInstances = map[string]func() (*cloudInstance, error){
+	"aws":   awsInstance,
+	"azure": azureInstance,
+	"gcp":   gcpInstance,
+}
+
+// updateConfigFromCloudMetadata sets the identity of the worker from the
+// metadata service of the cloud of config setting cloudMetadata. It is
+// applied on top of the config file, which should then be applied again, so
+// that only settings that the config file doesn't set come from the metadata.
+func updateConfigFromCloudMetadata(c *gwconfig.Config) error {
+	query, supported := cloudInstances[c.CloudMetadata]
+	if !supported {
+		return fmt.Errorf(`Config setting "cloudMetadata" has unsupported value %q - allowed values are "", "aws", "azure" and "gcp"`, c.CloudMetadata)
+	}
+	log.Printf("Querying %v metadata to get worker identity...", c.CloudMetadata)
+	instance, err := query()
+	if err != nil {
+		return fmt.Errorf("Could not query %v metadata (config setting cloudMetadata): %v", c.CloudMetadata, err)
+	}
+	c.WorkerTypeMetadata[instance.cloud] = instance.metadata
+	c.WorkerID = instance.instanceID
+	c.WorkerGroup = instance.region
+	c.InstanceID = instance.instanceID
+	c.InstanceType = instance.instanceType
+	c.ImageID = instance.imageID
+	c.Region = instance.region
+	c.AvailabilityZone = instance.availabilityZone
+	if instance.publicIP != nil {
+		c.PublicIP = instance.publicIP
+	}
+	if instance.privateIP != nil {
+		c.PrivateIP = instance.privateIP
+	}
+	if c.WorkerLocation == "" {
+		workerLocationJSON, err := json.Marshal(instance.workerLocation)
+		if err != nil {
+			return fmt.Errorf("Error encoding worker location %#v as JSON: %v", instance.workerLocation, err)
+		}
+		c.WorkerLocation = string(workerLocationJSON)
+	}
+	return nil
+}
+
+func awsInstance() (*cloudInstance, error) {
+	document, err := queryAWSMetaData(EC2MetadataBaseURL + "/dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+	iid := new(InstanceIdentityDocument)
+	err = json.Unmarshal(document, iid)
+	if err != nil {
+		return nil, fmt.Errorf("Could not interpret id document as json: %v: %v", string(document), err)
+	}
+	metadata := map[string]interface{}{
+		"instance-id":       iid.InstanceID,
+		"image":             iid.ImageID,
+		"instance-type":     iid.InstanceType,
+		"region":            iid.Region,
+		"availability-zone": iid.AvailabilityZone,
+		"local-ipv4":        iid.PrivateIP,
+	}
+	// instances without a public IP address don't have these
+	for _, key := range []string{"public-hostname", "public-ipv4"} {
+		if value, err := queryAWSMetaData(EC2MetadataBaseURL + "/meta-data/" + key); err == nil {
+			metadata[key] = string(value)
+		}
+	}
+	publicIP, _ := metadata["public-ipv4"].(string)
+	return &cloudInstance{
+		cloud:            "aws",
+		metadata:         metadata,
+		instanceID:       iid.InstanceID,
+		instanceType:     iid.InstanceType,
+		imageID:          iid.ImageID,
+		region:           iid.Region,
+		availabilityZone: iid.AvailabilityZone,
+		publicIP:         net.ParseIP(publicIP),
+		privateIP:        net.ParseIP(iid.PrivateIP),
+		workerLocation: &AWSWorkerLocation{
+			Cloud:            "aws",
+			Region:           iid.Region,
+			AvailabilityZone: iid.AvailabilityZone,
+		},
+	}, nil
+}
+
+func gcpInstance() (*cloudInstance, error) {
+	client := &http.Client{}
+	metadata := map[string]interface{}{}
+	for _, p := range []string{
+		"/project/project-id",
+		"/instance/image",
+		"/instance/id",
+		"/instance/machine-type",
+		"/instance/zone",
+		"/instance/hostname",
+		"/instance/network-interfaces/0/ip",
+		// instances without a public IP address don't have this
+		"/instance/network-interfaces/0/access-configs/0/external-ip",
+	} {
+		value, err := queryGCPMetaData(client, p)
+		if err != nil {
+			if path.Base(p) == "external-ip" {
+				continue
+			}
+			return nil, err
+		}
+		metadata[path.Base(p)] = string(value)
+	}
+	str := func(key string) string {
+		value, _ := metadata[key].(string)
+		return value
+	}
+	// See https://github.com/taskcluster/taskcluster-worker-runner/blob/6b5bbd197eed4be664171a482bf4d8d4f81a21b2/provider/google/google.go#L79-L84
+	zone := path.Base(str("zone"))
+	if len(zone) < 2 {
+		return nil, fmt.Errorf("GCP availability zone must be at least 2 chars, since region is availability zone minus last two chars. Availability zone %q has only %v chars.", zone, len(zone))
+	}
+	region := zone[:len(zone)-2]
+	return &cloudInstance{
+		cloud:            "gcp",
+		metadata:         metadata,
+		instanceID:       str("id"),
+		instanceType:     str("machine-type"),
+		imageID:          str("image"),
+		region:           region,
+		availabilityZone: zone,
+		publicIP:         net.ParseIP(str("external-ip")),
+		privateIP:        net.ParseIP(str("ip")),
+		workerLocation: &GCPWorkerLocation{
+			Cloud:  "google",
+			Region: region,
+			Zone:   zone,
+		},
+	}, nil
+}
+
+func azureInstance() (*cloudInstance, error) {
+	instanceMetaData, err := queryAzureMetaData(&http.Client{}, "/metadata/instance", "2019-04-30")
+	if err != nil {
+		return nil, err
+	}
+	var azureMetaData AzureMetaData
+	err = json.Unmarshal(instanceMetaData, &azureMetaData)
+	if err != nil {
+		return nil, fmt.Errorf("Could not unmarshal instance metadata %q into AzureMetaData struct - is it valid JSON? %v", string(instanceMetaData), err)
+	}
+	compute := azureMetaData.Compute
+	instance := &cloudInstance{
+		cloud: "azure",
+		metadata: map[string]interface{}{
+			"location": compute.Location,
+			"vmId":     compute.VMID,
+			"vmSize":   compute.VMSize,
+			"image":    azureMetaData.ImageID(),
+		},
+		instanceID:       compute.VMID,
+		instanceType:     compute.VMSize,
+		imageID:          azureMetaData.ImageID(),
+		region:           compute.Location,
+		availabilityZone: compute.Location,
+		workerLocation: &AzureWorkerLocation{
+			Cloud:  "azure",
+			Region: compute.Location,
+		},
+	}
+	if len(azureMetaData.Network.Interface) == 1 {
+		iface := azureMetaData.Network.Interface[0]
+		if len(iface.IPV4.IPAddress) == 1 {
+			addr := iface.IPV4.IPAddress[0]
+			instance.publicIP = net.ParseIP(addr.PublicIPAddress)
+			instance.privateIP = net.ParseIP(addr.PrivateIPAddress)
+		}
+	}
+	return instance, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func loadConfigWithCloudMetadata(t *testing.T, configJSON string) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	configFile := &gwconfig.File{
+		Path: filepath.Join(dir, "generic-worker.config"),
+	}
+	err = ioutil.WriteFile(configFile.Path, []byte(configJSON), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = loadConfig(configFile, NO_PROVIDER)
+	if err != nil {
+		t.Fatalf("Could not load config: %v", err)
+	}
+}
+
+func TestAWSCloudMetadata(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/latest/dynamic/instance-identity/document":
+			fmt.Fprint(w, `{"instanceId": "i-1234", "imageId": "ami-5678", "instanceType": "m5.large", "region": "us-west-2", "availabilityZone": "us-west-2a", "privateIp": "10.0.0.1"}`)
+		default:
+			// no public IP address
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+	oldEC2MetadataBaseURL := EC2MetadataBaseURL
+	EC2MetadataBaseURL = s.URL + "/latest"
+	defer func() {
+		EC2MetadataBaseURL = oldEC2MetadataBaseURL
+		config = nil
+	}()
+
+	loadConfigWithCloudMetadata(t, `{"cloudMetadata": "aws", "workerGroup": "my-group"}`)
+
+	for _, setting := range []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{"workerId", config.WorkerID, "i-1234"},
+		{"workerGroup", config.WorkerGroup, "my-group"},
+		{"instanceId", config.InstanceID, "i-1234"},
+		{"instanceType", config.InstanceType, "m5.large"},
+		{"imageId", config.ImageID, "ami-5678"},
+		{"region", config.Region, "us-west-2"},
+		{"availabilityZone", config.AvailabilityZone, "us-west-2a"},
+		{"privateIP", config.PrivateIP.String(), "10.0.0.1"},
+		{"workerLocation", config.WorkerLocation, `{"cloud":"aws","region":"us-west-2","availabilityZone":"us-west-2a"}`},
+	} {
+		if setting.actual != setting.expected {
+			t.Errorf("Was expecting config setting %v to be %q but got %q", setting.name, setting.expected, setting.actual)
+		}
+	}
+	if config.PublicIP != nil {
+		t.Errorf("Was expecting no public IP but got %v", config.PublicIP)
+	}
+	aws, ok := config.WorkerTypeMetadata["aws"].(map[string]interface{})
+	if !ok || aws["image"] != "ami-5678" {
+		t.Errorf("Was expecting image ami-5678 in aws worker type metadata but got %#v", config.WorkerTypeMetadata["aws"])
+	}
+}
+
+func TestGCPCloudMetadata(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(400)
+			return
+		}
+		switch req.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			fmt.Fprint(w, "98765")
+		case "/computeMetadata/v1/instance/image":
+			fmt.Fprint(w, "projects/proj-1234/global/images/worker-image")
+		case "/computeMetadata/v1/instance/machine-type":
+			fmt.Fprint(w, "projects/1234/machineTypes/n1-standard-4")
+		case "/computeMetadata/v1/instance/zone":
+			fmt.Fprint(w, "projects/1234/zones/us-east1-b")
+		case "/computeMetadata/v1/instance/network-interfaces/0/access-configs/0/external-ip":
+			fmt.Fprint(w, "1.2.3.4")
+		case "/computeMetadata/v1/instance/network-interfaces/0/ip":
+			fmt.Fprint(w, "10.10.10.10")
+		case "/computeMetadata/v1/instance/hostname", "/computeMetadata/v1/project/project-id":
+			fmt.Fprint(w, "x")
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+	oldGCPMetadataBaseURL := GCPMetadataBaseURL
+	GCPMetadataBaseURL = s.URL + "/computeMetadata/v1"
+	defer func() {
+		GCPMetadataBaseURL = oldGCPMetadataBaseURL
+		config = nil
+	}()
+
+	loadConfigWithCloudMetadata(t, `{"cloudMetadata": "gcp", "workerId": "my-worker"}`)
+
+	for _, setting := range []struct {
+		name     string
+		actual   string
+		expected string
+	}{
+		{"workerId", config.WorkerID, "my-worker"},
+		{"workerGroup", config.WorkerGroup, "us-east1"},
+		{"instanceId", config.InstanceID, "98765"},
+		{"imageId", config.ImageID, "projects/proj-1234/global/images/worker-image"},
+		{"availabilityZone", config.AvailabilityZone, "us-east1-b"},
+		{"publicIP", config.PublicIP.String(), "1.2.3.4"},
+	} {
+		if setting.actual != setting.expected {
+			t.Errorf("Was expecting config setting %v to be %q but got %q", setting.name, setting.expected, setting.actual)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	defaultRetryBackoffSeconds    = 10
+	defaultRetryMaxBackoffSeconds = 300
+)
+
+// validateRetryPolicies checks that the retry policies in the task payload
+// refer to existing task commands, with at most one policy per command
+func (task *TaskRun) validateRetryPolicies() *CommandExecutionError {
+	commands := map[int64]bool{}
+	for _, policy := range task.Payload.RetryPolicies {
+		if policy.Command >= int64(len(task.Payload.Command)) {
+			return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.retryPolicies refers to command %v, but the task only has %v commands", policy.Command, len(task.Payload.Command)))
+		}
+		if commands[policy.Command] {
+			return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.retryPolicies has more than one policy for command %v", policy.Command))
+		}
+		commands[policy.Command] = true
+	}
+	return nil
+}
+
+// retryPolicy returns the retry policy of task command index, or nil if it
+// doesn't have one
+func (task *TaskRun) retryPolicy(index int) *CommandRetryPolicy {
+	for i := range task.Payload.RetryPolicies {
+		if task.Payload.RetryPolicies[i].Command == int64(index) {
+			return &task.Payload.RetryPolicies[i]
+		}
+	}
+	return nil
+}
+
+// executeWithRetries executes task command index, retrying it according to
+// its retry policy, and returns the result of the final attempt
+func (task *TaskRun) executeWithRetries(index int) *process.Result {
+	policy := task.retryPolicy(index)
+	for attempt := int64(1); ; attempt++ {
+		result := task.Commands[index].Execute()
+		task.resourceUsage.addCPUTime(cpuTime(result))
+		if policy == nil || attempt >= policy.MaxAttempts || task.StatusManager.AbortException() != nil || !policy.retries(result) || task.IsSuccessExitCode(int64(result.ExitCode())) {
+			return result
+		}
+		delay := policy.backoff(attempt)
+		task.Infof("%v", result)
+		task.Warnf("Command %v failed on attempt %v of %v - retrying in %v", index, attempt, policy.MaxAttempts, delay)
+		if !task.sleepUnlessAborted(delay) {
+			return result
+		}
+		task.Commands[index].Reset()
+	}
+}
+
+// retries returns whether a command with the given result should be retried
+// under the policy
+func (policy *CommandRetryPolicy) retries(result *process.Result) bool {
+	if !result.Failed() || result.Crashed() {
+		return false
+	}
+	if len(policy.ExitCodes) == 0 {
+		return true
+	}
+	for _, exitCode := range policy.ExitCodes {
+		if int64(result.ExitCode()) == exitCode {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait after the given (1-based) failed attempt
+// before the next attempt
+func (policy *CommandRetryPolicy) backoff(attempt int64) time.Duration {
+	seconds := policy.BackoffSeconds
+	if seconds == 0 {
+		seconds = defaultRetryBackoffSeconds
+	}
+	max := policy.MaxBackoffSeconds
+	if max == 0 {
+		max = defaultRetryMaxBackoffSeconds
+	}
+	for i := int64(1); i < attempt && seconds < max; i++ {
+		seconds *= 2
+	}
+	if seconds > max {
+		seconds = max
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// sleepUnlessAborted waits for the given duration, returning early (with
+// false) if the task is aborted, e.g. because maxRunTime is exceeded
+func (task *TaskRun) sleepUnlessAborted(d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for {
+		if task.StatusManager.AbortException() != nil {
+			return false
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return true
+		}
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+		time.Sleep(remaining)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &CommandRetryPolicy{
+		BackoffSeconds:    5,
+		MaxBackoffSeconds: 30,
+	}
+	for attempt, expected := range []time.Duration{5, 10, 20, 30, 30} {
+		if actual := policy.backoff(int64(attempt + 1)); actual != expected*time.Second {
+			t.Fatalf("Was expecting backoff after attempt %v to be %v but got %v", attempt+1, expected*time.Second, actual)
+		}
+	}
+	if actual := (&CommandRetryPolicy{}).backoff(1); actual != defaultRetryBackoffSeconds*time.Second {
+		t.Fatalf("Was expecting default backoff of %v seconds but got %v", defaultRetryBackoffSeconds, actual)
+	}
+}
+
+func TestRetryPolicyForMissingCommand(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(0),
+		MaxRunTime: 30,
+		RetryPolicies: []CommandRetryPolicy{
+			{
+				Command:     1,
+				MaxAttempts: 2,
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestRetryPolicyRetriesFailedCommand(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(123),
+		MaxRunTime: 30,
+		RetryPolicies: []CommandRetryPolicy{
+			{
+				Command:        0,
+				MaxAttempts:    3,
+				ExitCodes:      []int64{123},
+				BackoffSeconds: 1,
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext := retryTestLog(t)
+	for _, expected := range []string{
+		"Command 0 failed on attempt 1 of 3 - retrying in 1s",
+		"Command 0 failed on attempt 2 of 3 - retrying in 2s",
+	} {
+		if !strings.Contains(logtext, expected) {
+			t.Fatalf("Was expecting log to contain %q but it doesn't:\n%v", expected, logtext)
+		}
+	}
+	if strings.Contains(logtext, "attempt 3 of 3") {
+		t.Fatalf("Was expecting command to be attempted at most 3 times, but log says otherwise:\n%v", logtext)
+	}
+}
+
+func TestRetryPolicyIgnoresOtherExitCodes(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(456),
+		MaxRunTime: 30,
+		RetryPolicies: []CommandRetryPolicy{
+			{
+				Command:     0,
+				MaxAttempts: 3,
+				ExitCodes:   []int64{123},
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	if logtext := retryTestLog(t); strings.Contains(logtext, "retrying") {
+		t.Fatalf("Was not expecting command with exit code 456 to be retried:\n%v", logtext)
+	}
+}
+
+func retryTestLog(t *testing.T) string {
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	return string(bytes)
+}
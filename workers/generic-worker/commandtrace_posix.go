@@ -0,0 +1,220 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+var (
+	// directory, relative to task directory, that command traces are written
+	// to
+	commandTraceDir = filepath.Join("generic-worker", "traces")
+	// default for task.payload.commandTrace.maxSizeBytes
+	defaultCommandTraceMaxSize int64 = 100 * 1024 * 1024
+	// how long to wait in Stop for strace output to be fully written, in case
+	// the task left processes running that still hold the output pipe open
+	commandTraceFlushTimeout = 30 * time.Second
+)
+
+// scope required by tasks in order to use the feature
+const commandTraceScope scopes.Pattern = "generic-worker:command-trace:<provisionerId>/<workerType>"
+
+type CommandTraceFeature struct {
+}
+
+func (feature *CommandTraceFeature) Name() string {
+	return "Command Trace"
+}
+
+func (feature *CommandTraceFeature) PayloadName() string {
+	return "commandTrace"
+}
+
+func (feature *CommandTraceFeature) ScopePattern() scopes.Pattern {
+	return commandTraceScope
+}
+
+func (feature *CommandTraceFeature) Initialise() error {
+	return nil
+}
+
+func (feature *CommandTraceFeature) PersistState() error {
+	return nil
+}
+
+// Command tracing is only enabled when task.payload.commandTrace is set
+func (feature *CommandTraceFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.CommandTrace.Tool != ""
+}
+
+type CommandTraceTask struct {
+	task    *TaskRun
+	maxSize int64
+	// write ends of strace output pipes, which the worker must close once all
+	// commands have completed, so that the readers see EOF
+	pipes []*os.File
+	// closed when the strace output of the corresponding command has been
+	// fully written
+	flushed []chan struct{}
+}
+
+func (feature *CommandTraceFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	maxSize := task.Payload.CommandTrace.MaxSizeBytes
+	if maxSize == 0 {
+		maxSize = defaultCommandTraceMaxSize
+	}
+	return &CommandTraceTask{
+		task:    task,
+		maxSize: maxSize,
+	}
+}
+
+func (ct *CommandTraceTask) RequiredScopes() scopes.Expression {
+	return workerScope(commandTraceScope)
+}
+
+func (ct *CommandTraceTask) ReservedArtifacts() []string {
+	artifacts := make([]string, len(ct.task.Payload.Command))
+	for i := range ct.task.Payload.Command {
+		artifacts[i] = ct.artifactName(i)
+	}
+	return artifacts
+}
+
+func (ct *CommandTraceTask) traceFile(index int) string {
+	extension := ".strace"
+	if ct.task.Payload.CommandTrace.Tool == "perf" {
+		extension = ".perf.data"
+	}
+	return fmt.Sprintf("command_%06d%v", index, extension)
+}
+
+func (ct *CommandTraceTask) artifactName(index int) string {
+	return ct.task.Payload.CommandTrace.ArtifactPrefix + ct.traceFile(index)
+}
+
+// Start wraps each task command in the tracing tool. The commands have
+// already been generated, but not yet executed.
+func (ct *CommandTraceTask) Start() *CommandExecutionError {
+	tool := ct.task.Payload.CommandTrace.Tool
+	tracer, err := exec.LookPath(tool)
+	if err != nil {
+		return MalformedPayloadError(fmt.Errorf("Command tracing with %v is not available on worker type %v/%v: %v", tool, config.ProvisionerID, config.WorkerType, err))
+	}
+	err = MkdirAllTaskUser(filepath.Join(taskContext.TaskDir, commandTraceDir), 0700)
+	if err != nil {
+		panic(err)
+	}
+	for i, c := range ct.task.Commands {
+		var args []string
+		switch tool {
+		case "strace":
+			args = ct.straceArgs(i, c.Cmd, tracer)
+		case "perf":
+			args = []string{
+				tracer,
+				"record",
+				"-g",
+				"--max-size=" + strconv.FormatInt(ct.maxSize, 10) + "B",
+				"-o", filepath.Join(taskContext.TaskDir, commandTraceDir, ct.traceFile(i)),
+				"--",
+			}
+		}
+		// c.Cmd.Path has already been resolved against the worker's PATH, so
+		// the same executable is run as would be without tracing
+		c.Cmd.Args = append(append(args, c.Cmd.Path), c.Cmd.Args[1:]...)
+		c.Cmd.Path = tracer
+	}
+	ct.task.Infof("[trace] Tracing task commands with %v", tool)
+	return nil
+}
+
+// straceArgs returns the strace command line for the given command. strace has
+// no limit on the size of its output, so rather than writing to a file, strace
+// writes to a pipe, and the worker enforces the limit when copying the output
+// to the trace file.
+func (ct *CommandTraceTask) straceArgs(index int, cmd *exec.Cmd, tracer string) []string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+	fd := 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+	ct.pipes = append(ct.pipes, w)
+	flushed := make(chan struct{})
+	ct.flushed = append(ct.flushed, flushed)
+	file := filepath.Join(taskContext.TaskDir, commandTraceDir, ct.traceFile(index))
+	go func() {
+		defer close(flushed)
+		defer r.Close()
+		f, err := os.Create(file)
+		if err != nil {
+			ct.task.Warnf("[trace] Could not create trace file %v: %v", file, err)
+			_, _ = io.Copy(ioutil.Discard, r)
+			return
+		}
+		defer f.Close()
+		_, _ = io.Copy(f, io.LimitReader(r, ct.maxSize))
+		// keep draining the pipe, so that strace doesn't block once the limit
+		// is reached
+		discarded, _ := io.Copy(ioutil.Discard, r)
+		if discarded > 0 {
+			ct.task.Warnf("[trace] strace output of command %v exceeded %v bytes; discarded remaining %v bytes", index, ct.maxSize, discarded)
+		}
+	}()
+	return []string{
+		tracer,
+		"-f",
+		"-tt",
+		"-o", "/dev/fd/" + strconv.Itoa(fd),
+		"--",
+	}
+}
+
+func (ct *CommandTraceTask) Stop(err *ExecutionErrors) {
+	for _, w := range ct.pipes {
+		_ = w.Close()
+	}
+	timeout := time.After(commandTraceFlushTimeout)
+flush:
+	for _, flushed := range ct.flushed {
+		select {
+		case <-flushed:
+		case <-timeout:
+			ct.task.Warnf("[trace] Timed out waiting for strace output to be written; traces may be incomplete")
+			break flush
+		}
+	}
+	for i := range ct.task.Commands {
+		path := filepath.Join(commandTraceDir, ct.traceFile(i))
+		if fi, e := os.Stat(filepath.Join(taskContext.TaskDir, path)); e != nil || fi.Size() == 0 {
+			// command did not run
+			continue
+		}
+		contentType := "text/plain; charset=utf-8"
+		if ct.task.Payload.CommandTrace.Tool == "perf" {
+			contentType = "application/octet-stream"
+		}
+		err.add(ct.task.uploadArtifact(
+			&S3Artifact{
+				BaseArtifact: &BaseArtifact{
+					Name:    ct.artifactName(i),
+					Expires: ct.task.Definition.Expires,
+				},
+				ContentType:     contentType,
+				ContentEncoding: "gzip",
+				Path:            path,
+			},
+		))
+	}
+}
@@ -0,0 +1,57 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestCommandTraceMissingScopes(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 10,
+		CommandTrace: CommandTrace{
+			Tool:           "strace",
+			ArtifactPrefix: "public/trace/",
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestStrace(t *testing.T) {
+	defer setup(t)()
+	if _, err := exec.LookPath("strace"); err != nil {
+		t.Skip("Skipping since strace is not installed")
+	}
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		CommandTrace: CommandTrace{
+			Tool:           "strace",
+			ArtifactPrefix: "public/trace/",
+			MaxSizeBytes:   4096,
+		},
+	}
+	td := testTask(t)
+	td.Scopes = []string{
+		"generic-worker:command-trace:" + td.ProvisionerID + "/" + td.WorkerType,
+	}
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	artifacts, err := testQueue.ListArtifacts(taskID, "0", "", "")
+	if err != nil {
+		t.Fatalf("Error listing artifacts: %v", err)
+	}
+	a := map[string]bool{}
+	for _, artifact := range artifacts.Artifacts {
+		a[artifact.Name] = true
+	}
+	if !a["public/trace/command_000000.strace"] || !a["public/trace/command_000001.strace"] {
+		t.Fatalf("Was expecting strace artifacts for both commands in task %v", taskID)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+type (
+	// ConfigDriftChecker compares the running config of the worker with the
+	// desired config of its worker pool in worker-manager, and acts on any
+	// differences according to config setting configDriftPolicy
+	ConfigDriftChecker struct {
+		policy string
+		// fetches the desired public config
+		desiredConfig func() (map[string]interface{}, error)
+		// hash of the desired config that drift was last reported for, so
+		// that the same drift is only reported once
+		reportedHash string
+	}
+
+	// ConfigDrift is a config setting whose running value differs from its
+	// desired value
+	ConfigDrift struct {
+		Setting string      `json:"setting"`
+		Running interface{} `json:"running"`
+		Desired interface{} `json:"desired"`
+	}
+)
+
+func NewConfigDriftChecker(policy string) *ConfigDriftChecker {
+	return &ConfigDriftChecker{
+		policy:        policy,
+		desiredConfig: WMDesiredConfig,
+	}
+}
+
+// WMDesiredConfig returns the public generic-worker config settings of the
+// latest worker config of the worker pool in worker-manager
+func WMDesiredConfig() (map[string]interface{}, error) {
+	workerConfig, err := WMWorkerConfig()
+	if err != nil {
+		return nil, err
+	}
+	// ensure there are no unknown or private settings
+	_, err = workerConfig.PublicHostSetup()
+	if err != nil {
+		return nil, fmt.Errorf("WARNING: Can't extract public host setup from latest userdata for worker type %v - not checking for config drift as latest user data is probably botched: %v", config.WorkerType, err)
+	}
+	var publicHostSetup struct {
+		Config map[string]interface{} `json:"config"`
+	}
+	err = json.Unmarshal(workerConfig.GenericWorker, &publicHostSetup)
+	if err != nil {
+		return nil, err
+	}
+	return publicHostSetup.Config, nil
+}
+
+// Check compares the running config with the desired config, and returns
+// true if the worker should exit so that it is restarted with the desired
+// config. It is called between tasks, so the current task has always
+// finished.
+func (cdc *ConfigDriftChecker) Check() (restart bool) {
+	log.Print("Checking for config drift...")
+	desired, err := cdc.desiredConfig()
+	if err != nil {
+		log.Printf("%v", err)
+		return false
+	}
+	drifts, runningHash, desiredHash, err := configDrifts(&config.PublicConfig, desired)
+	if err != nil {
+		log.Printf("WARNING: could not compare running config with desired config: %v", err)
+		return false
+	}
+	if len(drifts) == 0 {
+		log.Printf("No config drift - running config hash %v matches desired config hash", runningHash)
+		return false
+	}
+	reported := desiredHash != cdc.reportedHash
+	if reported {
+		cdc.reportedHash = desiredHash
+		for _, drift := range drifts {
+			log.Printf("Config drift: setting %v is %v but should be %v", drift.Setting, jsonString(drift.Running), jsonString(drift.Desired))
+		}
+		logEventWithFields("configDrift", nil, time.Now(), map[string]interface{}{
+			"policy":            cdc.policy,
+			"runningConfigHash": runningHash,
+			"desiredConfigHash": desiredHash,
+			"drifts":            drifts,
+		})
+	}
+	switch cdc.policy {
+	case "restart":
+		log.Print("Exiting so that the worker is restarted with the desired config (config setting configDriftPolicy is \"restart\")")
+		return true
+	case "reconfigure":
+		if reported {
+			for _, drift := range drifts {
+				if _, reloadable := reloadableSettings[drift.Setting]; !reloadable {
+					log.Printf("Config drift: setting %v only takes effect when the worker is restarted", drift.Setting)
+				}
+			}
+		}
+		err = reconfigure(desired)
+		if err != nil {
+			log.Printf("WARNING: could not apply desired config, so continuing with running config: %v", err)
+			return false
+		}
+		log.Printf("Applied reloadable settings of desired config (config setting configDriftPolicy is \"reconfigure\")")
+	}
+	return false
+}
+
+// configDrifts returns the settings of the desired config whose values differ
+// in the running config, sorted by setting name, and hashes of both configs
+// restricted to the settings of the desired config
+func configDrifts(running *gwconfig.PublicConfig, desired map[string]interface{}) (drifts []ConfigDrift, runningHash, desiredHash string, err error) {
+	// round trip through json, so that values are comparable with the
+	// desired config
+	data, err := json.Marshal(running)
+	if err != nil {
+		return
+	}
+	all := map[string]interface{}{}
+	err = json.Unmarshal(data, &all)
+	if err != nil {
+		return
+	}
+	settings := make([]string, 0, len(desired))
+	for setting := range desired {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+	relevant := map[string]interface{}{}
+	drifts = []ConfigDrift{}
+	for _, setting := range settings {
+		relevant[setting] = restrictTo(all[setting], desired[setting])
+		if !reflect.DeepEqual(relevant[setting], desired[setting]) {
+			drifts = append(drifts, ConfigDrift{
+				Setting: setting,
+				Running: relevant[setting],
+				Desired: desired[setting],
+			})
+		}
+	}
+	runningHash, err = configHash(relevant)
+	if err == nil {
+		desiredHash, err = configHash(desired)
+	}
+	return
+}
+
+// restrictTo returns the running value of a setting, but if both the running
+// and desired values are objects, only with the properties of the desired
+// value. Desired objects are merged into the running config (see
+// reconfigure), and the worker adds properties of its own to some of them
+// (such as workerTypeMetadata), which are not drift.
+func restrictTo(running, desired interface{}) interface{} {
+	runningMap, isMap := running.(map[string]interface{})
+	desiredMap, desiredIsMap := desired.(map[string]interface{})
+	if !isMap || !desiredIsMap {
+		return running
+	}
+	restricted := map[string]interface{}{}
+	for key, value := range desiredMap {
+		if runningValue, exists := runningMap[key]; exists {
+			restricted[key] = restrictTo(runningValue, value)
+		}
+	}
+	return restricted
+}
+
+// configHash returns the SHA256 of the given settings, as JSON with sorted
+// keys
+func configHash(settings map[string]interface{}) (string, error) {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// reloadableSettings are the config settings that reconfigure applies to the
+// running config, and how to apply them. They are only read by the main loop
+// of the worker, which also calls reconfigure, so they can be changed without
+// synchronising with other goroutines that read the config.
+var reloadableSettings = map[string]func(running, reconfigured *gwconfig.Config){
+	"checkForConfigDriftEverySecs":   func(r, c *gwconfig.Config) { r.CheckForConfigDriftEverySecs = c.CheckForConfigDriftEverySecs },
+	"checkForNewDeploymentEverySecs": func(r, c *gwconfig.Config) { r.CheckForNewDeploymentEverySecs = c.CheckForNewDeploymentEverySecs },
+	"checkForSelfUpdateEverySecs":    func(r, c *gwconfig.Config) { r.CheckForSelfUpdateEverySecs = c.CheckForSelfUpdateEverySecs },
+	"idleTimeoutSecs":                func(r, c *gwconfig.Config) { r.IdleTimeoutSecs = c.IdleTimeoutSecs },
+	"numberOfTasksToRun":             func(r, c *gwconfig.Config) { r.NumberOfTasksToRun = c.NumberOfTasksToRun },
+	"requiredDiskSpaceMegabytes":     func(r, c *gwconfig.Config) { r.RequiredDiskSpaceMegabytes = c.RequiredDiskSpaceMegabytes },
+	"shutdownMachineOnIdle":          func(r, c *gwconfig.Config) { r.ShutdownMachineOnIdle = c.ShutdownMachineOnIdle },
+	"shutdownMachineOnInternalError": func(r, c *gwconfig.Config) { r.ShutdownMachineOnInternalError = c.ShutdownMachineOnInternalError },
+}
+
+// reconfigure applies the reloadable settings (see reloadableSettings) of the
+// given public config settings to the running config, if the result is valid.
+// Other settings only take effect when the worker is restarted.
+func reconfigure(desired map[string]interface{}) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	reconfigured := new(gwconfig.Config)
+	err = json.Unmarshal(data, reconfigured)
+	if err != nil {
+		return err
+	}
+	reloadable := map[string]interface{}{}
+	for setting, value := range desired {
+		if _, exists := reloadableSettings[setting]; exists {
+			reloadable[setting] = value
+		}
+	}
+	desiredJSON, err := json.Marshal(reloadable)
+	if err != nil {
+		return err
+	}
+	err = reconfigured.MergeInJSON(desiredJSON, func(a map[string]interface{}) map[string]interface{} {
+		return a
+	})
+	if err != nil {
+		return err
+	}
+	err = reconfigured.Validate()
+	if err != nil {
+		return err
+	}
+	for setting := range reloadable {
+		reloadableSettings[setting](config, reconfigured)
+	}
+	return nil
+}
+
+func jsonString(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestConfigDrifts(t *testing.T) {
+	running := &gwconfig.PublicConfig{
+		IdleTimeoutSecs: 0,
+		WorkerType:      "my-worker-type",
+	}
+	drifts, runningHash, desiredHash, err := configDrifts(running, map[string]interface{}{
+		"idleTimeoutSecs": float64(60),
+		"workerType":      "my-worker-type",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].Setting != "idleTimeoutSecs" || drifts[0].Running != float64(0) || drifts[0].Desired != float64(60) {
+		t.Errorf("Was expecting idleTimeoutSecs to drift from 0 to 60 but got %#v", drifts)
+	}
+	if runningHash == desiredHash {
+		t.Errorf("Was expecting running config hash and desired config hash to differ, but both are %v", runningHash)
+	}
+
+	running.IdleTimeoutSecs = 60
+	drifts, runningHash, desiredHash, err = configDrifts(running, map[string]interface{}{
+		"idleTimeoutSecs": float64(60),
+		"workerType":      "my-worker-type",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 {
+		t.Errorf("Was expecting no config drift but got %#v", drifts)
+	}
+	if runningHash != desiredHash {
+		t.Errorf("Was expecting running config hash %v to match desired config hash %v", runningHash, desiredHash)
+	}
+}
+
+// The worker adds properties of its own to workerTypeMetadata when it starts,
+// which shouldn't be reported as drift
+func TestConfigDriftsWorkerTypeMetadata(t *testing.T) {
+	running := &gwconfig.PublicConfig{
+		WorkerTypeMetadata: map[string]interface{}{
+			"config": map[string]interface{}{
+				"deploymentId": "abc",
+			},
+			"generic-worker": map[string]interface{}{
+				"version": version,
+			},
+			"machine-setup": map[string]interface{}{
+				"script": "setup.sh",
+			},
+		},
+	}
+	desired := map[string]interface{}{
+		"workerTypeMetadata": map[string]interface{}{
+			"machine-setup": map[string]interface{}{
+				"script": "setup.sh",
+			},
+		},
+	}
+	drifts, runningHash, desiredHash, err := configDrifts(running, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 0 || runningHash != desiredHash {
+		t.Errorf("Was expecting no config drift but got %#v", drifts)
+	}
+
+	desired["workerTypeMetadata"].(map[string]interface{})["machine-setup"].(map[string]interface{})["script"] = "setup-v2.sh"
+	drifts, _, _, err = configDrifts(running, desired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drifts) != 1 || drifts[0].Setting != "workerTypeMetadata" {
+		t.Fatalf("Was expecting workerTypeMetadata to drift but got %#v", drifts)
+	}
+	if _, included := drifts[0].Running.(map[string]interface{})["generic-worker"]; included {
+		t.Errorf("Was expecting drift to only include desired properties of workerTypeMetadata but got %#v", drifts[0].Running)
+	}
+}
+
+func TestConfigDriftPolicies(t *testing.T) {
+	desired := map[string]interface{}{
+		"idleTimeoutSecs": float64(60),
+		// not reloadable, so not applied by "reconfigure"
+		"tasksDir": "other-tasks",
+	}
+	for _, test := range []struct {
+		policy          string
+		restart         bool
+		idleTimeoutSecs uint
+	}{
+		{"report", false, 0},
+		{"restart", true, 0},
+		{"reconfigure", false, 60},
+	} {
+		config = &gwconfig.Config{
+			PublicConfig: gwconfig.PublicConfig{
+				CachesDir:                 "caches",
+				ClientID:                  "test-client-id",
+				ConfigDriftPolicy:         test.policy,
+				DownloadsDir:              "downloads",
+				Ed25519SigningKeyLocation: "ed25519.key",
+				LiveLogExecutable:         "livelog",
+				LiveLogGETPort:            60023,
+				LiveLogPUTPort:            60022,
+				ProvisionerID:             "test-provisioner",
+				PublicIP:                  net.ParseIP("1.2.3.4"),
+				RootURL:                   "https://tc.example.com",
+				Subdomain:                 "taskcluster-worker.net",
+				TasksDir:                  "tasks",
+				WorkerGroup:               "test-worker-group",
+				WorkerID:                  "test-worker-id",
+				WorkerType:                "test-worker-type",
+				WorkerTypeMetadata:        map[string]interface{}{},
+			},
+			PrivateConfig: gwconfig.PrivateConfig{
+				AccessToken: "test-access-token",
+			},
+		}
+		cdc := NewConfigDriftChecker(test.policy)
+		cdc.desiredConfig = func() (map[string]interface{}, error) {
+			return desired, nil
+		}
+		if restart := cdc.Check(); restart != test.restart {
+			t.Errorf("Policy %v: was expecting restart %v but got %v", test.policy, test.restart, restart)
+		}
+		if config.IdleTimeoutSecs != test.idleTimeoutSecs {
+			t.Errorf("Policy %v: was expecting idleTimeoutSecs %v but got %v", test.policy, test.idleTimeoutSecs, config.IdleTimeoutSecs)
+		}
+		if config.TasksDir != "tasks" {
+			t.Errorf("Policy %v: was expecting tasksDir to be unchanged but got %v", test.policy, config.TasksDir)
+		}
+	}
+	config = nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -69,6 +70,24 @@ func TestInvalidIPConfig(t *testing.T) {
 	}
 }
 
+func TestInvalidNotifyOnStatusesConfig(t *testing.T) {
+	file := &gwconfig.File{
+		Path: filepath.Join("testdata", "config", "invalid-notify-status.json"),
+	}
+	_, err := loadConfig(file, NO_PROVIDER)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("Was expecting to get an error back due to an invalid notification status, but didn't get one!")
+	}
+	expectedErrorText := `contains invalid status "broken"`
+	if !strings.Contains(err.Error(), expectedErrorText) {
+		t.Fatalf("Was expecting error text to include %q but it didn't: %v", expectedErrorText, err)
+	}
+}
+
 func TestInvalidJsonConfig(t *testing.T) {
 	file := &gwconfig.File{
 		Path: filepath.Join("testdata", "config", "invalid-json.json"),
@@ -135,3 +154,55 @@ func TestBoolAsString(t *testing.T) {
 		t.Fatalf("Was expecting error text to include %q but it didn't: %v", expectedErrorText, err)
 	}
 }
+
+func TestInvalidArtifactMirrorConfig(t *testing.T) {
+	file := &gwconfig.File{
+		Path: filepath.Join("testdata", "config", "invalid-artifact-mirror.json"),
+	}
+	_, err := loadConfig(file, NO_PROVIDER)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("Was expecting to get an error back due to an unsupported artifact mirror, but didn't get one!")
+	}
+	expectedErrorText := `has unsupported scheme "ftp"`
+	if !strings.Contains(err.Error(), expectedErrorText) {
+		t.Fatalf("Was expecting error text to include %q but it didn't: %v", expectedErrorText, err)
+	}
+}
+
+func TestInvalidMaintenanceWindowConfig(t *testing.T) {
+	file := &gwconfig.File{
+		Path: filepath.Join("testdata", "config", "invalid-maintenance-window.json"),
+	}
+	_, err := loadConfig(file, NO_PROVIDER)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	err = config.Validate()
+	if err == nil {
+		t.Fatal("Was expecting to get an error back due to an invalid maintenance window schedule, but didn't get one!")
+	}
+	expectedErrorText := `window "updates" has invalid schedule`
+	if !strings.Contains(err.Error(), expectedErrorText) {
+		t.Fatalf("Was expecting error text to include %q but it didn't: %v", expectedErrorText, err)
+	}
+}
+
+// Config.String() is used for logging the worker config, so none of the
+// private settings should appear in it
+func TestConfigStringMasksPrivateConfig(t *testing.T) {
+	c := &gwconfig.Config{}
+	v := reflect.ValueOf(&c.PrivateConfig).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		v.Field(i).SetString("secret-value-of-" + v.Type().Field(i).Name)
+	}
+	s := c.String()
+	for i := 0; i < v.NumField(); i++ {
+		if strings.Contains(s, v.Field(i).String()) {
+			t.Errorf("Private config setting %v is not masked in config string:\n%v", v.Type().Field(i).Name, s)
+		}
+	}
+}
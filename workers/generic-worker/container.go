@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+// containerized is whether the worker itself is running inside a container,
+// such as a Kubernetes pod (see config setting containerMode)
+var containerized bool
+
+// configureContainerMode determines whether the worker is running inside a
+// container, and if so, adapts the worker to it: task users can't be created,
+// the work directories should be volumes that are bind-mounted from the host,
+// and reboots and shutdowns are requested from the host helper (see config
+// setting containerHostHelperURL), if there is one.
+func configureContainerMode() error {
+	switch config.ContainerMode {
+	case "enabled":
+		containerized = true
+	case "disabled":
+		containerized = false
+	case "auto", "":
+		containerized = runningInContainer()
+	default:
+		return fmt.Errorf("Config setting \"containerMode\" is %q - allowed values are \"auto\", \"enabled\" and \"disabled\"", config.ContainerMode)
+	}
+	if !containerized {
+		return nil
+	}
+	log.Print("Running in containerized worker mode")
+	adaptEngineToContainer()
+	for setting, dir := range map[string]string{
+		"cachesDir":    config.CachesDir,
+		"downloadsDir": config.DownloadsDir,
+		"tasksDir":     config.TasksDir,
+	} {
+		if overlayFilesystem(dir) {
+			log.Printf("WARNING: %v (config setting %v) is in the filesystem of the container, which is slow and is lost when the container is restarted; it should be a volume that is bind-mounted from the host", dir, setting)
+		}
+	}
+	if config.ContainerHostHelperURL == "" {
+		log.Print("Config setting containerHostHelperURL is not set, so the worker will exit rather than reboot or shut down the host")
+	}
+	return nil
+}
+
+// immediateReboot reboots the host. In containerized worker mode the host
+// helper is asked to reboot it, if there is one; otherwise the worker exits,
+// so that the container runtime restarts it.
+func immediateReboot() {
+	if !containerized {
+		host.ImmediateReboot()
+		return
+	}
+	requestFromHostHelper("reboot", "generic-worker requested reboot")
+}
+
+// immediateShutdown shuts down the host, like immediateReboot reboots it
+func immediateShutdown(cause string) {
+	if !containerized {
+		host.ImmediateShutdown(cause)
+		return
+	}
+	requestFromHostHelper("shutdown", cause)
+}
+
+// requestFromHostHelper asks the host helper to perform the given action on
+// the host, by posting a JSON object with the worker identity and cause to
+// <containerHostHelperURL>/<action>
+func requestFromHostHelper(action, cause string) {
+	if config.ContainerHostHelperURL == "" {
+		log.Printf("Not performing host %v (%v), since there is no host helper in containerized worker mode", action, cause)
+		return
+	}
+	body, err := json.Marshal(map[string]string{
+		"workerGroup": config.WorkerGroup,
+		"workerId":    config.WorkerID,
+		"cause":       cause,
+	})
+	if err != nil {
+		panic(err)
+	}
+	url := strings.TrimSuffix(config.ContainerHostHelperURL, "/") + "/" + action
+	log.Printf("Requesting host %v from host helper %v...", action, url)
+	resp, _, err := httpbackoff.Post(url, "application/json", body)
+	if err != nil {
+		log.Printf("WARNING: host helper could not perform host %v: %v", action, err)
+		return
+	}
+	_ = resp.Body.Close()
+}
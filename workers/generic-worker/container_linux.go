@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// runningInContainer returns whether the current process is running inside
+// a docker, podman, containerd or Kubernetes container
+func runningInContainer() bool {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return true
+	}
+	for _, file := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(file); err == nil {
+			return true
+		}
+	}
+	cgroups, err := ioutil.ReadFile("/proc/1/cgroup")
+	if err != nil {
+		return false
+	}
+	for _, runtime := range []string{"docker", "kubepods", "containerd", "libpod", "lxc"} {
+		if strings.Contains(string(cgroups), runtime) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlayFilesystem returns whether dir, or its closest existing parent, is
+// on an overlay filesystem, such as the root filesystem of a container
+func overlayFilesystem(dir string) bool {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for {
+		var fs unix.Statfs_t
+		if unix.Statfs(dir, &fs) == nil {
+			return fs.Type == unix.OVERLAYFS_SUPER_MAGIC
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
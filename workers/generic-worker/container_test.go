@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestContainerHostHelper(t *testing.T) {
+	requests := []map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/helper/shutdown" {
+			t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Could not decode request body: %v", err)
+		}
+		requests = append(requests, body)
+	}))
+	defer server.Close()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ContainerHostHelperURL: server.URL + "/helper/",
+			ContainerMode:          "enabled",
+			WorkerGroup:            "test-worker-group",
+			WorkerID:               "test-worker-id",
+		},
+	}
+	defer func() {
+		config = nil
+		containerized = false
+	}()
+	err := configureContainerMode()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !containerized {
+		t.Fatalf("Was expecting containerized worker mode to be enabled")
+	}
+	immediateShutdown("generic-worker idle timeout")
+	if len(requests) != 1 || requests[0]["workerId"] != "test-worker-id" || requests[0]["cause"] != "generic-worker idle timeout" {
+		t.Errorf("Was expecting one shutdown request from test-worker-id, but got %v", requests)
+	}
+}
+
+func TestContainerModeInvalid(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ContainerMode: "sometimes",
+		},
+	}
+	defer func() {
+		config = nil
+		containerized = false
+	}()
+	if configureContainerMode() == nil {
+		t.Fatalf("Was expecting an error for invalid config setting containerMode")
+	}
+}
@@ -0,0 +1,12 @@
+// +build !linux
+
+package main
+
+// Containerized worker mode is only detected automatically on Linux
+func runningInContainer() bool {
+	return false
+}
+
+func overlayFilesystem(dir string) bool {
+	return false
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"runtime"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+// WorkerControl serves the commands that operators and host agents send to
+// the control socket of the worker (see config setting controlSocket), and
+// holds the state that they change, which the main loop of the worker checks
+// between tasks.
+type WorkerControl struct {
+	token    string
+	started  time.Time
+	listener net.Listener
+
+	mutex         sync.Mutex
+	paused        bool
+	task          *TaskRun
+	taskStarted   time.Time
+	tasksResolved uint
+	// zero unless the worker is quarantined
+	quarantinedUntil time.Time
+	// empty unless the circuit breaker of Taskcluster API calls is open
+	degraded string
+	// empty unless a maintenance window is running
+	maintenanceWindow string
+	// closed when a graceful shutdown has been requested
+	shutdown          chan struct{}
+	shutdownRequested bool
+}
+
+type (
+	// controlRequest is a line of JSON sent to the control socket
+	controlRequest struct {
+		Token   string `json:"token"`
+		Command string `json:"command"`
+	}
+
+	// controlResponse is the line of JSON that the worker replies with
+	controlResponse struct {
+		OK     bool        `json:"ok"`
+		Error  string      `json:"error,omitempty"`
+		Result interface{} `json:"result,omitempty"`
+	}
+
+	controlStatus struct {
+		Version           string             `json:"version"`
+		Uptime            string             `json:"uptime"`
+		Paused            bool               `json:"paused"`
+		ShutdownRequested bool               `json:"shutdownRequested"`
+		QuarantinedUntil  *tcclient.Time     `json:"quarantinedUntil,omitempty"`
+		Health            string             `json:"health"`
+		DegradedReason    string             `json:"degradedReason,omitempty"`
+		MaintenanceWindow string             `json:"maintenanceWindow,omitempty"`
+		TasksResolved     uint               `json:"tasksResolved"`
+		Task              *controlTaskStatus `json:"task,omitempty"`
+	}
+
+	controlTaskStatus struct {
+		TaskID  string        `json:"taskId"`
+		RunID   uint          `json:"runId"`
+		Started tcclient.Time `json:"started"`
+	}
+
+	controlDiagnostics struct {
+		controlStatus
+		Goroutines int    `json:"goroutines"`
+		HeapBytes  uint64 `json:"heapBytes"`
+		SysBytes   uint64 `json:"sysBytes"`
+		NumGC      uint32 `json:"numGC"`
+		Stacks     string `json:"stacks"`
+	}
+)
+
+func NewWorkerControl(token string, tasksResolved uint) *WorkerControl {
+	return &WorkerControl{
+		token:         token,
+		started:       time.Now(),
+		tasksResolved: tasksResolved,
+		shutdown:      make(chan struct{}),
+	}
+}
+
+// Serve accepts connections to the control socket at the given path (or on
+// Windows, the named pipe with the given name) in the background, until Close
+// is called.
+func (wc *WorkerControl) Serve(path string) error {
+	if wc.token == "" {
+		return fmt.Errorf("config setting controlToken must be set when controlSocket is set")
+	}
+	listener, err := listenControlSocket(path)
+	if err != nil {
+		return fmt.Errorf("could not listen on control socket %v: %v", path, err)
+	}
+	wc.listener = listener
+	log.Printf("Accepting control commands on %v", path)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				// listener closed
+				return
+			}
+			go wc.handle(conn)
+		}
+	}()
+	return nil
+}
+
+func (wc *WorkerControl) Close() {
+	if wc.listener != nil {
+		_ = wc.listener.Close()
+	}
+}
+
+// Paused returns whether claiming of tasks has been paused
+func (wc *WorkerControl) Paused() bool {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	return wc.paused
+}
+
+// Shutdown returns a channel that is closed when a graceful shutdown has been
+// requested
+func (wc *WorkerControl) Shutdown() <-chan struct{} {
+	return wc.shutdown
+}
+
+// SetQuarantinedUntil records when the quarantine of the worker ends, for
+// reporting in its status, or the zero time if it isn't quarantined
+func (wc *WorkerControl) SetQuarantinedUntil(until time.Time) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wc.quarantinedUntil = until
+}
+
+// SetDegraded records why the worker is degraded, for reporting in its status,
+// or the empty string if it is healthy
+func (wc *WorkerControl) SetDegraded(reason string) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wc.degraded = reason
+}
+
+// SetMaintenanceWindow records the name of the running maintenance window,
+// for reporting in its status, or the empty string if none is running
+func (wc *WorkerControl) SetMaintenanceWindow(name string) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wc.maintenanceWindow = name
+}
+
+func (wc *WorkerControl) TaskStarted(task *TaskRun) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wc.task = task
+	wc.taskStarted = time.Now()
+}
+
+func (wc *WorkerControl) TaskFinished(tasksResolved uint) {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	wc.task = nil
+	wc.tasksResolved = tasksResolved
+}
+
+// handle serves the commands of one connection, one line of JSON per command
+func (wc *WorkerControl) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req controlRequest
+		var resp *controlResponse
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		switch {
+		case err != nil:
+			resp = &controlResponse{Error: fmt.Sprintf("invalid request: %v", err)}
+		case subtle.ConstantTimeCompare([]byte(req.Token), []byte(wc.token)) != 1:
+			log.Printf("WARNING: Rejected control command %q with invalid token", req.Command)
+			resp = &controlResponse{Error: "invalid token"}
+		default:
+			resp = wc.execute(req.Command)
+		}
+		if encoder.Encode(resp) != nil {
+			return
+		}
+	}
+}
+
+func (wc *WorkerControl) execute(command string) *controlResponse {
+	wc.mutex.Lock()
+	defer wc.mutex.Unlock()
+	switch command {
+	case "status":
+	case "diagnostics":
+		return &controlResponse{OK: true, Result: wc.diagnostics()}
+	case "pause":
+		if !wc.paused {
+			log.Print("Claiming of tasks paused by control command")
+		}
+		wc.paused = true
+	case "resume":
+		if wc.paused {
+			log.Print("Claiming of tasks resumed by control command")
+		}
+		wc.paused = false
+	case "shutdown":
+		if !wc.shutdownRequested {
+			log.Print("Graceful shutdown requested by control command - will exit once no task is running")
+			wc.shutdownRequested = true
+			close(wc.shutdown)
+		}
+	default:
+		return &controlResponse{Error: fmt.Sprintf("unknown command %q - must be one of status, diagnostics, pause, resume or shutdown", command)}
+	}
+	return &controlResponse{OK: true, Result: wc.status()}
+}
+
+// status must be called with wc.mutex held
+func (wc *WorkerControl) status() *controlStatus {
+	status := &controlStatus{
+		Version:           version,
+		Uptime:            time.Since(wc.started).Round(time.Second).String(),
+		Paused:            wc.paused,
+		ShutdownRequested: wc.shutdownRequested,
+		Health:            "healthy",
+		MaintenanceWindow: wc.maintenanceWindow,
+		TasksResolved:     wc.tasksResolved,
+	}
+	if wc.degraded != "" {
+		status.Health = "degraded"
+		status.DegradedReason = wc.degraded
+	}
+	if !wc.quarantinedUntil.IsZero() {
+		until := tcclient.Time(wc.quarantinedUntil)
+		status.QuarantinedUntil = &until
+	}
+	if wc.task != nil {
+		status.Task = &controlTaskStatus{
+			TaskID:  wc.task.TaskID,
+			RunID:   wc.task.RunID,
+			Started: tcclient.Time(wc.taskStarted),
+		}
+	}
+	return status
+}
+
+// diagnostics must be called with wc.mutex held
+func (wc *WorkerControl) diagnostics() *controlDiagnostics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stacks := make([]byte, 1<<20)
+	stacks = stacks[:runtime.Stack(stacks, true)]
+	return &controlDiagnostics{
+		controlStatus: *wc.status(),
+		Goroutines:    runtime.NumGoroutine(),
+		HeapBytes:     mem.HeapAlloc,
+		SysBytes:      mem.Sys,
+		NumGC:         mem.NumGC,
+		Stacks:        string(stacks),
+	}
+}
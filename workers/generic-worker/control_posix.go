@@ -0,0 +1,54 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// controlListener removes the control socket when it is closed, since the
+// socket is bound under a temporary name and then renamed
+type controlListener struct {
+	*net.UnixListener
+	path string
+}
+
+func (l *controlListener) Close() error {
+	err := l.UnixListener.Close()
+	_ = os.Remove(l.path)
+	return err
+}
+
+// listenControlSocket listens on a Unix domain socket that only the worker
+// user can connect to. The socket is created inside a new directory that only
+// the worker user can access, and only moved into place once its permissions
+// have been restricted, so that other users can never connect to it.
+func listenControlSocket(path string) (net.Listener, error) {
+	// a socket left behind by a previous run of the worker
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(filepath.Dir(path), "control")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tempPath := filepath.Join(dir, "control.sock")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: tempPath, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	listener.SetUnlinkOnClose(false)
+	err = os.Chmod(tempPath, 0600)
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return &controlListener{UnixListener: listener, path: path}, nil
+}
@@ -0,0 +1,120 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func controlCommand(t *testing.T, conn net.Conn, reader *bufio.Reader, token, command string) *controlResponse {
+	data, err := json.Marshal(&controlRequest{Token: token, Command: command})
+	if err != nil {
+		t.Fatalf("Could not marshal control request: %v", err)
+	}
+	_, err = conn.Write(append(data, '\n'))
+	if err != nil {
+		t.Fatalf("Could not send control command %v: %v", command, err)
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("Could not read response to control command %v: %v", command, err)
+	}
+	var resp controlResponse
+	err = json.Unmarshal(line, &resp)
+	if err != nil {
+		t.Fatalf("Could not unmarshal response %q: %v", line, err)
+	}
+	return &resp
+}
+
+func TestControlSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "control")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "control.sock")
+
+	if err := NewWorkerControl("", 0).Serve(socket); err == nil {
+		t.Fatal("Was expecting control socket to require a token")
+	}
+	control := NewWorkerControl("secret", 3)
+	err = control.Serve(socket)
+	if err != nil {
+		t.Fatalf("Could not serve control socket: %v", err)
+	}
+	defer control.Close()
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Could not stat control socket: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Was expecting control socket to have permissions 0600, but has %v", info.Mode().Perm())
+	}
+	// the private directory that the socket was created in is cleaned up
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Fatalf("Was expecting only the control socket in %v, but got %v (%v)", dir, files, err)
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatalf("Could not connect to control socket: %v", err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	if resp := controlCommand(t, conn, reader, "wrong", "shutdown"); resp.OK || resp.Error != "invalid token" {
+		t.Fatalf("Was expecting command with wrong token to be rejected, but got %#v", resp)
+	}
+	if resp := controlCommand(t, conn, reader, "secret", "reboot"); resp.OK {
+		t.Fatalf("Was expecting unknown command to fail, but got %#v", resp)
+	}
+
+	control.TaskStarted(&TaskRun{TaskID: "KTBKfEgxR5GdfIIREQIvFQ", RunID: 1})
+	resp := controlCommand(t, conn, reader, "secret", "pause")
+	if !resp.OK || !control.Paused() {
+		t.Fatalf("Was expecting claiming to be paused, but got %#v", resp)
+	}
+	status := resp.Result.(map[string]interface{})
+	if status["paused"] != true || status["tasksResolved"] != float64(3) {
+		t.Fatalf("Unexpected status %#v", status)
+	}
+	if task := status["task"].(map[string]interface{}); task["taskId"] != "KTBKfEgxR5GdfIIREQIvFQ" {
+		t.Fatalf("Was expecting status to include current task, but got %#v", status)
+	}
+	if resp := controlCommand(t, conn, reader, "secret", "resume"); !resp.OK || control.Paused() {
+		t.Fatalf("Was expecting claiming to be resumed, but got %#v", resp)
+	}
+	if resp := controlCommand(t, conn, reader, "secret", "diagnostics"); !resp.OK || resp.Result.(map[string]interface{})["stacks"] == "" {
+		t.Fatalf("Was expecting diagnostics to include goroutine stacks, but got %#v", resp)
+	}
+
+	select {
+	case <-control.Shutdown():
+		t.Fatal("Shutdown requested before shutdown command was sent")
+	default:
+	}
+	if resp := controlCommand(t, conn, reader, "secret", "shutdown"); !resp.OK {
+		t.Fatalf("Shutdown command failed: %#v", resp)
+	}
+	select {
+	case <-control.Shutdown():
+	default:
+		t.Fatal("Was expecting shutdown to be requested")
+	}
+	// shutdown is idempotent
+	if resp := controlCommand(t, conn, reader, "secret", "shutdown"); !resp.OK {
+		t.Fatalf("Second shutdown command failed: %#v", resp)
+	}
+
+	control.Close()
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting control socket to be removed on close, but got %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// only SYSTEM and Administrators may connect to the control pipe
+const controlPipeSecurityDescriptor = "D:P(A;;GA;;;SY)(A;;GA;;;BA)"
+
+// listenControlSocket creates a named pipe that only SYSTEM and
+// Administrators can connect to
+func listenControlSocket(name string) (net.Listener, error) {
+	return winio.ListenPipe(name, &winio.PipeConfig{
+		SecurityDescriptor: controlPipeSecurityDescriptor,
+	})
+}
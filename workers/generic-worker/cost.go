@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+var (
+	costPath = filepath.Join("generic-worker", "cost.json")
+	costName = "public/cost.json"
+)
+
+// ResourceUsage tracks the resources consumed by a task, for cost
+// accounting. Downloads may happen in parallel, so access is synchronised.
+type ResourceUsage struct {
+	sync.Mutex
+	BytesDownloaded int64
+	BytesUploaded   int64
+	CPUTime         time.Duration
+}
+
+func (ru *ResourceUsage) addDownloaded(bytes int64) {
+	ru.Lock()
+	defer ru.Unlock()
+	ru.BytesDownloaded += bytes
+}
+
+// downloadCounter counts the bytes read from an http response body that is
+// downloaded on behalf of a task
+type downloadCounter struct {
+	reader io.Reader
+	usage  *ResourceUsage
+}
+
+func (dc *downloadCounter) Read(p []byte) (int, error) {
+	n, err := dc.reader.Read(p)
+	dc.usage.addDownloaded(int64(n))
+	return n, err
+}
+
+// downloadReader returns a reader of the given http response body, subject to
+// the download throttles of the task, that counts the bytes downloaded for
+// cost accounting. All downloads of task content should read through it, so
+// that bytes of failed attempts, resumed downloads and multipart downloads
+// are included.
+func (task *TaskRun) downloadReader(body io.Reader) io.Reader {
+	return throttledReader(&downloadCounter{reader: body, usage: &task.resourceUsage}, task.downloadThrottles)
+}
+
+func (ru *ResourceUsage) addUploaded(bytes int64) {
+	ru.Lock()
+	defer ru.Unlock()
+	ru.BytesUploaded += bytes
+}
+
+func (ru *ResourceUsage) addCPUTime(d time.Duration) {
+	ru.Lock()
+	defer ru.Unlock()
+	ru.CPUTime += d
+}
+
+// TaskCost is the content of the public/cost.json artifact
+type TaskCost struct {
+	TaskID             string  `json:"taskId"`
+	RunID              uint    `json:"runId"`
+	WorkerPoolID       string  `json:"workerPoolId"`
+	InstanceType       string  `json:"instanceType"`
+	Region             string  `json:"region"`
+	WallTimeSeconds    float64 `json:"wallTimeSeconds"`
+	CPUTimeSeconds     float64 `json:"cpuTimeSeconds"`
+	BytesDownloaded    int64   `json:"bytesDownloaded"`
+	BytesUploaded      int64   `json:"bytesUploaded"`
+	InstanceHourlyCost float64 `json:"instanceHourlyCost"`
+	EstimatedCost      float64 `json:"estimatedCost"`
+}
+
+type CostAccountingFeature struct {
+	// hourly cost of the instance from instancePricingURL, if set
+	hourlyCost float64
+}
+
+func (feature *CostAccountingFeature) Name() string {
+	return "Cost Accounting"
+}
+
+func (feature *CostAccountingFeature) Initialise() error {
+	feature.hourlyCost = 0
+	if !config.EnableCostAccounting || config.InstancePricingURL == "" {
+		return nil
+	}
+	cost, err := lookUpInstanceHourlyCost(config.InstancePricingURL)
+	if err != nil {
+		// estimated costs are informational, so don't stop the worker
+		log.Printf("WARNING: could not look up hourly cost of instance type %v in region %v: %v", config.InstanceType, config.Region, err)
+		return nil
+	}
+	log.Printf("Hourly cost of instance type %v in region %v is %v", config.InstanceType, config.Region, cost)
+	feature.hourlyCost = cost
+	return nil
+}
+
+// lookUpInstanceHourlyCost returns the hourly cost of the instance type of the
+// worker in its region, from the pricing document at the given url, which
+// maps "<region>/<instanceType>", or "<instanceType>" for all regions, to an
+// hourly cost
+func lookUpInstanceHourlyCost(url string) (float64, error) {
+	resp, _, err := httpbackoff.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	prices := map[string]float64{}
+	err = json.NewDecoder(resp.Body).Decode(&prices)
+	if err != nil {
+		return 0, fmt.Errorf("Could not interpret pricing document %v as JSON: %v", url, err)
+	}
+	for _, key := range []string{config.Region + "/" + config.InstanceType, config.InstanceType} {
+		if cost, found := prices[key]; found {
+			return cost, nil
+		}
+	}
+	return 0, fmt.Errorf("Pricing document %v has no entry for %q or %q", url, config.Region+"/"+config.InstanceType, config.InstanceType)
+}
+
+func (feature *CostAccountingFeature) PersistState() error {
+	return nil
+}
+
+// Cost accounting is enabled for all tasks by the worker config
+func (feature *CostAccountingFeature) IsEnabled(task *TaskRun) bool {
+	return config.EnableCostAccounting
+}
+
+type CostAccountingTask struct {
+	task       *TaskRun
+	hourlyCost float64
+	started    time.Time
+}
+
+func (feature *CostAccountingFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	// config setting instanceHourlyCost overrides the pricing document
+	hourlyCost := feature.hourlyCost
+	if config.InstanceHourlyCost != 0 {
+		hourlyCost = config.InstanceHourlyCost
+	}
+	return &CostAccountingTask{
+		task:       task,
+		hourlyCost: hourlyCost,
+	}
+}
+
+func (c *CostAccountingTask) RequiredScopes() scopes.Expression {
+	// let's not require any scopes, as I see no reason to control access to this feature
+	return scopes.AllOf{}
+}
+
+func (c *CostAccountingTask) ReservedArtifacts() []string {
+	return []string{
+		costName,
+	}
+}
+
+func (c *CostAccountingTask) Start() *CommandExecutionError {
+	c.started = time.Now()
+	return nil
+}
+
+// Note, the task log is uploaded after all features have stopped, so is not
+// included in the bytes uploaded.
+func (c *CostAccountingTask) Stop(err *ExecutionErrors) {
+	usage := &c.task.resourceUsage
+	usage.Lock()
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	wallTime := time.Now().Round(0).Sub(c.started.Round(0))
+	cost := &TaskCost{
+		TaskID:             c.task.TaskID,
+		RunID:              c.task.RunID,
+		WorkerPoolID:       config.ProvisionerID + "/" + config.WorkerType,
+		InstanceType:       config.InstanceType,
+		Region:             config.Region,
+		WallTimeSeconds:    wallTime.Seconds(),
+		CPUTimeSeconds:     usage.CPUTime.Seconds(),
+		BytesDownloaded:    usage.BytesDownloaded,
+		BytesUploaded:      usage.BytesUploaded,
+		InstanceHourlyCost: c.hourlyCost,
+		EstimatedCost:      wallTime.Hours() * c.hourlyCost,
+	}
+	usage.Unlock()
+	c.task.Infof("[cost] Wall time: %.3fs, CPU time: %.3fs, bytes downloaded: %v, bytes uploaded: %v, estimated cost: %.4f", cost.WallTimeSeconds, cost.CPUTimeSeconds, cost.BytesDownloaded, cost.BytesUploaded, cost.EstimatedCost)
+	logEventWithFields("taskCost", c.task, time.Now(), map[string]interface{}{
+		"wallTimeSeconds": cost.WallTimeSeconds,
+		"cpuTimeSeconds":  cost.CPUTimeSeconds,
+		"bytesDownloaded": cost.BytesDownloaded,
+		"bytesUploaded":   cost.BytesUploaded,
+		"estimatedCost":   cost.EstimatedCost,
+	})
+	costFile := filepath.Join(taskContext.TaskDir, costPath)
+	e := fileutil.WriteToFileAsJSON(cost, costFile)
+	// if we can't write this, something seriously wrong, so cause worker to
+	// report an internal-error to sentry and crash!
+	if e != nil {
+		panic(e)
+	}
+	err.add(c.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    costName,
+				Expires: c.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            costPath,
+		},
+	))
+}
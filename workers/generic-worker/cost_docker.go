@@ -0,0 +1,21 @@
+// +build docker kubernetes
+
+package main
+
+import (
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// The docker and kubernetes engines do not report the CPU time of the
+// container, so only wall time is accounted for.
+func cpuTime(result *process.Result) time.Duration {
+	return 0
+}
+
+func commandResourceUsage(result *process.Result) *ResourceMeasurements {
+	return &ResourceMeasurements{
+		WallTimeSeconds: result.Duration.Seconds(),
+	}
+}
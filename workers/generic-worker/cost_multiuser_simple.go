@@ -0,0 +1,24 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+func cpuTime(result *process.Result) time.Duration {
+	return result.UserTime + result.KernelTime
+}
+
+func commandResourceUsage(result *process.Result) *ResourceMeasurements {
+	return &ResourceMeasurements{
+		WallTimeSeconds:   result.Duration.Seconds(),
+		UserTimeSeconds:   result.UserTime.Seconds(),
+		SystemTimeSeconds: result.KernelTime.Seconds(),
+		MaxRSSBytes:       result.MaxRSSBytes,
+		ReadBytes:         result.ReadBytes,
+		WriteBytes:        result.WriteBytes,
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestCostArtifact(t *testing.T) {
+	defer setup(t)()
+	config.EnableCostAccounting = true
+	config.InstanceHourlyCost = 3.6
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, costPath))
+	if err != nil {
+		t.Fatalf("Could not read cost file: %v", err)
+	}
+	var cost TaskCost
+	err = json.Unmarshal(bytes, &cost)
+	if err != nil {
+		t.Fatalf("Could not interpret cost file as JSON: %v\n%s", err, bytes)
+	}
+	if cost.WallTimeSeconds <= 0 {
+		t.Fatalf("Was expecting a positive wall time, but got %v", cost.WallTimeSeconds)
+	}
+	if cost.InstanceHourlyCost != 3.6 {
+		t.Fatalf("Was expecting instance hourly cost 3.6, but got %v", cost.InstanceHourlyCost)
+	}
+	if math.Abs(cost.EstimatedCost-cost.WallTimeSeconds/1000) > 1e-9 {
+		t.Fatalf("Was expecting estimated cost %v, but got %v", cost.WallTimeSeconds/1000, cost.EstimatedCost)
+	}
+}
+
+func TestLookUpInstanceHourlyCost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"us-west-2/m5.large": 0.096, "m5.large": 0.1, "c5.xlarge": 0.17}`))
+	}))
+	defer server.Close()
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	for _, test := range []struct {
+		region       string
+		instanceType string
+		cost         float64
+	}{
+		{"us-west-2", "m5.large", 0.096},
+		{"eu-central-1", "m5.large", 0.1},
+		{"us-west-2", "c5.xlarge", 0.17},
+	} {
+		config.Region, config.InstanceType = test.region, test.instanceType
+		cost, err := lookUpInstanceHourlyCost(server.URL)
+		if err != nil || cost != test.cost {
+			t.Errorf("Was expecting cost %v for %v in %v, but got %v (%v)", test.cost, test.instanceType, test.region, cost, err)
+		}
+	}
+	config.InstanceType = "t3.nano"
+	if _, err := lookUpInstanceHourlyCost(server.URL); err == nil {
+		t.Fatal("Was expecting an error for an instance type without a price")
+	}
+}
+
+func TestDownloadReaderCountsBytes(t *testing.T) {
+	task := &TaskRun{}
+	var out bytes.Buffer
+	for i := 0; i < 2; i++ {
+		if _, err := out.ReadFrom(task.downloadReader(strings.NewReader("12345"))); err != nil {
+			t.Fatalf("Could not read: %v", err)
+		}
+	}
+	if task.resourceUsage.BytesDownloaded != 10 {
+		t.Fatalf("Was expecting 10 bytes downloaded, but got %v", task.resourceUsage.BytesDownloaded)
+	}
+}
@@ -0,0 +1,153 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+var (
+	// directory, relative to task directory, that the OS is configured to
+	// write crash dumps to
+	crashDumpsDir = filepath.Join("generic-worker", "crashdumps")
+)
+
+type CrashDumpsFeature struct {
+}
+
+func (feature *CrashDumpsFeature) Name() string {
+	return "Crash Dumps"
+}
+
+func (feature *CrashDumpsFeature) PayloadName() string {
+	return "crashDumps"
+}
+
+func (feature *CrashDumpsFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *CrashDumpsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *CrashDumpsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *CrashDumpsFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.CrashDumps
+}
+
+type CrashDumpsTask struct {
+	task    *TaskRun
+	started time.Time
+	// restores the OS crash dump configuration, or nil if it was not changed
+	restore func()
+}
+
+func (feature *CrashDumpsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &CrashDumpsTask{
+		task: task,
+	}
+}
+
+func (cd *CrashDumpsTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (cd *CrashDumpsTask) ReservedArtifacts() []string {
+	// artifact names depend on which processes crash
+	return []string{}
+}
+
+// Start configures the OS to write crash dumps to the crash dumps directory.
+// Dumps are purely diagnostic, so failures are logged rather than failing the
+// task.
+func (cd *CrashDumpsTask) Start() *CommandExecutionError {
+	cd.started = time.Now()
+	dir := filepath.Join(taskContext.TaskDir, crashDumpsDir)
+	err := MkdirAllTaskUser(dir, 0700)
+	if err != nil {
+		panic(err)
+	}
+	cd.restore, err = enableCrashDumps(dir) // platform specific
+	if err != nil {
+		cd.task.Warnf("[crashdumps] Could not configure crash dumps: %v", err)
+		return nil
+	}
+	cd.task.Infof("[crashdumps] Crash dumps of task processes will be written to %v", dir)
+	return nil
+}
+
+func (cd *CrashDumpsTask) Stop(err *ExecutionErrors) {
+	if cd.restore == nil {
+		return
+	}
+	cd.restore()
+	dir := filepath.Join(taskContext.TaskDir, crashDumpsDir)
+	cd.collectCrashReports(dir)
+	files, e := ioutil.ReadDir(dir)
+	if e != nil {
+		cd.task.Warnf("[crashdumps] Could not read crash dumps directory %v: %v", dir, e)
+		return
+	}
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() || fi.Size() == 0 {
+			continue
+		}
+		err.add(cd.task.uploadArtifact(
+			&S3Artifact{
+				BaseArtifact: &BaseArtifact{
+					Name:    crashDumpArtifactName(fi),
+					Expires: cd.task.Definition.Expires,
+				},
+				ContentType:     "application/octet-stream",
+				ContentEncoding: "gzip",
+				Path:            filepath.Join(crashDumpsDir, fi.Name()),
+			},
+		))
+	}
+}
+
+// collectCrashReports copies crash reports that the OS writes to a fixed
+// location (rather than to the crash dumps directory) into dir, if they were
+// written since the feature started
+func (cd *CrashDumpsTask) collectCrashReports(dir string) {
+	for _, reportsDir := range crashReportDirs() { // platform specific
+		reports, err := ioutil.ReadDir(reportsDir)
+		if err != nil {
+			continue
+		}
+		for _, fi := range reports {
+			if !fi.Mode().IsRegular() || fi.ModTime().Before(cd.started) {
+				continue
+			}
+			_, err := fileutil.Copy(filepath.Join(dir, fi.Name()), filepath.Join(reportsDir, fi.Name()))
+			if err != nil {
+				cd.task.Warnf("[crashdumps] Could not collect crash report %v: %v", filepath.Join(reportsDir, fi.Name()), err)
+			}
+		}
+	}
+}
+
+// crashDumpArtifactName returns the artifact name for the given dump file.
+// Dumps are written as <executable>.<pid>.<extension>, so the time of the crash
+// is added, so that repeated crashes of an executable can be distinguished.
+// Crash reports already include the time in their name.
+func crashDumpArtifactName(fi os.FileInfo) string {
+	name := fi.Name()
+	switch ext := filepath.Ext(name); ext {
+	case ".dmp", ".core":
+		name = strings.TrimSuffix(name, ext) + "." + strconv.FormatInt(fi.ModTime().Unix(), 10) + ext
+	}
+	return "public/crashdumps/" + name
+}
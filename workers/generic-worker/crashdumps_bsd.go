@@ -0,0 +1,52 @@
+// +build darwin freebsd
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+// enableCrashDumps sets sysctl kern.corefile so that core files are written
+// to dir, and returns a function that restores the previous kern.corefile.
+func enableCrashDumps(dir string) (restore func(), err error) {
+	out, err := host.CombinedOutput("sysctl", "-n", "kern.corefile")
+	if err != nil {
+		return nil, err
+	}
+	original := strings.TrimSpace(out)
+	restoreLimit, err := raiseCoreLimit()
+	if err != nil {
+		return nil, err
+	}
+	err = host.Run("sysctl", "-w", "kern.corefile="+filepath.Join(dir, "%N.%P.core"))
+	if err != nil {
+		restoreLimit()
+		return nil, err
+	}
+	return func() {
+		restoreLimit()
+		err := host.Run("sysctl", "-w", "kern.corefile="+original)
+		if err != nil {
+			log.Printf("WARNING: could not restore kern.corefile: %v", err)
+		}
+	}, nil
+}
+
+// crashReportDirs returns the directories that ReportCrash writes crash
+// reports to on macOS; these do not exist on FreeBSD
+func crashReportDirs() []string {
+	dirs := []string{
+		"/Library/Logs/DiagnosticReports",
+		// multiuser task directory is the home directory of the task user
+		filepath.Join(taskContext.TaskDir, "Library", "Logs", "DiagnosticReports"),
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Library", "Logs", "DiagnosticReports"))
+	}
+	return dirs
+}
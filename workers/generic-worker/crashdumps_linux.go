@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+)
+
+const corePatternFile = "/proc/sys/kernel/core_pattern"
+
+// enableCrashDumps sets the kernel core_pattern so that core files are written
+// to dir, and returns a function that restores the previous core_pattern. See
+// core(5).
+func enableCrashDumps(dir string) (restore func(), err error) {
+	original, err := ioutil.ReadFile(corePatternFile)
+	if err != nil {
+		return nil, err
+	}
+	restoreLimit, err := raiseCoreLimit()
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(corePatternFile, []byte(filepath.Join(dir, "%e.%p.core")), 0644)
+	if err != nil {
+		restoreLimit()
+		return nil, err
+	}
+	return func() {
+		restoreLimit()
+		err := ioutil.WriteFile(corePatternFile, original, 0644)
+		if err != nil {
+			log.Printf("WARNING: could not restore %v: %v", corePatternFile, err)
+		}
+	}, nil
+}
+
+func crashReportDirs() []string {
+	return nil
+}
@@ -0,0 +1,31 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"log"
+	"syscall"
+)
+
+// raiseCoreLimit raises the soft limit on core file size of the worker to its
+// hard limit, so that task processes (which inherit it) can dump core. The
+// returned function restores the original limit.
+func raiseCoreLimit() (restore func(), err error) {
+	var original syscall.Rlimit
+	err = syscall.Getrlimit(syscall.RLIMIT_CORE, &original)
+	if err != nil {
+		return nil, err
+	}
+	raised := original
+	raised.Cur = raised.Max
+	err = syscall.Setrlimit(syscall.RLIMIT_CORE, &raised)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		err := syscall.Setrlimit(syscall.RLIMIT_CORE, &original)
+		if err != nil {
+			log.Printf("WARNING: could not restore core file size limit: %v", err)
+		}
+	}, nil
+}
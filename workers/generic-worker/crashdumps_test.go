@@ -0,0 +1,42 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCrashDumpArtifactName(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	crashed := time.Unix(1600000000, 0)
+	for file, expected := range map[string]string{
+		"firefox.exe.4242.dmp":                         "public/crashdumps/firefox.exe.4242.1600000000.dmp",
+		"xpcshell.4242.core":                           "public/crashdumps/xpcshell.4242.1600000000.core",
+		"firefox_2020-09-13-122640_mac-worker-1.crash": "public/crashdumps/firefox_2020-09-13-122640_mac-worker-1.crash",
+	} {
+		path := filepath.Join(dir, file)
+		err := ioutil.WriteFile(path, []byte("dump"), 0644)
+		if err != nil {
+			t.Fatalf("Could not write %v: %v", path, err)
+		}
+		err = os.Chtimes(path, crashed, crashed)
+		if err != nil {
+			t.Fatalf("Could not set modification time of %v: %v", path, err)
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Could not stat %v: %v", path, err)
+		}
+		if actual := crashDumpArtifactName(fi); actual != expected {
+			t.Errorf("Was expecting artifact name %q for dump %v but got %q", expected, file, actual)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	// See https://docs.microsoft.com/en-us/windows/win32/wer/collecting-user-mode-dumps
+	werLocalDumpsKey = `SOFTWARE\Microsoft\Windows\Windows Error Reporting\LocalDumps`
+	werMiniDump      = 1
+)
+
+// enableCrashDumps configures Windows Error Reporting to write minidumps of
+// crashing processes to dir, and returns a function that restores the previous
+// configuration. Dumps are named <executable>.<pid>.dmp.
+func enableCrashDumps(dir string) (restore func(), err error) {
+	k, existed, err := registry.CreateKey(registry.LOCAL_MACHINE, werLocalDumpsKey, registry.QUERY_VALUE|registry.SET_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	originalFolder, _, folderErr := k.GetStringValue("DumpFolder")
+	originalType, _, typeErr := k.GetIntegerValue("DumpType")
+	err = k.SetExpandStringValue("DumpFolder", dir)
+	if err != nil {
+		return nil, err
+	}
+	err = k.SetDWordValue("DumpType", werMiniDump)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if !existed {
+			err := registry.DeleteKey(registry.LOCAL_MACHINE, werLocalDumpsKey)
+			if err != nil {
+				log.Printf("WARNING: could not delete registry key %v: %v", werLocalDumpsKey, err)
+			}
+			return
+		}
+		k, err := registry.OpenKey(registry.LOCAL_MACHINE, werLocalDumpsKey, registry.SET_VALUE)
+		if err != nil {
+			log.Printf("WARNING: could not restore registry key %v: %v", werLocalDumpsKey, err)
+			return
+		}
+		defer k.Close()
+		if folderErr == nil {
+			err = k.SetExpandStringValue("DumpFolder", originalFolder)
+		} else {
+			err = k.DeleteValue("DumpFolder")
+		}
+		if err != nil {
+			log.Printf("WARNING: could not restore registry value %v\\DumpFolder: %v", werLocalDumpsKey, err)
+		}
+		if typeErr == nil {
+			err = k.SetDWordValue("DumpType", uint32(originalType))
+		} else {
+			err = k.DeleteValue("DumpType")
+		}
+		if err != nil {
+			log.Printf("WARNING: could not restore registry value %v\\DumpType: %v", werLocalDumpsKey, err)
+		}
+	}, nil
+}
+
+func crashReportDirs() []string {
+	return nil
+}
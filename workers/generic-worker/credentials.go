@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcworkermanager"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+const (
+	// credentials that expire are renewed this long before they expire, or a
+	// quarter of their lifetime before, if that is sooner
+	credentialsRenewalMargin = time.Hour
+	// minimum time between attempts to renew credentials that are due to
+	// expire, if an attempt fails
+	credentialsRetryInterval = time.Minute
+)
+
+// CredentialProvider acquires the Taskcluster credentials of the worker, see
+// config setting credentialProvider
+type CredentialProvider interface {
+	// Credentials acquires credentials for the worker, and returns when they
+	// expire, or the zero time if they don't expire
+	Credentials(c *gwconfig.Config) (*tcclient.Credentials, time.Time, error)
+	// Replaced returns whether the credentials that were acquired at the
+	// given time may have been replaced since, e.g. by an external agent
+	Replaced(since time.Time) bool
+}
+
+// NewCredentialProvider returns the credential provider of config setting
+// credentialProvider
+func NewCredentialProvider(c *gwconfig.Config) (CredentialProvider, error) {
+	requires := func(setting, value string) error {
+		if value == "" {
+			return fmt.Errorf("Config setting \"%v\" must be defined when \"credentialProvider\" is %q", setting, c.CredentialProvider)
+		}
+		return nil
+	}
+	switch c.CredentialProvider {
+	case "", "static":
+		return &StaticCredentialProvider{}, nil
+	case "file":
+		if err := requires("credentialsFile", c.CredentialsFile); err != nil {
+			return nil, err
+		}
+		return &FileCredentialProvider{Path: c.CredentialsFile}, nil
+	case "worker-manager":
+		if err := requires("workerManagerProviderId", c.WorkerManagerProviderID); err != nil {
+			return nil, err
+		}
+		if err := requires("workerManagerStaticSecret", c.WorkerManagerStaticSecret); err != nil {
+			return nil, err
+		}
+		return &WorkerManagerCredentialProvider{Proof: staticIdentityProof}, nil
+	case "aws":
+		if err := requires("workerManagerProviderId", c.WorkerManagerProviderID); err != nil {
+			return nil, err
+		}
+		return &WorkerManagerCredentialProvider{Proof: awsIdentityProof}, nil
+	case "gcp":
+		if err := requires("workerManagerProviderId", c.WorkerManagerProviderID); err != nil {
+			return nil, err
+		}
+		return &WorkerManagerCredentialProvider{Proof: gcpIdentityProof}, nil
+	default:
+		return nil, fmt.Errorf(`Config setting "credentialProvider" has unsupported value %q - allowed values are "static", "file", "worker-manager", "aws" and "gcp"`, c.CredentialProvider)
+	}
+}
+
+// StaticCredentialProvider provides the credentials of config settings
+// clientId, accessToken and certificate
+type StaticCredentialProvider struct {
+}
+
+func (p *StaticCredentialProvider) Credentials(c *gwconfig.Config) (*tcclient.Credentials, time.Time, error) {
+	return c.Credentials(), time.Time{}, nil
+}
+
+func (p *StaticCredentialProvider) Replaced(since time.Time) bool {
+	return false
+}
+
+// FileCredentialProvider provides the credentials in a JSON file, which an
+// external agent may replace at any time with new credentials
+type FileCredentialProvider struct {
+	Path string
+	// modification time of the file when it was last read
+	modTime time.Time
+}
+
+// credentialsFile is the content of the file of a FileCredentialProvider
+type credentialsFile struct {
+	ClientID    string `json:"clientId"`
+	AccessToken string `json:"accessToken"`
+	Certificate string `json:"certificate"`
+	// optional
+	Expires tcclient.Time `json:"expires"`
+}
+
+func (p *FileCredentialProvider) Credentials(c *gwconfig.Config) (*tcclient.Credentials, time.Time, error) {
+	fileInfo, err := os.Stat(p.Path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Could not read credentials file %v (config setting credentialsFile): %v", p.Path, err)
+	}
+	data, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Could not read credentials file %v (config setting credentialsFile): %v", p.Path, err)
+	}
+	var file credentialsFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Could not interpret credentials file %v (config setting credentialsFile) as JSON: %v", p.Path, err)
+	}
+	if file.ClientID == "" || file.AccessToken == "" {
+		return nil, time.Time{}, fmt.Errorf("Credentials file %v (config setting credentialsFile) must contain properties clientId and accessToken", p.Path)
+	}
+	p.modTime = fileInfo.ModTime()
+	return &tcclient.Credentials{
+		ClientID:    file.ClientID,
+		AccessToken: file.AccessToken,
+		Certificate: file.Certificate,
+	}, time.Time(file.Expires), nil
+}
+
+func (p *FileCredentialProvider) Replaced(since time.Time) bool {
+	fileInfo, err := os.Stat(p.Path)
+	// while the file is being replaced, it may be missing
+	return err == nil && !fileInfo.ModTime().Equal(p.modTime)
+}
+
+// WorkerManagerCredentialProvider provides credentials by registering the
+// worker with worker-manager, with the given proof of the identity of the
+// worker
+type WorkerManagerCredentialProvider struct {
+	Proof func(c *gwconfig.Config) (interface{}, error)
+}
+
+func (p *WorkerManagerCredentialProvider) Credentials(c *gwconfig.Config) (*tcclient.Credentials, time.Time, error) {
+	proof, err := p.Proof(c)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("Could not get identity proof of worker: %v", err)
+	}
+	reg, err := registerWorker(c, c.ProvisionerID+"/"+c.WorkerType, c.WorkerManagerProviderID, proof)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return &tcclient.Credentials{
+		ClientID:    reg.Credentials.ClientID,
+		AccessToken: reg.Credentials.AccessToken,
+		Certificate: reg.Credentials.Certificate,
+	}, time.Time(reg.Expires), nil
+}
+
+func (p *WorkerManagerCredentialProvider) Replaced(since time.Time) bool {
+	return false
+}
+
+func staticIdentityProof(c *gwconfig.Config) (interface{}, error) {
+	return &tcworkermanager.StaticProviderType{
+		StaticSecret: c.WorkerManagerStaticSecret,
+	}, nil
+}
+
+func awsIdentityProof(c *gwconfig.Config) (interface{}, error) {
+	document, err := queryAWSMetaData(EC2MetadataBaseURL + "/dynamic/instance-identity/document")
+	if err != nil {
+		return nil, err
+	}
+	signature, err := queryAWSMetaData(EC2MetadataBaseURL + "/dynamic/instance-identity/signature")
+	if err != nil {
+		return nil, err
+	}
+	return &tcworkermanager.AwsProviderType{
+		Document:  string(document),
+		Signature: string(signature),
+	}, nil
+}
+
+func gcpIdentityProof(c *gwconfig.Config) (interface{}, error) {
+	identity, err := queryGCPMetaData(&http.Client{}, "/instance/service-accounts/default/identity?audience="+c.RootURL+"&format=full")
+	if err != nil {
+		return nil, err
+	}
+	return &tcworkermanager.GoogleProviderType{
+		Token: string(identity),
+	}, nil
+}
+
+// WorkerCredentials keeps the credentials of the worker in the config up to
+// date, renewing them before they expire, and when they are replaced
+type WorkerCredentials struct {
+	provider CredentialProvider
+	// when the current credentials were acquired, and expire
+	acquired time.Time
+	expires  time.Time
+	// when the credentials were last due to be renewed, and renewing them
+	// failed
+	failed time.Time
+}
+
+func NewWorkerCredentials(provider CredentialProvider) *WorkerCredentials {
+	return &WorkerCredentials{
+		provider: provider,
+	}
+}
+
+// Acquire acquires credentials from the credential provider, and sets them
+// in the given config
+func (wc *WorkerCredentials) Acquire(c *gwconfig.Config) error {
+	creds, expires, err := wc.provider.Credentials(c)
+	if err != nil {
+		return err
+	}
+	c.ClientID = creds.ClientID
+	c.AccessToken = creds.AccessToken
+	c.Certificate = creds.Certificate
+	wc.acquired = time.Now()
+	wc.expires = expires
+	wc.failed = time.Time{}
+	if !expires.IsZero() {
+		log.Printf("Acquired credentials for client %v, which expire at %v", creds.ClientID, tcclient.Time(expires))
+	}
+	return nil
+}
+
+// Renew acquires new credentials, and sets them in the given config, if the
+// current credentials are due to expire or have been replaced. It returns
+// whether the credentials in the config changed.
+func (wc *WorkerCredentials) Renew(c *gwconfig.Config) (bool, error) {
+	now := time.Now()
+	replaced := wc.provider.Replaced(wc.acquired)
+	if !replaced {
+		if wc.expires.IsZero() || now.Add(wc.renewalMargin()).Before(wc.expires) {
+			return false, nil
+		}
+		// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+		if now.Round(0).Sub(wc.failed.Round(0)) < credentialsRetryInterval {
+			return false, nil
+		}
+	}
+	log.Print("Renewing worker credentials...")
+	if err := wc.Acquire(c); err != nil {
+		wc.failed = now
+		return false, err
+	}
+	return true, nil
+}
+
+// Expired returns whether the current credentials have expired
+func (wc *WorkerCredentials) Expired() bool {
+	return !wc.expires.IsZero() && time.Now().After(wc.expires)
+}
+
+func (wc *WorkerCredentials) renewalMargin() time.Duration {
+	margin := wc.expires.Sub(wc.acquired) / 4
+	if margin > credentialsRenewalMargin {
+		margin = credentialsRenewalMargin
+	}
+	return margin
+}
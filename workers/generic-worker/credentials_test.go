@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestNewCredentialProvider(t *testing.T) {
+	for _, test := range []struct {
+		config gwconfig.Config
+		valid  bool
+	}{
+		{gwconfig.Config{}, true},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "static"}}, true},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "file"}}, false},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "file", CredentialsFile: "creds.json"}}, true},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "worker-manager", WorkerManagerProviderID: "static"}}, false},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "worker-manager", WorkerManagerProviderID: "static"}, PrivateConfig: gwconfig.PrivateConfig{WorkerManagerStaticSecret: "secret"}}, true},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "aws"}}, false},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "gcp", WorkerManagerProviderID: "gcp"}}, true},
+		{gwconfig.Config{PublicConfig: gwconfig.PublicConfig{CredentialProvider: "vault"}}, false},
+	} {
+		_, err := NewCredentialProvider(&test.config)
+		if valid := err == nil; valid != test.valid {
+			t.Errorf("Was expecting credential provider %q to be valid=%v, but got error: %v", test.config.CredentialProvider, test.valid, err)
+		}
+	}
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+	writeCredentials := func(content string, modTime time.Time) {
+		err := ioutil.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(path, modTime, modTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := &gwconfig.Config{}
+	wc := NewWorkerCredentials(&FileCredentialProvider{Path: path})
+
+	if err := wc.Acquire(c); err == nil {
+		t.Fatal("Was expecting an error when the credentials file doesn't exist")
+	}
+
+	writeCredentials(`{"clientId": "client-a", "accessToken": "token-a"}`, time.Now().Add(-time.Minute))
+	if err := wc.Acquire(c); err != nil {
+		t.Fatal(err)
+	}
+	if c.ClientID != "client-a" || c.AccessToken != "token-a" {
+		t.Fatalf("Was expecting credentials of client-a, but got %v", c.ClientID)
+	}
+	if updated, err := wc.Renew(c); updated || err != nil {
+		t.Fatalf("Was not expecting credentials to be renewed if the file hasn't changed, but got %v %v", updated, err)
+	}
+
+	// an external agent rotates the credentials
+	writeCredentials(`{"clientId": "client-b", "accessToken": "token-b", "certificate": "cert-b"}`, time.Now())
+	updated, err := wc.Renew(c)
+	if !updated || err != nil {
+		t.Fatalf("Was expecting credentials to be renewed after the file changed, but got %v %v", updated, err)
+	}
+	if c.ClientID != "client-b" || c.AccessToken != "token-b" || c.Certificate != "cert-b" {
+		t.Fatalf("Was expecting credentials of client-b, but got %v", c.ClientID)
+	}
+	if wc.Expired() {
+		t.Fatal("Was not expecting credentials without expiry to expire")
+	}
+}
+
+// expiringCredentialProvider provides credentials that expire after the
+// given lifetime, and fails once broken
+type expiringCredentialProvider struct {
+	lifetime time.Duration
+	calls    int
+	broken   bool
+}
+
+func (p *expiringCredentialProvider) Credentials(c *gwconfig.Config) (*tcclient.Credentials, time.Time, error) {
+	p.calls++
+	if p.broken {
+		return nil, time.Time{}, os.ErrNotExist
+	}
+	return &tcclient.Credentials{ClientID: "client", AccessToken: "token"}, time.Now().Add(p.lifetime), nil
+}
+
+func (p *expiringCredentialProvider) Replaced(since time.Time) bool {
+	return false
+}
+
+func TestWorkerCredentialsRenewal(t *testing.T) {
+	c := &gwconfig.Config{}
+
+	// credentials that expire in a day aren't renewed yet
+	provider := &expiringCredentialProvider{lifetime: 24 * time.Hour}
+	wc := NewWorkerCredentials(provider)
+	if err := wc.Acquire(c); err != nil {
+		t.Fatal(err)
+	}
+	if updated, _ := wc.Renew(c); updated || provider.calls != 1 {
+		t.Fatalf("Was not expecting credentials that expire in a day to be renewed, but provider was called %v times", provider.calls)
+	}
+
+	// credentials that expire within the hour are renewed
+	wc.expires = time.Now().Add(30 * time.Minute)
+	wc.acquired = wc.expires.Add(-24 * time.Hour)
+	if updated, err := wc.Renew(c); !updated || err != nil || provider.calls != 2 {
+		t.Fatalf("Was expecting credentials to be renewed, but got %v %v after %v calls", updated, err, provider.calls)
+	}
+
+	// failed renewals are retried no more than once a minute
+	provider.broken = true
+	wc.expires = time.Now().Add(-time.Second)
+	if _, err := wc.Renew(c); err == nil {
+		t.Fatal("Was expecting renewal to fail")
+	}
+	if _, err := wc.Renew(c); err != nil || provider.calls != 3 {
+		t.Fatalf("Was not expecting renewal to be retried straight away, but provider was called %v times", provider.calls)
+	}
+	if !wc.Expired() {
+		t.Fatal("Was expecting credentials to have expired")
+	}
+}
@@ -0,0 +1,147 @@
+// Package cron parses cron expressions, such as those of the maintenance
+// windows of the worker.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression, with five space separated fields:
+//
+//   minute        0-59
+//   hour          0-23
+//   day of month  1-31
+//   month         1-12
+//   day of week   0-6 (0 is Sunday, 7 is also accepted for Sunday)
+//
+// Each field is "*", a value, a range "a-b", any of these followed by a step
+// "/n", or a comma separated list of these. As with cron, if both day of
+// month and day of week are restricted (not "*"), a time matches if either
+// matches.
+type Schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	anyDayOfMonth, anyDayOfWeek                bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Parse parses the given cron expression
+func Parse(expr string) (*Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("Cron expression %q has %v fields, but should have %v (minute hour day-of-month month day-of-week)", expr, len(parts), len(fields))
+	}
+	bits := make([]uint64, len(fields))
+	for i, f := range fields {
+		var err error
+		bits[i], err = f.parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("Cron expression %q has invalid %v field: %v", expr, f.name, err)
+		}
+	}
+	// 7 is also Sunday
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &Schedule{
+		minute:        bits[0],
+		hour:          bits[1],
+		dayOfMonth:    bits[2],
+		month:         bits[3],
+		dayOfWeek:     bits[4],
+		anyDayOfMonth: parts[2] == "*",
+		anyDayOfWeek:  parts[4] == "*",
+	}, nil
+}
+
+// parse returns the values of the given field as bits
+func (f field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i != -1 {
+			rangePart = item[:i]
+			var err error
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", item[i+1:])
+			}
+		}
+		from, to := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if from, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if to, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if from > to {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			var err error
+			if from, err = f.value(rangePart); err != nil {
+				return 0, err
+			}
+			// a single value with a step, e.g. 5/15, runs to the end of
+			// the range
+			if step == 1 {
+				to = from
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%q is not a number from %v to %v", s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches returns whether the minute of the given time matches the schedule
+func (s *Schedule) Matches(t time.Time) bool {
+	if s.minute&(1<<uint(t.Minute())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Latest returns the latest minute that matches the schedule, from the given
+// time back to the given earliest time, or the zero time if there isn't one
+func (s *Schedule) Latest(t, earliest time.Time) time.Time {
+	for m := t.Truncate(time.Minute); !m.Before(earliest); m = m.Add(-time.Minute) {
+		if s.Matches(m) {
+			return m
+		}
+	}
+	return time.Time{}
+}
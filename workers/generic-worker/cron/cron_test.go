@@ -0,0 +1,75 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+	} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Was expecting cron expression %q to be invalid", expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// a Sunday
+	sunday := time.Date(2020, 3, 1, 2, 30, 0, 0, time.UTC)
+	for _, test := range []struct {
+		expr    string
+		time    time.Time
+		matches bool
+	}{
+		{"* * * * *", sunday, true},
+		{"30 2 * * *", sunday, true},
+		{"31 2 * * *", sunday, false},
+		{"*/15 * * * *", sunday, true},
+		{"*/20 * * * *", sunday, false},
+		{"0,30 1-3 * * *", sunday, true},
+		{"30 2 * * 0", sunday, true},
+		{"30 2 * * 7", sunday, true},
+		{"30 2 * * 1-5", sunday, false},
+		{"30 2 1 3 *", sunday, true},
+		{"30 2 2 * *", sunday, false},
+		// either day of month or day of week matches
+		{"30 2 2 * 0", sunday, true},
+		{"30 2 1 * 1", sunday, true},
+		{"30 2 2 * 1", sunday, false},
+	} {
+		schedule, err := Parse(test.expr)
+		if err != nil {
+			t.Fatalf("Could not parse %q: %v", test.expr, err)
+		}
+		if matches := schedule.Matches(test.time); matches != test.matches {
+			t.Errorf("Was expecting %q matching %v to be %v", test.expr, test.time, test.matches)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	schedule, err := Parse("0 2 * * 6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sunday
+	now := time.Date(2020, 3, 1, 2, 30, 0, 0, time.UTC)
+	saturday := time.Date(2020, 2, 29, 2, 0, 0, 0, time.UTC)
+	if latest := schedule.Latest(now, now.Add(-48*time.Hour)); !latest.Equal(saturday) {
+		t.Fatalf("Was expecting latest match to be %v but got %v", saturday, latest)
+	}
+	if latest := schedule.Latest(now, now.Add(-time.Hour)); !latest.IsZero() {
+		t.Fatalf("Was not expecting a match within the hour, but got %v", latest)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
+	"golang.org/x/sys/windows"
+)
+
+// DefenderExclusionsFeature excludes the directories that tasks write to from
+// Windows Defender scanning (see defenderExclusions) and Windows Search
+// indexing (see config setting windowsDefenderExclusions). It doesn't do anything for individual tasks.
+type DefenderExclusionsFeature struct {
+	// exclusions added by the worker, which are removed when the worker
+	// exits; exclusions that were already configured are left in place
+	added []string
+}
+
+func (feature *DefenderExclusionsFeature) Name() string {
+	return "Windows Defender Exclusions"
+}
+
+func (feature *DefenderExclusionsFeature) Initialise() error {
+	if !config.WindowsDefenderExclusions {
+		return nil
+	}
+	out, err := powershellOutput(`(Get-MpPreference -ErrorAction Stop).ExclusionPath`)
+	if err != nil {
+		return fmt.Errorf("config setting windowsDefenderExclusions is true but Windows Defender preferences could not be queried: %v", err)
+	}
+	existing := map[string]bool{}
+	for _, line := range strings.Split(out, "\n") {
+		existing[strings.ToLower(filepath.Clean(strings.TrimSpace(line)))] = true
+	}
+	exclusions, err := defenderExclusions()
+	if err != nil {
+		return fmt.Errorf("config setting windowsDefenderExclusions is true but %v", err)
+	}
+	for _, path := range exclusions {
+		if !existing[strings.ToLower(path)] {
+			feature.added = append(feature.added, path)
+		}
+	}
+	for _, dir := range defenderExclusionDirs() {
+		notContentIndexed(dir)
+	}
+	if len(feature.added) == 0 {
+		return nil
+	}
+	_, err = powershellOutput(defenderPreferenceCommand("Add-MpPreference", feature.added))
+	if err != nil {
+		feature.added = nil
+		return fmt.Errorf("could not add Windows Defender exclusions: %v", err)
+	}
+	log.Printf("Added Windows Defender exclusions for %v", strings.Join(feature.added, ", "))
+	return nil
+}
+
+// PersistState is called when the worker exits, so removes the exclusions
+// that the worker added
+func (feature *DefenderExclusionsFeature) PersistState() error {
+	if len(feature.added) == 0 {
+		return nil
+	}
+	_, err := powershellOutput(defenderPreferenceCommand("Remove-MpPreference", feature.added))
+	if err != nil {
+		return fmt.Errorf("could not remove Windows Defender exclusions: %v", err)
+	}
+	log.Printf("Removed Windows Defender exclusions for %v", strings.Join(feature.added, ", "))
+	feature.added = nil
+	return nil
+}
+
+func (feature *DefenderExclusionsFeature) IsEnabled(task *TaskRun) bool {
+	return false
+}
+
+func (feature *DefenderExclusionsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &DefenderExclusionsTask{}
+}
+
+type DefenderExclusionsTask struct {
+}
+
+func (det *DefenderExclusionsTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (det *DefenderExclusionsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (det *DefenderExclusionsTask) Start() *CommandExecutionError {
+	return nil
+}
+
+func (det *DefenderExclusionsTask) Stop(err *ExecutionErrors) {
+}
+
+// defenderExclusionDirs returns the absolute paths of the tasks, caches and
+// downloads directories, in that order
+func defenderExclusionDirs() []string {
+	dirs := []string{}
+	for _, dir := range []string{config.TasksDir, config.CachesDir, config.DownloadsDir} {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			abs = dir
+		}
+		dirs = append(dirs, filepath.Clean(abs))
+	}
+	return dirs
+}
+
+// defenderExclusions returns the paths that are excluded from Windows Defender
+// scanning. The tasks directory may also hold profiles of users other than
+// task users (by default it is the profiles directory), so rather than the
+// whole directory, only task directories (see taskUserOfDir) are excluded.
+// The caches and downloads directories belong to the worker, so are excluded
+// completely, if that doesn't also exclude the system (see
+// validateDefenderExclusion).
+func defenderExclusions() ([]string, error) {
+	dirs := defenderExclusionDirs()
+	exclusions := []string{filepath.Join(dirs[0], "task_*")}
+	for _, dir := range dirs[1:] {
+		err := validateDefenderExclusion(dir)
+		if err != nil {
+			return nil, err
+		}
+		exclusions = append(exclusions, dir)
+	}
+	return exclusions, nil
+}
+
+// validateDefenderExclusion returns an error if excluding dir from Windows
+// Defender scanning would also exclude files that don't belong to the worker,
+// i.e. if dir is the root of a volume, or is or contains the profiles
+// directory, or the Windows or Program Files directories
+func validateDefenderExclusion(dir string) error {
+	if filepath.Dir(dir) == dir {
+		return fmt.Errorf("%v is the root of a volume, so can't be excluded from Windows Defender scanning", dir)
+	}
+	protected := []string{win32.ProfilesDirectory()}
+	for _, env := range []string{"SystemRoot", "ProgramFiles", "ProgramFiles(x86)"} {
+		protected = append(protected, os.Getenv(env))
+	}
+	for _, p := range protected {
+		if p != "" && pathContains(dir, p) {
+			return fmt.Errorf("%v contains %v, so can't be excluded from Windows Defender scanning", dir, p)
+		}
+	}
+	return nil
+}
+
+// pathContains returns whether path is dir, or inside dir, ignoring case,
+// since Windows paths are case insensitive
+func pathContains(dir, path string) bool {
+	rel, err := filepath.Rel(strings.ToLower(filepath.Clean(dir)), strings.ToLower(filepath.Clean(path)))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// defenderPreferenceCommand returns the PowerShell command that adds or
+// removes (depending on cmdlet) the given Windows Defender exclusions
+func defenderPreferenceCommand(cmdlet string, exclusions []string) string {
+	return cmdlet + ` -ErrorAction Stop -ExclusionPath ` + powershellList(exclusions)
+}
+
+// notContentIndexed excludes dir from Windows Search indexing. Files and
+// directories that are created in it inherit the attribute.
+func notContentIndexed(dir string) {
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return
+	}
+	attributes, err := windows.GetFileAttributes(path)
+	if err == nil {
+		err = windows.SetFileAttributes(path, attributes|windows.FILE_ATTRIBUTE_NOT_CONTENT_INDEXED)
+	}
+	if err != nil {
+		log.Printf("WARNING: could not exclude %v from Windows Search indexing: %v", dir, err)
+	}
+}
+
+// powershellList returns the given strings as a PowerShell array of single
+// quoted strings
+func powershellList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "'" + strings.Replace(item, "'", "''", -1) + "'"
+	}
+	return strings.Join(quoted, ",")
+}
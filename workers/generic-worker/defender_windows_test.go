@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
+)
+
+func TestDefenderExclusions(t *testing.T) {
+	profiles := win32.ProfilesDirectory()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			TasksDir:     profiles,
+			CachesDir:    `D:\generic-worker\caches`,
+			DownloadsDir: `D:\generic-worker\downloads`,
+		},
+	}
+	defer func() { config = nil }()
+	exclusions, err := defenderExclusions()
+	if err != nil {
+		t.Fatalf("Could not determine Windows Defender exclusions: %v", err)
+	}
+	// the tasks directory holds other user profiles too, so only the task
+	// directories in it are excluded
+	expected := []string{filepath.Join(profiles, "task_*"), `D:\generic-worker\caches`, `D:\generic-worker\downloads`}
+	if !reflect.DeepEqual(exclusions, expected) {
+		t.Fatalf("Was expecting Windows Defender exclusions %q but got %q", expected, exclusions)
+	}
+
+	for _, dir := range []string{
+		`C:\`,
+		`D:\`,
+		profiles,
+		filepath.Dir(profiles),
+		os.Getenv("SystemRoot"),
+		strings.ToUpper(os.Getenv("ProgramFiles")),
+	} {
+		config.CachesDir = dir
+		if _, err := defenderExclusions(); err == nil {
+			t.Errorf("Was expecting caches directory %v not to be excluded from Windows Defender scanning", dir)
+		}
+	}
+	// directories outside of the tasks directory, and inside the profile of
+	// the worker user, can be excluded
+	for _, dir := range []string{`C:\generic-worker\caches`, filepath.Join(profiles, "GenericWorker", "caches")} {
+		if err := validateDefenderExclusion(dir); err != nil {
+			t.Errorf("Was expecting %v to be a valid Windows Defender exclusion, but got: %v", dir, err)
+		}
+	}
+}
+
+func TestDefenderPreferenceCommand(t *testing.T) {
+	command := defenderPreferenceCommand("Add-MpPreference", []string{`C:\Users\task_*`, `D:\it's\caches`})
+	expected := `Add-MpPreference -ErrorAction Stop -ExclusionPath 'C:\Users\task_*','D:\it''s\caches'`
+	if command != expected {
+		t.Fatalf("Was expecting command %q but got %q", expected, command)
+	}
+}
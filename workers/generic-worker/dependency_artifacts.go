@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+type (
+	// DependencyArtifactsFeature checks that the upstream artifacts that
+	// task.payload.mounts and task.payload.fetches refer to exist before they
+	// are downloaded (see config setting checkDependencyArtifacts), so that a
+	// task whose dependency didn't produce an artifact fails straight away,
+	// rather than part way through downloading its other mounts and fetches
+	DependencyArtifactsFeature struct {
+	}
+
+	DependencyArtifactsTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *DependencyArtifactsFeature) Name() string {
+	return "Dependency Artifacts"
+}
+
+func (feature *DependencyArtifactsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *DependencyArtifactsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *DependencyArtifactsFeature) IsEnabled(task *TaskRun) bool {
+	return config.CheckDependencyArtifacts && (len(task.Payload.Mounts) > 0 || len(task.Payload.Fetches) > 0)
+}
+
+func (feature *DependencyArtifactsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &DependencyArtifactsTask{
+		task: task,
+	}
+}
+
+func (dat *DependencyArtifactsTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (dat *DependencyArtifactsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (dat *DependencyArtifactsTask) Start() *CommandExecutionError {
+	missing := []string{}
+	for _, ac := range dat.dependencyArtifacts() {
+		if _, inCache := fileCaches[ac.UniqueKey()]; inCache {
+			continue
+		}
+		exists, err := dependencyArtifactExists(ac)
+		if err != nil {
+			// not conclusive, so leave it to the download to fail, if it
+			// is going to
+			dat.task.Warnf("[dependency artifacts] Could not check whether %v exists: %v", ac, err)
+			continue
+		}
+		if !exists {
+			dat.task.Errorf("[dependency artifacts] Dependency artifact missing: %v", ac)
+			missing = append(missing, ac.String())
+		}
+	}
+	if len(missing) > 0 {
+		return MalformedPayloadError(fmt.Errorf("[dependency artifacts] Dependency artifact missing: %v", strings.Join(missing, ", ")))
+	}
+	return nil
+}
+
+func (dat *DependencyArtifactsTask) Stop(err *ExecutionErrors) {
+}
+
+// dependencyArtifacts returns the artifacts that task.payload.mounts and
+// task.payload.fetches refer to by taskId, ordered by task and artifact name.
+// Fetches that refer to an index namespace are resolved by the Fetches
+// feature when it starts, so are not included. Invalid mounts are skipped,
+// since the Mounts feature reports them.
+func (dat *DependencyArtifactsTask) dependencyArtifacts() []*ArtifactContent {
+	artifacts := map[string]*ArtifactContent{}
+	tm := (&MountsFeature{}).NewTaskFeature(dat.task).(*TaskMount)
+	if tm.payloadError == nil {
+		for _, mount := range tm.mounts {
+			fsContent, err := mount.FSContent()
+			if err != nil {
+				continue
+			}
+			if ac, isArtifact := fsContent.(*ArtifactContent); isArtifact {
+				artifacts[ac.UniqueKey()] = ac
+			}
+		}
+	}
+	for _, fetch := range dat.task.Payload.Fetches {
+		if fetch.TaskID == "" {
+			continue
+		}
+		ac := &ArtifactContent{
+			Artifact: fetch.Artifact,
+			TaskID:   fetch.TaskID,
+		}
+		artifacts[ac.UniqueKey()] = ac
+	}
+	keys := make([]string, 0, len(artifacts))
+	for key := range artifacts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*ArtifactContent, len(keys))
+	for i, key := range keys {
+		result[i] = artifacts[key]
+	}
+	return result
+}
+
+// dependencyArtifactExists makes a HEAD request for the latest run of the
+// given artifact. The queue responds with 404 if the artifact doesn't exist
+// and 424 if it is an error artifact, neither of which a download would
+// recover from.
+func dependencyArtifactExists(ac *ArtifactContent) (bool, error) {
+	signedURL, err := queue.GetLatestArtifact_SignedURL(ac.TaskID, ac.Artifact, signedURLDuration())
+	if err != nil {
+		return false, err
+	}
+	resp, err := http.Head(signedURL.String())
+	if err != nil {
+		return false, err
+	}
+	_ = resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound, resp.StatusCode == http.StatusFailedDependency:
+		return false, nil
+	case resp.StatusCode >= 400:
+		return false, fmt.Errorf("HEAD %v returned %v", ac, resp.Status)
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func TestDependencyArtifactsMissing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/api/queue/v1/task/upstream/artifacts/public/exists.zip":
+			w.WriteHeader(http.StatusOK)
+		case "/api/queue/v1/task/upstream/artifacts/public/error.zip":
+			w.WriteHeader(http.StatusFailedDependency)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	queue = tcqueue.New(&tcclient.Credentials{ClientID: "test-client", AccessToken: "test-token"}, server.URL)
+	defer func() {
+		queue = nil
+	}()
+	fileCaches = CacheMap{}
+	task := &TaskRun{
+		Definition: tcqueue.TaskDefinitionResponse{
+			Dependencies: []string{"upstream"},
+		},
+		logWriter: &bytes.Buffer{},
+	}
+	err := json.Unmarshal([]byte(`{
+  "mounts": [
+    {"file": "a.zip", "content": {"taskId": "upstream", "artifact": "public/exists.zip"}},
+    {"directory": "b", "format": "zip", "content": {"taskId": "upstream", "artifact": "public/missing.zip"}},
+    {"file": "c.txt", "content": {"raw": "hello"}}
+  ],
+  "fetches": [
+    {"taskId": "upstream", "artifact": "public/error.zip", "path": "d.zip"},
+    {"namespace": "some.index.namespace", "artifact": "public/indexed.zip", "path": "e.zip"}
+  ]
+}`), &task.Payload)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	dat := (&DependencyArtifactsFeature{}).NewTaskFeature(task)
+	cee := dat.Start()
+	if cee == nil {
+		t.Fatalf("Was expecting missing dependency artifacts to be reported")
+	}
+	if cee.Reason != malformedPayload {
+		t.Errorf("Was expecting reason %v but got %v", malformedPayload, cee.Reason)
+	}
+	expected := "[dependency artifacts] Dependency artifact missing: task upstream artifact public/error.zip, task upstream artifact public/missing.zip"
+	if cee.Cause.Error() != expected {
+		t.Errorf("Was expecting error %q but got %q", expected, cee.Cause.Error())
+	}
+	if strings.Contains(task.logWriter.(*bytes.Buffer).String(), "exists.zip") {
+		t.Errorf("Existing artifact should not have been reported as missing:\n%v", task.logWriter)
+	}
+}
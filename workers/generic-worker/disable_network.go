@@ -0,0 +1,108 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// DisableNetworkFeature runs the commands of tasks that enable
+// task.payload.features.disableNetwork (or of all tasks, if config setting
+// disableNetwork is enabled) without network access, for hermetic build
+// verification. Attempts of the task to use the network fail straight away,
+// and are reported when the task ends, where the platform allows.
+type DisableNetworkFeature struct {
+}
+
+func (feature *DisableNetworkFeature) Name() string {
+	return "Disable Network"
+}
+
+func (feature *DisableNetworkFeature) Initialise() error {
+	if !config.DisableNetwork {
+		return nil
+	}
+	if err := disableNetworkSupported(); err != nil {
+		return fmt.Errorf("Config setting disableNetwork is enabled, but %v", err)
+	}
+	return nil
+}
+
+func (feature *DisableNetworkFeature) PersistState() error {
+	return nil
+}
+
+func (feature *DisableNetworkFeature) IsEnabled(task *TaskRun) bool {
+	return networkDisabled(task)
+}
+
+// networkDisabled returns whether the task runs without network access
+func networkDisabled(task *TaskRun) bool {
+	return config.DisableNetwork || task.Payload.Features.DisableNetwork
+}
+
+type DisableNetworkTask struct {
+	task *TaskRun
+	// nil if the commands of the task already run without network access
+	block *networkBlock
+}
+
+func (feature *DisableNetworkFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &DisableNetworkTask{
+		task: task,
+	}
+}
+
+func (dn *DisableNetworkTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (dn *DisableNetworkTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (dn *DisableNetworkTask) Start() *CommandExecutionError {
+	if taskRequiresNetwork(dn.task) {
+		if config.DisableNetwork {
+			return MalformedPayloadError(fmt.Errorf("[network] Task requires network access, but network access is disabled on this worker (config setting disableNetwork)"))
+		}
+		return MalformedPayloadError(fmt.Errorf("[network] Task payload features network and disableNetwork cannot both be enabled"))
+	}
+	if err := disableNetworkSupported(); err != nil {
+		return MalformedPayloadError(fmt.Errorf("[network] Task requires network access to be disabled, but %v", err))
+	}
+	block, err := newNetworkBlock(dn.task)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[network] Could not disable network access of task: %v", err))
+	}
+	dn.block = block
+	if block != nil {
+		for _, c := range dn.task.Commands {
+			block.wrap(c.Cmd)
+		}
+	}
+	dn.task.Info("[network] Running task commands without network access")
+	return nil
+}
+
+func (dn *DisableNetworkTask) Stop(err *ExecutionErrors) {
+	if dn.block == nil {
+		return
+	}
+	attempts, e := dn.block.attempts()
+	if e != nil {
+		dn.task.Warnf("[network] Could not count attempts of task to use the network: %v", e)
+	}
+	if attempts > 0 {
+		dn.task.Warnf("[network] Task attempted to use the network %v times, which failed since network access is disabled", attempts)
+		logEventWithFields("networkAccessRejected", dn.task, time.Now(), map[string]interface{}{
+			"attempts": attempts,
+		})
+	}
+	if e := dn.block.remove(); e != nil {
+		dn.task.Warnf("[network] Could not restore network access: %v", e)
+	}
+}
@@ -0,0 +1,136 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+const (
+	// the only (dummy) network interface of the empty network namespace
+	// besides loopback, which the default route points at, so that traffic
+	// leaving the task can be rejected straight away and counted
+	blackholeInterface = "gw-blackhole"
+	// TEST-NET-1 (RFC 5737) address, which is never reachable, so that DNS
+	// lookups of the task are counted as attempts to use the network
+	blackholeNameserver = "192.0.2.1"
+)
+
+// networkBlock is an empty network namespace that task commands run in
+type networkBlock struct {
+	network *taskNetwork
+}
+
+func taskRequiresNetwork(task *TaskRun) bool {
+	return task.Payload.Features.Network
+}
+
+func disableNetworkSupported() error {
+	// all task isolation methods run task commands without network access,
+	// unless the task enables feature network
+	if config.TaskIsolation != "" {
+		return nil
+	}
+	return findNetworkNamespaceTools()
+}
+
+// newNetworkBlock creates an empty network namespace for the task, or returns
+// nil if task isolation already runs the task commands without network
+// access
+func newNetworkBlock(task *TaskRun) (*networkBlock, error) {
+	if config.TaskIsolation != "" {
+		return nil, nil
+	}
+	network := &taskNetwork{
+		namespace: taskNetworkNamespace,
+		disabled:  true,
+	}
+	// left behind if the worker didn't stop cleanly
+	if _, err := os.Stat(filepath.Join("/run/netns", network.namespace)); err == nil {
+		_ = network.remove()
+	}
+	block := &networkBlock{
+		network: network,
+	}
+	err := block.writeResolvConf()
+	if err == nil {
+		err = host.RunBatch(false, block.setupCommands()...)
+	}
+	if err != nil {
+		_ = network.remove()
+		return nil, err
+	}
+	return block, nil
+}
+
+func (block *networkBlock) inNamespace(command ...string) []string {
+	return append([]string{ipCommand, "netns", "exec", block.network.namespace}, command...)
+}
+
+// setupCommands returns the commands that create the empty network namespace,
+// in which all traffic other than to loopback is rejected
+func (block *networkBlock) setupCommands() [][]string {
+	return [][]string{
+		{ipCommand, "netns", "add", block.network.namespace},
+		block.inNamespace(ipCommand, "link", "set", "lo", "up"),
+		block.inNamespace(ipCommand, "link", "add", blackholeInterface, "type", "dummy"),
+		block.inNamespace(ipCommand, "link", "set", blackholeInterface, "up"),
+		block.inNamespace(ipCommand, "route", "add", "default", "dev", blackholeInterface),
+		block.inNamespace(iptablesCommand, "-A", "OUTPUT", "-o", blackholeInterface, "-j", "REJECT", "--reject-with", "icmp-net-unreachable"),
+	}
+}
+
+// writeResolvConf points DNS lookups in the network namespace at an
+// unreachable nameserver, rather than at the nameservers of the host (such as
+// the stub resolver of systemd-resolved on loopback), so that they fail
+// straight away and are counted
+func (block *networkBlock) writeResolvConf() error {
+	dir := filepath.Join("/etc/netns", block.network.namespace)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), []byte("nameserver "+blackholeNameserver+"\n"), 0644)
+}
+
+func (block *networkBlock) wrap(cmd *exec.Cmd) {
+	block.network.wrap(cmd)
+}
+
+// attempts returns the number of packets that the task has tried to send
+// over the network, which were rejected
+func (block *networkBlock) attempts() (uint64, error) {
+	command := block.inNamespace(iptablesCommand, "-nvxL", "OUTPUT")
+	out, err := host.CombinedOutput(command[0], command[1:]...)
+	if err != nil {
+		return 0, err
+	}
+	return rejectedPackets(out)
+}
+
+// rejectedPackets returns the packet count of the REJECT rule in the given
+// output of `iptables -nvxL OUTPUT`
+func rejectedPackets(iptablesOutput string) (uint64, error) {
+	scanner := bufio.NewScanner(strings.NewReader(iptablesOutput))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[2] == "REJECT" {
+			return strconv.ParseUint(fields[0], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no REJECT rule in iptables output:\n%v", iptablesOutput)
+}
+
+// remove deletes the network namespace
+func (block *networkBlock) remove() error {
+	return block.network.remove()
+}
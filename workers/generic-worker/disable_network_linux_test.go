@@ -0,0 +1,54 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRejectedPackets(t *testing.T) {
+	output := `Chain OUTPUT (policy ACCEPT 0 packets, 0 bytes)
+    pkts      bytes target     prot opt in     out     source               destination
+      17     1020 REJECT     all  --  *      gw-blackhole  0.0.0.0/0            0.0.0.0/0            reject-with icmp-net-unreachable
+`
+	attempts, err := rejectedPackets(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 17 {
+		t.Errorf("Was expecting 17 attempts but got %v", attempts)
+	}
+	if _, err := rejectedPackets("Chain OUTPUT (policy ACCEPT 0 packets, 0 bytes)\n"); err == nil {
+		t.Error("Was expecting an error when there is no REJECT rule")
+	}
+}
+
+func TestNetworkBlockSetupCommands(t *testing.T) {
+	oldIPCommand, oldIptablesCommand := ipCommand, iptablesCommand
+	ipCommand, iptablesCommand = "/sbin/ip", "/sbin/iptables"
+	defer func() {
+		ipCommand, iptablesCommand = oldIPCommand, oldIptablesCommand
+	}()
+	block := &networkBlock{
+		network: &taskNetwork{
+			namespace: taskNetworkNamespace,
+			disabled:  true,
+		},
+	}
+	commands := []string{}
+	for _, command := range block.setupCommands() {
+		commands = append(commands, strings.Join(command, " "))
+	}
+	expected := []string{
+		"/sbin/ip netns add generic-worker-task",
+		"/sbin/ip netns exec generic-worker-task /sbin/ip link set lo up",
+		"/sbin/ip netns exec generic-worker-task /sbin/ip link add gw-blackhole type dummy",
+		"/sbin/ip netns exec generic-worker-task /sbin/ip link set gw-blackhole up",
+		"/sbin/ip netns exec generic-worker-task /sbin/ip route add default dev gw-blackhole",
+		"/sbin/ip netns exec generic-worker-task /sbin/iptables -A OUTPUT -o gw-blackhole -j REJECT --reject-with icmp-net-unreachable",
+	}
+	if strings.Join(commands, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Was expecting setup commands\n%v\nbut got\n%v", strings.Join(expected, "\n"), strings.Join(commands, "\n"))
+	}
+}
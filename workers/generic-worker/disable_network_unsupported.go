@@ -0,0 +1,46 @@
+// +build darwin,multiuser darwin,simple freebsd,simple
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// networkBlock is never needed, since either the task isolation sandbox
+// already runs task commands without network access, or disabling network
+// access is not supported
+type networkBlock struct {
+}
+
+func taskRequiresNetwork(task *TaskRun) bool {
+	return task.Payload.Features.Network
+}
+
+func disableNetworkSupported() error {
+	// only the sandbox of config setting taskIsolation (sandboxExec on macOS)
+	// can run task commands without network access
+	if config.TaskIsolation != "" {
+		return nil
+	}
+	if runtime.GOOS == "darwin" {
+		return fmt.Errorf("disabling network access requires config setting taskIsolation to be %q on %v", "sandboxExec", runtime.GOOS)
+	}
+	return fmt.Errorf("disabling network access is not supported on %v", runtime.GOOS)
+}
+
+func newNetworkBlock(task *TaskRun) (*networkBlock, error) {
+	return nil, nil
+}
+
+func (block *networkBlock) wrap(cmd *exec.Cmd) {
+}
+
+func (block *networkBlock) attempts() (uint64, error) {
+	return 0, nil
+}
+
+func (block *networkBlock) remove() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+// +build multiuser
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// networkBlock is a Windows Firewall rule that blocks outbound connections of
+// the task user. Windows Firewall doesn't count the connections that a rule
+// blocks, so attempts of the task to use the network are not reported.
+type networkBlock struct {
+	ruleName string
+}
+
+// tasks can't enable feature network on Windows, since there is no task
+// isolation sandbox that blocks network access
+func taskRequiresNetwork(task *TaskRun) bool {
+	return false
+}
+
+func disableNetworkSupported() error {
+	if config.RunTasksAsCurrentUser {
+		return fmt.Errorf("disabling network access is not supported when config setting runTasksAsCurrentUser is enabled, since firewall rules would apply to the worker itself")
+	}
+	if config.TaskIsolation != "" {
+		return fmt.Errorf("disabling network access is not supported when config setting taskIsolation is set, since task commands don't run as the task user on the host")
+	}
+	return nil
+}
+
+func newNetworkBlock(task *TaskRun) (*networkBlock, error) {
+	user := taskContext.User
+	sid, _, _, err := windows.LookupSID("", user.Name)
+	if err != nil {
+		return nil, fmt.Errorf("could not look up SID of task user %v: %v", user.Name, err)
+	}
+	block := &networkBlock{
+		ruleName: "generic-worker-disable-network-" + user.Name,
+	}
+	// left behind if the worker didn't stop cleanly
+	_ = block.remove()
+	_, err = powershellOutput(fmt.Sprintf(`New-NetFirewallRule -Name '%v' -DisplayName '%v' -Direction Outbound -Action Block -LocalUser 'D:(A;;CC;;;%v)'`, block.ruleName, block.ruleName, sid.String()))
+	if err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+func (block *networkBlock) wrap(cmd *exec.Cmd) {
+}
+
+func (block *networkBlock) attempts() (uint64, error) {
+	return 0, nil
+}
+
+func (block *networkBlock) remove() error {
+	_, err := powershellOutput(fmt.Sprintf(`Remove-NetFirewallRule -Name '%v' -ErrorAction SilentlyContinue`, block.ruleName))
+	return err
+}
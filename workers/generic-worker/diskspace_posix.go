@@ -8,6 +8,9 @@ import (
 )
 
 func freeDiskSpaceBytes(dir string) (uint64, error) {
+	if injectedDiskFull() {
+		return 0, nil
+	}
 	var stat syscall.Statfs_t
 	err := syscall.Statfs(dir, &stat)
 	if err != nil {
@@ -8,6 +8,9 @@ import (
 )
 
 func freeDiskSpaceBytes(dir string) (uint64, error) {
+	if injectedDiskFull() {
+		return 0, nil
+	}
 	path, err := syscall.UTF16PtrFromString(".")
 	if err != nil {
 		return 0, err
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// maximum time that querying or changing display settings may take
+const displayTimeout = 60 * time.Second
+
+// displayScript queries the display settings of the primary display and the
+// DPI of the task user, after changing those that are not 0, and writes them
+// to standard output as JSON. A negative DPI removes the DPI setting of the
+// task user, which restores the default DPI.
+const displayScript = `
+$ErrorActionPreference = 'Stop'
+Add-Type -TypeDefinition @'
+using System;
+using System.Runtime.InteropServices;
+public static class Display {
+    [StructLayout(LayoutKind.Sequential, CharSet = CharSet.Unicode)]
+    public struct DEVMODE {
+        [MarshalAs(UnmanagedType.ByValTStr, SizeConst = 32)] public string dmDeviceName;
+        public short dmSpecVersion;
+        public short dmDriverVersion;
+        public short dmSize;
+        public short dmDriverExtra;
+        public int dmFields;
+        public int dmPositionX;
+        public int dmPositionY;
+        public int dmDisplayOrientation;
+        public int dmDisplayFixedOutput;
+        public short dmColor;
+        public short dmDuplex;
+        public short dmYResolution;
+        public short dmTTOption;
+        public short dmCollate;
+        [MarshalAs(UnmanagedType.ByValTStr, SizeConst = 32)] public string dmFormName;
+        public short dmLogPixels;
+        public int dmBitsPerPel;
+        public int dmPelsWidth;
+        public int dmPelsHeight;
+        public int dmDisplayFlags;
+        public int dmDisplayFrequency;
+        public int dmICMMethod;
+        public int dmICMIntent;
+        public int dmMediaType;
+        public int dmDitherType;
+        public int dmReserved1;
+        public int dmReserved2;
+        public int dmPanningWidth;
+        public int dmPanningHeight;
+    }
+    [DllImport("user32.dll", CharSet = CharSet.Unicode)]
+    public static extern bool EnumDisplaySettings(string deviceName, int modeNum, ref DEVMODE devMode);
+    [DllImport("user32.dll", CharSet = CharSet.Unicode)]
+    public static extern int ChangeDisplaySettings(ref DEVMODE devMode, int flags);
+    [DllImport("user32.dll")]
+    public static extern bool SetProcessDPIAware();
+    [DllImport("user32.dll")]
+    public static extern IntPtr GetDC(IntPtr hWnd);
+    [DllImport("user32.dll")]
+    public static extern int ReleaseDC(IntPtr hWnd, IntPtr hDC);
+    [DllImport("gdi32.dll")]
+    public static extern int GetDeviceCaps(IntPtr hDC, int index);
+    public static DEVMODE Current() {
+        DEVMODE dm = new DEVMODE();
+        dm.dmSize = (short)Marshal.SizeOf(dm);
+        if (!EnumDisplaySettings(null, -1, ref dm)) {
+            throw new Exception("Could not read current display settings");
+        }
+        return dm;
+    }
+}
+'@
+[Display]::SetProcessDPIAware() | Out-Null
+$desktop = 'HKCU:\Control Panel\Desktop'
+$logPixels = (Get-ItemProperty -Path $desktop -Name LogPixels -ErrorAction SilentlyContinue).LogPixels
+if ($logPixels -eq $null) { $logPixels = 0 }
+$dm = [Display]::Current()
+$fields = 0
+if ({{.Width}} -gt 0) {
+    $dm.dmPelsWidth = {{.Width}}
+    $dm.dmPelsHeight = {{.Height}}
+    $fields = $fields -bor 0x180000
+}
+if ({{.ColorDepth}} -gt 0) {
+    $dm.dmBitsPerPel = {{.ColorDepth}}
+    $fields = $fields -bor 0x40000
+}
+if ($fields -ne 0) {
+    $dm.dmFields = $fields
+    # CDS_TEST
+    $result = [Display]::ChangeDisplaySettings([ref]$dm, 2)
+    if ($result -ne 0) {
+        ConvertTo-Json -Compress @{ unsupported = "ChangeDisplaySettings returned $result" }
+        exit 0
+    }
+    $result = [Display]::ChangeDisplaySettings([ref]$dm, 0)
+    if ($result -ne 0) {
+        throw "ChangeDisplaySettings returned $result"
+    }
+}
+if ({{.DPI}} -gt 0) {
+    Set-ItemProperty -Path $desktop -Name LogPixels -Value {{.DPI}} -Type DWord
+    Set-ItemProperty -Path $desktop -Name Win8DpiScaling -Value 1 -Type DWord
+}
+if ({{.DPI}} -lt 0) {
+    Remove-ItemProperty -Path $desktop -Name LogPixels -ErrorAction SilentlyContinue
+}
+$current = [Display]::Current()
+$hdc = [Display]::GetDC([IntPtr]::Zero)
+# LOGPIXELSX
+$dpi = [Display]::GetDeviceCaps($hdc, 88)
+[Display]::ReleaseDC([IntPtr]::Zero, $hdc) | Out-Null
+ConvertTo-Json -Compress @{
+    width = $current.dmPelsWidth
+    height = $current.dmPelsHeight
+    colorDepth = $current.dmBitsPerPel
+    dpi = $dpi
+    logPixels = $logPixels
+}
+`
+
+type (
+	// DisplayFeature configures the display of the task user's desktop with
+	// the resolution, color depth and DPI in task.payload.display, before
+	// the task commands run, and restores the original settings afterwards
+	DisplayFeature struct {
+	}
+
+	DisplayTask struct {
+		task *TaskRun
+		// settings before they were changed, if they were changed
+		original *displaySettings
+	}
+
+	// displaySettings is the output of displayScript
+	displaySettings struct {
+		Width      int64 `json:"width"`
+		Height     int64 `json:"height"`
+		ColorDepth int64 `json:"colorDepth"`
+		// DPI of the logon session
+		DPI int64 `json:"dpi"`
+		// DPI setting of the task user before it was changed, or 0 if it
+		// wasn't set
+		LogPixels int64 `json:"logPixels"`
+		// reason that the requested display settings are not supported
+		Unsupported string `json:"unsupported"`
+	}
+)
+
+func (feature *DisplayFeature) Name() string {
+	return "Display"
+}
+
+func (feature *DisplayFeature) PayloadName() string {
+	return "display"
+}
+
+func (feature *DisplayFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *DisplayFeature) Initialise() error {
+	return nil
+}
+
+func (feature *DisplayFeature) PersistState() error {
+	return nil
+}
+
+func (feature *DisplayFeature) IsEnabled(task *TaskRun) bool {
+	display := task.Payload.Display
+	return display.Width > 0 || display.Height > 0 || display.ColorDepth > 0 || display.Dpi > 0
+}
+
+func (feature *DisplayFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &DisplayTask{
+		task: task,
+	}
+}
+
+func (dt *DisplayTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (dt *DisplayTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (dt *DisplayTask) Start() *CommandExecutionError {
+	requested := dt.task.Payload.Display
+	if (requested.Width > 0) != (requested.Height > 0) {
+		return MalformedPayloadError(fmt.Errorf("[display] task.payload.display must set both width and height, or neither"))
+	}
+	original, err := dt.apply(0, 0, 0, 0)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[display] Could not read display settings: %v", err))
+	}
+	dt.task.Infof("[display] Display settings are %v", original)
+	// restore the original settings even if they were only partially
+	// changed
+	dt.original = original
+	applied, err := dt.apply(requested.Width, requested.Height, requested.ColorDepth, requested.Dpi)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[display] Could not change display settings: %v", err))
+	}
+	if applied.Unsupported != "" {
+		return MalformedPayloadError(fmt.Errorf("[display] The display adapter of this worker doesn't support task.payload.display settings %v: %v", dt.requested(), applied.Unsupported))
+	}
+	if (requested.Width > 0 && (applied.Width != requested.Width || applied.Height != requested.Height)) || (requested.ColorDepth > 0 && applied.ColorDepth != requested.ColorDepth) {
+		return MalformedPayloadError(fmt.Errorf("[display] Requested display settings %v but the display adapter of this worker applied %v", dt.requested(), applied))
+	}
+	if requested.Dpi > 0 && applied.DPI != requested.Dpi {
+		dt.task.Warnf("[display] DPI of the task user is set to %v, but the logon session still has DPI %v, which only some applications will override", requested.Dpi, applied.DPI)
+	}
+	dt.task.Infof("[display] Changed display settings to %v", applied)
+	return nil
+}
+
+// Stop restores the display settings that were changed
+func (dt *DisplayTask) Stop(err *ExecutionErrors) {
+	if dt.original == nil {
+		return
+	}
+	requested := dt.task.Payload.Display
+	var width, height, colorDepth, dpi int64
+	if requested.Width > 0 {
+		width, height = dt.original.Width, dt.original.Height
+	}
+	if requested.ColorDepth > 0 {
+		colorDepth = dt.original.ColorDepth
+	}
+	if requested.Dpi > 0 {
+		dpi = dt.original.LogPixels
+		if dpi == 0 {
+			dpi = -1
+		}
+	}
+	restored, e := dt.apply(width, height, colorDepth, dpi)
+	switch {
+	case e != nil:
+		dt.task.Warnf("[display] Could not restore display settings: %v", e)
+	case restored.Unsupported != "":
+		dt.task.Warnf("[display] Could not restore display settings: %v", restored.Unsupported)
+	default:
+		dt.task.Infof("[display] Restored display settings to %v", restored)
+	}
+}
+
+// apply runs displayScript as the task user, in order to change the given
+// display settings, other than those that are 0
+func (dt *DisplayTask) apply(width, height, colorDepth, dpi int64) (*displaySettings, error) {
+	script := displayScript
+	for placeholder, value := range map[string]int64{
+		"{{.Width}}":      width,
+		"{{.Height}}":     height,
+		"{{.ColorDepth}}": colorDepth,
+		"{{.DPI}}":        dpi,
+	} {
+		script = strings.Replace(script, placeholder, strconv.FormatInt(value, 10), -1)
+	}
+	cmd, err := process.NewCommand([]string{"powershell.exe", "-NoProfile", "-NonInteractive", "-EncodedCommand", encodePowerShell(script)}, taskContext.TaskDir, nil, taskContext.pd)
+	if err != nil {
+		return nil, err
+	}
+	out := &bytes.Buffer{}
+	cmd.DirectOutput(out)
+	result := make(chan *process.Result, 1)
+	go func() {
+		result <- cmd.Execute()
+	}()
+	select {
+	case r := <-result:
+		if !r.Succeeded() {
+			return nil, fmt.Errorf("%v: %v", r, strings.TrimSpace(out.String()))
+		}
+	case <-time.After(displayTimeout):
+		_, _ = cmd.Kill()
+		return nil, fmt.Errorf("timed out after %v", displayTimeout)
+	}
+	return parseDisplaySettings(out.Bytes())
+}
+
+// encodePowerShell encodes the given script for powershell.exe option
+// -EncodedCommand, which avoids quoting it on the command line
+func encodePowerShell(script string) string {
+	b := []byte{}
+	for _, u := range utf16.Encode([]rune(script)) {
+		b = append(b, byte(u), byte(u>>8))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// parseDisplaySettings parses the last line of the output of displayScript
+func parseDisplaySettings(out []byte) (*displaySettings, error) {
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	settings := &displaySettings{}
+	err := json.Unmarshal([]byte(strings.TrimSpace(lines[len(lines)-1])), settings)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse display settings %q: %v", string(out), err)
+	}
+	return settings, nil
+}
+
+func (dt *DisplayTask) requested() string {
+	requested := dt.task.Payload.Display
+	settings := []string{}
+	if requested.Width > 0 {
+		settings = append(settings, fmt.Sprintf("%vx%v", requested.Width, requested.Height))
+	}
+	if requested.ColorDepth > 0 {
+		settings = append(settings, fmt.Sprintf("%v bits per pixel", requested.ColorDepth))
+	}
+	if requested.Dpi > 0 {
+		settings = append(settings, fmt.Sprintf("%v DPI", requested.Dpi))
+	}
+	return strings.Join(settings, ", ")
+}
+
+func (settings *displaySettings) String() string {
+	return fmt.Sprintf("%vx%v, %v bits per pixel, %v DPI", settings.Width, settings.Height, settings.ColorDepth, settings.DPI)
+}
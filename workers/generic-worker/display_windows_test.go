@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidthWithoutHeight(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 10,
+		Display: DisplaySettings{
+			Width: 1920,
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestDisplayResolution(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 60,
+		Display: DisplaySettings{
+			Width:      1024,
+			Height:     768,
+			ColorDepth: 32,
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	logtext := string(bytes)
+	for _, expected := range []string{"[display] Changed display settings to 1024x768, 32 bits per pixel", "[display] Restored display settings"} {
+		if !strings.Contains(logtext, expected) {
+			t.Fatalf("Was expecting log to contain %q but it didn't:\n%v", expected, logtext)
+		}
+	}
+}
+
+func TestParseDisplaySettings(t *testing.T) {
+	settings, err := parseDisplaySettings([]byte("WARNING: noise\r\n{\"width\":1920,\"height\":1080,\"colorDepth\":32,\"dpi\":96,\"logPixels\":0}\r\n"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if settings.String() != "1920x1080, 32 bits per pixel, 96 DPI" {
+		t.Fatalf("Unexpected display settings %v", settings)
+	}
+	if _, err := parseDisplaySettings([]byte("Exception calling ChangeDisplaySettings")); err == nil {
+		t.Fatal("Was expecting output without display settings to be invalid")
+	}
+}
@@ -2,7 +2,11 @@
 
 package main
 
-import "os"
+import (
+	"os"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
 
 const (
 	engine = "docker"
@@ -14,3 +18,21 @@ func secure(configFile string) {
 func MkdirAllTaskUser(dir string, perms os.FileMode) (err error) {
 	return nil
 }
+
+func platformFeatures() []Feature {
+	return []Feature{
+		&DockerFeature{},
+	}
+}
+
+func (task *TaskRun) generateCommand(index int) error {
+	var err error
+	task.Commands[index], err = process.NewCommand(task.Payload.Command[index], taskContext.TaskDir, task.EnvVars())
+	if err != nil {
+		return err
+	}
+	task.logMux.RLock()
+	defer task.logMux.RUnlock()
+	task.Commands[index].DirectOutput(task.logWriter)
+	return nil
+}
@@ -0,0 +1,193 @@
+// +build docker
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const dockerImagesFile = "docker-images.json"
+
+// dockerImages are the docker images that tasks have run in, which are owned
+// by the worker, and may be garbage collected
+var dockerImages DockerImages
+
+type (
+	// DockerImages maps image names to the images that tasks have run in
+	DockerImages map[string]*DockerImage
+
+	// DockerImage is a docker image that tasks have run in
+	DockerImage struct {
+		Name     string    `json:"name"`
+		LastUsed time.Time `json:"lastUsed"`
+	}
+
+	// DockerFeature pulls the docker images that tasks run in, using the
+	// registry credentials and mirrors in the worker config, or loads them
+	// from task artifacts (see task.payload.image), and records
+	// which images tasks run in, so that images that haven't been used
+	// recently can be garbage collected. It doesn't need to be enabled by
+	// tasks.
+	DockerFeature struct {
+	}
+
+	DockerTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *DockerFeature) Name() string {
+	return "Docker"
+}
+
+func (feature *DockerFeature) Initialise() error {
+	if config.DockerPullAttempts == 0 {
+		config.DockerPullAttempts = 5
+	}
+	err := dockerRegistryLogin()
+	if err != nil {
+		return err
+	}
+	dockerImages = DockerImages{}
+	if _, err := os.Stat(dockerImagesFile); err != nil {
+		log.Printf("No %v file found, creating empty DockerImages", dockerImagesFile)
+		return nil
+	}
+	return loadFromJSONFile(&dockerImages, dockerImagesFile)
+}
+
+func (feature *DockerFeature) PersistState() error {
+	err := fileutil.WriteToFileAsJSON(&dockerImages, dockerImagesFile)
+	if err != nil {
+		return err
+	}
+	return fileutil.SecureFiles(dockerImagesFile)
+}
+
+func (feature *DockerFeature) IsEnabled(task *TaskRun) bool {
+	return true
+}
+
+func (feature *DockerFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &DockerTask{
+		task: task,
+	}
+}
+
+// RequiredScopes returns the scopes needed to download the image artifact of
+// the task, if it has one
+func (dt *DockerTask) RequiredScopes() scopes.Expression {
+	ac, err := dt.task.imageArtifact()
+	if err != nil || ac == nil {
+		return scopes.AllOf{}
+	}
+	return ac.RequiredScopes()
+}
+
+func (dt *DockerTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (dt *DockerTask) Start() *CommandExecutionError {
+	image, err := dt.task.dockerImage()
+	if err != nil {
+		return err
+	}
+	dockerImages.Used(image, time.Now())
+	dt.task.setImage(image)
+	return nil
+}
+
+func (dt *DockerTask) Stop(err *ExecutionErrors) {
+}
+
+// Used records that the given image was used at the given time
+func (images DockerImages) Used(name string, at time.Time) {
+	if image, exists := images[name]; exists {
+		image.LastUsed = at
+		return
+	}
+	images[name] = &DockerImage{
+		Name:     name,
+		LastUsed: at,
+	}
+}
+
+// SortedResources returns the images that are not pinned, least recently used
+// first
+func (images DockerImages) SortedResources(pinned []string) Resources {
+	isPinned := map[string]bool{}
+	for _, name := range pinned {
+		isPinned[name] = true
+	}
+	r := Resources{}
+	for _, image := range images {
+		if !isPinned[image.Name] {
+			r = append(r, image)
+		}
+	}
+	sort.Sort(r)
+	return r
+}
+
+// Rating is the time the image was last used, so that the least recently
+// used images are deleted first
+func (image *DockerImage) Rating() float64 {
+	return float64(image.LastUsed.UnixNano())
+}
+
+func (image *DockerImage) Expunge(task *TaskRun) error {
+	log.Printf("Removing docker image %v, last used %v", image.Name, image.LastUsed)
+	out, err := host.CombinedOutput(process.DockerPath(), "image", "rm", image.Name)
+	// the image may have been removed behind the worker's back
+	if err != nil && !strings.Contains(out, "No such image") {
+		return fmt.Errorf("Could not remove docker image %v: %v", image.Name, err)
+	}
+	delete(dockerImages, image.Name)
+	return nil
+}
+
+// dockerGarbageCollection removes the stopped containers that task commands
+// ran in, and if the docker root directory is short of free space, removes
+// the least recently used images that tasks ran in, other than those in
+// config setting dockerPinnedImages. Errors are logged rather than returned,
+// since the worker can still run tasks if images can't be removed.
+func dockerGarbageCollection() {
+	err := host.Run(process.DockerPath(), "container", "prune", "--force", "--filter", "label="+process.ContainerLabel)
+	if err != nil {
+		log.Printf("WARNING: could not remove stopped docker containers: %v", err)
+	}
+	out, err := host.CombinedOutput(process.DockerPath(), "info", "--format", "{{.DockerRootDir}}")
+	if err != nil {
+		log.Printf("WARNING: could not find docker root directory: %v", err)
+		return
+	}
+	rootDir := strings.TrimSpace(out)
+	r := dockerImages.SortedResources(config.DockerPinnedImages)
+	for !r.Empty() {
+		freeSpace, err := freeDiskSpaceBytes(rootDir)
+		if err != nil {
+			log.Printf("WARNING: could not calculate free disk space in docker root directory %v: %v", rootDir, err)
+			return
+		}
+		if freeSpace >= requiredSpaceBytes() {
+			return
+		}
+		// images that are still used by containers that the worker doesn't
+		// own can't be removed, so try the next one
+		if err := r[0].Expunge(nil); err != nil {
+			log.Printf("WARNING: %v", err)
+		}
+		r = r[1:]
+	}
+}
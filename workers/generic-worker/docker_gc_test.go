@@ -0,0 +1,29 @@
+// +build docker
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDockerImagesLeastRecentlyUsedFirst(t *testing.T) {
+	now := time.Now()
+	images := DockerImages{}
+	images.Used("ubuntu", now.Add(-time.Hour))
+	images.Used("debian", now.Add(-3*time.Hour))
+	images.Used("alpine", now.Add(-2*time.Hour))
+	images.Used("fedora", now.Add(-4*time.Hour))
+	// used again since, so now the most recently used
+	images.Used("debian", now)
+	r := images.SortedResources([]string{"fedora"})
+	expected := []string{"alpine", "ubuntu", "debian"}
+	if len(r) != len(expected) {
+		t.Fatalf("Was expecting %v unpinned images but got %v", len(expected), len(r))
+	}
+	for i, name := range expected {
+		if image := r[i].(*DockerImage); image.Name != name {
+			t.Errorf("Was expecting image %v to be %v but got %v", i, name, image.Name)
+		}
+	}
+}
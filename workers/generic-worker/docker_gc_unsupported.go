@@ -0,0 +1,8 @@
+// +build !docker
+
+package main
+
+// dockerGarbageCollection is a no-op, since docker images and containers are
+// only owned by the worker with the docker engine
+func dockerGarbageCollection() {
+}
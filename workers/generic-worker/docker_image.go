@@ -0,0 +1,116 @@
+// +build docker
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// artifactImageRepository is the repository that images loaded from task
+// artifacts are tagged in, with the SHA 256 of the image archive as tag, so
+// that later tasks with the same archive reuse the loaded image
+const artifactImageRepository = "generic-worker/artifact-image"
+
+// imageArtifact returns the artifact that task.payload.image refers to, or
+// nil if it refers to an image by name
+func (task *TaskRun) imageArtifact() (*ArtifactContent, error) {
+	image := task.Payload.Image
+	if image.TaskID == "" && image.Artifact == "" && image.Sha256 == "" {
+		return nil, nil
+	}
+	if image.Name != "" {
+		return nil, fmt.Errorf("[docker] task.payload.image must set either name, or taskId and artifact, but not both")
+	}
+	if image.TaskID == "" || image.Artifact == "" {
+		return nil, fmt.Errorf("[docker] task.payload.image must set both taskId and artifact, in order to load the image from an artifact")
+	}
+	return &ArtifactContent{
+		TaskID:   image.TaskID,
+		Artifact: image.Artifact,
+		Sha256:   image.Sha256,
+	}, nil
+}
+
+// dockerImage pulls or loads the image that task.payload.image refers to,
+// and returns its name
+func (task *TaskRun) dockerImage() (string, *CommandExecutionError) {
+	ac, err := task.imageArtifact()
+	if err != nil {
+		return "", MalformedPayloadError(err)
+	}
+	if ac != nil {
+		return task.loadImage(ac)
+	}
+	image := task.Payload.Image.Name
+	if image == "" {
+		image = process.DefaultImage
+	}
+	return image, task.pullImage(image)
+}
+
+// loadImage downloads the given image archive, unless it is already in the
+// file cache, and loads it, unless an archive with the same SHA 256 has
+// already been loaded
+func (task *TaskRun) loadImage(ac *ArtifactContent) (string, *CommandExecutionError) {
+	taskDependencies := map[string]bool{}
+	for _, taskID := range task.Definition.Dependencies {
+		taskDependencies[taskID] = true
+	}
+	if !taskDependencies[ac.TaskID] {
+		return "", MalformedPayloadError(fmt.Errorf("[docker] task.dependencies needs to include %v since the task image is one of its artifacts", ac.TaskID))
+	}
+	file, err := ensureCached(ac, task)
+	if err != nil {
+		return "", Failure(fmt.Errorf("[docker] Could not download image from %v: %v", ac, err))
+	}
+	image := artifactImageRepository + ":" + fileCaches[ac.UniqueKey()].SHA256
+	if _, err := host.CombinedOutput(process.DockerPath(), "image", "inspect", image); err == nil {
+		task.Infof("[docker] Using image %v, already loaded from an archive with the same SHA 256 as %v", image, ac)
+		return image, nil
+	}
+	task.Infof("[docker] Loading image from %v", ac)
+	out, err := host.CombinedOutput(process.DockerPath(), "image", "load", "--input", file)
+	if err != nil {
+		return "", Failure(fmt.Errorf("[docker] Could not load image from %v: %v: %v", ac, err, strings.TrimSpace(out)))
+	}
+	loaded := loadedImage(out)
+	if loaded == "" {
+		return "", Failure(fmt.Errorf("[docker] %v does not contain an image", ac))
+	}
+	_, err = host.CombinedOutput(process.DockerPath(), "image", "tag", loaded, image)
+	if err != nil {
+		return "", ResourceUnavailable(fmt.Errorf("[docker] Could not tag %v as %v: %v", loaded, image, err))
+	}
+	// only keep the name that the image is garbage collected under, unless
+	// the archive retagged an image that tasks have run in
+	if !strings.HasPrefix(loaded, "sha256:") && dockerImages[loaded] == nil {
+		_, _ = host.CombinedOutput(process.DockerPath(), "image", "rm", loaded)
+	}
+	task.Infof("[docker] Loaded image %v from %v as %v", loaded, ac, image)
+	return image, nil
+}
+
+// loadedImage returns the name, or if it has none, the ID, of the first image
+// that `docker image load` reported in the given output
+func loadedImage(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range []string{"Loaded image: ", "Loaded image ID: "} {
+			if strings.HasPrefix(line, prefix) {
+				return strings.TrimSpace(strings.TrimPrefix(line, prefix))
+			}
+		}
+	}
+	return ""
+}
+
+// setImage sets the image that each task command runs in
+func (task *TaskRun) setImage(image string) {
+	for i := range task.Commands {
+		task.Commands[i].SetImage(image)
+	}
+}
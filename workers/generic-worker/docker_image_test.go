@@ -0,0 +1,49 @@
+// +build docker
+
+package main
+
+import (
+	"testing"
+)
+
+func TestLoadedImage(t *testing.T) {
+	for _, test := range []struct {
+		out   string
+		image string
+	}{
+		{"Loaded image: myimage:latest\n", "myimage:latest"},
+		{"Loaded image ID: sha256:4e5021d210f6\nLoaded image ID: sha256:9aa4bce6a4e2\n", "sha256:4e5021d210f6"},
+		{"open /downloads/abc: no such file or directory\n", ""},
+	} {
+		if image := loadedImage(test.out); image != test.image {
+			t.Errorf("Was expecting image loaded according to %q to be %q but got %q", test.out, test.image, image)
+		}
+	}
+}
+
+func TestImageArtifact(t *testing.T) {
+	task := &TaskRun{}
+	if ac, err := task.imageArtifact(); ac != nil || err != nil {
+		t.Fatalf("Was expecting no image artifact without task.payload.image, but got %v, %v", ac, err)
+	}
+	task.Payload.Image.Name = "ubuntu:20.04"
+	if ac, err := task.imageArtifact(); ac != nil || err != nil {
+		t.Fatalf("Was expecting no image artifact for named image, but got %v, %v", ac, err)
+	}
+	task.Payload.Image.TaskID = "KTBKfEgxR5GdfIIREQIvFQ"
+	if _, err := task.imageArtifact(); err == nil {
+		t.Fatal("Was expecting task.payload.image with name and taskId to be invalid")
+	}
+	task.Payload.Image.Name = ""
+	if _, err := task.imageArtifact(); err == nil {
+		t.Fatal("Was expecting task.payload.image with taskId but no artifact to be invalid")
+	}
+	task.Payload.Image.Artifact = "public/image.tar.gz"
+	ac, err := task.imageArtifact()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if ac.UniqueKey() != "artifact:KTBKfEgxR5GdfIIREQIvFQ:public/image.tar.gz" {
+		t.Fatalf("Unexpected image artifact %v", ac.UniqueKey())
+	}
+}
@@ -0,0 +1,160 @@
+// +build docker
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	dockerHub = "docker.io"
+	// minimum time to wait before retrying a pull that a registry has rate
+	// limited, since rate limits are typically applied per hour or more
+	dockerRateLimitWait = time.Minute
+)
+
+// dockerRegistryCredentials is the content of the secrets listed in config
+// setting dockerRegistrySecrets
+type dockerRegistryCredentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// dockerRegistryLogin logs the docker client in to each registry in config
+// setting dockerRegistrySecrets, with the credentials in the given secret.
+func dockerRegistryLogin() error {
+	secretsClient := config.Secrets()
+	for _, registry := range sortedKeys(config.DockerRegistrySecrets) {
+		name := config.DockerRegistrySecrets[registry]
+		secret, err := secretsClient.Get(name)
+		if err != nil {
+			return fmt.Errorf("could not get secret %v with credentials of docker registry %v: %v", name, registry, err)
+		}
+		credentials := &dockerRegistryCredentials{}
+		err = json.Unmarshal(secret.Secret, credentials)
+		if err != nil || credentials.Username == "" || credentials.Password == "" {
+			return fmt.Errorf("secret %v with credentials of docker registry %v must have string properties username and password", name, registry)
+		}
+		// the password is passed on stdin, so that it isn't logged, or
+		// visible in the process list
+		cmd := exec.Command(process.DockerPath(), "login", "--username", credentials.Username, "--password-stdin", registry)
+		cmd.Stdin = strings.NewReader(credentials.Password)
+		_, err = host.RunCommand(cmd)
+		if err != nil {
+			return fmt.Errorf("could not log in to docker registry %v: %v", registry, err)
+		}
+		log.Printf("Logged in to docker registry %v as %v", registry, credentials.Username)
+	}
+	return nil
+}
+
+// pullImage pulls the given image, unless it is already present. Images from
+// Docker Hub are pulled from the mirrors in config setting
+// dockerRegistryMirrors if possible, and only from Docker Hub if none of the
+// mirrors have them.
+func (task *TaskRun) pullImage(image string) *CommandExecutionError {
+	if _, err := host.CombinedOutput(process.DockerPath(), "image", "inspect", image); err == nil {
+		return nil
+	}
+	if dockerRegistry(image) == dockerHub {
+		for _, mirror := range config.DockerRegistryMirrors {
+			ref := strings.TrimSuffix(mirror, "/") + "/" + dockerHubRepository(image)
+			err := task.pull(ref)
+			if err != nil {
+				task.Warnf("[docker] Could not pull %v from mirror %v: %v", image, mirror, err)
+				continue
+			}
+			// tag the image with its own name, so that it is used by task
+			// commands, and garbage collected under it
+			_, err = host.CombinedOutput(process.DockerPath(), "image", "tag", ref, image)
+			if err != nil {
+				return ResourceUnavailable(fmt.Errorf("[docker] Could not tag %v as %v: %v", ref, image, err))
+			}
+			_, _ = host.CombinedOutput(process.DockerPath(), "image", "rm", ref)
+			return nil
+		}
+	}
+	if err := task.pull(image); err != nil {
+		return ResourceUnavailable(fmt.Errorf("[docker] Could not pull %v: %v", image, err))
+	}
+	return nil
+}
+
+// pull pulls the given image reference, retrying transient failures up to
+// config setting dockerPullAttempts times in total. Retries of pulls that
+// the registry has rate limited wait at least dockerRateLimitWait.
+func (task *TaskRun) pull(ref string) error {
+	b := backoff.NewExponentialBackOff()
+	b.MaxElapsedTime = 0
+	for attempt := uint(1); ; attempt++ {
+		task.Infof("[docker] Pulling %v", ref)
+		out, err := host.CombinedOutput(process.DockerPath(), "pull", ref)
+		if err == nil {
+			return nil
+		}
+		err = fmt.Errorf("%v: %v", err, strings.TrimSpace(out))
+		retry, rateLimited := dockerPullRetryable(out)
+		if !retry || attempt >= config.DockerPullAttempts {
+			return err
+		}
+		wait := b.NextBackOff()
+		if rateLimited && wait < dockerRateLimitWait {
+			wait = dockerRateLimitWait
+		}
+		task.Warnf("[docker] Attempt %v of %v to pull %v failed, retrying in %v: %v", attempt, config.DockerPullAttempts, ref, wait, err)
+		time.Sleep(wait)
+	}
+}
+
+// dockerPullRetryable returns whether a pull that failed with the given
+// output should be retried, and whether the registry rate limited it
+func dockerPullRetryable(out string) (retry, rateLimited bool) {
+	out = strings.ToLower(out)
+	if strings.Contains(out, "toomanyrequests") || strings.Contains(out, "too many requests") || strings.Contains(out, "rate limit") {
+		return true, true
+	}
+	for _, permanent := range []string{"not found", "manifest unknown", "unauthorized", "denied", "invalid reference format"} {
+		if strings.Contains(out, permanent) {
+			return false, false
+		}
+	}
+	return true, false
+}
+
+// dockerRegistry returns the registry of the given image, which is Docker Hub
+// unless the first component of the image name is a host name
+func dockerRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return dockerHub
+	}
+	first := image[:i]
+	if first == "localhost" || strings.ContainsAny(first, ".:") {
+		if first == "index.docker.io" || first == "registry-1.docker.io" {
+			return dockerHub
+		}
+		return first
+	}
+	return dockerHub
+}
+
+// dockerHubRepository returns the fully qualified name, without the registry,
+// of the given Docker Hub image, which is how mirrors of Docker Hub name it
+func dockerHubRepository(image string) string {
+	if i := strings.Index(image, "/"); i >= 0 && dockerRegistry(image) == dockerHub && strings.ContainsAny(image[:i], ".:") {
+		image = image[i+1:]
+	}
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	return image
+}
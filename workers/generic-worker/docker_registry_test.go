@@ -0,0 +1,50 @@
+// +build docker
+
+package main
+
+import (
+	"testing"
+)
+
+func TestDockerHubRepository(t *testing.T) {
+	for _, test := range []struct {
+		image      string
+		registry   string
+		repository string
+	}{
+		{"ubuntu", "docker.io", "library/ubuntu"},
+		{"ubuntu:20.04", "docker.io", "library/ubuntu:20.04"},
+		{"taskcluster/websocktunnel:latest", "docker.io", "taskcluster/websocktunnel:latest"},
+		{"docker.io/library/ubuntu", "docker.io", "library/ubuntu"},
+		{"ghcr.io/mozilla/image", "ghcr.io", ""},
+		{"localhost:5000/image", "localhost:5000", ""},
+	} {
+		if registry := dockerRegistry(test.image); registry != test.registry {
+			t.Errorf("Was expecting registry of %v to be %v but got %v", test.image, test.registry, registry)
+		}
+		if test.repository == "" {
+			continue
+		}
+		if repository := dockerHubRepository(test.image); repository != test.repository {
+			t.Errorf("Was expecting Docker Hub repository of %v to be %v but got %v", test.image, test.repository, repository)
+		}
+	}
+}
+
+func TestDockerPullRetryable(t *testing.T) {
+	for _, test := range []struct {
+		out         string
+		retry       bool
+		rateLimited bool
+	}{
+		{"Error response from daemon: toomanyrequests: You have reached your pull rate limit.", true, true},
+		{"Error response from daemon: manifest for ubuntu:nope not found: manifest unknown", false, false},
+		{"Error response from daemon: pull access denied for private/image", false, false},
+		{"Error response from daemon: Get https://registry-1.docker.io/v2/: net/http: TLS handshake timeout", true, false},
+	} {
+		retry, rateLimited := dockerPullRetryable(test.out)
+		if retry != test.retry || rateLimited != test.rateLimited {
+			t.Errorf("Was expecting pull failure %q to have retry %v and rate limited %v but got %v and %v", test.out, test.retry, test.rateLimited, retry, rateLimited)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/taskcluster/httpbackoff/v3"
+)
+
+// multipartDownload downloads content that is at least
+// config.MultipartDownloadMinMB in size with config.DownloadConnections
+// parallel range requests. Each connection downloads chunks of
+// downloadChunkSize bytes in turn, and a chunk whose download fails is retried
+// on its own.
+type multipartDownload struct {
+	url           string
+	contentSource string
+	file          *os.File
+	task          *TaskRun
+	size          int64
+	// precondition that each range request carries, so that the chunks all
+	// come from the same version of the content
+	precondition http.Header
+}
+
+// multipartDownloadURLToFile downloads url to file with parallel range
+// requests, and returns true, if config settings downloadConnections and
+// multipartDownloadMinMB allow it, and the server supports range requests of
+// the unencoded content. Otherwise it returns false without writing file, and
+// the content should be downloaded with a single request.
+func multipartDownloadURLToFile(url, contentSource, file string, task *TaskRun) (multipart bool, contentSize int64, validators *HTTPValidators, err error) {
+	if config.DownloadConnections <= 1 {
+		return false, 0, nil, nil
+	}
+	md, validators := probeMultipartDownload(url, contentSource, task)
+	if md == nil {
+		return false, 0, nil, nil
+	}
+	md.file, err = os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		task.Errorf("[mounts] Could not open file %v: %v", file, err)
+		return true, 0, nil, err
+	}
+	defer md.file.Close()
+	err = md.file.Truncate(md.size)
+	if err != nil {
+		task.Errorf("[mounts] Could not allocate %v bytes for file %v: %v", md.size, file, err)
+		return true, 0, nil, err
+	}
+	connections := int64(config.DownloadConnections)
+	chunks := (md.size + downloadChunkSize - 1) / downloadChunkSize
+	if chunks < connections {
+		connections = chunks
+	}
+	task.Infof("[mounts] Downloading %v bytes from %v to %v with %v connections", md.size, contentSource, file, connections)
+	err = md.download(chunks, connections)
+	if err != nil {
+		task.Errorf("[mounts] Could not fetch from %v into file %v: %v", contentSource, file, err)
+		return true, 0, nil, err
+	}
+	return true, md.size, validators, nil
+}
+
+// probeMultipartDownload requests the first byte of the content at url, to
+// find out its size and whether the server supports range requests. It
+// returns nil if the content should not be downloaded in parts.
+func probeMultipartDownload(url, contentSource string, task *TaskRun) (*multipartDownload, *HTTPValidators) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, nil
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	// parts of transparently decompressed content can't be reassembled
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := http.DefaultClient.Do(req)
+	clockSkew.observe(resp)
+	if err != nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, nil
+	}
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+		return nil, nil
+	}
+	_, _, size, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || size < int64(config.MultipartDownloadMinMB)*1024*1024 {
+		return nil, nil
+	}
+	md := &multipartDownload{
+		url:           url,
+		contentSource: contentSource,
+		task:          task,
+		size:          size,
+		precondition:  http.Header{},
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	switch {
+	case etag != "" && !strings.HasPrefix(etag, "W/"):
+		// If-Match requires a strong validator
+		md.precondition.Set("If-Match", etag)
+	case lastModified != "":
+		md.precondition.Set("If-Unmodified-Since", lastModified)
+	default:
+		// without a validator, a change of content during the download
+		// would go unnoticed
+		return nil, nil
+	}
+	return md, &HTTPValidators{
+		ETag:         etag,
+		LastModified: lastModified,
+	}
+}
+
+// download downloads the given number of chunks with the given number of
+// connections, stopping at the first chunk that can't be downloaded
+func (md *multipartDownload) download(chunks, connections int64) error {
+	next := make(chan int64)
+	done := make(chan struct{})
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	for i := int64(0); i < connections; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range next {
+				if err := md.downloadChunk(chunk); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						close(done)
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}()
+	}
+	func() {
+		defer close(next)
+		for chunk := int64(0); chunk < chunks; chunk++ {
+			select {
+			case next <- chunk:
+			case <-done:
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	return firstErr
+}
+
+// downloadChunk downloads the given chunk, retrying if the connection fails
+func (md *multipartDownload) downloadChunk(chunk int64) error {
+	start := chunk * downloadChunkSize
+	end := start + downloadChunkSize - 1
+	if end >= md.size {
+		end = md.size - 1
+	}
+	contentRange := fmt.Sprintf("bytes %v-%v/%v", start, end, md.size)
+	retryFunc := func() (resp *http.Response, tempError error, permError error) {
+		req, err := http.NewRequest("GET", md.url, nil)
+		if err != nil {
+			// permanent error!
+			return nil, nil, err
+		}
+		for header, values := range md.precondition {
+			req.Header[header] = values
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%v-%v", start, end))
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err = http.DefaultClient.Do(req)
+		clockSkew.observe(resp)
+		if err != nil {
+			md.task.Warnf("[mounts] Download of %v of %v failed on this attempt: %v", contentRange, md.contentSource, err)
+			// temporary error!
+			return resp, err, nil
+		}
+		if resp.StatusCode == http.StatusPreconditionFailed {
+			resp.Body.Close()
+			// permanent error!
+			return resp, nil, fmt.Errorf("%v changed during download", md.contentSource)
+		}
+		if resp.StatusCode/100 != 2 {
+			// httpbackoff reads the response body, and decides whether to
+			// retry
+			return resp, nil, nil
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Range") != contentRange {
+			// permanent error!
+			return resp, nil, fmt.Errorf("server responded to request for %v of %v with %v and content range %q", contentRange, md.contentSource, resp.Status, resp.Header.Get("Content-Range"))
+		}
+		written, err := io.Copy(&offsetWriter{file: md.file, offset: start}, md.task.downloadReader(resp.Body))
+		if err == nil && written != end-start+1 {
+			err = fmt.Errorf("received %v bytes but expected %v", written, end-start+1)
+		}
+		if err != nil {
+			md.task.Warnf("[mounts] Could not write %v of %v to file %v on this attempt: %v", contentRange, md.contentSource, md.file.Name(), err)
+			// likely a temporary error - network blip
+			return resp, err, nil
+		}
+		return resp, nil, nil
+	}
+	resp, _, err := httpbackoff.Retry(retryFunc)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+// offsetWriter writes to file from the given offset, so that chunks can be
+// written to the same file concurrently
+type offsetWriter struct {
+	file   *os.File
+	offset int64
+}
+
+func (ow *offsetWriter) Write(p []byte) (int, error) {
+	n, err := ow.file.WriteAt(p, ow.offset)
+	ow.offset += int64(n)
+	return n, err
+}
+
+// parseContentRange parses a Content-Range header such as "bytes 0-0/1234",
+// returning false if the header is invalid or the complete size is unknown
+func parseContentRange(header string) (start, end, size int64, ok bool) {
+	if !strings.HasPrefix(header, "bytes ") {
+		return 0, 0, 0, false
+	}
+	parts := strings.SplitN(header[len("bytes "):], "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, 0, false
+	}
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, 0, false
+	}
+	var err1, err2, err3 error
+	start, err1 = strconv.ParseInt(bounds[0], 10, 64)
+	end, err2 = strconv.ParseInt(bounds[1], 10, 64)
+	size, err3 = strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start > end || end >= size {
+		return 0, 0, 0, false
+	}
+	return start, end, size, true
+}
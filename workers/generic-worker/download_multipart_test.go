@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestMultipartDownload(t *testing.T) {
+	defer func(size int64) {
+		downloadChunkSize = size
+	}(downloadChunkSize)
+	downloadChunkSize = 1000
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	config.DownloadConnections = 3
+	content := make([]byte, 10500)
+	rand.New(rand.NewSource(1)).Read(content)
+	modTime := time.Now()
+	var mu sync.Mutex
+	ranges := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges[r.Header.Get("Range")]++
+		failFirstAttempt := r.Header.Get("Range") == "bytes=5000-5999" && ranges["bytes=5000-5999"] == 1
+		mu.Unlock()
+		if failFirstAttempt {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"abc"`)
+		http.ServeContent(w, r, "content", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "download")
+	task := &TaskRun{
+		logWriter: &bytes.Buffer{},
+	}
+	sha256, err := downloadURLToFile(server.URL, "test content", file, task)
+	if err != nil {
+		t.Fatalf("%v\n%v", err, task.logWriter)
+	}
+	// probe, 11 chunks, and the retry of the chunk that failed
+	requests := 0
+	for _, n := range ranges {
+		requests += n
+	}
+	if requests != 13 || ranges["bytes=0-0"] != 1 || ranges["bytes=10000-10499"] != 1 || ranges["bytes=5000-5999"] != 2 {
+		t.Errorf("Was expecting content to be downloaded in 11 chunks, but got ranges %v:\n%v", ranges, task.logWriter)
+	}
+	downloaded, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Fatalf("Downloaded content (%v bytes) does not match served content (%v bytes)", len(downloaded), len(content))
+	}
+	if expected, _ := fileutil.CalculateSHA256(file); sha256 != expected {
+		t.Fatalf("Was expecting SHA256 %v of whole file, but got %v", expected, sha256)
+	}
+	if !strings.Contains(task.logWriter.(*bytes.Buffer).String(), "with 3 connections") {
+		t.Fatalf("Was expecting download with 3 connections to be logged, but got:\n%v", task.logWriter)
+	}
+}
+
+func TestMultipartDownloadFallsBackToSingleRequest(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	config.DownloadConnections = 4
+	config.MultipartDownloadMinMB = 1
+	for name, handler := range map[string]http.HandlerFunc{
+		// content smaller than multipartDownloadMinMB
+		"small": func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			http.ServeContent(w, r, "content", time.Now(), strings.NewReader("hello"))
+		},
+		// server without range support
+		"no ranges": func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("hello"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			dir, err := ioutil.TempDir("", "multipart-download")
+			if err != nil {
+				t.Fatalf("%v", err)
+			}
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "download")
+			task := &TaskRun{
+				logWriter: &bytes.Buffer{},
+			}
+			multipart, _, _, err := multipartDownloadURLToFile(server.URL, "test content", file, task)
+			if multipart || err != nil {
+				t.Fatalf("Was expecting content not to be downloaded in parts, but got multipart=%v, error %v", multipart, err)
+			}
+			if _, err := os.Stat(file); !os.IsNotExist(err) {
+				t.Fatalf("Was not expecting file to be written, but got %v", err)
+			}
+		})
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	if start, end, size, ok := parseContentRange("bytes 0-0/1234"); !ok || start != 0 || end != 0 || size != 1234 {
+		t.Errorf("Could not parse content range: %v %v %v %v", start, end, size, ok)
+	}
+	for _, header := range []string{"", "bytes 0-0/*", "bytes */1234", "bytes 5-4/10", "bytes 0-10/10", "items 0-0/1"} {
+		if _, _, _, ok := parseContentRange(header); ok {
+			t.Errorf("Was expecting content range %q to be invalid", header)
+		}
+	}
+}
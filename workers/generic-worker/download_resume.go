@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// size of the chunks of a download that are hashed as they are written, so
+// that an interrupted download can resume from the end of the last chunk that
+// is verified to be intact on disk
+var downloadChunkSize int64 = 64 * 1024 * 1024
+
+// downloadProgress records the SHA256 of each complete chunk of a download
+// that has been written to file, and the validator of the response that the
+// chunks came from, which is needed to resume the download with an HTTP range
+// request
+type downloadProgress struct {
+	chunkHashes [][]byte
+	current     hash.Hash
+	currentSize int64
+	// strong ETag or Last-Modified of the response, or "" if the server
+	// doesn't support range requests, in which case downloads can't be
+	// resumed
+	validator string
+}
+
+func newDownloadProgress() *downloadProgress {
+	return &downloadProgress{
+		current: sha256.New(),
+	}
+}
+
+// Write hashes p, which has been written to file after the data written
+// before it
+func (dp *downloadProgress) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk := p
+		if remaining := downloadChunkSize - dp.currentSize; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		_, _ = dp.current.Write(chunk)
+		dp.currentSize += int64(len(chunk))
+		p = p[len(chunk):]
+		if dp.currentSize == downloadChunkSize {
+			dp.chunkHashes = append(dp.chunkHashes, dp.current.Sum(nil))
+			dp.current.Reset()
+			dp.currentSize = 0
+		}
+	}
+	return n, nil
+}
+
+// start records the response that the download is being written from. If the
+// response isn't the continuation of the same content (206 Partial Content,
+// from the requested offset, with the same validator), the progress is reset,
+// and false is returned, in which case the download must restart from the
+// beginning of the file.
+func (dp *downloadProgress) start(resp *http.Response, offset int64) bool {
+	validator := resp.Header.Get("ETag")
+	if strings.HasPrefix(validator, "W/") {
+		// If-Range requires a strong validator
+		validator = ""
+	}
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" && resp.StatusCode != http.StatusPartialContent {
+		validator = ""
+	}
+	resumed := offset > 0 &&
+		resp.StatusCode == http.StatusPartialContent &&
+		strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %v-", offset)) &&
+		(validator == "" || validator == dp.validator)
+	if !resumed {
+		dp.chunkHashes = nil
+	}
+	dp.current.Reset()
+	dp.currentSize = 0
+	if validator != "" || !resumed {
+		dp.validator = validator
+	}
+	return resumed
+}
+
+// resumeOffset verifies the chunks of file that have been recorded against
+// their SHA256, and returns the offset after the last chunk that is intact,
+// from where the download can resume. It returns 0 if the download can't be
+// resumed.
+func (dp *downloadProgress) resumeOffset(file string) int64 {
+	if dp.validator == "" || len(dp.chunkHashes) == 0 {
+		return 0
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		dp.chunkHashes = nil
+		return 0
+	}
+	defer f.Close()
+	verified := 0
+	for _, expected := range dp.chunkHashes {
+		h := sha256.New()
+		n, err := io.CopyN(h, f, downloadChunkSize)
+		if err != nil || n != downloadChunkSize || !bytes.Equal(h.Sum(nil), expected) {
+			break
+		}
+		verified++
+	}
+	dp.chunkHashes = dp.chunkHashes[:verified]
+	return int64(verified) * downloadChunkSize
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestResumeInterruptedDownload(t *testing.T) {
+	// single connection downloads
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	defer func(size int64) {
+		downloadChunkSize = size
+	}(downloadChunkSize)
+	downloadChunkSize = 1024
+	content := make([]byte, 10000)
+	rand.New(rand.NewSource(1)).Read(content)
+	modTime := time.Now()
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"abc"`)
+		if len(ranges) == 1 {
+			// drop the connection part way through the first response
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+			_, _ = w.Write(content[:5000])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		http.ServeContent(w, r, "content", modTime, bytes.NewReader(content))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "download")
+	task := &TaskRun{
+		logWriter: &bytes.Buffer{},
+	}
+	_, err = downloadURLToFile(server.URL, "test content", file, task)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=4096-" {
+		t.Errorf("Was expecting download to resume from the end of the last complete chunk, but got ranges %q:\n%v", ranges, task.logWriter)
+	}
+	downloaded, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if !bytes.Equal(downloaded, content) {
+		t.Errorf("Downloaded content (%v bytes) does not match served content (%v bytes)", len(downloaded), len(content))
+	}
+}
+
+func TestDownloadResumeOffsetVerifiesChunks(t *testing.T) {
+	defer func(size int64) {
+		downloadChunkSize = size
+	}(downloadChunkSize)
+	downloadChunkSize = 4
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "download")
+	progress := newDownloadProgress()
+	progress.validator = `"abc"`
+	_, _ = progress.Write([]byte("abcdefghijk"))
+	if len(progress.chunkHashes) != 2 {
+		t.Fatalf("Was expecting 2 complete chunks, but got %v", len(progress.chunkHashes))
+	}
+	// second chunk corrupted on disk
+	err = ioutil.WriteFile(file, []byte("abcdXfghijk"), 0600)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if offset := progress.resumeOffset(file); offset != 4 {
+		t.Errorf("Was expecting download to resume from byte 4, but got %v", offset)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/tent/hawk-go"
+)
+
+var (
+	// faults that config setting faultInjection injects, or nil
+	injectedFaults *gwconfig.FaultInjection
+	// upload throttle of config setting faultInjection.uploadBytesPerSec, or nil
+	injectedUploadThrottle *Throttle
+	// overridden in tests
+	injectedFaultRandom = rand.Float64
+)
+
+// configureFaultInjection injects the faults of config setting
+// faultInjection, if set; see gwconfig.FaultInjection. It must be called
+// after c.HTTPRetry has been set, since it wraps it.
+func configureFaultInjection(c *gwconfig.Config) {
+	injectedFaults = c.FaultInjection
+	if injectedFaults == nil {
+		return
+	}
+	log.Printf("WARNING: Injecting faults (config setting faultInjection): %#v - this worker must not be used in production!", *injectedFaults)
+	if injectedFaults.APIErrorRate > 0 {
+		c.HTTPRetry = injectAPIErrors(c.HTTPRetry, injectedFaults.APIErrorRate)
+	}
+	injectedUploadThrottle = NewThrottle(int64(injectedFaults.UploadBytesPerSec))
+	if injectedFaults.ClockSkewSecs != 0 {
+		skew := time.Duration(injectedFaults.ClockSkewSecs) * time.Second
+		hawk.Now = func() time.Time {
+			return time.Now().Add(skew)
+		}
+	}
+}
+
+// injectAPIErrors returns an HTTPRetry function (see gwconfig.Config) that
+// makes http calls with the given HTTPRetry function, or httpbackoff if nil,
+// except that each attempt fails with HTTP 500 with the given probability
+func injectAPIErrors(retry func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error), rate float64) func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+	if retry == nil {
+		retry = httpbackoff.Retry
+	}
+	return func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+		return retry(func() (*http.Response, error, error) {
+			if injectedFaultRandom() >= rate {
+				return httpCall()
+			}
+			log.Print("Injecting HTTP 500 response to Taskcluster API call (config setting faultInjection.apiErrorRate)")
+			return &http.Response{
+				Status:     "500 Internal Server Error",
+				StatusCode: http.StatusInternalServerError,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(strings.NewReader(`{"code": "InternalServerError", "message": "Fault injected by config setting faultInjection.apiErrorRate"}`)),
+			}, nil, nil
+		})
+	}
+}
+
+// injectedDiskFull returns whether disks should be reported to have no free
+// space (config setting faultInjection.diskFull)
+func injectedDiskFull() bool {
+	if injectedFaults == nil || !injectedFaults.DiskFull {
+		return false
+	}
+	log.Print("Reporting no free disk space (config setting faultInjection.diskFull)")
+	return true
+}
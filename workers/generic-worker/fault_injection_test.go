@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/tent/hawk-go"
+)
+
+func TestInjectAPIErrors(t *testing.T) {
+	defer func(random func() float64) {
+		injectedFaultRandom = random
+	}(injectedFaultRandom)
+	// first attempt fails, second succeeds
+	randoms := []float64{0.1, 0.9}
+	injectedFaultRandom = func() float64 {
+		r := randoms[0]
+		randoms = randoms[1:]
+		return r
+	}
+	calls := 0
+	httpCall := func() (*http.Response, error, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusOK}, nil, nil
+	}
+	statusCodes := []int{}
+	retry := injectAPIErrors(func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) {
+		for attempts := 1; ; attempts++ {
+			resp, _, _ := httpCall()
+			statusCodes = append(statusCodes, resp.StatusCode)
+			if resp.StatusCode == http.StatusOK {
+				return resp, attempts, nil
+			}
+		}
+	}, 0.5)
+	_, attempts, err := retry(httpCall)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if attempts != 2 || calls != 1 {
+		t.Fatalf("Expected 2 attempts and 1 http call, but got %v attempts and %v http calls", attempts, calls)
+	}
+	if statusCodes[0] != http.StatusInternalServerError {
+		t.Fatalf("Expected injected HTTP 500 response, but got %v", statusCodes)
+	}
+}
+
+func TestConfigureFaultInjection(t *testing.T) {
+	defer func(now func() time.Time) {
+		hawk.Now = now
+		injectedFaults = nil
+		injectedUploadThrottle = nil
+	}(hawk.Now)
+	c := &gwconfig.Config{}
+	configureFaultInjection(c)
+	if injectedDiskFull() || injectedUploadThrottle != nil || c.HTTPRetry != nil {
+		t.Fatal("Expected no faults to be injected without config setting faultInjection")
+	}
+	c.FaultInjection = &gwconfig.FaultInjection{
+		UploadBytesPerSec: 1024,
+		DiskFull:          true,
+		ClockSkewSecs:     -3600,
+	}
+	configureFaultInjection(c)
+	if !injectedDiskFull() || injectedUploadThrottle == nil {
+		t.Fatal("Expected disk full and upload throttle faults to be injected")
+	}
+	if free, err := freeDiskSpaceBytes(""); err != nil || free != 0 {
+		t.Fatalf("Expected no free disk space, but got %v (%v)", free, err)
+	}
+	if skew := time.Until(hawk.Now()); skew > -59*time.Minute || skew < -61*time.Minute {
+		t.Fatalf("Expected hawk clock to be an hour behind, but it is %v ahead", skew)
+	}
+}
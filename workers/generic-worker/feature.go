@@ -11,10 +11,37 @@ type (
 		Name() string
 	}
 
+	// PayloadFeature is a Feature that exposes an optional capability which
+	// tasks request in their payload. A PayloadFeature is only available to
+	// tasks if it is listed in worker config setting enabledFeatures. Features
+	// that don't implement PayloadFeature are available to all tasks.
+	PayloadFeature interface {
+		Feature
+		// PayloadName is the name of the feature in worker config setting
+		// enabledFeatures, which matches the name of the task payload property
+		// that requests it, e.g. "chainOfTrust"
+		PayloadName() string
+		// ScopePattern is the scope that a task requires in order to use the
+		// feature, e.g.
+		// "generic-worker:allow-rdp:<provisionerId>/<workerType>", or "" if
+		// no scopes are required
+		ScopePattern() scopes.Pattern
+	}
+
 	TaskFeature interface {
-		RequiredScopes() scopes.Required
+		// RequiredScopes returns the scopes the task needs in order to use
+		// the feature. If the task does not have them, the task is resolved
+		// as malformed-payload, naming the missing scopes.
+		RequiredScopes() scopes.Expression
 		ReservedArtifacts() []string
 		Start() *CommandExecutionError
 		Stop(err *ExecutionErrors)
 	}
 )
+
+// workerScope returns the scope with the given pattern, substituting the
+// <provisionerId> and <workerType> parameters of the pattern with those of the
+// worker, together with any further parameters given as name/value pairs
+func workerScope(pattern scopes.Pattern, nameValuePairs ...string) scopes.Scope {
+	return pattern.Scope(append([]string{"provisionerId", config.ProvisionerID, "workerType", config.WorkerType}, nameValuePairs...)...)
+}
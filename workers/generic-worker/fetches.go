@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+var (
+	// service to call to resolve fetches that reference an index namespace
+	// rather than a taskId. See
+	// https://docs.taskcluster.net/reference/core/index
+	index *tcindex.Index
+	// maximum number of fetches to download at the same time
+	maxConcurrentFetches = 4
+
+	resolvedFetchesPath = filepath.Join("generic-worker", "resolved-fetches.json")
+	resolvedFetchesName = "public/resolved-fetches.json"
+)
+
+// ResolvedFetch records the task that an index namespace in
+// task.payload.fetches resolved to, so that the task remains auditable after
+// the index namespace has been updated to point to a different task.
+type ResolvedFetch struct {
+	Namespace string          `json:"namespace"`
+	TaskID    string          `json:"taskId"`
+	Rank      float64         `json:"rank"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Artifact  string          `json:"artifact"`
+	SHA256    string          `json:"sha256"`
+}
+
+// Represents the Fetches feature as a whole - one global instance
+type FetchesFeature struct {
+}
+
+func (feature *FetchesFeature) Name() string {
+	return "Fetches"
+}
+
+// Downloaded artifacts are stored in the file caches managed by the Mounts
+// feature, so there is no state of our own to load or persist.
+func (feature *FetchesFeature) Initialise() error {
+	index = config.Index()
+	return nil
+}
+
+func (feature *FetchesFeature) PersistState() error {
+	return nil
+}
+
+// Fetches are protected by scopes per artifact, so having fetches in the
+// payload is enough to enable the feature.
+func (feature *FetchesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Fetches) > 0
+}
+
+// Represents the Fetches feature for an individual task (one per task)
+type TaskFetches struct {
+	task *TaskRun
+	// payload errors are detected when creating feature but only reported when
+	// feature starts, so need to keep hold of any error raised...
+	payloadError   error
+	requiredScopes scopes.AllOf
+	// whether any fetches reference an index namespace
+	usesIndex bool
+	// one entry per fetch in the task payload, populated when the feature
+	// starts, once index namespaces have been resolved
+	resolved []*ArtifactContent
+}
+
+func (feature *FetchesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	tf := &TaskFetches{
+		task: task,
+	}
+	taskDependencies := map[string]bool{}
+	for _, taskID := range task.Definition.Dependencies {
+		taskDependencies[taskID] = true
+	}
+	requiredScopes := scopes.AllOf{}
+	for i, fetch := range task.Payload.Fetches {
+		switch {
+		case fetch.TaskID == "" && fetch.Namespace == "":
+			tf.payloadError = fmt.Errorf("[fetches] Fetch %v (artifact %v) must specify one of taskId or namespace", i, fetch.Artifact)
+			return tf
+		case fetch.TaskID != "" && fetch.Namespace != "":
+			tf.payloadError = fmt.Errorf("[fetches] Fetch %v (artifact %v) cannot specify both taskId %v and namespace %v", i, fetch.Artifact, fetch.TaskID, fetch.Namespace)
+			return tf
+		case fetch.TaskID != "" && !taskDependencies[fetch.TaskID]:
+			tf.payloadError = fmt.Errorf("[fetches] task.dependencies needs to include %v since one or more of its artifacts are fetched", fetch.TaskID)
+			return tf
+		}
+		if fetch.Namespace != "" {
+			tf.usesIndex = true
+		}
+		ac := &ArtifactContent{
+			Artifact: fetch.Artifact,
+		}
+		requiredScopes = append(requiredScopes, ac.RequiredScopes())
+	}
+	tf.requiredScopes = requiredScopes
+	return tf
+}
+
+func (tf *TaskFetches) RequiredScopes() scopes.Expression {
+	return tf.requiredScopes
+}
+
+func (tf *TaskFetches) ReservedArtifacts() []string {
+	if tf.usesIndex {
+		return []string{
+			resolvedFetchesName,
+		}
+	}
+	return []string{}
+}
+
+func (tf *TaskFetches) Start() *CommandExecutionError {
+	if tf.payloadError != nil {
+		return MalformedPayloadError(tf.payloadError)
+	}
+	err := tf.resolve()
+	if err != nil {
+		return Failure(err)
+	}
+	err = tf.download()
+	if err != nil {
+		return Failure(err)
+	}
+	for i, fetch := range tf.task.Payload.Fetches {
+		err = tf.place(fetch, tf.resolved[i])
+		if err != nil {
+			return Failure(fmt.Errorf("[fetches] %s", err))
+		}
+	}
+	if tf.usesIndex {
+		return tf.uploadResolvedFetches()
+	}
+	return nil
+}
+
+func (tf *TaskFetches) Stop(err *ExecutionErrors) {
+}
+
+// resolve determines the concrete artifact content for each fetch, looking
+// up the taskId in the index for fetches that reference a namespace
+func (tf *TaskFetches) resolve() error {
+	tf.resolved = make([]*ArtifactContent, len(tf.task.Payload.Fetches))
+	for i, fetch := range tf.task.Payload.Fetches {
+		taskID := fetch.TaskID
+		if fetch.Namespace != "" {
+			indexedTask, err := index.FindTask(fetch.Namespace)
+			if err != nil {
+				return fmt.Errorf("[fetches] Could not find task in index namespace %v: %v", fetch.Namespace, err)
+			}
+			taskID = indexedTask.TaskID
+			tf.task.Infof("[fetches] Index namespace %v resolved to task %v (rank %v)", fetch.Namespace, taskID, indexedTask.Rank)
+			tf.task.resolvedFetches = append(tf.task.resolvedFetches, ResolvedFetch{
+				Namespace: fetch.Namespace,
+				TaskID:    taskID,
+				Rank:      indexedTask.Rank,
+				Data:      indexedTask.Data,
+				Artifact:  fetch.Artifact,
+			})
+		}
+		tf.resolved[i] = &ArtifactContent{
+			Artifact: fetch.Artifact,
+			Sha256:   fetch.Sha256,
+			TaskID:   taskID,
+		}
+	}
+	return nil
+}
+
+// download fetches all artifacts that are not already in the file caches, in
+// parallel. Downloaded files are added to the file caches, and validated
+// against any required SHA256 when they are placed in the task directory.
+func (tf *TaskFetches) download() error {
+	type result struct {
+		content *ArtifactContent
+		file    string
+		sha256  string
+		err     error
+	}
+	pending := map[string]*ArtifactContent{}
+	for _, ac := range tf.resolved {
+		if _, inCache := fileCaches[ac.UniqueKey()]; !inCache {
+			pending[ac.UniqueKey()] = ac
+		}
+	}
+	results := make(chan *result, len(pending))
+	sem := make(chan struct{}, maxConcurrentFetches)
+	var wg sync.WaitGroup
+	for _, ac := range pending {
+		wg.Add(1)
+		go func(ac *ArtifactContent) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r := &result{content: ac}
+			r.file, r.sha256, r.err = ac.Download(tf.task)
+			results <- r
+		}(ac)
+	}
+	wg.Wait()
+	close(results)
+	var err error
+	for r := range results {
+		if r.err != nil {
+			tf.task.Errorf("[fetches] Could not download %v: %v", r.content, r.err)
+			err = fmt.Errorf("[fetches] Could not download %v: %v", r.content, r.err)
+			continue
+		}
+		cacheKey := r.content.UniqueKey()
+		fileCaches[cacheKey] = &Cache{
+			Location: r.file,
+			Created:  time.Now(),
+			Owner:    fileCaches,
+			Key:      cacheKey,
+			SHA256:   r.sha256,
+		}
+	}
+	return err
+}
+
+// place copies (or extracts, if a format is given) the fetched content into
+// the task directory, by mounting it just like the Mounts feature would
+func (tf *TaskFetches) place(fetch Fetch, ac *ArtifactContent) error {
+	content, err := json.Marshal(ac)
+	if err != nil {
+		panic(fmt.Sprintf("Internal worker bug! Cannot marshal %#v to json: %v", ac, err))
+	}
+	var m MountEntry
+	if fetch.Format == "" {
+		m = &FileMount{
+			File:    fetch.Path,
+			Content: json.RawMessage(content),
+		}
+	} else {
+		m = &ReadOnlyDirectory{
+			Directory: fetch.Path,
+			Content:   json.RawMessage(content),
+			Format:    fetch.Format,
+		}
+	}
+	return m.Mount(tf.task)
+}
+
+// uploadResolvedFetches publishes the tasks that index namespaces resolved to,
+// together with the SHA256 of the content that was fetched from them
+func (tf *TaskFetches) uploadResolvedFetches() *CommandExecutionError {
+	for i := range tf.task.resolvedFetches {
+		rf := &tf.task.resolvedFetches[i]
+		ac := &ArtifactContent{
+			Artifact: rf.Artifact,
+			TaskID:   rf.TaskID,
+		}
+		if cache, inCache := fileCaches[ac.UniqueKey()]; inCache {
+			rf.SHA256 = cache.SHA256
+		}
+	}
+	resolvedFetchesFile := filepath.Join(taskContext.TaskDir, resolvedFetchesPath)
+	err := fileutil.WriteToFileAsJSON(tf.task.resolvedFetches, resolvedFetchesFile)
+	// if we can't write this, something seriously wrong, so cause worker to
+	// report an internal-error to sentry and crash!
+	if err != nil {
+		panic(err)
+	}
+	return tf.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    resolvedFetchesName,
+				Expires: tf.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            resolvedFetchesPath,
+		},
+	)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/slugid-go/slugid"
+)
+
+func TestFetchArtifactByTaskID(t *testing.T) {
+	defer setup(t)()
+	taskID := CreateArtifactFromFile(t, "SampleArtifacts/_/X.txt", "SampleArtifacts/_/X.txt")
+
+	payload := GenericWorkerPayload{
+		Fetches: []Fetch{
+			{
+				TaskID:   taskID,
+				Artifact: "SampleArtifacts/_/X.txt",
+				Path:     filepath.Join("fetched", "X.txt"),
+			},
+		},
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+
+	td := testTask(t)
+	td.Dependencies = []string{
+		taskID,
+	}
+	td.Scopes = []string{"queue:get-artifact:SampleArtifacts/_/X.txt"}
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	expected, err := ioutil.ReadFile(filepath.Join(testdataDir, "SampleArtifacts", "_", "X.txt"))
+	if err != nil {
+		t.Fatalf("Could not read test data file: %v", err)
+	}
+	actual, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, "fetched", "X.txt"))
+	if err != nil {
+		t.Fatalf("Could not read fetched file: %v", err)
+	}
+	if string(actual) != string(expected) {
+		t.Fatalf("Fetched file content %q does not match expected content %q", string(actual), string(expected))
+	}
+}
+
+// TestMissingFetchesDependency tests that if an artifact is fetched by
+// taskId, the task must be included as a task dependency
+func TestMissingFetchesDependency(t *testing.T) {
+	defer setup(t)()
+	pretendTaskID := slugid.Nice()
+
+	payload := GenericWorkerPayload{
+		Fetches: []Fetch{
+			{
+				TaskID:   pretendTaskID,
+				Artifact: "public/build/X.txt",
+				Path:     "X.txt",
+			},
+		},
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	logtext := string(bytes)
+	if !strings.Contains(logtext, "[fetches] task.dependencies needs to include "+pretendTaskID+" since one or more of its artifacts are fetched") {
+		t.Fatalf("Was expecting log file to explain that task dependency was missing, but it doesn't: \n%v", logtext)
+	}
+}
+
+func TestFetchWithTaskIDAndNamespace(t *testing.T) {
+	defer setup(t)()
+	pretendTaskID := slugid.Nice()
+
+	payload := GenericWorkerPayload{
+		Fetches: []Fetch{
+			{
+				TaskID:    pretendTaskID,
+				Namespace: "project.example.latest",
+				Artifact:  "public/build/X.txt",
+				Path:      "X.txt",
+			},
+		},
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+
+	td := testTask(t)
+	td.Dependencies = []string{
+		pretendTaskID,
+	}
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestFetchFromMissingIndexNamespace(t *testing.T) {
+	defer setup(t)()
+	namespace := "garbage.generic-worker.fetches." + slugid.Nice()
+
+	payload := GenericWorkerPayload{
+		Fetches: []Fetch{
+			{
+				Namespace: namespace,
+				Artifact:  "public/build/X.txt",
+				Path:      "X.txt",
+			},
+		},
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	logtext := string(bytes)
+	if !strings.Contains(logtext, "[fetches] Could not find task in index namespace "+namespace) {
+		t.Fatalf("Was expecting log file to explain that index namespace could not be resolved, but it doesn't: \n%v", logtext)
+	}
+}
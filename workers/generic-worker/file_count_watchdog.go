@@ -0,0 +1,197 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// number of directories with the most files that are listed when a task
+// exceeds its file count limit
+const fileCountDiagnosticDirs = 10
+
+var errFileCountExceeded = errors.New("file count limit exceeded")
+
+type (
+	// FileCountWatchdogFeature fails tasks that create more files (including
+	// directories and links) under the task directory, which includes mounted
+	// caches, than config setting fileCountWatchdogMaxTaskFiles allows, since
+	// some filers fall over when tasks create millions of tiny files
+	FileCountWatchdogFeature struct {
+	}
+
+	FileCountWatchdogTask struct {
+		task *TaskRun
+		// closed by Stop
+		stop chan struct{}
+		done chan struct{}
+		// set by the watchdog goroutine if it aborted the task
+		aborted bool
+	}
+
+	// fileCount is the result of counting the files under a directory
+	fileCount struct {
+		// total number of files counted, which is one more than the limit if
+		// the limit was exceeded, since counting stops there
+		Total uint
+		// number of files directly inside each directory, relative to the
+		// counted directory
+		PerDir map[string]uint
+	}
+)
+
+func (feature *FileCountWatchdogFeature) Name() string {
+	return "File Count Watchdog"
+}
+
+func (feature *FileCountWatchdogFeature) Initialise() error {
+	if config.FileCountWatchdogMaxTaskFiles != 0 && config.FileCountWatchdogIntervalSecs == 0 {
+		return fmt.Errorf("config setting fileCountWatchdogIntervalSecs must be non-zero when config setting fileCountWatchdogMaxTaskFiles is set")
+	}
+	return nil
+}
+
+func (feature *FileCountWatchdogFeature) PersistState() error {
+	return nil
+}
+
+func (feature *FileCountWatchdogFeature) IsEnabled(task *TaskRun) bool {
+	return config.FileCountWatchdogMaxTaskFiles != 0
+}
+
+func (feature *FileCountWatchdogFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &FileCountWatchdogTask{
+		task: task,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (fcw *FileCountWatchdogTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (fcw *FileCountWatchdogTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (fcw *FileCountWatchdogTask) Start() *CommandExecutionError {
+	go func() {
+		defer close(fcw.done)
+		ticker := time.NewTicker(time.Duration(config.FileCountWatchdogIntervalSecs) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-fcw.stop:
+				return
+			case <-ticker.C:
+				if _, reason := fcw.check(); reason != "" {
+					fcw.aborted = true
+					err := fcw.task.StatusManager.Abort(Failure(fmt.Errorf("Task aborted - %v", reason)))
+					if err != nil {
+						fcw.task.Warnf("[file count watchdog] Error when aborting task: %v", err)
+					}
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop counts the files once more, so that tasks that create too many files
+// between two checks, or just before they finish, also fail
+func (fcw *FileCountWatchdogTask) Stop(err *ExecutionErrors) {
+	close(fcw.stop)
+	<-fcw.done
+	if fcw.aborted {
+		return
+	}
+	total, reason := fcw.check()
+	if reason != "" {
+		err.add(Failure(fmt.Errorf("[file count watchdog] Task failed - %v", reason)))
+		return
+	}
+	fcw.task.Infof("[file count watchdog] Task directory contains %v files", total)
+}
+
+// check counts the files under the task directory, and if there are too many,
+// writes a diagnostic to the task log and returns the reason to fail the task
+func (fcw *FileCountWatchdogTask) check() (total uint, reason string) {
+	count, err := countFiles(taskContext.TaskDir, config.FileCountWatchdogMaxTaskFiles)
+	if err != nil {
+		fcw.task.Warnf("[file count watchdog] Could not count files in task directory: %v", err)
+		return 0, ""
+	}
+	if count.Total <= config.FileCountWatchdogMaxTaskFiles {
+		return count.Total, ""
+	}
+	reason = fmt.Sprintf("task directory contains more than %v files (config setting fileCountWatchdogMaxTaskFiles)", config.FileCountWatchdogMaxTaskFiles)
+	fcw.task.Errorf("[file count watchdog] %v. Directories with the most files:\n%v", reason, count.diagnostic(fileCountDiagnosticDirs))
+	return count.Total, reason
+}
+
+// countFiles counts the files (including directories and links) under dir,
+// stopping once more than limit have been counted
+func countFiles(dir string, limit uint) (*fileCount, error) {
+	count := &fileCount{
+		PerDir: map[string]uint{},
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// files that are deleted while counting don't count
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		parent, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		count.Total++
+		count.PerDir[parent]++
+		if count.Total > limit {
+			return errFileCountExceeded
+		}
+		return nil
+	})
+	if err != nil && err != errFileCountExceeded {
+		return nil, err
+	}
+	return count, nil
+}
+
+// diagnostic lists up to max directories with the most files directly inside
+// them, one per line
+func (count *fileCount) diagnostic(max int) string {
+	dirs := make([]string, 0, len(count.PerDir))
+	for dir := range count.PerDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if count.PerDir[dirs[i]] != count.PerDir[dirs[j]] {
+			return count.PerDir[dirs[i]] > count.PerDir[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+	if len(dirs) > max {
+		dirs = dirs[:max]
+	}
+	lines := make([]string, len(dirs))
+	for i, dir := range dirs {
+		lines[i] = fmt.Sprintf("  %v: %v files", dir, count.PerDir[dir])
+	}
+	return strings.Join(lines, "\n")
+}
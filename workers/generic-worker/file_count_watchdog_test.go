@@ -0,0 +1,52 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestCountFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file-count-watchdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i := 0; i < 5; i++ {
+		err = os.MkdirAll(filepath.Join(dir, "cache", "objects"), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "cache", "objects", strconv.Itoa(i)), []byte{}, 0644)
+		}
+		if err == nil {
+			err = ioutil.WriteFile(filepath.Join(dir, "file"+strconv.Itoa(i)), []byte{}, 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 5 files in the task directory, 5 in cache/objects, and the two
+	// directories
+	count, err := countFiles(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Total != 12 {
+		t.Fatalf("Was expecting 12 files but got %v", count.Total)
+	}
+	expected := "  .: 6 files\n  cache/objects: 5 files"
+	if diagnostic := count.diagnostic(2); diagnostic != filepath.FromSlash(expected) {
+		t.Fatalf("Was expecting diagnostic\n%v\nbut got\n%v", expected, diagnostic)
+	}
+	// counting stops once the limit is exceeded
+	count, err = countFiles(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count.Total != 4 {
+		t.Fatalf("Was expecting counting to stop after 4 files but got %v", count.Total)
+	}
+}
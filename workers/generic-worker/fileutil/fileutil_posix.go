@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
 )
@@ -55,3 +56,36 @@ func SecureFiles(filepaths ...string) (err error) {
 	}
 	return nil
 }
+
+// LongPath returns path unchanged, since only Windows limits path lengths
+// (see fileutil_windows.go).
+func LongPath(path string) string {
+	return path
+}
+
+// ValidatePath returns nil, since any relative path can be used on this
+// platform.
+func ValidatePath(path string) error {
+	return nil
+}
+
+// EnableCaseSensitivity does nothing, since the case sensitivity of
+// directories is a property of the file system on this platform.
+func EnableCaseSensitivity(dir string) error {
+	return nil
+}
+
+// markSparse does nothing, since file systems on this platform create holes
+// in any file that is seeked past the end of
+func markSparse(f *os.File) {
+}
+
+// HardLinkID returns an identifier of the file of the given info that is
+// shared by all hard links to it, if it has more than one.
+func HardLinkID(info os.FileInfo) (id string, linked bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat.Nlink < 2 || !info.Mode().IsRegular() {
+		return "", false
+	}
+	return fmt.Sprintf("%v:%v", stat.Dev, stat.Ino), true
+}
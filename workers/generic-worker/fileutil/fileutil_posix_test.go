@@ -3,8 +3,10 @@
 package fileutil
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
+	"syscall"
 	"testing"
 )
 
@@ -42,3 +44,31 @@ func TestSecureFile(t *testing.T) {
 		t.Fatalf("Was expecting file mode 0600 but got %v", stat.Mode())
 	}
 }
+
+// TestWriteSparse checks that a file written with WriteSparse has the right
+// content and size, but doesn't allocate disk space for its blocks of zeros.
+func TestWriteSparse(t *testing.T) {
+	content := make([]byte, 8<<20)
+	copy(content[3<<20:], "data")
+	f, err := ioutil.TempFile("", "TestWriteSparse")
+	if err != nil {
+		t.Fatalf("Could not create temp file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	n, err := WriteSparse(f, bytes.NewReader(content))
+	if err != nil || n != int64(len(content)) {
+		t.Fatalf("Expected to write %v bytes, but wrote %v (%v)", len(content), n, err)
+	}
+	written, err := ioutil.ReadFile(f.Name())
+	if err != nil || !bytes.Equal(written, content) {
+		t.Fatalf("Written file differs from content (%v)", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatalf("Could not stat %v: %v", f.Name(), err)
+	}
+	if allocated := info.Sys().(*syscall.Stat_t).Blocks * 512; allocated >= int64(len(content)) {
+		t.Fatalf("Expected sparse file, but %v bytes are allocated for %v bytes of content", allocated, len(content))
+	}
+}
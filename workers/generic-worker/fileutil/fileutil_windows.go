@@ -1,7 +1,17 @@
 package fileutil
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
+
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	// https://docs.microsoft.com/en-us/windows/win32/api/winioctl/ni-winioctl-fsctl_set_sparse
+	fsctlSetSparse = 0x000900c4
 )
 
 // SecureFiles modifies the discretionary access control list (DACL) of each
@@ -16,3 +26,55 @@ func SecureFiles(filepaths ...string) (err error) {
 	}
 	return
 }
+
+// LongPath returns path in extended-length form (prefixed with `\\?\`), so
+// that Windows doesn't limit it to MAX_PATH (260) characters, and treats
+// reserved device names in it, such as nul, as ordinary file names. Relative
+// paths are made absolute, since extended-length paths must be absolute.
+func LongPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	// filepath.Abs would turn a path ending in a device name into the device
+	if filepath.IsAbs(path) {
+		path = filepath.Clean(path)
+	} else {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		path = abs
+	}
+	if strings.HasPrefix(path, `\\`) {
+		return `\\?\UNC\` + path[2:]
+	}
+	return `\\?\` + path
+}
+
+// ValidatePath returns an error if the given relative path cannot be used
+// on Windows (see CheckWindowsPath).
+func ValidatePath(path string) error {
+	return CheckWindowsPath(path)
+}
+
+// EnableCaseSensitivity sets the case sensitivity flag of the given empty
+// directory, which directories created inside it inherit, so that it can
+// hold files whose names only differ in case. This requires NTFS on Windows
+// 10 version 1803 or later.
+func EnableCaseSensitivity(dir string) error {
+	return host.Run("fsutil.exe", "file", "setCaseSensitiveInfo", dir, "enable")
+}
+
+// markSparse marks f as a sparse file, since NTFS otherwise fills the regions
+// that are seeked over with zeros. It does nothing on file systems that don't
+// support sparse files.
+func markSparse(f *os.File) {
+	var bytesReturned uint32
+	_ = windows.DeviceIoControl(windows.Handle(f.Fd()), fsctlSetSparse, nil, 0, nil, 0, &bytesReturned, nil)
+}
+
+// HardLinkID returns false, since os.FileInfo doesn't identify files on
+// Windows, so hard links are treated as separate files.
+func HardLinkID(info os.FileInfo) (id string, linked bool) {
+	return "", false
+}
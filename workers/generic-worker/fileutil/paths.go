@@ -0,0 +1,40 @@
+package fileutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// reservedWindowsNames are the device names that Windows does not allow as
+// file names, with or without an extension
+var reservedWindowsNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// CheckWindowsPath returns an error if an element of the given relative path
+// cannot be used as a file name on Windows, since it is a reserved device
+// name (such as "nul" or "con.txt"), contains a character that Windows
+// doesn't allow in file names, or ends with a dot or space. Both '/' and '\'
+// are treated as path separators.
+func CheckWindowsPath(path string) error {
+	for _, name := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if name == "." || name == ".." {
+			continue
+		}
+		if i := strings.IndexFunc(name, func(r rune) bool { return r < 32 || strings.ContainsRune(`<>:"|?*`, r) }); i != -1 {
+			return fmt.Errorf("path %q contains character %q, which Windows does not allow in file names", path, name[i])
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return fmt.Errorf("file name %q of path %q ends with a dot or space, which Windows does not allow", name, path)
+		}
+		base := strings.TrimRight(strings.SplitN(name, ".", 2)[0], " ")
+		if reservedWindowsNames[strings.ToUpper(base)] {
+			return fmt.Errorf("file name %q of path %q is reserved for device %v on Windows", name, path, strings.ToUpper(base))
+		}
+	}
+	return nil
+}
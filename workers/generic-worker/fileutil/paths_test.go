@@ -0,0 +1,33 @@
+package fileutil
+
+import (
+	"testing"
+)
+
+func TestCheckWindowsPath(t *testing.T) {
+	for _, path := range []string{
+		"node_modules/a/b/c/index.js",
+		`build\output\app.exe`,
+		"../console/nulls.txt",
+		"com10",
+		".config/settings",
+	} {
+		if err := CheckWindowsPath(path); err != nil {
+			t.Errorf("Expected %q to be a valid Windows path, but got: %v", path, err)
+		}
+	}
+	for _, path := range []string{
+		"nul",
+		"src/Con.txt",
+		`logs\lpt1`,
+		"aux .log",
+		"out/file.",
+		"out/trailing /file",
+		"what?.txt",
+		"a:b",
+	} {
+		if err := CheckWindowsPath(path); err == nil {
+			t.Errorf("Expected %q to be an invalid Windows path", path)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package fileutil
+
+import (
+	"io"
+	"os"
+)
+
+// sparseBlockSize is the size of the blocks of zeros that WriteSparse skips,
+// which matches the block size of common file systems
+const sparseBlockSize = 4096
+
+// WriteSparse writes the content of r to the empty file f, seeking over
+// blocks of zeros rather than writing them, so that file systems that
+// support sparse files don't allocate disk space for them. This keeps sparse
+// files, such as virtual machine disk images, sparse when they are copied or
+// extracted. It returns the number of bytes of content written, including
+// skipped zeros.
+func WriteSparse(f *os.File, r io.Reader) (n int64, err error) {
+	markSparse(f)
+	buf := make([]byte, 64*sparseBlockSize)
+	for {
+		nr, readErr := io.ReadFull(r, buf)
+		for start := 0; start < nr; {
+			end := start
+			zero := isZero(buf[start:minInt(start+sparseBlockSize, nr)])
+			// coalesce consecutive blocks of the same kind
+			for end < nr && isZero(buf[end:minInt(end+sparseBlockSize, nr)]) == zero {
+				end = minInt(end+sparseBlockSize, nr)
+			}
+			if zero {
+				_, err = f.Seek(int64(end-start), io.SeekCurrent)
+			} else {
+				_, err = f.Write(buf[start:end])
+			}
+			if err != nil {
+				return
+			}
+			n += int64(end - start)
+			start = end
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+	// seeking doesn't extend the file, so a trailing hole needs truncating
+	return n, f.Truncate(n)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
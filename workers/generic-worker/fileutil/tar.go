@@ -0,0 +1,141 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// ExtractTar extracts the tar archive read from r into dir. Unlike most tar
+// extractors, regular and sparse files are written with WriteSparse, so that
+// they keep their holes, and hard links are recreated as hard links (or
+// copies where the file system doesn't support them), so that disk images
+// and build outputs take the same disk space as when they were archived.
+// Entries that would be written outside of dir are rejected.
+func ExtractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = ExtractTarEntry(tr, hdr, dir)
+		if err != nil {
+			return fmt.Errorf("%s: %v", hdr.Name, err)
+		}
+	}
+}
+
+// ExtractTarEntry extracts the archive entry of the given header, whose
+// content is read from r, into dir, in the same way as ExtractTar.
+func ExtractTarEntry(r io.Reader, hdr *tar.Header, dir string) error {
+	path, err := extractPath(dir, hdr.Name)
+	if err != nil {
+		return err
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(path, 0755)
+	// character/block devices and fifos are extracted as regular files
+	case tar.TypeReg, tar.TypeRegA, tar.TypeGNUSparse, tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return extractTarFile(r, path, hdr.FileInfo().Mode())
+	case tar.TypeSymlink:
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(hdr.Linkname, path)
+	case tar.TypeLink:
+		return ExtractHardLink(dir, path, hdr.Linkname)
+	case tar.TypeXGlobalHeader:
+		// ignore the pax global header of git generated tarballs
+		return nil
+	}
+	return fmt.Errorf("unknown type flag %q", hdr.Typeflag)
+}
+
+// extractPath returns the path in dir of the given archive entry name, or an
+// error if it is outside of dir
+func extractPath(dir, name string) (string, error) {
+	rel := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal file path %q in archive, since it is outside of %v", name, dir)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+func extractTarFile(r io.Reader, path string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = f.Chmod(mode.Perm())
+	if err != nil && runtime.GOOS == "windows" {
+		err = nil
+	}
+	if err == nil {
+		_, err = WriteSparse(f, r)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ExtractHardLink links path to the earlier extracted file target of a hard
+// link archive entry, which must be a regular file in dir that isn't reached
+// through a symbolic link, so that an archive cannot link to files elsewhere
+// on the worker. Where the file system doesn't support hard links, target is
+// copied instead.
+func ExtractHardLink(dir, path, target string) error {
+	targetPath, err := extractPath(dir, target)
+	if err != nil {
+		return err
+	}
+	rel, _ := filepath.Rel(dir, targetPath)
+	var info os.FileInfo
+	p := dir
+	for _, element := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, element)
+		info, err = os.Lstat(p)
+		if err != nil {
+			return fmt.Errorf("hard link target %q has not been extracted: %v", target, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("hard link target %q is reached through symbolic link %v", target, p)
+		}
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("hard link target %q is not a regular file", target)
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	// like tar, replace anything already extracted at path
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(targetPath, path) == nil {
+		return nil
+	}
+	// e.g. FAT file systems don't support hard links
+	source, err := os.Open(targetPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	return extractTarFile(source, path, info.Mode())
+}
@@ -0,0 +1,84 @@
+package fileutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExtractTar(t *testing.T) {
+	dir, err := ioutil.TempDir("", "extract-tar")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// a disk image with data at both ends, and a hole in between
+	image := make([]byte, 1<<20)
+	copy(image, "boot sector")
+	copy(image[len(image)-4:], "tail")
+
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, entry := range []struct {
+		hdr     tar.Header
+		content []byte
+	}{
+		{tar.Header{Name: "vm/", Typeflag: tar.TypeDir, Mode: 0755}, nil},
+		{tar.Header{Name: "vm/disk.img", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(image))}, image},
+		{tar.Header{Name: "vm/disk-link.img", Typeflag: tar.TypeLink, Linkname: "vm/disk.img"}, nil},
+	} {
+		hdr := entry.hdr
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("Could not write tar header %v: %v", hdr.Name, err)
+		}
+		if _, err := tw.Write(entry.content); err != nil {
+			t.Fatalf("Could not write tar entry %v: %v", hdr.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Could not write tar archive: %v", err)
+	}
+
+	err = ExtractTar(bytes.NewReader(archive.Bytes()), dir)
+	if err != nil {
+		t.Fatalf("Could not extract tar archive: %v", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "vm", "disk.img"))
+	if err != nil || !bytes.Equal(content, image) {
+		t.Fatalf("Extracted disk image differs from original (%v)", err)
+	}
+	original, err := os.Stat(filepath.Join(dir, "vm", "disk.img"))
+	if err != nil {
+		t.Fatalf("Could not stat disk image: %v", err)
+	}
+	link, err := os.Stat(filepath.Join(dir, "vm", "disk-link.img"))
+	if err != nil {
+		t.Fatalf("Could not stat hard link: %v", err)
+	}
+	if !os.SameFile(original, link) {
+		t.Fatal("Expected vm/disk-link.img to be a hard link to vm/disk.img")
+	}
+
+	escapes := []string{"../escape.txt", "/etc/passwd"}
+	// creating symbolic links requires a privilege on Windows
+	if runtime.GOOS != "windows" {
+		err = os.Symlink(os.TempDir(), filepath.Join(dir, "tmp"))
+		if err != nil {
+			t.Fatalf("Could not create symbolic link: %v", err)
+		}
+		escapes = append(escapes, "tmp/"+filepath.Base(dir)+"/vm/disk.img")
+	}
+	for _, name := range escapes {
+		var archive bytes.Buffer
+		tw := tar.NewWriter(&archive)
+		_ = tw.WriteHeader(&tar.Header{Name: "escape", Typeflag: tar.TypeLink, Linkname: name})
+		_ = tw.Close()
+		if err := ExtractTar(&archive, dir); err == nil {
+			t.Fatalf("Expected hard link to %v to be rejected", name)
+		}
+	}
+}
@@ -87,6 +87,7 @@ func (g *GCPConfigProvider) UpdateConfig(c *gwconfig.Config) error {
 	c.PrivateIP = net.ParseIP(gcpMetadata["ip"])
 	c.InstanceID = gcpMetadata["id"]
 	c.InstanceType = gcpMetadata["machine-type"]
+	c.ImageID = gcpMetadata["image"]
 
 	// See https://github.com/taskcluster/taskcluster-worker-runner/blob/6b5bbd197eed4be664171a482bf4d8d4f81a21b2/provider/google/google.go#L79-L84
 	c.AvailabilityZone = path.Base(gcpMetadata["zone"])
@@ -0,0 +1,1920 @@
+// +build kubernetes
+
+// This source code file is AUTO-GENERATED by github.com/taskcluster/jsonschema2go
+
+package main
+
+import (
+	"encoding/json"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+type (
+	Artifact struct {
+
+		// Content-Encoding for the artifact. If not provided, `gzip` will be used, except for the
+		// following file extensions, where `identity` will be used, since they are already
+		// compressed:
+		//
+		// * jpg
+		// * jpeg
+		// * png
+		// * gif
+		// * webp
+		// * 7z
+		// * zip
+		// * gz
+		// * tgz
+		// * bz2
+		// * tbz
+		// * whl
+		// * xz
+		// * swf
+		// * flv
+		// * woff
+		// * woff2
+		//
+		// Note, setting `contentEncoding` on a directory artifact will apply the same content
+		// encoding to all the files contained in the directory.
+		//
+		// Since: generic-worker 16.2.0
+		//
+		// Possible values:
+		//   * "identity"
+		//   * "gzip"
+		ContentEncoding string `json:"contentEncoding,omitempty"`
+
+		// Explicitly set the value of the HTTP `Content-Type` response header when the artifact(s)
+		// is/are served over HTTP(S). If not provided (this property is optional) the worker will
+		// guess the content type of artifacts based on the filename extension of the file storing
+		// the artifact content. It does this by looking at the system filename-to-mimetype mappings
+		// defined in multiple `mime.types` files located under `/etc`. Note, setting `contentType`
+		// on a directory artifact will apply the same contentType to all files contained in the
+		// directory.
+		//
+		// See [mime.TypeByExtension](https://godoc.org/mime#TypeByExtension).
+		//
+		// Since: generic-worker 10.4.0
+		ContentType string `json:"contentType,omitempty"`
+
+		// Date when artifact should expire must be in the future, no earlier than task deadline, but
+		// no later than task expiry. If not set, defaults to task expiry.
+		//
+		// Since: generic-worker 1.0.0
+		Expires tcclient.Time `json:"expires,omitempty"`
+
+		// Name of the artifact, as it will be published. If not set, `path` will be used.
+		// Conventionally (although not enforced) path elements are forward slash separated. Example:
+		// `public/build/a/house`. Note, no scopes are required to read artifacts beginning `public/`.
+		// Artifact names not beginning `public/` are scope-protected (caller requires scopes to
+		// download the artifact). See the Queue documentation for more information.
+		//
+		// Since: generic-worker 8.1.0
+		Name string `json:"name,omitempty"`
+
+		// Relative path of the file/directory from the task directory. Note this is not an absolute
+		// path as is typically used in docker-worker, since the absolute task directory name is not
+		// known when the task is submitted. Example: `dist\regedit.exe`. It doesn't matter if
+		// forward slashes or backslashes are used.
+		//
+		// Since: generic-worker 1.0.0
+		Path string `json:"path"`
+
+		// If `true`, the artifact is scope-protected, so its `name` (or `path`, if `name` is not
+		// set) must not begin `public/`. Downloading the artifact requires scope
+		// `queue:get-artifact:<name>` (for a `directory` artifact, `queue:get-artifact:<name>/*`),
+		// which the task must also have, so that the task can grant it to the tasks that consume
+		// the artifact. Note, on workers with config setting `forcePrivateArtifacts` enabled, all
+		// artifact names beginning `public/` are published beginning `private/` instead.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Private bool `json:"private,omitempty"`
+
+		// Artifacts can be either an individual `file` or a `directory` containing
+		// potentially multiple files with recursively included subdirectories.
+		//
+		// Since: generic-worker 1.0.0
+		//
+		// Possible values:
+		//   * "file"
+		//   * "directory"
+		Type string `json:"type"`
+	}
+
+	// Requires scope `queue:get-artifact:<artifact-name>`.
+	//
+	// Since: generic-worker 5.4.0
+	ArtifactContent struct {
+
+		// Max length: 1024
+		Artifact string `json:"artifact"`
+
+		// The required SHA 256 of the content body.
+		//
+		// Since: generic-worker 10.8.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// Syntax:     ^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$
+		TaskID string `json:"taskId"`
+	}
+
+	// Rate limits for transfers made by the worker on behalf of this task.
+	// These apply in addition to any limits configured for the worker as a
+	// whole (config settings `maxDownloadBytesPerSec` and
+	// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+	//
+	// Since: generic-worker 28.1.0
+	BandwidthLimits struct {
+
+		// Maximum number of bytes per second to download for mounts and
+		// fetches.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxDownloadBytesPerSec int64 `json:"maxDownloadBytesPerSec,omitempty"`
+
+		// Maximum number of bytes per second to upload for artifacts.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxUploadBytesPerSec int64 `json:"maxUploadBytesPerSec,omitempty"`
+	}
+
+	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
+	//
+	// Since: generic-worker 11.1.0
+	Base64Content struct {
+
+		// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
+		//
+		// Since: generic-worker 11.1.0
+		//
+		// Syntax:     ^[A-Za-z0-9/+]+[=]{0,2}$
+		// Max length: 65536
+		Base64 string `json:"base64"`
+	}
+
+	CommandRetryPolicy struct {
+
+		// The number of seconds to wait before the second attempt of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    3600
+		BackoffSeconds int64 `json:"backoffSeconds,omitempty"`
+
+		// The zero-based index of the task command that the policy applies
+		// to. Each command may have at most one policy.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		Command int64 `json:"command"`
+
+		// Exit codes that cause the command to be retried. If not
+		// specified, any failure of the command causes it to be retried.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// The maximum number of times the command is run, including the
+		// first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    2
+		// Maximum:    10
+		MaxAttempts int64 `json:"maxAttempts"`
+
+		// The maximum number of seconds to wait between attempts of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    300
+		// Mininum:    1
+		// Maximum:    3600
+		MaxBackoffSeconds int64 `json:"maxBackoffSeconds,omitempty"`
+	}
+
+	// Compute resources of the task container.
+	//
+	// Since: generic-worker 28.1.0
+	ContainerResources struct {
+
+		// Maximum compute resources that the task container may use, as
+		// Kubernetes resource quantities keyed by resource name, for example
+		// `{"memory": "8Gi"}`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Map entries:
+		Limits map[string]string `json:"limits,omitempty"`
+
+		// Compute resources that the task container requires, as Kubernetes
+		// resource quantities keyed by resource name, for example
+		// `{"cpu": "2", "memory": "4Gi"}`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Map entries:
+		Requests map[string]string `json:"requests,omitempty"`
+	}
+
+	ExceptionMapping struct {
+
+		// The exit codes that cause the task to be resolved as
+		// exception with this reason.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes"`
+
+		// The reason to resolve the task with.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "internal-error"
+		//   * "malformed-payload"
+		//   * "resource-unavailable"
+		Reason string `json:"reason"`
+	}
+
+	// By default tasks will be resolved with `state/reasonResolved`: `completed/completed`
+	// if all task commands have a zero exit code, or `failed/failed` if any command has a
+	// non-zero exit code. This payload property allows customsation of the task resolution
+	// based on exit code of task commands.
+	ExitCodeHandling struct {
+
+		// Exit codes for any command in the task payload to cause this task to
+		// be resolved as `exception`, with the given reason, for example so
+		// that a test harness that detects a problem with the worker can
+		// resolve the task as `exception/resource-unavailable`, rather than
+		// `failed/failed`. Use `retry` for `exception/intermittent-task`.
+		//
+		// Since: generic-worker 28.1.0
+		Exception []ExceptionMapping `json:"exception,omitempty"`
+
+		// Exit codes for any command in the task payload to cause this task to
+		// be resolved as `exception/intermittent-task`. Typically the Queue
+		// will then schedule a new run of the existing `taskId` (rerun) if not
+		// all task runs have been exhausted.
+		//
+		// See [itermittent tasks](https://docs.taskcluster.net/docs/reference/platform/taskcluster-queue/docs/worker-interaction#intermittent-tasks) for more detail.
+		//
+		// Since: generic-worker 10.10.0
+		//
+		// Array items:
+		// Mininum:    1
+		Retry []int64 `json:"retry,omitempty"`
+
+		// Exit codes for any command in the task payload to be treated as
+		// success (with a warning in the task log), so that subsequent task
+		// commands are run, and if they succeed, the task is resolved as
+		// `completed/completed`. Commands that exit with these exit codes
+		// are not retried by `retryPolicies`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		Success []int64 `json:"success,omitempty"`
+	}
+
+	// Feature flags enable additional functionality.
+	//
+	// Since: generic-worker 5.3.0
+	FeatureFlags struct {
+
+		// Artifacts named `public/chain-of-trust.json` and
+		// `public/chain-of-trust.json.sig` should be generated which will
+		// include information for downstream tasks to build a level of trust
+		// for the artifacts produced by the task and the environment it ran in.
+		//
+		// Since: generic-worker 5.3.0
+		ChainOfTrust bool `json:"chainOfTrust,omitempty"`
+
+		// If enabled, the template expressions in the arguments of `command`,
+		// the values of `env`, and the `path` of each of `artifacts` are
+		// expanded when the task starts (see the description of the payload).
+		// Without it, text such as `{{taskId}}` is passed to the task as is.
+		//
+		// Since: generic-worker 28.1.0
+		PayloadTemplates bool `json:"payloadTemplates,omitempty"`
+
+		// If enabled, the worker computes a hash of the task payload together
+		// with the SHA256 of all content mounted or fetched into the task
+		// directory. If an earlier task with the same hash completed
+		// successfully on this worker type, the task commands are not run, and
+		// instead the artifacts of the earlier task are re-exposed as redirect
+		// artifacts, and the task resolves as completed. Otherwise, if the task
+		// completes successfully, it is recorded in the index under namespace
+		// `generic-worker.result-cache.<provisionerId>.<workerType>.<hash>` for
+		// future tasks to reuse. The hash also covers the scopes and routes of
+		// the task. Only enable this for deterministic tasks.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:result-cache:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		ResultCache bool `json:"resultCache,omitempty"`
+
+		// The taskcluster proxy provides an easy and safe way to make authenticated
+		// taskcluster requests within the scope(s) of a particular task. See
+		// [the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.
+		//
+		// Since: generic-worker 10.6.0
+		TaskclusterProxy bool `json:"taskclusterProxy,omitempty"`
+	}
+
+	// An artifact of an upstream task to download. Exactly one of `taskId`
+	// and `namespace` must be provided.
+	//
+	// Since: generic-worker 28.1.0
+	Fetch struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// The name of the artifact to download from the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 1024
+		Artifact string `json:"artifact"`
+
+		// If provided, the artifact is treated as an archive of the given
+		// format, and is extracted into `path`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format,omitempty"`
+
+		// An index namespace (e.g. `project.example.latest.linux64`) which
+		// is resolved to a `taskId` via the index service when the task
+		// starts. The resolved `taskId` is recorded, together with the SHA256
+		// of the fetched content, in the artifact `public/resolved-fetches.json`
+		// and in the chain of trust certificate (if enabled).
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 255
+		Namespace string `json:"namespace,omitempty"`
+
+		// The location, relative to the task directory, to place the artifact.
+		// If `format` is provided, this is the directory into which the
+		// artifact is extracted, otherwise it is the file the artifact is
+		// copied to.
+		//
+		// Since: generic-worker 28.1.0
+		Path string `json:"path"`
+
+		// The required SHA 256 of the artifact content.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// The `taskId` of the task that published the artifact.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$
+		TaskID string `json:"taskId,omitempty"`
+	}
+
+	FileMount struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// One of:
+		//   * ArtifactContent
+		//   * URLContent
+		//   * RawContent
+		//   * Base64Content
+		Content json.RawMessage `json:"content"`
+
+		// The filesystem location to mount the file.
+		//
+		// Since: generic-worker 5.4.0
+		File string `json:"file"`
+	}
+
+	FileToWrite struct {
+
+		// The content of the file, base64 encoded, for binary content. At
+		// most one of `content` and `base64` may be set.
+		//
+		// Since: generic-worker 28.1.0
+		Base64 string `json:"base64,omitempty"`
+
+		// The content of the file, as UTF-8 text. At most one of `content`
+		// and `base64` may be set, and the file is empty if neither is.
+		//
+		// Since: generic-worker 28.1.0
+		Content string `json:"content,omitempty"`
+
+		// The permissions of the file, in octal, e.g. `"0755"` for an
+		// executable script. Ignored on Windows.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "0644"
+		// Syntax:     ^0?[0-7]{3}$
+		Mode string `json:"mode,omitempty"`
+
+		// The path, relative to the task directory, of the file to write.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Path string `json:"path"`
+	}
+
+	// This schema defines the structure of the `payload` property referred to in a
+	// Taskcluster Task definition.
+	//
+	// If `features.payloadTemplates` is enabled, the arguments of `command`, the
+	// values of `env`, and the `path` of each of `artifacts` may contain template
+	// expressions, which the worker expands when the task starts:
+	//
+	//   * `{{taskId}}`, `{{runId}}` and `{{taskGroupId}}` - the IDs of the task
+	//   * `{{workerGroup}}`, `{{workerId}}` and `{{workerPoolId}}` - the IDs of the
+	//     worker
+	//   * `{{cachePath "<cacheName>"}}` - the `directory` of the writable
+	//     directory cache mount with cache name `<cacheName>`
+	//   * `{{fetchPath "<artifact>"}}` - the `path` of the fetch of the artifact
+	//     with name (or base name) `<artifact>`
+	//
+	// Paths are relative to the task directory. Other text between `{{` and `}}`
+	// is left as is.
+	//
+	// Since: generic-worker 28.1.0
+	GenericWorkerPayload struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// Artifacts to be published.
+		//
+		// Since: generic-worker 1.0.0
+		Artifacts []Artifact `json:"artifacts,omitempty"`
+
+		// Rate limits for transfers made by the worker on behalf of this task.
+		// These apply in addition to any limits configured for the worker as a
+		// whole (config settings `maxDownloadBytesPerSec` and
+		// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+		//
+		// Since: generic-worker 28.1.0
+		BandwidthLimits BandwidthLimits `json:"bandwidthLimits,omitempty"`
+
+		// One array per command (each command is an array of arguments). Several arrays
+		// for several commands.
+		//
+		// Since: generic-worker 0.0.1
+		//
+		// The kubernetes engine runs each task as a single Kubernetes Job, so
+		// exactly one command is supported. Use a shell to run several steps.
+		//
+		// Array items:
+		// Array items:
+		Command [][]string `json:"command"`
+
+		// Env vars must be string to __string__ mappings (not number or boolean). For example:
+		// ```
+		// {
+		//   "PATH": "/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin",
+		//   "GOOS": "darwin",
+		//   "FOO_ENABLE": "true",
+		//   "BAR_TOTAL": "3"
+		// }
+		// ```
+		//
+		// Note, the following environment variables will automatically be set in the task
+		// commands:
+		//   * `TASK_ID` - the task ID of the currently running task
+		//   * `RUN_ID` - the run ID of the currently running task
+		//   * `TASKCLUSTER_ROOT_URL` - the root URL of the taskcluster deployment
+		//   * `TASKCLUSTER_PROXY_URL` (if taskcluster proxy feature enabled) - the
+		//      taskcluster authentication proxy for making unauthenticated taskcluster
+		//      API calls
+		//   * `TASKCLUSTER_WORKER_LOCATION` (if running in AWS or GCP or explicitly set
+		//     in the generic-worker config file). See
+		//     [RFC #0148](https://github.com/taskcluster/taskcluster-rfcs/blob/master/rfcs/0148-taskcluster-worker-location.md)
+		//     for details.
+		//
+		// Since: generic-worker 0.0.1
+		//
+		// Map entries:
+		Env map[string]string `json:"env,omitempty"`
+
+		// Feature flags enable additional functionality.
+		//
+		// Since: generic-worker 5.3.0
+		Features FeatureFlags `json:"features,omitempty"`
+
+		// Artifacts of upstream tasks to be downloaded before the task commands
+		// run. Each fetch refers to an artifact of a task, identified either
+		// directly by `taskId`, or indirectly by an index `namespace` which is
+		// resolved to a `taskId` when the task starts. Fetches are downloaded in
+		// parallel, retried on transient failures, verified against `sha256` (if
+		// provided) and cached on the worker between tasks, in the same way as
+		// file mounts.
+		//
+		// Tasks referenced by `taskId` must be listed in `task.dependencies`.
+		// Fetching a non-public artifact (i.e. not starting with `public/`)
+		// requires scope `queue:get-artifact:<artifact-name>`.
+		//
+		// Since: generic-worker 28.1.0
+		Fetches []Fetch `json:"fetches,omitempty"`
+
+		// The container image that the task command runs in, for example
+		// `ubuntu:20.04`. The image must provide `/bin/sh`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Image string `json:"image"`
+
+		// The maximum total size in megabytes of the artifacts of
+		// `task.payload.artifacts`. If the artifacts are larger, none of them
+		// are uploaded, and the task resolves as failed, listing its largest
+		// artifacts. This applies in addition to any limit configured for the
+		// worker (config setting `maxTaskArtifactsMB`), so can only lower it.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxArtifactsMB int64 `json:"maxArtifactsMB,omitempty"`
+
+		// Maximum time the task container can run in seconds.
+		//
+		// Since: generic-worker 0.0.1
+		//
+		// Mininum:    1
+		// Maximum:    86400
+		MaxRunTime int64 `json:"maxRunTime"`
+
+		// Directories and/or files to be mounted.
+		//
+		// Mounts are prepared in the task directory on the worker, which is copied
+		// into a volume of the task pod before the task command starts. The volume
+		// is the working directory of the task command. Changes that the task makes
+		// to writable cache mounts are not copied back to the worker, so caches
+		// are only persisted as they were before the task ran.
+		//
+		// Since: generic-worker 5.4.0
+		//
+		// Array items:
+		// One of:
+		//   * FileMount
+		//   * WritableDirectoryCache
+		//   * ReadOnlyDirectory
+		Mounts []json.RawMessage `json:"mounts,omitempty"`
+
+		// By default tasks will be resolved with `state/reasonResolved`: `completed/completed`
+		// if all task commands have a zero exit code, or `failed/failed` if any command has a
+		// non-zero exit code. This payload property allows customsation of the task resolution
+		// based on exit code of task commands.
+		OnExitStatus ExitCodeHandling `json:"onExitStatus,omitempty"`
+
+		// A list of OS Groups that the task user should be a member of. Not yet implemented on
+		// non-Windows platforms, therefore this optional property may only be an empty array if
+		// provided.
+		//
+		// Since: generic-worker 6.0.0
+		//
+		// Array items:
+		OSGroups []string `json:"osGroups,omitempty"`
+
+		// Groups the task commands into named phases (for example `setup`,
+		// `build`, `test` and `package`), each of which is a run of
+		// consecutive commands. The numbers of commands of the phases must add
+		// up to the number of task commands. The worker writes
+		// Treeherder-compatible step markers to the task log at the start and
+		// end of each phase, and publishes the duration and outcome of each
+		// phase as artifact `public/phases.json`. Phases whose commands did not
+		// all run (because an earlier command failed, or the task was aborted)
+		// are reported with state `failed`, `aborted` or `skipped`.
+		//
+		// Since: generic-worker 28.1.0
+		Phases []Phase `json:"phases,omitempty"`
+
+		// Ports that the worker leases to the task for the duration of the task,
+		// each exposed to the task commands (and to any services) in an
+		// environment variable. Leased ports are taken from the worker's
+		// configured port lease range, and are not leased to any other task on
+		// the same host (including tasks of other workers that share the same
+		// `portLeasesDir`) until the task resolves. Use this instead of
+		// hard-coded port numbers to avoid clashes between concurrent tasks. The
+		// leased ports are listed in the task log.
+		//
+		// Since: generic-worker 28.1.0
+		PortLeases []PortLease `json:"portLeases,omitempty"`
+
+		// Settings for tasks that produce reproducible artifacts. Environment
+		// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+		// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+		// in `env`. The resolved settings are listed in the task log, and are
+		// recorded in the chain of trust certificate of the task (if the
+		// `chainOfTrust` feature is enabled).
+		//
+		// Since: generic-worker 28.1.0
+		Reproducible ReproducibleBuildEnvironment `json:"reproducible,omitempty"`
+
+		// Names of artifacts that the task must publish in order to resolve
+		// successfully, such as `public/build/target.tar.gz`. If any of them was
+		// not uploaded (for example because the file of an artifact of
+		// `task.payload.artifacts` does not exist, so an error artifact was
+		// uploaded instead) the task resolves as failed, listing the missing
+		// artifacts. This protects against tasks that succeed without producing
+		// their outputs.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    []
+		//
+		// Array items:
+		RequiredArtifacts []string `json:"requiredArtifacts,omitempty"`
+
+		// Policy for rerunning all of the task commands, from the first command,
+		// when the task fails with a known intermittent failure signature, so
+		// that intermittent failures don't need a new task run (and worker) to
+		// be retried. A task fails with a failure signature if the failing
+		// command exits with one of `exitCodes`, or if a line of the output of
+		// the failed attempt matches one of `logPatterns`. The task is rerun at
+		// most `maxReruns` times, after which it is resolved as `failed`. Each
+		// attempt is logged in its own section of the task log, and reported
+		// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+		// directory, so the task commands need to cope with files left behind
+		// by earlier attempts. Time spent rerunning counts towards
+		// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+		// and `onExitStatus.retry`, which resolves the task as
+		// `exception/intermittent-task` so that the queue creates a new run,
+		// reruns happen within the same run.
+		//
+		// Since: generic-worker 28.1.0
+		Rerun TaskRerunPolicy `json:"rerun,omitempty"`
+
+		// Compute resources of the task container.
+		//
+		// Since: generic-worker 28.1.0
+		Resources ContainerResources `json:"resources,omitempty"`
+
+		// Policies for retrying task commands that fail transiently (for
+		// example because of flaky network operations), so that task scripts
+		// don't need their own retry loops. A task command that has a retry
+		// policy, and fails, is run again after a delay, until it succeeds or
+		// has been attempted `maxAttempts` times. The delay is `backoffSeconds`
+		// before the second attempt, and doubles before each further attempt,
+		// up to `maxBackoffSeconds`. Time spent retrying counts towards
+		// `maxRunTime`. Only the result of the final attempt of a command
+		// determines the outcome of the task (including `onExitStatus`
+		// handling).
+		//
+		// Since: generic-worker 28.1.0
+		RetryPolicies []CommandRetryPolicy `json:"retryPolicies,omitempty"`
+
+		// Secrets from the taskcluster secrets service to inject into the task,
+		// as environment variables of the task commands, or as files in the task
+		// directory. The worker fetches the secrets with the task credentials, so
+		// the task requires scope `secrets:get:<name>` for each secret. Secret
+		// values are redacted from the task log, and secret files are deleted
+		// when the task ends. Secrets require the `secrets` feature to be enabled
+		// in the worker config.
+		//
+		// Since: generic-worker 28.1.0
+		Secrets []Secret `json:"secrets,omitempty"`
+
+		// URL of a service that can indicate tasks superseding this one; the current `taskId`
+		// will be appended as a query argument `taskId`. The service should return an object with
+		// a `supersedes` key containing a list of `taskId`s, including the supplied `taskId`. The
+		// tasks should be ordered such that each task supersedes all tasks appearing later in the
+		// list.
+		//
+		// See [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.
+		//
+		// Since: generic-worker 10.2.2
+		SupersederURL string `json:"supersederUrl,omitempty"`
+
+		// Files to create in the task directory before the task commands run,
+		// with inline content, which avoids quoting file content in the task
+		// commands, whose quoting rules differ between shells and platforms.
+		// Parent directories are created as needed, and existing files are
+		// replaced.
+		//
+		// Since: generic-worker 28.1.0
+		WriteFiles []FileToWrite `json:"writeFiles,omitempty"`
+	}
+
+	Phase struct {
+
+		// The number of consecutive task commands in the phase, following
+		// the commands of the previous phases.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		Commands int64 `json:"commands"`
+
+		// The name of the phase, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		// Max length: 100
+		Name string `json:"name"`
+	}
+
+	PortLease struct {
+
+		// The name of the environment variable that holds the leased port
+		// number, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]{0,63}$
+		Name string `json:"name"`
+
+		// The protocol that the port must be free for.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "tcp"
+		//   * "udp"
+		//
+		// Default:    "tcp"
+		Protocol string `json:"protocol,omitempty"`
+	}
+
+	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
+	//
+	// Since: generic-worker 11.1.0
+	RawContent struct {
+
+		// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
+		//
+		// Since: generic-worker 11.1.0
+		//
+		// Max length: 65536
+		Raw string `json:"raw"`
+	}
+
+	ReadOnlyDirectory struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// One of:
+		//   * ArtifactContent
+		//   * URLContent
+		//   * RawContent
+		//   * Base64Content
+		Content json.RawMessage `json:"content"`
+
+		// The filesystem location to mount the directory volume.
+		//
+		// Since: generic-worker 5.4.0
+		Directory string `json:"directory"`
+
+		// Archive format of content for read only directory.
+		//
+		// Since: generic-worker 5.4.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format"`
+	}
+
+	// Settings for tasks that produce reproducible artifacts. Environment
+	// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+	// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+	// in `env`. The resolved settings are listed in the task log, and are
+	// recorded in the chain of trust certificate of the task (if the
+	// `chainOfTrust` feature is enabled).
+	//
+	// Since: generic-worker 28.1.0
+	ReproducibleBuildEnvironment struct {
+
+		// The value of `LANG` and `LC_ALL`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "C.UTF-8"
+		Locale string `json:"locale,omitempty"`
+
+		// The value of `SOURCE_DATE_EPOCH`, in seconds since the Unix epoch.
+		// If not specified (or 0), the creation time of the task is used, so
+		// that reruns of the task use the same value.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		SourceDateEpoch int64 `json:"sourceDateEpoch,omitempty"`
+
+		// The value of `TZ`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "UTC"
+		Timezone string `json:"timezone,omitempty"`
+	}
+
+	Secret struct {
+
+		// The name of the environment variable to inject the secret as.
+		// Exactly one of `env` and `file` must be set.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]*$
+		Env string `json:"env,omitempty"`
+
+		// The path, relative to the task directory, of the file to write
+		// the secret to. The file is only readable by the task user.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		File string `json:"file,omitempty"`
+
+		// The property of the secret value to inject. If not set, the whole
+		// secret value is injected as JSON. String properties are injected
+		// as is, other properties as JSON.
+		//
+		// Since: generic-worker 28.1.0
+		Key string `json:"key,omitempty"`
+
+		// The name of the secret in the taskcluster secrets service.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Name string `json:"name"`
+	}
+
+	// Policy for rerunning all of the task commands, from the first command,
+	// when the task fails with a known intermittent failure signature, so
+	// that intermittent failures don't need a new task run (and worker) to
+	// be retried. A task fails with a failure signature if the failing
+	// command exits with one of `exitCodes`, or if a line of the output of
+	// the failed attempt matches one of `logPatterns`. The task is rerun at
+	// most `maxReruns` times, after which it is resolved as `failed`. Each
+	// attempt is logged in its own section of the task log, and reported
+	// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+	// directory, so the task commands need to cope with files left behind
+	// by earlier attempts. Time spent rerunning counts towards
+	// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+	// and `onExitStatus.retry`, which resolves the task as
+	// `exception/intermittent-task` so that the queue creates a new run,
+	// reruns happen within the same run.
+	//
+	// Since: generic-worker 28.1.0
+	TaskRerunPolicy struct {
+
+		// Exit codes that cause the task commands to be rerun, if a task
+		// command exits with them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// Regular expressions (in Go syntax) that cause the task commands to
+		// be rerun, if a line of the task log written during the failed
+		// attempt matches them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		LogPatterns []string `json:"logPatterns,omitempty"`
+
+		// The maximum number of times the task commands are rerun, not
+		// including the first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		// Maximum:    5
+		MaxReruns int64 `json:"maxReruns"`
+	}
+
+	// URL to download content from.
+	//
+	// Since: generic-worker 5.4.0
+	URLContent struct {
+
+		// The required SHA 256 of the content body.
+		//
+		// Since: generic-worker 10.8.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// URL to download content from.
+		//
+		// Since: generic-worker 5.4.0
+		URL string `json:"url"`
+	}
+
+	WritableDirectoryCache struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// Implies a read/write cache directory volume. A unique name for the
+		// cache volume. Requires scope `generic-worker:cache:<cache-name>`.
+		// Note if this cache is loaded from an artifact, you will also require
+		// scope `queue:get-artifact:<artifact-name>` to use this cache.
+		//
+		// Since: generic-worker 5.4.0
+		CacheName string `json:"cacheName"`
+
+		// One of:
+		//   * ArtifactContent
+		//   * URLContent
+		//   * RawContent
+		//   * Base64Content
+		Content json.RawMessage `json:"content,omitempty"`
+
+		// The filesystem location to mount the directory volume.
+		//
+		// Since: generic-worker 5.4.0
+		Directory string `json:"directory"`
+
+		// Archive format of the preloaded content (if `content` provided).
+		//
+		// Since: generic-worker 5.4.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format,omitempty"`
+
+		// If provided, the cache is kept on the worker between tasks as a
+		// seekable zstd archive, and only the given paths of the cache
+		// (relative to `directory`) are extracted when it is mounted, which
+		// is much quicker than mounting the whole of a large cache when the
+		// task only needs part of it. Other paths of the cache are not
+		// available to the task, but are kept in the cache for later tasks.
+		// A task that mounts the cache without `paths` gets the whole cache.
+		// Requires `zstd` to be installed on the worker.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Paths []string `json:"paths,omitempty"`
+	}
+)
+
+// Returns json schema for the payload part of the task definition. Please
+// note we use a go string and do not load an external file, since we want this
+// to be *part of the compiled executable*. If this sat in another file that
+// was loaded at runtime, it would not be burned into the build, which would be
+// bad for the following two reasons:
+//  1) we could no longer distribute a single binary file that didn't require
+//     installation/extraction
+//  2) the payload schema is specific to the version of the code, therefore
+//     should be versioned directly with the code and *frozen on build*.
+//
+// Run `generic-worker show-payload-schema` to output this schema to standard
+// out.
+func taskPayloadSchema() string {
+	return `{
+  "$id": "/schemas/generic-worker/kubernetes_posix.json#",
+  "$schema": "/schemas/common/metaschema.json#",
+  "additionalProperties": false,
+  "definitions": {
+    "architectures": {
+      "description": "A list of CPU architectures.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "enum": [
+          "arm64",
+          "x86_64"
+        ],
+        "title": "CPU architecture",
+        "type": "string"
+      },
+      "minItems": 1,
+      "title": "CPU architectures",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "content": {
+      "oneOf": [
+        {
+          "additionalProperties": false,
+          "description": "Requires scope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + `.\n\nSince: generic-worker 5.4.0",
+          "properties": {
+            "artifact": {
+              "maxLength": 1024,
+              "type": "string"
+            },
+            "sha256": {
+              "description": "The required SHA 256 of the content body.\n\nSince: generic-worker 10.8.0",
+              "pattern": "^[a-f0-9]{64}$",
+              "title": "SHA 256",
+              "type": "string"
+            },
+            "taskId": {
+              "pattern": "^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$",
+              "type": "string"
+            }
+          },
+          "required": [
+            "taskId",
+            "artifact"
+          ],
+          "title": "Artifact Content",
+          "type": "object"
+        },
+        {
+          "additionalProperties": false,
+          "description": "URL to download content from.\n\nSince: generic-worker 5.4.0",
+          "properties": {
+            "sha256": {
+              "description": "The required SHA 256 of the content body.\n\nSince: generic-worker 10.8.0",
+              "pattern": "^[a-f0-9]{64}$",
+              "title": "SHA 256",
+              "type": "string"
+            },
+            "url": {
+              "description": "URL to download content from.\n\nSince: generic-worker 5.4.0",
+              "format": "uri",
+              "title": "URL",
+              "type": "string"
+            }
+          },
+          "required": [
+            "url"
+          ],
+          "title": "URL Content",
+          "type": "object"
+        },
+        {
+          "additionalProperties": false,
+          "description": "Byte-for-byte literal inline content of file/archive, up to 64KB in size.\n\nSince: generic-worker 11.1.0",
+          "properties": {
+            "raw": {
+              "description": "Byte-for-byte literal inline content of file/archive, up to 64KB in size.\n\nSince: generic-worker 11.1.0",
+              "maxLength": 65536,
+              "title": "Raw",
+              "type": "string"
+            }
+          },
+          "required": [
+            "raw"
+          ],
+          "title": "Raw Content",
+          "type": "object"
+        },
+        {
+          "additionalProperties": false,
+          "description": "Base64 encoded content of file/archive, up to 64KB (encoded) in size.\n\nSince: generic-worker 11.1.0",
+          "properties": {
+            "base64": {
+              "description": "Base64 encoded content of file/archive, up to 64KB (encoded) in size.\n\nSince: generic-worker 11.1.0",
+              "maxLength": 65536,
+              "pattern": "^[A-Za-z0-9/+]+[=]{0,2}$",
+              "title": "Base64",
+              "type": "string"
+            }
+          },
+          "required": [
+            "base64"
+          ],
+          "title": "Base64 Content",
+          "type": "object"
+        }
+      ]
+    },
+    "fetch": {
+      "additionalProperties": false,
+      "description": "An artifact of an upstream task to download. Exactly one of ` + "`" + `taskId` + "`" + `\nand ` + "`" + `namespace` + "`" + ` must be provided.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "artifact": {
+          "description": "The name of the artifact to download from the task.\n\nSince: generic-worker 28.1.0",
+          "maxLength": 1024,
+          "title": "Artifact name",
+          "type": "string"
+        },
+        "format": {
+          "description": "If provided, the artifact is treated as an archive of the given\nformat, and is extracted into ` + "`" + `path` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "rar",
+            "tar.bz2",
+            "tar.gz",
+            "zip"
+          ],
+          "title": "Format",
+          "type": "string"
+        },
+        "namespace": {
+          "description": "An index namespace (e.g. ` + "`" + `project.example.latest.linux64` + "`" + `) which\nis resolved to a ` + "`" + `taskId` + "`" + ` via the index service when the task\nstarts. The resolved ` + "`" + `taskId` + "`" + ` is recorded, together with the SHA256\nof the fetched content, in the artifact ` + "`" + `public/resolved-fetches.json` + "`" + `\nand in the chain of trust certificate (if enabled).\n\nSince: generic-worker 28.1.0",
+          "maxLength": 255,
+          "title": "Index namespace",
+          "type": "string"
+        },
+        "path": {
+          "description": "The location, relative to the task directory, to place the artifact.\nIf ` + "`" + `format` + "`" + ` is provided, this is the directory into which the\nartifact is extracted, otherwise it is the file the artifact is\ncopied to.\n\nSince: generic-worker 28.1.0",
+          "title": "Path",
+          "type": "string"
+        },
+        "sha256": {
+          "description": "The required SHA 256 of the artifact content.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[a-f0-9]{64}$",
+          "title": "SHA 256",
+          "type": "string"
+        },
+        "taskId": {
+          "description": "The ` + "`" + `taskId` + "`" + ` of the task that published the artifact.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$",
+          "title": "Task ID",
+          "type": "string"
+        }
+      },
+      "required": [
+        "artifact",
+        "path"
+      ],
+      "title": "Fetch",
+      "type": "object"
+    },
+    "fileMount": {
+      "additionalProperties": false,
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "content": {
+          "$ref": "#/definitions/content",
+          "description": "Content of the file to be mounted.\n\nSince: generic-worker 5.4.0"
+        },
+        "file": {
+          "description": "The filesystem location to mount the file.\n\nSince: generic-worker 5.4.0",
+          "title": "File",
+          "type": "string"
+        }
+      },
+      "required": [
+        "file",
+        "content"
+      ],
+      "title": "File Mount",
+      "type": "object"
+    },
+    "mount": {
+      "oneOf": [
+        {
+          "$ref": "#/definitions/fileMount"
+        },
+        {
+          "$ref": "#/definitions/writableDirectoryCache"
+        },
+        {
+          "$ref": "#/definitions/readOnlyDirectory"
+        }
+      ],
+      "title": "Mount"
+    },
+    "readOnlyDirectory": {
+      "additionalProperties": false,
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "content": {
+          "$ref": "#/definitions/content",
+          "description": "Contents of read only directory.\n\nSince: generic-worker 5.4.0",
+          "title": "Content"
+        },
+        "directory": {
+          "description": "The filesystem location to mount the directory volume.\n\nSince: generic-worker 5.4.0",
+          "title": "Directory",
+          "type": "string"
+        },
+        "format": {
+          "description": "Archive format of content for read only directory.\n\nSince: generic-worker 5.4.0",
+          "enum": [
+            "rar",
+            "tar.bz2",
+            "tar.gz",
+            "zip"
+          ],
+          "title": "Format",
+          "type": "string"
+        }
+      },
+      "required": [
+        "directory",
+        "content",
+        "format"
+      ],
+      "title": "Read Only Directory",
+      "type": "object"
+    },
+    "writableDirectoryCache": {
+      "additionalProperties": false,
+      "dependencies": {
+        "content": [
+          "format"
+        ],
+        "format": [
+          "content"
+        ]
+      },
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "cacheName": {
+          "description": "Implies a read/write cache directory volume. A unique name for the\ncache volume. Requires scope ` + "`" + `generic-worker:cache:\u003ccache-name\u003e` + "`" + `.\nNote if this cache is loaded from an artifact, you will also require\nscope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + ` to use this cache.\n\nSince: generic-worker 5.4.0",
+          "title": "Cache Name",
+          "type": "string"
+        },
+        "content": {
+          "$ref": "#/definitions/content",
+          "description": "Optional content to be preloaded when initially creating the cache\n(if set, ` + "`" + `format` + "`" + ` must also be provided).\n\nSince: generic-worker 5.4.0",
+          "title": "Content"
+        },
+        "directory": {
+          "description": "The filesystem location to mount the directory volume.\n\nSince: generic-worker 5.4.0",
+          "title": "Directory Volume",
+          "type": "string"
+        },
+        "format": {
+          "description": "Archive format of the preloaded content (if ` + "`" + `content` + "`" + ` provided).\n\nSince: generic-worker 5.4.0",
+          "enum": [
+            "rar",
+            "tar.bz2",
+            "tar.gz",
+            "zip"
+          ],
+          "title": "Format",
+          "type": "string"
+        },
+        "paths": {
+          "description": "If provided, the cache is kept on the worker between tasks as a\nseekable zstd archive, and only the given paths of the cache\n(relative to ` + "`" + `directory` + "`" + `) are extracted when it is mounted, which\nis much quicker than mounting the whole of a large cache when the\ntask only needs part of it. Other paths of the cache are not\navailable to the task, but are kept in the cache for later tasks.\nA task that mounts the cache without ` + "`" + `paths` + "`" + ` gets the whole cache.\nRequires ` + "`" + `zstd` + "`" + ` to be installed on the worker.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          },
+          "title": "Paths",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [
+        "directory",
+        "cacheName"
+      ],
+      "title": "Writable Directory Cache",
+      "type": "object"
+    }
+  },
+  "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.\n\nIf ` + "`" + `features.payloadTemplates` + "`" + ` is enabled, the arguments of ` + "`" + `command` + "`" + `, the\nvalues of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` may contain template\nexpressions, which the worker expands when the task starts:\n\n  * ` + "`" + `{{taskId}}` + "`" + `, ` + "`" + `{{runId}}` + "`" + ` and ` + "`" + `{{taskGroupId}}` + "`" + ` - the IDs of the task\n  * ` + "`" + `{{workerGroup}}` + "`" + `, ` + "`" + `{{workerId}}` + "`" + ` and ` + "`" + `{{workerPoolId}}` + "`" + ` - the IDs of the\n    worker\n  * ` + "`" + `{{cachePath \"\u003ccacheName\u003e\"}}` + "`" + ` - the ` + "`" + `directory` + "`" + ` of the writable\n    directory cache mount with cache name ` + "`" + `\u003ccacheName\u003e` + "`" + `\n  * ` + "`" + `{{fetchPath \"\u003cartifact\u003e\"}}` + "`" + ` - the ` + "`" + `path` + "`" + ` of the fetch of the artifact\n    with name (or base name) ` + "`" + `\u003cartifact\u003e` + "`" + `\n\nPaths are relative to the task directory. Other text between ` + "`" + `{{` + "`" + ` and ` + "`" + `}}` + "`" + `\nis left as is.\n\nSince: generic-worker 28.1.0",
+  "properties": {
+    "architectures": {
+      "$ref": "#/definitions/architectures",
+      "description": "The CPU architectures that the task commands can run on, most\npreferred first. The task runs as the first of them that the worker\nsupports, either natively, or on macOS and Linux workers with Rosetta,\nas x86_64 by translation. If the worker supports none of them, the\ntask resolves as ` + "`" + `exception/malformed-payload` + "`" + `. The architecture that\nthe task runs as is available to the task commands in environment\nvariable ` + "`" + `TASK_ARCHITECTURE` + "`" + `, and selects which ` + "`" + `mounts` + "`" + ` and ` + "`" + `fetches` + "`" + `\napply to the task (see their ` + "`" + `architectures` + "`" + ` property). If not\nprovided, the task runs as the native architecture of the worker.\n\nSince: generic-worker 28.1.0",
+      "title": "Architectures"
+    },
+    "artifacts": {
+      "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "contentEncoding": {
+            "description": "Content-Encoding for the artifact. If not provided, ` + "`" + `gzip` + "`" + ` will be used, except for the\nfollowing file extensions, where ` + "`" + `identity` + "`" + ` will be used, since they are already\ncompressed:\n\n* jpg\n* jpeg\n* png\n* gif\n* webp\n* 7z\n* zip\n* gz\n* tgz\n* bz2\n* tbz\n* whl\n* xz\n* swf\n* flv\n* woff\n* woff2\n\nNote, setting ` + "`" + `contentEncoding` + "`" + ` on a directory artifact will apply the same content\nencoding to all the files contained in the directory.\n\nSince: generic-worker 16.2.0",
+            "enum": [
+              "identity",
+              "gzip"
+            ],
+            "title": "Content-Encoding header when serving artifact over HTTP.",
+            "type": "string"
+          },
+          "contentType": {
+            "description": "Explicitly set the value of the HTTP ` + "`" + `Content-Type` + "`" + ` response header when the artifact(s)\nis/are served over HTTP(S). If not provided (this property is optional) the worker will\nguess the content type of artifacts based on the filename extension of the file storing\nthe artifact content. It does this by looking at the system filename-to-mimetype mappings\ndefined in multiple ` + "`" + `mime.types` + "`" + ` files located under ` + "`" + `/etc` + "`" + `. Note, setting ` + "`" + `contentType` + "`" + `\non a directory artifact will apply the same contentType to all files contained in the\ndirectory.\n\nSee [mime.TypeByExtension](https://godoc.org/mime#TypeByExtension).\n\nSince: generic-worker 10.4.0",
+            "title": "Content-Type header when serving artifact over HTTP",
+            "type": "string"
+          },
+          "expires": {
+            "description": "Date when artifact should expire must be in the future, no earlier than task deadline, but\nno later than task expiry. If not set, defaults to task expiry.\n\nSince: generic-worker 1.0.0",
+            "format": "date-time",
+            "title": "Expiry date and time",
+            "type": "string"
+          },
+          "name": {
+            "description": "Name of the artifact, as it will be published. If not set, ` + "`" + `path` + "`" + ` will be used.\nConventionally (although not enforced) path elements are forward slash separated. Example:\n` + "`" + `public/build/a/house` + "`" + `. Note, no scopes are required to read artifacts beginning ` + "`" + `public/` + "`" + `.\nArtifact names not beginning ` + "`" + `public/` + "`" + ` are scope-protected (caller requires scopes to\ndownload the artifact). See the Queue documentation for more information.\n\nSince: generic-worker 8.1.0",
+            "title": "Name of the artifact",
+            "type": "string"
+          },
+          "path": {
+            "description": "Relative path of the file/directory from the task directory. Note this is not an absolute\npath as is typically used in docker-worker, since the absolute task directory name is not\nknown when the task is submitted. Example: ` + "`" + `dist\\regedit.exe` + "`" + `. It doesn't matter if\nforward slashes or backslashes are used.\n\nSince: generic-worker 1.0.0",
+            "title": "Artifact location",
+            "type": "string"
+          },
+          "private": {
+            "default": false,
+            "description": "If ` + "`" + `true` + "`" + `, the artifact is scope-protected, so its ` + "`" + `name` + "`" + ` (or ` + "`" + `path` + "`" + `, if ` + "`" + `name` + "`" + ` is not\nset) must not begin ` + "`" + `public/` + "`" + `. Downloading the artifact requires scope\n` + "`" + `queue:get-artifact:\u003cname\u003e` + "`" + ` (for a ` + "`" + `directory` + "`" + ` artifact, ` + "`" + `queue:get-artifact:\u003cname\u003e/*` + "`" + `),\nwhich the task must also have, so that the task can grant it to the tasks that consume\nthe artifact. Note, on workers with config setting ` + "`" + `forcePrivateArtifacts` + "`" + ` enabled, all\nartifact names beginning ` + "`" + `public/` + "`" + ` are published beginning ` + "`" + `private/` + "`" + ` instead.\n\nSince: generic-worker 28.1.0",
+            "title": "Publish artifact as private",
+            "type": "boolean"
+          },
+          "type": {
+            "description": "Artifacts can be either an individual ` + "`" + `file` + "`" + ` or a ` + "`" + `directory` + "`" + ` containing\npotentially multiple files with recursively included subdirectories.\n\nSince: generic-worker 1.0.0",
+            "enum": [
+              "file",
+              "directory"
+            ],
+            "title": "Artifact upload type.",
+            "type": "string"
+          }
+        },
+        "required": [
+          "type",
+          "path"
+        ],
+        "title": "Artifact",
+        "type": "object"
+      },
+      "title": "Artifacts to be published",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "bandwidthLimits": {
+      "additionalProperties": false,
+      "description": "Rate limits for transfers made by the worker on behalf of this task.\nThese apply in addition to any limits configured for the worker as a\nwhole (config settings ` + "`" + `maxDownloadBytesPerSec` + "`" + ` and\n` + "`" + `maxUploadBytesPerSec` + "`" + `), so can only further reduce bandwidth usage.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "maxDownloadBytesPerSec": {
+          "description": "Maximum number of bytes per second to download for mounts and\nfetches.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum download rate",
+          "type": "integer"
+        },
+        "maxUploadBytesPerSec": {
+          "description": "Maximum number of bytes per second to upload for artifacts.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum upload rate",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Bandwidth limits",
+      "type": "object"
+    },
+    "command": {
+      "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nSince: generic-worker 0.0.1\n\nThe kubernetes engine runs each task as a single Kubernetes Job, so\nexactly one command is supported. Use a shell to run several steps.",
+      "items": {
+        "items": {
+          "type": "string"
+        },
+        "minItems": 1,
+        "type": "array",
+        "uniqueItems": false
+      },
+      "maxItems": 1,
+      "minItems": 1,
+      "title": "Commands to run",
+      "type": "array",
+      "uniqueItems": false
+    },
+    "env": {
+      "additionalProperties": {
+        "type": "string"
+      },
+      "description": "Env vars must be string to __string__ mappings (not number or boolean). For example:\n` + "`" + `` + "`" + `` + "`" + `\n{\n  \"PATH\": \"/usr/local/bin:/usr/bin:/bin:/usr/sbin:/sbin\",\n  \"GOOS\": \"darwin\",\n  \"FOO_ENABLE\": \"true\",\n  \"BAR_TOTAL\": \"3\"\n}\n` + "`" + `` + "`" + `` + "`" + `\n\nNote, the following environment variables will automatically be set in the task\ncommands:\n  * ` + "`" + `TASK_ID` + "`" + ` - the task ID of the currently running task\n  * ` + "`" + `RUN_ID` + "`" + ` - the run ID of the currently running task\n  * ` + "`" + `TASKCLUSTER_ROOT_URL` + "`" + ` - the root URL of the taskcluster deployment\n  * ` + "`" + `TASKCLUSTER_PROXY_URL` + "`" + ` (if taskcluster proxy feature enabled) - the\n     taskcluster authentication proxy for making unauthenticated taskcluster\n     API calls\n  * ` + "`" + `TASKCLUSTER_WORKER_LOCATION` + "`" + ` (if running in AWS or GCP or explicitly set\n    in the generic-worker config file). See\n    [RFC #0148](https://github.com/taskcluster/taskcluster-rfcs/blob/master/rfcs/0148-taskcluster-worker-location.md)\n    for details.\n\nSince: generic-worker 0.0.1",
+      "title": "Env vars",
+      "type": "object"
+    },
+    "features": {
+      "additionalProperties": false,
+      "description": "Feature flags enable additional functionality.\n\nSince: generic-worker 5.3.0",
+      "properties": {
+        "chainOfTrust": {
+          "description": "Artifacts named ` + "`" + `public/chain-of-trust.json` + "`" + ` and\n` + "`" + `public/chain-of-trust.json.sig` + "`" + ` should be generated which will\ninclude information for downstream tasks to build a level of trust\nfor the artifacts produced by the task and the environment it ran in.\n\nSince: generic-worker 5.3.0",
+          "title": "Enable generation of signed Chain of Trust artifacts",
+          "type": "boolean"
+        },
+        "payloadTemplates": {
+          "description": "If enabled, the template expressions in the arguments of ` + "`" + `command` + "`" + `,\nthe values of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` are\nexpanded when the task starts (see the description of the payload).\nWithout it, text such as ` + "`" + `{{taskId}}` + "`" + ` is passed to the task as is.\n\nSince: generic-worker 28.1.0",
+          "title": "Expand template expressions in the task payload",
+          "type": "boolean"
+        },
+        "resultCache": {
+          "description": "If enabled, the worker computes a hash of the task payload together\nwith the SHA256 of all content mounted or fetched into the task\ndirectory. If an earlier task with the same hash completed\nsuccessfully on this worker type, the task commands are not run, and\ninstead the artifacts of the earlier task are re-exposed as redirect\nartifacts, and the task resolves as completed. Otherwise, if the task\ncompletes successfully, it is recorded in the index under namespace\n` + "`" + `generic-worker.result-cache.\u003cprovisionerId\u003e.\u003cworkerType\u003e.\u003chash\u003e` + "`" + ` for\nfuture tasks to reuse. The hash also covers the scopes and routes of\nthe task. Only enable this for deterministic tasks.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:result-cache:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Reuse the result of an identical earlier task run",
+          "type": "boolean"
+        },
+        "taskclusterProxy": {
+          "description": "The taskcluster proxy provides an easy and safe way to make authenticated\ntaskcluster requests within the scope(s) of a particular task. See\n[the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.\n\nSince: generic-worker 10.6.0",
+          "title": "Run [taskcluster-proxy](https://github.com/taskcluster/taskcluster-proxy) to allow tasks to dynamically proxy requests to taskcluster services",
+          "type": "boolean"
+        }
+      },
+      "required": [],
+      "title": "Feature flags",
+      "type": "object"
+    },
+    "fetches": {
+      "description": "Artifacts of upstream tasks to be downloaded before the task commands\nrun. Each fetch refers to an artifact of a task, identified either\ndirectly by ` + "`" + `taskId` + "`" + `, or indirectly by an index ` + "`" + `namespace` + "`" + ` which is\nresolved to a ` + "`" + `taskId` + "`" + ` when the task starts. Fetches are downloaded in\nparallel, retried on transient failures, verified against ` + "`" + `sha256` + "`" + ` (if\nprovided) and cached on the worker between tasks, in the same way as\nfile mounts.\n\nTasks referenced by ` + "`" + `taskId` + "`" + ` must be listed in ` + "`" + `task.dependencies` + "`" + `.\nFetching a non-public artifact (i.e. not starting with ` + "`" + `public/` + "`" + `)\nrequires scope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "$ref": "#/definitions/fetch",
+        "title": "Fetch"
+      },
+      "title": "Fetches",
+      "type": "array",
+      "uniqueItems": false
+    },
+    "image": {
+      "description": "The container image that the task command runs in, for example\n` + "`" + `ubuntu:20.04` + "`" + `. The image must provide ` + "`" + `/bin/sh` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "minLength": 1,
+      "title": "Container image",
+      "type": "string"
+    },
+    "maxArtifactsMB": {
+      "description": "The maximum total size in megabytes of the artifacts of\n` + "`" + `task.payload.artifacts` + "`" + `. If the artifacts are larger, none of them\nare uploaded, and the task resolves as failed, listing its largest\nartifacts. This applies in addition to any limit configured for the\nworker (config setting ` + "`" + `maxTaskArtifactsMB` + "`" + `), so can only lower it.\n\nSince: generic-worker 28.1.0",
+      "minimum": 1,
+      "title": "Maximum total artifact size",
+      "type": "integer"
+    },
+    "maxRunTime": {
+      "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
+      "maximum": 86400,
+      "minimum": 1,
+      "multipleOf": 1,
+      "title": "Maximum run time in seconds",
+      "type": "integer"
+    },
+    "mounts": {
+      "description": "Directories and/or files to be mounted.\n\nMounts are prepared in the task directory on the worker, which is copied\ninto a volume of the task pod before the task command starts. The volume\nis the working directory of the task command. Changes that the task makes\nto writable cache mounts are not copied back to the worker, so caches\nare only persisted as they were before the task ran.\n\nSince: generic-worker 5.4.0",
+      "items": {
+        "$ref": "#/definitions/mount",
+        "title": "Mount"
+      },
+      "type": "array",
+      "uniqueItems": false
+    },
+    "onExitStatus": {
+      "additionalProperties": false,
+      "description": "By default tasks will be resolved with ` + "`" + `state/reasonResolved` + "`" + `: ` + "`" + `completed/completed` + "`" + `\nif all task commands have a zero exit code, or ` + "`" + `failed/failed` + "`" + ` if any command has a\nnon-zero exit code. This payload property allows customsation of the task resolution\nbased on exit code of task commands.",
+      "properties": {
+        "exception": {
+          "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception` + "`" + `, with the given reason, for example so\nthat a test harness that detects a problem with the worker can\nresolve the task as ` + "`" + `exception/resource-unavailable` + "`" + `, rather than\n` + "`" + `failed/failed` + "`" + `. Use ` + "`" + `retry` + "`" + ` for ` + "`" + `exception/intermittent-task` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "exitCodes": {
+                "description": "The exit codes that cause the task to be resolved as\nexception with this reason.\n\nSince: generic-worker 28.1.0",
+                "items": {
+                  "minimum": 1,
+                  "type": "integer"
+                },
+                "minItems": 1,
+                "title": "Exit codes",
+                "type": "array",
+                "uniqueItems": true
+              },
+              "reason": {
+                "description": "The reason to resolve the task with.\n\nSince: generic-worker 28.1.0",
+                "enum": [
+                  "internal-error",
+                  "malformed-payload",
+                  "resource-unavailable"
+                ],
+                "title": "Exception reason",
+                "type": "string"
+              }
+            },
+            "required": [
+              "reason",
+              "exitCodes"
+            ],
+            "title": "Exception mapping",
+            "type": "object"
+          },
+          "title": "Exit codes resolving task as exception",
+          "type": "array"
+        },
+        "retry": {
+          "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception/intermittent-task` + "`" + `. Typically the Queue\nwill then schedule a new run of the existing ` + "`" + `taskId` + "`" + ` (rerun) if not\nall task runs have been exhausted.\n\nSee [itermittent tasks](https://docs.taskcluster.net/docs/reference/platform/taskcluster-queue/docs/worker-interaction#intermittent-tasks) for more detail.\n\nSince: generic-worker 10.10.0",
+          "items": {
+            "minimum": 1,
+            "title": "Exit codes",
+            "type": "integer"
+          },
+          "title": "Intermittent task exit codes",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "success": {
+          "description": "Exit codes for any command in the task payload to be treated as\nsuccess (with a warning in the task log), so that subsequent task\ncommands are run, and if they succeed, the task is resolved as\n` + "`" + `completed/completed` + "`" + `. Commands that exit with these exit codes\nare not retried by ` + "`" + `retryPolicies` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "title": "Exit codes",
+            "type": "integer"
+          },
+          "title": "Exit codes treated as success",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [],
+      "title": "Exit code handling",
+      "type": "object"
+    },
+    "osGroups": {
+      "description": "A list of OS Groups that the task user should be a member of. Not yet implemented on\nnon-Windows platforms, therefore this optional property may only be an empty array if\nprovided.\n\nSince: generic-worker 6.0.0",
+      "items": {
+        "type": "string"
+      },
+      "maxItems": 0,
+      "title": "OS Groups",
+      "type": "array",
+      "uniqueItems": false
+    },
+    "phases": {
+      "description": "Groups the task commands into named phases (for example ` + "`" + `setup` + "`" + `,\n` + "`" + `build` + "`" + `, ` + "`" + `test` + "`" + ` and ` + "`" + `package` + "`" + `), each of which is a run of\nconsecutive commands. The numbers of commands of the phases must add\nup to the number of task commands. The worker writes\nTreeherder-compatible step markers to the task log at the start and\nend of each phase, and publishes the duration and outcome of each\nphase as artifact ` + "`" + `public/phases.json` + "`" + `. Phases whose commands did not\nall run (because an earlier command failed, or the task was aborted)\nare reported with state ` + "`" + `failed` + "`" + `, ` + "`" + `aborted` + "`" + ` or ` + "`" + `skipped` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "commands": {
+            "description": "The number of consecutive task commands in the phase, following\nthe commands of the previous phases.\n\nSince: generic-worker 28.1.0",
+            "minimum": 1,
+            "title": "Number of commands in phase",
+            "type": "integer"
+          },
+          "name": {
+            "description": "The name of the phase, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "maxLength": 100,
+            "minLength": 1,
+            "title": "Phase name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name",
+          "commands"
+        ],
+        "title": "Phase",
+        "type": "object"
+      },
+      "title": "Named phases of task commands",
+      "type": "array"
+    },
+    "portLeases": {
+      "description": "Ports that the worker leases to the task for the duration of the task,\neach exposed to the task commands (and to any services) in an\nenvironment variable. Leased ports are taken from the worker's\nconfigured port lease range, and are not leased to any other task on\nthe same host (including tasks of other workers that share the same\n` + "`" + `portLeasesDir` + "`" + `) until the task resolves. Use this instead of\nhard-coded port numbers to avoid clashes between concurrent tasks. The\nleased ports are listed in the task log.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "name": {
+            "description": "The name of the environment variable that holds the leased port\nnumber, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]{0,63}$",
+            "title": "Environment variable name",
+            "type": "string"
+          },
+          "protocol": {
+            "default": "tcp",
+            "description": "The protocol that the port must be free for.\n\nSince: generic-worker 28.1.0",
+            "enum": [
+              "tcp",
+              "udp"
+            ],
+            "title": "Protocol",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Port lease",
+        "type": "object"
+      },
+      "title": "Port leases",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "reproducible": {
+      "additionalProperties": false,
+      "description": "Settings for tasks that produce reproducible artifacts. Environment\nvariable ` + "`" + `SOURCE_DATE_EPOCH` + "`" + ` is set to ` + "`" + `sourceDateEpoch` + "`" + `, ` + "`" + `TZ` + "`" + ` to\n` + "`" + `timezone` + "`" + `, and ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + ` to ` + "`" + `locale` + "`" + `, overriding any values\nin ` + "`" + `env` + "`" + `. The resolved settings are listed in the task log, and are\nrecorded in the chain of trust certificate of the task (if the\n` + "`" + `chainOfTrust` + "`" + ` feature is enabled).\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "locale": {
+          "default": "C.UTF-8",
+          "description": "The value of ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Locale",
+          "type": "string"
+        },
+        "sourceDateEpoch": {
+          "description": "The value of ` + "`" + `SOURCE_DATE_EPOCH` + "`" + `, in seconds since the Unix epoch.\nIf not specified (or 0), the creation time of the task is used, so\nthat reruns of the task use the same value.\n\nSince: generic-worker 28.1.0",
+          "minimum": 0,
+          "title": "Source date epoch",
+          "type": "integer"
+        },
+        "timezone": {
+          "default": "UTC",
+          "description": "The value of ` + "`" + `TZ` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Time zone",
+          "type": "string"
+        }
+      },
+      "title": "Reproducible build environment",
+      "type": "object"
+    },
+    "requiredArtifacts": {
+      "default": [],
+      "description": "Names of artifacts that the task must publish in order to resolve\nsuccessfully, such as ` + "`" + `public/build/target.tar.gz` + "`" + `. If any of them was\nnot uploaded (for example because the file of an artifact of\n` + "`" + `task.payload.artifacts` + "`" + ` does not exist, so an error artifact was\nuploaded instead) the task resolves as failed, listing the missing\nartifacts. This protects against tasks that succeed without producing\ntheir outputs.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "type": "string"
+      },
+      "title": "Required artifacts",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "rerun": {
+      "additionalProperties": false,
+      "description": "Policy for rerunning all of the task commands, from the first command,\nwhen the task fails with a known intermittent failure signature, so\nthat intermittent failures don't need a new task run (and worker) to\nbe retried. A task fails with a failure signature if the failing\ncommand exits with one of ` + "`" + `exitCodes` + "`" + `, or if a line of the output of\nthe failed attempt matches one of ` + "`" + `logPatterns` + "`" + `. The task is rerun at\nmost ` + "`" + `maxReruns` + "`" + ` times, after which it is resolved as ` + "`" + `failed` + "`" + `. Each\nattempt is logged in its own section of the task log, and reported\nas a ` + "`" + `taskRerun` + "`" + ` WORKER_METRICS event. Reruns use the same task\ndirectory, so the task commands need to cope with files left behind\nby earlier attempts. Time spent rerunning counts towards\n` + "`" + `maxRunTime` + "`" + `. Unlike ` + "`" + `retryPolicies` + "`" + `, which retry a single command,\nand ` + "`" + `onExitStatus.retry` + "`" + `, which resolves the task as\n` + "`" + `exception/intermittent-task` + "`" + ` so that the queue creates a new run,\nreruns happen within the same run.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "exitCodes": {
+          "description": "Exit codes that cause the task commands to be rerun, if a task\ncommand exits with them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "type": "integer"
+          },
+          "title": "Exit codes of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "logPatterns": {
+          "description": "Regular expressions (in Go syntax) that cause the task commands to\nbe rerun, if a line of the task log written during the failed\nattempt matches them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "type": "string"
+          },
+          "title": "Log patterns of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "maxReruns": {
+          "description": "The maximum number of times the task commands are rerun, not\nincluding the first attempt.\n\nSince: generic-worker 28.1.0",
+          "maximum": 5,
+          "minimum": 1,
+          "title": "Maximum number of reruns",
+          "type": "integer"
+        }
+      },
+      "required": [
+        "maxReruns"
+      ],
+      "title": "Task rerun policy",
+      "type": "object"
+    },
+    "resources": {
+      "additionalProperties": false,
+      "description": "Compute resources of the task container.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "limits": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "description": "Maximum compute resources that the task container may use, as\nKubernetes resource quantities keyed by resource name, for example\n` + "`" + `{\"memory\": \"8Gi\"}` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Resource limits",
+          "type": "object"
+        },
+        "requests": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "description": "Compute resources that the task container requires, as Kubernetes\nresource quantities keyed by resource name, for example\n` + "`" + `{\"cpu\": \"2\", \"memory\": \"4Gi\"}` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Resource requests",
+          "type": "object"
+        }
+      },
+      "title": "Container resources",
+      "type": "object"
+    },
+    "retryPolicies": {
+      "description": "Policies for retrying task commands that fail transiently (for\nexample because of flaky network operations), so that task scripts\ndon't need their own retry loops. A task command that has a retry\npolicy, and fails, is run again after a delay, until it succeeds or\nhas been attempted ` + "`" + `maxAttempts` + "`" + ` times. The delay is ` + "`" + `backoffSeconds` + "`" + `\nbefore the second attempt, and doubles before each further attempt,\nup to ` + "`" + `maxBackoffSeconds` + "`" + `. Time spent retrying counts towards\n` + "`" + `maxRunTime` + "`" + `. Only the result of the final attempt of a command\ndetermines the outcome of the task (including ` + "`" + `onExitStatus` + "`" + `\nhandling).\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "backoffSeconds": {
+            "default": 10,
+            "description": "The number of seconds to wait before the second attempt of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Initial delay between attempts",
+            "type": "integer"
+          },
+          "command": {
+            "description": "The zero-based index of the task command that the policy applies\nto. Each command may have at most one policy.\n\nSince: generic-worker 28.1.0",
+            "minimum": 0,
+            "title": "Command index",
+            "type": "integer"
+          },
+          "exitCodes": {
+            "description": "Exit codes that cause the command to be retried. If not\nspecified, any failure of the command causes it to be retried.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "minimum": 1,
+              "type": "integer"
+            },
+            "title": "Exit codes to retry",
+            "type": "array",
+            "uniqueItems": true
+          },
+          "maxAttempts": {
+            "description": "The maximum number of times the command is run, including the\nfirst attempt.\n\nSince: generic-worker 28.1.0",
+            "maximum": 10,
+            "minimum": 2,
+            "title": "Maximum number of attempts",
+            "type": "integer"
+          },
+          "maxBackoffSeconds": {
+            "default": 300,
+            "description": "The maximum number of seconds to wait between attempts of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Maximum delay between attempts",
+            "type": "integer"
+          }
+        },
+        "required": [
+          "command",
+          "maxAttempts"
+        ],
+        "title": "Command retry policy",
+        "type": "object"
+      },
+      "title": "Command retry policies",
+      "type": "array"
+    },
+    "secrets": {
+      "description": "Secrets from the taskcluster secrets service to inject into the task,\nas environment variables of the task commands, or as files in the task\ndirectory. The worker fetches the secrets with the task credentials, so\nthe task requires scope ` + "`" + `secrets:get:\u003cname\u003e` + "`" + ` for each secret. Secret\nvalues are redacted from the task log, and secret files are deleted\nwhen the task ends. Secrets require the ` + "`" + `secrets` + "`" + ` feature to be enabled\nin the worker config.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "env": {
+            "description": "The name of the environment variable to inject the secret as.\nExactly one of ` + "`" + `env` + "`" + ` and ` + "`" + `file` + "`" + ` must be set.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]*$",
+            "title": "Environment variable",
+            "type": "string"
+          },
+          "file": {
+            "description": "The path, relative to the task directory, of the file to write\nthe secret to. The file is only readable by the task user.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "File",
+            "type": "string"
+          },
+          "key": {
+            "description": "The property of the secret value to inject. If not set, the whole\nsecret value is injected as JSON. String properties are injected\nas is, other properties as JSON.\n\nSince: generic-worker 28.1.0",
+            "title": "Secret key",
+            "type": "string"
+          },
+          "name": {
+            "description": "The name of the secret in the taskcluster secrets service.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Secret name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Secret",
+        "type": "object"
+      },
+      "title": "Secrets to inject into the task",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "supersederUrl": {
+      "description": "URL of a service that can indicate tasks superseding this one; the current ` + "`" + `taskId` + "`" + `\nwill be appended as a query argument ` + "`" + `taskId` + "`" + `. The service should return an object with\na ` + "`" + `supersedes` + "`" + ` key containing a list of ` + "`" + `taskId` + "`" + `s, including the supplied ` + "`" + `taskId` + "`" + `. The\ntasks should be ordered such that each task supersedes all tasks appearing later in the\nlist.\n\nSee [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.\n\nSince: generic-worker 10.2.2",
+      "format": "uri",
+      "title": "Superseder URL",
+      "type": "string"
+    },
+    "writeFiles": {
+      "description": "Files to create in the task directory before the task commands run,\nwith inline content, which avoids quoting file content in the task\ncommands, whose quoting rules differ between shells and platforms.\nParent directories are created as needed, and existing files are\nreplaced.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "base64": {
+            "contentEncoding": "base64",
+            "description": "The content of the file, base64 encoded, for binary content. At\nmost one of ` + "`" + `content` + "`" + ` and ` + "`" + `base64` + "`" + ` may be set.\n\nSince: generic-worker 28.1.0",
+            "title": "Base64 encoded content",
+            "type": "string"
+          },
+          "content": {
+            "description": "The content of the file, as UTF-8 text. At most one of ` + "`" + `content` + "`" + `\nand ` + "`" + `base64` + "`" + ` may be set, and the file is empty if neither is.\n\nSince: generic-worker 28.1.0",
+            "title": "Content",
+            "type": "string"
+          },
+          "mode": {
+            "default": "0644",
+            "description": "The permissions of the file, in octal, e.g. ` + "`" + `\"0755\"` + "`" + ` for an\nexecutable script. Ignored on Windows.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^0?[0-7]{3}$",
+            "title": "File mode",
+            "type": "string"
+          },
+          "path": {
+            "description": "The path, relative to the task directory, of the file to write.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          }
+        },
+        "required": [
+          "path"
+        ],
+        "title": "File to write",
+        "type": "object"
+      },
+      "title": "Files to write",
+      "type": "array",
+      "uniqueItems": true
+    }
+  },
+  "required": [
+    "command",
+    "image",
+    "maxRunTime"
+  ],
+  "title": "Generic worker payload",
+  "type": "object"
+}`
+}
@@ -80,6 +80,18 @@ type (
 		// Since: generic-worker 1.0.0
 		Path string `json:"path"`
 
+		// If `true`, the artifact is scope-protected, so its `name` (or `path`, if `name` is not
+		// set) must not begin `public/`. Downloading the artifact requires scope
+		// `queue:get-artifact:<name>` (for a `directory` artifact, `queue:get-artifact:<name>/*`),
+		// which the task must also have, so that the task can grant it to the tasks that consume
+		// the artifact. Note, on workers with config setting `forcePrivateArtifacts` enabled, all
+		// artifact names beginning `public/` are published beginning `private/` instead.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Private bool `json:"private,omitempty"`
+
 		// Artifacts can be either an individual `file` or a `directory` containing
 		// potentially multiple files with recursively included subdirectories.
 		//
@@ -110,6 +122,48 @@ type (
 		TaskID string `json:"taskId"`
 	}
 
+	ArtifactToSign struct {
+
+		// The ID of the signing key of the worker to sign the artifact with.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z0-9_.-]+$
+		Key string `json:"key"`
+
+		// The name of an artifact of `task.payload.artifacts` that is a file,
+		// such as `public/build/target.mar`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Name string `json:"name"`
+	}
+
+	// Rate limits for transfers made by the worker on behalf of this task.
+	// These apply in addition to any limits configured for the worker as a
+	// whole (config settings `maxDownloadBytesPerSec` and
+	// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+	//
+	// Since: generic-worker 28.1.0
+	BandwidthLimits struct {
+
+		// Maximum number of bytes per second to download for mounts and
+		// fetches.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxDownloadBytesPerSec int64 `json:"maxDownloadBytesPerSec,omitempty"`
+
+		// Maximum number of bytes per second to upload for artifacts.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxUploadBytesPerSec int64 `json:"maxUploadBytesPerSec,omitempty"`
+	}
+
 	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
 	//
 	// Since: generic-worker 11.1.0
@@ -124,12 +178,147 @@ type (
 		Base64 string `json:"base64"`
 	}
 
+	CommandRetryPolicy struct {
+
+		// The number of seconds to wait before the second attempt of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    3600
+		BackoffSeconds int64 `json:"backoffSeconds,omitempty"`
+
+		// The zero-based index of the task command that the policy applies
+		// to. Each command may have at most one policy.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		Command int64 `json:"command"`
+
+		// Exit codes that cause the command to be retried. If not
+		// specified, any failure of the command causes it to be retried.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// The maximum number of times the command is run, including the
+		// first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    2
+		// Maximum:    10
+		MaxAttempts int64 `json:"maxAttempts"`
+
+		// The maximum number of seconds to wait between attempts of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    300
+		// Mininum:    1
+		// Maximum:    3600
+		MaxBackoffSeconds int64 `json:"maxBackoffSeconds,omitempty"`
+	}
+
+	// Display settings that the desktop of the task user is configured with
+	// before the task commands run, for GUI tests that depend on them. The
+	// settings are verified after they are applied, and the task is resolved
+	// as `exception` with reason `malformed-payload` if the display adapter
+	// doesn't support them. The original settings are restored when the
+	// task commands complete.
+	//
+	// Since: generic-worker 28.1.0
+	DisplaySettings struct {
+
+		// The color depth of the primary display, in bits per pixel.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * 16
+		//   * 24
+		//   * 32
+		ColorDepth int64 `json:"colorDepth,omitempty"`
+
+		// The logical DPI of the task user. 96 is 100% scaling, 120 is 125%,
+		// 144 is 150% and 192 is 200%. Windows applies DPI changes to
+		// applications that start after the change, but some parts of the
+		// desktop only apply them on the next logon, so a warning is logged
+		// if the DPI of the logon session doesn't match after the change.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * 96
+		//   * 120
+		//   * 144
+		//   * 168
+		//   * 192
+		Dpi int64 `json:"dpi,omitempty"`
+
+		// The vertical resolution of the primary display, in pixels.
+		// Requires `width`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    480
+		// Maximum:    4320
+		Height int64 `json:"height,omitempty"`
+
+		// The horizontal resolution of the primary display, in pixels.
+		// Requires `height`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    640
+		// Maximum:    7680
+		Width int64 `json:"width,omitempty"`
+	}
+
+	ExceptionMapping struct {
+
+		// The exit codes that cause the task to be resolved as
+		// exception with this reason.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes"`
+
+		// The reason to resolve the task with.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "internal-error"
+		//   * "malformed-payload"
+		//   * "resource-unavailable"
+		Reason string `json:"reason"`
+	}
+
 	// By default tasks will be resolved with `state/reasonResolved`: `completed/completed`
 	// if all task commands have a zero exit code, or `failed/failed` if any command has a
 	// non-zero exit code. This payload property allows customsation of the task resolution
 	// based on exit code of task commands.
 	ExitCodeHandling struct {
 
+		// Exit codes for any command in the task payload to cause this task to
+		// be resolved as `exception`, with the given reason, for example so
+		// that a test harness that detects a problem with the worker can
+		// resolve the task as `exception/resource-unavailable`, rather than
+		// `failed/failed`. Use `retry` for `exception/intermittent-task`.
+		//
+		// Since: generic-worker 28.1.0
+		Exception []ExceptionMapping `json:"exception,omitempty"`
+
 		// Exit codes for any command in the task payload to cause this task to
 		// be resolved as `exception/intermittent-task`. Typically the Queue
 		// will then schedule a new run of the existing `taskId` (rerun) if not
@@ -142,6 +331,18 @@ type (
 		// Array items:
 		// Mininum:    1
 		Retry []int64 `json:"retry,omitempty"`
+
+		// Exit codes for any command in the task payload to be treated as
+		// success (with a warning in the task log), so that subsequent task
+		// commands are run, and if they succeed, the task is resolved as
+		// `completed/completed`. Commands that exit with these exit codes
+		// are not retried by `retryPolicies`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		Success []int64 `json:"success,omitempty"`
 	}
 
 	// Feature flags enable additional functionality.
@@ -149,6 +350,19 @@ type (
 	// Since: generic-worker 5.3.0
 	FeatureFlags struct {
 
+		// If enabled, the Android emulator configured on the worker is booted
+		// from its snapshot before the task commands run, and shut down
+		// without saving its state after they complete, so that each task
+		// starts from the same snapshot. The environment variables
+		// `ANDROID_SERIAL`, `ANDROID_ADB_SERVER_PORT` and
+		// `ANDROID_EMULATOR_CONSOLE_PORT` are set for the task commands, so
+		// that `adb` connects to the emulator. The emulator log (logcat) is
+		// published as artifact `public/logs/logcat.txt`. Requires scope
+		// `generic-worker:android-emulator:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		AndroidEmulator bool `json:"androidEmulator,omitempty"`
+
 		// Artifacts named `public/chain-of-trust.json` and
 		// `public/chain-of-trust.json.sig` should be generated which will
 		// include information for downstream tasks to build a level of trust
@@ -157,6 +371,68 @@ type (
 		// Since: generic-worker 5.3.0
 		ChainOfTrust bool `json:"chainOfTrust,omitempty"`
 
+		// If enabled, the operating system is configured so that any task
+		// process that crashes writes a dump (a minidump via Windows Error
+		// Reporting on Windows, a core file via `core_pattern` on Linux, or a
+		// core file and ReportCrash report on macOS) to a directory that is
+		// collected by the worker when the task commands complete. Dumps are
+		// published as artifacts named
+		// `public/crashdumps/<executable>.<pid>.<timestamp>.<extension>` so
+		// that they can be matched to symbols for the crashing executable.
+		//
+		// Since: generic-worker 28.1.0
+		CrashDumps bool `json:"crashDumps,omitempty"`
+
+		// If enabled, task commands run without network access, for example
+		// to verify that a build is hermetic. Outbound connections of the task
+		// user are blocked by a Windows Firewall rule for the duration of the
+		// task, so attempts to use the network fail straight away. Not
+		// supported if worker config setting `runTasksAsCurrentUser` is
+		// enabled, or if worker config setting `taskIsolation` is set. The
+		// worker config setting `disableNetwork` enables this for all tasks.
+		//
+		// Since: generic-worker 28.1.0
+		DisableNetwork bool `json:"disableNetwork,omitempty"`
+
+		// If enabled, the template expressions in the arguments of `command`,
+		// the values of `env`, and the `path` of each of `artifacts` are
+		// expanded when the task starts (see the description of the payload).
+		// Without it, text such as `{{taskId}}` is passed to the task as is.
+		//
+		// Since: generic-worker 28.1.0
+		PayloadTemplates bool `json:"payloadTemplates,omitempty"`
+
+		// If enabled, task commands can report the progress of the task by
+		// POSTing JSON such as
+		// `{"percentage": 42.5, "step": "Linking", "eta": "2020-06-01T14:30:00.000Z"}`
+		// to the URL in environment variable `TASKCLUSTER_PROGRESS_URL`, where
+		// `percentage` (between 0 and 100) is required and `step` and `eta`
+		// (when the task expects to complete) are optional. The latest report
+		// is published as artifact `public/progress.json`, which is updated
+		// every `progressUpdateIntervalSecs` seconds (a worker config setting)
+		// while the task runs, and once more when the task commands complete,
+		// so that dashboards can show the progress of long running tasks.
+		//
+		// Since: generic-worker 28.1.0
+		Progress bool `json:"progress,omitempty"`
+
+		// If enabled, the worker computes a hash of the task payload together
+		// with the SHA256 of all content mounted or fetched into the task
+		// directory. If an earlier task with the same hash completed
+		// successfully on this worker type, the task commands are not run, and
+		// instead the artifacts of the earlier task are re-exposed as redirect
+		// artifacts, and the task resolves as completed. Otherwise, if the task
+		// completes successfully, it is recorded in the index under namespace
+		// `generic-worker.result-cache.<provisionerId>.<workerType>.<hash>` for
+		// future tasks to reuse. The hash also covers the scopes and routes of
+		// the task. Only enable this for deterministic tasks.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:result-cache:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		ResultCache bool `json:"resultCache,omitempty"`
+
 		// Runs commands with UAC elevation. Only set to true when UAC is
 		// enabled on the worker and Administrative privileges are required by
 		// task commands. When UAC is disabled on the worker, task commands will
@@ -185,8 +461,87 @@ type (
 		TaskclusterProxy bool `json:"taskclusterProxy,omitempty"`
 	}
 
+	// An artifact of an upstream task to download. Exactly one of `taskId`
+	// and `namespace` must be provided.
+	//
+	// Since: generic-worker 28.1.0
+	Fetch struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// The name of the artifact to download from the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 1024
+		Artifact string `json:"artifact"`
+
+		// If provided, the artifact is treated as an archive of the given
+		// format, and is extracted into `path`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format,omitempty"`
+
+		// An index namespace (e.g. `project.example.latest.linux64`) which
+		// is resolved to a `taskId` via the index service when the task
+		// starts. The resolved `taskId` is recorded, together with the SHA256
+		// of the fetched content, in the artifact `public/resolved-fetches.json`
+		// and in the chain of trust certificate (if enabled).
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 255
+		Namespace string `json:"namespace,omitempty"`
+
+		// The location, relative to the task directory, to place the artifact.
+		// If `format` is provided, this is the directory into which the
+		// artifact is extracted, otherwise it is the file the artifact is
+		// copied to.
+		//
+		// Since: generic-worker 28.1.0
+		Path string `json:"path"`
+
+		// The required SHA 256 of the artifact content.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// The `taskId` of the task that published the artifact.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$
+		TaskID string `json:"taskId,omitempty"`
+	}
+
 	FileMount struct {
 
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// One of:
 		//   * ArtifactContent
 		//   * URLContent
@@ -200,15 +555,94 @@ type (
 		File string `json:"file"`
 	}
 
+	FileToWrite struct {
+
+		// The content of the file, base64 encoded, for binary content. At
+		// most one of `content` and `base64` may be set.
+		//
+		// Since: generic-worker 28.1.0
+		Base64 string `json:"base64,omitempty"`
+
+		// The content of the file, as UTF-8 text. At most one of `content`
+		// and `base64` may be set, and the file is empty if neither is.
+		//
+		// Since: generic-worker 28.1.0
+		Content string `json:"content,omitempty"`
+
+		// The permissions of the file, in octal, e.g. `"0755"` for an
+		// executable script. Ignored on Windows.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "0644"
+		// Syntax:     ^0?[0-7]{3}$
+		Mode string `json:"mode,omitempty"`
+
+		// The path, relative to the task directory, of the file to write.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Path string `json:"path"`
+	}
+
 	// This schema defines the structure of the `payload` property referred to in a
 	// Taskcluster Task definition.
+	//
+	// If `features.payloadTemplates` is enabled, the arguments of `command`, the
+	// values of `env`, and the `path` of each of `artifacts` may contain template
+	// expressions, which the worker expands when the task starts:
+	//
+	//   * `{{taskId}}`, `{{runId}}` and `{{taskGroupId}}` - the IDs of the task
+	//   * `{{workerGroup}}`, `{{workerId}}` and `{{workerPoolId}}` - the IDs of the
+	//     worker
+	//   * `{{cachePath "<cacheName>"}}` - the `directory` of the writable
+	//     directory cache mount with cache name `<cacheName>`
+	//   * `{{fetchPath "<artifact>"}}` - the `path` of the fetch of the artifact
+	//     with name (or base name) `<artifact>`
+	//
+	// Paths are relative to the task directory. Other text between `{{` and `}}`
+	// is left as is.
+	//
+	// Since: generic-worker 28.1.0
 	GenericWorkerPayload struct {
 
+		// Settings for publishing artifact `public/annotations.json`, which
+		// summarizes the errors and warnings of the task, so that CI user
+		// interfaces can show them without parsing the task log. When the task
+		// commands complete, each line of the task log is matched against
+		// `errorPatterns` and `warningPatterns`, TAP output is parsed if `tap` is
+		// enabled, and the JUnit XML reports listed in `junitReports` are parsed.
+		// Annotations found in the task log have the line number and byte offset
+		// of the line in artifact `public/logs/live_backing.log`. At most 1000
+		// annotations are published, although all are counted.
+		//
+		// Since: generic-worker 28.1.0
+		Annotations TaskAnnotations `json:"annotations,omitempty"`
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// Artifacts to be published.
 		//
 		// Since: generic-worker 1.0.0
 		Artifacts []Artifact `json:"artifacts,omitempty"`
 
+		// Rate limits for transfers made by the worker on behalf of this task.
+		// These apply in addition to any limits configured for the worker as a
+		// whole (config settings `maxDownloadBytesPerSec` and
+		// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+		//
+		// Since: generic-worker 28.1.0
+		BandwidthLimits BandwidthLimits `json:"bandwidthLimits,omitempty"`
+
 		// One entry per command (consider each entry to be interpreted as a full line of
 		// a Windows™ .bat file). For example:
 		// ```
@@ -224,6 +658,29 @@ type (
 		// Array items:
 		Command []string `json:"command"`
 
+		// The Windows container that the task commands run in, on workers with
+		// config setting `taskIsolation` set to `windowsContainer`. Required on
+		// such workers, and not supported on any others. The image is pulled if
+		// needed, and must be compatible with the kernel of the worker: with
+		// `process` isolation the image must have the same Windows build number
+		// as the worker, and with `hyperv` isolation it must not have a later
+		// build number. The task directory (including mounted caches and
+		// fetched content) is mounted into the container at the same path, and
+		// the output of the task commands is streamed to the task log as usual.
+		//
+		// Since: generic-worker 28.1.0
+		Container WindowsContainer `json:"container,omitempty"`
+
+		// Display settings that the desktop of the task user is configured with
+		// before the task commands run, for GUI tests that depend on them. The
+		// settings are verified after they are applied, and the task is resolved
+		// as `exception` with reason `malformed-payload` if the display adapter
+		// doesn't support them. The original settings are restored when the
+		// task commands complete.
+		//
+		// Since: generic-worker 28.1.0
+		Display DisplaySettings `json:"display,omitempty"`
+
 		// Env vars must be string to __string__ mappings (not number or boolean). For example:
 		// ```
 		// {
@@ -262,6 +719,32 @@ type (
 		// Since: generic-worker 5.3.0
 		Features FeatureFlags `json:"features,omitempty"`
 
+		// Artifacts of upstream tasks to be downloaded before the task commands
+		// run. Each fetch refers to an artifact of a task, identified either
+		// directly by `taskId`, or indirectly by an index `namespace` which is
+		// resolved to a `taskId` when the task starts. Fetches are downloaded in
+		// parallel, retried on transient failures, verified against `sha256` (if
+		// provided) and cached on the worker between tasks, in the same way as
+		// file mounts.
+		//
+		// Tasks referenced by `taskId` must be listed in `task.dependencies`.
+		// Fetching a non-public artifact (i.e. not starting with `public/`)
+		// requires scope `queue:get-artifact:<artifact-name>`.
+		//
+		// Since: generic-worker 28.1.0
+		Fetches []Fetch `json:"fetches,omitempty"`
+
+		// The maximum total size in megabytes of the artifacts of
+		// `task.payload.artifacts`. If the artifacts are larger, none of them
+		// are uploaded, and the task resolves as failed, listing its largest
+		// artifacts. This applies in addition to any limit configured for the
+		// worker (config setting `maxTaskArtifactsMB`), so can only lower it.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxArtifactsMB int64 `json:"maxArtifactsMB,omitempty"`
+
 		// Maximum time the task container can run in seconds.
 		//
 		// Since: generic-worker 0.0.1
@@ -296,6 +779,77 @@ type (
 		// Array items:
 		OSGroups []string `json:"osGroups,omitempty"`
 
+		// The encoding of the output of the task commands, which is converted to
+		// UTF-8 in the task log:
+		//
+		//   * `auto`: output that starts with a UTF-16 byte order mark, or looks
+		//     like ASCII encoded as UTF-16, is UTF-16LE, e.g. the output of
+		//     `cmd /u`. Other output is UTF-8, until it is not valid UTF-8, after
+		//     which it is in the OEM code page, which console programs such as
+		//     `cmd` write output in by default. This is suitable for most
+		//     localized Windows images.
+		//   * `utf-8`: output is UTF-8, e.g. after `chcp 65001`.
+		//   * `utf-16le`: output is UTF-16 little endian.
+		//   * `oem`: output is in the OEM code page of the worker.
+		//   * `ansi`: output is in the ANSI code page of the worker.
+		//
+		// Output that is not valid in its encoding is replaced, and a warning is
+		// written to the task log after the command that wrote it.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "auto"
+		//   * "utf-8"
+		//   * "utf-16le"
+		//   * "oem"
+		//   * "ansi"
+		//
+		// Default:    "auto"
+		OutputEncoding string `json:"outputEncoding,omitempty"`
+
+		// Captures Windows performance counters and/or an ETW trace for the
+		// duration of the task commands, to help diagnose machine-level noise
+		// (for example in benchmark pools). Counters are sampled with `logman`
+		// and published as artifact `public/performance/counters.csv`. ETW traces
+		// are recorded with Windows Performance Recorder (`wpr`) and published as
+		// artifact `public/performance/trace.etl`.
+		//
+		// Failure to start or stop a capture does not affect the task
+		// resolution; a warning is written to the task log instead.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:performance-capture:<provisionerId>/<workerType>` since
+		// the captured data covers all processes running on the worker.
+		//
+		// Since: generic-worker 28.1.0
+		PerformanceCapture PerformanceCapture `json:"performanceCapture,omitempty"`
+
+		// Groups the task commands into named phases (for example `setup`,
+		// `build`, `test` and `package`), each of which is a run of
+		// consecutive commands. The numbers of commands of the phases must add
+		// up to the number of task commands. The worker writes
+		// Treeherder-compatible step markers to the task log at the start and
+		// end of each phase, and publishes the duration and outcome of each
+		// phase as artifact `public/phases.json`. Phases whose commands did not
+		// all run (because an earlier command failed, or the task was aborted)
+		// are reported with state `failed`, `aborted` or `skipped`.
+		//
+		// Since: generic-worker 28.1.0
+		Phases []Phase `json:"phases,omitempty"`
+
+		// Ports that the worker leases to the task for the duration of the task,
+		// each exposed to the task commands (and to any services) in an
+		// environment variable. Leased ports are taken from the worker's
+		// configured port lease range, and are not leased to any other task on
+		// the same host (including tasks of other workers that share the same
+		// `portLeasesDir`) until the task resolves. Use this instead of
+		// hard-coded port numbers to avoid clashes between concurrent tasks. The
+		// leased ports are listed in the task log.
+		//
+		// Since: generic-worker 28.1.0
+		PortLeases []PortLease `json:"portLeases,omitempty"`
+
 		// Specifies an artifact name for publishing RDP connection information.
 		//
 		// Since this is potentially sensitive data, care should be taken to publish
@@ -324,6 +878,115 @@ type (
 		// Since: generic-worker 10.5.0
 		RdpInfo string `json:"rdpInfo,omitempty"`
 
+		// Settings for tasks that produce reproducible artifacts. Environment
+		// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+		// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+		// in `env`. The resolved settings are listed in the task log, and are
+		// recorded in the chain of trust certificate of the task (if the
+		// `chainOfTrust` feature is enabled).
+		//
+		// Since: generic-worker 28.1.0
+		Reproducible ReproducibleBuildEnvironment `json:"reproducible,omitempty"`
+
+		// Names of artifacts that the task must publish in order to resolve
+		// successfully, such as `public/build/target.tar.gz`. If any of them was
+		// not uploaded (for example because the file of an artifact of
+		// `task.payload.artifacts` does not exist, so an error artifact was
+		// uploaded instead) the task resolves as failed, listing the missing
+		// artifacts. This protects against tasks that succeed without producing
+		// their outputs.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    []
+		//
+		// Array items:
+		RequiredArtifacts []string `json:"requiredArtifacts,omitempty"`
+
+		// Policy for rerunning all of the task commands, from the first command,
+		// when the task fails with a known intermittent failure signature, so
+		// that intermittent failures don't need a new task run (and worker) to
+		// be retried. A task fails with a failure signature if the failing
+		// command exits with one of `exitCodes`, or if a line of the output of
+		// the failed attempt matches one of `logPatterns`. The task is rerun at
+		// most `maxReruns` times, after which it is resolved as `failed`. Each
+		// attempt is logged in its own section of the task log, and reported
+		// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+		// directory, so the task commands need to cope with files left behind
+		// by earlier attempts. Time spent rerunning counts towards
+		// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+		// and `onExitStatus.retry`, which resolves the task as
+		// `exception/intermittent-task` so that the queue creates a new run,
+		// reruns happen within the same run.
+		//
+		// Since: generic-worker 28.1.0
+		Rerun TaskRerunPolicy `json:"rerun,omitempty"`
+
+		// Policies for retrying task commands that fail transiently (for
+		// example because of flaky network operations), so that task scripts
+		// don't need their own retry loops. A task command that has a retry
+		// policy, and fails, is run again after a delay, until it succeeds or
+		// has been attempted `maxAttempts` times. The delay is `backoffSeconds`
+		// before the second attempt, and doubles before each further attempt,
+		// up to `maxBackoffSeconds`. Time spent retrying counts towards
+		// `maxRunTime`. Only the result of the final attempt of a command
+		// determines the outcome of the task (including `onExitStatus`
+		// handling).
+		//
+		// Since: generic-worker 28.1.0
+		RetryPolicies []CommandRetryPolicy `json:"retryPolicies,omitempty"`
+
+		// Publishes a software bill of materials (SBOM) of the task when the task
+		// commands complete, as artifact `public/sbom.cdx.json` (CycloneDX 1.4)
+		// or `public/sbom.spdx.json` (SPDX 2.3). The SBOM lists the content
+		// mounted or fetched into the task, such as toolchains, with its SHA 256,
+		// and the packages listed in `manifests`. On workers with chain of trust
+		// enabled, the SBOM is covered by the chain of trust certificate of the
+		// task, like any other artifact.
+		//
+		// Since: generic-worker 28.1.0
+		Sbom SoftwareBillOfMaterials `json:"sbom,omitempty"`
+
+		// Captures the task user's desktop when a task command fails or the task
+		// is aborted (for example because `maxRunTime` was exceeded), to help
+		// diagnose failing GUI tests. When the task is aborted, the capture is
+		// taken before task processes are killed. Captures are only published
+		// if the task does not complete successfully.
+		//
+		// Screenshots are published as artifact
+		// `public/screencapture/screenshot.png`. Recordings are published as
+		// artifacts `public/screencapture/recording-<n>.ts` (MPEG transport
+		// stream segments of ten seconds each, in chronological order).
+		// Recording requires `ffmpeg` to be installed on the worker.
+		//
+		// Since: generic-worker 28.1.0
+		ScreenCapture ScreenCapture `json:"screenCapture,omitempty"`
+
+		// Secrets from the taskcluster secrets service to inject into the task,
+		// as environment variables of the task commands, or as files in the task
+		// directory. The worker fetches the secrets with the task credentials, so
+		// the task requires scope `secrets:get:<name>` for each secret. Secret
+		// values are redacted from the task log, and secret files are deleted
+		// when the task ends. Secrets require the `secrets` feature to be enabled
+		// in the worker config.
+		//
+		// Since: generic-worker 28.1.0
+		Secrets []Secret `json:"secrets,omitempty"`
+
+		// Artifacts that the worker signs, once they have been uploaded, with a
+		// signing key that it holds (see worker config setting
+		// `artifactSigningKeys`), so that release signing can run on dedicated
+		// worker pools without the keys ever being available to tasks. For each
+		// artifact, a detached signature of its content (ed25519, unless the key
+		// is held by a signing command) is published as artifact `<name>.sig`,
+		// if the task commands succeed. Requires scope
+		// `generic-worker:signing-key:<provisionerId>/<workerType>/<key>` for
+		// each key used. On workers with chain of trust enabled, the chain of
+		// trust certificate of the task records the key ID of each signature.
+		//
+		// Since: generic-worker 28.1.0
+		SignArtifacts []ArtifactToSign `json:"signArtifacts,omitempty"`
+
 		// URL of a service that can indicate tasks superseding this one; the current `taskId`
 		// will be appended as a query argument `taskId`. The service should return an object with
 		// a `supersedes` key containing a list of `taskId`s, including the supplied `taskId`. The
@@ -334,6 +997,125 @@ type (
 		//
 		// Since: generic-worker 10.2.2
 		SupersederURL string `json:"supersederUrl,omitempty"`
+
+		// If true, each line that the task commands write to the task log is
+		// prefixed with the output stream that it was written to, `[stdout] ` or
+		// `[stderr] `. Otherwise both streams share a single pipe, so output is
+		// written to the task log in exactly the order that it was written.
+		// Tagged streams have a pipe each, and are written to the task log in
+		// the order that the worker reads them, so output written to both
+		// streams within microseconds of each other may be reordered. A line
+		// that is still incomplete when the other stream is written to is
+		// ended, so that every line has a single source.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		TagOutputStreams bool `json:"tagOutputStreams,omitempty"`
+
+		// JUnit (or XUnit) XML reports of the task to summarize. When the task
+		// commands complete, the reports matching `paths` are parsed, and
+		// artifact `public/test-results.json` is published with the number of
+		// tests that passed, failed, errored and were skipped, the slowest
+		// tests, and the failed tests, which are also listed in the task log.
+		//
+		// Since: generic-worker 28.1.0
+		TestResults TestResults `json:"testResults,omitempty"`
+
+		// Files to create in the task directory before the task commands run,
+		// with inline content, which avoids quoting file content in the task
+		// commands, whose quoting rules differ between shells and platforms.
+		// Parent directories are created as needed, and existing files are
+		// replaced.
+		//
+		// Since: generic-worker 28.1.0
+		WriteFiles []FileToWrite `json:"writeFiles,omitempty"`
+	}
+
+	// Captures Windows performance counters and/or an ETW trace for the
+	// duration of the task commands, to help diagnose machine-level noise
+	// (for example in benchmark pools). Counters are sampled with `logman`
+	// and published as artifact `public/performance/counters.csv`. ETW traces
+	// are recorded with Windows Performance Recorder (`wpr`) and published as
+	// artifact `public/performance/trace.etl`.
+	//
+	// Failure to start or stop a capture does not affect the task
+	// resolution; a warning is written to the task log instead.
+	//
+	// Use of this feature requires scope
+	// `generic-worker:performance-capture:<provisionerId>/<workerType>` since
+	// the captured data covers all processes running on the worker.
+	//
+	// Since: generic-worker 28.1.0
+	PerformanceCapture struct {
+
+		// Performance counter paths to sample, for example
+		// `\Processor(_Total)\% Processor Time` or
+		// `\PhysicalDisk(_Total)\Avg. Disk Queue Length`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		Counters []string `json:"counters,omitempty"`
+
+		// If set, the Windows Performance Recorder profile to record an ETW
+		// trace with, for example `GeneralProfile`, `CPU` or `DiskIO`. See
+		// `wpr -profiles` for the available profiles.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[A-Za-z][A-Za-z0-9._-]*$
+		EtwProfile string `json:"etwProfile,omitempty"`
+
+		// How often to sample performance counters, in seconds.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    1
+		// Mininum:    1
+		// Maximum:    3600
+		SampleInterval int64 `json:"sampleInterval,omitempty"`
+	}
+
+	Phase struct {
+
+		// The number of consecutive task commands in the phase, following
+		// the commands of the previous phases.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		Commands int64 `json:"commands"`
+
+		// The name of the phase, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		// Max length: 100
+		Name string `json:"name"`
+	}
+
+	PortLease struct {
+
+		// The name of the environment variable that holds the leased port
+		// number, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]{0,63}$
+		Name string `json:"name"`
+
+		// The protocol that the port must be free for.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "tcp"
+		//   * "udp"
+		//
+		// Default:    "tcp"
+		Protocol string `json:"protocol,omitempty"`
 	}
 
 	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
@@ -351,6 +1133,16 @@ type (
 
 	ReadOnlyDirectory struct {
 
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// One of:
 		//   * ArtifactContent
 		//   * URLContent
@@ -375,7 +1167,270 @@ type (
 		Format string `json:"format"`
 	}
 
-	// URL to download content from.
+	// Settings for tasks that produce reproducible artifacts. Environment
+	// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+	// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+	// in `env`. The resolved settings are listed in the task log, and are
+	// recorded in the chain of trust certificate of the task (if the
+	// `chainOfTrust` feature is enabled).
+	//
+	// Since: generic-worker 28.1.0
+	ReproducibleBuildEnvironment struct {
+
+		// The value of `LANG` and `LC_ALL`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "C.UTF-8"
+		Locale string `json:"locale,omitempty"`
+
+		// The value of `SOURCE_DATE_EPOCH`, in seconds since the Unix epoch.
+		// If not specified (or 0), the creation time of the task is used, so
+		// that reruns of the task use the same value.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		SourceDateEpoch int64 `json:"sourceDateEpoch,omitempty"`
+
+		// The value of `TZ`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "UTC"
+		Timezone string `json:"timezone,omitempty"`
+	}
+
+	// Captures the task user's desktop when a task command fails or the task
+	// is aborted (for example because `maxRunTime` was exceeded), to help
+	// diagnose failing GUI tests. When the task is aborted, the capture is
+	// taken before task processes are killed. Captures are only published
+	// if the task does not complete successfully.
+	//
+	// Screenshots are published as artifact
+	// `public/screencapture/screenshot.png`. Recordings are published as
+	// artifacts `public/screencapture/recording-<n>.ts` (MPEG transport
+	// stream segments of ten seconds each, in chronological order).
+	// Recording requires `ffmpeg` to be installed on the worker.
+	//
+	// Since: generic-worker 28.1.0
+	ScreenCapture struct {
+
+		// If greater than zero, the desktop is recorded while task commands
+		// run, keeping (approximately) the given number of seconds of the
+		// most recent recording, which is published if the task does not
+		// complete successfully.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		// Maximum:    600
+		RecordingSeconds int64 `json:"recordingSeconds,omitempty"`
+
+		// Take a screenshot of the desktop when a task command fails or the
+		// task is aborted.
+		//
+		// Since: generic-worker 28.1.0
+		Screenshot bool `json:"screenshot,omitempty"`
+	}
+
+	Secret struct {
+
+		// The name of the environment variable to inject the secret as.
+		// Exactly one of `env` and `file` must be set.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]*$
+		Env string `json:"env,omitempty"`
+
+		// The path, relative to the task directory, of the file to write
+		// the secret to. The file is only readable by the task user.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		File string `json:"file,omitempty"`
+
+		// The property of the secret value to inject. If not set, the whole
+		// secret value is injected as JSON. String properties are injected
+		// as is, other properties as JSON.
+		//
+		// Since: generic-worker 28.1.0
+		Key string `json:"key,omitempty"`
+
+		// The name of the secret in the taskcluster secrets service.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Name string `json:"name"`
+	}
+
+	// Publishes a software bill of materials (SBOM) of the task when the task
+	// commands complete, as artifact `public/sbom.cdx.json` (CycloneDX 1.4)
+	// or `public/sbom.spdx.json` (SPDX 2.3). The SBOM lists the content
+	// mounted or fetched into the task, such as toolchains, with its SHA 256,
+	// and the packages listed in `manifests`. On workers with chain of trust
+	// enabled, the SBOM is covered by the chain of trust certificate of the
+	// task, like any other artifact.
+	//
+	// Since: generic-worker 28.1.0
+	SoftwareBillOfMaterials struct {
+
+		// The format of the SBOM.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "cyclonedx"
+		//   * "spdx"
+		Format string `json:"format"`
+
+		// Paths, relative to the task directory, of package manifests that
+		// the task commands write, for example while installing packages.
+		// Each manifest is a JSON array of packages, each with a `name`, and
+		// optionally a `version` and [package URL](https://github.com/package-url/purl-spec)
+		// (`purl`), e.g. `[{"name": "requests", "version": "2.25.1", "purl": "pkg:pypi/requests@2.25.1"}]`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Manifests []string `json:"manifests,omitempty"`
+	}
+
+	// Settings for publishing artifact `public/annotations.json`, which
+	// summarizes the errors and warnings of the task, so that CI user
+	// interfaces can show them without parsing the task log. When the task
+	// commands complete, each line of the task log is matched against
+	// `errorPatterns` and `warningPatterns`, TAP output is parsed if `tap` is
+	// enabled, and the JUnit XML reports listed in `junitReports` are parsed.
+	// Annotations found in the task log have the line number and byte offset
+	// of the line in artifact `public/logs/live_backing.log`. At most 1000
+	// annotations are published, although all are counted.
+	//
+	// Since: generic-worker 28.1.0
+	TaskAnnotations struct {
+
+		// Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))
+		// that lines of the task log which report errors match.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		ErrorPatterns []string `json:"errorPatterns,omitempty"`
+
+		// Paths, relative to the task directory, of JUnit XML reports that the
+		// task commands write. Each test case with a failure or error is
+		// reported as an error. Missing reports are noted in the task log,
+		// but don't fail the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		JunitReports []string `json:"junitReports,omitempty"`
+
+		// If true, [TAP](https://testanything.org/) test results in the task
+		// log are parsed, and each failed test (`not ok`, unless marked
+		// `# TODO` or `# SKIP`) and `Bail out!` is reported as an error.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Tap bool `json:"tap,omitempty"`
+
+		// Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))
+		// that lines of the task log which report warnings match. Lines that
+		// match one of `errorPatterns` are not also reported as warnings.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		WarningPatterns []string `json:"warningPatterns,omitempty"`
+	}
+
+	// Policy for rerunning all of the task commands, from the first command,
+	// when the task fails with a known intermittent failure signature, so
+	// that intermittent failures don't need a new task run (and worker) to
+	// be retried. A task fails with a failure signature if the failing
+	// command exits with one of `exitCodes`, or if a line of the output of
+	// the failed attempt matches one of `logPatterns`. The task is rerun at
+	// most `maxReruns` times, after which it is resolved as `failed`. Each
+	// attempt is logged in its own section of the task log, and reported
+	// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+	// directory, so the task commands need to cope with files left behind
+	// by earlier attempts. Time spent rerunning counts towards
+	// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+	// and `onExitStatus.retry`, which resolves the task as
+	// `exception/intermittent-task` so that the queue creates a new run,
+	// reruns happen within the same run.
+	//
+	// Since: generic-worker 28.1.0
+	TaskRerunPolicy struct {
+
+		// Exit codes that cause the task commands to be rerun, if a task
+		// command exits with them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// Regular expressions (in Go syntax) that cause the task commands to
+		// be rerun, if a line of the task log written during the failed
+		// attempt matches them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		LogPatterns []string `json:"logPatterns,omitempty"`
+
+		// The maximum number of times the task commands are rerun, not
+		// including the first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		// Maximum:    5
+		MaxReruns int64 `json:"maxReruns"`
+	}
+
+	// JUnit (or XUnit) XML reports of the task to summarize. When the task
+	// commands complete, the reports matching `paths` are parsed, and
+	// artifact `public/test-results.json` is published with the number of
+	// tests that passed, failed, errored and were skipped, the slowest
+	// tests, and the failed tests, which are also listed in the task log.
+	//
+	// Since: generic-worker 28.1.0
+	TestResults struct {
+
+		// If true, the task fails if no reports match `paths`, or if a
+		// matching report cannot be parsed, so that a test harness which
+		// crashes without writing its results doesn't go unnoticed.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		FailIfMissing bool `json:"failIfMissing,omitempty"`
+
+		// Paths of the reports, relative to the task directory, which may
+		// contain the wildcards of [filepath.Match](https://golang.org/pkg/path/filepath/#Match),
+		// e.g. `build/test-results/TEST-*.xml`. Wildcards don't match path
+		// separators, so `**` is not supported.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Paths []string `json:"paths"`
+	}
+
+	// URL to download content from.
 	//
 	// Since: generic-worker 5.4.0
 	URLContent struct {
@@ -393,8 +1448,53 @@ type (
 		URL string `json:"url"`
 	}
 
+	// The Windows container that the task commands run in, on workers with
+	// config setting `taskIsolation` set to `windowsContainer`. Required on
+	// such workers, and not supported on any others. The image is pulled if
+	// needed, and must be compatible with the kernel of the worker: with
+	// `process` isolation the image must have the same Windows build number
+	// as the worker, and with `hyperv` isolation it must not have a later
+	// build number. The task directory (including mounted caches and
+	// fetched content) is mounted into the container at the same path, and
+	// the output of the task commands is streamed to the task log as usual.
+	//
+	// Since: generic-worker 28.1.0
+	WindowsContainer struct {
+
+		// The Windows container image to run the task commands in, for
+		// example `mcr.microsoft.com/windows/servercore:ltsc2019`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Image string `json:"image"`
+
+		// Whether the container shares the kernel of the worker (`process`),
+		// or runs in a lightweight Hyper-V VM (`hyperv`), which supports
+		// images of earlier Windows builds than the worker.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "process"
+		//   * "hyperv"
+		//
+		// Default:    "process"
+		Isolation string `json:"isolation,omitempty"`
+	}
+
 	WritableDirectoryCache struct {
 
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// Implies a read/write cache directory volume. A unique name for the
 		// cache volume. Requires scope `generic-worker:cache:<cache-name>`.
 		// Note if this cache is loaded from an artifact, you will also require
@@ -425,6 +1525,21 @@ type (
 		//   * "tar.gz"
 		//   * "zip"
 		Format string `json:"format,omitempty"`
+
+		// If provided, the cache is kept on the worker between tasks as a
+		// seekable zstd archive, and only the given paths of the cache
+		// (relative to `directory`) are extracted when it is mounted, which
+		// is much quicker than mounting the whole of a large cache when the
+		// task only needs part of it. Other paths of the cache are not
+		// available to the task, but are kept in the cache for later tasks.
+		// A task that mounts the cache without `paths` gets the whole cache.
+		// Requires `zstd` to be installed on the worker.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Paths []string `json:"paths,omitempty"`
 	}
 )
 
@@ -446,6 +1561,21 @@ func taskPayloadSchema() string {
   "$schema": "/schemas/common/metaschema.json#",
   "additionalProperties": false,
   "definitions": {
+    "architectures": {
+      "description": "A list of CPU architectures.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "enum": [
+          "arm64",
+          "x86_64"
+        ],
+        "title": "CPU architecture",
+        "type": "string"
+      },
+      "minItems": 1,
+      "title": "CPU architectures",
+      "type": "array",
+      "uniqueItems": true
+    },
     "content": {
       "oneOf": [
         {
@@ -534,9 +1664,71 @@ func taskPayloadSchema() string {
         }
       ]
     },
+    "fetch": {
+      "additionalProperties": false,
+      "description": "An artifact of an upstream task to download. Exactly one of ` + "`" + `taskId` + "`" + `\nand ` + "`" + `namespace` + "`" + ` must be provided.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "artifact": {
+          "description": "The name of the artifact to download from the task.\n\nSince: generic-worker 28.1.0",
+          "maxLength": 1024,
+          "title": "Artifact name",
+          "type": "string"
+        },
+        "format": {
+          "description": "If provided, the artifact is treated as an archive of the given\nformat, and is extracted into ` + "`" + `path` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "rar",
+            "tar.bz2",
+            "tar.gz",
+            "zip"
+          ],
+          "title": "Format",
+          "type": "string"
+        },
+        "namespace": {
+          "description": "An index namespace (e.g. ` + "`" + `project.example.latest.linux64` + "`" + `) which\nis resolved to a ` + "`" + `taskId` + "`" + ` via the index service when the task\nstarts. The resolved ` + "`" + `taskId` + "`" + ` is recorded, together with the SHA256\nof the fetched content, in the artifact ` + "`" + `public/resolved-fetches.json` + "`" + `\nand in the chain of trust certificate (if enabled).\n\nSince: generic-worker 28.1.0",
+          "maxLength": 255,
+          "title": "Index namespace",
+          "type": "string"
+        },
+        "path": {
+          "description": "The location, relative to the task directory, to place the artifact.\nIf ` + "`" + `format` + "`" + ` is provided, this is the directory into which the\nartifact is extracted, otherwise it is the file the artifact is\ncopied to.\n\nSince: generic-worker 28.1.0",
+          "title": "Path",
+          "type": "string"
+        },
+        "sha256": {
+          "description": "The required SHA 256 of the artifact content.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[a-f0-9]{64}$",
+          "title": "SHA 256",
+          "type": "string"
+        },
+        "taskId": {
+          "description": "The ` + "`" + `taskId` + "`" + ` of the task that published the artifact.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$",
+          "title": "Task ID",
+          "type": "string"
+        }
+      },
+      "required": [
+        "artifact",
+        "path"
+      ],
+      "title": "Fetch",
+      "type": "object"
+    },
     "fileMount": {
       "additionalProperties": false,
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "content": {
           "$ref": "#/definitions/content",
           "description": "Content of the file to be mounted.\n\nSince: generic-worker 5.4.0"
@@ -571,6 +1763,11 @@ func taskPayloadSchema() string {
     "readOnlyDirectory": {
       "additionalProperties": false,
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "content": {
           "$ref": "#/definitions/content",
           "description": "Contents of read only directory.\n\nSince: generic-worker 5.4.0",
@@ -612,6 +1809,11 @@ func taskPayloadSchema() string {
         ]
       },
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "cacheName": {
           "description": "Implies a read/write cache directory volume. A unique name for the\ncache volume. Requires scope ` + "`" + `generic-worker:cache:\u003ccache-name\u003e` + "`" + `.\nNote if this cache is loaded from an artifact, you will also require\nscope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + ` to use this cache.\n\nSince: generic-worker 5.4.0",
           "title": "Cache Name",
@@ -637,6 +1839,17 @@ func taskPayloadSchema() string {
           ],
           "title": "Format",
           "type": "string"
+        },
+        "paths": {
+          "description": "If provided, the cache is kept on the worker between tasks as a\nseekable zstd archive, and only the given paths of the cache\n(relative to ` + "`" + `directory` + "`" + `) are extracted when it is mounted, which\nis much quicker than mounting the whole of a large cache when the\ntask only needs part of it. Other paths of the cache are not\navailable to the task, but are kept in the cache for later tasks.\nA task that mounts the cache without ` + "`" + `paths` + "`" + ` gets the whole cache.\nRequires ` + "`" + `zstd` + "`" + ` to be installed on the worker.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          },
+          "title": "Paths",
+          "type": "array",
+          "uniqueItems": true
         }
       },
       "required": [
@@ -647,8 +1860,57 @@ func taskPayloadSchema() string {
       "type": "object"
     }
   },
-  "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.",
+  "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.\n\nIf ` + "`" + `features.payloadTemplates` + "`" + ` is enabled, the arguments of ` + "`" + `command` + "`" + `, the\nvalues of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` may contain template\nexpressions, which the worker expands when the task starts:\n\n  * ` + "`" + `{{taskId}}` + "`" + `, ` + "`" + `{{runId}}` + "`" + ` and ` + "`" + `{{taskGroupId}}` + "`" + ` - the IDs of the task\n  * ` + "`" + `{{workerGroup}}` + "`" + `, ` + "`" + `{{workerId}}` + "`" + ` and ` + "`" + `{{workerPoolId}}` + "`" + ` - the IDs of the\n    worker\n  * ` + "`" + `{{cachePath \"\u003ccacheName\u003e\"}}` + "`" + ` - the ` + "`" + `directory` + "`" + ` of the writable\n    directory cache mount with cache name ` + "`" + `\u003ccacheName\u003e` + "`" + `\n  * ` + "`" + `{{fetchPath \"\u003cartifact\u003e\"}}` + "`" + ` - the ` + "`" + `path` + "`" + ` of the fetch of the artifact\n    with name (or base name) ` + "`" + `\u003cartifact\u003e` + "`" + `\n\nPaths are relative to the task directory. Other text between ` + "`" + `{{` + "`" + ` and ` + "`" + `}}` + "`" + `\nis left as is.\n\nSince: generic-worker 28.1.0",
   "properties": {
+    "annotations": {
+      "additionalProperties": false,
+      "description": "Settings for publishing artifact ` + "`" + `public/annotations.json` + "`" + `, which\nsummarizes the errors and warnings of the task, so that CI user\ninterfaces can show them without parsing the task log. When the task\ncommands complete, each line of the task log is matched against\n` + "`" + `errorPatterns` + "`" + ` and ` + "`" + `warningPatterns` + "`" + `, TAP output is parsed if ` + "`" + `tap` + "`" + ` is\nenabled, and the JUnit XML reports listed in ` + "`" + `junitReports` + "`" + ` are parsed.\nAnnotations found in the task log have the line number and byte offset\nof the line in artifact ` + "`" + `public/logs/live_backing.log` + "`" + `. At most 1000\nannotations are published, although all are counted.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "errorPatterns": {
+          "description": "Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))\nthat lines of the task log which report errors match.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Error patterns",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "junitReports": {
+          "description": "Paths, relative to the task directory, of JUnit XML reports that the\ntask commands write. Each test case with a failure or error is\nreported as an error. Missing reports are noted in the task log,\nbut don't fail the task.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "JUnit XML reports",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "tap": {
+          "default": false,
+          "description": "If true, [TAP](https://testanything.org/) test results in the task\nlog are parsed, and each failed test (` + "`" + `not ok` + "`" + `, unless marked\n` + "`" + `# TODO` + "`" + ` or ` + "`" + `# SKIP` + "`" + `) and ` + "`" + `Bail out!` + "`" + ` is reported as an error.\n\nSince: generic-worker 28.1.0",
+          "title": "Parse TAP output",
+          "type": "boolean"
+        },
+        "warningPatterns": {
+          "description": "Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))\nthat lines of the task log which report warnings match. Lines that\nmatch one of ` + "`" + `errorPatterns` + "`" + ` are not also reported as warnings.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Warning patterns",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "title": "Task annotations",
+      "type": "object"
+    },
+    "architectures": {
+      "$ref": "#/definitions/architectures",
+      "description": "The CPU architectures that the task commands can run on, most\npreferred first. The task runs as the first of them that the worker\nsupports, either natively, or on macOS and Linux workers with Rosetta,\nas x86_64 by translation. If the worker supports none of them, the\ntask resolves as ` + "`" + `exception/malformed-payload` + "`" + `. The architecture that\nthe task runs as is available to the task commands in environment\nvariable ` + "`" + `TASK_ARCHITECTURE` + "`" + `, and selects which ` + "`" + `mounts` + "`" + ` and ` + "`" + `fetches` + "`" + `\napply to the task (see their ` + "`" + `architectures` + "`" + ` property). If not\nprovided, the task runs as the native architecture of the worker.\n\nSince: generic-worker 28.1.0",
+      "title": "Architectures"
+    },
     "artifacts": {
       "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
       "items": {
@@ -684,6 +1946,12 @@ func taskPayloadSchema() string {
             "title": "Artifact location",
             "type": "string"
           },
+          "private": {
+            "default": false,
+            "description": "If ` + "`" + `true` + "`" + `, the artifact is scope-protected, so its ` + "`" + `name` + "`" + ` (or ` + "`" + `path` + "`" + `, if ` + "`" + `name` + "`" + ` is not\nset) must not begin ` + "`" + `public/` + "`" + `. Downloading the artifact requires scope\n` + "`" + `queue:get-artifact:\u003cname\u003e` + "`" + ` (for a ` + "`" + `directory` + "`" + ` artifact, ` + "`" + `queue:get-artifact:\u003cname\u003e/*` + "`" + `),\nwhich the task must also have, so that the task can grant it to the tasks that consume\nthe artifact. Note, on workers with config setting ` + "`" + `forcePrivateArtifacts` + "`" + ` enabled, all\nartifact names beginning ` + "`" + `public/` + "`" + ` are published beginning ` + "`" + `private/` + "`" + ` instead.\n\nSince: generic-worker 28.1.0",
+            "title": "Publish artifact as private",
+            "type": "boolean"
+          },
           "type": {
             "description": "Artifacts can be either an individual ` + "`" + `file` + "`" + ` or a ` + "`" + `directory` + "`" + ` containing\npotentially multiple files with recursively included subdirectories.\n\nSince: generic-worker 1.0.0",
             "enum": [
@@ -705,6 +1973,27 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": true
     },
+    "bandwidthLimits": {
+      "additionalProperties": false,
+      "description": "Rate limits for transfers made by the worker on behalf of this task.\nThese apply in addition to any limits configured for the worker as a\nwhole (config settings ` + "`" + `maxDownloadBytesPerSec` + "`" + ` and\n` + "`" + `maxUploadBytesPerSec` + "`" + `), so can only further reduce bandwidth usage.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "maxDownloadBytesPerSec": {
+          "description": "Maximum number of bytes per second to download for mounts and\nfetches.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum download rate",
+          "type": "integer"
+        },
+        "maxUploadBytesPerSec": {
+          "description": "Maximum number of bytes per second to upload for artifacts.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum upload rate",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Bandwidth limits",
+      "type": "object"
+    },
     "command": {
       "description": "One entry per command (consider each entry to be interpreted as a full line of\na Windows™ .bat file). For example:\n` + "`" + `` + "`" + `` + "`" + `\n[\n  \"set\",\n  \"echo hello world \u003e hello_world.txt\",\n  \"set GOPATH=C:\\\\Go\"\n]\n` + "`" + `` + "`" + `` + "`" + `\n\nSince: generic-worker 0.0.1",
       "items": {
@@ -715,6 +2004,78 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "container": {
+      "additionalProperties": false,
+      "description": "The Windows container that the task commands run in, on workers with\nconfig setting ` + "`" + `taskIsolation` + "`" + ` set to ` + "`" + `windowsContainer` + "`" + `. Required on\nsuch workers, and not supported on any others. The image is pulled if\nneeded, and must be compatible with the kernel of the worker: with\n` + "`" + `process` + "`" + ` isolation the image must have the same Windows build number\nas the worker, and with ` + "`" + `hyperv` + "`" + ` isolation it must not have a later\nbuild number. The task directory (including mounted caches and\nfetched content) is mounted into the container at the same path, and\nthe output of the task commands is streamed to the task log as usual.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "image": {
+          "description": "The Windows container image to run the task commands in, for\nexample ` + "`" + `mcr.microsoft.com/windows/servercore:ltsc2019` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "minLength": 1,
+          "title": "Image",
+          "type": "string"
+        },
+        "isolation": {
+          "default": "process",
+          "description": "Whether the container shares the kernel of the worker (` + "`" + `process` + "`" + `),\nor runs in a lightweight Hyper-V VM (` + "`" + `hyperv` + "`" + `), which supports\nimages of earlier Windows builds than the worker.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "process",
+            "hyperv"
+          ],
+          "title": "Isolation mode",
+          "type": "string"
+        }
+      },
+      "required": [
+        "image"
+      ],
+      "title": "Windows container",
+      "type": "object"
+    },
+    "display": {
+      "additionalProperties": false,
+      "description": "Display settings that the desktop of the task user is configured with\nbefore the task commands run, for GUI tests that depend on them. The\nsettings are verified after they are applied, and the task is resolved\nas ` + "`" + `exception` + "`" + ` with reason ` + "`" + `malformed-payload` + "`" + ` if the display adapter\ndoesn't support them. The original settings are restored when the\ntask commands complete.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "colorDepth": {
+          "description": "The color depth of the primary display, in bits per pixel.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            16,
+            24,
+            32
+          ],
+          "title": "Color depth in bits per pixel",
+          "type": "integer"
+        },
+        "dpi": {
+          "description": "The logical DPI of the task user. 96 is 100% scaling, 120 is 125%,\n144 is 150% and 192 is 200%. Windows applies DPI changes to\napplications that start after the change, but some parts of the\ndesktop only apply them on the next logon, so a warning is logged\nif the DPI of the logon session doesn't match after the change.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            96,
+            120,
+            144,
+            168,
+            192
+          ],
+          "title": "Dots per inch",
+          "type": "integer"
+        },
+        "height": {
+          "description": "The vertical resolution of the primary display, in pixels.\nRequires ` + "`" + `width` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "maximum": 4320,
+          "minimum": 480,
+          "title": "Vertical resolution in pixels",
+          "type": "integer"
+        },
+        "width": {
+          "description": "The horizontal resolution of the primary display, in pixels.\nRequires ` + "`" + `height` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "maximum": 7680,
+          "minimum": 640,
+          "title": "Horizontal resolution in pixels",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Display settings",
+      "type": "object"
+    },
     "env": {
       "additionalProperties": {
         "type": "string"
@@ -727,11 +2088,41 @@ func taskPayloadSchema() string {
       "additionalProperties": false,
       "description": "Feature flags enable additional functionality.\n\nSince: generic-worker 5.3.0",
       "properties": {
+        "androidEmulator": {
+          "description": "If enabled, the Android emulator configured on the worker is booted\nfrom its snapshot before the task commands run, and shut down\nwithout saving its state after they complete, so that each task\nstarts from the same snapshot. The environment variables\n` + "`" + `ANDROID_SERIAL` + "`" + `, ` + "`" + `ANDROID_ADB_SERVER_PORT` + "`" + ` and\n` + "`" + `ANDROID_EMULATOR_CONSOLE_PORT` + "`" + ` are set for the task commands, so\nthat ` + "`" + `adb` + "`" + ` connects to the emulator. The emulator log (logcat) is\npublished as artifact ` + "`" + `public/logs/logcat.txt` + "`" + `. Requires scope\n` + "`" + `generic-worker:android-emulator:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Boot an Android emulator for the task",
+          "type": "boolean"
+        },
         "chainOfTrust": {
           "description": "Artifacts named ` + "`" + `public/chain-of-trust.json` + "`" + ` and\n` + "`" + `public/chain-of-trust.json.sig` + "`" + ` should be generated which will\ninclude information for downstream tasks to build a level of trust\nfor the artifacts produced by the task and the environment it ran in.\n\nSince: generic-worker 5.3.0",
           "title": "Enable generation of signed Chain of Trust artifacts",
           "type": "boolean"
         },
+        "crashDumps": {
+          "description": "If enabled, the operating system is configured so that any task\nprocess that crashes writes a dump (a minidump via Windows Error\nReporting on Windows, a core file via ` + "`" + `core_pattern` + "`" + ` on Linux, or a\ncore file and ReportCrash report on macOS) to a directory that is\ncollected by the worker when the task commands complete. Dumps are\npublished as artifacts named\n` + "`" + `public/crashdumps/\u003cexecutable\u003e.\u003cpid\u003e.\u003ctimestamp\u003e.\u003cextension\u003e` + "`" + ` so\nthat they can be matched to symbols for the crashing executable.\n\nSince: generic-worker 28.1.0",
+          "title": "Collect crash dumps of task processes",
+          "type": "boolean"
+        },
+        "disableNetwork": {
+          "description": "If enabled, task commands run without network access, for example\nto verify that a build is hermetic. Outbound connections of the task\nuser are blocked by a Windows Firewall rule for the duration of the\ntask, so attempts to use the network fail straight away. Not\nsupported if worker config setting ` + "`" + `runTasksAsCurrentUser` + "`" + ` is\nenabled, or if worker config setting ` + "`" + `taskIsolation` + "`" + ` is set. The\nworker config setting ` + "`" + `disableNetwork` + "`" + ` enables this for all tasks.\n\nSince: generic-worker 28.1.0",
+          "title": "Run the task without network access",
+          "type": "boolean"
+        },
+        "payloadTemplates": {
+          "description": "If enabled, the template expressions in the arguments of ` + "`" + `command` + "`" + `,\nthe values of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` are\nexpanded when the task starts (see the description of the payload).\nWithout it, text such as ` + "`" + `{{taskId}}` + "`" + ` is passed to the task as is.\n\nSince: generic-worker 28.1.0",
+          "title": "Expand template expressions in the task payload",
+          "type": "boolean"
+        },
+        "progress": {
+          "description": "If enabled, task commands can report the progress of the task by\nPOSTing JSON such as\n` + "`" + `{\"percentage\": 42.5, \"step\": \"Linking\", \"eta\": \"2020-06-01T14:30:00.000Z\"}` + "`" + `\nto the URL in environment variable ` + "`" + `TASKCLUSTER_PROGRESS_URL` + "`" + `, where\n` + "`" + `percentage` + "`" + ` (between 0 and 100) is required and ` + "`" + `step` + "`" + ` and ` + "`" + `eta` + "`" + `\n(when the task expects to complete) are optional. The latest report\nis published as artifact ` + "`" + `public/progress.json` + "`" + `, which is updated\nevery ` + "`" + `progressUpdateIntervalSecs` + "`" + ` seconds (a worker config setting)\nwhile the task runs, and once more when the task commands complete,\nso that dashboards can show the progress of long running tasks.\n\nSince: generic-worker 28.1.0",
+          "title": "Allow the task to report its progress",
+          "type": "boolean"
+        },
+        "resultCache": {
+          "description": "If enabled, the worker computes a hash of the task payload together\nwith the SHA256 of all content mounted or fetched into the task\ndirectory. If an earlier task with the same hash completed\nsuccessfully on this worker type, the task commands are not run, and\ninstead the artifacts of the earlier task are re-exposed as redirect\nartifacts, and the task resolves as completed. Otherwise, if the task\ncompletes successfully, it is recorded in the index under namespace\n` + "`" + `generic-worker.result-cache.\u003cprovisionerId\u003e.\u003cworkerType\u003e.\u003chash\u003e` + "`" + ` for\nfuture tasks to reuse. The hash also covers the scopes and routes of\nthe task. Only enable this for deterministic tasks.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:result-cache:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Reuse the result of an identical earlier task run",
+          "type": "boolean"
+        },
         "runAsAdministrator": {
           "description": "Runs commands with UAC elevation. Only set to true when UAC is\nenabled on the worker and Administrative privileges are required by\ntask commands. When UAC is disabled on the worker, task commands will\nalready run with full user privileges, and therefore a value of true\nwill result in a malformed-payload task exception.\n\nA value of true does not add the task user to the ` + "`" + `Administrators` + "`" + `\ngroup - see the ` + "`" + `osGroups` + "`" + ` property for that. Typically\n` + "`" + `task.payload.osGroups` + "`" + ` should include an Administrative group, such\nas ` + "`" + `Administrators` + "`" + `, when setting to true.\n\nFor security, ` + "`" + `runAsAdministrator` + "`" + ` feature cannot be used in\nconjunction with ` + "`" + `chainOfTrust` + "`" + ` feature.\n\nRequires scope\n` + "`" + `generic-worker:run-as-administrator:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 10.11.0",
           "title": "Run commands with UAC process elevation",
@@ -747,6 +2138,22 @@ func taskPayloadSchema() string {
       "title": "Feature flags",
       "type": "object"
     },
+    "fetches": {
+      "description": "Artifacts of upstream tasks to be downloaded before the task commands\nrun. Each fetch refers to an artifact of a task, identified either\ndirectly by ` + "`" + `taskId` + "`" + `, or indirectly by an index ` + "`" + `namespace` + "`" + ` which is\nresolved to a ` + "`" + `taskId` + "`" + ` when the task starts. Fetches are downloaded in\nparallel, retried on transient failures, verified against ` + "`" + `sha256` + "`" + ` (if\nprovided) and cached on the worker between tasks, in the same way as\nfile mounts.\n\nTasks referenced by ` + "`" + `taskId` + "`" + ` must be listed in ` + "`" + `task.dependencies` + "`" + `.\nFetching a non-public artifact (i.e. not starting with ` + "`" + `public/` + "`" + `)\nrequires scope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "$ref": "#/definitions/fetch",
+        "title": "Fetch"
+      },
+      "title": "Fetches",
+      "type": "array",
+      "uniqueItems": false
+    },
+    "maxArtifactsMB": {
+      "description": "The maximum total size in megabytes of the artifacts of\n` + "`" + `task.payload.artifacts` + "`" + `. If the artifacts are larger, none of them\nare uploaded, and the task resolves as failed, listing its largest\nartifacts. This applies in addition to any limit configured for the\nworker (config setting ` + "`" + `maxTaskArtifactsMB` + "`" + `), so can only lower it.\n\nSince: generic-worker 28.1.0",
+      "minimum": 1,
+      "title": "Maximum total artifact size",
+      "type": "integer"
+    },
     "maxRunTime": {
       "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
       "maximum": 86400,
@@ -768,6 +2175,43 @@ func taskPayloadSchema() string {
       "additionalProperties": false,
       "description": "By default tasks will be resolved with ` + "`" + `state/reasonResolved` + "`" + `: ` + "`" + `completed/completed` + "`" + `\nif all task commands have a zero exit code, or ` + "`" + `failed/failed` + "`" + ` if any command has a\nnon-zero exit code. This payload property allows customsation of the task resolution\nbased on exit code of task commands.",
       "properties": {
+        "exception": {
+          "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception` + "`" + `, with the given reason, for example so\nthat a test harness that detects a problem with the worker can\nresolve the task as ` + "`" + `exception/resource-unavailable` + "`" + `, rather than\n` + "`" + `failed/failed` + "`" + `. Use ` + "`" + `retry` + "`" + ` for ` + "`" + `exception/intermittent-task` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "exitCodes": {
+                "description": "The exit codes that cause the task to be resolved as\nexception with this reason.\n\nSince: generic-worker 28.1.0",
+                "items": {
+                  "minimum": 1,
+                  "type": "integer"
+                },
+                "minItems": 1,
+                "title": "Exit codes",
+                "type": "array",
+                "uniqueItems": true
+              },
+              "reason": {
+                "description": "The reason to resolve the task with.\n\nSince: generic-worker 28.1.0",
+                "enum": [
+                  "internal-error",
+                  "malformed-payload",
+                  "resource-unavailable"
+                ],
+                "title": "Exception reason",
+                "type": "string"
+              }
+            },
+            "required": [
+              "reason",
+              "exitCodes"
+            ],
+            "title": "Exception mapping",
+            "type": "object"
+          },
+          "title": "Exit codes resolving task as exception",
+          "type": "array"
+        },
         "retry": {
           "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception/intermittent-task` + "`" + `. Typically the Queue\nwill then schedule a new run of the existing ` + "`" + `taskId` + "`" + ` (rerun) if not\nall task runs have been exhausted.\n\nSee [itermittent tasks](https://docs.taskcluster.net/docs/reference/platform/taskcluster-queue/docs/worker-interaction#intermittent-tasks) for more detail.\n\nSince: generic-worker 10.10.0",
           "items": {
@@ -778,6 +2222,17 @@ func taskPayloadSchema() string {
           "title": "Intermittent task exit codes",
           "type": "array",
           "uniqueItems": true
+        },
+        "success": {
+          "description": "Exit codes for any command in the task payload to be treated as\nsuccess (with a warning in the task log), so that subsequent task\ncommands are run, and if they succeed, the task is resolved as\n` + "`" + `completed/completed` + "`" + `. Commands that exit with these exit codes\nare not retried by ` + "`" + `retryPolicies` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "title": "Exit codes",
+            "type": "integer"
+          },
+          "title": "Exit codes treated as success",
+          "type": "array",
+          "uniqueItems": true
         }
       },
       "required": [],
@@ -793,16 +2248,443 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "outputEncoding": {
+      "default": "auto",
+      "description": "The encoding of the output of the task commands, which is converted to\nUTF-8 in the task log:\n\n  * ` + "`" + `auto` + "`" + `: output that starts with a UTF-16 byte order mark, or looks\n    like ASCII encoded as UTF-16, is UTF-16LE, e.g. the output of\n    ` + "`" + `cmd /u` + "`" + `. Other output is UTF-8, until it is not valid UTF-8, after\n    which it is in the OEM code page, which console programs such as\n    ` + "`" + `cmd` + "`" + ` write output in by default. This is suitable for most\n    localized Windows images.\n  * ` + "`" + `utf-8` + "`" + `: output is UTF-8, e.g. after ` + "`" + `chcp 65001` + "`" + `.\n  * ` + "`" + `utf-16le` + "`" + `: output is UTF-16 little endian.\n  * ` + "`" + `oem` + "`" + `: output is in the OEM code page of the worker.\n  * ` + "`" + `ansi` + "`" + `: output is in the ANSI code page of the worker.\n\nOutput that is not valid in its encoding is replaced, and a warning is\nwritten to the task log after the command that wrote it.\n\nSince: generic-worker 28.1.0",
+      "enum": [
+        "auto",
+        "utf-8",
+        "utf-16le",
+        "oem",
+        "ansi"
+      ],
+      "title": "Output encoding",
+      "type": "string"
+    },
+    "performanceCapture": {
+      "additionalProperties": false,
+      "description": "Captures Windows performance counters and/or an ETW trace for the\nduration of the task commands, to help diagnose machine-level noise\n(for example in benchmark pools). Counters are sampled with ` + "`" + `logman` + "`" + `\nand published as artifact ` + "`" + `public/performance/counters.csv` + "`" + `. ETW traces\nare recorded with Windows Performance Recorder (` + "`" + `wpr` + "`" + `) and published as\nartifact ` + "`" + `public/performance/trace.etl` + "`" + `.\n\nFailure to start or stop a capture does not affect the task\nresolution; a warning is written to the task log instead.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:performance-capture:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + ` since\nthe captured data covers all processes running on the worker.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "counters": {
+          "description": "Performance counter paths to sample, for example\n` + "`" + `\\Processor(_Total)\\% Processor Time` + "`" + ` or\n` + "`" + `\\PhysicalDisk(_Total)\\Avg. Disk Queue Length` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "type": "string"
+          },
+          "title": "Performance counters",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "etwProfile": {
+          "description": "If set, the Windows Performance Recorder profile to record an ETW\ntrace with, for example ` + "`" + `GeneralProfile` + "`" + `, ` + "`" + `CPU` + "`" + ` or ` + "`" + `DiskIO` + "`" + `. See\n` + "`" + `wpr -profiles` + "`" + ` for the available profiles.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[A-Za-z][A-Za-z0-9._-]*$",
+          "title": "ETW trace profile",
+          "type": "string"
+        },
+        "sampleInterval": {
+          "default": 1,
+          "description": "How often to sample performance counters, in seconds.\n\nSince: generic-worker 28.1.0",
+          "maximum": 3600,
+          "minimum": 1,
+          "title": "Sample interval in seconds",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Performance capture",
+      "type": "object"
+    },
+    "phases": {
+      "description": "Groups the task commands into named phases (for example ` + "`" + `setup` + "`" + `,\n` + "`" + `build` + "`" + `, ` + "`" + `test` + "`" + ` and ` + "`" + `package` + "`" + `), each of which is a run of\nconsecutive commands. The numbers of commands of the phases must add\nup to the number of task commands. The worker writes\nTreeherder-compatible step markers to the task log at the start and\nend of each phase, and publishes the duration and outcome of each\nphase as artifact ` + "`" + `public/phases.json` + "`" + `. Phases whose commands did not\nall run (because an earlier command failed, or the task was aborted)\nare reported with state ` + "`" + `failed` + "`" + `, ` + "`" + `aborted` + "`" + ` or ` + "`" + `skipped` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "commands": {
+            "description": "The number of consecutive task commands in the phase, following\nthe commands of the previous phases.\n\nSince: generic-worker 28.1.0",
+            "minimum": 1,
+            "title": "Number of commands in phase",
+            "type": "integer"
+          },
+          "name": {
+            "description": "The name of the phase, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "maxLength": 100,
+            "minLength": 1,
+            "title": "Phase name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name",
+          "commands"
+        ],
+        "title": "Phase",
+        "type": "object"
+      },
+      "title": "Named phases of task commands",
+      "type": "array"
+    },
+    "portLeases": {
+      "description": "Ports that the worker leases to the task for the duration of the task,\neach exposed to the task commands (and to any services) in an\nenvironment variable. Leased ports are taken from the worker's\nconfigured port lease range, and are not leased to any other task on\nthe same host (including tasks of other workers that share the same\n` + "`" + `portLeasesDir` + "`" + `) until the task resolves. Use this instead of\nhard-coded port numbers to avoid clashes between concurrent tasks. The\nleased ports are listed in the task log.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "name": {
+            "description": "The name of the environment variable that holds the leased port\nnumber, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]{0,63}$",
+            "title": "Environment variable name",
+            "type": "string"
+          },
+          "protocol": {
+            "default": "tcp",
+            "description": "The protocol that the port must be free for.\n\nSince: generic-worker 28.1.0",
+            "enum": [
+              "tcp",
+              "udp"
+            ],
+            "title": "Protocol",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Port lease",
+        "type": "object"
+      },
+      "title": "Port leases",
+      "type": "array",
+      "uniqueItems": true
+    },
     "rdpInfo": {
       "description": "Specifies an artifact name for publishing RDP connection information.\n\nSince this is potentially sensitive data, care should be taken to publish\nto a suitably locked down path, such as\n` + "`" + `login-identity/\u003clogin-identity\u003e/rdpinfo.json` + "`" + ` which is only readable for\nthe given login identity (for example\n` + "`" + `login-identity/mozilla-ldap/pmoore@mozilla.com/rdpinfo.json` + "`" + `). See the\n[artifact namespace guide](https://docs.taskcluster.net/manual/design/namespaces#artifacts) for more information.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:allow-rdp:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + ` which must be\ndeclared as a task scope.\n\nThe RDP connection data is published during task startup so that a user\nmay interact with the running task.\n\nThe task environment will be retained for 12 hours after the task\ncompletes, to enable an interactive user to perform investigative tasks.\nAfter these 12 hours, the worker will delete the task's Windows user\naccount, and then continue with other tasks.\n\nNo guarantees are given about the resolution status of the interactive\ntask, since the task is inherently non-reproducible and no automation\nshould rely on this value.\n\nSince: generic-worker 10.5.0",
       "title": "RDP Info",
       "type": "string"
     },
+    "reproducible": {
+      "additionalProperties": false,
+      "description": "Settings for tasks that produce reproducible artifacts. Environment\nvariable ` + "`" + `SOURCE_DATE_EPOCH` + "`" + ` is set to ` + "`" + `sourceDateEpoch` + "`" + `, ` + "`" + `TZ` + "`" + ` to\n` + "`" + `timezone` + "`" + `, and ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + ` to ` + "`" + `locale` + "`" + `, overriding any values\nin ` + "`" + `env` + "`" + `. The resolved settings are listed in the task log, and are\nrecorded in the chain of trust certificate of the task (if the\n` + "`" + `chainOfTrust` + "`" + ` feature is enabled).\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "locale": {
+          "default": "C.UTF-8",
+          "description": "The value of ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Locale",
+          "type": "string"
+        },
+        "sourceDateEpoch": {
+          "description": "The value of ` + "`" + `SOURCE_DATE_EPOCH` + "`" + `, in seconds since the Unix epoch.\nIf not specified (or 0), the creation time of the task is used, so\nthat reruns of the task use the same value.\n\nSince: generic-worker 28.1.0",
+          "minimum": 0,
+          "title": "Source date epoch",
+          "type": "integer"
+        },
+        "timezone": {
+          "default": "UTC",
+          "description": "The value of ` + "`" + `TZ` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Time zone",
+          "type": "string"
+        }
+      },
+      "title": "Reproducible build environment",
+      "type": "object"
+    },
+    "requiredArtifacts": {
+      "default": [],
+      "description": "Names of artifacts that the task must publish in order to resolve\nsuccessfully, such as ` + "`" + `public/build/target.tar.gz` + "`" + `. If any of them was\nnot uploaded (for example because the file of an artifact of\n` + "`" + `task.payload.artifacts` + "`" + ` does not exist, so an error artifact was\nuploaded instead) the task resolves as failed, listing the missing\nartifacts. This protects against tasks that succeed without producing\ntheir outputs.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "type": "string"
+      },
+      "title": "Required artifacts",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "rerun": {
+      "additionalProperties": false,
+      "description": "Policy for rerunning all of the task commands, from the first command,\nwhen the task fails with a known intermittent failure signature, so\nthat intermittent failures don't need a new task run (and worker) to\nbe retried. A task fails with a failure signature if the failing\ncommand exits with one of ` + "`" + `exitCodes` + "`" + `, or if a line of the output of\nthe failed attempt matches one of ` + "`" + `logPatterns` + "`" + `. The task is rerun at\nmost ` + "`" + `maxReruns` + "`" + ` times, after which it is resolved as ` + "`" + `failed` + "`" + `. Each\nattempt is logged in its own section of the task log, and reported\nas a ` + "`" + `taskRerun` + "`" + ` WORKER_METRICS event. Reruns use the same task\ndirectory, so the task commands need to cope with files left behind\nby earlier attempts. Time spent rerunning counts towards\n` + "`" + `maxRunTime` + "`" + `. Unlike ` + "`" + `retryPolicies` + "`" + `, which retry a single command,\nand ` + "`" + `onExitStatus.retry` + "`" + `, which resolves the task as\n` + "`" + `exception/intermittent-task` + "`" + ` so that the queue creates a new run,\nreruns happen within the same run.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "exitCodes": {
+          "description": "Exit codes that cause the task commands to be rerun, if a task\ncommand exits with them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "type": "integer"
+          },
+          "title": "Exit codes of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "logPatterns": {
+          "description": "Regular expressions (in Go syntax) that cause the task commands to\nbe rerun, if a line of the task log written during the failed\nattempt matches them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "type": "string"
+          },
+          "title": "Log patterns of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "maxReruns": {
+          "description": "The maximum number of times the task commands are rerun, not\nincluding the first attempt.\n\nSince: generic-worker 28.1.0",
+          "maximum": 5,
+          "minimum": 1,
+          "title": "Maximum number of reruns",
+          "type": "integer"
+        }
+      },
+      "required": [
+        "maxReruns"
+      ],
+      "title": "Task rerun policy",
+      "type": "object"
+    },
+    "retryPolicies": {
+      "description": "Policies for retrying task commands that fail transiently (for\nexample because of flaky network operations), so that task scripts\ndon't need their own retry loops. A task command that has a retry\npolicy, and fails, is run again after a delay, until it succeeds or\nhas been attempted ` + "`" + `maxAttempts` + "`" + ` times. The delay is ` + "`" + `backoffSeconds` + "`" + `\nbefore the second attempt, and doubles before each further attempt,\nup to ` + "`" + `maxBackoffSeconds` + "`" + `. Time spent retrying counts towards\n` + "`" + `maxRunTime` + "`" + `. Only the result of the final attempt of a command\ndetermines the outcome of the task (including ` + "`" + `onExitStatus` + "`" + `\nhandling).\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "backoffSeconds": {
+            "default": 10,
+            "description": "The number of seconds to wait before the second attempt of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Initial delay between attempts",
+            "type": "integer"
+          },
+          "command": {
+            "description": "The zero-based index of the task command that the policy applies\nto. Each command may have at most one policy.\n\nSince: generic-worker 28.1.0",
+            "minimum": 0,
+            "title": "Command index",
+            "type": "integer"
+          },
+          "exitCodes": {
+            "description": "Exit codes that cause the command to be retried. If not\nspecified, any failure of the command causes it to be retried.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "minimum": 1,
+              "type": "integer"
+            },
+            "title": "Exit codes to retry",
+            "type": "array",
+            "uniqueItems": true
+          },
+          "maxAttempts": {
+            "description": "The maximum number of times the command is run, including the\nfirst attempt.\n\nSince: generic-worker 28.1.0",
+            "maximum": 10,
+            "minimum": 2,
+            "title": "Maximum number of attempts",
+            "type": "integer"
+          },
+          "maxBackoffSeconds": {
+            "default": 300,
+            "description": "The maximum number of seconds to wait between attempts of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Maximum delay between attempts",
+            "type": "integer"
+          }
+        },
+        "required": [
+          "command",
+          "maxAttempts"
+        ],
+        "title": "Command retry policy",
+        "type": "object"
+      },
+      "title": "Command retry policies",
+      "type": "array"
+    },
+    "sbom": {
+      "additionalProperties": false,
+      "description": "Publishes a software bill of materials (SBOM) of the task when the task\ncommands complete, as artifact ` + "`" + `public/sbom.cdx.json` + "`" + ` (CycloneDX 1.4)\nor ` + "`" + `public/sbom.spdx.json` + "`" + ` (SPDX 2.3). The SBOM lists the content\nmounted or fetched into the task, such as toolchains, with its SHA 256,\nand the packages listed in ` + "`" + `manifests` + "`" + `. On workers with chain of trust\nenabled, the SBOM is covered by the chain of trust certificate of the\ntask, like any other artifact.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "format": {
+          "description": "The format of the SBOM.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "cyclonedx",
+            "spdx"
+          ],
+          "title": "SBOM format",
+          "type": "string"
+        },
+        "manifests": {
+          "description": "Paths, relative to the task directory, of package manifests that\nthe task commands write, for example while installing packages.\nEach manifest is a JSON array of packages, each with a ` + "`" + `name` + "`" + `, and\noptionally a ` + "`" + `version` + "`" + ` and [package URL](https://github.com/package-url/purl-spec)\n(` + "`" + `purl` + "`" + `), e.g. ` + "`" + `[{\"name\": \"requests\", \"version\": \"2.25.1\", \"purl\": \"pkg:pypi/requests@2.25.1\"}]` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Package manifests",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [
+        "format"
+      ],
+      "title": "Software bill of materials",
+      "type": "object"
+    },
+    "screenCapture": {
+      "additionalProperties": false,
+      "description": "Captures the task user's desktop when a task command fails or the task\nis aborted (for example because ` + "`" + `maxRunTime` + "`" + ` was exceeded), to help\ndiagnose failing GUI tests. When the task is aborted, the capture is\ntaken before task processes are killed. Captures are only published\nif the task does not complete successfully.\n\nScreenshots are published as artifact\n` + "`" + `public/screencapture/screenshot.png` + "`" + `. Recordings are published as\nartifacts ` + "`" + `public/screencapture/recording-\u003cn\u003e.ts` + "`" + ` (MPEG transport\nstream segments of ten seconds each, in chronological order).\nRecording requires ` + "`" + `ffmpeg` + "`" + ` to be installed on the worker.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "recordingSeconds": {
+          "description": "If greater than zero, the desktop is recorded while task commands\nrun, keeping (approximately) the given number of seconds of the\nmost recent recording, which is published if the task does not\ncomplete successfully.\n\nSince: generic-worker 28.1.0",
+          "maximum": 600,
+          "minimum": 0,
+          "title": "Length of rolling screen recording in seconds",
+          "type": "integer"
+        },
+        "screenshot": {
+          "description": "Take a screenshot of the desktop when a task command fails or the\ntask is aborted.\n\nSince: generic-worker 28.1.0",
+          "title": "Take a screenshot on failure",
+          "type": "boolean"
+        }
+      },
+      "required": [],
+      "title": "Screen capture",
+      "type": "object"
+    },
+    "secrets": {
+      "description": "Secrets from the taskcluster secrets service to inject into the task,\nas environment variables of the task commands, or as files in the task\ndirectory. The worker fetches the secrets with the task credentials, so\nthe task requires scope ` + "`" + `secrets:get:\u003cname\u003e` + "`" + ` for each secret. Secret\nvalues are redacted from the task log, and secret files are deleted\nwhen the task ends. Secrets require the ` + "`" + `secrets` + "`" + ` feature to be enabled\nin the worker config.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "env": {
+            "description": "The name of the environment variable to inject the secret as.\nExactly one of ` + "`" + `env` + "`" + ` and ` + "`" + `file` + "`" + ` must be set.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]*$",
+            "title": "Environment variable",
+            "type": "string"
+          },
+          "file": {
+            "description": "The path, relative to the task directory, of the file to write\nthe secret to. The file is only readable by the task user.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "File",
+            "type": "string"
+          },
+          "key": {
+            "description": "The property of the secret value to inject. If not set, the whole\nsecret value is injected as JSON. String properties are injected\nas is, other properties as JSON.\n\nSince: generic-worker 28.1.0",
+            "title": "Secret key",
+            "type": "string"
+          },
+          "name": {
+            "description": "The name of the secret in the taskcluster secrets service.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Secret name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Secret",
+        "type": "object"
+      },
+      "title": "Secrets to inject into the task",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "signArtifacts": {
+      "description": "Artifacts that the worker signs, once they have been uploaded, with a\nsigning key that it holds (see worker config setting\n` + "`" + `artifactSigningKeys` + "`" + `), so that release signing can run on dedicated\nworker pools without the keys ever being available to tasks. For each\nartifact, a detached signature of its content (ed25519, unless the key\nis held by a signing command) is published as artifact ` + "`" + `\u003cname\u003e.sig` + "`" + `,\nif the task commands succeed. Requires scope\n` + "`" + `generic-worker:signing-key:\u003cprovisionerId\u003e/\u003cworkerType\u003e/\u003ckey\u003e` + "`" + ` for\neach key used. On workers with chain of trust enabled, the chain of\ntrust certificate of the task records the key ID of each signature.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "key": {
+            "description": "The ID of the signing key of the worker to sign the artifact with.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z0-9_.-]+$",
+            "title": "Signing key",
+            "type": "string"
+          },
+          "name": {
+            "description": "The name of an artifact of ` + "`" + `task.payload.artifacts` + "`" + ` that is a file,\nsuch as ` + "`" + `public/build/target.mar` + "`" + `.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Artifact name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name",
+          "key"
+        ],
+        "title": "Artifact to sign",
+        "type": "object"
+      },
+      "title": "Sign artifacts",
+      "type": "array",
+      "uniqueItems": true
+    },
     "supersederUrl": {
       "description": "URL of a service that can indicate tasks superseding this one; the current ` + "`" + `taskId` + "`" + `\nwill be appended as a query argument ` + "`" + `taskId` + "`" + `. The service should return an object with\na ` + "`" + `supersedes` + "`" + ` key containing a list of ` + "`" + `taskId` + "`" + `s, including the supplied ` + "`" + `taskId` + "`" + `. The\ntasks should be ordered such that each task supersedes all tasks appearing later in the\nlist.\n\nSee [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.\n\nSince: generic-worker 10.2.2",
       "format": "uri",
       "title": "Superseder URL",
       "type": "string"
+    },
+    "tagOutputStreams": {
+      "default": false,
+      "description": "If true, each line that the task commands write to the task log is\nprefixed with the output stream that it was written to, ` + "`" + `[stdout] ` + "`" + ` or\n` + "`" + `[stderr] ` + "`" + `. Otherwise both streams share a single pipe, so output is\nwritten to the task log in exactly the order that it was written.\nTagged streams have a pipe each, and are written to the task log in\nthe order that the worker reads them, so output written to both\nstreams within microseconds of each other may be reordered. A line\nthat is still incomplete when the other stream is written to is\nended, so that every line has a single source.\n\nSince: generic-worker 28.1.0",
+      "title": "Tag output streams",
+      "type": "boolean"
+    },
+    "testResults": {
+      "additionalProperties": false,
+      "description": "JUnit (or XUnit) XML reports of the task to summarize. When the task\ncommands complete, the reports matching ` + "`" + `paths` + "`" + ` are parsed, and\nartifact ` + "`" + `public/test-results.json` + "`" + ` is published with the number of\ntests that passed, failed, errored and were skipped, the slowest\ntests, and the failed tests, which are also listed in the task log.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "failIfMissing": {
+          "default": false,
+          "description": "If true, the task fails if no reports match ` + "`" + `paths` + "`" + `, or if a\nmatching report cannot be parsed, so that a test harness which\ncrashes without writing its results doesn't go unnoticed.\n\nSince: generic-worker 28.1.0",
+          "title": "Fail if test results are missing",
+          "type": "boolean"
+        },
+        "paths": {
+          "description": "Paths of the reports, relative to the task directory, which may\ncontain the wildcards of [filepath.Match](https://golang.org/pkg/path/filepath/#Match),\ne.g. ` + "`" + `build/test-results/TEST-*.xml` + "`" + `. Wildcards don't match path\nseparators, so ` + "`" + `**` + "`" + ` is not supported.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "minItems": 1,
+          "title": "Report paths",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [
+        "paths"
+      ],
+      "title": "Test results",
+      "type": "object"
+    },
+    "writeFiles": {
+      "description": "Files to create in the task directory before the task commands run,\nwith inline content, which avoids quoting file content in the task\ncommands, whose quoting rules differ between shells and platforms.\nParent directories are created as needed, and existing files are\nreplaced.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "base64": {
+            "contentEncoding": "base64",
+            "description": "The content of the file, base64 encoded, for binary content. At\nmost one of ` + "`" + `content` + "`" + ` and ` + "`" + `base64` + "`" + ` may be set.\n\nSince: generic-worker 28.1.0",
+            "title": "Base64 encoded content",
+            "type": "string"
+          },
+          "content": {
+            "description": "The content of the file, as UTF-8 text. At most one of ` + "`" + `content` + "`" + `\nand ` + "`" + `base64` + "`" + ` may be set, and the file is empty if neither is.\n\nSince: generic-worker 28.1.0",
+            "title": "Content",
+            "type": "string"
+          },
+          "mode": {
+            "default": "0644",
+            "description": "The permissions of the file, in octal, e.g. ` + "`" + `\"0755\"` + "`" + ` for an\nexecutable script. Ignored on Windows.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^0?[0-7]{3}$",
+            "title": "File mode",
+            "type": "string"
+          },
+          "path": {
+            "description": "The path, relative to the task directory, of the file to write.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          }
+        },
+        "required": [
+          "path"
+        ],
+        "title": "File to write",
+        "type": "object"
+      },
+      "title": "Files to write",
+      "type": "array",
+      "uniqueItems": true
     }
   },
   "required": [
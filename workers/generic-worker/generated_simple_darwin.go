@@ -81,6 +81,18 @@ type (
 		// Since: generic-worker 1.0.0
 		Path string `json:"path"`
 
+		// If `true`, the artifact is scope-protected, so its `name` (or `path`, if `name` is not
+		// set) must not begin `public/`. Downloading the artifact requires scope
+		// `queue:get-artifact:<name>` (for a `directory` artifact, `queue:get-artifact:<name>/*`),
+		// which the task must also have, so that the task can grant it to the tasks that consume
+		// the artifact. Note, on workers with config setting `forcePrivateArtifacts` enabled, all
+		// artifact names beginning `public/` are published beginning `private/` instead.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Private bool `json:"private,omitempty"`
+
 		// Artifacts can be either an individual `file` or a `directory` containing
 		// potentially multiple files with recursively included subdirectories.
 		//
@@ -111,6 +123,30 @@ type (
 		TaskID string `json:"taskId"`
 	}
 
+	// Rate limits for transfers made by the worker on behalf of this task.
+	// These apply in addition to any limits configured for the worker as a
+	// whole (config settings `maxDownloadBytesPerSec` and
+	// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+	//
+	// Since: generic-worker 28.1.0
+	BandwidthLimits struct {
+
+		// Maximum number of bytes per second to download for mounts and
+		// fetches.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxDownloadBytesPerSec int64 `json:"maxDownloadBytesPerSec,omitempty"`
+
+		// Maximum number of bytes per second to upload for artifacts.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxUploadBytesPerSec int64 `json:"maxUploadBytesPerSec,omitempty"`
+	}
+
 	// Base64 encoded content of file/archive, up to 64KB (encoded) in size.
 	//
 	// Since: generic-worker 11.1.0
@@ -125,12 +161,162 @@ type (
 		Base64 string `json:"base64"`
 	}
 
+	Certificate struct {
+
+		// The property of the secret whose value is the base64 encoded
+		// PKCS #12 (`.p12`) file of the certificate and its private
+		// key.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Key string `json:"key"`
+
+		// The property of the secret whose value is the password of the
+		// PKCS #12 file, if it has one.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    ""
+		PasswordKey string `json:"passwordKey,omitempty"`
+
+		// The name of the secret that holds the certificate.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Secret string `json:"secret"`
+	}
+
+	CommandRetryPolicy struct {
+
+		// The number of seconds to wait before the second attempt of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    10
+		// Mininum:    1
+		// Maximum:    3600
+		BackoffSeconds int64 `json:"backoffSeconds,omitempty"`
+
+		// The zero-based index of the task command that the policy applies
+		// to. Each command may have at most one policy.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		Command int64 `json:"command"`
+
+		// Exit codes that cause the command to be retried. If not
+		// specified, any failure of the command causes it to be retried.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// The maximum number of times the command is run, including the
+		// first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    2
+		// Maximum:    10
+		MaxAttempts int64 `json:"maxAttempts"`
+
+		// The maximum number of seconds to wait between attempts of the
+		// command.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    300
+		// Mininum:    1
+		// Maximum:    3600
+		MaxBackoffSeconds int64 `json:"maxBackoffSeconds,omitempty"`
+	}
+
+	// Runs each task command under `strace -f` or `perf record -g`, and
+	// publishes the output of each command as an artifact named
+	// `<artifactPrefix>command_<index>.strace` or
+	// `<artifactPrefix>command_<index>.perf.data` (where `<index>` is the
+	// zero-based command index, zero-padded to six digits). This is intended
+	// for diagnosing hangs and performance regressions without modifying task
+	// scripts. The requested tool must be installed on the worker, otherwise
+	// the task will resolve as `malformed-payload`. Tracing is only supported
+	// on Linux.
+	//
+	// Use of this feature requires scope
+	// `generic-worker:command-trace:<provisionerId>/<workerType>`.
+	//
+	// Since: generic-worker 28.1.0
+	CommandTrace struct {
+
+		// Prefix for the names of the trace artifacts, for example
+		// `public/trace/`. Traces can contain sensitive data such as
+		// environment variables and the contents of files read or written by
+		// the task, so consider using a non-public prefix.
+		//
+		// Since: generic-worker 28.1.0
+		ArtifactPrefix string `json:"artifactPrefix"`
+
+		// Maximum size of the trace of each command, in bytes. Output beyond
+		// this size is discarded.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    1.048576e+08
+		// Mininum:    1
+		MaxSizeBytes int64 `json:"maxSizeBytes,omitempty"`
+
+		// The tool to run task commands under.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "perf"
+		//   * "strace"
+		Tool string `json:"tool"`
+	}
+
+	ExceptionMapping struct {
+
+		// The exit codes that cause the task to be resolved as
+		// exception with this reason.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes"`
+
+		// The reason to resolve the task with.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "internal-error"
+		//   * "malformed-payload"
+		//   * "resource-unavailable"
+		Reason string `json:"reason"`
+	}
+
 	// By default tasks will be resolved with `state/reasonResolved`: `completed/completed`
 	// if all task commands have a zero exit code, or `failed/failed` if any command has a
 	// non-zero exit code. This payload property allows customsation of the task resolution
 	// based on exit code of task commands.
 	ExitCodeHandling struct {
 
+		// Exit codes for any command in the task payload to cause this task to
+		// be resolved as `exception`, with the given reason, for example so
+		// that a test harness that detects a problem with the worker can
+		// resolve the task as `exception/resource-unavailable`, rather than
+		// `failed/failed`. Use `retry` for `exception/intermittent-task`.
+		//
+		// Since: generic-worker 28.1.0
+		Exception []ExceptionMapping `json:"exception,omitempty"`
+
 		// Exit codes for any command in the task payload to cause this task to
 		// be resolved as `exception/intermittent-task`. Typically the Queue
 		// will then schedule a new run of the existing `taskId` (rerun) if not
@@ -143,6 +329,18 @@ type (
 		// Array items:
 		// Mininum:    1
 		Retry []int64 `json:"retry,omitempty"`
+
+		// Exit codes for any command in the task payload to be treated as
+		// success (with a warning in the task log), so that subsequent task
+		// commands are run, and if they succeed, the task is resolved as
+		// `completed/completed`. Commands that exit with these exit codes
+		// are not retried by `retryPolicies`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		Success []int64 `json:"success,omitempty"`
 	}
 
 	// Feature flags enable additional functionality.
@@ -150,6 +348,92 @@ type (
 	// Since: generic-worker 5.3.0
 	FeatureFlags struct {
 
+		// If enabled, the Android emulator configured on the worker is booted
+		// from its snapshot before the task commands run, and shut down
+		// without saving its state after they complete, so that each task
+		// starts from the same snapshot. The environment variables
+		// `ANDROID_SERIAL`, `ANDROID_ADB_SERVER_PORT` and
+		// `ANDROID_EMULATOR_CONSOLE_PORT` are set for the task commands, so
+		// that `adb` connects to the emulator. The emulator log (logcat) is
+		// published as artifact `public/logs/logcat.txt`. Requires scope
+		// `generic-worker:android-emulator:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		AndroidEmulator bool `json:"androidEmulator,omitempty"`
+
+		// If enabled, the operating system is configured so that any task
+		// process that crashes writes a dump (a minidump via Windows Error
+		// Reporting on Windows, a core file via `core_pattern` on Linux, or a
+		// core file and ReportCrash report on macOS) to a directory that is
+		// collected by the worker when the task commands complete. Dumps are
+		// published as artifacts named
+		// `public/crashdumps/<executable>.<pid>.<timestamp>.<extension>` so
+		// that they can be matched to symbols for the crashing executable.
+		//
+		// Since: generic-worker 28.1.0
+		CrashDumps bool `json:"crashDumps,omitempty"`
+
+		// If enabled, task commands run without network access, for example
+		// to verify that a build is hermetic. On Linux, task commands run in
+		// an empty network namespace, unless the worker config setting
+		// `taskIsolation` already isolates them from the network; on macOS,
+		// this requires worker config setting `taskIsolation` to be
+		// `sandboxExec`. Not supported on FreeBSD. Attempts to use the network
+		// fail straight away, and on Linux the number of attempts is reported in
+		// the task log. Cannot be combined with feature `network`. The worker
+		// config setting `disableNetwork` enables this for all tasks.
+		//
+		// Since: generic-worker 28.1.0
+		DisableNetwork bool `json:"disableNetwork,omitempty"`
+
+		// If the worker config setting `taskIsolation` is `bubblewrap` (Linux)
+		// or `sandboxExec` (macOS), task commands run without network access,
+		// unless this is enabled. Requires scope
+		// `generic-worker:network:<provisionerId>/<workerType>`. Has no effect
+		// on workers that don't isolate tasks.
+		//
+		// Since: generic-worker 28.1.0
+		Network bool `json:"network,omitempty"`
+
+		// If enabled, the template expressions in the arguments of `command`,
+		// the values of `env`, and the `path` of each of `artifacts` are
+		// expanded when the task starts (see the description of the payload).
+		// Without it, text such as `{{taskId}}` is passed to the task as is.
+		//
+		// Since: generic-worker 28.1.0
+		PayloadTemplates bool `json:"payloadTemplates,omitempty"`
+
+		// If enabled, task commands can report the progress of the task by
+		// POSTing JSON such as
+		// `{"percentage": 42.5, "step": "Linking", "eta": "2020-06-01T14:30:00.000Z"}`
+		// to the URL in environment variable `TASKCLUSTER_PROGRESS_URL`, where
+		// `percentage` (between 0 and 100) is required and `step` and `eta`
+		// (when the task expects to complete) are optional. The latest report
+		// is published as artifact `public/progress.json`, which is updated
+		// every `progressUpdateIntervalSecs` seconds (a worker config setting)
+		// while the task runs, and once more when the task commands complete,
+		// so that dashboards can show the progress of long running tasks.
+		//
+		// Since: generic-worker 28.1.0
+		Progress bool `json:"progress,omitempty"`
+
+		// If enabled, the worker computes a hash of the task payload together
+		// with the SHA256 of all content mounted or fetched into the task
+		// directory. If an earlier task with the same hash completed
+		// successfully on this worker type, the task commands are not run, and
+		// instead the artifacts of the earlier task are re-exposed as redirect
+		// artifacts, and the task resolves as completed. Otherwise, if the task
+		// completes successfully, it is recorded in the index under namespace
+		// `generic-worker.result-cache.<provisionerId>.<workerType>.<hash>` for
+		// future tasks to reuse. The hash also covers the scopes and routes of
+		// the task. Only enable this for deterministic tasks.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:result-cache:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		ResultCache bool `json:"resultCache,omitempty"`
+
 		// The taskcluster proxy provides an easy and safe way to make authenticated
 		// taskcluster requests within the scope(s) of a particular task. See
 		// [the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.
@@ -158,8 +442,86 @@ type (
 		TaskclusterProxy bool `json:"taskclusterProxy,omitempty"`
 	}
 
+	// An artifact of an upstream task to download. Exactly one of `taskId`
+	// and `namespace` must be provided.
+	//
+	// Since: generic-worker 28.1.0
+	Fetch struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// The name of the artifact to download from the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 1024
+		Artifact string `json:"artifact"`
+
+		// If provided, the artifact is treated as an archive of the given
+		// format, and is extracted into `path`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format,omitempty"`
+
+		// An index namespace (e.g. `project.example.latest.linux64`) which
+		// is resolved to a `taskId` via the index service when the task
+		// starts. The resolved `taskId` is recorded, together with the SHA256
+		// of the fetched content, in the artifact `public/resolved-fetches.json`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Max length: 255
+		Namespace string `json:"namespace,omitempty"`
+
+		// The location, relative to the task directory, to place the artifact.
+		// If `format` is provided, this is the directory into which the
+		// artifact is extracted, otherwise it is the file the artifact is
+		// copied to.
+		//
+		// Since: generic-worker 28.1.0
+		Path string `json:"path"`
+
+		// The required SHA 256 of the artifact content.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// The `taskId` of the task that published the artifact.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$
+		TaskID string `json:"taskId,omitempty"`
+	}
+
 	FileMount struct {
 
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// One of:
 		//   * ArtifactContent
 		//   * URLContent
@@ -173,15 +535,94 @@ type (
 		File string `json:"file"`
 	}
 
+	FileToWrite struct {
+
+		// The content of the file, base64 encoded, for binary content. At
+		// most one of `content` and `base64` may be set.
+		//
+		// Since: generic-worker 28.1.0
+		Base64 string `json:"base64,omitempty"`
+
+		// The content of the file, as UTF-8 text. At most one of `content`
+		// and `base64` may be set, and the file is empty if neither is.
+		//
+		// Since: generic-worker 28.1.0
+		Content string `json:"content,omitempty"`
+
+		// The permissions of the file, in octal, e.g. `"0755"` for an
+		// executable script. Ignored on Windows.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "0644"
+		// Syntax:     ^0?[0-7]{3}$
+		Mode string `json:"mode,omitempty"`
+
+		// The path, relative to the task directory, of the file to write.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Path string `json:"path"`
+	}
+
 	// This schema defines the structure of the `payload` property referred to in a
 	// Taskcluster Task definition.
+	//
+	// If `features.payloadTemplates` is enabled, the arguments of `command`, the
+	// values of `env`, and the `path` of each of `artifacts` may contain template
+	// expressions, which the worker expands when the task starts:
+	//
+	//   * `{{taskId}}`, `{{runId}}` and `{{taskGroupId}}` - the IDs of the task
+	//   * `{{workerGroup}}`, `{{workerId}}` and `{{workerPoolId}}` - the IDs of the
+	//     worker
+	//   * `{{cachePath "<cacheName>"}}` - the `directory` of the writable
+	//     directory cache mount with cache name `<cacheName>`
+	//   * `{{fetchPath "<artifact>"}}` - the `path` of the fetch of the artifact
+	//     with name (or base name) `<artifact>`
+	//
+	// Paths are relative to the task directory. Other text between `{{` and `}}`
+	// is left as is.
+	//
+	// Since: generic-worker 28.1.0
 	GenericWorkerPayload struct {
 
+		// Settings for publishing artifact `public/annotations.json`, which
+		// summarizes the errors and warnings of the task, so that CI user
+		// interfaces can show them without parsing the task log. When the task
+		// commands complete, each line of the task log is matched against
+		// `errorPatterns` and `warningPatterns`, TAP output is parsed if `tap` is
+		// enabled, and the JUnit XML reports listed in `junitReports` are parsed.
+		// Annotations found in the task log have the line number and byte offset
+		// of the line in artifact `public/logs/live_backing.log`. At most 1000
+		// annotations are published, although all are counted.
+		//
+		// Since: generic-worker 28.1.0
+		Annotations TaskAnnotations `json:"annotations,omitempty"`
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
 		// Artifacts to be published.
 		//
 		// Since: generic-worker 1.0.0
 		Artifacts []Artifact `json:"artifacts,omitempty"`
 
+		// Rate limits for transfers made by the worker on behalf of this task.
+		// These apply in addition to any limits configured for the worker as a
+		// whole (config settings `maxDownloadBytesPerSec` and
+		// `maxUploadBytesPerSec`), so can only further reduce bandwidth usage.
+		//
+		// Since: generic-worker 28.1.0
+		BandwidthLimits BandwidthLimits `json:"bandwidthLimits,omitempty"`
+
 		// One array per command (each command is an array of arguments). Several arrays
 		// for several commands.
 		//
@@ -191,6 +632,22 @@ type (
 		// Array items:
 		Command [][]string `json:"command"`
 
+		// Runs each task command under `strace -f` or `perf record -g`, and
+		// publishes the output of each command as an artifact named
+		// `<artifactPrefix>command_<index>.strace` or
+		// `<artifactPrefix>command_<index>.perf.data` (where `<index>` is the
+		// zero-based command index, zero-padded to six digits). This is intended
+		// for diagnosing hangs and performance regressions without modifying task
+		// scripts. The requested tool must be installed on the worker, otherwise
+		// the task will resolve as `malformed-payload`. Tracing is only supported
+		// on Linux.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:command-trace:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		CommandTrace CommandTrace `json:"commandTrace,omitempty"`
+
 		// Env vars must be string to __string__ mappings (not number or boolean). For example:
 		// ```
 		// {
@@ -224,6 +681,82 @@ type (
 		// Since: generic-worker 5.3.0
 		Features FeatureFlags `json:"features,omitempty"`
 
+		// Artifacts of upstream tasks to be downloaded before the task commands
+		// run. Each fetch refers to an artifact of a task, identified either
+		// directly by `taskId`, or indirectly by an index `namespace` which is
+		// resolved to a `taskId` when the task starts. Fetches are downloaded in
+		// parallel, retried on transient failures, verified against `sha256` (if
+		// provided) and cached on the worker between tasks, in the same way as
+		// file mounts.
+		//
+		// Tasks referenced by `taskId` must be listed in `task.dependencies`.
+		// Fetching a non-public artifact (i.e. not starting with `public/`)
+		// requires scope `queue:get-artifact:<artifact-name>`.
+		//
+		// Since: generic-worker 28.1.0
+		Fetches []Fetch `json:"fetches,omitempty"`
+
+		// Hostname to IP address overrides that apply to the task commands (and
+		// to container services), for example to run hermetic tests against
+		// staged services without modifying images. The overrides are written
+		// to a task-scoped hosts file, `generic-worker/hosts` in the task
+		// directory, which is a copy of the worker's `/etc/hosts` preceded by
+		// the overrides (so that they take precedence), and which is mounted
+		// over `/etc/hosts` inside the task's sandbox. Host aliases therefore require config setting
+		// `taskIsolation` to be `bubblewrap` (only supported on Linux), and the
+		// `hostAliases` feature to be enabled in the worker config.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:host-aliases:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		HostAliases []HostAlias `json:"hostAliases,omitempty"`
+
+		// Creates and boots a new iOS simulator of the given device type and
+		// runtime for the task, as the task user, before the task commands
+		// run. The UDID of the simulator is available to the task commands in
+		// environment variable `SIMULATOR_UDID`, so that it can be passed to
+		// e.g. `xcodebuild -destination id=$SIMULATOR_UDID` or
+		// `xcrun simctl`. After the task commands complete, the simulator is
+		// shut down and deleted, so that no simulator state is carried over to
+		// subsequent tasks. The simulator log is published as artifact
+		// `public/logs/simulator.log`. iOS simulators are only supported on
+		// macOS, and require the `iosSimulator` feature to be enabled in the
+		// worker config.
+		//
+		// Use of this feature requires scope
+		// `generic-worker:ios-simulator:<provisionerId>/<workerType>`.
+		//
+		// Since: generic-worker 28.1.0
+		IosSimulator IOSSimulator `json:"iosSimulator,omitempty"`
+
+		// Creates a new keychain for the task before the task commands run,
+		// imports the given code signing certificates into it from the secrets
+		// service, unlocks it, and adds it to the keychain search list of the
+		// task user, so that `codesign`, `productsign` and `xcodebuild` can use
+		// the certificates without prompting. The path of the keychain is
+		// available to the task commands in environment variable
+		// `KEYCHAIN_PATH`. After the task commands complete, the keychain is
+		// deleted. Keychains are only supported on macOS, and require the
+		// `keychain` feature to be enabled in the worker config.
+		//
+		// Use of this feature requires scope `secrets:get:<secret>` for the
+		// secret of each certificate.
+		//
+		// Since: generic-worker 28.1.0
+		Keychain MacOSKeychain `json:"keychain,omitempty"`
+
+		// The maximum total size in megabytes of the artifacts of
+		// `task.payload.artifacts`. If the artifacts are larger, none of them
+		// are uploaded, and the task resolves as failed, listing its largest
+		// artifacts. This applies in addition to any limit configured for the
+		// worker (config setting `maxTaskArtifactsMB`), so can only lower it.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		MaxArtifactsMB int64 `json:"maxArtifactsMB,omitempty"`
+
 		// Maximum time the task container can run in seconds.
 		//
 		// Since: generic-worker 0.0.1
@@ -258,6 +791,126 @@ type (
 		// Array items:
 		OSGroups []string `json:"osGroups,omitempty"`
 
+		// Groups the task commands into named phases (for example `setup`,
+		// `build`, `test` and `package`), each of which is a run of
+		// consecutive commands. The numbers of commands of the phases must add
+		// up to the number of task commands. The worker writes
+		// Treeherder-compatible step markers to the task log at the start and
+		// end of each phase, and publishes the duration and outcome of each
+		// phase as artifact `public/phases.json`. Phases whose commands did not
+		// all run (because an earlier command failed, or the task was aborted)
+		// are reported with state `failed`, `aborted` or `skipped`.
+		//
+		// Since: generic-worker 28.1.0
+		Phases []Phase `json:"phases,omitempty"`
+
+		// Ports that the worker leases to the task for the duration of the task,
+		// each exposed to the task commands (and to any services) in an
+		// environment variable. Leased ports are taken from the worker's
+		// configured port lease range, and are not leased to any other task on
+		// the same host (including tasks of other workers that share the same
+		// `portLeasesDir`) until the task resolves. Use this instead of
+		// hard-coded port numbers to avoid clashes between concurrent tasks. The
+		// leased ports are listed in the task log.
+		//
+		// Since: generic-worker 28.1.0
+		PortLeases []PortLease `json:"portLeases,omitempty"`
+
+		// Settings for tasks that produce reproducible artifacts. Environment
+		// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+		// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+		// in `env`. The resolved settings are listed in the task log, and are
+		// recorded in the chain of trust certificate of the task (if the
+		// `chainOfTrust` feature is enabled).
+		//
+		// Since: generic-worker 28.1.0
+		Reproducible ReproducibleBuildEnvironment `json:"reproducible,omitempty"`
+
+		// Names of artifacts that the task must publish in order to resolve
+		// successfully, such as `public/build/target.tar.gz`. If any of them was
+		// not uploaded (for example because the file of an artifact of
+		// `task.payload.artifacts` does not exist, so an error artifact was
+		// uploaded instead) the task resolves as failed, listing the missing
+		// artifacts. This protects against tasks that succeed without producing
+		// their outputs.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    []
+		//
+		// Array items:
+		RequiredArtifacts []string `json:"requiredArtifacts,omitempty"`
+
+		// Policy for rerunning all of the task commands, from the first command,
+		// when the task fails with a known intermittent failure signature, so
+		// that intermittent failures don't need a new task run (and worker) to
+		// be retried. A task fails with a failure signature if the failing
+		// command exits with one of `exitCodes`, or if a line of the output of
+		// the failed attempt matches one of `logPatterns`. The task is rerun at
+		// most `maxReruns` times, after which it is resolved as `failed`. Each
+		// attempt is logged in its own section of the task log, and reported
+		// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+		// directory, so the task commands need to cope with files left behind
+		// by earlier attempts. Time spent rerunning counts towards
+		// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+		// and `onExitStatus.retry`, which resolves the task as
+		// `exception/intermittent-task` so that the queue creates a new run,
+		// reruns happen within the same run.
+		//
+		// Since: generic-worker 28.1.0
+		Rerun TaskRerunPolicy `json:"rerun,omitempty"`
+
+		// Policies for retrying task commands that fail transiently (for
+		// example because of flaky network operations), so that task scripts
+		// don't need their own retry loops. A task command that has a retry
+		// policy, and fails, is run again after a delay, until it succeeds or
+		// has been attempted `maxAttempts` times. The delay is `backoffSeconds`
+		// before the second attempt, and doubles before each further attempt,
+		// up to `maxBackoffSeconds`. Time spent retrying counts towards
+		// `maxRunTime`. Only the result of the final attempt of a command
+		// determines the outcome of the task (including `onExitStatus`
+		// handling).
+		//
+		// Since: generic-worker 28.1.0
+		RetryPolicies []CommandRetryPolicy `json:"retryPolicies,omitempty"`
+
+		// Publishes a software bill of materials (SBOM) of the task when the task
+		// commands complete, as artifact `public/sbom.cdx.json` (CycloneDX 1.4)
+		// or `public/sbom.spdx.json` (SPDX 2.3). The SBOM lists the content
+		// mounted or fetched into the task, such as toolchains, with its SHA 256,
+		// and the packages listed in `manifests`. On workers with chain of trust
+		// enabled, the SBOM is covered by the chain of trust certificate of the
+		// task, like any other artifact.
+		//
+		// Since: generic-worker 28.1.0
+		Sbom SoftwareBillOfMaterials `json:"sbom,omitempty"`
+
+		// Secrets from the taskcluster secrets service to inject into the task,
+		// as environment variables of the task commands, or as files in the task
+		// directory. The worker fetches the secrets with the task credentials, so
+		// the task requires scope `secrets:get:<name>` for each secret. Secret
+		// values are redacted from the task log, and secret files are deleted
+		// when the task ends. Secrets require the `secrets` feature to be enabled
+		// in the worker config.
+		//
+		// Since: generic-worker 28.1.0
+		Secrets []Secret `json:"secrets,omitempty"`
+
+		// Auxiliary long-running services (for example databases, a Selenium
+		// grid or a local registry) that are started before the task commands
+		// run, and killed after they complete. A service is either a process,
+		// which runs in the task directory as the task user, or a docker
+		// container, which requires docker to be installed on the worker. A
+		// service may have a health check, in which case the next service (or
+		// the task commands) are only started once it passes, and the task
+		// fails if it doesn't pass in time. The output of each service is
+		// published as artifact `public/logs/services/<name>.log`.
+		//
+		// Requires the `services` feature to be enabled in the worker config.
+		//
+		// Since: generic-worker 28.1.0
+		Services []Service `json:"services,omitempty"`
+
 		// URL of a service that can indicate tasks superseding this one; the current `taskId`
 		// will be appended as a query argument `taskId`. The service should return an object with
 		// a `supersedes` key containing a list of `taskId`s, including the supplied `taskId`. The
@@ -268,66 +921,582 @@ type (
 		//
 		// Since: generic-worker 10.2.2
 		SupersederURL string `json:"supersederUrl,omitempty"`
-	}
 
-	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
-	//
-	// Since: generic-worker 11.1.0
-	RawContent struct {
+		// If true, each line that the task commands write to the task log is
+		// prefixed with the output stream that it was written to, `[stdout] ` or
+		// `[stderr] `. Otherwise both streams share a single pipe, so output is
+		// written to the task log in exactly the order that it was written.
+		// Tagged streams have a pipe each, and are written to the task log in
+		// the order that the worker reads them, so output written to both
+		// streams within microseconds of each other may be reordered. A line
+		// that is still incomplete when the other stream is written to is
+		// ended, so that every line has a single source.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		TagOutputStreams bool `json:"tagOutputStreams,omitempty"`
 
-		// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
+		// JUnit (or XUnit) XML reports of the task to summarize. When the task
+		// commands complete, the reports matching `paths` are parsed, and
+		// artifact `public/test-results.json` is published with the number of
+		// tests that passed, failed, errored and were skipped, the slowest
+		// tests, and the failed tests, which are also listed in the task log.
 		//
-		// Since: generic-worker 11.1.0
+		// Since: generic-worker 28.1.0
+		TestResults TestResults `json:"testResults,omitempty"`
+
+		// Path, relative to the task directory, of a disk image (typically
+		// provided by a file mount) to boot the task VM from, instead of the
+		// worker's configured image, for example to test operating system
+		// installers or kernels. The image is not modified, since the VM boots
+		// from a copy-on-write overlay of it. Only supported on Linux workers
+		// whose worker config setting `taskIsolation` is `qemu`.
 		//
-		// Max length: 65536
-		Raw string `json:"raw"`
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		VMImage string `json:"vmImage,omitempty"`
+
+		// Files to create in the task directory before the task commands run,
+		// with inline content, which avoids quoting file content in the task
+		// commands, whose quoting rules differ between shells and platforms.
+		// Parent directories are created as needed, and existing files are
+		// replaced.
+		//
+		// Since: generic-worker 28.1.0
+		WriteFiles []FileToWrite `json:"writeFiles,omitempty"`
 	}
 
-	ReadOnlyDirectory struct {
+	// How to determine that the service is ready. Exactly one of
+	// `tcpPort` and `httpUrl` must be specified.
+	//
+	// Since: generic-worker 28.1.0
+	HealthCheck struct {
 
-		// One of:
-		//   * ArtifactContent
-		//   * URLContent
-		//   * RawContent
-		//   * Base64Content
-		Content json.RawMessage `json:"content"`
+		// The service is healthy once a GET request to this URL
+		// returns a 2xx status code.
+		//
+		// Since: generic-worker 28.1.0
+		HTTPURL string `json:"httpUrl,omitempty"`
 
-		// The filesystem location to mount the directory volume.
+		// The service is healthy once it accepts connections on this
+		// port of the worker's loopback interface.
 		//
-		// Since: generic-worker 5.4.0
-		Directory string `json:"directory"`
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		// Maximum:    65535
+		TCPPort int64 `json:"tcpPort,omitempty"`
 
-		// Archive format of content for read only directory.
+		// How long to wait for the service to become healthy.
 		//
-		// Since: generic-worker 5.4.0
+		// Since: generic-worker 28.1.0
 		//
-		// Possible values:
-		//   * "rar"
-		//   * "tar.bz2"
-		//   * "tar.gz"
-		//   * "zip"
-		Format string `json:"format"`
+		// Default:    60
+		// Mininum:    1
+		// Maximum:    3600
+		TimeoutSeconds int64 `json:"timeoutSeconds,omitempty"`
 	}
 
-	// URL to download content from.
-	//
-	// Since: generic-worker 5.4.0
-	URLContent struct {
+	HostAlias struct {
 
-		// The required SHA 256 of the content body.
+		// The hostname to resolve to `ip`.
 		//
-		// Since: generic-worker 10.8.0
+		// Since: generic-worker 28.1.0
 		//
-		// Syntax:     ^[a-f0-9]{64}$
-		Sha256 string `json:"sha256,omitempty"`
+		// Syntax:     ^[a-zA-Z0-9]([a-zA-Z0-9.-]{0,251}[a-zA-Z0-9])?$
+		Hostname string `json:"hostname"`
 
-		// URL to download content from.
+		// The IPv4 or IPv6 address that `hostname` resolves to.
 		//
-		// Since: generic-worker 5.4.0
-		URL string `json:"url"`
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		IP string `json:"ip"`
 	}
 
-	WritableDirectoryCache struct {
+	// Creates and boots a new iOS simulator of the given device type and
+	// runtime for the task, as the task user, before the task commands
+	// run. The UDID of the simulator is available to the task commands in
+	// environment variable `SIMULATOR_UDID`, so that it can be passed to
+	// e.g. `xcodebuild -destination id=$SIMULATOR_UDID` or
+	// `xcrun simctl`. After the task commands complete, the simulator is
+	// shut down and deleted, so that no simulator state is carried over to
+	// subsequent tasks. The simulator log is published as artifact
+	// `public/logs/simulator.log`. iOS simulators are only supported on
+	// macOS, and require the `iosSimulator` feature to be enabled in the
+	// worker config.
+	//
+	// Use of this feature requires scope
+	// `generic-worker:ios-simulator:<provisionerId>/<workerType>`.
+	//
+	// Since: generic-worker 28.1.0
+	IOSSimulator struct {
+
+		// The device type of the simulator, as a name or identifier listed by
+		// `xcrun simctl list devicetypes`, for example `iPhone 14` or
+		// `com.apple.CoreSimulator.SimDeviceType.iPhone-14`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		DeviceType string `json:"deviceType"`
+
+		// The runtime of the simulator, as a name or identifier listed by
+		// `xcrun simctl list runtimes`, for example `iOS 16.4` or
+		// `com.apple.CoreSimulator.SimRuntime.iOS-16-4`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Runtime string `json:"runtime"`
+	}
+
+	// Creates a new keychain for the task before the task commands run,
+	// imports the given code signing certificates into it from the secrets
+	// service, unlocks it, and adds it to the keychain search list of the
+	// task user, so that `codesign`, `productsign` and `xcodebuild` can use
+	// the certificates without prompting. The path of the keychain is
+	// available to the task commands in environment variable
+	// `KEYCHAIN_PATH`. After the task commands complete, the keychain is
+	// deleted. Keychains are only supported on macOS, and require the
+	// `keychain` feature to be enabled in the worker config.
+	//
+	// Use of this feature requires scope `secrets:get:<secret>` for the
+	// secret of each certificate.
+	//
+	// Since: generic-worker 28.1.0
+	MacOSKeychain struct {
+
+		// The certificates, with their private keys, to import into the
+		// keychain.
+		//
+		// Since: generic-worker 28.1.0
+		Certificates []Certificate `json:"certificates"`
+	}
+
+	Phase struct {
+
+		// The number of consecutive task commands in the phase, following
+		// the commands of the previous phases.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		Commands int64 `json:"commands"`
+
+		// The name of the phase, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		// Max length: 100
+		Name string `json:"name"`
+	}
+
+	PortLease struct {
+
+		// The name of the environment variable that holds the leased port
+		// number, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]{0,63}$
+		Name string `json:"name"`
+
+		// The protocol that the port must be free for.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "tcp"
+		//   * "udp"
+		//
+		// Default:    "tcp"
+		Protocol string `json:"protocol,omitempty"`
+	}
+
+	// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
+	//
+	// Since: generic-worker 11.1.0
+	RawContent struct {
+
+		// Byte-for-byte literal inline content of file/archive, up to 64KB in size.
+		//
+		// Since: generic-worker 11.1.0
+		//
+		// Max length: 65536
+		Raw string `json:"raw"`
+	}
+
+	ReadOnlyDirectory struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
+
+		// One of:
+		//   * ArtifactContent
+		//   * URLContent
+		//   * RawContent
+		//   * Base64Content
+		Content json.RawMessage `json:"content"`
+
+		// The filesystem location to mount the directory volume.
+		//
+		// Since: generic-worker 5.4.0
+		Directory string `json:"directory"`
+
+		// Archive format of content for read only directory.
+		//
+		// Since: generic-worker 5.4.0
+		//
+		// Possible values:
+		//   * "rar"
+		//   * "tar.bz2"
+		//   * "tar.gz"
+		//   * "zip"
+		Format string `json:"format"`
+	}
+
+	// Settings for tasks that produce reproducible artifacts. Environment
+	// variable `SOURCE_DATE_EPOCH` is set to `sourceDateEpoch`, `TZ` to
+	// `timezone`, and `LANG` and `LC_ALL` to `locale`, overriding any values
+	// in `env`. The resolved settings are listed in the task log, and are
+	// recorded in the chain of trust certificate of the task (if the
+	// `chainOfTrust` feature is enabled).
+	//
+	// Since: generic-worker 28.1.0
+	ReproducibleBuildEnvironment struct {
+
+		// If true, the task commands are run with libfaketime preloaded
+		// (config setting `faketimeLibrary`), so that the clock of the task
+		// starts at `sourceDateEpoch` and advances normally from there.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Faketime bool `json:"faketime,omitempty"`
+
+		// The value of `LANG` and `LC_ALL`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "C.UTF-8"
+		Locale string `json:"locale,omitempty"`
+
+		// The value of `SOURCE_DATE_EPOCH`, in seconds since the Unix epoch.
+		// If not specified (or 0), the creation time of the task is used, so
+		// that reruns of the task use the same value.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    0
+		SourceDateEpoch int64 `json:"sourceDateEpoch,omitempty"`
+
+		// The value of `TZ`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    "UTC"
+		Timezone string `json:"timezone,omitempty"`
+	}
+
+	Secret struct {
+
+		// The name of the environment variable to inject the secret as.
+		// Exactly one of `env` and `file` must be set.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z_][a-zA-Z0-9_]*$
+		Env string `json:"env,omitempty"`
+
+		// The path, relative to the task directory, of the file to write
+		// the secret to. The file is only readable by the task user.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		File string `json:"file,omitempty"`
+
+		// The property of the secret value to inject. If not set, the whole
+		// secret value is injected as JSON. String properties are injected
+		// as is, other properties as JSON.
+		//
+		// Since: generic-worker 28.1.0
+		Key string `json:"key,omitempty"`
+
+		// The name of the secret in the taskcluster secrets service.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Name string `json:"name"`
+	}
+
+	Service struct {
+
+		// The command line of a process service, or the arguments passed
+		// to the container of a container service. Required unless `image`
+		// is specified.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		Command []string `json:"command,omitempty"`
+
+		// Environment variables of the service, in addition to (or
+		// overriding) the task environment variables for process
+		// services.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Map entries:
+		Env map[string]string `json:"env,omitempty"`
+
+		// How to determine that the service is ready. Exactly one of
+		// `tcpPort` and `httpUrl` must be specified.
+		//
+		// Since: generic-worker 28.1.0
+		HealthCheck HealthCheck `json:"healthCheck,omitempty"`
+
+		// The docker image to run the service from, which makes the
+		// service a container service.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Min length: 1
+		Image string `json:"image,omitempty"`
+
+		// Names of port leases (see `portLeases`) that a container service
+		// listens on, which are published on the same port of the worker's
+		// loopback interface. Unlike `ports`, these don't clash with other
+		// tasks running on the same host.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		LeasedPorts []string `json:"leasedPorts,omitempty"`
+
+		// The name of the service, which must be unique within the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Syntax:     ^[a-zA-Z0-9_.-]{1,64}$
+		Name string `json:"name"`
+
+		// Ports of a container service that are published on the same port
+		// of the worker's loopback interface, so that task commands can
+		// connect to them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		// Maximum:    65535
+		Ports []int64 `json:"ports,omitempty"`
+	}
+
+	// Publishes a software bill of materials (SBOM) of the task when the task
+	// commands complete, as artifact `public/sbom.cdx.json` (CycloneDX 1.4)
+	// or `public/sbom.spdx.json` (SPDX 2.3). The SBOM lists the content
+	// mounted or fetched into the task, such as toolchains, with its SHA 256,
+	// and the packages listed in `manifests`. On workers with chain of trust
+	// enabled, the SBOM is covered by the chain of trust certificate of the
+	// task, like any other artifact.
+	//
+	// Since: generic-worker 28.1.0
+	SoftwareBillOfMaterials struct {
+
+		// The format of the SBOM.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Possible values:
+		//   * "cyclonedx"
+		//   * "spdx"
+		Format string `json:"format"`
+
+		// Paths, relative to the task directory, of package manifests that
+		// the task commands write, for example while installing packages.
+		// Each manifest is a JSON array of packages, each with a `name`, and
+		// optionally a `version` and [package URL](https://github.com/package-url/purl-spec)
+		// (`purl`), e.g. `[{"name": "requests", "version": "2.25.1", "purl": "pkg:pypi/requests@2.25.1"}]`.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Manifests []string `json:"manifests,omitempty"`
+	}
+
+	// Settings for publishing artifact `public/annotations.json`, which
+	// summarizes the errors and warnings of the task, so that CI user
+	// interfaces can show them without parsing the task log. When the task
+	// commands complete, each line of the task log is matched against
+	// `errorPatterns` and `warningPatterns`, TAP output is parsed if `tap` is
+	// enabled, and the JUnit XML reports listed in `junitReports` are parsed.
+	// Annotations found in the task log have the line number and byte offset
+	// of the line in artifact `public/logs/live_backing.log`. At most 1000
+	// annotations are published, although all are counted.
+	//
+	// Since: generic-worker 28.1.0
+	TaskAnnotations struct {
+
+		// Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))
+		// that lines of the task log which report errors match.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		ErrorPatterns []string `json:"errorPatterns,omitempty"`
+
+		// Paths, relative to the task directory, of JUnit XML reports that the
+		// task commands write. Each test case with a failure or error is
+		// reported as an error. Missing reports are noted in the task log,
+		// but don't fail the task.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		JunitReports []string `json:"junitReports,omitempty"`
+
+		// If true, [TAP](https://testanything.org/) test results in the task
+		// log are parsed, and each failed test (`not ok`, unless marked
+		// `# TODO` or `# SKIP`) and `Bail out!` is reported as an error.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		Tap bool `json:"tap,omitempty"`
+
+		// Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))
+		// that lines of the task log which report warnings match. Lines that
+		// match one of `errorPatterns` are not also reported as warnings.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		WarningPatterns []string `json:"warningPatterns,omitempty"`
+	}
+
+	// Policy for rerunning all of the task commands, from the first command,
+	// when the task fails with a known intermittent failure signature, so
+	// that intermittent failures don't need a new task run (and worker) to
+	// be retried. A task fails with a failure signature if the failing
+	// command exits with one of `exitCodes`, or if a line of the output of
+	// the failed attempt matches one of `logPatterns`. The task is rerun at
+	// most `maxReruns` times, after which it is resolved as `failed`. Each
+	// attempt is logged in its own section of the task log, and reported
+	// as a `taskRerun` WORKER_METRICS event. Reruns use the same task
+	// directory, so the task commands need to cope with files left behind
+	// by earlier attempts. Time spent rerunning counts towards
+	// `maxRunTime`. Unlike `retryPolicies`, which retry a single command,
+	// and `onExitStatus.retry`, which resolves the task as
+	// `exception/intermittent-task` so that the queue creates a new run,
+	// reruns happen within the same run.
+	//
+	// Since: generic-worker 28.1.0
+	TaskRerunPolicy struct {
+
+		// Exit codes that cause the task commands to be rerun, if a task
+		// command exits with them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Mininum:    1
+		ExitCodes []int64 `json:"exitCodes,omitempty"`
+
+		// Regular expressions (in Go syntax) that cause the task commands to
+		// be rerun, if a line of the task log written during the failed
+		// attempt matches them.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		LogPatterns []string `json:"logPatterns,omitempty"`
+
+		// The maximum number of times the task commands are rerun, not
+		// including the first attempt.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Mininum:    1
+		// Maximum:    5
+		MaxReruns int64 `json:"maxReruns"`
+	}
+
+	// JUnit (or XUnit) XML reports of the task to summarize. When the task
+	// commands complete, the reports matching `paths` are parsed, and
+	// artifact `public/test-results.json` is published with the number of
+	// tests that passed, failed, errored and were skipped, the slowest
+	// tests, and the failed tests, which are also listed in the task log.
+	//
+	// Since: generic-worker 28.1.0
+	TestResults struct {
+
+		// If true, the task fails if no reports match `paths`, or if a
+		// matching report cannot be parsed, so that a test harness which
+		// crashes without writing its results doesn't go unnoticed.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Default:    false
+		FailIfMissing bool `json:"failIfMissing,omitempty"`
+
+		// Paths of the reports, relative to the task directory, which may
+		// contain the wildcards of [filepath.Match](https://golang.org/pkg/path/filepath/#Match),
+		// e.g. `build/test-results/TEST-*.xml`. Wildcards don't match path
+		// separators, so `**` is not supported.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Paths []string `json:"paths"`
+	}
+
+	// URL to download content from.
+	//
+	// Since: generic-worker 5.4.0
+	URLContent struct {
+
+		// The required SHA 256 of the content body.
+		//
+		// Since: generic-worker 10.8.0
+		//
+		// Syntax:     ^[a-f0-9]{64}$
+		Sha256 string `json:"sha256,omitempty"`
+
+		// URL to download content from.
+		//
+		// Since: generic-worker 5.4.0
+		URL string `json:"url"`
+	}
+
+	WritableDirectoryCache struct {
+
+		// A list of CPU architectures.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Possible values:
+		//   * "arm64"
+		//   * "x86_64"
+		Architectures []string `json:"architectures,omitempty"`
 
 		// Implies a read/write cache directory volume. A unique name for the
 		// cache volume. Requires scope `generic-worker:cache:<cache-name>`.
@@ -359,6 +1528,21 @@ type (
 		//   * "tar.gz"
 		//   * "zip"
 		Format string `json:"format,omitempty"`
+
+		// If provided, the cache is kept on the worker between tasks as a
+		// seekable zstd archive, and only the given paths of the cache
+		// (relative to `directory`) are extracted when it is mounted, which
+		// is much quicker than mounting the whole of a large cache when the
+		// task only needs part of it. Other paths of the cache are not
+		// available to the task, but are kept in the cache for later tasks.
+		// A task that mounts the cache without `paths` gets the whole cache.
+		// Requires `zstd` to be installed on the worker.
+		//
+		// Since: generic-worker 28.1.0
+		//
+		// Array items:
+		// Min length: 1
+		Paths []string `json:"paths,omitempty"`
 	}
 )
 
@@ -380,6 +1564,21 @@ func taskPayloadSchema() string {
   "$schema": "/schemas/common/metaschema.json#",
   "additionalProperties": false,
   "definitions": {
+    "architectures": {
+      "description": "A list of CPU architectures.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "enum": [
+          "arm64",
+          "x86_64"
+        ],
+        "title": "CPU architecture",
+        "type": "string"
+      },
+      "minItems": 1,
+      "title": "CPU architectures",
+      "type": "array",
+      "uniqueItems": true
+    },
     "content": {
       "oneOf": [
         {
@@ -468,9 +1667,71 @@ func taskPayloadSchema() string {
         }
       ]
     },
+    "fetch": {
+      "additionalProperties": false,
+      "description": "An artifact of an upstream task to download. Exactly one of ` + "`" + `taskId` + "`" + `\nand ` + "`" + `namespace` + "`" + ` must be provided.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
+        "artifact": {
+          "description": "The name of the artifact to download from the task.\n\nSince: generic-worker 28.1.0",
+          "maxLength": 1024,
+          "title": "Artifact name",
+          "type": "string"
+        },
+        "format": {
+          "description": "If provided, the artifact is treated as an archive of the given\nformat, and is extracted into ` + "`" + `path` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "rar",
+            "tar.bz2",
+            "tar.gz",
+            "zip"
+          ],
+          "title": "Format",
+          "type": "string"
+        },
+        "namespace": {
+          "description": "An index namespace (e.g. ` + "`" + `project.example.latest.linux64` + "`" + `) which\nis resolved to a ` + "`" + `taskId` + "`" + ` via the index service when the task\nstarts. The resolved ` + "`" + `taskId` + "`" + ` is recorded, together with the SHA256\nof the fetched content, in the artifact ` + "`" + `public/resolved-fetches.json` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "maxLength": 255,
+          "title": "Index namespace",
+          "type": "string"
+        },
+        "path": {
+          "description": "The location, relative to the task directory, to place the artifact.\nIf ` + "`" + `format` + "`" + ` is provided, this is the directory into which the\nartifact is extracted, otherwise it is the file the artifact is\ncopied to.\n\nSince: generic-worker 28.1.0",
+          "title": "Path",
+          "type": "string"
+        },
+        "sha256": {
+          "description": "The required SHA 256 of the artifact content.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[a-f0-9]{64}$",
+          "title": "SHA 256",
+          "type": "string"
+        },
+        "taskId": {
+          "description": "The ` + "`" + `taskId` + "`" + ` of the task that published the artifact.\n\nSince: generic-worker 28.1.0",
+          "pattern": "^[A-Za-z0-9_-]{8}[Q-T][A-Za-z0-9_-][CGKOSWaeimquy26-][A-Za-z0-9_-]{10}[AQgw]$",
+          "title": "Task ID",
+          "type": "string"
+        }
+      },
+      "required": [
+        "artifact",
+        "path"
+      ],
+      "title": "Fetch",
+      "type": "object"
+    },
     "fileMount": {
       "additionalProperties": false,
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "content": {
           "$ref": "#/definitions/content",
           "description": "Content of the file to be mounted.\n\nSince: generic-worker 5.4.0"
@@ -505,6 +1766,11 @@ func taskPayloadSchema() string {
     "readOnlyDirectory": {
       "additionalProperties": false,
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "content": {
           "$ref": "#/definitions/content",
           "description": "Contents of read only directory.\n\nSince: generic-worker 5.4.0",
@@ -546,6 +1812,11 @@ func taskPayloadSchema() string {
         ]
       },
       "properties": {
+        "architectures": {
+          "$ref": "#/definitions/architectures",
+          "description": "If provided, the entry only applies to tasks that run as one of the\ngiven CPU architectures (see ` + "`" + `task.payload.architectures` + "`" + `), so that\na task can mount or fetch the toolchain of the architecture it\nruns as.\n\nSince: generic-worker 28.1.0",
+          "title": "Architectures"
+        },
         "cacheName": {
           "description": "Implies a read/write cache directory volume. A unique name for the\ncache volume. Requires scope ` + "`" + `generic-worker:cache:\u003ccache-name\u003e` + "`" + `.\nNote if this cache is loaded from an artifact, you will also require\nscope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + ` to use this cache.\n\nSince: generic-worker 5.4.0",
           "title": "Cache Name",
@@ -571,6 +1842,17 @@ func taskPayloadSchema() string {
           ],
           "title": "Format",
           "type": "string"
+        },
+        "paths": {
+          "description": "If provided, the cache is kept on the worker between tasks as a\nseekable zstd archive, and only the given paths of the cache\n(relative to ` + "`" + `directory` + "`" + `) are extracted when it is mounted, which\nis much quicker than mounting the whole of a large cache when the\ntask only needs part of it. Other paths of the cache are not\navailable to the task, but are kept in the cache for later tasks.\nA task that mounts the cache without ` + "`" + `paths` + "`" + ` gets the whole cache.\nRequires ` + "`" + `zstd` + "`" + ` to be installed on the worker.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          },
+          "title": "Paths",
+          "type": "array",
+          "uniqueItems": true
         }
       },
       "required": [
@@ -581,8 +1863,57 @@ func taskPayloadSchema() string {
       "type": "object"
     }
   },
-  "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.",
+  "description": "This schema defines the structure of the ` + "`" + `payload` + "`" + ` property referred to in a\nTaskcluster Task definition.\n\nIf ` + "`" + `features.payloadTemplates` + "`" + ` is enabled, the arguments of ` + "`" + `command` + "`" + `, the\nvalues of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` may contain template\nexpressions, which the worker expands when the task starts:\n\n  * ` + "`" + `{{taskId}}` + "`" + `, ` + "`" + `{{runId}}` + "`" + ` and ` + "`" + `{{taskGroupId}}` + "`" + ` - the IDs of the task\n  * ` + "`" + `{{workerGroup}}` + "`" + `, ` + "`" + `{{workerId}}` + "`" + ` and ` + "`" + `{{workerPoolId}}` + "`" + ` - the IDs of the\n    worker\n  * ` + "`" + `{{cachePath \"\u003ccacheName\u003e\"}}` + "`" + ` - the ` + "`" + `directory` + "`" + ` of the writable\n    directory cache mount with cache name ` + "`" + `\u003ccacheName\u003e` + "`" + `\n  * ` + "`" + `{{fetchPath \"\u003cartifact\u003e\"}}` + "`" + ` - the ` + "`" + `path` + "`" + ` of the fetch of the artifact\n    with name (or base name) ` + "`" + `\u003cartifact\u003e` + "`" + `\n\nPaths are relative to the task directory. Other text between ` + "`" + `{{` + "`" + ` and ` + "`" + `}}` + "`" + `\nis left as is.\n\nSince: generic-worker 28.1.0",
   "properties": {
+    "annotations": {
+      "additionalProperties": false,
+      "description": "Settings for publishing artifact ` + "`" + `public/annotations.json` + "`" + `, which\nsummarizes the errors and warnings of the task, so that CI user\ninterfaces can show them without parsing the task log. When the task\ncommands complete, each line of the task log is matched against\n` + "`" + `errorPatterns` + "`" + ` and ` + "`" + `warningPatterns` + "`" + `, TAP output is parsed if ` + "`" + `tap` + "`" + ` is\nenabled, and the JUnit XML reports listed in ` + "`" + `junitReports` + "`" + ` are parsed.\nAnnotations found in the task log have the line number and byte offset\nof the line in artifact ` + "`" + `public/logs/live_backing.log` + "`" + `. At most 1000\nannotations are published, although all are counted.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "errorPatterns": {
+          "description": "Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))\nthat lines of the task log which report errors match.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Error patterns",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "junitReports": {
+          "description": "Paths, relative to the task directory, of JUnit XML reports that the\ntask commands write. Each test case with a failure or error is\nreported as an error. Missing reports are noted in the task log,\nbut don't fail the task.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "JUnit XML reports",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "tap": {
+          "default": false,
+          "description": "If true, [TAP](https://testanything.org/) test results in the task\nlog are parsed, and each failed test (` + "`" + `not ok` + "`" + `, unless marked\n` + "`" + `# TODO` + "`" + ` or ` + "`" + `# SKIP` + "`" + `) and ` + "`" + `Bail out!` + "`" + ` is reported as an error.\n\nSince: generic-worker 28.1.0",
+          "title": "Parse TAP output",
+          "type": "boolean"
+        },
+        "warningPatterns": {
+          "description": "Regular expressions ([RE2 syntax](https://github.com/google/re2/wiki/Syntax))\nthat lines of the task log which report warnings match. Lines that\nmatch one of ` + "`" + `errorPatterns` + "`" + ` are not also reported as warnings.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Warning patterns",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "title": "Task annotations",
+      "type": "object"
+    },
+    "architectures": {
+      "$ref": "#/definitions/architectures",
+      "description": "The CPU architectures that the task commands can run on, most\npreferred first. The task runs as the first of them that the worker\nsupports, either natively, or on macOS and Linux workers with Rosetta,\nas x86_64 by translation. If the worker supports none of them, the\ntask resolves as ` + "`" + `exception/malformed-payload` + "`" + `. The architecture that\nthe task runs as is available to the task commands in environment\nvariable ` + "`" + `TASK_ARCHITECTURE` + "`" + `, and selects which ` + "`" + `mounts` + "`" + ` and ` + "`" + `fetches` + "`" + `\napply to the task (see their ` + "`" + `architectures` + "`" + ` property). If not\nprovided, the task runs as the native architecture of the worker.\n\nSince: generic-worker 28.1.0",
+      "title": "Architectures"
+    },
     "artifacts": {
       "description": "Artifacts to be published.\n\nSince: generic-worker 1.0.0",
       "items": {
@@ -618,6 +1949,12 @@ func taskPayloadSchema() string {
             "title": "Artifact location",
             "type": "string"
           },
+          "private": {
+            "default": false,
+            "description": "If ` + "`" + `true` + "`" + `, the artifact is scope-protected, so its ` + "`" + `name` + "`" + ` (or ` + "`" + `path` + "`" + `, if ` + "`" + `name` + "`" + ` is not\nset) must not begin ` + "`" + `public/` + "`" + `. Downloading the artifact requires scope\n` + "`" + `queue:get-artifact:\u003cname\u003e` + "`" + ` (for a ` + "`" + `directory` + "`" + ` artifact, ` + "`" + `queue:get-artifact:\u003cname\u003e/*` + "`" + `),\nwhich the task must also have, so that the task can grant it to the tasks that consume\nthe artifact. Note, on workers with config setting ` + "`" + `forcePrivateArtifacts` + "`" + ` enabled, all\nartifact names beginning ` + "`" + `public/` + "`" + ` are published beginning ` + "`" + `private/` + "`" + ` instead.\n\nSince: generic-worker 28.1.0",
+            "title": "Publish artifact as private",
+            "type": "boolean"
+          },
           "type": {
             "description": "Artifacts can be either an individual ` + "`" + `file` + "`" + ` or a ` + "`" + `directory` + "`" + ` containing\npotentially multiple files with recursively included subdirectories.\n\nSince: generic-worker 1.0.0",
             "enum": [
@@ -639,6 +1976,27 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": true
     },
+    "bandwidthLimits": {
+      "additionalProperties": false,
+      "description": "Rate limits for transfers made by the worker on behalf of this task.\nThese apply in addition to any limits configured for the worker as a\nwhole (config settings ` + "`" + `maxDownloadBytesPerSec` + "`" + ` and\n` + "`" + `maxUploadBytesPerSec` + "`" + `), so can only further reduce bandwidth usage.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "maxDownloadBytesPerSec": {
+          "description": "Maximum number of bytes per second to download for mounts and\nfetches.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum download rate",
+          "type": "integer"
+        },
+        "maxUploadBytesPerSec": {
+          "description": "Maximum number of bytes per second to upload for artifacts.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum upload rate",
+          "type": "integer"
+        }
+      },
+      "required": [],
+      "title": "Bandwidth limits",
+      "type": "object"
+    },
     "command": {
       "description": "One array per command (each command is an array of arguments). Several arrays\nfor several commands.\n\nSince: generic-worker 0.0.1",
       "items": {
@@ -654,6 +2012,39 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "commandTrace": {
+      "additionalProperties": false,
+      "description": "Runs each task command under ` + "`" + `strace -f` + "`" + ` or ` + "`" + `perf record -g` + "`" + `, and\npublishes the output of each command as an artifact named\n` + "`" + `\u003cartifactPrefix\u003ecommand_\u003cindex\u003e.strace` + "`" + ` or\n` + "`" + `\u003cartifactPrefix\u003ecommand_\u003cindex\u003e.perf.data` + "`" + ` (where ` + "`" + `\u003cindex\u003e` + "`" + ` is the\nzero-based command index, zero-padded to six digits). This is intended\nfor diagnosing hangs and performance regressions without modifying task\nscripts. The requested tool must be installed on the worker, otherwise\nthe task will resolve as ` + "`" + `malformed-payload` + "`" + `. Tracing is only supported\non Linux.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:command-trace:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "artifactPrefix": {
+          "description": "Prefix for the names of the trace artifacts, for example\n` + "`" + `public/trace/` + "`" + `. Traces can contain sensitive data such as\nenvironment variables and the contents of files read or written by\nthe task, so consider using a non-public prefix.\n\nSince: generic-worker 28.1.0",
+          "title": "Artifact name prefix",
+          "type": "string"
+        },
+        "maxSizeBytes": {
+          "default": 104857600,
+          "description": "Maximum size of the trace of each command, in bytes. Output beyond\nthis size is discarded.\n\nSince: generic-worker 28.1.0",
+          "minimum": 1,
+          "title": "Maximum trace size",
+          "type": "integer"
+        },
+        "tool": {
+          "description": "The tool to run task commands under.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "perf",
+            "strace"
+          ],
+          "title": "Tracing tool",
+          "type": "string"
+        }
+      },
+      "required": [
+        "tool",
+        "artifactPrefix"
+      ],
+      "title": "Command trace",
+      "type": "object"
+    },
     "env": {
       "additionalProperties": {
         "type": "string"
@@ -666,6 +2057,41 @@ func taskPayloadSchema() string {
       "additionalProperties": false,
       "description": "Feature flags enable additional functionality.\n\nSince: generic-worker 5.3.0",
       "properties": {
+        "androidEmulator": {
+          "description": "If enabled, the Android emulator configured on the worker is booted\nfrom its snapshot before the task commands run, and shut down\nwithout saving its state after they complete, so that each task\nstarts from the same snapshot. The environment variables\n` + "`" + `ANDROID_SERIAL` + "`" + `, ` + "`" + `ANDROID_ADB_SERVER_PORT` + "`" + ` and\n` + "`" + `ANDROID_EMULATOR_CONSOLE_PORT` + "`" + ` are set for the task commands, so\nthat ` + "`" + `adb` + "`" + ` connects to the emulator. The emulator log (logcat) is\npublished as artifact ` + "`" + `public/logs/logcat.txt` + "`" + `. Requires scope\n` + "`" + `generic-worker:android-emulator:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Boot an Android emulator for the task",
+          "type": "boolean"
+        },
+        "crashDumps": {
+          "description": "If enabled, the operating system is configured so that any task\nprocess that crashes writes a dump (a minidump via Windows Error\nReporting on Windows, a core file via ` + "`" + `core_pattern` + "`" + ` on Linux, or a\ncore file and ReportCrash report on macOS) to a directory that is\ncollected by the worker when the task commands complete. Dumps are\npublished as artifacts named\n` + "`" + `public/crashdumps/\u003cexecutable\u003e.\u003cpid\u003e.\u003ctimestamp\u003e.\u003cextension\u003e` + "`" + ` so\nthat they can be matched to symbols for the crashing executable.\n\nSince: generic-worker 28.1.0",
+          "title": "Collect crash dumps of task processes",
+          "type": "boolean"
+        },
+        "disableNetwork": {
+          "description": "If enabled, task commands run without network access, for example\nto verify that a build is hermetic. On Linux, task commands run in\nan empty network namespace, unless the worker config setting\n` + "`" + `taskIsolation` + "`" + ` already isolates them from the network; on macOS,\nthis requires worker config setting ` + "`" + `taskIsolation` + "`" + ` to be\n` + "`" + `sandboxExec` + "`" + `. Not supported on FreeBSD. Attempts to use the network\nfail straight away, and on Linux the number of attempts is reported in\nthe task log. Cannot be combined with feature ` + "`" + `network` + "`" + `. The worker\nconfig setting ` + "`" + `disableNetwork` + "`" + ` enables this for all tasks.\n\nSince: generic-worker 28.1.0",
+          "title": "Run the task without network access",
+          "type": "boolean"
+        },
+        "network": {
+          "description": "If the worker config setting ` + "`" + `taskIsolation` + "`" + ` is ` + "`" + `bubblewrap` + "`" + ` (Linux)\nor ` + "`" + `sandboxExec` + "`" + ` (macOS), task commands run without network access,\nunless this is enabled. Requires scope\n` + "`" + `generic-worker:network:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `. Has no effect\non workers that don't isolate tasks.\n\nSince: generic-worker 28.1.0",
+          "title": "Allow network access from the task sandbox",
+          "type": "boolean"
+        },
+        "payloadTemplates": {
+          "description": "If enabled, the template expressions in the arguments of ` + "`" + `command` + "`" + `,\nthe values of ` + "`" + `env` + "`" + `, and the ` + "`" + `path` + "`" + ` of each of ` + "`" + `artifacts` + "`" + ` are\nexpanded when the task starts (see the description of the payload).\nWithout it, text such as ` + "`" + `{{taskId}}` + "`" + ` is passed to the task as is.\n\nSince: generic-worker 28.1.0",
+          "title": "Expand template expressions in the task payload",
+          "type": "boolean"
+        },
+        "progress": {
+          "description": "If enabled, task commands can report the progress of the task by\nPOSTing JSON such as\n` + "`" + `{\"percentage\": 42.5, \"step\": \"Linking\", \"eta\": \"2020-06-01T14:30:00.000Z\"}` + "`" + `\nto the URL in environment variable ` + "`" + `TASKCLUSTER_PROGRESS_URL` + "`" + `, where\n` + "`" + `percentage` + "`" + ` (between 0 and 100) is required and ` + "`" + `step` + "`" + ` and ` + "`" + `eta` + "`" + `\n(when the task expects to complete) are optional. The latest report\nis published as artifact ` + "`" + `public/progress.json` + "`" + `, which is updated\nevery ` + "`" + `progressUpdateIntervalSecs` + "`" + ` seconds (a worker config setting)\nwhile the task runs, and once more when the task commands complete,\nso that dashboards can show the progress of long running tasks.\n\nSince: generic-worker 28.1.0",
+          "title": "Allow the task to report its progress",
+          "type": "boolean"
+        },
+        "resultCache": {
+          "description": "If enabled, the worker computes a hash of the task payload together\nwith the SHA256 of all content mounted or fetched into the task\ndirectory. If an earlier task with the same hash completed\nsuccessfully on this worker type, the task commands are not run, and\ninstead the artifacts of the earlier task are re-exposed as redirect\nartifacts, and the task resolves as completed. Otherwise, if the task\ncompletes successfully, it is recorded in the index under namespace\n` + "`" + `generic-worker.result-cache.\u003cprovisionerId\u003e.\u003cworkerType\u003e.\u003chash\u003e` + "`" + ` for\nfuture tasks to reuse. The hash also covers the scopes and routes of\nthe task. Only enable this for deterministic tasks.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:result-cache:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Reuse the result of an identical earlier task run",
+          "type": "boolean"
+        },
         "taskclusterProxy": {
           "description": "The taskcluster proxy provides an easy and safe way to make authenticated\ntaskcluster requests within the scope(s) of a particular task. See\n[the github project](https://github.com/taskcluster/taskcluster-proxy) for more information.\n\nSince: generic-worker 10.6.0",
           "title": "Run [taskcluster-proxy](https://github.com/taskcluster/taskcluster-proxy) to allow tasks to dynamically proxy requests to taskcluster services",
@@ -676,6 +2102,121 @@ func taskPayloadSchema() string {
       "title": "Feature flags",
       "type": "object"
     },
+    "fetches": {
+      "description": "Artifacts of upstream tasks to be downloaded before the task commands\nrun. Each fetch refers to an artifact of a task, identified either\ndirectly by ` + "`" + `taskId` + "`" + `, or indirectly by an index ` + "`" + `namespace` + "`" + ` which is\nresolved to a ` + "`" + `taskId` + "`" + ` when the task starts. Fetches are downloaded in\nparallel, retried on transient failures, verified against ` + "`" + `sha256` + "`" + ` (if\nprovided) and cached on the worker between tasks, in the same way as\nfile mounts.\n\nTasks referenced by ` + "`" + `taskId` + "`" + ` must be listed in ` + "`" + `task.dependencies` + "`" + `.\nFetching a non-public artifact (i.e. not starting with ` + "`" + `public/` + "`" + `)\nrequires scope ` + "`" + `queue:get-artifact:\u003cartifact-name\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "$ref": "#/definitions/fetch",
+        "title": "Fetch"
+      },
+      "title": "Fetches",
+      "type": "array",
+      "uniqueItems": false
+    },
+    "hostAliases": {
+      "description": "Hostname to IP address overrides that apply to the task commands (and\nto container services), for example to run hermetic tests against\nstaged services without modifying images. The overrides are written\nto a task-scoped hosts file, ` + "`" + `generic-worker/hosts` + "`" + ` in the task\ndirectory, which is a copy of the worker's ` + "`" + `/etc/hosts` + "`" + ` preceded by\nthe overrides (so that they take precedence), and which is mounted\nover ` + "`" + `/etc/hosts` + "`" + ` inside the task's sandbox. Host aliases therefore require config setting\n` + "`" + `taskIsolation` + "`" + ` to be ` + "`" + `bubblewrap` + "`" + ` (only supported on Linux), and the\n` + "`" + `hostAliases` + "`" + ` feature to be enabled in the worker config.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:host-aliases:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "hostname": {
+            "description": "The hostname to resolve to ` + "`" + `ip` + "`" + `.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z0-9]([a-zA-Z0-9.-]{0,251}[a-zA-Z0-9])?$",
+            "title": "Hostname",
+            "type": "string"
+          },
+          "ip": {
+            "description": "The IPv4 or IPv6 address that ` + "`" + `hostname` + "`" + ` resolves to.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "IP address",
+            "type": "string"
+          }
+        },
+        "required": [
+          "hostname",
+          "ip"
+        ],
+        "title": "Host alias",
+        "type": "object"
+      },
+      "title": "Host aliases",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "iosSimulator": {
+      "additionalProperties": false,
+      "description": "Creates and boots a new iOS simulator of the given device type and\nruntime for the task, as the task user, before the task commands\nrun. The UDID of the simulator is available to the task commands in\nenvironment variable ` + "`" + `SIMULATOR_UDID` + "`" + `, so that it can be passed to\ne.g. ` + "`" + `xcodebuild -destination id=$SIMULATOR_UDID` + "`" + ` or\n` + "`" + `xcrun simctl` + "`" + `. After the task commands complete, the simulator is\nshut down and deleted, so that no simulator state is carried over to\nsubsequent tasks. The simulator log is published as artifact\n` + "`" + `public/logs/simulator.log` + "`" + `. iOS simulators are only supported on\nmacOS, and require the ` + "`" + `iosSimulator` + "`" + ` feature to be enabled in the\nworker config.\n\nUse of this feature requires scope\n` + "`" + `generic-worker:ios-simulator:\u003cprovisionerId\u003e/\u003cworkerType\u003e` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "deviceType": {
+          "description": "The device type of the simulator, as a name or identifier listed by\n` + "`" + `xcrun simctl list devicetypes` + "`" + `, for example ` + "`" + `iPhone 14` + "`" + ` or\n` + "`" + `com.apple.CoreSimulator.SimDeviceType.iPhone-14` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "minLength": 1,
+          "title": "Simulator device type",
+          "type": "string"
+        },
+        "runtime": {
+          "description": "The runtime of the simulator, as a name or identifier listed by\n` + "`" + `xcrun simctl list runtimes` + "`" + `, for example ` + "`" + `iOS 16.4` + "`" + ` or\n` + "`" + `com.apple.CoreSimulator.SimRuntime.iOS-16-4` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "minLength": 1,
+          "title": "Simulator runtime",
+          "type": "string"
+        }
+      },
+      "required": [
+        "deviceType",
+        "runtime"
+      ],
+      "title": "iOS simulator",
+      "type": "object"
+    },
+    "keychain": {
+      "additionalProperties": false,
+      "description": "Creates a new keychain for the task before the task commands run,\nimports the given code signing certificates into it from the secrets\nservice, unlocks it, and adds it to the keychain search list of the\ntask user, so that ` + "`" + `codesign` + "`" + `, ` + "`" + `productsign` + "`" + ` and ` + "`" + `xcodebuild` + "`" + ` can use\nthe certificates without prompting. The path of the keychain is\navailable to the task commands in environment variable\n` + "`" + `KEYCHAIN_PATH` + "`" + `. After the task commands complete, the keychain is\ndeleted. Keychains are only supported on macOS, and require the\n` + "`" + `keychain` + "`" + ` feature to be enabled in the worker config.\n\nUse of this feature requires scope ` + "`" + `secrets:get:\u003csecret\u003e` + "`" + ` for the\nsecret of each certificate.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "certificates": {
+          "description": "The certificates, with their private keys, to import into the\nkeychain.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "key": {
+                "description": "The property of the secret whose value is the base64 encoded\nPKCS #12 (` + "`" + `.p12` + "`" + `) file of the certificate and its private\nkey.\n\nSince: generic-worker 28.1.0",
+                "minLength": 1,
+                "title": "Certificate key",
+                "type": "string"
+              },
+              "passwordKey": {
+                "default": "",
+                "description": "The property of the secret whose value is the password of the\nPKCS #12 file, if it has one.\n\nSince: generic-worker 28.1.0",
+                "title": "Password key",
+                "type": "string"
+              },
+              "secret": {
+                "description": "The name of the secret that holds the certificate.\n\nSince: generic-worker 28.1.0",
+                "minLength": 1,
+                "title": "Secret name",
+                "type": "string"
+              }
+            },
+            "required": [
+              "secret",
+              "key"
+            ],
+            "title": "Certificate",
+            "type": "object"
+          },
+          "minItems": 1,
+          "title": "Certificates",
+          "type": "array"
+        }
+      },
+      "required": [
+        "certificates"
+      ],
+      "title": "macOS keychain",
+      "type": "object"
+    },
+    "maxArtifactsMB": {
+      "description": "The maximum total size in megabytes of the artifacts of\n` + "`" + `task.payload.artifacts` + "`" + `. If the artifacts are larger, none of them\nare uploaded, and the task resolves as failed, listing its largest\nartifacts. This applies in addition to any limit configured for the\nworker (config setting ` + "`" + `maxTaskArtifactsMB` + "`" + `), so can only lower it.\n\nSince: generic-worker 28.1.0",
+      "minimum": 1,
+      "title": "Maximum total artifact size",
+      "type": "integer"
+    },
     "maxRunTime": {
       "description": "Maximum time the task container can run in seconds.\n\nSince: generic-worker 0.0.1",
       "maximum": 86400,
@@ -697,6 +2238,43 @@ func taskPayloadSchema() string {
       "additionalProperties": false,
       "description": "By default tasks will be resolved with ` + "`" + `state/reasonResolved` + "`" + `: ` + "`" + `completed/completed` + "`" + `\nif all task commands have a zero exit code, or ` + "`" + `failed/failed` + "`" + ` if any command has a\nnon-zero exit code. This payload property allows customsation of the task resolution\nbased on exit code of task commands.",
       "properties": {
+        "exception": {
+          "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception` + "`" + `, with the given reason, for example so\nthat a test harness that detects a problem with the worker can\nresolve the task as ` + "`" + `exception/resource-unavailable` + "`" + `, rather than\n` + "`" + `failed/failed` + "`" + `. Use ` + "`" + `retry` + "`" + ` for ` + "`" + `exception/intermittent-task` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "additionalProperties": false,
+            "properties": {
+              "exitCodes": {
+                "description": "The exit codes that cause the task to be resolved as\nexception with this reason.\n\nSince: generic-worker 28.1.0",
+                "items": {
+                  "minimum": 1,
+                  "type": "integer"
+                },
+                "minItems": 1,
+                "title": "Exit codes",
+                "type": "array",
+                "uniqueItems": true
+              },
+              "reason": {
+                "description": "The reason to resolve the task with.\n\nSince: generic-worker 28.1.0",
+                "enum": [
+                  "internal-error",
+                  "malformed-payload",
+                  "resource-unavailable"
+                ],
+                "title": "Exception reason",
+                "type": "string"
+              }
+            },
+            "required": [
+              "reason",
+              "exitCodes"
+            ],
+            "title": "Exception mapping",
+            "type": "object"
+          },
+          "title": "Exit codes resolving task as exception",
+          "type": "array"
+        },
         "retry": {
           "description": "Exit codes for any command in the task payload to cause this task to\nbe resolved as ` + "`" + `exception/intermittent-task` + "`" + `. Typically the Queue\nwill then schedule a new run of the existing ` + "`" + `taskId` + "`" + ` (rerun) if not\nall task runs have been exhausted.\n\nSee [itermittent tasks](https://docs.taskcluster.net/docs/reference/platform/taskcluster-queue/docs/worker-interaction#intermittent-tasks) for more detail.\n\nSince: generic-worker 10.10.0",
           "items": {
@@ -707,6 +2285,17 @@ func taskPayloadSchema() string {
           "title": "Intermittent task exit codes",
           "type": "array",
           "uniqueItems": true
+        },
+        "success": {
+          "description": "Exit codes for any command in the task payload to be treated as\nsuccess (with a warning in the task log), so that subsequent task\ncommands are run, and if they succeed, the task is resolved as\n` + "`" + `completed/completed` + "`" + `. Commands that exit with these exit codes\nare not retried by ` + "`" + `retryPolicies` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "title": "Exit codes",
+            "type": "integer"
+          },
+          "title": "Exit codes treated as success",
+          "type": "array",
+          "uniqueItems": true
         }
       },
       "required": [],
@@ -723,11 +2312,449 @@ func taskPayloadSchema() string {
       "type": "array",
       "uniqueItems": false
     },
+    "phases": {
+      "description": "Groups the task commands into named phases (for example ` + "`" + `setup` + "`" + `,\n` + "`" + `build` + "`" + `, ` + "`" + `test` + "`" + ` and ` + "`" + `package` + "`" + `), each of which is a run of\nconsecutive commands. The numbers of commands of the phases must add\nup to the number of task commands. The worker writes\nTreeherder-compatible step markers to the task log at the start and\nend of each phase, and publishes the duration and outcome of each\nphase as artifact ` + "`" + `public/phases.json` + "`" + `. Phases whose commands did not\nall run (because an earlier command failed, or the task was aborted)\nare reported with state ` + "`" + `failed` + "`" + `, ` + "`" + `aborted` + "`" + ` or ` + "`" + `skipped` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "commands": {
+            "description": "The number of consecutive task commands in the phase, following\nthe commands of the previous phases.\n\nSince: generic-worker 28.1.0",
+            "minimum": 1,
+            "title": "Number of commands in phase",
+            "type": "integer"
+          },
+          "name": {
+            "description": "The name of the phase, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "maxLength": 100,
+            "minLength": 1,
+            "title": "Phase name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name",
+          "commands"
+        ],
+        "title": "Phase",
+        "type": "object"
+      },
+      "title": "Named phases of task commands",
+      "type": "array"
+    },
+    "portLeases": {
+      "description": "Ports that the worker leases to the task for the duration of the task,\neach exposed to the task commands (and to any services) in an\nenvironment variable. Leased ports are taken from the worker's\nconfigured port lease range, and are not leased to any other task on\nthe same host (including tasks of other workers that share the same\n` + "`" + `portLeasesDir` + "`" + `) until the task resolves. Use this instead of\nhard-coded port numbers to avoid clashes between concurrent tasks. The\nleased ports are listed in the task log.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "name": {
+            "description": "The name of the environment variable that holds the leased port\nnumber, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]{0,63}$",
+            "title": "Environment variable name",
+            "type": "string"
+          },
+          "protocol": {
+            "default": "tcp",
+            "description": "The protocol that the port must be free for.\n\nSince: generic-worker 28.1.0",
+            "enum": [
+              "tcp",
+              "udp"
+            ],
+            "title": "Protocol",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Port lease",
+        "type": "object"
+      },
+      "title": "Port leases",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "reproducible": {
+      "additionalProperties": false,
+      "description": "Settings for tasks that produce reproducible artifacts. Environment\nvariable ` + "`" + `SOURCE_DATE_EPOCH` + "`" + ` is set to ` + "`" + `sourceDateEpoch` + "`" + `, ` + "`" + `TZ` + "`" + ` to\n` + "`" + `timezone` + "`" + `, and ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + ` to ` + "`" + `locale` + "`" + `, overriding any values\nin ` + "`" + `env` + "`" + `. The resolved settings are listed in the task log, and are\nrecorded in the chain of trust certificate of the task (if the\n` + "`" + `chainOfTrust` + "`" + ` feature is enabled).\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "faketime": {
+          "default": false,
+          "description": "If true, the task commands are run with libfaketime preloaded\n(config setting ` + "`" + `faketimeLibrary` + "`" + `), so that the clock of the task\nstarts at ` + "`" + `sourceDateEpoch` + "`" + ` and advances normally from there.\n\nSince: generic-worker 28.1.0",
+          "title": "Fake time",
+          "type": "boolean"
+        },
+        "locale": {
+          "default": "C.UTF-8",
+          "description": "The value of ` + "`" + `LANG` + "`" + ` and ` + "`" + `LC_ALL` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Locale",
+          "type": "string"
+        },
+        "sourceDateEpoch": {
+          "description": "The value of ` + "`" + `SOURCE_DATE_EPOCH` + "`" + `, in seconds since the Unix epoch.\nIf not specified (or 0), the creation time of the task is used, so\nthat reruns of the task use the same value.\n\nSince: generic-worker 28.1.0",
+          "minimum": 0,
+          "title": "Source date epoch",
+          "type": "integer"
+        },
+        "timezone": {
+          "default": "UTC",
+          "description": "The value of ` + "`" + `TZ` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "title": "Time zone",
+          "type": "string"
+        }
+      },
+      "title": "Reproducible build environment",
+      "type": "object"
+    },
+    "requiredArtifacts": {
+      "default": [],
+      "description": "Names of artifacts that the task must publish in order to resolve\nsuccessfully, such as ` + "`" + `public/build/target.tar.gz` + "`" + `. If any of them was\nnot uploaded (for example because the file of an artifact of\n` + "`" + `task.payload.artifacts` + "`" + ` does not exist, so an error artifact was\nuploaded instead) the task resolves as failed, listing the missing\nartifacts. This protects against tasks that succeed without producing\ntheir outputs.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "type": "string"
+      },
+      "title": "Required artifacts",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "rerun": {
+      "additionalProperties": false,
+      "description": "Policy for rerunning all of the task commands, from the first command,\nwhen the task fails with a known intermittent failure signature, so\nthat intermittent failures don't need a new task run (and worker) to\nbe retried. A task fails with a failure signature if the failing\ncommand exits with one of ` + "`" + `exitCodes` + "`" + `, or if a line of the output of\nthe failed attempt matches one of ` + "`" + `logPatterns` + "`" + `. The task is rerun at\nmost ` + "`" + `maxReruns` + "`" + ` times, after which it is resolved as ` + "`" + `failed` + "`" + `. Each\nattempt is logged in its own section of the task log, and reported\nas a ` + "`" + `taskRerun` + "`" + ` WORKER_METRICS event. Reruns use the same task\ndirectory, so the task commands need to cope with files left behind\nby earlier attempts. Time spent rerunning counts towards\n` + "`" + `maxRunTime` + "`" + `. Unlike ` + "`" + `retryPolicies` + "`" + `, which retry a single command,\nand ` + "`" + `onExitStatus.retry` + "`" + `, which resolves the task as\n` + "`" + `exception/intermittent-task` + "`" + ` so that the queue creates a new run,\nreruns happen within the same run.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "exitCodes": {
+          "description": "Exit codes that cause the task commands to be rerun, if a task\ncommand exits with them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minimum": 1,
+            "type": "integer"
+          },
+          "title": "Exit codes of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "logPatterns": {
+          "description": "Regular expressions (in Go syntax) that cause the task commands to\nbe rerun, if a line of the task log written during the failed\nattempt matches them.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "type": "string"
+          },
+          "title": "Log patterns of intermittent failures",
+          "type": "array",
+          "uniqueItems": true
+        },
+        "maxReruns": {
+          "description": "The maximum number of times the task commands are rerun, not\nincluding the first attempt.\n\nSince: generic-worker 28.1.0",
+          "maximum": 5,
+          "minimum": 1,
+          "title": "Maximum number of reruns",
+          "type": "integer"
+        }
+      },
+      "required": [
+        "maxReruns"
+      ],
+      "title": "Task rerun policy",
+      "type": "object"
+    },
+    "retryPolicies": {
+      "description": "Policies for retrying task commands that fail transiently (for\nexample because of flaky network operations), so that task scripts\ndon't need their own retry loops. A task command that has a retry\npolicy, and fails, is run again after a delay, until it succeeds or\nhas been attempted ` + "`" + `maxAttempts` + "`" + ` times. The delay is ` + "`" + `backoffSeconds` + "`" + `\nbefore the second attempt, and doubles before each further attempt,\nup to ` + "`" + `maxBackoffSeconds` + "`" + `. Time spent retrying counts towards\n` + "`" + `maxRunTime` + "`" + `. Only the result of the final attempt of a command\ndetermines the outcome of the task (including ` + "`" + `onExitStatus` + "`" + `\nhandling).\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "backoffSeconds": {
+            "default": 10,
+            "description": "The number of seconds to wait before the second attempt of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Initial delay between attempts",
+            "type": "integer"
+          },
+          "command": {
+            "description": "The zero-based index of the task command that the policy applies\nto. Each command may have at most one policy.\n\nSince: generic-worker 28.1.0",
+            "minimum": 0,
+            "title": "Command index",
+            "type": "integer"
+          },
+          "exitCodes": {
+            "description": "Exit codes that cause the command to be retried. If not\nspecified, any failure of the command causes it to be retried.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "minimum": 1,
+              "type": "integer"
+            },
+            "title": "Exit codes to retry",
+            "type": "array",
+            "uniqueItems": true
+          },
+          "maxAttempts": {
+            "description": "The maximum number of times the command is run, including the\nfirst attempt.\n\nSince: generic-worker 28.1.0",
+            "maximum": 10,
+            "minimum": 2,
+            "title": "Maximum number of attempts",
+            "type": "integer"
+          },
+          "maxBackoffSeconds": {
+            "default": 300,
+            "description": "The maximum number of seconds to wait between attempts of the\ncommand.\n\nSince: generic-worker 28.1.0",
+            "maximum": 3600,
+            "minimum": 1,
+            "title": "Maximum delay between attempts",
+            "type": "integer"
+          }
+        },
+        "required": [
+          "command",
+          "maxAttempts"
+        ],
+        "title": "Command retry policy",
+        "type": "object"
+      },
+      "title": "Command retry policies",
+      "type": "array"
+    },
+    "sbom": {
+      "additionalProperties": false,
+      "description": "Publishes a software bill of materials (SBOM) of the task when the task\ncommands complete, as artifact ` + "`" + `public/sbom.cdx.json` + "`" + ` (CycloneDX 1.4)\nor ` + "`" + `public/sbom.spdx.json` + "`" + ` (SPDX 2.3). The SBOM lists the content\nmounted or fetched into the task, such as toolchains, with its SHA 256,\nand the packages listed in ` + "`" + `manifests` + "`" + `. On workers with chain of trust\nenabled, the SBOM is covered by the chain of trust certificate of the\ntask, like any other artifact.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "format": {
+          "description": "The format of the SBOM.\n\nSince: generic-worker 28.1.0",
+          "enum": [
+            "cyclonedx",
+            "spdx"
+          ],
+          "title": "SBOM format",
+          "type": "string"
+        },
+        "manifests": {
+          "description": "Paths, relative to the task directory, of package manifests that\nthe task commands write, for example while installing packages.\nEach manifest is a JSON array of packages, each with a ` + "`" + `name` + "`" + `, and\noptionally a ` + "`" + `version` + "`" + ` and [package URL](https://github.com/package-url/purl-spec)\n(` + "`" + `purl` + "`" + `), e.g. ` + "`" + `[{\"name\": \"requests\", \"version\": \"2.25.1\", \"purl\": \"pkg:pypi/requests@2.25.1\"}]` + "`" + `.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "title": "Package manifests",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [
+        "format"
+      ],
+      "title": "Software bill of materials",
+      "type": "object"
+    },
+    "secrets": {
+      "description": "Secrets from the taskcluster secrets service to inject into the task,\nas environment variables of the task commands, or as files in the task\ndirectory. The worker fetches the secrets with the task credentials, so\nthe task requires scope ` + "`" + `secrets:get:\u003cname\u003e` + "`" + ` for each secret. Secret\nvalues are redacted from the task log, and secret files are deleted\nwhen the task ends. Secrets require the ` + "`" + `secrets` + "`" + ` feature to be enabled\nin the worker config.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "env": {
+            "description": "The name of the environment variable to inject the secret as.\nExactly one of ` + "`" + `env` + "`" + ` and ` + "`" + `file` + "`" + ` must be set.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z_][a-zA-Z0-9_]*$",
+            "title": "Environment variable",
+            "type": "string"
+          },
+          "file": {
+            "description": "The path, relative to the task directory, of the file to write\nthe secret to. The file is only readable by the task user.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "File",
+            "type": "string"
+          },
+          "key": {
+            "description": "The property of the secret value to inject. If not set, the whole\nsecret value is injected as JSON. String properties are injected\nas is, other properties as JSON.\n\nSince: generic-worker 28.1.0",
+            "title": "Secret key",
+            "type": "string"
+          },
+          "name": {
+            "description": "The name of the secret in the taskcluster secrets service.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Secret name",
+            "type": "string"
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Secret",
+        "type": "object"
+      },
+      "title": "Secrets to inject into the task",
+      "type": "array",
+      "uniqueItems": true
+    },
+    "services": {
+      "description": "Auxiliary long-running services (for example databases, a Selenium\ngrid or a local registry) that are started before the task commands\nrun, and killed after they complete. A service is either a process,\nwhich runs in the task directory as the task user, or a docker\ncontainer, which requires docker to be installed on the worker. A\nservice may have a health check, in which case the next service (or\nthe task commands) are only started once it passes, and the task\nfails if it doesn't pass in time. The output of each service is\npublished as artifact ` + "`" + `public/logs/services/\u003cname\u003e.log` + "`" + `.\n\nRequires the ` + "`" + `services` + "`" + ` feature to be enabled in the worker config.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "command": {
+            "description": "The command line of a process service, or the arguments passed\nto the container of a container service. Required unless ` + "`" + `image` + "`" + `\nis specified.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "type": "string"
+            },
+            "minItems": 1,
+            "title": "Service command",
+            "type": "array"
+          },
+          "env": {
+            "additionalProperties": {
+              "type": "string"
+            },
+            "description": "Environment variables of the service, in addition to (or\noverriding) the task environment variables for process\nservices.\n\nSince: generic-worker 28.1.0",
+            "title": "Service environment variables",
+            "type": "object"
+          },
+          "healthCheck": {
+            "additionalProperties": false,
+            "description": "How to determine that the service is ready. Exactly one of\n` + "`" + `tcpPort` + "`" + ` and ` + "`" + `httpUrl` + "`" + ` must be specified.\n\nSince: generic-worker 28.1.0",
+            "properties": {
+              "httpUrl": {
+                "description": "The service is healthy once a GET request to this URL\nreturns a 2xx status code.\n\nSince: generic-worker 28.1.0",
+                "format": "uri",
+                "title": "HTTP URL",
+                "type": "string"
+              },
+              "tcpPort": {
+                "description": "The service is healthy once it accepts connections on this\nport of the worker's loopback interface.\n\nSince: generic-worker 28.1.0",
+                "maximum": 65535,
+                "minimum": 1,
+                "title": "TCP port",
+                "type": "integer"
+              },
+              "timeoutSeconds": {
+                "default": 60,
+                "description": "How long to wait for the service to become healthy.\n\nSince: generic-worker 28.1.0",
+                "maximum": 3600,
+                "minimum": 1,
+                "title": "Health check timeout",
+                "type": "integer"
+              }
+            },
+            "required": [],
+            "title": "Health check",
+            "type": "object"
+          },
+          "image": {
+            "description": "The docker image to run the service from, which makes the\nservice a container service.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Docker image",
+            "type": "string"
+          },
+          "leasedPorts": {
+            "description": "Names of port leases (see ` + "`" + `portLeases` + "`" + `) that a container service\nlistens on, which are published on the same port of the worker's\nloopback interface. Unlike ` + "`" + `ports` + "`" + `, these don't clash with other\ntasks running on the same host.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "type": "string"
+            },
+            "title": "Published leased ports",
+            "type": "array",
+            "uniqueItems": true
+          },
+          "name": {
+            "description": "The name of the service, which must be unique within the task.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^[a-zA-Z0-9_.-]{1,64}$",
+            "title": "Service name",
+            "type": "string"
+          },
+          "ports": {
+            "description": "Ports of a container service that are published on the same port\nof the worker's loopback interface, so that task commands can\nconnect to them.\n\nSince: generic-worker 28.1.0",
+            "items": {
+              "maximum": 65535,
+              "minimum": 1,
+              "type": "integer"
+            },
+            "title": "Published container ports",
+            "type": "array",
+            "uniqueItems": true
+          }
+        },
+        "required": [
+          "name"
+        ],
+        "title": "Service",
+        "type": "object"
+      },
+      "title": "Services",
+      "type": "array"
+    },
     "supersederUrl": {
       "description": "URL of a service that can indicate tasks superseding this one; the current ` + "`" + `taskId` + "`" + `\nwill be appended as a query argument ` + "`" + `taskId` + "`" + `. The service should return an object with\na ` + "`" + `supersedes` + "`" + ` key containing a list of ` + "`" + `taskId` + "`" + `s, including the supplied ` + "`" + `taskId` + "`" + `. The\ntasks should be ordered such that each task supersedes all tasks appearing later in the\nlist.\n\nSee [superseding](https://docs.taskcluster.net/reference/platform/taskcluster-queue/docs/superseding) for more detail.\n\nSince: generic-worker 10.2.2",
       "format": "uri",
       "title": "Superseder URL",
       "type": "string"
+    },
+    "tagOutputStreams": {
+      "default": false,
+      "description": "If true, each line that the task commands write to the task log is\nprefixed with the output stream that it was written to, ` + "`" + `[stdout] ` + "`" + ` or\n` + "`" + `[stderr] ` + "`" + `. Otherwise both streams share a single pipe, so output is\nwritten to the task log in exactly the order that it was written.\nTagged streams have a pipe each, and are written to the task log in\nthe order that the worker reads them, so output written to both\nstreams within microseconds of each other may be reordered. A line\nthat is still incomplete when the other stream is written to is\nended, so that every line has a single source.\n\nSince: generic-worker 28.1.0",
+      "title": "Tag output streams",
+      "type": "boolean"
+    },
+    "testResults": {
+      "additionalProperties": false,
+      "description": "JUnit (or XUnit) XML reports of the task to summarize. When the task\ncommands complete, the reports matching ` + "`" + `paths` + "`" + ` are parsed, and\nartifact ` + "`" + `public/test-results.json` + "`" + ` is published with the number of\ntests that passed, failed, errored and were skipped, the slowest\ntests, and the failed tests, which are also listed in the task log.\n\nSince: generic-worker 28.1.0",
+      "properties": {
+        "failIfMissing": {
+          "default": false,
+          "description": "If true, the task fails if no reports match ` + "`" + `paths` + "`" + `, or if a\nmatching report cannot be parsed, so that a test harness which\ncrashes without writing its results doesn't go unnoticed.\n\nSince: generic-worker 28.1.0",
+          "title": "Fail if test results are missing",
+          "type": "boolean"
+        },
+        "paths": {
+          "description": "Paths of the reports, relative to the task directory, which may\ncontain the wildcards of [filepath.Match](https://golang.org/pkg/path/filepath/#Match),\ne.g. ` + "`" + `build/test-results/TEST-*.xml` + "`" + `. Wildcards don't match path\nseparators, so ` + "`" + `**` + "`" + ` is not supported.\n\nSince: generic-worker 28.1.0",
+          "items": {
+            "minLength": 1,
+            "type": "string"
+          },
+          "minItems": 1,
+          "title": "Report paths",
+          "type": "array",
+          "uniqueItems": true
+        }
+      },
+      "required": [
+        "paths"
+      ],
+      "title": "Test results",
+      "type": "object"
+    },
+    "vmImage": {
+      "description": "Path, relative to the task directory, of a disk image (typically\nprovided by a file mount) to boot the task VM from, instead of the\nworker's configured image, for example to test operating system\ninstallers or kernels. The image is not modified, since the VM boots\nfrom a copy-on-write overlay of it. Only supported on Linux workers\nwhose worker config setting ` + "`" + `taskIsolation` + "`" + ` is ` + "`" + `qemu` + "`" + `.\n\nSince: generic-worker 28.1.0",
+      "minLength": 1,
+      "title": "Disk image of task VM",
+      "type": "string"
+    },
+    "writeFiles": {
+      "description": "Files to create in the task directory before the task commands run,\nwith inline content, which avoids quoting file content in the task\ncommands, whose quoting rules differ between shells and platforms.\nParent directories are created as needed, and existing files are\nreplaced.\n\nSince: generic-worker 28.1.0",
+      "items": {
+        "additionalProperties": false,
+        "properties": {
+          "base64": {
+            "contentEncoding": "base64",
+            "description": "The content of the file, base64 encoded, for binary content. At\nmost one of ` + "`" + `content` + "`" + ` and ` + "`" + `base64` + "`" + ` may be set.\n\nSince: generic-worker 28.1.0",
+            "title": "Base64 encoded content",
+            "type": "string"
+          },
+          "content": {
+            "description": "The content of the file, as UTF-8 text. At most one of ` + "`" + `content` + "`" + `\nand ` + "`" + `base64` + "`" + ` may be set, and the file is empty if neither is.\n\nSince: generic-worker 28.1.0",
+            "title": "Content",
+            "type": "string"
+          },
+          "mode": {
+            "default": "0644",
+            "description": "The permissions of the file, in octal, e.g. ` + "`" + `\"0755\"` + "`" + ` for an\nexecutable script. Ignored on Windows.\n\nSince: generic-worker 28.1.0",
+            "pattern": "^0?[0-7]{3}$",
+            "title": "File mode",
+            "type": "string"
+          },
+          "path": {
+            "description": "The path, relative to the task directory, of the file to write.\n\nSince: generic-worker 28.1.0",
+            "minLength": 1,
+            "title": "Path",
+            "type": "string"
+          }
+        },
+        "required": [
+          "path"
+        ],
+        "title": "File to write",
+        "type": "object"
+      },
+      "title": "Files to write",
+      "type": "array",
+      "uniqueItems": true
     }
   },
   "required": [
@@ -7,66 +7,194 @@ import (
 	"io/ioutil"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"reflect"
+	"regexp"
+	"strings"
 
 	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcauth"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcnotify"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcpurgecache"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcworkermanager"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/cron"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 )
 
+// signingKeyID is the syntax of the IDs of config setting artifactSigningKeys,
+// which task.payload.signArtifacts entries refer to
+var signingKeyID = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
 type (
 	// Generic Worker config
 	Config struct {
 		PrivateConfig
 		PublicConfig
+		// HTTPRetry, if not nil, makes the http calls of the Taskcluster API
+		// clients of the config, see tcclient.Client.HTTPRetry
+		HTTPRetry func(httpCall func() (*http.Response, error, error)) (*http.Response, int, error) `json:"-"`
 	}
 
 	PublicConfig struct {
 		PublicEngineConfig
+		AndroidEmulatorAVD             string                 `json:"androidEmulatorAVD"`
+		AndroidEmulatorBootTimeoutSecs uint                   `json:"androidEmulatorBootTimeoutSecs"`
+		AndroidEmulatorPort            uint16                 `json:"androidEmulatorPort"`
+		AndroidEmulatorSnapshot        string                 `json:"androidEmulatorSnapshot"`
+		AndroidSDKRoot                 string                 `json:"androidSDKRoot"`
+		APICircuitBreakerCooldownSecs  uint                   `json:"apiCircuitBreakerCooldownSecs"`
+		APICircuitBreakerThreshold     uint                   `json:"apiCircuitBreakerThreshold"`
+		APIRetryBudgetSecs             uint                   `json:"apiRetryBudgetSecs"`
+		ArtifactMirror                 string                 `json:"artifactMirror"`
+		ArtifactMirrorAccessKeyID      string                 `json:"artifactMirrorAccessKeyId"`
+		ArtifactMirrorEndpoint         string                 `json:"artifactMirrorEndpoint"`
+		ArtifactMirrorRegion           string                 `json:"artifactMirrorRegion"`
+		ArtifactMirrorRetries          uint                   `json:"artifactMirrorRetries"`
+		ArtifactSigningKeys            map[string]SigningKey  `json:"artifactSigningKeys"`
 		AuthRootURL                    string                 `json:"authRootURL"`
+		AutoscalerHook                 string                 `json:"autoscalerHook"`
+		AutoscalerHookCommand          []string               `json:"autoscalerHookCommand"`
 		AvailabilityZone               string                 `json:"availabilityZone"`
+		CABundle                       string                 `json:"caBundle"`
 		CachesDir                      string                 `json:"cachesDir"`
+		CaseSensitiveTaskDirectories   bool                   `json:"caseSensitiveTaskDirectories"`
+		CheckDependencyArtifacts       bool                   `json:"checkDependencyArtifacts"`
+		CheckForCancellationEverySecs  uint                   `json:"checkForCancellationEverySecs"`
+		CheckForConfigDriftEverySecs   uint                   `json:"checkForConfigDriftEverySecs"`
 		CheckForNewDeploymentEverySecs uint                   `json:"checkForNewDeploymentEverySecs"`
+		CheckForQuarantineEverySecs    uint                   `json:"checkForQuarantineEverySecs"`
+		CheckForSelfUpdateEverySecs    uint                   `json:"checkForSelfUpdateEverySecs"`
+		ChunkedArtifactUploads         bool                   `json:"chunkedArtifactUploads"`
+		CircuitBreakerPatterns         []string               `json:"circuitBreakerPatterns"`
+		CircuitBreakerQuarantineSecs   uint                   `json:"circuitBreakerQuarantineSecs"`
+		CircuitBreakerThreshold        uint                   `json:"circuitBreakerThreshold"`
+		ClaimExpiryMarginSecs          uint                   `json:"claimExpiryMarginSecs"`
+		ClaimFilterRoutes              []string               `json:"claimFilterRoutes"`
+		ClaimFilterTags                map[string]string      `json:"claimFilterTags"`
 		CleanUpTaskDirs                bool                   `json:"cleanUpTaskDirs"`
+		ClientCertificate              string                 `json:"clientCertificate"`
 		ClientID                       string                 `json:"clientId"`
+		ClientKey                      string                 `json:"clientKey"`
+		CloudMetadata                  string                 `json:"cloudMetadata"`
+		ConfigDriftPolicy              string                 `json:"configDriftPolicy"`
+		ConfirmIndexRoutes             string                 `json:"confirmIndexRoutes"`
+		ContainerHostHelperURL         string                 `json:"containerHostHelperURL"`
+		ContainerMode                  string                 `json:"containerMode"`
+		ControlSocket                  string                 `json:"controlSocket"`
+		CredentialProvider             string                 `json:"credentialProvider"`
+		CredentialsFile                string                 `json:"credentialsFile"`
 		DeploymentID                   string                 `json:"deploymentId"`
+		DisableNetwork                 bool                   `json:"disableNetwork"`
 		DisableReboots                 bool                   `json:"disableReboots"`
+		DownloadConnections            uint                   `json:"downloadConnections"`
 		DownloadsDir                   string                 `json:"downloadsDir"`
 		Ed25519SigningKeyLocation      string                 `json:"ed25519SigningKeyLocation"`
+		EnableAuditTrail               bool                   `json:"enableAuditTrail"`
+		EnableCostAccounting           bool                   `json:"enableCostAccounting"`
+		EnableMachineInventory         bool                   `json:"enableMachineInventory"`
+		EnableResourceUsage            bool                   `json:"enableResourceUsage"`
+		EnabledFeatures                []string               `json:"enabledFeatures"`
+		FaketimeLibrary                string                 `json:"faketimeLibrary"`
+		FaultInjection                 *FaultInjection        `json:"faultInjection,omitempty"`
+		FileCountWatchdogIntervalSecs  uint                   `json:"fileCountWatchdogIntervalSecs"`
+		FileCountWatchdogMaxTaskFiles  uint                   `json:"fileCountWatchdogMaxTaskFiles"`
+		ForcePrivateArtifacts          bool                   `json:"forcePrivateArtifacts"`
 		IdleTimeoutSecs                uint                   `json:"idleTimeoutSecs"`
+		ImageID                        string                 `json:"imageId"`
+		IndexRootURL                   string                 `json:"indexRootURL"`
+		InstanceHourlyCost             float64                `json:"instanceHourlyCost"`
 		InstanceID                     string                 `json:"instanceId"`
+		InstancePricingURL             string                 `json:"instancePricingURL"`
 		InstanceType                   string                 `json:"instanceType"`
+		IOSSimulatorBootTimeoutSecs    uint                   `json:"iosSimulatorBootTimeoutSecs"`
 		LiveLogCertificate             string                 `json:"livelogCertificate"`
 		LiveLogExecutable              string                 `json:"livelogExecutable"`
 		LiveLogGETPort                 uint16                 `json:"livelogGETPort"`
 		LiveLogKey                     string                 `json:"livelogKey"`
 		LiveLogPUTPort                 uint16                 `json:"livelogPUTPort"`
+		MachineInventoryManifest       string                 `json:"machineInventoryManifest"`
+		MaintenanceAfterIdleSecs       uint                   `json:"maintenanceAfterIdleSecs"`
+		MaintenanceJobs                []MaintenanceJob       `json:"maintenanceJobs"`
+		MaintenanceWindows             []MaintenanceWindow    `json:"maintenanceWindows"`
+		MaxDownloadBytesPerSec         uint                   `json:"maxDownloadBytesPerSec"`
+		MaxPayloadBytes                uint                   `json:"maxPayloadBytes"`
+		MaxTaskArtifacts               uint                   `json:"maxTaskArtifacts"`
+		MaxTaskArtifactsMB             uint                   `json:"maxTaskArtifactsMB"`
+		MaxTaskCommands                uint                   `json:"maxTaskCommands"`
+		MaxTaskEnvBytes                uint                   `json:"maxTaskEnvBytes"`
+		MaxUploadBytesPerSec           uint                   `json:"maxUploadBytesPerSec"`
+		MemoryWatchdogIntervalSecs     uint                   `json:"memoryWatchdogIntervalSecs"`
+		MemoryWatchdogMaxTaskRSSMB     uint                   `json:"memoryWatchdogMaxTaskRSSMB"`
+		MemoryWatchdogMinAvailableMB   uint                   `json:"memoryWatchdogMinAvailableMB"`
+		MultipartDownloadMinMB         uint                   `json:"multipartDownloadMinMB"`
+		NotifyEmailAddress             string                 `json:"notifyEmailAddress"`
+		NotifyMatrixRoomID             string                 `json:"notifyMatrixRoomId"`
+		NotifyOnStatuses               []string               `json:"notifyOnStatuses"`
+		NotifyRootURL                  string                 `json:"notifyRootURL"`
+		NotifyWebhookURL               string                 `json:"notifyWebhookURL"`
 		NumberOfTasksToRun             uint                   `json:"numberOfTasksToRun"`
+		PortLeaseMaxPort               uint16                 `json:"portLeaseMaxPort"`
+		PortLeaseMinPort               uint16                 `json:"portLeaseMinPort"`
+		PortLeasesDir                  string                 `json:"portLeasesDir"`
 		PrivateIP                      net.IP                 `json:"privateIP"`
+		ProgressPort                   uint16                 `json:"progressPort"`
+		ProgressUpdateIntervalSecs     uint                   `json:"progressUpdateIntervalSecs"`
 		ProvisionerID                  string                 `json:"provisionerId"`
+		ProxyBypass                    []string               `json:"proxyBypass"`
+		ProxyURL                       string                 `json:"proxyURL"`
+		ProxyUsername                  string                 `json:"proxyUsername"`
 		PublicIP                       net.IP                 `json:"publicIP"`
 		PurgeCacheRootURL              string                 `json:"purgeCacheRootURL"`
 		QueueRootURL                   string                 `json:"queueRootURL"`
 		Region                         string                 `json:"region"`
+		RegistrySandbox                bool                   `json:"registrySandbox"`
+		RegistrySandboxKeys            []string               `json:"registrySandboxKeys"`
 		RequiredDiskSpaceMegabytes     uint                   `json:"requiredDiskSpaceMegabytes"`
 		RootURL                        string                 `json:"rootURL"`
 		RunAfterUserCreation           string                 `json:"runAfterUserCreation"`
 		SecretsRootURL                 string                 `json:"secretsRootURL"`
+		SelfUpdateEd25519PublicKey     string                 `json:"selfUpdateEd25519PublicKey"`
+		SelfUpdateHealthCheck          []string               `json:"selfUpdateHealthCheck"`
+		SelfUpdateLabels               []string               `json:"selfUpdateLabels"`
+		SelfUpdateManifestURL          string                 `json:"selfUpdateManifestURL"`
 		SentryProject                  string                 `json:"sentryProject"`
 		ShutdownMachineOnIdle          bool                   `json:"shutdownMachineOnIdle"`
 		ShutdownMachineOnInternalError bool                   `json:"shutdownMachineOnInternalError"`
+		StatusPagePort                 uint16                 `json:"statusPagePort"`
 		Subdomain                      string                 `json:"subdomain"`
 		TaskclusterProxyExecutable     string                 `json:"taskclusterProxyExecutable"`
 		TaskclusterProxyPort           uint16                 `json:"taskclusterProxyPort"`
+		TaskEnvironmentCapture         string                 `json:"taskEnvironmentCapture"`
+		TaskHistoryMaxRuns             uint                   `json:"taskHistoryMaxRuns"`
+		TaskIsolation                  string                 `json:"taskIsolation"`
+		TaskIsolationSandboxProfile    string                 `json:"taskIsolationSandboxProfile"`
+		TaskIsolationVMImage           string                 `json:"taskIsolationVMImage"`
+		TaskIsolationVMMemoryMB        uint                   `json:"taskIsolationVMMemoryMB"`
+		TaskIsolationVMProcessorCount  uint                   `json:"taskIsolationVMProcessorCount"`
+		TaskIsolationVMSSHKey          string                 `json:"taskIsolationVMSSHKey"`
+		TaskIsolationVMSwitch          string                 `json:"taskIsolationVMSwitch"`
+		TaskIsolationVMUsername        string                 `json:"taskIsolationVMUsername"`
+		TaskNetworkNamespace           bool                   `json:"taskNetworkNamespace"`
+		TaskNetworkSubnet              string                 `json:"taskNetworkSubnet"`
+		TaskUserGroups                 []string               `json:"taskUserGroups"`
+		TaskUserPasswordLength         uint                   `json:"taskUserPasswordLength"`
+		TaskUserProfilesDir            string                 `json:"taskUserProfilesDir"`
+		TaskUserRights                 []string               `json:"taskUserRights"`
+		TaskUserSetupAttempts          uint                   `json:"taskUserSetupAttempts"`
+		TaskUserSetupQuarantineSecs    uint                   `json:"taskUserSetupQuarantineSecs"`
 		TasksDir                       string                 `json:"tasksDir"`
+		TCCGrants                      []TCCGrant             `json:"tccGrants"`
+		WarmStandby                    bool                   `json:"warmStandby"`
+		WindowsDefenderExclusions      bool                   `json:"windowsDefenderExclusions"`
 		WorkerGroup                    string                 `json:"workerGroup"`
 		WorkerID                       string                 `json:"workerId"`
 		WorkerLocation                 string                 `json:"workerLocation"`
+		WorkerManagerProviderID        string                 `json:"workerManagerProviderId"`
 		WorkerManagerRootURL           string                 `json:"workerManagerRootURL"`
 		WorkerType                     string                 `json:"workerType"`
 		WorkerTypeMetadata             map[string]interface{} `json:"workerTypeMetadata"`
@@ -75,20 +203,106 @@ type (
 	}
 
 	PrivateConfig struct {
-		AccessToken   string `json:"accessToken"`
-		Certificate   string `json:"certificate"`
-		LiveLogSecret string `json:"livelogSecret"`
+		AccessToken                   string `json:"accessToken"`
+		ArtifactMirrorSecretAccessKey string `json:"artifactMirrorSecretAccessKey"`
+		Certificate                   string `json:"certificate"`
+		ControlToken                  string `json:"controlToken"`
+		LiveLogSecret                 string `json:"livelogSecret"`
+		ProxyPassword                 string `json:"proxyPassword"`
+		StatusPageToken               string `json:"statusPageToken"`
+		TaskIsolationVMPassword       string `json:"taskIsolationVMPassword"`
+		WorkerManagerStaticSecret     string `json:"workerManagerStaticSecret"`
 	}
 
 	MissingConfigError struct {
 		Setting string
 	}
+
+	// MaintenanceJob is a command that the worker runs while it is idle
+	MaintenanceJob struct {
+		// Name of the job, used in logs and for the job's log file
+		Name string `json:"name"`
+		// Command line of the job, run as the worker user
+		Command []string `json:"command"`
+		// Minimum time between consecutive runs of the job
+		IntervalSecs uint `json:"intervalSecs"`
+		// Time budget for each run of the job, after which it is killed;
+		// zero means no limit
+		MaxRunTimeSecs uint `json:"maxRunTimeSecs"`
+	}
+
+	// SigningKey is a key that the worker signs task artifacts with, which
+	// is either an ed25519 private key file, or a command that signs, e.g.
+	// with a key held in a hardware security module
+	SigningKey struct {
+		// Path of a file with the base64 encoded ed25519 private key seed,
+		// as written by generic-worker new-ed25519-keypair
+		File string `json:"file"`
+		// Command line, run as the worker user, that reads the content to
+		// sign from standard input, and writes the detached signature to
+		// standard output
+		Command []string `json:"command"`
+	}
+
+	// MaintenanceWindow is a scheduled period during which the worker stops
+	// claiming tasks, and runs maintenance commands
+	MaintenanceWindow struct {
+		// Name of the window, used in logs, metrics and for the window's log
+		// file
+		Name string `json:"name"`
+		// Cron expression of when the window starts, in UTC
+		Schedule string `json:"schedule"`
+		// Length of the window, after which commands that are still running
+		// are killed
+		DurationMins uint `json:"durationMins"`
+		// Commands to run in order, as the worker user
+		Commands [][]string `json:"commands"`
+		// Exit codes of the commands that mean the worker should reboot at
+		// the end of the window
+		RebootExitCodes []int64 `json:"rebootExitCodes"`
+	}
+
+	// FaultInjection configures faults that the worker injects into its own
+	// operation, so that operators can check that its error handling, retries
+	// and quarantine work as expected before relying on them in production.
+	// It is deliberately undocumented, and must never be set on production
+	// workers.
+	FaultInjection struct {
+		// Probability, between 0 and 1, that an attempt of a Taskcluster API
+		// call fails with HTTP 500 Internal Server Error without being made
+		APIErrorRate float64 `json:"apiErrorRate"`
+		// Upload rate limit of artifacts, in bytes per second, on top of any
+		// other limits; zero means no limit
+		UploadBytesPerSec uint `json:"uploadBytesPerSec"`
+		// Whether the disks of the worker are reported to have no free space
+		DiskFull bool `json:"diskFull"`
+		// Seconds added to the local clock when signing Taskcluster API
+		// requests and urls, which can be negative
+		ClockSkewSecs int64 `json:"clockSkewSecs"`
+	}
+
+	// TCCGrant is a macOS privacy permission that is granted to a client
+	// without prompting
+	TCCGrant struct {
+		// TCC service, without kTCCService prefix, e.g. "ScreenCapture"
+		Service string `json:"service"`
+		// Bundle identifier or absolute path of the client, e.g.
+		// "com.apple.Terminal" or "/usr/bin/osascript"
+		Client string `json:"client"`
+	}
 )
 
 func (c *Config) String() string {
 	cCopy := *c
 	cCopy.AccessToken = "*************"
+	cCopy.ArtifactMirrorSecretAccessKey = "*************"
+	cCopy.Certificate = "*************"
+	cCopy.ControlToken = "*************"
 	cCopy.LiveLogSecret = "*************"
+	cCopy.ProxyPassword = "*************"
+	cCopy.StatusPageToken = "*************"
+	cCopy.TaskIsolationVMPassword = "*************"
+	cCopy.WorkerManagerStaticSecret = "*************"
 	// This json.Marshal call won't sort all inherited properties
 	// alphabetically, since it sorts properties within each nested struct, but
 	// concatenates the results from each of the nested structs together.
@@ -145,6 +359,109 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if c.SelfUpdateManifestURL != "" && c.SelfUpdateEd25519PublicKey == "" {
+		return fmt.Errorf("Config setting \"selfUpdateEd25519PublicKey\" must be defined when \"selfUpdateManifestURL\" is set")
+	}
+
+	if c.ArtifactMirror != "" {
+		u, err := url.Parse(c.ArtifactMirror)
+		if err != nil {
+			return fmt.Errorf("Config setting \"artifactMirror\" is not a valid URL: %v", err)
+		}
+		switch u.Scheme {
+		case "s3", "gs", "file":
+		default:
+			return fmt.Errorf("Config setting \"artifactMirror\" has unsupported scheme %q - allowed schemes are \"s3\", \"gs\" and \"file\"", u.Scheme)
+		}
+	}
+
+	for _, status := range c.NotifyOnStatuses {
+		switch status {
+		case "completed", "failed", "exception":
+		default:
+			return fmt.Errorf("Config setting \"notifyOnStatuses\" contains invalid status %q - allowed values are \"completed\", \"failed\" and \"exception\"", status)
+		}
+	}
+
+	switch c.ConfigDriftPolicy {
+	case "", "report", "restart", "reconfigure":
+	default:
+		return fmt.Errorf("Config setting \"configDriftPolicy\" has invalid value %q - allowed values are \"\", \"report\", \"restart\" and \"reconfigure\"", c.ConfigDriftPolicy)
+	}
+
+	switch c.ConfirmIndexRoutes {
+	case "", "verify", "insert":
+	default:
+		return fmt.Errorf("Config setting \"confirmIndexRoutes\" has invalid value %q - allowed values are \"\", \"verify\" and \"insert\"", c.ConfirmIndexRoutes)
+	}
+
+	switch c.TaskEnvironmentCapture {
+	case "", "never", "on-failure", "always":
+	default:
+		return fmt.Errorf("Config setting \"taskEnvironmentCapture\" has invalid value %q - allowed values are \"\", \"never\", \"on-failure\" and \"always\"", c.TaskEnvironmentCapture)
+	}
+
+	if c.ClaimExpiryMarginSecs >= 180 {
+		return fmt.Errorf("Config setting \"claimExpiryMarginSecs\" must be less than 180, since claims are renewed 3 minutes before they expire")
+	}
+
+	for _, pattern := range c.CircuitBreakerPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("Config setting \"circuitBreakerPatterns\" contains invalid regular expression %q: %v", pattern, err)
+		}
+	}
+
+	for id, key := range c.ArtifactSigningKeys {
+		switch {
+		case !signingKeyID.MatchString(id):
+			return fmt.Errorf("Config setting \"artifactSigningKeys\" key ID %q must match regular expression %v", id, signingKeyID)
+		case (key.File == "") == (len(key.Command) == 0):
+			return fmt.Errorf("Config setting \"artifactSigningKeys\" key %q must have exactly one of file and command", id)
+		}
+	}
+
+	names := map[string]bool{}
+	for i, job := range c.MaintenanceJobs {
+		switch {
+		case job.Name == "":
+			return fmt.Errorf("Config setting \"maintenanceJobs\" entry %v has no name", i)
+		case strings.ContainsAny(job.Name, `/\`):
+			return fmt.Errorf("Config setting \"maintenanceJobs\" job name %q may not contain path separators", job.Name)
+		case names[job.Name]:
+			return fmt.Errorf("Config setting \"maintenanceJobs\" contains more than one job named %q", job.Name)
+		case len(job.Command) == 0:
+			return fmt.Errorf("Config setting \"maintenanceJobs\" job %q has no command", job.Name)
+		}
+		names[job.Name] = true
+	}
+
+	names = map[string]bool{}
+	for i, window := range c.MaintenanceWindows {
+		switch {
+		case window.Name == "":
+			return fmt.Errorf("Config setting \"maintenanceWindows\" entry %v has no name", i)
+		case strings.ContainsAny(window.Name, `/\`):
+			return fmt.Errorf("Config setting \"maintenanceWindows\" window name %q may not contain path separators", window.Name)
+		case names[window.Name]:
+			return fmt.Errorf("Config setting \"maintenanceWindows\" contains more than one window named %q", window.Name)
+		case window.DurationMins == 0:
+			return fmt.Errorf("Config setting \"maintenanceWindows\" window %q has no durationMins", window.Name)
+		}
+		if _, err := cron.Parse(window.Schedule); err != nil {
+			return fmt.Errorf("Config setting \"maintenanceWindows\" window %q has invalid schedule: %v", window.Name, err)
+		}
+		for j, command := range window.Commands {
+			if len(command) == 0 {
+				return fmt.Errorf("Config setting \"maintenanceWindows\" window %q has empty command %v", window.Name, j)
+			}
+		}
+		names[window.Name] = true
+	}
+
+	if f := c.FaultInjection; f != nil && (f.APIErrorRate < 0 || f.APIErrorRate > 1) {
+		return fmt.Errorf("Config setting \"faultInjection.apiErrorRate\" must be between 0 and 1, but is %v", f.APIErrorRate)
+	}
+
 	// all required config set!
 	return nil
 }
@@ -167,24 +484,47 @@ func (c *Config) Auth() *tcauth.Auth {
 	if c.AuthRootURL != "" {
 		auth.RootURL = c.AuthRootURL
 	}
+	auth.HTTPRetry = c.HTTPRetry
 	return auth
 }
 
+func (c *Config) Index() *tcindex.Index {
+	index := tcindex.New(c.Credentials(), c.RootURL)
+	// If indexRootURL provided, it should take precedence over rootURL
+	if c.IndexRootURL != "" {
+		index.RootURL = c.IndexRootURL
+	}
+	index.HTTPRetry = c.HTTPRetry
+	return index
+}
+
 func (c *Config) Queue() *tcqueue.Queue {
 	queue := tcqueue.New(c.Credentials(), c.RootURL)
 	// If queueRootURL provided, it should take precedence over rootURL
 	if c.QueueRootURL != "" {
 		queue.RootURL = c.QueueRootURL
 	}
+	queue.HTTPRetry = c.HTTPRetry
 	return queue
 }
 
+func (c *Config) Notify() *tcnotify.Notify {
+	notify := tcnotify.New(c.Credentials(), c.RootURL)
+	// If notifyRootURL provided, it should take precedence over rootURL
+	if c.NotifyRootURL != "" {
+		notify.RootURL = c.NotifyRootURL
+	}
+	notify.HTTPRetry = c.HTTPRetry
+	return notify
+}
+
 func (c *Config) PurgeCache() *tcpurgecache.PurgeCache {
 	purgeCache := tcpurgecache.New(c.Credentials(), c.RootURL)
 	// If purgeCacheRootURL provided, it should take precedence over rootURL
 	if c.PurgeCacheRootURL != "" {
 		purgeCache.RootURL = c.PurgeCacheRootURL
 	}
+	purgeCache.HTTPRetry = c.HTTPRetry
 	return purgeCache
 }
 
@@ -194,6 +534,7 @@ func (c *Config) Secrets() *tcsecrets.Secrets {
 	if c.SecretsRootURL != "" {
 		secrets.RootURL = c.SecretsRootURL
 	}
+	secrets.HTTPRetry = c.HTTPRetry
 	return secrets
 }
 
@@ -203,6 +544,7 @@ func (c *Config) WorkerManager() *tcworkermanager.WorkerManager {
 	if c.WorkerManagerRootURL != "" {
 		workerManager.RootURL = c.WorkerManagerRootURL
 	}
+	workerManager.HTTPRetry = c.HTTPRetry
 	return workerManager
 }
 
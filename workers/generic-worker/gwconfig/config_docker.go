@@ -3,4 +3,8 @@
 package gwconfig
 
 type PublicEngineConfig struct {
+	DockerPinnedImages    []string          `json:"dockerPinnedImages"`
+	DockerPullAttempts    uint              `json:"dockerPullAttempts"`
+	DockerRegistryMirrors []string          `json:"dockerRegistryMirrors"`
+	DockerRegistrySecrets map[string]string `json:"dockerRegistrySecrets"`
 }
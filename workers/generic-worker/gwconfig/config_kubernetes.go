@@ -0,0 +1,9 @@
+// +build kubernetes
+
+package gwconfig
+
+type PublicEngineConfig struct {
+	KubernetesAPIServer    string `json:"kubernetesAPIServer"`
+	KubernetesNamespace    string `json:"kubernetesNamespace"`
+	KubernetesSidecarImage string `json:"kubernetesSidecarImage"`
+}
@@ -1,4 +1,4 @@
-// +build darwin,!docker linux,!docker freebsd
+// +build darwin,!docker,!kubernetes linux,!docker,!kubernetes freebsd
 
 package main
 
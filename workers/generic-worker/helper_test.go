@@ -56,6 +56,7 @@ func setupEnvironment(t *testing.T) (teardown func()) {
 	for _, file := range []string{
 		filepath.Join(cwd, "file-caches.json"),
 		filepath.Join(cwd, "directory-caches.json"),
+		filepath.Join(cwd, "docker-images.json"),
 	} {
 		err := os.RemoveAll(file)
 		if err != nil {
@@ -91,6 +92,21 @@ func setupEnvironment(t *testing.T) (teardown func()) {
 	}
 }
 
+// allPayloadFeatures lists every payload feature, on any platform, so that
+// tests can exercise them without needing to update the worker config
+var allPayloadFeatures = []string{
+	"chainOfTrust",
+	"commandTrace",
+	"crashDumps",
+	"performanceCapture",
+	"rdpInfo",
+	"resultCache",
+	"runAsAdministrator",
+	"screenCapture",
+	"secrets",
+	"taskclusterProxy",
+}
+
 func setup(t *testing.T) (teardown func()) {
 	teardown = setupEnvironment(t)
 	// configure the worker
@@ -107,6 +123,7 @@ func setup(t *testing.T) (teardown func()) {
 			// Need common caches directory across tests, since files
 			// directory-caches.json and file-caches.json are not per-test.
 			CachesDir:                      filepath.Join(cwd, "caches"),
+			CheckForCancellationEverySecs:  0,
 			CheckForNewDeploymentEverySecs: 0,
 			CleanUpTaskDirs:                false,
 			ClientID:                       os.Getenv("TASKCLUSTER_CLIENT_ID"),
@@ -116,6 +133,7 @@ func setup(t *testing.T) (teardown func()) {
 			// directory-caches.json and file-caches.json are not per-test.
 			DownloadsDir:              filepath.Join(cwd, "downloads"),
 			Ed25519SigningKeyLocation: filepath.Join(testdataDir, "ed25519_private_key"),
+			EnabledFeatures:           allPayloadFeatures,
 			IdleTimeoutSecs:           60,
 			InstanceID:                "test-instance-id",
 			InstanceType:              "p3.enormous",
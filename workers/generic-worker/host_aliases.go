@@ -0,0 +1,112 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// scope required by tasks in order to use the feature
+const hostAliasesScope scopes.Pattern = "generic-worker:host-aliases:<provisionerId>/<workerType>"
+
+// path, relative to task directory, of the task-scoped hosts file
+var hostsFilePath = filepath.Join("generic-worker", "hosts")
+
+// HostAliasesFeature writes the hostname overrides in task.payload.hostAliases
+// to a task-scoped hosts file, which task isolation mounts over /etc/hosts
+// inside the sandbox of the task
+type HostAliasesFeature struct {
+}
+
+func (feature *HostAliasesFeature) Name() string {
+	return "Host Aliases"
+}
+
+func (feature *HostAliasesFeature) PayloadName() string {
+	return "hostAliases"
+}
+
+func (feature *HostAliasesFeature) ScopePattern() scopes.Pattern {
+	return hostAliasesScope
+}
+
+func (feature *HostAliasesFeature) Initialise() error {
+	if !payloadFeatureEnabled(feature.PayloadName()) {
+		return nil
+	}
+	if err := hostAliasesSupported(); err != nil {
+		return fmt.Errorf("%v, so enabledFeatures may not include %q", err, feature.PayloadName())
+	}
+	return nil
+}
+
+func (feature *HostAliasesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *HostAliasesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.HostAliases) > 0
+}
+
+type HostAliasesTask struct {
+	task *TaskRun
+}
+
+func (feature *HostAliasesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &HostAliasesTask{
+		task: task,
+	}
+}
+
+func (ha *HostAliasesTask) RequiredScopes() scopes.Expression {
+	return workerScope(hostAliasesScope)
+}
+
+func (ha *HostAliasesTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (ha *HostAliasesTask) Start() *CommandExecutionError {
+	for _, alias := range ha.task.Payload.HostAliases {
+		if net.ParseIP(alias.IP) == nil {
+			return MalformedPayloadError(fmt.Errorf("Host alias %v has invalid IP address %q", alias.Hostname, alias.IP))
+		}
+	}
+	base, err := ioutil.ReadFile("/etc/hosts")
+	if err != nil && !os.IsNotExist(err) {
+		return executionError(internalError, errored, fmt.Errorf("[host aliases] Could not read /etc/hosts: %v", err))
+	}
+	file := filepath.Join(taskContext.TaskDir, hostsFilePath)
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(file, hostsFile(base, ha.task.Payload.HostAliases), 0644)
+	}
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[host aliases] Could not write hosts file %v: %v", file, err))
+	}
+	for _, alias := range ha.task.Payload.HostAliases {
+		ha.task.Infof("[host aliases] %v resolves to %v", alias.Hostname, alias.IP)
+	}
+	return nil
+}
+
+func (ha *HostAliasesTask) Stop(err *ExecutionErrors) {
+}
+
+// hostsFile returns the content of a hosts file with the given aliases
+// followed by base. The aliases come first, since the first matching entry of
+// a hosts file wins.
+func hostsFile(base []byte, aliases []HostAlias) []byte {
+	content := "# task.payload.hostAliases\n"
+	for _, alias := range aliases {
+		content += alias.IP + "\t" + alias.Hostname + "\n"
+	}
+	content += "\n# /etc/hosts of the worker\n"
+	return append([]byte(content), base...)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+)
+
+var (
+	// index namespaces that the index service accepts in task routes
+	indexNamespaceFormat = regexp.MustCompile(`^([a-zA-Z0-9_!~*'()%-]+\.)*[a-zA-Z0-9_!~*'()%-]+$`)
+	// how long to wait for the index service between attempts to find a
+	// task in the index, when config setting confirmIndexRoutes is "verify"
+	indexRouteVerifyDelays = []time.Duration{5 * time.Second, 10 * time.Second, 15 * time.Second}
+)
+
+// indexOptions are the settings of task.extra.index that the index service
+// uses when indexing a task under its routes
+type indexOptions struct {
+	Rank    float64         `json:"rank"`
+	Expires tcclient.Time   `json:"expires"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// indexNamespaces returns the index namespaces of the "index.<namespace>"
+// routes of the task
+func (task *TaskRun) indexNamespaces() []string {
+	namespaces := []string{}
+	for _, route := range task.Definition.Routes {
+		if !strings.HasPrefix(route, "index.") {
+			continue
+		}
+		namespace := strings.TrimPrefix(route, "index.")
+		if indexNamespaceFormat.MatchString(namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// indexOptions returns the options that the index service would index the
+// task with, with the same defaults
+func (task *TaskRun) indexOptions() indexOptions {
+	var extra struct {
+		Index indexOptions `json:"index"`
+	}
+	extra.Index.Expires = task.Definition.Expires
+	if len(task.Definition.Extra) > 0 {
+		if err := json.Unmarshal(task.Definition.Extra, &extra); err != nil {
+			log.Printf("WARNING: could not interpret task.extra.index of task %v: %v", task.TaskID, err)
+		}
+	}
+	if len(extra.Index.Data) == 0 {
+		extra.Index.Data = json.RawMessage(`{}`)
+	}
+	return extra.Index
+}
+
+// confirmIndexRoutes checks that a successfully completed task is indexed
+// under all of its index routes, according to config setting
+// confirmIndexRoutes. The task log has already been uploaded, so problems are
+// only reported in the worker log.
+func (task *TaskRun) confirmIndexRoutes() {
+	namespaces := task.indexNamespaces()
+	if config.ConfirmIndexRoutes == "" || len(namespaces) == 0 {
+		return
+	}
+	options := task.indexOptions()
+	var missing map[string]string
+	switch config.ConfirmIndexRoutes {
+	case "verify":
+		missing = task.verifyIndexRoutes(config.Index(), namespaces, options)
+	case "insert":
+		missing = task.insertIndexRoutes(task.Index(), namespaces, options)
+	}
+	for _, namespace := range sortedKeys(missing) {
+		log.Printf("WARNING: task %v is not indexed under route index.%v: %v", task.TaskID, namespace, missing[namespace])
+		logEventWithFields("indexRouteMissing", task, time.Now(), map[string]interface{}{
+			"namespace": namespace,
+			"reason":    missing[namespace],
+		})
+	}
+	if len(missing) == 0 {
+		log.Printf("Task %v is indexed under all of its index routes", task.TaskID)
+	}
+}
+
+// verifyIndexRoutes waits for the index service to index the task under each
+// of the given namespaces, and returns the reason for each namespace that it
+// isn't indexed under. A namespace where a task of higher rank is indexed has
+// still been honoured.
+func (task *TaskRun) verifyIndexRoutes(index *tcindex.Index, namespaces []string, options indexOptions) (missing map[string]string) {
+	pending := namespaces
+	for _, delay := range indexRouteVerifyDelays {
+		time.Sleep(delay)
+		remaining := []string{}
+		for _, namespace := range pending {
+			indexedTask, err := index.FindTask(namespace)
+			if err != nil || (indexedTask.TaskID != task.TaskID && indexedTask.Rank <= options.Rank) {
+				remaining = append(remaining, namespace)
+			}
+		}
+		pending = remaining
+		if len(pending) == 0 {
+			break
+		}
+	}
+	missing = map[string]string{}
+	for _, namespace := range pending {
+		missing[namespace] = "task not found in index"
+	}
+	return
+}
+
+// insertIndexRoutes inserts the task into the index under each of the given
+// namespaces, and returns the reason for each namespace that it couldn't be
+// inserted under
+func (task *TaskRun) insertIndexRoutes(index *tcindex.Index, namespaces []string, options indexOptions) (missing map[string]string) {
+	missing = map[string]string{}
+	for _, namespace := range namespaces {
+		_, err := index.InsertTask(
+			namespace,
+			&tcindex.InsertTaskRequest{
+				TaskID:  task.TaskID,
+				Data:    options.Data,
+				Expires: options.Expires,
+				Rank:    options.Rank,
+			},
+		)
+		if err != nil {
+			missing[namespace] = err.Error()
+			continue
+		}
+		log.Printf("Inserted task %v into index namespace %v", task.TaskID, namespace)
+	}
+	return
+}
+
+// Index returns an index client with the task credentials
+func (task *TaskRun) Index() *tcindex.Index {
+	index := tcindex.New(task.Queue.Credentials, config.RootURL)
+	index.HTTPRetry = config.HTTPRetry
+	// if indexRootURL is configured, this takes precedence over rootURL
+	if config.IndexRootURL != "" {
+		index.RootURL = config.IndexRootURL
+	}
+	return index
+}
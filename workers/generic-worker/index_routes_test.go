@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// fakeIndex serves the findTask and insertTask endpoints of the index service
+// from the given index entries
+func fakeIndex(t *testing.T, entries map[string]*tcindex.IndexedTaskResponse) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		namespace := strings.TrimPrefix(req.URL.Path, "/api/index/v1/task/")
+		switch req.Method {
+		case "GET":
+			entry, found := entries[namespace]
+			if !found {
+				w.WriteHeader(404)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(entry)
+		case "PUT":
+			if namespace == "forbidden" {
+				w.WriteHeader(403)
+				return
+			}
+			var request tcindex.InsertTaskRequest
+			if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+				t.Errorf("Could not decode insertTask request: %v", err)
+			}
+			entries[namespace] = &tcindex.IndexedTaskResponse{
+				Namespace: namespace,
+				TaskID:    request.TaskID,
+				Rank:      request.Rank,
+				Data:      request.Data,
+			}
+			_ = json.NewEncoder(w).Encode(entries[namespace])
+		}
+	}))
+}
+
+func indexRoutesTask(rootURL string) *TaskRun {
+	return &TaskRun{
+		TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		Definition: tcqueue.TaskDefinitionResponse{
+			Routes: []string{"index.project.own", "index.project.outranked", "index.project.missing", "tc-treeherder.v2.project", "index.forbidden"},
+			Extra:  json.RawMessage(`{"index": {"rank": 3, "data": {"a": "b"}}}`),
+		},
+		Queue: tcqueue.New(nil, rootURL),
+	}
+}
+
+func TestIndexNamespaces(t *testing.T) {
+	task := indexRoutesTask("https://tc.example.com")
+	expected := []string{"project.own", "project.outranked", "project.missing", "forbidden"}
+	if namespaces := task.indexNamespaces(); !reflect.DeepEqual(namespaces, expected) {
+		t.Errorf("Was expecting index namespaces %v but got %v", expected, namespaces)
+	}
+	if options := task.indexOptions(); options.Rank != 3 || string(options.Data) != `{"a": "b"}` {
+		t.Errorf("Unexpected index options %#v", options)
+	}
+}
+
+func TestVerifyIndexRoutes(t *testing.T) {
+	s := fakeIndex(t, map[string]*tcindex.IndexedTaskResponse{
+		"project.own":       {TaskID: "KTBKfEgxR5GdfIIREQIvFQ", Rank: 3},
+		"project.outranked": {TaskID: "OtherTaskIDwh8jAanQaDQ", Rank: 4},
+		"project.missing":   {TaskID: "OtherTaskIDwh8jAanQaDQ", Rank: 3},
+	})
+	defer s.Close()
+	oldDelays := indexRouteVerifyDelays
+	indexRouteVerifyDelays = []time.Duration{0, 0}
+	defer func() {
+		indexRouteVerifyDelays = oldDelays
+	}()
+	task := indexRoutesTask(s.URL)
+	missing := task.verifyIndexRoutes(tcindex.New(nil, s.URL), task.indexNamespaces(), task.indexOptions())
+	if len(missing) != 2 || missing["project.missing"] == "" || missing["forbidden"] == "" {
+		t.Errorf("Was expecting namespaces project.missing and forbidden to be missing, but got %v", missing)
+	}
+}
+
+func TestInsertIndexRoutes(t *testing.T) {
+	entries := map[string]*tcindex.IndexedTaskResponse{}
+	s := fakeIndex(t, entries)
+	defer s.Close()
+	task := indexRoutesTask(s.URL)
+	missing := task.insertIndexRoutes(tcindex.New(nil, s.URL), task.indexNamespaces(), task.indexOptions())
+	if len(missing) != 1 || missing["forbidden"] == "" {
+		t.Errorf("Was expecting only namespace forbidden to be missing, but got %v", missing)
+	}
+	entry := entries["project.missing"]
+	if entry == nil || entry.TaskID != task.TaskID || entry.Rank != 3 || string(entry.Data) != `{"a":"b"}` {
+		t.Errorf("Unexpected index entry %#v", entry)
+	}
+}
@@ -128,3 +128,55 @@ func TestIntermittentNegativeExitCode(t *testing.T) {
 		t.Fatalf("Was expecting log to contain string %v.", substring)
 	}
 }
+
+// Exit codes in onExitStatus.success should be treated as success
+func TestSuccessExitCodeCompletes(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(77),
+		MaxRunTime: 30,
+		OnExitStatus: ExitCodeHandling{
+			Success: []int64{77},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+}
+
+// Exit codes in onExitStatus.exception should resolve as exception with the
+// given reason
+func TestExceptionExitCodeResolvesWithReason(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(70),
+		MaxRunTime: 30,
+		OnExitStatus: ExitCodeHandling{
+			Exception: []ExceptionMapping{
+				{
+					Reason:    "resource-unavailable",
+					ExitCodes: []int64{70, 71},
+				},
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "resource-unavailable")
+}
+
+// An exit code may only be handled one way
+func TestExitCodeInMultipleListsIsMalformed(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(0),
+		MaxRunTime: 30,
+		OnExitStatus: ExitCodeHandling{
+			Retry:   []int64{70},
+			Success: []int64{70},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
@@ -0,0 +1,228 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+const (
+	// scope required by tasks in order to use the feature
+	iosSimulatorScope        scopes.Pattern = "generic-worker:ios-simulator:<provisionerId>/<workerType>"
+	simulatorLogArtifactName                = "public/logs/simulator.log"
+	// relative to task directory
+	simulatorLogPath = "generic-worker/simulator.log"
+)
+
+// IOSSimulatorFeature creates a new iOS simulator, of the device type and
+// runtime requested in the task payload, for each task, and deletes it when
+// the task completes, so that no simulator state is carried over between
+// tasks.
+type IOSSimulatorFeature struct {
+}
+
+func (feature *IOSSimulatorFeature) Name() string {
+	return "iOS Simulator"
+}
+
+func (feature *IOSSimulatorFeature) PayloadName() string {
+	return "iosSimulator"
+}
+
+func (feature *IOSSimulatorFeature) ScopePattern() scopes.Pattern {
+	return iosSimulatorScope
+}
+
+func (feature *IOSSimulatorFeature) Initialise() error {
+	if !payloadFeatureEnabled(feature.PayloadName()) {
+		return nil
+	}
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("iOS simulators are not supported on %v, so enabledFeatures may not include %q", runtime.GOOS, feature.PayloadName())
+	}
+	out, err := host.CombinedOutput("/usr/bin/xcrun", "--find", "simctl")
+	if err != nil {
+		return fmt.Errorf("Could not find simctl - is Xcode installed? %v\n%v", err, out)
+	}
+	return nil
+}
+
+func (feature *IOSSimulatorFeature) PersistState() error {
+	return nil
+}
+
+func (feature *IOSSimulatorFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.IosSimulator.DeviceType != ""
+}
+
+type IOSSimulatorTask struct {
+	task *TaskRun
+	// empty until the simulator has been created
+	udid   string
+	logger *exec.Cmd
+	// closed once the logger has exited and its output file is closed
+	loggerExited chan struct{}
+}
+
+func (feature *IOSSimulatorFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &IOSSimulatorTask{
+		task: task,
+	}
+}
+
+func (l *IOSSimulatorTask) RequiredScopes() scopes.Expression {
+	return workerScope(iosSimulatorScope)
+}
+
+func (l *IOSSimulatorTask) ReservedArtifacts() []string {
+	return []string{
+		simulatorLogArtifactName,
+	}
+}
+
+func (l *IOSSimulatorTask) Start() *CommandExecutionError {
+	sim := l.task.Payload.IosSimulator
+	udid, err := simctl("create", "generic-worker-"+l.task.TaskID, sim.DeviceType, sim.Runtime)
+	if err != nil {
+		// almost always an unknown device type or runtime, or an invalid
+		// combination of the two
+		return MalformedPayloadError(fmt.Errorf("[ios] Could not create iOS simulator with device type %q and runtime %q: %v", sim.DeviceType, sim.Runtime, err))
+	}
+	l.udid = udid
+	l.task.Infof("[ios] Created iOS simulator %v (%v, %v)", l.udid, sim.DeviceType, sim.Runtime)
+
+	started := time.Now()
+	timeout := time.Duration(config.IOSSimulatorBootTimeoutSecs) * time.Second
+	err = bootSimulator(l.udid, timeout)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[ios] iOS simulator %v did not boot: %v", l.udid, err))
+	}
+	l.task.Infof("[ios] iOS simulator %v booted in %v", l.udid, time.Since(started))
+
+	logFile := filepath.Join(taskContext.TaskDir, simulatorLogPath)
+	err = os.MkdirAll(filepath.Dir(logFile), 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[ios] Could not create directory for simulator log: %v", err))
+	}
+	simulatorLog, err := os.Create(logFile)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[ios] Could not create simulator log: %v", err))
+	}
+	cmd := simctlCommand("spawn", l.udid, "log", "stream", "--style", "compact")
+	l.logger = exec.Command(cmd[0], cmd[1:]...)
+	l.logger.Stdout = simulatorLog
+	l.logger.Stderr = simulatorLog
+	l.loggerExited = make(chan struct{})
+	err = l.logger.Start()
+	if err != nil {
+		simulatorLog.Close()
+		l.logger = nil
+		l.task.Warnf("[ios] Could not capture simulator log: %v", err)
+	} else {
+		go func() {
+			_ = l.logger.Wait()
+			simulatorLog.Close()
+			close(l.loggerExited)
+		}()
+	}
+
+	err = l.task.setVariable("SIMULATOR_UDID", l.udid)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[ios] Could not set SIMULATOR_UDID: %v", err))
+	}
+	return nil
+}
+
+func (l *IOSSimulatorTask) Stop(err *ExecutionErrors) {
+	if l.udid == "" {
+		return
+	}
+	if l.logger != nil {
+		_ = l.logger.Process.Kill()
+		<-l.loggerExited
+	}
+	// shutting down a simulator that isn't booted fails, which is harmless
+	_, _ = simctl("shutdown", l.udid)
+	_, e := simctl("delete", l.udid)
+	if e != nil {
+		log.Printf("WARNING: could not delete iOS simulator %v: %v", l.udid, e)
+	} else {
+		l.task.Infof("[ios] Deleted iOS simulator %v", l.udid)
+	}
+	if l.logger == nil {
+		return
+	}
+	err.add(l.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    simulatorLogArtifactName,
+				Expires: l.task.Definition.Expires,
+			},
+			ContentType:     "text/plain; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            simulatorLogPath,
+		},
+	))
+}
+
+// bootSimulator boots the simulator with the given UDID, and waits until it
+// has finished booting, or timeout has elapsed
+func bootSimulator(udid string, timeout time.Duration) error {
+	cmd := simctlCommand("bootstatus", udid, "-b")
+	boot := exec.Command(cmd[0], cmd[1:]...)
+	var out strings.Builder
+	boot.Stdout = &out
+	boot.Stderr = &out
+	err := boot.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- boot.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		_ = boot.Process.Kill()
+		<-done
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, out.String())
+	}
+	return nil
+}
+
+// simctl runs xcrun simctl with the given arguments, and returns its
+// (trimmed) standard output
+func simctl(args ...string) (string, error) {
+	cmd := simctlCommand(args...)
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("%v\n%s", err, exitErr.Stderr)
+	}
+	return strings.TrimSpace(string(out)), err
+}
+
+// simctlCommand returns the command line to run xcrun simctl with the given
+// arguments. Simulators belong to the user that creates them, so simctl is
+// run as the task user, in order that task commands can use the simulator.
+func simctlCommand(args ...string) []string {
+	cmd := append([]string{"/usr/bin/xcrun", "simctl"}, args...)
+	// taskContext.User is nil if running tasks as current user
+	if taskContext.User != nil {
+		cmd = append([]string{"/usr/bin/sudo", "-H", "-u", taskContext.User.Name}, cmd...)
+	}
+	return cmd
+}
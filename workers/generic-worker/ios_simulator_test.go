@@ -0,0 +1,74 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	gwruntime "github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+func TestIOSSimulatorConfig(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	feature := &IOSSimulatorFeature{}
+	if err := feature.Initialise(); err != nil {
+		t.Fatalf("Was not expecting a disabled feature to require anything, but got: %v", err)
+	}
+	// on macOS, initialisation depends on whether Xcode is installed
+	if runtime.GOOS == "darwin" {
+		return
+	}
+	config.EnabledFeatures = []string{"iosSimulator"}
+	if err := feature.Initialise(); err == nil || !strings.Contains(err.Error(), "not supported on "+runtime.GOOS) {
+		t.Fatalf("Was expecting iOS simulators to be unsupported on %v, but got: %v", runtime.GOOS, err)
+	}
+}
+
+func TestSimctlCommand(t *testing.T) {
+	defer func(tc *TaskContext) {
+		taskContext = tc
+	}(taskContext)
+	taskContext = &TaskContext{}
+	expected := []string{"/usr/bin/xcrun", "simctl", "create", "generic-worker-abc", "iPhone 14", "iOS-16-4"}
+	if cmd := simctlCommand("create", "generic-worker-abc", "iPhone 14", "iOS-16-4"); !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("Was expecting simctl command %q but got %q", expected, cmd)
+	}
+	// simulators belong to the user that creates them
+	taskContext = &TaskContext{
+		User: &gwruntime.OSUser{
+			Name: "task_1234567890",
+		},
+	}
+	expected = []string{"/usr/bin/sudo", "-H", "-u", "task_1234567890", "/usr/bin/xcrun", "simctl", "bootstatus", "ABCD-1234", "-b"}
+	if cmd := simctlCommand("bootstatus", "ABCD-1234", "-b"); !reflect.DeepEqual(cmd, expected) {
+		t.Errorf("Was expecting simctl command %q but got %q", expected, cmd)
+	}
+}
+
+func TestIOSSimulatorPayload(t *testing.T) {
+	task := taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "iosSimulator": {
+    "deviceType": "iPhone 14",
+    "runtime": "iOS-16-4"
+  }
+}`)
+	ensureValidPayload(t, task)
+	if !(&IOSSimulatorFeature{}).IsEnabled(task) {
+		t.Error("Was expecting iOS simulator to be enabled for task with a device type")
+	}
+	// runtime is required
+	ensureMalformedPayload(t, taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [`+rawHelloGoodbye()+`],
+  "iosSimulator": {
+    "deviceType": "iPhone 14"
+  }
+}`))
+}
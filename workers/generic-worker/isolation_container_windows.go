@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"golang.org/x/sys/windows"
+)
+
+const (
+	processContainerIsolation = "process"
+	hyperVContainerIsolation  = "hyperv"
+)
+
+var (
+	dockerCommand string
+	// Windows build number of the worker, that container images must be
+	// compatible with
+	hostBuildNumber uint32
+)
+
+// initialiseWindowsContainers checks that Docker is installed and runs
+// Windows containers, rather than Linux containers
+func initialiseWindowsContainers() (err error) {
+	dockerCommand, err = exec.LookPath("docker.exe")
+	if err != nil {
+		return fmt.Errorf("Config setting taskIsolation is %q but Docker is not installed: %v", config.TaskIsolation, err)
+	}
+	out, err := host.CombinedOutput(dockerCommand, "version", "--format", "{{.Server.Os}}")
+	if err != nil {
+		return fmt.Errorf("Config setting taskIsolation is %q but Docker is not running: %v", config.TaskIsolation, err)
+	}
+	if serverOS := strings.TrimSpace(out); serverOS != "windows" {
+		return fmt.Errorf("Config setting taskIsolation is %q but Docker runs %v containers - switch Docker to Windows containers", config.TaskIsolation, serverOS)
+	}
+	hostBuildNumber = windows.RtlGetVersion().BuildNumber
+	return nil
+}
+
+// containerIsolation returns the isolation mode of the Windows container of
+// the task
+func (l *TaskIsolationTask) containerIsolation() string {
+	if l.task.Payload.Container.Isolation == "" {
+		return processContainerIsolation
+	}
+	return l.task.Payload.Container.Isolation
+}
+
+// pullWindowsContainerImage pulls the image of the Windows container of the
+// task, and checks that it can run on the worker
+func (l *TaskIsolationTask) pullWindowsContainerImage() *CommandExecutionError {
+	image := l.task.Payload.Container.Image
+	l.task.Infof("[isolation] Pulling image %v", image)
+	out, err := host.CombinedOutput(dockerCommand, "pull", image)
+	if err != nil {
+		for _, notFound := range []string{"manifest unknown", "not found", "does not exist", "no matching manifest"} {
+			if strings.Contains(out, notFound) {
+				return MalformedPayloadError(fmt.Errorf("[isolation] Could not pull image %v: %v", image, strings.TrimSpace(out)))
+			}
+		}
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not pull image %v: %v\n%v", image, err, out))
+	}
+	out, err = host.CombinedOutput(dockerCommand, "image", "inspect", "--format", "{{.Os}} {{.OsVersion}}", image)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[isolation] Could not inspect image %v: %v\n%v", image, err, out))
+	}
+	fields := strings.Fields(out)
+	imageOS, imageOSVersion := "", ""
+	if len(fields) > 0 {
+		imageOS = fields[0]
+	}
+	if len(fields) > 1 {
+		imageOSVersion = fields[1]
+	}
+	err = checkContainerCompatibility(hostBuildNumber, imageOS, imageOSVersion, l.containerIsolation())
+	if err != nil {
+		return MalformedPayloadError(fmt.Errorf("[isolation] Image %v cannot run on this worker: %v", image, err))
+	}
+	l.task.Infof("[isolation] Image %v has Windows version %v, running it with %v isolation", image, imageOSVersion, l.containerIsolation())
+	return nil
+}
+
+// checkContainerCompatibility checks that a Windows container image with the
+// given OS and OS version (such as "10.0.17763.1577") can run with the given
+// isolation mode on a worker with the given Windows build number. Containers
+// with process isolation share the kernel of the worker, so must have the
+// same build number, whereas Hyper-V isolated containers can run any earlier
+// build.
+func checkContainerCompatibility(hostBuild uint32, imageOS, imageOSVersion, isolation string) error {
+	if imageOS != "windows" {
+		return fmt.Errorf("it is a %q image rather than a Windows image", imageOS)
+	}
+	parts := strings.Split(imageOSVersion, ".")
+	if len(parts) < 3 {
+		return fmt.Errorf("it has unrecognised Windows version %q", imageOSVersion)
+	}
+	imageBuild, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return fmt.Errorf("it has unrecognised Windows version %q", imageOSVersion)
+	}
+	switch isolation {
+	case processContainerIsolation:
+		if uint32(imageBuild) != hostBuild {
+			return fmt.Errorf("with process isolation the image must have the same Windows build number as the worker (%v), but it has %v - use hyperv isolation or an image of build %v", hostBuild, imageBuild, hostBuild)
+		}
+	case hyperVContainerIsolation:
+		if uint32(imageBuild) > hostBuild {
+			return fmt.Errorf("with hyperv isolation the image must not have a later Windows build number than the worker (%v), but it has %v", hostBuild, imageBuild)
+		}
+	default:
+		return fmt.Errorf("unsupported isolation mode %q", isolation)
+	}
+	return nil
+}
+
+// startWindowsContainer starts the Windows container of the task, with the
+// task directory (which includes mounted caches) mounted at the same path, so
+// that the absolute paths in the command wrapper scripts are valid. The
+// container runs an idle interactive shell until it is destroyed, and the
+// task commands are run in it with `docker exec`.
+func (l *TaskIsolationTask) startWindowsContainer() error {
+	// left behind if the worker didn't stop cleanly
+	_ = l.stopWindowsContainer()
+	out, err := host.CombinedOutput(
+		dockerCommand,
+		"run",
+		"--detach",
+		"--interactive",
+		"--name", l.containerName,
+		"--isolation", l.containerIsolation(),
+		"--mount", "type=bind,source="+taskContext.TaskDir+",target="+taskContext.TaskDir,
+		"--workdir", taskContext.TaskDir,
+		"--entrypoint", "cmd.exe",
+		l.task.Payload.Container.Image,
+	)
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, out)
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) stopWindowsContainer() error {
+	out, err := host.CombinedOutput(dockerCommand, "rm", "--force", l.containerName)
+	if err != nil && !strings.Contains(out, "No such container") {
+		return fmt.Errorf("%v\n%v", err, out)
+	}
+	return nil
+}
+
+// windowsContainerRelayCommand returns the command that runs the given
+// command wrapper script in the Windows container of the task. Its output is
+// streamed to the task log, and its exit code is that of the task command.
+func (l *TaskIsolationTask) windowsContainerRelayCommand(wrapper string) []string {
+	return []string{dockerCommand, "exec", l.containerName, "cmd.exe", "/c", wrapper}
+}
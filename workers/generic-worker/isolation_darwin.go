@@ -0,0 +1,137 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const sandboxExecIsolation = "sandboxExec"
+
+// defaultSandboxProfile only allows task commands to write to the task
+// directory and temporary directories, and denies network access unless
+// ALLOW_NETWORK is "true"
+const defaultSandboxProfile = `(version 1)
+(allow default)
+(deny file-write*)
+(allow file-write*
+    (subpath (param "TASK_DIR"))
+    (subpath "/private/tmp")
+    (subpath "/private/var/folders")
+    (literal "/dev/null")
+    (literal "/dev/zero")
+    (literal "/dev/dtracehelper")
+    (regex #"^/dev/tty")
+    (regex #"^/dev/fd/"))
+(if (equal? (param "ALLOW_NETWORK") "false")
+    (deny network-outbound (remote ip)))
+`
+
+// TaskIsolationFeature wraps the commands of each task in sandbox-exec, with
+// either the default sandbox profile, or the one configured in
+// taskIsolationSandboxProfile
+type TaskIsolationFeature struct {
+	sandboxExec string
+	profile     string
+}
+
+func (feature *TaskIsolationFeature) Name() string {
+	return "Task Isolation"
+}
+
+func (feature *TaskIsolationFeature) Initialise() (err error) {
+	switch config.TaskIsolation {
+	case "":
+		return nil
+	case sandboxExecIsolation:
+		feature.sandboxExec, err = exec.LookPath("sandbox-exec")
+		if err != nil {
+			return fmt.Errorf("Config setting taskIsolation is %q but sandbox-exec is not available: %v", config.TaskIsolation, err)
+		}
+		feature.profile = defaultSandboxProfile
+		if config.TaskIsolationSandboxProfile != "" {
+			profile, err := ioutil.ReadFile(config.TaskIsolationSandboxProfile)
+			if err != nil {
+				return fmt.Errorf("Could not read sandbox profile %v specified in config setting taskIsolationSandboxProfile: %v", config.TaskIsolationSandboxProfile, err)
+			}
+			feature.profile = string(profile)
+		}
+		return nil
+	default:
+		return fmt.Errorf("Config setting taskIsolation has unsupported value %q - must be %q or empty", config.TaskIsolation, sandboxExecIsolation)
+	}
+}
+
+func (feature *TaskIsolationFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskIsolationFeature) IsEnabled(task *TaskRun) bool {
+	return config.TaskIsolation != ""
+}
+
+type TaskIsolationTask struct {
+	task    *TaskRun
+	feature *TaskIsolationFeature
+}
+
+func (feature *TaskIsolationFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskIsolationTask{
+		task:    task,
+		feature: feature,
+	}
+}
+
+func (l *TaskIsolationTask) RequiredScopes() scopes.Expression {
+	if l.task.Payload.Features.Network {
+		return workerScope(networkScope)
+	}
+	return scopes.AllOf{}
+}
+
+func (l *TaskIsolationTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (l *TaskIsolationTask) Start() *CommandExecutionError {
+	network := l.task.Payload.Features.Network
+	args := sandboxExecArgs(l.feature.sandboxExec, l.feature.profile, taskContext.TaskDir, network)
+	for _, c := range l.task.Commands {
+		// c.Cmd.Path has already been resolved against the worker's PATH, so
+		// the same executable is run as would be without the sandbox
+		c.Cmd.Args = append(append(append([]string{}, args...), c.Cmd.Path), c.Cmd.Args[1:]...)
+		c.Cmd.Path = l.feature.sandboxExec
+	}
+	if network {
+		l.task.Infof("[isolation] Running task commands with sandbox-exec with network access")
+	} else {
+		l.task.Infof("[isolation] Running task commands with sandbox-exec without network access")
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) Stop(err *ExecutionErrors) {
+}
+
+// sandboxExecArgs returns the sandbox-exec command line (up to, but not
+// including, the command to run). The profile is passed inline, rather than
+// as a file, so that task commands can't modify it.
+func sandboxExecArgs(sandboxExec, profile, taskDir string, network bool) []string {
+	return []string{
+		sandboxExec,
+		"-p", profile,
+		"-D", "TASK_DIR=" + taskDir,
+		"-D", "ALLOW_NETWORK=" + strconv.FormatBool(network),
+	}
+}
+
+// hostAliasesSupported returns an error, since sandbox-exec cannot override
+// the hosts file of task commands
+func hostAliasesSupported() error {
+	return fmt.Errorf("Host aliases are not supported on darwin")
+}
@@ -0,0 +1,25 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSandboxExecArgs(t *testing.T) {
+	for _, network := range []bool{false, true} {
+		args := sandboxExecArgs("/usr/bin/sandbox-exec", defaultSandboxProfile, "/Users/task_1", network)
+		if args[0] != "/usr/bin/sandbox-exec" || args[1] != "-p" || args[2] != defaultSandboxProfile {
+			t.Fatalf("Was expecting sandbox profile to be passed inline, but got %q", args)
+		}
+		commandLine := strings.Join(args[3:], " ")
+		expected := "-D TASK_DIR=/Users/task_1 -D ALLOW_NETWORK=false"
+		if network {
+			expected = "-D TASK_DIR=/Users/task_1 -D ALLOW_NETWORK=true"
+		}
+		if commandLine != expected {
+			t.Fatalf("Was expecting sandbox parameters %q but got %q", expected, commandLine)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// +build simple
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// TaskIsolationFeature is not implemented on FreeBSD
+type TaskIsolationFeature struct {
+}
+
+func (feature *TaskIsolationFeature) Name() string {
+	return "Task Isolation"
+}
+
+func (feature *TaskIsolationFeature) Initialise() error {
+	if config.TaskIsolation != "" {
+		return fmt.Errorf("Config setting taskIsolation is not supported on %v", runtime.GOOS)
+	}
+	return nil
+}
+
+func (feature *TaskIsolationFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskIsolationFeature) IsEnabled(task *TaskRun) bool {
+	return false
+}
+
+func (feature *TaskIsolationFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return nil
+}
+
+// hostAliasesSupported returns an error, since task isolation is not
+// implemented on FreeBSD
+func hostAliasesSupported() error {
+	return fmt.Errorf("Host aliases are not supported on %v", runtime.GOOS)
+}
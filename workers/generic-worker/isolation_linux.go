@@ -0,0 +1,177 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const (
+	bubblewrapIsolation = "bubblewrap"
+	qemuIsolation       = "qemu"
+)
+
+// directories of the worker that are bind mounted read-only into the
+// sandbox, if they exist
+var sandboxReadOnlyDirs = []string{
+	"/bin",
+	"/etc",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/opt",
+	// for /etc/resolv.conf when systemd-resolved is used
+	"/run/systemd/resolve",
+	"/sbin",
+	"/usr",
+}
+
+// TaskIsolationFeature wraps the commands of each task in a bubblewrap
+// sandbox, with a tmpfs root and the task directory bind mounted into it, or
+// runs them inside a QEMU VM that is booted for the task (see
+// isolation_qemu_linux.go)
+type TaskIsolationFeature struct {
+	bwrap string
+	qemu  *qemuTools
+}
+
+func (feature *TaskIsolationFeature) Name() string {
+	return "Task Isolation"
+}
+
+func (feature *TaskIsolationFeature) Initialise() (err error) {
+	switch config.TaskIsolation {
+	case "":
+		return nil
+	case bubblewrapIsolation:
+		feature.bwrap, err = exec.LookPath("bwrap")
+		if err != nil {
+			return fmt.Errorf("Config setting taskIsolation is %q but bwrap is not installed: %v", config.TaskIsolation, err)
+		}
+		return nil
+	case qemuIsolation:
+		feature.qemu, err = findQEMUTools()
+		return err
+	default:
+		return fmt.Errorf("Config setting taskIsolation has unsupported value %q - must be %q, %q or empty", config.TaskIsolation, bubblewrapIsolation, qemuIsolation)
+	}
+}
+
+func (feature *TaskIsolationFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskIsolationFeature) IsEnabled(task *TaskRun) bool {
+	return config.TaskIsolation != ""
+}
+
+type TaskIsolationTask struct {
+	task  *TaskRun
+	bwrap string
+	qemu  *qemuTools
+	// nil unless a QEMU VM has been started for the task
+	vm *qemuVM
+}
+
+func (feature *TaskIsolationFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskIsolationTask{
+		task:  task,
+		bwrap: feature.bwrap,
+		qemu:  feature.qemu,
+	}
+}
+
+func (l *TaskIsolationTask) RequiredScopes() scopes.Expression {
+	if l.task.Payload.Features.Network {
+		return workerScope(networkScope)
+	}
+	return scopes.AllOf{}
+}
+
+func (l *TaskIsolationTask) ReservedArtifacts() []string {
+	if config.TaskIsolation == qemuIsolation {
+		return []string{vmConsoleArtifactName}
+	}
+	return []string{}
+}
+
+func (l *TaskIsolationTask) Start() *CommandExecutionError {
+	if config.TaskIsolation == qemuIsolation {
+		return l.startQEMU()
+	}
+	if l.task.Payload.VMImage != "" {
+		return MalformedPayloadError(fmt.Errorf("Worker type %v/%v does not run tasks in VMs, so task.payload.vmImage is not supported", config.ProvisionerID, config.WorkerType))
+	}
+	hostsFile := ""
+	if len(l.task.Payload.HostAliases) > 0 {
+		// written by the host aliases feature
+		hostsFile = filepath.Join(taskContext.TaskDir, hostsFilePath)
+	}
+	args := bubblewrapArgs(l.bwrap, taskContext.TaskDir, hostsFile, l.task.Payload.Features.Network)
+	for _, c := range l.task.Commands {
+		// c.Cmd.Path has already been resolved against the worker's PATH,
+		// and is under one of the read-only directories, or the task
+		// directory
+		c.Cmd.Args = append(append(append([]string{}, args...), "--chdir", c.Cmd.Dir, "--", c.Cmd.Path), c.Cmd.Args[1:]...)
+		c.Cmd.Path = l.bwrap
+	}
+	if l.task.Payload.Features.Network {
+		l.task.Infof("[isolation] Running task commands in a bubblewrap sandbox with network access")
+	} else {
+		l.task.Infof("[isolation] Running task commands in a bubblewrap sandbox without network access")
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) Stop(err *ExecutionErrors) {
+	if l.vm != nil {
+		l.stopQEMU(err)
+	}
+}
+
+// bubblewrapArgs returns the bwrap command line (up to, but not including,
+// the command to run) for a sandbox with a tmpfs root, read-only system
+// directories, and read-write task directory. If hostsFile is not empty, it is
+// mounted over /etc/hosts.
+func bubblewrapArgs(bwrap, taskDir, hostsFile string, network bool) []string {
+	args := []string{
+		bwrap,
+		"--unshare-all",
+		"--die-with-parent",
+		"--tmpfs", "/",
+	}
+	for _, dir := range sandboxReadOnlyDirs {
+		// e.g. /lib32 doesn't exist on all distributions
+		if _, err := os.Lstat(dir); err == nil {
+			args = append(args, "--ro-bind", dir, dir)
+		}
+	}
+	if hostsFile != "" {
+		args = append(args, "--ro-bind", hostsFile, "/etc/hosts")
+	}
+	args = append(
+		args,
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--tmpfs", "/tmp",
+		"--bind", taskDir, taskDir,
+	)
+	if network {
+		args = append(args, "--share-net")
+	}
+	return args
+}
+
+// hostAliasesSupported returns an error if task.payload.hostAliases cannot be
+// applied to task commands, which requires them to run in a bubblewrap sandbox
+func hostAliasesSupported() error {
+	if config.TaskIsolation != bubblewrapIsolation {
+		return fmt.Errorf("Host aliases require config setting taskIsolation to be %q, but it is %q", bubblewrapIsolation, config.TaskIsolation)
+	}
+	return nil
+}
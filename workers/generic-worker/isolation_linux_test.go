@@ -0,0 +1,100 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBubblewrapArgs(t *testing.T) {
+	for _, network := range []bool{false, true} {
+		args := strings.Join(bubblewrapArgs("/usr/bin/bwrap", "/home/task_1", "", network), " ")
+		for _, expected := range []string{
+			"/usr/bin/bwrap --unshare-all --die-with-parent --tmpfs / ",
+			" --ro-bind /usr /usr ",
+			" --tmpfs /tmp ",
+			" --bind /home/task_1 /home/task_1",
+		} {
+			if !strings.Contains(args, expected) {
+				t.Fatalf("Was expecting bwrap command line to contain %q, but got %q", expected, args)
+			}
+		}
+		if strings.Contains(args, "--share-net") != network {
+			t.Fatalf("Network access should be %v, but bwrap command line is %q", network, args)
+		}
+	}
+}
+
+func TestBubblewrapHostsFile(t *testing.T) {
+	args := strings.Join(bubblewrapArgs("/usr/bin/bwrap", "/home/task_1", "/home/task_1/generic-worker/hosts", false), " ")
+	etc := strings.Index(args, " --ro-bind /etc /etc ")
+	hosts := strings.Index(args, " --ro-bind /home/task_1/generic-worker/hosts /etc/hosts ")
+	if hosts == -1 || hosts < etc {
+		t.Fatalf("Was expecting bwrap command line to mount hosts file over /etc/hosts after mounting /etc, but got %q", args)
+	}
+	content := string(hostsFile([]byte("127.0.0.1\tlocalhost\n10.0.0.1\tstaging.example.com\n"), []HostAlias{{Hostname: "staging.example.com", IP: "127.0.0.2"}}))
+	if !strings.HasPrefix(content, "# task.payload.hostAliases\n127.0.0.2\tstaging.example.com\n") || !strings.HasSuffix(content, "10.0.0.1\tstaging.example.com\n") {
+		t.Fatalf("Was expecting host aliases to precede worker's hosts file, but got:\n%v", content)
+	}
+}
+
+func TestQEMUArgs(t *testing.T) {
+	vm := &qemuVM{
+		overlay: "/home/task_1.qcow2",
+		console: "/home/task_1/generic-worker/isolation/console.log",
+		sshPort: 40022,
+	}
+	for _, network := range []bool{false, true} {
+		args := strings.Join(vm.qemuArgs(&qemuTools{qemu: "/usr/bin/qemu-system-x86_64", kvm: true}, 4096, 2, network), " ")
+		for _, expected := range []string{
+			"/usr/bin/qemu-system-x86_64 -m 4096 -smp 2 ",
+			" -drive file=/home/task_1.qcow2,if=virtio,format=qcow2 ",
+			" -netdev user,id=net0,hostfwd=tcp:127.0.0.1:40022-:22",
+			" -serial file:/home/task_1/generic-worker/isolation/console.log",
+			" -enable-kvm",
+		} {
+			if !strings.Contains(args, expected) {
+				t.Fatalf("Was expecting QEMU command line to contain %q, but got %q", expected, args)
+			}
+		}
+		if strings.Contains(args, "restrict=on") == network {
+			t.Fatalf("Network access should be %v, but QEMU command line is %q", network, args)
+		}
+	}
+}
+
+func TestQEMURelayScript(t *testing.T) {
+	taskDir, err := ioutil.TempDir("", "TestQEMURelayScript")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(taskDir)
+	// runs the remote command locally, so the task directory is both the
+	// worker's and the VM's
+	fakeSSH := filepath.Join(taskDir, "ssh")
+	err = ioutil.WriteFile(fakeSSH, []byte("#!/bin/sh\nfor last; do :; done\nexec /bin/sh -c \"$last\"\n"), 0755)
+	if err != nil {
+		t.Fatalf("Could not write fake ssh: %v", err)
+	}
+	vm := &qemuVM{
+		ssh: []string{fakeSSH, "-p", "40022", "root@127.0.0.1"},
+	}
+	env := vmEnv([]string{"HOME=/home/task_1", "GREETING=it's me"})
+	script := vm.relayScript(taskDir, taskDir, []string{"/bin/sh", "-c", `echo "$GREETING $HOME" > out.txt; exit 3`}, env)
+	err = exec.Command("/bin/sh", "-c", script).Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Fatalf("Was expecting relayed command to exit with exit code 3, but got %v", err)
+	}
+	out, err := ioutil.ReadFile(filepath.Join(taskDir, "out.txt"))
+	if err != nil {
+		t.Fatalf("Relayed command did not write to task directory: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "it's me ") || strings.Contains(string(out), "/home/task_1") {
+		t.Fatalf("Was expecting GREETING, but not HOME of task user, to be passed to relayed command, but got %q", out)
+	}
+}
@@ -0,0 +1,8 @@
+// +build darwin,multiuser darwin,simple linux,multiuser linux,simple
+
+package main
+
+import "github.com/taskcluster/taskcluster/v28/internal/scopes"
+
+// scope required by tasks in order to have network access inside the sandbox
+const networkScope scopes.Pattern = "generic-worker:network:<provisionerId>/<workerType>"
@@ -0,0 +1,400 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	vmConsoleArtifactName = "public/logs/vm-console.log"
+	// how long to wait for a task VM to accept SSH connections
+	vmBootTimeout = 10 * time.Minute
+)
+
+// directory, relative to task directory, for files of the task VM that stay
+// on the worker, which is excluded from the copies of the task directory to
+// and from the VM
+var vmControlDir = filepath.Join("generic-worker", "isolation")
+
+// environment variables of task commands that describe the worker, rather
+// than the task VM, and so are not passed to commands run in the VM
+var vmExcludedEnvVars = map[string]bool{
+	"DISPLAY":               true,
+	"HOME":                  true,
+	"LOGNAME":               true,
+	"TASK_USER_CREDENTIALS": true,
+	"USER":                  true,
+}
+
+type qemuTools struct {
+	qemu    string
+	qemuImg string
+	ssh     string
+	// whether hardware virtualisation is available
+	kvm bool
+}
+
+// qemuVM is the QEMU VM of a task. The VM boots from a copy-on-write overlay
+// of the disk image, so the image itself is never modified, and has
+// user-mode networking, with the SSH port of the VM forwarded to sshPort on
+// the worker's loopback interface.
+type qemuVM struct {
+	cmd *exec.Cmd
+	// receives the result of cmd.Wait()
+	exited chan error
+	// stderr of QEMU, only to be read once QEMU has exited
+	stderr  bytes.Buffer
+	overlay string
+	// file the serial console of the VM is written to
+	console string
+	sshPort int
+	// the ssh command line for connecting to the VM, up to (but not
+	// including) the remote command
+	ssh []string
+}
+
+func findQEMUTools() (*qemuTools, error) {
+	if config.TaskIsolationVMUsername == "" {
+		return nil, fmt.Errorf("Config setting taskIsolationVMUsername must be set when taskIsolation is %q", config.TaskIsolation)
+	}
+	if config.TaskIsolationVMSSHKey == "" {
+		return nil, fmt.Errorf("Config setting taskIsolationVMSSHKey must be set when taskIsolation is %q", config.TaskIsolation)
+	}
+	tools := &qemuTools{}
+	for name, path := range map[string]*string{
+		"qemu-system-x86_64": &tools.qemu,
+		"qemu-img":           &tools.qemuImg,
+		"ssh":                &tools.ssh,
+	} {
+		var err error
+		*path, err = exec.LookPath(name)
+		if err != nil {
+			return nil, fmt.Errorf("Config setting taskIsolation is %q but %v is not installed: %v", config.TaskIsolation, name, err)
+		}
+	}
+	kvm, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		log.Printf("WARNING: KVM is not available, so task VMs will be emulated, which is very slow: %v", err)
+	} else {
+		kvm.Close()
+		tools.kvm = true
+	}
+	return tools, nil
+}
+
+func (l *TaskIsolationTask) startQEMU() *CommandExecutionError {
+	// the VM has its own users
+	if len(l.task.Payload.OSGroups) > 0 {
+		return MalformedPayloadError(fmt.Errorf("Worker type %v/%v runs tasks in QEMU VMs, so task.payload.osGroups is not supported", config.ProvisionerID, config.WorkerType))
+	}
+	image, err := l.vmImage()
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	controlDir := filepath.Join(taskContext.TaskDir, vmControlDir)
+	err = os.MkdirAll(controlDir, 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[isolation] Could not create directory %v: %v", controlDir, err))
+	}
+	sshPort, err := freeLoopbackPort()
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not allocate SSH port for task VM: %v", err))
+	}
+	l.vm = &qemuVM{
+		// outside of the task directory, so that it isn't published or
+		// copied into the VM
+		overlay: taskContext.TaskDir + ".qcow2",
+		console: filepath.Join(controlDir, "console.log"),
+		sshPort: sshPort,
+		ssh:     vmSSHCommand(l.qemu.ssh, config.TaskIsolationVMSSHKey, config.TaskIsolationVMUsername, sshPort),
+	}
+	err = createOverlay(l.qemu.qemuImg, image, l.vm.overlay)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not create disk of task VM from %v: %v", image, err))
+	}
+	l.task.Infof("[isolation] Booting QEMU VM from %v", image)
+	started := time.Now()
+	err = l.vm.boot(l.qemu, config.TaskIsolationVMMemoryMB, config.TaskIsolationVMProcessorCount, l.task.Payload.Features.Network)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not boot task VM: %v", err))
+	}
+	l.task.Infof("[isolation] QEMU VM booted in %v", time.Since(started))
+	err = l.vm.copyTaskDirIn(taskContext.TaskDir, l.task.Payload.VMImage)
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not copy task directory into task VM: %v", err))
+	}
+	for _, c := range l.task.Commands {
+		script := l.vm.relayScript(taskContext.TaskDir, c.Cmd.Dir, c.Cmd.Args, vmEnv(c.Cmd.Env))
+		c.Cmd.Path = "/bin/sh"
+		c.Cmd.Args = []string{"/bin/sh", "-c", script}
+		c.Cmd.Env = os.Environ()
+		// commands are relayed by the worker, since only the worker can read
+		// the SSH key of the VM
+		if c.Cmd.SysProcAttr != nil {
+			c.Cmd.SysProcAttr.Credential = nil
+		}
+	}
+	if l.task.Payload.Features.Network {
+		l.task.Infof("[isolation] Running task commands in the QEMU VM with network access")
+	} else {
+		l.task.Infof("[isolation] Running task commands in the QEMU VM without network access")
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) stopQEMU(err *ExecutionErrors) {
+	if l.vm.cmd != nil {
+		// the disk overlay is thrown away, so there is no need for a clean
+		// shutdown
+		_ = l.vm.cmd.Process.Kill()
+		<-l.vm.exited
+		l.task.Infof("[isolation] Destroyed QEMU VM")
+	}
+	if e := os.Remove(l.vm.overlay); e != nil && !os.IsNotExist(e) {
+		log.Printf("WARNING: could not delete disk of task VM %v: %v", l.vm.overlay, e)
+	}
+	if _, e := os.Stat(l.vm.console); e != nil {
+		return
+	}
+	err.add(l.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    vmConsoleArtifactName,
+				Expires: l.task.Definition.Expires,
+			},
+			ContentType:     "text/plain; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            filepath.Join(vmControlDir, "console.log"),
+		},
+	))
+}
+
+// vmImage returns the disk image to boot the task VM from, which is either
+// the one given in the task payload, which must be inside the task
+// directory, or the one in the worker config
+func (l *TaskIsolationTask) vmImage() (string, error) {
+	if l.task.Payload.VMImage == "" {
+		if config.TaskIsolationVMImage == "" {
+			return "", fmt.Errorf("Worker type %v/%v has no default VM image, so task.payload.vmImage must be specified", config.ProvisionerID, config.WorkerType)
+		}
+		return config.TaskIsolationVMImage, nil
+	}
+	image, err := filepath.EvalSymlinks(filepath.Join(taskContext.TaskDir, l.task.Payload.VMImage))
+	if err != nil {
+		return "", fmt.Errorf("Could not find task.payload.vmImage %q in task directory: %v", l.task.Payload.VMImage, err)
+	}
+	taskDir, err := filepath.EvalSymlinks(taskContext.TaskDir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(taskDir, image)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("task.payload.vmImage %q is not inside the task directory", l.task.Payload.VMImage)
+	}
+	return image, nil
+}
+
+func createOverlay(qemuImg, image, overlay string) error {
+	out, err := exec.Command(qemuImg, "info", "--output=json", image).Output()
+	if err != nil {
+		return err
+	}
+	var info struct {
+		Format string `json:"format"`
+	}
+	err = json.Unmarshal(out, &info)
+	if err != nil {
+		return fmt.Errorf("Could not parse output of qemu-img info: %v", err)
+	}
+	combined, err := exec.Command(qemuImg, "create", "-f", "qcow2", "-F", info.Format, "-b", image, overlay).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, combined)
+	}
+	return nil
+}
+
+// boot starts QEMU, and waits for the VM to accept SSH connections
+func (vm *qemuVM) boot(tools *qemuTools, memoryMB, processorCount uint, network bool) error {
+	args := vm.qemuArgs(tools, memoryMB, processorCount, network)
+	vm.cmd = exec.Command(args[0], args[1:]...)
+	vm.cmd.Stderr = &vm.stderr
+	err := vm.cmd.Start()
+	if err != nil {
+		vm.cmd = nil
+		return err
+	}
+	vm.exited = make(chan error, 1)
+	go func() {
+		vm.exited <- vm.cmd.Wait()
+	}()
+	deadline := time.Now().Add(vmBootTimeout)
+	for {
+		select {
+		case err := <-vm.exited:
+			vm.exited <- err
+			return fmt.Errorf("QEMU exited: %v\n%v", err, vm.stderr.String())
+		default:
+		}
+		check := append(append([]string{}, vm.ssh...), "true")
+		if exec.Command(check[0], check[1:]...).Run() == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("VM did not accept SSH connections within %v", vmBootTimeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (vm *qemuVM) qemuArgs(tools *qemuTools, memoryMB, processorCount uint, network bool) []string {
+	// restrict=on isolates the VM from the network, other than the
+	// forwarded SSH port
+	netdev := fmt.Sprintf("user,id=net0,hostfwd=tcp:127.0.0.1:%v-:22", vm.sshPort)
+	if !network {
+		netdev += ",restrict=on"
+	}
+	args := []string{
+		tools.qemu,
+		"-m", strconv.Itoa(int(memoryMB)),
+		"-smp", strconv.Itoa(int(processorCount)),
+		"-drive", "file=" + vm.overlay + ",if=virtio,format=qcow2",
+		"-netdev", netdev,
+		"-device", "virtio-net-pci,netdev=net0",
+		"-display", "none",
+		"-monitor", "none",
+		"-serial", "file:" + vm.console,
+	}
+	if tools.kvm {
+		args = append(args, "-enable-kvm", "-cpu", "host")
+	}
+	return args
+}
+
+// copyTaskDirIn copies the task directory to the same path inside the VM, so
+// that absolute paths in task commands are valid inside the VM
+func (vm *qemuVM) copyTaskDirIn(taskDir, image string) error {
+	tarArgs := []string{"-C", taskDir, "--exclude", "./" + filepath.ToSlash(vmControlDir)}
+	if image != "" {
+		// the VM boots from the image, so has no use for a copy of it
+		tarArgs = append(tarArgs, "--exclude", "./"+filepath.ToSlash(filepath.Clean(image)))
+	}
+	tarArgs = append(tarArgs, "-cf", "-", ".")
+	extract := append(append([]string{}, vm.ssh...), "mkdir -p "+shellQuote(taskDir)+" && tar -C "+shellQuote(taskDir)+" -xf -")
+	return pipeCommands(exec.Command("tar", tarArgs...), exec.Command(extract[0], extract[1:]...))
+}
+
+// relayScript returns a shell script that runs a task command (with
+// arguments args, in directory dir, with environment env) inside the VM, and
+// then copies the task directory back out of the VM, so that artifacts are
+// collected from it as usual, before exiting with the exit code of the
+// command
+func (vm *qemuVM) relayScript(taskDir, dir string, args, env []string) string {
+	remote := "cd " + shellQuote(dir) + " && exec env"
+	for _, e := range env {
+		remote += " " + shellQuote(e)
+	}
+	for _, arg := range args {
+		remote += " " + shellQuote(arg)
+	}
+	ssh := make([]string, len(vm.ssh))
+	for i, arg := range vm.ssh {
+		ssh[i] = shellQuote(arg)
+	}
+	sshCommand := strings.Join(ssh, " ")
+	copyOut := "tar -C " + shellQuote(taskDir) + " --exclude " + shellQuote("./"+filepath.ToSlash(vmControlDir)) + " -cf - ."
+	return sshCommand + " " + shellQuote(remote) + " < /dev/null\n" +
+		"rc=$?\n" +
+		sshCommand + " " + shellQuote(copyOut) + " | tar -C " + shellQuote(taskDir) + " -xf - || echo '[isolation] Could not copy task directory out of task VM' >&2\n" +
+		"exit $rc\n"
+}
+
+// vmEnv returns the variables of env that should be passed to commands run in
+// the VM
+func vmEnv(env []string) []string {
+	result := []string{}
+	for _, e := range env {
+		if !vmExcludedEnvVars[strings.SplitN(e, "=", 2)[0]] {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func vmSSHCommand(ssh, key, username string, port int) []string {
+	return []string{
+		ssh,
+		"-i", key,
+		"-p", strconv.Itoa(port),
+		// the VM host key changes with every image, and is only reachable
+		// via the loopback interface
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "BatchMode=yes",
+		"-o", "LogLevel=ERROR",
+		"-o", "ConnectTimeout=10",
+		"-o", "ServerAliveInterval=15",
+		username + "@127.0.0.1",
+	}
+}
+
+// pipeCommands runs from and to, with the standard output of from connected
+// to the standard input of to
+func pipeCommands(from, to *exec.Cmd) error {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	var fromStderr, toOut bytes.Buffer
+	from.Stdout = w
+	from.Stderr = &fromStderr
+	to.Stdin = r
+	to.Stdout = &toOut
+	to.Stderr = &toOut
+	err = from.Start()
+	if err == nil {
+		err = to.Start()
+		if err != nil {
+			_ = from.Process.Kill()
+			_ = from.Wait()
+		}
+	}
+	// the child processes have their own copies
+	r.Close()
+	w.Close()
+	if err != nil {
+		return err
+	}
+	toErr := to.Wait()
+	if fromErr := from.Wait(); fromErr != nil {
+		return fmt.Errorf("%v: %v\n%v", from.Args[0], fromErr, fromStderr.String())
+	}
+	if toErr != nil {
+		return fmt.Errorf("%v: %v\n%v", to.Args[0], toErr, toOut.String())
+	}
+	return nil
+}
+
+func freeLoopbackPort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	windowsSandboxIsolation   = "windowsSandbox"
+	hyperVIsolation           = "hyperV"
+	windowsContainerIsolation = "windowsContainer"
+)
+
+// TaskIsolationFeature runs the commands of each task inside an ephemeral
+// Windows Sandbox, Hyper-V VM or Windows container, rather than directly on
+// the worker, for
+// worker pools that run untrusted code. The command wrapper scripts that are
+// generated for the task (see prepareCommand) are run inside the isolated
+// environment, by a relay script that runs on the worker, and which takes the
+// place of the task user command.
+type TaskIsolationFeature struct {
+}
+
+func (feature *TaskIsolationFeature) Name() string {
+	return "Task Isolation"
+}
+
+func (feature *TaskIsolationFeature) Initialise() error {
+	switch config.TaskIsolation {
+	case "":
+		return nil
+	case windowsSandboxIsolation:
+		if _, err := os.Stat(windowsSandboxExe()); err != nil {
+			return fmt.Errorf("Config setting taskIsolation is %q but Windows Sandbox is not installed: %v", config.TaskIsolation, err)
+		}
+	case hyperVIsolation:
+		if config.TaskIsolationVMImage == "" {
+			return fmt.Errorf("Config setting taskIsolationVMImage must be set when taskIsolation is %q", config.TaskIsolation)
+		}
+		if config.TaskIsolationVMUsername == "" {
+			return fmt.Errorf("Config setting taskIsolationVMUsername must be set when taskIsolation is %q", config.TaskIsolation)
+		}
+		if _, err := powershellOutput(`Get-Command -Name New-VM -ErrorAction Stop`); err != nil {
+			return fmt.Errorf("Config setting taskIsolation is %q but Hyper-V PowerShell module is not available: %v", config.TaskIsolation, err)
+		}
+	case windowsContainerIsolation:
+		return initialiseWindowsContainers()
+	default:
+		return fmt.Errorf("Config setting taskIsolation has unsupported value %q - must be %q, %q, %q or empty", config.TaskIsolation, windowsSandboxIsolation, hyperVIsolation, windowsContainerIsolation)
+	}
+	return nil
+}
+
+func (feature *TaskIsolationFeature) PersistState() error {
+	return nil
+}
+
+// IsEnabled also returns true for tasks that specify a Windows container on
+// workers that don't run them, so that they are rejected
+func (feature *TaskIsolationFeature) IsEnabled(task *TaskRun) bool {
+	return config.TaskIsolation != "" || task.Payload.Container.Image != ""
+}
+
+type TaskIsolationTask struct {
+	task *TaskRun
+	// directory inside the task directory for isolation scripts and
+	// communication with the isolated environment
+	controlDir string
+	// name of the Hyper-V VM
+	vmName string
+	// differencing disk of the Hyper-V VM
+	vmDisk string
+	// name of the Windows container
+	containerName string
+	// whether creation of the isolated environment was attempted, and so
+	// needs cleaning up
+	created bool
+}
+
+func (feature *TaskIsolationFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskIsolationTask{
+		task:          task,
+		controlDir:    filepath.Join(taskContext.TaskDir, "generic-worker", "isolation"),
+		vmName:        filepath.Base(taskContext.TaskDir),
+		vmDisk:        taskContext.TaskDir + ".vhdx",
+		containerName: filepath.Base(taskContext.TaskDir),
+	}
+}
+
+func (l *TaskIsolationTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (l *TaskIsolationTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (l *TaskIsolationTask) Start() *CommandExecutionError {
+	// these features configure the task user on the worker, which doesn't
+	// run the task commands
+	if len(l.task.Payload.OSGroups) > 0 || l.task.Payload.Features.RunAsAdministrator || l.task.Payload.RdpInfo != "" {
+		return MalformedPayloadError(fmt.Errorf("Worker type %v/%v runs tasks in a %v, so task.payload.osGroups, task.payload.rdpInfo and task.payload.features.runAsAdministrator are not supported", config.ProvisionerID, config.WorkerType, config.TaskIsolation))
+	}
+	if (config.TaskIsolation == windowsContainerIsolation) != (l.task.Payload.Container.Image != "") {
+		if config.TaskIsolation == windowsContainerIsolation {
+			return MalformedPayloadError(fmt.Errorf("Worker type %v/%v runs tasks in Windows containers, so task.payload.container is required", config.ProvisionerID, config.WorkerType))
+		}
+		return MalformedPayloadError(fmt.Errorf("Worker type %v/%v does not run tasks in Windows containers, so task.payload.container is not supported", config.ProvisionerID, config.WorkerType))
+	}
+	if config.TaskIsolation == windowsContainerIsolation {
+		if e := l.pullWindowsContainerImage(); e != nil {
+			return e
+		}
+	}
+	err := os.MkdirAll(l.controlDir, 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[isolation] Could not create directory %v: %v", l.controlDir, err))
+	}
+	for name, contents := range isolationScripts {
+		err = ioutil.WriteFile(filepath.Join(l.controlDir, name), []byte(contents), 0600)
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[isolation] Could not write script %v: %v", name, err))
+		}
+	}
+	l.created = true
+	l.task.Infof("[isolation] Creating %v for task", config.TaskIsolation)
+	switch config.TaskIsolation {
+	case windowsSandboxIsolation:
+		err = l.startWindowsSandbox()
+	case hyperVIsolation:
+		err = l.startHyperV()
+	case windowsContainerIsolation:
+		err = l.startWindowsContainer()
+	}
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[isolation] Could not create %v for task: %v", config.TaskIsolation, err))
+	}
+	// commands are relayed by the worker, so don't run as the task user
+	pd, err := process.NewPlatformData(true)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[isolation] Could not create platform data: %v", err))
+	}
+	for i := range l.task.Commands {
+		commandName := fmt.Sprintf("command_%06d", i)
+		wrapper := filepath.Join(taskContext.TaskDir, commandName+"_wrapper.bat")
+		script := filepath.Join(taskContext.TaskDir, commandName+".bat")
+		commandLine, env := l.relayCommand(i, wrapper, script)
+		command, err := process.NewCommand(commandLine, taskContext.TaskDir, env, pd)
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[isolation] Could not create command %v: %v", i, err))
+		}
+		l.task.logMux.RLock()
+		command.DirectOutput(l.task.logWriter)
+		l.task.logMux.RUnlock()
+		command.TagOutputStreams = l.task.Payload.TagOutputStreams
+		command.OutputEncoding = l.task.Payload.OutputEncoding
+		l.task.Commands[i] = command
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) Stop(err *ExecutionErrors) {
+	if !l.created {
+		return
+	}
+	l.task.Infof("[isolation] Destroying %v", config.TaskIsolation)
+	var e error
+	switch config.TaskIsolation {
+	case windowsSandboxIsolation:
+		e = l.stopWindowsSandbox()
+	case hyperVIsolation:
+		e = l.stopHyperV()
+	case windowsContainerIsolation:
+		e = l.stopWindowsContainer()
+	}
+	if e != nil {
+		l.task.Errorf("[isolation] Could not destroy %v: %v", config.TaskIsolation, e)
+		err.add(executionError(internalError, errored, e))
+	}
+}
+
+func (l *TaskIsolationTask) relayCommand(index int, wrapper, script string) (commandLine []string, env []string) {
+	switch config.TaskIsolation {
+	case windowsSandboxIsolation:
+		return powershellFileCommandLine(
+			filepath.Join(l.controlDir, "sandbox-relay.ps1"),
+			"-ControlDir", l.controlDir,
+			"-Index", strconv.Itoa(index),
+			"-Wrapper", wrapper,
+		), nil
+	case windowsContainerIsolation:
+		return l.windowsContainerRelayCommand(wrapper), nil
+	default:
+		return powershellFileCommandLine(
+			filepath.Join(l.controlDir, "hyperv-relay.ps1"),
+			"-VMName", l.vmName,
+			"-TaskDir", taskContext.TaskDir,
+			"-Wrapper", wrapper,
+			"-Script", script,
+		), l.vmCredentialsEnv()
+	}
+}
+
+func (l *TaskIsolationTask) startWindowsSandbox() error {
+	agent := filepath.Join(l.controlDir, "sandbox-agent.ps1")
+	// the task directory is mapped to the same path inside the sandbox, so
+	// that the absolute paths in the command wrapper scripts are valid
+	wsb := `<Configuration>
+  <MappedFolders>
+    <MappedFolder>
+      <HostFolder>` + xmlEscape(taskContext.TaskDir) + `</HostFolder>
+      <SandboxFolder>` + xmlEscape(taskContext.TaskDir) + `</SandboxFolder>
+      <ReadOnly>false</ReadOnly>
+    </MappedFolder>
+  </MappedFolders>
+  <LogonCommand>
+    <Command>powershell.exe -NoProfile -ExecutionPolicy Bypass -File "` + xmlEscape(agent) + `" -ControlDir "` + xmlEscape(l.controlDir) + `"</Command>
+  </LogonCommand>
+</Configuration>
+`
+	wsbFile := filepath.Join(l.controlDir, "task.wsb")
+	err := ioutil.WriteFile(wsbFile, []byte(wsb), 0600)
+	if err != nil {
+		return err
+	}
+	err = exec.Command(windowsSandboxExe(), wsbFile).Start()
+	if err != nil {
+		return err
+	}
+	// the agent creates this file once it is running inside the sandbox
+	ready := filepath.Join(l.controlDir, "ready")
+	deadline := time.Now().Add(5 * time.Minute)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Windows Sandbox did not start within 5 minutes")
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (l *TaskIsolationTask) stopWindowsSandbox() error {
+	// only one Windows Sandbox can run at a time, so there is no ambiguity
+	for _, image := range []string{"WindowsSandboxClient.exe", "WindowsSandbox.exe"} {
+		_, _ = host.CombinedOutput("taskkill.exe", "/im", image, "/f", "/t")
+	}
+	return nil
+}
+
+func (l *TaskIsolationTask) startHyperV() error {
+	return l.runPowershellFile(
+		"hyperv-start.ps1",
+		"-VMName", l.vmName,
+		"-Image", config.TaskIsolationVMImage,
+		"-Disk", l.vmDisk,
+		"-MemoryMB", strconv.Itoa(int(config.TaskIsolationVMMemoryMB)),
+		"-ProcessorCount", strconv.Itoa(int(config.TaskIsolationVMProcessorCount)),
+		"-SwitchName", config.TaskIsolationVMSwitch,
+		"-TaskDir", taskContext.TaskDir,
+	)
+}
+
+func (l *TaskIsolationTask) stopHyperV() error {
+	return l.runPowershellFile(
+		"hyperv-stop.ps1",
+		"-VMName", l.vmName,
+		"-Disk", l.vmDisk,
+	)
+}
+
+func (l *TaskIsolationTask) runPowershellFile(name string, args ...string) error {
+	commandLine := powershellFileCommandLine(filepath.Join(l.controlDir, name), args...)
+	cmd := exec.Command(commandLine[0], commandLine[1:]...)
+	cmd.Env = append(os.Environ(), l.vmCredentialsEnv()...)
+	out, err := host.RunCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, out)
+	}
+	return nil
+}
+
+// vmCredentialsEnv passes the VM credentials to the Hyper-V scripts via the
+// environment, so that they don't appear in process listings
+func (l *TaskIsolationTask) vmCredentialsEnv() []string {
+	return []string{
+		"GW_ISOLATION_VM_USERNAME=" + config.TaskIsolationVMUsername,
+		"GW_ISOLATION_VM_PASSWORD=" + config.TaskIsolationVMPassword,
+	}
+}
+
+func powershellFileCommandLine(file string, args ...string) []string {
+	return append([]string{"powershell.exe", "-NoProfile", "-NonInteractive", "-ExecutionPolicy", "Bypass", "-File", file}, args...)
+}
+
+func windowsSandboxExe() string {
+	return filepath.Join(os.Getenv("SystemRoot"), "System32", "WindowsSandbox.exe")
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(s)
+}
+
+var isolationScripts = map[string]string{
+	"sandbox-agent.ps1": sandboxAgentScript,
+	"sandbox-relay.ps1": sandboxRelayScript,
+	"hyperv-start.ps1":  hyperVStartScript,
+	"hyperv-relay.ps1":  hyperVRelayScript,
+	"hyperv-stop.ps1":   hyperVStopScript,
+}
+
+// sandboxAgentScript runs inside the Windows Sandbox, and runs the command
+// wrapper scripts requested by sandboxRelayScript
+const sandboxAgentScript = `param([string]$ControlDir)
+New-Item -ItemType File -Force -Path (Join-Path $ControlDir 'ready') | Out-Null
+while ($true) {
+  foreach ($request in @(Get-ChildItem -Path $ControlDir -Filter 'request-*.txt')) {
+    $index = $request.BaseName.Substring('request-'.Length)
+    Remove-Item -Path $request.FullName
+    & cmd.exe /c (Join-Path $ControlDir "launcher-$index.bat")
+    $exitCode = Join-Path $ControlDir "exitcode-$index"
+    Set-Content -Path "$exitCode.tmp" -Value $LASTEXITCODE
+    Move-Item -Path "$exitCode.tmp" -Destination "$exitCode.txt"
+  }
+  Start-Sleep -Milliseconds 200
+}
+`
+
+// sandboxRelayScript runs on the worker in place of a task command, asks
+// sandboxAgentScript to run the command inside the Windows Sandbox, streams
+// its output, and exits with its exit code
+const sandboxRelayScript = `param([string]$ControlDir, [string]$Index, [string]$Wrapper)
+$output = Join-Path $ControlDir "output-$Index.log"
+$exitCode = Join-Path $ControlDir "exitcode-$Index.txt"
+$request = Join-Path $ControlDir "request-$Index"
+Set-Content -Path (Join-Path $ControlDir "launcher-$Index.bat") -Value "@call ` + "`" + `"$Wrapper` + "`" + `" > ` + "`" + `"$output` + "`" + `" 2>&1", '@exit /b %errorlevel%'
+New-Item -ItemType File -Force -Path "$request.tmp" | Out-Null
+Move-Item -Path "$request.tmp" -Destination "$request.txt"
+$stdout = [Console]::OpenStandardOutput()
+$buffer = New-Object byte[] 65536
+$offset = 0
+while ($true) {
+  $done = Test-Path -Path $exitCode
+  if (Test-Path -Path $output) {
+    $stream = [System.IO.File]::Open($output, 'Open', 'Read', 'ReadWrite')
+    [void]$stream.Seek($offset, 'Begin')
+    while (($n = $stream.Read($buffer, 0, $buffer.Length)) -gt 0) {
+      $stdout.Write($buffer, 0, $n)
+      $offset += $n
+    }
+    $stream.Close()
+    $stdout.Flush()
+  }
+  if ($done) {
+    exit [int](Get-Content -Path $exitCode)
+  }
+  Start-Sleep -Milliseconds 200
+}
+`
+
+const hyperVCredential = `$credential = New-Object System.Management.Automation.PSCredential($env:GW_ISOLATION_VM_USERNAME, (ConvertTo-SecureString -String $env:GW_ISOLATION_VM_PASSWORD -AsPlainText -Force))
+`
+
+// hyperVStartScript creates and starts the task VM, waits for PowerShell
+// Direct to be available, and copies the task directory into it
+const hyperVStartScript = `param([string]$VMName, [string]$Image, [string]$Disk, [int]$MemoryMB, [int]$ProcessorCount, [string]$SwitchName, [string]$TaskDir)
+$ErrorActionPreference = 'Stop'
+` + hyperVCredential + `New-VHD -Path $Disk -ParentPath $Image -Differencing | Out-Null
+if ($SwitchName) {
+  New-VM -Name $VMName -Generation 2 -MemoryStartupBytes ($MemoryMB * 1MB) -VHDPath $Disk -SwitchName $SwitchName | Out-Null
+} else {
+  New-VM -Name $VMName -Generation 2 -MemoryStartupBytes ($MemoryMB * 1MB) -VHDPath $Disk | Out-Null
+}
+Set-VMProcessor -VMName $VMName -Count $ProcessorCount
+Start-VM -Name $VMName
+$deadline = (Get-Date).AddMinutes(10)
+while ($true) {
+  try {
+    $session = New-PSSession -VMName $VMName -Credential $credential -ErrorAction Stop
+    break
+  } catch {
+    if ((Get-Date) -gt $deadline) {
+      throw "VM $VMName did not accept PowerShell Direct connections within 10 minutes: $_"
+    }
+    Start-Sleep -Seconds 5
+  }
+}
+try {
+  Invoke-Command -Session $session -ScriptBlock { param($d) New-Item -ItemType Directory -Force -Path $d | Out-Null } -ArgumentList $TaskDir
+  Copy-Item -ToSession $session -Path (Join-Path $TaskDir '*') -Destination $TaskDir -Recurse -Force
+} finally {
+  Remove-PSSession -Session $session
+}
+`
+
+// hyperVRelayScript runs on the worker in place of a task command, copies the
+// command scripts into the task VM, runs the command there (streaming its
+// output), copies the resulting task directory back, and exits with the exit
+// code of the command
+const hyperVRelayScript = `param([string]$VMName, [string]$TaskDir, [string]$Wrapper, [string]$Script)
+$ErrorActionPreference = 'Stop'
+` + hyperVCredential + `$session = New-PSSession -VMName $VMName -Credential $credential
+try {
+  foreach ($file in @($Wrapper, $Script, (Join-Path $TaskDir 'env.txt'), (Join-Path $TaskDir 'dir.txt'))) {
+    if (Test-Path -Path $file) {
+      Copy-Item -ToSession $session -Path $file -Destination $file -Force
+    }
+  }
+  $ErrorActionPreference = 'Continue'
+  Invoke-Command -Session $session -ScriptBlock { param($w) & cmd.exe /c $w 2>&1 } -ArgumentList $Wrapper | ForEach-Object { [Console]::Out.WriteLine($_) }
+  $exitCode = Invoke-Command -Session $session -ScriptBlock { $LASTEXITCODE }
+  $ErrorActionPreference = 'Stop'
+  Copy-Item -FromSession $session -Path (Join-Path $TaskDir '*') -Destination $TaskDir -Recurse -Force
+} finally {
+  Remove-PSSession -Session $session
+}
+exit $exitCode
+`
+
+// hyperVStopScript destroys the task VM and its disk
+const hyperVStopScript = `param([string]$VMName, [string]$Disk)
+$ErrorActionPreference = 'Stop'
+if (Get-VM -Name $VMName -ErrorAction SilentlyContinue) {
+  Stop-VM -Name $VMName -TurnOff -Force
+  Remove-VM -Name $VMName -Force
+}
+if (Test-Path -Path $Disk) {
+  Remove-Item -Path $Disk -Force
+}
+`
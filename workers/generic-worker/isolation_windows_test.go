@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaskIsolationInvalidConfig(t *testing.T) {
+	defer setup(t)()
+	feature := &TaskIsolationFeature{}
+
+	config.TaskIsolation = "docker"
+	err := feature.Initialise()
+	if err == nil || !strings.Contains(err.Error(), "unsupported value") {
+		t.Fatalf("Was expecting unsupported taskIsolation to be rejected, but got: %v", err)
+	}
+
+	config.TaskIsolation = hyperVIsolation
+	config.TaskIsolationVMImage = ""
+	err = feature.Initialise()
+	if err == nil || !strings.Contains(err.Error(), "taskIsolationVMImage") {
+		t.Fatalf("Was expecting hyperV task isolation without a VM image to be rejected, but got: %v", err)
+	}
+}
+
+func TestCheckContainerCompatibility(t *testing.T) {
+	for _, test := range []struct {
+		imageOS        string
+		imageOSVersion string
+		isolation      string
+		compatible     bool
+	}{
+		{"windows", "10.0.17763.1577", processContainerIsolation, true},
+		{"windows", "10.0.17763.2300", processContainerIsolation, true},
+		{"windows", "10.0.14393.4046", processContainerIsolation, false},
+		{"windows", "10.0.14393.4046", hyperVContainerIsolation, true},
+		{"windows", "10.0.20348.169", hyperVContainerIsolation, false},
+		{"linux", "", hyperVContainerIsolation, false},
+		{"windows", "10.0", processContainerIsolation, false},
+	} {
+		err := checkContainerCompatibility(17763, test.imageOS, test.imageOSVersion, test.isolation)
+		if (err == nil) != test.compatible {
+			t.Errorf("Was expecting %v image %v with %v isolation on build 17763 to be compatible: %v, but got: %v", test.imageOS, test.imageOSVersion, test.isolation, test.compatible, err)
+		}
+	}
+}
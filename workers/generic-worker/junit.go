@@ -0,0 +1,97 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type (
+	// junitSuite is a <testsuites> or <testsuite> element of a JUnit XML
+	// report, which may contain further test suites
+	junitSuite struct {
+		Suites []junitSuite `xml:"testsuite"`
+		Cases  []junitCase  `xml:"testcase"`
+	}
+
+	junitCase struct {
+		Name      string `xml:"name,attr"`
+		ClassName string `xml:"classname,attr"`
+		// duration of the test case in seconds
+		Time     string         `xml:"time,attr"`
+		Failures []junitProblem `xml:"failure"`
+		Errors   []junitProblem `xml:"error"`
+		Skipped  []junitProblem `xml:"skipped"`
+	}
+
+	// junitProblem is a <failure>, <error> or <skipped> element of a test
+	// case
+	junitProblem struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+// readJUnitReport parses the JUnit XML report at the given path
+func readJUnitReport(path string) (*junitSuite, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	suite := &junitSuite{}
+	err = xml.NewDecoder(file).Decode(suite)
+	if err != nil {
+		return nil, err
+	}
+	return suite, nil
+}
+
+// eachCase calls f with each test case of the suite, including those of
+// nested suites
+func (suite *junitSuite) eachCase(f func(c *junitCase)) {
+	for i := range suite.Cases {
+		f(&suite.Cases[i])
+	}
+	for i := range suite.Suites {
+		suite.Suites[i].eachCase(f)
+	}
+}
+
+// test returns the name of the test case, qualified by its class name, if it
+// has one
+func (c *junitCase) test() string {
+	if c.ClassName == "" {
+		return c.Name
+	}
+	return c.ClassName + "." + c.Name
+}
+
+// duration returns the duration of the test case in seconds, or 0 if unknown
+func (c *junitCase) duration() float64 {
+	// some tools use thousands separators
+	seconds, err := strconv.ParseFloat(strings.Replace(c.Time, ",", "", -1), 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return seconds
+}
+
+// problems returns the failures and errors of the test case
+func (c *junitCase) problems() []junitProblem {
+	problems := make([]junitProblem, 0, len(c.Failures)+len(c.Errors))
+	problems = append(problems, c.Failures...)
+	return append(problems, c.Errors...)
+}
+
+// message returns the message of the problem, or its text if it has no
+// message
+func (p *junitProblem) message() string {
+	if p.Message != "" {
+		return p.Message
+	}
+	return strings.TrimSpace(p.Text)
+}
@@ -0,0 +1,215 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	gwruntime "github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+const (
+	// length of the random password of task keychains, which is only needed
+	// while the worker sets up the keychain
+	keychainPasswordLength = 32
+)
+
+var (
+	// relative to task directory
+	keychainPath = filepath.Join("generic-worker", "task.keychain-db")
+	// relative to task directory; deleted as soon as it has been imported
+	keychainCertificatePath = filepath.Join("generic-worker", "certificate.p12")
+)
+
+// KeychainFeature creates a temporary keychain for each task that requests
+// one, with code signing certificates from the secrets service, and deletes
+// it when the task completes, so that signing tasks don't need to manage
+// keychains themselves.
+type KeychainFeature struct {
+}
+
+func (feature *KeychainFeature) Name() string {
+	return "Keychain"
+}
+
+func (feature *KeychainFeature) PayloadName() string {
+	return "keychain"
+}
+
+func (feature *KeychainFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *KeychainFeature) Initialise() error {
+	if !payloadFeatureEnabled(feature.PayloadName()) {
+		return nil
+	}
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("Keychains are not supported on %v, so enabledFeatures may not include %q", runtime.GOOS, feature.PayloadName())
+	}
+	return nil
+}
+
+func (feature *KeychainFeature) PersistState() error {
+	return nil
+}
+
+func (feature *KeychainFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Keychain.Certificates) > 0
+}
+
+type KeychainTask struct {
+	task *TaskRun
+	// empty until the keychain has been created
+	keychain string
+}
+
+func (feature *KeychainFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &KeychainTask{
+		task: task,
+	}
+}
+
+// RequiredScopes returns the scopes to get the secret of each certificate
+func (l *KeychainTask) RequiredScopes() scopes.Expression {
+	requiredScopes := scopes.AllOf{}
+	for _, certificate := range l.task.Payload.Keychain.Certificates {
+		requiredScopes = append(requiredScopes, scopes.Scope("secrets:get:"+certificate.Secret))
+	}
+	return requiredScopes
+}
+
+func (l *KeychainTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (l *KeychainTask) Start() *CommandExecutionError {
+	keychain := filepath.Join(taskContext.TaskDir, keychainPath)
+	password := gwruntime.GeneratePassword(keychainPasswordLength)
+	err := os.MkdirAll(filepath.Dir(keychain), 0700)
+	if err == nil {
+		err = makeDirReadWritableForTaskUser(l.task, filepath.Dir(keychain))
+	}
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not create directory for keychain: %v", err))
+	}
+	_, err = security("create-keychain", "-p", password, keychain)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not create keychain: %v", err))
+	}
+	l.keychain = keychain
+	// without -t, the keychain doesn't lock itself while the task runs
+	_, err = security("set-keychain-settings", keychain)
+	if err == nil {
+		_, err = security("unlock-keychain", "-p", password, keychain)
+	}
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not unlock keychain: %v", err))
+	}
+	secretsClient := l.task.Secrets()
+	for _, certificate := range l.task.Payload.Keychain.Certificates {
+		if e := l.importCertificate(secretsClient, certificate); e != nil {
+			return e
+		}
+		l.task.Infof("[keychain] Imported certificate %v from secret %v", certificate.Key, certificate.Secret)
+	}
+	// allow codesign and other Apple tools to use the private keys without
+	// showing a dialog
+	_, err = security("set-key-partition-list", "-S", "apple-tool:,apple:,codesign:", "-s", "-k", password, keychain)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not allow code signing with keychain: %v", err))
+	}
+	searchList, err := security("list-keychains", "-d", "user")
+	if err == nil {
+		args := []string{"list-keychains", "-d", "user", "-s", keychain}
+		for _, line := range strings.Split(searchList, "\n") {
+			if line = strings.Trim(strings.TrimSpace(line), `"`); line != "" {
+				args = append(args, line)
+			}
+		}
+		_, err = security(args...)
+	}
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not add keychain to keychain search list: %v", err))
+	}
+	err = l.task.setVariable("KEYCHAIN_PATH", keychain)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not set KEYCHAIN_PATH: %v", err))
+	}
+	l.task.Infof("[keychain] Created keychain %v", keychain)
+	return nil
+}
+
+// importCertificate imports the PKCS #12 file of the given certificate into
+// the keychain of the task
+func (l *KeychainTask) importCertificate(secretsClient *tcsecrets.Secrets, certificate Certificate) *CommandExecutionError {
+	value, e := fetchSecret(secretsClient, certificate.Secret, certificate.Key)
+	if e != nil {
+		return e
+	}
+	p12, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return MalformedPayloadError(fmt.Errorf("[keychain] Key %v of secret %v is not a base64 encoded PKCS #12 file: %v", certificate.Key, certificate.Secret, err))
+	}
+	p12Password := ""
+	if certificate.PasswordKey != "" {
+		p12Password, e = fetchSecret(secretsClient, certificate.Secret, certificate.PasswordKey)
+		if e != nil {
+			return e
+		}
+	}
+	file := filepath.Join(taskContext.TaskDir, keychainCertificatePath)
+	defer os.Remove(file)
+	err = ioutil.WriteFile(file, p12, 0600)
+	if err == nil {
+		err = makeFileReadWritableForTaskUser(l.task, file)
+	}
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[keychain] Could not write certificate %v of secret %v: %v", certificate.Key, certificate.Secret, err))
+	}
+	_, err = security("import", file, "-k", l.keychain, "-f", "pkcs12", "-P", p12Password, "-T", "/usr/bin/codesign", "-T", "/usr/bin/productsign", "-T", "/usr/bin/security")
+	if err != nil {
+		// a wrong password or corrupt file
+		return MalformedPayloadError(fmt.Errorf("[keychain] Could not import certificate %v of secret %v: %v", certificate.Key, certificate.Secret, err))
+	}
+	return nil
+}
+
+// Stop deletes the keychain, which also removes it from the keychain search
+// list of the task user
+func (l *KeychainTask) Stop(err *ExecutionErrors) {
+	if l.keychain == "" {
+		return
+	}
+	_, e := security("delete-keychain", l.keychain)
+	if e != nil {
+		l.task.Warnf("[keychain] Could not delete keychain %v: %v", l.keychain, e)
+		return
+	}
+	l.task.Infof("[keychain] Deleted keychain %v", l.keychain)
+}
+
+// security runs /usr/bin/security with the given arguments, as the task
+// user, whose keychain search list it changes, and returns its (trimmed)
+// standard output
+func security(args ...string) (string, error) {
+	cmd := append([]string{"/usr/bin/security"}, args...)
+	// taskContext.User is nil if running tasks as current user
+	if taskContext.User != nil {
+		cmd = append([]string{"/usr/bin/sudo", "-H", "-u", taskContext.User.Name}, cmd...)
+	}
+	out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return "", fmt.Errorf("security %v: %v\n%s", args[0], err, exitErr.Stderr)
+	}
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,135 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	gwruntime "github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+// keychainTestSetup serves secret project/signing, with a PKCS #12 file of a
+// freshly generated self signed certificate "generic-worker-test" in key
+// "p12", its password in key "password", and a file that isn't PKCS #12 in
+// key "junk", and returns a task directory for the keychain of the task
+func keychainTestSetup(t *testing.T) (teardown func()) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	key, cert, p12 := filepath.Join(dir, "key.pem"), filepath.Join(dir, "cert.pem"), filepath.Join(dir, "cert.p12")
+	for _, args := range [][]string{
+		{"req", "-x509", "-newkey", "rsa:2048", "-nodes", "-keyout", key, "-out", cert, "-subj", "/CN=generic-worker-test", "-days", "1"},
+		{"pkcs12", "-export", "-inkey", key, "-in", cert, "-out", p12, "-passout", "pass:p12-password"},
+	} {
+		if out, err := exec.Command("/usr/bin/openssl", args...).CombinedOutput(); err != nil {
+			t.Fatalf("Could not run openssl %v: %v\n%s", args[0], err, out)
+		}
+	}
+	content, err := ioutil.ReadFile(p12)
+	if err != nil {
+		t.Fatalf("Could not read %v: %v", p12, err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/secrets/v1/secret/project/signing" {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprintf(w, `{"expires": "2100-01-01T00:00:00.000Z", "secret": {"p12": %q, "password": "p12-password", "junk": %q}}`, base64.StdEncoding.EncodeToString(content), base64.StdEncoding.EncodeToString([]byte("not a p12 file")))
+	}))
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			RootURL: server.URL,
+		},
+	}
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: dir,
+	}
+	// the multiuser engine grants the task user access to the keychain
+	if engine == "multiuser" {
+		u, err := user.Current()
+		if err != nil {
+			t.Fatalf("Could not determine current user: %v", err)
+		}
+		taskContext.User = &gwruntime.OSUser{
+			Name: u.Username,
+		}
+	}
+	return func() {
+		taskContext = oldTaskContext
+		config = nil
+		server.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func keychainTask(t *testing.T, key string) *KeychainTask {
+	task := taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "keychain": {
+    "certificates": [
+      {
+        "secret": "project/signing",
+        "key": "` + key + `",
+        "passwordKey": "password"
+      }
+    ]
+  }
+}`)
+	ensureValidPayload(t, task)
+	task.Queue = tcqueue.New(nil, config.RootURL)
+	return (&KeychainFeature{}).NewTaskFeature(task).(*KeychainTask)
+}
+
+func TestKeychainCreatedAndDeleted(t *testing.T) {
+	defer keychainTestSetup(t)()
+	l := keychainTask(t, "p12")
+	if e := l.Start(); e != nil {
+		t.Fatalf("Could not create keychain: %v", e)
+	}
+	keychain := filepath.Join(taskContext.TaskDir, keychainPath)
+	if l.task.featureEnv["KEYCHAIN_PATH"] != keychain {
+		t.Errorf("Was expecting KEYCHAIN_PATH to be %v, but got %q", keychain, l.task.featureEnv["KEYCHAIN_PATH"])
+	}
+	if _, err := security("find-certificate", "-c", "generic-worker-test", keychain); err != nil {
+		t.Errorf("Was expecting certificate to have been imported into keychain %v: %v", keychain, err)
+	}
+	if searchList, err := security("list-keychains", "-d", "user"); err != nil || !strings.Contains(searchList, keychain) {
+		t.Errorf("Was expecting keychain %v to be in the keychain search list, but got %q (%v)", keychain, searchList, err)
+	}
+	if _, err := os.Stat(filepath.Join(taskContext.TaskDir, keychainCertificatePath)); !os.IsNotExist(err) {
+		t.Errorf("Was expecting PKCS #12 file to be deleted once imported, but got: %v", err)
+	}
+
+	l.Stop(&ExecutionErrors{})
+	if _, err := os.Stat(keychain); !os.IsNotExist(err) {
+		t.Errorf("Was expecting keychain %v to be deleted, but got: %v", keychain, err)
+	}
+	if searchList, err := security("list-keychains", "-d", "user"); err != nil || strings.Contains(searchList, keychain) {
+		t.Errorf("Was expecting keychain %v to be removed from the keychain search list, but got %q (%v)", keychain, searchList, err)
+	}
+}
+
+func TestKeychainInvalidCertificate(t *testing.T) {
+	defer keychainTestSetup(t)()
+	l := keychainTask(t, "junk")
+	e := l.Start()
+	defer l.Stop(&ExecutionErrors{})
+	if e == nil || e.Reason != malformedPayload || !strings.Contains(e.Error(), "Could not import certificate junk") {
+		t.Fatalf("Was expecting a file that isn't PKCS #12 to be a malformed payload, but got: %v", e)
+	}
+}
@@ -0,0 +1,79 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestKeychainConfig(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	feature := &KeychainFeature{}
+	if err := feature.Initialise(); err != nil {
+		t.Fatalf("Was not expecting a disabled feature to require anything, but got: %v", err)
+	}
+	config.EnabledFeatures = []string{"keychain"}
+	err := feature.Initialise()
+	if runtime.GOOS == "darwin" {
+		if err != nil {
+			t.Fatalf("Could not initialise keychain feature: %v", err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), "not supported on "+runtime.GOOS) {
+		t.Fatalf("Was expecting keychains to be unsupported on %v, but got: %v", runtime.GOOS, err)
+	}
+}
+
+func TestKeychainPayload(t *testing.T) {
+	task := taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "keychain": {
+    "certificates": [
+      {
+        "secret": "project/signing",
+        "key": "p12",
+        "passwordKey": "password"
+      },
+      {
+        "secret": "project/installer-signing",
+        "key": "p12"
+      }
+    ]
+  }
+}`)
+	ensureValidPayload(t, task)
+	feature := &KeychainFeature{}
+	if !feature.IsEnabled(task) {
+		t.Fatal("Was expecting keychain feature to be enabled for task with certificates")
+	}
+	requiredScopes := feature.NewTaskFeature(task).RequiredScopes()
+	expected := scopes.AllOf{scopes.Scope("secrets:get:project/signing"), scopes.Scope("secrets:get:project/installer-signing")}
+	if requiredScopes.String() != expected.String() {
+		t.Errorf("Was expecting required scopes %v but got %v", expected, requiredScopes)
+	}
+
+	for _, keychain := range []string{
+		// no certificates
+		`{"certificates": []}`,
+		// no key
+		`{"certificates": [{"secret": "project/signing"}]}`,
+		// empty secret name
+		`{"certificates": [{"secret": "", "key": "p12"}]}`,
+		// unknown property
+		`{"certificates": [{"secret": "project/signing", "key": "p12", "password": "abc"}]}`,
+	} {
+		ensureMalformedPayload(t, taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [`+rawHelloGoodbye()+`],
+  "keychain": `+keychain+`
+}`))
+	}
+}
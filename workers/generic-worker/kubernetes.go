@@ -0,0 +1,150 @@
+// +build kubernetes
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	engine = "kubernetes"
+)
+
+// cluster is the Kubernetes cluster that task Jobs are created in
+var cluster *process.Cluster
+
+func secure(configFile string) {
+}
+
+func MkdirAllTaskUser(dir string, perms os.FileMode) (err error) {
+	return nil
+}
+
+func platformFeatures() []Feature {
+	return []Feature{
+		&KubernetesFeature{},
+	}
+}
+
+// KubernetesFeature connects to the Kubernetes cluster that task Jobs are
+// created in (see config settings kubernetesAPIServer and
+// kubernetesNamespace). It doesn't do anything for individual tasks.
+type KubernetesFeature struct {
+}
+
+func (feature *KubernetesFeature) Name() string {
+	return "Kubernetes"
+}
+
+func (feature *KubernetesFeature) Initialise() (err error) {
+	if config.KubernetesSidecarImage == "" {
+		config.KubernetesSidecarImage = "busybox"
+	}
+	cluster, err = process.NewCluster(config.KubernetesAPIServer, config.KubernetesNamespace)
+	if err != nil {
+		return fmt.Errorf("could not connect to Kubernetes cluster: %v", err)
+	}
+	log.Printf("Running tasks as Kubernetes Jobs in namespace %v of %v", cluster.Namespace, cluster.APIServer)
+	return nil
+}
+
+func (feature *KubernetesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *KubernetesFeature) IsEnabled(task *TaskRun) bool {
+	return false
+}
+
+func (feature *KubernetesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &KubernetesTask{}
+}
+
+type KubernetesTask struct {
+}
+
+func (kt *KubernetesTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (kt *KubernetesTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (kt *KubernetesTask) Start() *CommandExecutionError {
+	return nil
+}
+
+func (kt *KubernetesTask) Stop(err *ExecutionErrors) {
+}
+
+func (task *TaskRun) generateCommand(index int) error {
+	var err error
+	task.Commands[index], err = process.NewCommand(cluster, task.kubernetesJob(), task.Payload.Command[index], taskContext.TaskDir, task.kubernetesEnv())
+	if err != nil {
+		return err
+	}
+	task.logMux.RLock()
+	defer task.logMux.RUnlock()
+	task.Commands[index].DirectOutput(task.logWriter)
+	return nil
+}
+
+// kubernetesJob returns the Kubernetes Job that runs the task
+func (task *TaskRun) kubernetesJob() *process.Job {
+	artifacts := []string{}
+	for _, artifact := range task.Payload.Artifacts {
+		artifacts = append(artifacts, artifact.Path)
+	}
+	return &process.Job{
+		Name: kubernetesJobName(task.TaskID, task.RunID),
+		Annotations: map[string]string{
+			"taskcluster.net/task-id": task.TaskID,
+			"taskcluster.net/run-id":  strconv.Itoa(int(task.RunID)),
+		},
+		Image:     task.Payload.Image,
+		Requests:  task.Payload.Resources.Requests,
+		Limits:    task.Payload.Resources.Limits,
+		Artifacts: artifacts,
+		// the worker's own files, such as the task log
+		Exclude:      []string{"generic-worker"},
+		SidecarImage: config.KubernetesSidecarImage,
+		// the worker kills the Job when task.payload.maxRunTime is exceeded;
+		// this is a backstop in case the worker goes away, which allows time
+		// for copying the task directory to and from the pod
+		ActiveDeadlineSeconds: task.Payload.MaxRunTime + 600,
+	}
+}
+
+// kubernetesJobName returns the name of the Job of the given task run. Task
+// IDs are case sensitive, but Kubernetes object names must be lower case, so
+// the name is derived from a hash.
+func kubernetesJobName(taskID string, runID uint) string {
+	return fmt.Sprintf("gw-task-%x", sha256.Sum256([]byte(fmt.Sprintf("%v/%v", taskID, runID))))[:40]
+}
+
+// kubernetesEnv returns the env vars of the task container. Unlike the other
+// engines, the environment of the worker is not inherited, since the task
+// runs in a different container.
+func (task *TaskRun) kubernetesEnv() []string {
+	env := []string{}
+	for _, name := range sortedKeys(task.Payload.Env) {
+		env = append(env, name+"="+task.Payload.Env[name])
+	}
+	env = append(env,
+		"TASK_ID="+task.TaskID,
+		"RUN_ID="+strconv.Itoa(int(task.RunID)),
+		"TASKCLUSTER_ROOT_URL="+config.RootURL,
+	)
+	if config.WorkerLocation != "" {
+		env = append(env, "TASKCLUSTER_WORKER_LOCATION="+config.WorkerLocation)
+	}
+	return env
+}
@@ -0,0 +1,104 @@
+// +build kubernetes
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestKubernetesJobManifest(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			RootURL: "https://tc.example.com",
+			PublicEngineConfig: gwconfig.PublicEngineConfig{
+				KubernetesSidecarImage: "busybox",
+			},
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	task := &TaskRun{
+		TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		RunID:  1,
+	}
+	err := json.Unmarshal([]byte(`{
+		"command": [["make", "all"]],
+		"image": "ubuntu:20.04",
+		"maxRunTime": 60,
+		"env": {"FOO": "bar"},
+		"resources": {"limits": {"memory": "1Gi"}},
+		"artifacts": [{"type": "file", "path": "out/build.log"}]
+	}`), &task.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := task.kubernetesJob()
+	if job.Name != kubernetesJobName(task.TaskID, task.RunID) || len(job.Name) > 63 || strings.ToLower(job.Name) != job.Name {
+		t.Errorf("invalid job name %q", job.Name)
+	}
+	if job.Name == kubernetesJobName(task.TaskID, 0) {
+		t.Errorf("job name %q is not unique per run", job.Name)
+	}
+	data, err := json.Marshal(job.Manifest(task.Payload.Command[0], task.kubernetesEnv()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest struct {
+		Spec struct {
+			ActiveDeadlineSeconds int64 `json:"activeDeadlineSeconds"`
+			Template              struct {
+				Spec struct {
+					InitContainers []struct {
+						Name string `json:"name"`
+					} `json:"initContainers"`
+					Containers []struct {
+						Name      string            `json:"name"`
+						Image     string            `json:"image"`
+						Command   []string          `json:"command"`
+						Env       []json.RawMessage `json:"env"`
+						Resources struct {
+							Limits map[string]string `json:"limits"`
+						} `json:"resources"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	err = json.Unmarshal(data, &manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := manifest.Spec.Template.Spec
+	if manifest.Spec.ActiveDeadlineSeconds <= 60 {
+		t.Errorf("expected active deadline beyond max run time, but got %v", manifest.Spec.ActiveDeadlineSeconds)
+	}
+	if len(spec.InitContainers) != 1 || len(spec.Containers) != 2 || spec.Containers[1].Name != "artifacts" {
+		t.Fatalf("expected mounts init container, and task and artifacts containers, but got %s", data)
+	}
+	taskContainer := spec.Containers[0]
+	if taskContainer.Image != "ubuntu:20.04" || taskContainer.Resources.Limits["memory"] != "1Gi" {
+		t.Errorf("unexpected task container %s", data)
+	}
+	if command := taskContainer.Command; !reflect.DeepEqual(command[len(command)-2:], []string{"make", "all"}) {
+		t.Errorf("expected task command to run make all, but got %q", command)
+	}
+	env := []string{}
+	for _, e := range taskContainer.Env {
+		env = append(env, string(e))
+	}
+	expectedEnv := []string{
+		`{"name":"FOO","value":"bar"}`,
+		`{"name":"RUN_ID","value":"1"}`,
+		`{"name":"TASKCLUSTER_ROOT_URL","value":"https://tc.example.com"}`,
+		`{"name":"TASK_ID","value":"KTBKfEgxR5GdfIIREQIvFQ"}`,
+	}
+	if !reflect.DeepEqual(env, expectedEnv) {
+		t.Errorf("expected env %v but got %v", expectedEnv, env)
+	}
+}
@@ -60,9 +60,9 @@ func (feature *LiveLogFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 	}
 }
 
-func (l *LiveLogTask) RequiredScopes() scopes.Required {
+func (l *LiveLogTask) RequiredScopes() scopes.Expression {
 	// let's not require any scopes, as I see no reason to control access to this feature
-	return scopes.Required{}
+	return scopes.AllOf{}
 }
 
 func (l *LiveLogTask) Start() *CommandExecutionError {
@@ -130,7 +130,7 @@ func (l *LiveLogTask) Stop(err *ExecutionErrors) {
 		log.Printf("WARNING: could not terminate livelog writer: %s", errTerminate)
 	}
 	log.Printf("Redirecting %v to %v", livelogName, logName)
-	logURL := tcurls.API(queue.RootURL, "queue", "v1", fmt.Sprintf("task/%v/runs/%v/artifacts/%v", l.task.TaskID, l.task.RunID, logName))
+	logURL := tcurls.API(queue.RootURL, "queue", "v1", fmt.Sprintf("task/%v/runs/%v/artifacts/%v", l.task.TaskID, l.task.RunID, publishedArtifactName(logName)))
 	err.add(l.task.uploadArtifact(
 		&RedirectArtifact{
 			BaseArtifact: &BaseArtifact{
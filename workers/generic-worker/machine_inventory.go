@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const machineInventoryArtifactName = "public/machine-inventory.json"
+
+var (
+	// path, relative to task directory, of the machine inventory
+	machineInventoryPath = filepath.Join("generic-worker", "machine-inventory.json")
+	// how long to wait for a toolchain to report its version
+	toolchainVersionTimeout = 30 * time.Second
+)
+
+type (
+	// MachineInventory is the content of artifact
+	// public/machine-inventory.json
+	MachineInventory struct {
+		WorkerVersion string `json:"workerVersion"`
+		Engine        string `json:"engine"`
+		Hostname      string `json:"hostname"`
+		OS            string `json:"os"`
+		Arch          string `json:"arch"`
+		// name and build of the operating system, e.g. "Ubuntu 20.04.1 LTS
+		// (kernel 5.4.0-1029-aws)"
+		OSBuild  string `json:"osBuild"`
+		CPUModel string `json:"cpuModel"`
+		CPUCount int    `json:"cpuCount"`
+		// total physical memory
+		MemoryBytes uint64 `json:"memoryBytes"`
+		// free disk space in the tasks directory when the task started
+		FreeDiskBytes uint64 `json:"freeDiskBytes"`
+		// driver (or kernel module) name -> version
+		Drivers map[string]string `json:"drivers"`
+		// toolchain name (from machineInventoryManifest) -> version output
+		Toolchains map[string]string `json:"toolchains"`
+		// problems encountered collecting the inventory, which is otherwise
+		// incomplete
+		Errors []string `json:"errors,omitempty"`
+	}
+
+	MachineInventoryFeature struct {
+	}
+
+	MachineInventoryTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *MachineInventoryFeature) Name() string {
+	return "Machine Inventory"
+}
+
+func (feature *MachineInventoryFeature) Initialise() error {
+	return nil
+}
+
+func (feature *MachineInventoryFeature) PersistState() error {
+	return nil
+}
+
+// Machine inventory is enabled for all tasks by the worker config
+func (feature *MachineInventoryFeature) IsEnabled(task *TaskRun) bool {
+	return config.EnableMachineInventory
+}
+
+func (feature *MachineInventoryFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &MachineInventoryTask{
+		task: task,
+	}
+}
+
+func (mi *MachineInventoryTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (mi *MachineInventoryTask) ReservedArtifacts() []string {
+	return []string{
+		machineInventoryArtifactName,
+	}
+}
+
+// Start collects the inventory and publishes it straight away, so that it is
+// available even if the worker does not survive the task. The inventory is
+// purely informational, so problems collecting it are logged rather than
+// failing the task.
+func (mi *MachineInventoryTask) Start() *CommandExecutionError {
+	inventory := collectMachineInventory(config.MachineInventoryManifest)
+	mi.logBanner(inventory)
+	data, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	file := filepath.Join(taskContext.TaskDir, machineInventoryPath)
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(file, data, 0644)
+	if err != nil {
+		panic(err)
+	}
+	mi.task.machineInventorySHA256, err = fileutil.CalculateSHA256(file)
+	if err != nil {
+		panic(err)
+	}
+	return mi.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    machineInventoryArtifactName,
+				Expires: mi.task.Definition.Expires,
+			},
+			ContentType:     "application/json; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            machineInventoryPath,
+		},
+	)
+}
+
+func (mi *MachineInventoryTask) Stop(err *ExecutionErrors) {
+}
+
+func (mi *MachineInventoryTask) logBanner(inventory *MachineInventory) {
+	mi.task.Infof("[inventory] Host: %v (%v/%v)", inventory.Hostname, inventory.OS, inventory.Arch)
+	mi.task.Infof("[inventory] OS: %v", inventory.OSBuild)
+	mi.task.Infof("[inventory] CPU: %v (%v cores)", inventory.CPUModel, inventory.CPUCount)
+	mi.task.Infof("[inventory] Memory: %.1f GiB, free disk space: %.1f GiB", float64(inventory.MemoryBytes)/(1<<30), float64(inventory.FreeDiskBytes)/(1<<30))
+	for _, name := range sortedKeys(inventory.Toolchains) {
+		mi.task.Infof("[inventory] Toolchain %v: %v", name, inventory.Toolchains[name])
+	}
+	for _, e := range inventory.Errors {
+		mi.task.Warnf("[inventory] %v", e)
+	}
+	mi.task.Infof("[inventory] Full inventory, including %v driver versions, published as %v", len(inventory.Drivers), machineInventoryArtifactName)
+}
+
+// collectMachineInventory collects the inventory of the worker, including
+// the versions of the toolchains listed in the given manifest file, if not ""
+func collectMachineInventory(manifest string) *MachineInventory {
+	inventory := &MachineInventory{
+		WorkerVersion: version,
+		Engine:        engine,
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		CPUCount:      runtime.NumCPU(),
+		Drivers:       map[string]string{},
+		Toolchains:    map[string]string{},
+	}
+	problem := func(what string, err error) {
+		inventory.Errors = append(inventory.Errors, fmt.Sprintf("Could not determine %v: %v", what, err))
+	}
+	var err error
+	if inventory.Hostname, err = os.Hostname(); err != nil {
+		problem("hostname", err)
+	}
+	// platform specific
+	if inventory.OSBuild, err = osBuild(); err != nil {
+		problem("OS build", err)
+	}
+	if inventory.CPUModel, err = cpuModel(); err != nil {
+		problem("CPU model", err)
+	}
+	if inventory.MemoryBytes, err = memoryBytes(); err != nil {
+		problem("memory", err)
+	}
+	if drivers, err := driverVersions(); err != nil {
+		problem("driver versions", err)
+	} else {
+		inventory.Drivers = drivers
+	}
+	if inventory.FreeDiskBytes, err = freeDiskSpaceBytes(config.TasksDir); err != nil {
+		problem("free disk space", err)
+	}
+	if manifest != "" {
+		toolchains := map[string][]string{}
+		err = loadJSONFile(manifest, &toolchains)
+		if err != nil {
+			problem("toolchain versions", err)
+		}
+		for name, command := range toolchains {
+			inventory.Toolchains[name], err = toolchainVersion(command)
+			if err != nil {
+				problem("version of toolchain "+name, err)
+			}
+		}
+	}
+	return inventory
+}
+
+// toolchainVersion returns the trimmed output of the given command
+func toolchainVersion(command []string) (string, error) {
+	if len(command) == 0 {
+		return "", fmt.Errorf("no command specified in %v", config.MachineInventoryManifest)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), toolchainVersionTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%q failed: %v\n%s", command, err, out)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func loadJSONFile(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
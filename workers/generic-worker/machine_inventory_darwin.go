@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+func osBuild() (string, error) {
+	productVersion, err := host.CombinedOutput("sw_vers", "-productVersion")
+	if err != nil {
+		return "", err
+	}
+	buildVersion, err := host.CombinedOutput("sw_vers", "-buildVersion")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("macOS %v (build %v)", strings.TrimSpace(productVersion), strings.TrimSpace(buildVersion)), nil
+}
+
+func cpuModel() (string, error) {
+	model, err := host.CombinedOutput("sysctl", "-n", "machdep.cpu.brand_string")
+	return strings.TrimSpace(model), err
+}
+
+func memoryBytes() (uint64, error) {
+	memsize, err := host.CombinedOutput("sysctl", "-n", "hw.memsize")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(memsize), 10, 64)
+}
+
+// driverVersions returns the versions of loaded third party kernel
+// extensions, since Apple's are determined by the OS build
+func driverVersions() (map[string]string, error) {
+	out, err := host.CombinedOutput("kextstat", "-l")
+	if err != nil {
+		return nil, err
+	}
+	drivers := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		// Index Refs Address Size Wired Name (Version) UUID <Linked Against>
+		fields := strings.Fields(line)
+		if len(fields) < 7 || strings.HasPrefix(fields[5], "com.apple.") {
+			continue
+		}
+		drivers[fields[5]] = strings.Trim(fields[6], "()")
+	}
+	return drivers, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+func osBuild() (string, error) {
+	release, err := host.CombinedOutput("freebsd-version", "-ku")
+	if err != nil {
+		return "", err
+	}
+	// kernel and userland versions
+	return "FreeBSD " + strings.Join(strings.Fields(release), " / "), nil
+}
+
+func cpuModel() (string, error) {
+	model, err := host.CombinedOutput("sysctl", "-n", "hw.model")
+	return strings.TrimSpace(model), err
+}
+
+func memoryBytes() (uint64, error) {
+	physmem, err := host.CombinedOutput("sysctl", "-n", "hw.physmem")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(physmem), 10, 64)
+}
+
+// driverVersions returns the loaded kernel modules; FreeBSD modules are
+// built with the kernel, so have the version of the kernel
+func driverVersions() (map[string]string, error) {
+	kernel, err := host.CombinedOutput("uname", "-r")
+	if err != nil {
+		return nil, err
+	}
+	out, err := host.CombinedOutput("kldstat")
+	if err != nil {
+		return nil, err
+	}
+	drivers := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		// Id Refs Address Size Name
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] == "Id" {
+			continue
+		}
+		drivers[fields[4]] = strings.TrimSpace(kernel)
+	}
+	return drivers, nil
+}
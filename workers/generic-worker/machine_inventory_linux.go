@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+func osBuild() (string, error) {
+	kernel, err := host.CombinedOutput("uname", "-r")
+	if err != nil {
+		return "", err
+	}
+	name := "Linux"
+	release, err := readKeyValueFile("/etc/os-release", "=")
+	if err == nil && release["PRETTY_NAME"] != "" {
+		name = strings.Trim(release["PRETTY_NAME"], `"`)
+	}
+	return fmt.Sprintf("%v (kernel %v)", name, strings.TrimSpace(kernel)), nil
+}
+
+func cpuModel() (string, error) {
+	cpuinfo, err := readKeyValueFile("/proc/cpuinfo", ":")
+	if err != nil {
+		return "", err
+	}
+	if model := cpuinfo["model name"]; model != "" {
+		return model, nil
+	}
+	// e.g. arm64 doesn't report a model name
+	return cpuinfo["Hardware"], nil
+}
+
+func memoryBytes() (uint64, error) {
+	meminfo, err := readKeyValueFile("/proc/meminfo", ":")
+	if err != nil {
+		return 0, err
+	}
+	// e.g. "16396640 kB"
+	kb, err := strconv.ParseUint(strings.TrimSuffix(meminfo["MemTotal"], " kB"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("could not interpret MemTotal in /proc/meminfo: %v", err)
+	}
+	return kb * 1024, nil
+}
+
+// driverVersions returns the versions of loaded kernel modules that declare a
+// version, together with the NVIDIA driver version, if installed
+func driverVersions() (map[string]string, error) {
+	drivers := map[string]string{}
+	versionFiles, err := filepath.Glob("/sys/module/*/version")
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range versionFiles {
+		v, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		drivers[filepath.Base(filepath.Dir(file))] = strings.TrimSpace(string(v))
+	}
+	if nvidia, err := ioutil.ReadFile("/proc/driver/nvidia/version"); err == nil {
+		drivers["nvidia"] = strings.TrimSpace(strings.SplitN(string(nvidia), "\n", 2)[0])
+	}
+	return drivers, nil
+}
+
+// readKeyValueFile returns the keys and values of the given file, which has
+// lines of the form <key><separator><value>. The first occurrence of a key is
+// kept.
+func readKeyValueFile(file, separator string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), separator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		if _, exists := values[key]; !exists {
+			values[key] = strings.TrimSpace(parts[1])
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMachineInventoryArtifact(t *testing.T) {
+	defer setup(t)()
+	config.EnableMachineInventory = true
+	config.MachineInventoryManifest = filepath.Join(testdataDir, t.Name(), "toolchains.json")
+	err := ioutil.WriteFile(config.MachineInventoryManifest, []byte(`{"go": ["go", "version"]}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write toolchain manifest: %v", err)
+	}
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	file := filepath.Join(taskContext.TaskDir, machineInventoryPath)
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Could not read machine inventory: %v", err)
+	}
+	var inventory MachineInventory
+	err = json.Unmarshal(bytes, &inventory)
+	if err != nil {
+		t.Fatalf("Could not interpret machine inventory as JSON: %v\n%s", err, bytes)
+	}
+	if inventory.OS != runtime.GOOS || inventory.CPUCount != runtime.NumCPU() || inventory.Engine != engine {
+		t.Fatalf("Machine inventory does not describe this worker:\n%s", bytes)
+	}
+	if !strings.HasPrefix(inventory.Toolchains["go"], "go version") {
+		t.Fatalf("Was expecting machine inventory to include go toolchain version, but got:\n%s", bytes)
+	}
+	logBytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	if logtext := string(logBytes); !strings.Contains(logtext, "[inventory] Toolchain go: go version") {
+		t.Fatalf("Was expecting log to include inventory banner, but it doesn't:\n%v", logtext)
+	}
+}
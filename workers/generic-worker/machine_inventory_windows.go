@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"golang.org/x/sys/windows/registry"
+)
+
+func osBuild() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	productName, _, err := k.GetStringValue("ProductName")
+	if err != nil {
+		return "", err
+	}
+	build, _, err := k.GetStringValue("CurrentBuild")
+	if err != nil {
+		return "", err
+	}
+	// update build revision, not present on older versions of Windows
+	if ubr, _, err := k.GetIntegerValue("UBR"); err == nil {
+		build += "." + strconv.FormatUint(ubr, 10)
+	}
+	release, _, err := k.GetStringValue("DisplayVersion")
+	if err != nil {
+		release, _, _ = k.GetStringValue("ReleaseId")
+	}
+	if release != "" {
+		return fmt.Sprintf("%v %v (build %v)", productName, release, build), nil
+	}
+	return fmt.Sprintf("%v (build %v)", productName, build), nil
+}
+
+func cpuModel() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `HARDWARE\DESCRIPTION\System\CentralProcessor\0`, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	model, _, err := k.GetStringValue("ProcessorNameString")
+	return strings.TrimSpace(model), err
+}
+
+func memoryBytes() (uint64, error) {
+	out, err := powershellOutput(`(Get-CimInstance -ClassName Win32_ComputerSystem).TotalPhysicalMemory`)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// driverVersions returns the versions of the display, network and storage
+// drivers, which are the drivers most likely to affect task behaviour
+func driverVersions() (map[string]string, error) {
+	out, err := powershellOutput(`@(Get-CimInstance -ClassName Win32_PnPSignedDriver | Where-Object { $_.DeviceClass -in 'DISPLAY', 'NET', 'SCSIADAPTER', 'HDC' -and $_.DriverVersion } | Select-Object DeviceName, DriverVersion) | ConvertTo-Json -Compress`)
+	if err != nil {
+		return nil, err
+	}
+	var signedDrivers []struct {
+		DeviceName    string
+		DriverVersion string
+	}
+	err = json.Unmarshal([]byte(out), &signedDrivers)
+	if err != nil {
+		return nil, fmt.Errorf("could not interpret driver list %q: %v", out, err)
+	}
+	drivers := map[string]string{}
+	for _, d := range signedDrivers {
+		drivers[d.DeviceName] = d.DriverVersion
+	}
+	return drivers, nil
+}
+
+func powershellOutput(script string) (string, error) {
+	out, err := host.CombinedOutput("powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script)
+	if err != nil {
+		return "", fmt.Errorf("%v\n%v", err, out)
+	}
+	return out, nil
+}
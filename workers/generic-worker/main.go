@@ -1,5 +1,7 @@
 //go:generate go run ./gw-codegen file://schemas/docker_posix.yml       generated_docker_linux.go        docker
 //go:generate go run ./gw-codegen file://schemas/docker_posix.yml       generated_docker_darwin.go       docker
+//go:generate go run ./gw-codegen file://schemas/kubernetes_posix.yml   generated_kubernetes_linux.go    kubernetes
+//go:generate go run ./gw-codegen file://schemas/kubernetes_posix.yml   generated_kubernetes_darwin.go   kubernetes
 //go:generate go run ./gw-codegen file://schemas/simple_posix.yml       generated_simple_linux.go        simple
 //go:generate go run ./gw-codegen file://schemas/simple_posix.yml       generated_simple_darwin.go       simple
 //go:generate go run ./gw-codegen file://schemas/simple_posix.yml       generated_simple_freebsd.go      simple
@@ -33,7 +35,6 @@ import (
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/expose"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
-	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
 	gwruntime "github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
 	"github.com/xeipuuv/gojsonschema"
@@ -46,6 +47,9 @@ var (
 	cwd = CwdOrPanic()
 	// workerReady becomes true when it is able to call queue.claimWork for the first time
 	workerReady = false
+	// how often task directories and task users left over from previous
+	// tasks are purged while the worker is idle
+	idlePurgeInterval = 15 * time.Minute
 	// Whether we are running in AWS
 	configureForAWS bool
 	// Whether we are running in GCP
@@ -81,13 +85,52 @@ func persistFeaturesState() (err error) {
 
 func initialiseFeatures() (err error) {
 	Features = []Feature{
+		// keep cost accounting first, so that it is started first and
+		// stopped last, in order to account for as much of the task as
+		// possible
+		&CostAccountingFeature{},
+		&ResourceUsageFeature{},
+		// must come before Mounts and Fetches, so that their downloads are
+		// throttled
+		&ThrottleFeature{},
 		&LiveLogFeature{},
+		// after LiveLog, so that the inventory banner appears in the live
+		// log
+		&MachineInventoryFeature{},
+		// after LiveLog, since it wraps the task log writer that LiveLog
+		// sets up, in order to redact secret values
+		&SecretsFeature{},
 		&TaskclusterProxyFeature{},
+		// must come before Services, so that services can use leased ports
+		&PortLeasesFeature{},
 		&OSGroupsFeature{},
+		// must come before Mounts and Fetches, which download the
+		// artifacts that it checks
+		&DependencyArtifactsFeature{},
 		&MountsFeature{},
+		&FetchesFeature{},
+		// after Mounts and Fetches, so that only mounts that aren't already
+		// cached are prefetched for the next task
+		&WarmStandbyFeature{},
+		// after Mounts and Fetches, so that files can be written inside
+		// directories that they populate
+		&WriteFilesFeature{},
+		// after Mounts, so that it is stopped before writable directory
+		// caches are moved out of the task directory
+		&TaskEnvironmentFeature{},
+		// must come after Mounts and Fetches, since content they download
+		// contributes to the task hash
+		&ResultCacheFeature{},
 		&SupersedeFeature{},
+		&NotificationsFeature{},
+		&PhasesFeature{},
+		&ReproducibleFeature{},
+		&PrivateArtifactsFeature{},
 	}
 	Features = append(Features, platformFeatures()...)
+	// last, so that it is stopped first, in order for the audit trail to be
+	// covered by the chain of trust certificate
+	Features = append(Features, &AuditTrailFeature{})
 	for _, feature := range Features {
 		log.Printf("Initialising task feature %v...", feature.Name())
 		err := feature.Initialise()
@@ -96,10 +139,50 @@ func initialiseFeatures() (err error) {
 			return err
 		}
 	}
+	logPayloadFeatures()
 	log.Print("All features initialised.")
 	return nil
 }
 
+// logPayloadFeatures logs which payload features are enabled on this worker,
+// together with the scopes tasks need in order to use them, and warns about
+// unrecognised names in config setting enabledFeatures. Worker configs may be
+// shared between platforms, so unrecognised names are not fatal.
+func logPayloadFeatures() {
+	known := map[string]bool{}
+	for _, feature := range Features {
+		pf, isPayloadFeature := feature.(PayloadFeature)
+		if !isPayloadFeature {
+			continue
+		}
+		known[pf.PayloadName()] = true
+		switch {
+		case !payloadFeatureEnabled(pf.PayloadName()):
+			log.Printf("Payload feature %v is disabled; add it to config setting enabledFeatures to enable it", pf.PayloadName())
+		case pf.ScopePattern() != "":
+			log.Printf("Payload feature %v is enabled, requiring scope %v", pf.PayloadName(), pf.ScopePattern())
+		default:
+			log.Printf("Payload feature %v is enabled", pf.PayloadName())
+		}
+	}
+	for _, name := range config.EnabledFeatures {
+		if !known[name] {
+			log.Printf("WARNING: Config setting enabledFeatures includes %q which is not a payload feature of this worker", name)
+		}
+	}
+}
+
+// payloadFeatureEnabled returns whether the payload feature with the given
+// name is listed in config setting enabledFeatures
+func payloadFeatureEnabled(name string) bool {
+	for _, enabled := range config.EnabledFeatures {
+		if enabled == name {
+			return true
+		}
+	}
+	return false
+}
+
 func init() {
 	InitialiseLogger()
 }
@@ -184,6 +267,9 @@ func main() {
 
 		// Config known to be loaded successfully at this point...
 
+		err = configureContainerMode()
+		exitOnError(INVALID_CONFIG, err, "Invalid config")
+
 		// * If running tasks as dedicated OS users, we should take ownership
 		//   of generic-worker config file, and block access to task users, so
 		//   that tasks can't read from or write to it.
@@ -199,21 +285,21 @@ func main() {
 		case REBOOT_REQUIRED:
 			logEvent("instanceReboot", nil, time.Now())
 			if !config.DisableReboots {
-				host.ImmediateReboot()
+				immediateReboot()
 			}
 		case IDLE_TIMEOUT:
 			logEvent("instanceShutdown", nil, time.Now())
 			if config.ShutdownMachineOnIdle {
-				host.ImmediateShutdown("generic-worker idle timeout")
+				immediateShutdown("generic-worker idle timeout")
 			}
 		case INTERNAL_ERROR:
 			logEvent("instanceShutdown", nil, time.Now())
 			if config.ShutdownMachineOnInternalError {
-				host.ImmediateShutdown("generic-worker internal error")
+				immediateShutdown("generic-worker internal error")
 			}
 		case NONCURRENT_DEPLOYMENT_ID:
 			logEvent("instanceShutdown", nil, time.Now())
-			host.ImmediateShutdown("generic-worker deploymentId is not latest")
+			immediateShutdown("generic-worker deploymentId is not latest")
 		}
 		os.Exit(int(exitCode))
 	case arguments["install"]:
@@ -223,6 +309,23 @@ func main() {
 	case arguments["new-ed25519-keypair"]:
 		err := generateEd25519Keypair(arguments["--file"].(string))
 		exitOnError(CANT_CREATE_ED25519_KEYPAIR, err, "Error generating ed25519 keypair %v for worker", arguments["--file"].(string))
+	case arguments["quarantine"]:
+		duration, err := time.ParseDuration(arguments["--duration"].(string))
+		exitOnError(INTERNAL_ERROR, err, "Invalid quarantine duration %q", arguments["--duration"])
+		configFileAbs, err := filepath.Abs(arguments["--config"].(string))
+		exitOnError(CANT_LOAD_CONFIG, err, "Cannot determine absolute path location for generic-worker config file '%v'", arguments["--config"])
+		_, err = loadConfig(&gwconfig.File{Path: configFileAbs}, NO_PROVIDER)
+		exitOnError(CANT_LOAD_CONFIG, err, "Error loading configuration")
+		err = quarantine(config.Queue(), duration)
+		exitOnError(INTERNAL_ERROR, err, "Could not quarantine worker %v/%v", config.WorkerGroup, config.WorkerID)
+	case arguments["task-history"]:
+		taskID, _ := arguments["--task-id"].(string)
+		result, _ := arguments["--result"].(string)
+		err := queryTaskHistory(taskID, result, arguments["--limit"].(string))
+		exitOnError(INTERNAL_ERROR, err, "Could not query task history database")
+	case arguments["test-harness"]:
+		err := runTestHarness(arguments["--port"].(string))
+		exitOnError(INTERNAL_ERROR, err, "Could not run test harness")
 	default:
 		// platform specific...
 		os.Exit(int(platformTargets(arguments)))
@@ -242,33 +345,152 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 	// only one place if possible (defaults also declared in `usage`)
 	config = &gwconfig.Config{
 		PublicConfig: gwconfig.PublicConfig{
+			AndroidEmulatorAVD:             "",
+			AndroidEmulatorBootTimeoutSecs: 300,
+			AndroidEmulatorPort:            5554,
+			AndroidEmulatorSnapshot:        "",
+			AndroidSDKRoot:                 "",
+			APICircuitBreakerCooldownSecs:  60,
+			APICircuitBreakerThreshold:     5,
+			APIRetryBudgetSecs:             300,
+			ArtifactMirror:                 "",
+			ArtifactMirrorAccessKeyID:      "",
+			ArtifactMirrorEndpoint:         "",
+			ArtifactMirrorRegion:           "us-east-1",
+			ArtifactMirrorRetries:          5,
+			ArtifactSigningKeys:            map[string]gwconfig.SigningKey{},
 			AuthRootURL:                    "",
+			AutoscalerHook:                 "",
+			AutoscalerHookCommand:          []string{},
+			CABundle:                       "",
 			CachesDir:                      "caches",
+			CaseSensitiveTaskDirectories:   false,
+			CheckDependencyArtifacts:       false,
+			CheckForCancellationEverySecs:  30,
+			CheckForConfigDriftEverySecs:   1800,
 			CheckForNewDeploymentEverySecs: 1800,
+			CheckForQuarantineEverySecs:    60,
+			CheckForSelfUpdateEverySecs:    3600,
+			ChunkedArtifactUploads:         false,
+			CircuitBreakerPatterns:         []string{},
+			CircuitBreakerQuarantineSecs:   86400,
+			CircuitBreakerThreshold:        0,
+			ClaimExpiryMarginSecs:          60,
+			ClaimFilterRoutes:              []string{},
+			ClaimFilterTags:                map[string]string{},
 			CleanUpTaskDirs:                true,
+			ClientCertificate:              "",
+			ClientKey:                      "",
+			CloudMetadata:                  "",
+			ConfigDriftPolicy:              "",
+			ConfirmIndexRoutes:             "",
+			ContainerHostHelperURL:         "",
+			ContainerMode:                  "auto",
+			ControlSocket:                  "",
+			CredentialProvider:             "static",
+			CredentialsFile:                "",
+			DisableNetwork:                 false,
 			DisableReboots:                 false,
+			DownloadConnections:            4,
 			DownloadsDir:                   "downloads",
+			EnableAuditTrail:               false,
+			EnableCostAccounting:           false,
+			EnableMachineInventory:         false,
+			EnableResourceUsage:            false,
+			// payload features that existed before enabledFeatures was
+			// introduced are enabled by default, for backward compatibility
+			EnabledFeatures: []string{
+				"chainOfTrust",
+				"rdpInfo",
+				"runAsAdministrator",
+				"taskclusterProxy",
+			},
+			FaketimeLibrary:                "",
+			FileCountWatchdogIntervalSecs:  30,
+			FileCountWatchdogMaxTaskFiles:  0,
+			ForcePrivateArtifacts:          false,
 			IdleTimeoutSecs:                0,
+			IndexRootURL:                   "",
+			InstanceHourlyCost:             0,
+			InstancePricingURL:             "",
+			IOSSimulatorBootTimeoutSecs:    300,
 			LiveLogExecutable:              "livelog",
 			LiveLogGETPort:                 60023,
 			LiveLogPUTPort:                 60022,
+			MachineInventoryManifest:       "",
+			MaintenanceAfterIdleSecs:       60,
+			MaintenanceJobs:                []gwconfig.MaintenanceJob{},
+			MaintenanceWindows:             []gwconfig.MaintenanceWindow{},
+			MaxDownloadBytesPerSec:         0,
+			MaxPayloadBytes:                0,
+			MaxTaskArtifacts:               0,
+			MaxTaskArtifactsMB:             0,
+			MaxTaskCommands:                0,
+			MaxTaskEnvBytes:                0,
+			MaxUploadBytesPerSec:           0,
+			MemoryWatchdogIntervalSecs:     5,
+			MemoryWatchdogMaxTaskRSSMB:     0,
+			MemoryWatchdogMinAvailableMB:   0,
+			MultipartDownloadMinMB:         256,
+			NotifyEmailAddress:             "",
+			NotifyMatrixRoomID:             "",
+			NotifyOnStatuses:               []string{},
+			NotifyRootURL:                  "",
+			NotifyWebhookURL:               "",
 			NumberOfTasksToRun:             0,
+			PortLeaseMaxPort:               29999,
+			PortLeaseMinPort:               20000,
+			PortLeasesDir:                  filepath.Join(os.TempDir(), "generic-worker-port-leases"),
+			ProgressPort:                   60099,
+			ProgressUpdateIntervalSecs:     60,
 			ProvisionerID:                  "test-provisioner",
+			ProxyBypass:                    []string{},
+			ProxyURL:                       "",
+			ProxyUsername:                  "",
 			PurgeCacheRootURL:              "",
 			QueueRootURL:                   "",
+			RegistrySandbox:                false,
+			RegistrySandboxKeys:            []string{},
 			RequiredDiskSpaceMegabytes:     10240,
 			RootURL:                        "",
 			RunAfterUserCreation:           "",
 			SecretsRootURL:                 "",
+			SelfUpdateEd25519PublicKey:     "",
+			SelfUpdateHealthCheck:          []string{},
+			SelfUpdateLabels:               []string{},
+			SelfUpdateManifestURL:          "",
 			SentryProject:                  "generic-worker",
 			ShutdownMachineOnIdle:          false,
 			ShutdownMachineOnInternalError: false,
+			StatusPagePort:                 0,
 			Subdomain:                      "taskcluster-worker.net",
 			TaskclusterProxyExecutable:     "taskcluster-proxy",
 			TaskclusterProxyPort:           80,
+			TaskEnvironmentCapture:         "on-failure",
+			TaskHistoryMaxRuns:             1000,
+			TaskIsolation:                  "",
+			TaskIsolationSandboxProfile:    "",
+			TaskIsolationVMImage:           "",
+			TaskIsolationVMMemoryMB:        4096,
+			TaskIsolationVMProcessorCount:  2,
+			TaskIsolationVMSSHKey:          "",
+			TaskIsolationVMSwitch:          "",
+			TaskIsolationVMUsername:        "",
+			TaskNetworkNamespace:           false,
+			TaskNetworkSubnet:              "10.254.254.0/30",
+			TaskUserGroups:                 []string{},
+			TaskUserPasswordLength:         29,
+			TaskUserProfilesDir:            "",
+			TaskUserRights:                 []string{},
+			TaskUserSetupAttempts:          3,
+			TaskUserSetupQuarantineSecs:    3600,
 			TasksDir:                       defaultTasksDir(),
+			TCCGrants:                      []gwconfig.TCCGrant{},
+			WarmStandby:                    false,
+			WindowsDefenderExclusions:      false,
 			WorkerGroup:                    "test-worker-group",
 			WorkerLocation:                 "",
+			WorkerManagerProviderID:        "",
 			WorkerManagerRootURL:           "",
 			WorkerTypeMetadata:             map[string]interface{}{},
 		},
@@ -280,6 +502,14 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 	} else {
 		// apply values from config file
 		err = configFile.UpdateConfig(config)
+		if err == nil && config.CloudMetadata != "" {
+			// the config file is applied again, so that the worker identity
+			// from cloud metadata only replaces settings it doesn't set
+			err = updateConfigFromCloudMetadata(config)
+			if err == nil {
+				err = configFile.UpdateConfig(config)
+			}
+		}
 	}
 
 	if err != nil {
@@ -298,6 +528,9 @@ func loadConfig(configFile *gwconfig.File, provider Provider) (gwconfig.Provider
 		"version":    version,
 		"engine":     engine,
 	}
+	for k, v := range architectureMetadata() {
+		gwMetadata[k] = v
+	}
 	if revision != "" {
 		gwMetadata["revision"] = revision
 		gwMetadata["source"] = "https://github.com/taskcluster/taskcluster/commits/" + revision
@@ -409,18 +642,50 @@ func CwdOrPanic() string {
 }
 
 func RunWorker() (exitCode ExitCode) {
+	var circuitBreaker *CircuitBreaker
 	defer func() {
 		if r := recover(); r != nil {
 			HandleCrash(r)
+			// e.g. task users could not be created
+			if circuitBreaker != nil {
+				circuitBreaker.Record(true)
+			}
+			signalAutoscaler(lifecycleUnhealthy)
 			exitCode = INTERNAL_ERROR
 		}
 	}()
 
-	err := config.Validate()
+	// before anything connects to Taskcluster services
+	err := configureTLS(config)
+	if err == nil {
+		err = configureProxy(config)
+	}
+	if err != nil {
+		log.Printf("Invalid config: %v", err)
+		return INVALID_CONFIG
+	}
+
+	credentialProvider, err := NewCredentialProvider(config)
 	if err != nil {
 		log.Printf("Invalid config: %v", err)
 		return INVALID_CONFIG
 	}
+	workerCredentials := NewWorkerCredentials(credentialProvider)
+	err = workerCredentials.Acquire(config)
+	if err != nil {
+		log.Printf("Could not acquire worker credentials (config setting credentialProvider): %v", err)
+		return CREDENTIALS_EXPIRED
+	}
+
+	err = config.Validate()
+	if err != nil {
+		log.Printf("Invalid config: %v", err)
+		return INVALID_CONFIG
+	}
+	circuitBreaker = NewCircuitBreaker(config.CircuitBreakerThreshold, time.Duration(config.CircuitBreakerQuarantineSecs)*time.Second, config.CircuitBreakerPatterns)
+	apiRetrier = NewAPIRetrier(time.Duration(config.APIRetryBudgetSecs)*time.Second, config.APICircuitBreakerThreshold, time.Duration(config.APICircuitBreakerCooldownSecs)*time.Second)
+	config.HTTPRetry = apiRetrier.Retry
+	configureFaultInjection(config)
 
 	// This *DOESN'T* output secret fields, so is SAFE
 	log.Printf("Config: %v", config)
@@ -430,6 +695,12 @@ func RunWorker() (exitCode ExitCode) {
 		logEvent("instanceBoot", nil, host.Info().BootTime)
 	}
 
+	// If this worker recently updated itself, make sure the new release is
+	// not failing to get as far as running tasks
+	if selfUpdateStarted() {
+		return WORKER_ROLLED_BACK
+	}
+
 	err = setupExposer()
 	if err != nil {
 		log.Printf("Could not initialize exposer: %v", err)
@@ -450,6 +721,22 @@ func RunWorker() (exitCode ExitCode) {
 	// Queue is the object we will use for accessing queue api
 	queue = config.Queue()
 
+	err = initialiseArtifactMirror()
+	if err != nil {
+		log.Printf("Could not initialise artifact mirror: %v", err)
+		return INVALID_CONFIG
+	}
+
+	err = initialiseAutoscalerHook()
+	if err != nil {
+		log.Printf("Could not initialise autoscaler hook: %v", err)
+		return INVALID_CONFIG
+	}
+
+	// resolve the run that the worker was running if it stopped unexpectedly,
+	// before its task directory is deleted
+	recoverOrphanedRun()
+
 	err = initialiseFeatures()
 	if err != nil {
 		panic(err)
@@ -461,14 +748,56 @@ func RunWorker() (exitCode ExitCode) {
 			exitCode = INTERNAL_ERROR
 		}
 	}()
+	// notifications of the last task are sent in the background
+	defer pendingNotifications.Wait()
+	// runs before features persist their state, so that prefetched mounts are
+	// persisted, and a task user created in the background is complete
+	// before the worker exits or reboots
+	defer func() {
+		_, err := standby.Collect()
+		if err != nil {
+			log.Printf("%v", err)
+			exitCode = INTERNAL_ERROR
+		}
+	}()
+
+	control := NewWorkerControl(config.ControlToken, tasksResolved)
+	if config.ControlSocket != "" {
+		err = control.Serve(config.ControlSocket)
+		if err != nil {
+			log.Printf("%v", err)
+			return INVALID_CONFIG
+		}
+		defer control.Close()
+	}
+
+	statusPage := NewStatusPage(control, config.StatusPageToken)
+	if config.StatusPagePort != 0 {
+		statusPage.RefreshCaches()
+		err = statusPage.Serve(config.StatusPagePort)
+		if err != nil {
+			log.Printf("%v", err)
+			return INVALID_CONFIG
+		}
+		defer statusPage.Close()
+	}
+
+	quarantineChecker := NewQuarantineChecker(queue, time.Duration(config.CheckForQuarantineEverySecs)*time.Second)
 
 	// loop, claiming and running tasks!
 	lastActive := time.Now()
 	// use zero value, to be sure that a check is made before first task runs
 	lastCheckedDeploymentID := time.Time{}
+	lastCheckedConfigDrift := time.Time{}
+	configDriftChecker := NewConfigDriftChecker(config.ConfigDriftPolicy)
+	lastCheckedSelfUpdate := time.Time{}
 	lastReportedNoTasks := time.Now()
+	lastPurgedWhileIdle := time.Now()
 	sigInterrupt := make(chan os.Signal, 1)
 	signal.Notify(sigInterrupt, os.Interrupt)
+	maintenance := NewMaintenanceScheduler(config.MaintenanceJobs, time.Duration(config.MaintenanceAfterIdleSecs)*time.Second, filepath.Join(cwd, "maintenance"))
+	defer maintenance.Pause()
+	maintenanceWindows := NewMaintenanceWindows(config.MaintenanceWindows, filepath.Join(cwd, "maintenance-windows"), maintenanceWindowsFile)
 	if RotateTaskEnvironment() {
 		return REBOOT_REQUIRED
 	}
@@ -484,39 +813,145 @@ func RunWorker() (exitCode ExitCode) {
 			}
 		}
 
+		// Compare the running config with the desired config of the worker
+		// pool, which can change without a new deploymentId.
+		// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+		if config.ConfigDriftPolicy != "" && time.Now().Round(0).Sub(lastCheckedConfigDrift) > time.Duration(config.CheckForConfigDriftEverySecs)*time.Second {
+			lastCheckedConfigDrift = time.Now()
+			if configDriftChecker.Check() {
+				return CONFIG_DRIFT
+			}
+		}
+
+		// Check for a new release of generic-worker between tasks, and if
+		// found, exit so that the updated binary is run when the worker is
+		// restarted.
+		// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+		if config.SelfUpdateManifestURL != "" && time.Now().Round(0).Sub(lastCheckedSelfUpdate) > time.Duration(config.CheckForSelfUpdateEverySecs)*time.Second {
+			lastCheckedSelfUpdate = time.Now()
+			if selfUpdate() {
+				return WORKER_UPDATED
+			}
+		}
+
+		// Renew the credentials of the worker between tasks, for the next
+		// claimWork call, before they expire or when they are replaced.
+		updated, err := workerCredentials.Renew(config)
+		if err != nil {
+			log.Printf("WARNING: Could not renew worker credentials: %v", err)
+		}
+		if updated {
+			queue.Credentials = config.Credentials()
+		}
+		if workerCredentials.Expired() {
+			log.Print("Worker credentials have expired and could not be renewed")
+			return CREDENTIALS_EXPIRED
+		}
+
 		// Ensure there is enough disk space *before* claiming a task
-		err := garbageCollection()
+		dockerGarbageCollection()
+		err = garbageCollection()
 		if err != nil {
 			panic(err)
 		}
 
-		task := ClaimWork()
+		select {
+		case <-control.Shutdown():
+			log.Print("Shutting down gracefully, as requested by control command")
+			return WORKER_STOPPED
+		default:
+		}
+
+		// Tasks aren't claimed during a maintenance window, so once the
+		// previous task has been resolved, the window can run.
+		if window, started, ends := maintenanceWindows.Due(time.Now()); window != nil {
+			maintenance.Pause()
+			control.SetMaintenanceWindow(window.Name)
+			rebootRequired := maintenanceWindows.Run(window, started, ends)
+			control.SetMaintenanceWindow("")
+			if rebootRequired {
+				return REBOOT_REQUIRED
+			}
+			lastActive = time.Now()
+		}
+
+		var task *TaskRun
+		quarantined := quarantineChecker.Quarantined()
+		control.SetQuarantinedUntil(quarantineChecker.Until())
+		degraded, reason := apiRetrier.Degraded()
+		control.SetDegraded(reason)
+		if control.Paused() || quarantined || degraded {
+			// a paused, quarantined or degraded worker is not idle, so
+			// shouldn't reach idle timeout
+			lastActive = time.Now()
+		} else {
+			task = ClaimWork()
+			if task != nil {
+				if mismatch := claimFilterMismatch(&task.Definition); mismatch != "" {
+					declineTask(task, mismatch)
+					task = nil
+				}
+			}
+		}
 
 		// make sure at least 5 seconds pass between tcqueue.ClaimWork API calls
 		wait5Seconds := time.NewTimer(time.Second * 5)
 
 		if task != nil {
+			// the task should have the machine to itself
+			maintenance.Pause()
 			logEvent("taskQueued", task, time.Time(task.Definition.Created))
 			logEvent("taskStart", task, time.Now())
+			control.TaskStarted(task)
+			signalAutoscaler(lifecycleStartedTask)
 
+			err := recordInFlightRun(task, task.StatusManager.TakenUntil())
+			if err != nil {
+				log.Printf("WARNING: could not record in-flight run, so if the worker stops unexpectedly, it will not be able to resolve it: %v", err)
+			}
+			started := time.Now()
 			errors := task.Run()
+			// the run has been resolved
+			err = clearInFlightRun()
+			if err != nil {
+				panic(err)
+			}
 			logEvent("taskFinish", task, time.Now())
+			recordTaskHistory(task, started, errors)
+			signalAutoscaler(lifecycleFinishedTask)
 			if errors.Occurred() {
 				log.Printf("ERROR(s) encountered: %v", errors)
 				task.Error(errors.Error())
+			} else {
+				task.confirmIndexRoutes()
 			}
 			if errors.WorkerShutdown() {
 				return WORKER_SHUTDOWN
 			}
-			err := task.ReleaseResources()
+			infraFailure := circuitBreaker.infraFailure(errors)
+			if circuitBreaker.Record(infraFailure) {
+				quarantineChecker.Recheck()
+				signalAutoscaler(lifecycleUnhealthy)
+			}
+			task.mirrorArtifacts()
+			err = task.ReleaseResources()
 			if err != nil {
 				log.Printf("ERROR: releasing resources\n%v", err)
 			}
+			// the next task user may still be being created in the
+			// background, and mustn't be purged as an orphan
+			standby.Wait()
 			err = purgeOldTasks()
 			if err != nil {
 				panic(err)
 			}
 			tasksResolved++
+			control.TaskFinished(tasksResolved)
+			statusPage.RefreshCaches()
+			// a cancelled task says nothing about the health of the worker
+			if selfUpdateTaskResolved(!errors.Occurred(), infraFailure && task.StatusManager.LastKnownStatus() != cancelled) {
+				return WORKER_ROLLED_BACK
+			}
 			// remainingTasks will be -ve, if config.NumberOfTasksToRun is not set (=0)
 			remainingTasks := int(config.NumberOfTasksToRun - tasksResolved)
 			remainingTaskCountText := ""
@@ -545,6 +980,7 @@ func RunWorker() (exitCode ExitCode) {
 			if config.IdleTimeoutSecs > 0 {
 				remainingIdleTimeText = fmt.Sprintf(" (will exit if no task claimed in %v)", time.Second*time.Duration(config.IdleTimeoutSecs)-idleTime)
 				if idleTime.Seconds() > float64(config.IdleTimeoutSecs) {
+					standby.Wait()
 					_ = purgeOldTasks()
 					log.Printf("Worker idle for idleShutdownTimeoutSecs seconds (%v)", idleTime)
 					return IDLE_TIMEOUT
@@ -564,6 +1000,20 @@ func RunWorker() (exitCode ExitCode) {
 				}
 				log.Printf("No task claimed. Idle for %v%v.%v", idleTime, remainingIdleTimeText, remainingTaskCountText)
 			}
+			// Clean up after worker runs that crashed, and after tasks whose
+			// environment could not be purged, while there is nothing else
+			// to do. Not while the environment of the next task is being
+			// prepared, as it isn't in use yet.
+			if time.Now().Round(0).Sub(lastPurgedWhileIdle) > idlePurgeInterval && !standby.Pending() {
+				lastPurgedWhileIdle = time.Now()
+				err := purgeOldTasks()
+				// errors are not fatal
+				if err != nil {
+					log.Printf("WARNING: failed to remove old task directories/users: %v", err)
+				}
+			}
+			signalAutoscaler(lifecycleBecameIdle)
+			maintenance.Idle(idleTime)
 		}
 		// To avoid hammering queue, make sure there is at least 5 seconds
 		// between consecutive requests. Note we do this even if a task ran,
@@ -572,6 +1022,9 @@ func RunWorker() (exitCode ExitCode) {
 		case <-wait5Seconds.C:
 		case <-sigInterrupt:
 			return WORKER_STOPPED
+		case <-control.Shutdown():
+			log.Print("Shutting down gracefully, as requested by control command")
+			return WORKER_STOPPED
 		}
 	}
 }
@@ -633,6 +1086,7 @@ func ClaimWork() *TaskRun {
 			},
 			config.RootURL,
 		)
+		taskQueue.HTTPRetry = config.HTTPRetry
 		// if queueRootURL is configured, this takes precedence over rootURL
 		if config.QueueRootURL != "" {
 			taskQueue.RootURL = config.QueueRootURL
@@ -669,6 +1123,13 @@ func (task *TaskRun) validatePayload() *CommandExecutionError {
 		for _, desc := range result.Errors() {
 			task.Errorf("- %s", desc)
 		}
+		task.payloadViolations = payloadViolations(result)
+		addRemediationHints(task.payloadViolations)
+		for _, v := range task.payloadViolations {
+			if v.Hint != "" {
+				task.Errorf("Hint: %v", v.Hint)
+			}
+		}
 		// Dealing with Invalid Task Payloads
 		// ----------------------------------
 		// If the task payload is malformed or invalid, keep in mind that the
@@ -703,6 +1164,24 @@ func (task *TaskRun) validatePayload() *CommandExecutionError {
 	if err != nil {
 		return MalformedPayloadError(err)
 	}
+	if cee := task.selectArchitecture(); cee != nil {
+		return cee
+	}
+	if cee := task.expandTemplates(); cee != nil {
+		return cee
+	}
+	if cee := task.validateRetryPolicies(); cee != nil {
+		return cee
+	}
+	if cee := task.validateRerunPolicy(); cee != nil {
+		return cee
+	}
+	if cee := task.validateExitStatusHandling(); cee != nil {
+		return cee
+	}
+	if cee := task.lintPayload(); cee != nil {
+		return cee
+	}
 	for _, artifact := range task.Payload.Artifacts {
 		// The default artifact expiry is task expiry, but is only applied when
 		// the task artifacts are resolved. We intentionally don't modify
@@ -728,6 +1207,10 @@ type CommandExecutionError struct {
 	TaskStatus TaskStatus
 	Cause      error
 	Reason     TaskUpdateReason
+	// Set if task.payload.onExitStatus mapped the exit code of a task
+	// command to Reason, in which case the task, rather than the worker,
+	// chose the reason.
+	exitStatusMapping bool
 }
 
 func executionError(reason TaskUpdateReason, status TaskStatus, err error) *CommandExecutionError {
@@ -806,14 +1289,70 @@ func (task *TaskRun) IsIntermittentExitCode(c int64) bool {
 	return false
 }
 
+func (task *TaskRun) IsSuccessExitCode(c int64) bool {
+	for _, code := range task.Payload.OnExitStatus.Success {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// exceptionReason returns the reason that task.payload.onExitStatus.exception
+// maps exit code c to, or "" if it doesn't
+func (task *TaskRun) exceptionReason(c int64) TaskUpdateReason {
+	for _, mapping := range task.Payload.OnExitStatus.Exception {
+		for _, code := range mapping.ExitCodes {
+			if c == code {
+				return TaskUpdateReason(mapping.Reason)
+			}
+		}
+	}
+	return ""
+}
+
+// validateExitStatusHandling checks that no exit code appears more than once
+// in task.payload.onExitStatus, since it would be ambiguous how to resolve
+// the task
+func (task *TaskRun) validateExitStatusHandling() *CommandExecutionError {
+	lists := map[int64]string{}
+	add := func(list string, codes []int64) *CommandExecutionError {
+		for _, code := range codes {
+			if other, exists := lists[code]; exists {
+				return MalformedPayloadError(fmt.Errorf("Malformed payload: exit code %v appears in both %v and %v of task.payload.onExitStatus", code, other, list))
+			}
+			lists[code] = list
+		}
+		return nil
+	}
+	if cee := add("retry", task.Payload.OnExitStatus.Retry); cee != nil {
+		return cee
+	}
+	if cee := add("success", task.Payload.OnExitStatus.Success); cee != nil {
+		return cee
+	}
+	for _, mapping := range task.Payload.OnExitStatus.Exception {
+		if cee := add("exception ("+mapping.Reason+")", mapping.ExitCodes); cee != nil {
+			return cee
+		}
+	}
+	return nil
+}
+
 func (task *TaskRun) ExecuteCommand(index int) *CommandExecutionError {
+	for _, f := range task.beforeCommand {
+		f(index)
+	}
 	task.Infof("Executing command %v: %v", index, task.formatCommand(index))
 	log.Print("Executing command " + strconv.Itoa(index) + ": " + task.Commands[index].String())
 	cee := task.prepareCommand(index)
 	if cee != nil {
 		panic(cee)
 	}
-	result := task.Commands[index].Execute()
+	result := task.executeWithRetries(index)
+	for _, f := range task.afterCommand {
+		f(index, result)
+	}
 	if ae := task.StatusManager.AbortException(); ae != nil {
 		return ae
 	}
@@ -821,11 +1360,23 @@ func (task *TaskRun) ExecuteCommand(index int) *CommandExecutionError {
 
 	switch {
 	case result.Failed():
-		if task.IsIntermittentExitCode(int64(result.ExitCode())) {
+		exitCode := int64(result.ExitCode())
+		if task.IsIntermittentExitCode(exitCode) {
 			return &CommandExecutionError{
-				Cause:      fmt.Errorf("Task appears to have failed intermittently - exit code %v found in task payload.onExitStatus list", result.ExitCode()),
-				Reason:     intermittentTask,
-				TaskStatus: errored,
+				Cause:             fmt.Errorf("Task appears to have failed intermittently - exit code %v found in task payload.onExitStatus list", result.ExitCode()),
+				Reason:            intermittentTask,
+				TaskStatus:        errored,
+				exitStatusMapping: true,
+			}
+		} else if task.IsSuccessExitCode(exitCode) {
+			task.Warnf("Command %v exited with exit code %v, which task.payload.onExitStatus.success treats as success", index, exitCode)
+			return nil
+		} else if reason := task.exceptionReason(exitCode); reason != "" {
+			return &CommandExecutionError{
+				Cause:             fmt.Errorf("Exit code %v found in task payload.onExitStatus.exception list for reason %v", exitCode, reason),
+				Reason:            reason,
+				TaskStatus:        errored,
+				exitStatusMapping: true,
 			}
 		} else {
 			return &CommandExecutionError{
@@ -882,8 +1433,17 @@ func (e *ExecutionErrors) Occurred() bool {
 
 func (task *TaskRun) resolve(e *ExecutionErrors) *CommandExecutionError {
 	log.Printf("Resolving task %v ...", task.TaskID)
+	if task.StatusManager.LastKnownStatus() == cancelled {
+		log.Printf("Not resolving task %v since it has been cancelled", task.TaskID)
+		return nil
+	}
 	if !e.Occurred() {
-		return ResourceUnavailable(task.StatusManager.ReportCompleted())
+		err := task.StatusManager.ReportCompleted()
+		if err == nil {
+			// all features have stopped, so the task can no longer fail
+			task.recordResultCache()
+		}
+		return ResourceUnavailable(err)
 	}
 	if (*e)[0].TaskStatus == failed {
 		return ResourceUnavailable(task.StatusManager.ReportFailed())
@@ -906,6 +1466,9 @@ func (task *TaskRun) setMaxRunTimer() *time.Timer {
 }
 
 func (task *TaskRun) kill() {
+	for _, f := range task.beforeKill {
+		f()
+	}
 	for _, command := range task.Commands {
 		output, err := command.Kill()
 		if len(output) > 0 {
@@ -980,8 +1543,18 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 
 	task.logHeader()
 
+	err.add(task.validatePayloadSize())
+	if err.Occurred() {
+		return
+	}
 	err.add(task.validatePayload())
+	if !err.Occurred() {
+		err.add(task.validatePayloadLimits())
+	}
 	if err.Occurred() {
+		if len(task.payloadViolations) > 0 {
+			err.add(task.uploadPayloadViolations())
+		}
 		return
 	}
 	log.Printf("Running task %v/tasks/%v/runs/%v", config.RootURL, task.TaskID, task.RunID)
@@ -1006,18 +1579,22 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 	// create task features
 	for _, feature := range Features {
 		if feature.IsEnabled(task) {
+			if pf, isPayloadFeature := feature.(PayloadFeature); isPayloadFeature && !payloadFeatureEnabled(pf.PayloadName()) {
+				err.add(MalformedPayloadError(fmt.Errorf("Feature %q (task payload feature %v) is not enabled on worker type %v/%v - the worker config setting enabledFeatures would need to include %q", feature.Name(), pf.PayloadName(), config.ProvisionerID, config.WorkerType, pf.PayloadName())))
+				continue
+			}
 			log.Printf("Creating task feature %v...", feature.Name())
 			taskFeature := feature.NewTaskFeature(task)
 			requiredScopes := taskFeature.RequiredScopes()
-			scopesSatisfied, scopeValidationErr := scopes.Given(task.Definition.Scopes).Satisfies(requiredScopes, config.Auth())
+			missingScopes, scopeValidationErr := scopes.Given(task.Definition.Scopes).Missing(requiredScopes, config.Auth())
 			if scopeValidationErr != nil {
 				// presumably we couldn't expand assume:* scopes due to auth
 				// service unavailability
 				err.add(ResourceUnavailable(scopeValidationErr))
 				continue
 			}
-			if !scopesSatisfied {
-				err.add(MalformedPayloadError(fmt.Errorf("Feature %q requires scopes:\n\n%v\n\nbut task only has scopes:\n\n%v\n\nYou probably should add some scopes to your task definition", feature.Name(), requiredScopes, scopes.Given(task.Definition.Scopes))))
+			if missingScopes != nil {
+				err.add(MalformedPayloadError(fmt.Errorf("Feature %q requires scopes:\n\n%v\n\nbut task is missing scopes:\n\n%v\n\nsince it only has scopes:\n\n%v\n\nYou probably should add some scopes to your task definition", feature.Name(), requiredScopes, missingScopes, scopes.Given(task.Definition.Scopes))))
 				continue
 			}
 			reservedArtifacts := taskFeature.ReservedArtifacts()
@@ -1059,7 +1636,14 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 		}
 	}
 
+	// The Result Cache feature has exposed the artifacts of an identical
+	// earlier task, so there is nothing left to run or upload
+	if task.resultCacheTaskID != "" {
+		return
+	}
+
 	defer func() {
+		artifacts := []TaskArtifact{}
 		for _, artifact := range task.PayloadArtifacts() {
 			// Any attempt to upload a feature artifact should be skipped
 			// but not cause a failure, since e.g. a directory artifact
@@ -1070,6 +1654,14 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 				task.Warnf("Not uploading artifact %v found in task.payload.artifacts section, since this will be uploaded later by %v", artifact.Base().Name, feature)
 				continue
 			}
+			artifacts = append(artifacts, artifact)
+		}
+		if fail := task.checkArtifactsSize(artifacts); fail != nil {
+			err.add(fail)
+			task.Errorf("TASK FAILURE during artifact upload: %v", fail)
+			return
+		}
+		for _, artifact := range artifacts {
 			err.add(task.uploadArtifact(artifact))
 			// Note - the above error only covers not being able to upload an
 			// artifact, but doesn't cover case that an artifact could not be
@@ -1082,6 +1674,10 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 				task.Errorf("TASK FAILURE during artifact upload: %v", fail)
 			}
 		}
+		if fail := task.checkRequiredArtifacts(); fail != nil {
+			err.add(fail)
+			task.Errorf("TASK FAILURE during artifact upload: %v", fail)
+		}
 	}()
 
 	t := task.setMaxRunTimer()
@@ -1128,12 +1724,7 @@ func (task *TaskRun) Run() (err *ExecutionErrors) {
 		task.Info("Task Duration: " + finished.Round(0).Sub(started).String())
 	}()
 
-	for i := range task.Payload.Command {
-		err.add(task.ExecuteCommand(i))
-		if err.Occurred() {
-			return
-		}
-	}
+	err.add(task.executeCommands())
 
 	return
 }
@@ -1169,12 +1760,18 @@ func (task *TaskRun) closeLog(logHandle io.WriteCloser) {
 }
 
 func PrepareTaskEnvironment() (reboot bool) {
-	taskDirName := "task_" + strconv.Itoa(int(time.Now().Unix()))
+	taskDirName, err := standby.Collect()
+	if err != nil {
+		panic(err)
+	}
+	if taskDirName == "" {
+		taskDirName = "task_" + strconv.Itoa(int(time.Now().Unix()))
+	}
 	if PlatformTaskEnvironmentSetup(taskDirName) {
 		return true
 	}
 	logDir := filepath.Join(taskContext.TaskDir, filepath.Dir(logPath))
-	err := os.MkdirAll(logDir, 0700)
+	err = os.MkdirAll(logDir, 0700)
 	if err != nil {
 		panic(err)
 	}
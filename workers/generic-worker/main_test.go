@@ -155,6 +155,32 @@ func TestNonExecutableBinaryFailsTask(t *testing.T) {
 	_ = submitAndAssert(t, td, payload, "failed", "failed")
 }
 
+// Requesting a payload feature that is not listed in config setting
+// enabledFeatures should resolve as malformed-payload
+func TestPayloadFeatureNotEnabled(t *testing.T) {
+	defer setup(t)()
+	config.EnabledFeatures = []string{"chainOfTrust"}
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 10,
+		Features: FeatureFlags{
+			TaskclusterProxy: true,
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	logtext := string(bytes)
+	if !strings.Contains(logtext, `enabledFeatures would need to include "taskclusterProxy"`) {
+		t.Fatalf("Was expecting log to say that taskclusterProxy is not enabled, but it doesn't:\n%v", logtext)
+	}
+}
+
 // TestRemoveTaskDirs creates a temp directory containing files and folders
 // whose names begin with 'task_', other files and folders that don't, then
 // calls removeTaskDirs(tempDir), and tests that only folders that started with
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// MaintenanceScheduler runs the configured maintenance jobs (e.g. cache
+// garbage collection, docker image pruning, SSD trimming, OS update checks)
+// while the worker is idle. At most one job runs at a time. When a task is
+// claimed, the running job is killed so that the task has the machine to
+// itself, and since the job did not complete, it is run again the next time
+// the worker is idle.
+type MaintenanceScheduler struct {
+	sync.Mutex
+	jobs      []gwconfig.MaintenanceJob
+	afterIdle time.Duration
+	logDir    string
+	lastRun   map[string]time.Time
+	running   *maintenanceRun
+}
+
+type maintenanceRun struct {
+	job     gwconfig.MaintenanceJob
+	cmd     *exec.Cmd
+	started time.Time
+	paused  bool
+	done    chan struct{}
+}
+
+// NewMaintenanceScheduler returns a scheduler for the given jobs, that only
+// runs them once the worker has been idle for afterIdle, and writes the
+// output of job <name> to <logDir>/<name>.log.
+func NewMaintenanceScheduler(jobs []gwconfig.MaintenanceJob, afterIdle time.Duration, logDir string) *MaintenanceScheduler {
+	return &MaintenanceScheduler{
+		jobs:      jobs,
+		afterIdle: afterIdle,
+		logDir:    logDir,
+		lastRun:   map[string]time.Time{},
+	}
+}
+
+// Idle informs the scheduler that the worker has been idle for idleTime. If
+// that is long enough, and no job is already running, the first job that is
+// due is started in the background.
+func (ms *MaintenanceScheduler) Idle(idleTime time.Duration) {
+	if idleTime < ms.afterIdle {
+		return
+	}
+	ms.Lock()
+	defer ms.Unlock()
+	if ms.running != nil {
+		return
+	}
+	for _, job := range ms.jobs {
+		// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+		if lastRun, ran := ms.lastRun[job.Name]; ran && time.Now().Round(0).Sub(lastRun) < time.Duration(job.IntervalSecs)*time.Second {
+			continue
+		}
+		err := ms.start(job)
+		if err != nil {
+			log.Printf("WARNING: could not start maintenance job %q: %v", job.Name, err)
+			// don't retry until the job is next due
+			ms.lastRun[job.Name] = time.Now()
+			continue
+		}
+		return
+	}
+}
+
+// Pause kills the running maintenance job, if there is one, and waits for it
+// to exit. It is called as soon as a task is claimed.
+func (ms *MaintenanceScheduler) Pause() {
+	ms.Lock()
+	run := ms.running
+	if run == nil {
+		ms.Unlock()
+		return
+	}
+	run.paused = true
+	ms.Unlock()
+	err := killMaintenanceJob(run.cmd)
+	if err != nil {
+		log.Printf("WARNING: could not kill maintenance job %q: %v", run.job.Name, err)
+	}
+	<-run.done
+}
+
+// start must be called with the lock held
+func (ms *MaintenanceScheduler) start(job gwconfig.MaintenanceJob) error {
+	err := os.MkdirAll(ms.logDir, 0755)
+	if err != nil {
+		return err
+	}
+	logFile, err := os.Create(filepath.Join(ms.logDir, job.Name+".log"))
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(job.Command[0], job.Command[1:]...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	setMaintenanceProcessGroup(cmd)
+	err = cmd.Start()
+	if err != nil {
+		logFile.Close()
+		return err
+	}
+	run := &maintenanceRun{
+		job:     job,
+		cmd:     cmd,
+		started: time.Now(),
+		done:    make(chan struct{}),
+	}
+	ms.running = run
+	log.Printf("Started maintenance job %q: %q (output in %v)", job.Name, job.Command, logFile.Name())
+	go ms.wait(run, logFile)
+	return nil
+}
+
+// wait waits for the given maintenance job to exit, killing it if it exceeds
+// its time budget, and then records the outcome
+func (ms *MaintenanceScheduler) wait(run *maintenanceRun, logFile *os.File) {
+	defer close(run.done)
+	exited := make(chan error, 1)
+	go func() {
+		exited <- run.cmd.Wait()
+	}()
+	var budget <-chan time.Time
+	if run.job.MaxRunTimeSecs > 0 {
+		timer := time.NewTimer(time.Duration(run.job.MaxRunTimeSecs) * time.Second)
+		defer timer.Stop()
+		budget = timer.C
+	}
+	var err error
+	exceededBudget := false
+	select {
+	case err = <-exited:
+	case <-budget:
+		exceededBudget = true
+		killErr := killMaintenanceJob(run.cmd)
+		if killErr != nil {
+			log.Printf("WARNING: could not kill maintenance job %q: %v", run.job.Name, killErr)
+		}
+		err = <-exited
+	}
+	logFile.Close()
+	duration := time.Since(run.started)
+
+	ms.Lock()
+	defer ms.Unlock()
+	ms.running = nil
+	switch {
+	case run.paused:
+		log.Printf("Paused maintenance job %q after %v, since a task was claimed", run.job.Name, duration)
+		return
+	case exceededBudget:
+		log.Printf("WARNING: maintenance job %q exceeded its time budget of %v seconds, and was killed", run.job.Name, run.job.MaxRunTimeSecs)
+	case err != nil:
+		log.Printf("WARNING: maintenance job %q failed after %v: %v", run.job.Name, duration, err)
+	default:
+		log.Printf("Maintenance job %q completed in %v", run.job.Name, duration)
+	}
+	ms.lastRun[run.job.Name] = time.Now()
+}
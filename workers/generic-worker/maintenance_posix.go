@@ -0,0 +1,23 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setMaintenanceProcessGroup runs the maintenance job in its own process
+// group, so that any processes it spawns are also killed when it is
+func setMaintenanceProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killMaintenanceJob(cmd *exec.Cmd) error {
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	// process group may already have exited
+	if err == syscall.ESRCH {
+		return nil
+	}
+	return err
+}
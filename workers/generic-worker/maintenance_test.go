@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func longRunningMaintenanceCommand() []string {
+	if runtime.GOOS == "windows" {
+		return []string{"ping.exe", "-n", "60", "127.0.0.1"}
+	}
+	return []string{"sleep", "60"}
+}
+
+func maintenanceLogDir(t *testing.T) (dir string, teardown func()) {
+	dir, err := ioutil.TempDir("", "maintenance")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	return dir, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func (ms *MaintenanceScheduler) runningJob() *maintenanceRun {
+	ms.Lock()
+	defer ms.Unlock()
+	return ms.running
+}
+
+func TestMaintenanceJobPausedWhenTaskClaimed(t *testing.T) {
+	logDir, teardown := maintenanceLogDir(t)
+	defer teardown()
+	job := gwconfig.MaintenanceJob{
+		Name:         "sleep",
+		Command:      longRunningMaintenanceCommand(),
+		IntervalSecs: 3600,
+	}
+	ms := NewMaintenanceScheduler([]gwconfig.MaintenanceJob{job}, 10*time.Second, logDir)
+
+	ms.Idle(5 * time.Second)
+	if ms.runningJob() != nil {
+		t.Fatal("Maintenance job started before worker was idle for long enough")
+	}
+	ms.Idle(10 * time.Second)
+	if ms.runningJob() == nil {
+		t.Fatal("Maintenance job not started when worker was idle")
+	}
+
+	start := time.Now()
+	ms.Pause()
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("Took %v to pause maintenance job", d)
+	}
+	if ms.runningJob() != nil {
+		t.Fatal("Maintenance job still running after being paused")
+	}
+
+	// paused job didn't complete, so should run again even though its
+	// interval hasn't elapsed
+	ms.Idle(10 * time.Second)
+	if ms.runningJob() == nil {
+		t.Fatal("Paused maintenance job not restarted when worker was next idle")
+	}
+	ms.Pause()
+}
+
+func TestMaintenanceJobTimeBudget(t *testing.T) {
+	logDir, teardown := maintenanceLogDir(t)
+	defer teardown()
+	job := gwconfig.MaintenanceJob{
+		Name:           "sleep",
+		Command:        longRunningMaintenanceCommand(),
+		IntervalSecs:   3600,
+		MaxRunTimeSecs: 1,
+	}
+	ms := NewMaintenanceScheduler([]gwconfig.MaintenanceJob{job}, 0, logDir)
+
+	ms.Idle(0)
+	run := ms.runningJob()
+	if run == nil {
+		t.Fatal("Maintenance job not started when worker was idle")
+	}
+	select {
+	case <-run.done:
+	case <-time.After(30 * time.Second):
+		ms.Pause()
+		t.Fatal("Maintenance job not killed after exceeding its time budget")
+	}
+
+	// job ran, so shouldn't run again until its interval has elapsed
+	ms.Idle(0)
+	if ms.runningJob() != nil {
+		ms.Pause()
+		t.Fatal("Maintenance job run again before its interval elapsed")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+func setMaintenanceProcessGroup(cmd *exec.Cmd) {
+}
+
+func killMaintenanceJob(cmd *exec.Cmd) error {
+	// here we use taskkill.exe rather than cmd.Process.Kill() since we want child processes also to be killed
+	out, err := host.CombinedOutput("taskkill.exe", "/pid", strconv.Itoa(cmd.Process.Pid), "/f", "/t")
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, out)
+	}
+	return nil
+}
@@ -0,0 +1,281 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	sysinfo "github.com/elastic/go-sysinfo"
+	"github.com/elastic/go-sysinfo/types"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const memorySnapshotArtifactName = "public/logs/memory-snapshot.json"
+
+// path, relative to task directory, of the memory snapshot
+var memorySnapshotPath = filepath.Join("generic-worker", "memory-snapshot.json")
+
+type (
+	// MemoryWatchdogFeature aborts tasks whose processes use more memory than
+	// config setting memoryWatchdogMaxTaskRSSMB allows, or that leave the
+	// system with less available memory than memoryWatchdogMinAvailableMB,
+	// before the kernel starts killing processes, which could include the
+	// worker itself
+	MemoryWatchdogFeature struct {
+	}
+
+	MemoryWatchdogTask struct {
+		task *TaskRun
+		// closed by Stop
+		stop chan struct{}
+		done chan struct{}
+		// set when the watchdog has written a memory snapshot
+		mutex    sync.Mutex
+		snapshot bool
+	}
+
+	// memorySnapshot is the content of the memory snapshot artifact
+	memorySnapshot struct {
+		Reason        string                  `json:"reason"`
+		Time          time.Time               `json:"time"`
+		TaskRSSBytes  uint64                  `json:"taskRSSBytes"`
+		Host          *types.HostMemoryInfo   `json:"host"`
+		TaskProcesses []memorySnapshotProcess `json:"taskProcesses"`
+	}
+
+	memorySnapshotProcess struct {
+		PID      int      `json:"pid"`
+		PPID     int      `json:"ppid"`
+		Name     string   `json:"name"`
+		Args     []string `json:"args"`
+		RSSBytes uint64   `json:"rssBytes"`
+	}
+)
+
+func (feature *MemoryWatchdogFeature) Name() string {
+	return "Memory Watchdog"
+}
+
+func (feature *MemoryWatchdogFeature) Initialise() error {
+	if config.MemoryWatchdogMaxTaskRSSMB == 0 && config.MemoryWatchdogMinAvailableMB == 0 {
+		return nil
+	}
+	if config.MemoryWatchdogIntervalSecs == 0 {
+		return fmt.Errorf("config setting memoryWatchdogIntervalSecs must be non-zero when the memory watchdog is enabled")
+	}
+	if _, err := sysinfo.Processes(); err != nil {
+		return fmt.Errorf("memory watchdog is not supported on this platform, so config settings memoryWatchdogMaxTaskRSSMB and memoryWatchdogMinAvailableMB must be 0: %v", err)
+	}
+	return nil
+}
+
+func (feature *MemoryWatchdogFeature) PersistState() error {
+	return nil
+}
+
+func (feature *MemoryWatchdogFeature) IsEnabled(task *TaskRun) bool {
+	return config.MemoryWatchdogMaxTaskRSSMB != 0 || config.MemoryWatchdogMinAvailableMB != 0
+}
+
+func (feature *MemoryWatchdogFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &MemoryWatchdogTask{
+		task: task,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (mwt *MemoryWatchdogTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (mwt *MemoryWatchdogTask) ReservedArtifacts() []string {
+	return []string{
+		memorySnapshotArtifactName,
+	}
+}
+
+func (mwt *MemoryWatchdogTask) Start() *CommandExecutionError {
+	go func() {
+		defer close(mwt.done)
+		ticker := time.NewTicker(time.Duration(config.MemoryWatchdogIntervalSecs) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-mwt.stop:
+				return
+			case <-ticker.C:
+				if mwt.check() {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func (mwt *MemoryWatchdogTask) Stop(err *ExecutionErrors) {
+	close(mwt.stop)
+	<-mwt.done
+	mwt.mutex.Lock()
+	defer mwt.mutex.Unlock()
+	if !mwt.snapshot {
+		return
+	}
+	err.add(mwt.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    memorySnapshotArtifactName,
+				Expires: mwt.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            memorySnapshotPath,
+		},
+	))
+}
+
+// check samples the memory of the task and the system, and aborts the task if
+// a threshold has been crossed, returning true if it did so
+func (mwt *MemoryWatchdogTask) check() bool {
+	processes, err := sysinfo.Processes()
+	if err != nil {
+		mwt.task.Warnf("[memory watchdog] Could not list processes: %v", err)
+		return false
+	}
+	host, err := sysinfo.Host()
+	if err != nil {
+		mwt.task.Warnf("[memory watchdog] Could not query host memory: %v", err)
+		return false
+	}
+	hostMemory, err := host.Memory()
+	if err != nil {
+		mwt.task.Warnf("[memory watchdog] Could not query host memory: %v", err)
+		return false
+	}
+	roots := []int{}
+	for _, command := range mwt.task.Commands {
+		if command == nil {
+			continue
+		}
+		if pid := command.PID(); pid != 0 {
+			roots = append(roots, pid)
+		}
+	}
+	taskProcesses := descendantProcesses(snapshotProcesses(processes), roots)
+	taskRSS := uint64(0)
+	for _, p := range taskProcesses {
+		taskRSS += p.RSSBytes
+	}
+	reason := memoryThresholdCrossed(taskRSS, hostMemory.Available)
+	if reason == "" {
+		return false
+	}
+	mwt.task.Warnf("[memory watchdog] %v - aborting task before the system runs out of memory", reason)
+	mwt.writeSnapshot(&memorySnapshot{
+		Reason:        reason,
+		Time:          time.Now(),
+		TaskRSSBytes:  taskRSS,
+		Host:          hostMemory,
+		TaskProcesses: taskProcesses,
+	})
+	err = mwt.task.StatusManager.Abort(Failure(fmt.Errorf("Task aborted - %v", reason)))
+	if err != nil {
+		mwt.task.Warnf("[memory watchdog] Error when aborting task: %v", err)
+	}
+	return true
+}
+
+func (mwt *MemoryWatchdogTask) writeSnapshot(snapshot *memorySnapshot) {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	file := filepath.Join(taskContext.TaskDir, memorySnapshotPath)
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err == nil {
+		err = ioutil.WriteFile(file, data, 0600)
+	}
+	if err != nil {
+		mwt.task.Warnf("[memory watchdog] Could not write memory snapshot %v: %v", file, err)
+		return
+	}
+	mwt.mutex.Lock()
+	defer mwt.mutex.Unlock()
+	mwt.snapshot = true
+}
+
+// memoryThresholdCrossed returns which memory watchdog threshold has been
+// crossed, or the empty string if none have been
+func memoryThresholdCrossed(taskRSS, available uint64) string {
+	if max := uint64(config.MemoryWatchdogMaxTaskRSSMB) << 20; max != 0 && taskRSS > max {
+		return fmt.Sprintf("task processes use %v MB of memory, which exceeds the limit of %v MB", taskRSS>>20, config.MemoryWatchdogMaxTaskRSSMB)
+	}
+	if min := uint64(config.MemoryWatchdogMinAvailableMB) << 20; min != 0 && available < min {
+		return fmt.Sprintf("system has %v MB of available memory, which is below the minimum of %v MB", available>>20, config.MemoryWatchdogMinAvailableMB)
+	}
+	return ""
+}
+
+// snapshotProcesses returns the details of the given processes, skipping
+// processes that exit while being queried
+func snapshotProcesses(processes []types.Process) []memorySnapshotProcess {
+	snapshots := []memorySnapshotProcess{}
+	for _, p := range processes {
+		info, err := p.Info()
+		if err != nil {
+			continue
+		}
+		memory, err := p.Memory()
+		if err != nil {
+			continue
+		}
+		snapshots = append(snapshots, memorySnapshotProcess{
+			PID:      info.PID,
+			PPID:     info.PPID,
+			Name:     info.Name,
+			Args:     info.Args,
+			RSSBytes: memory.Resident,
+		})
+	}
+	return snapshots
+}
+
+// descendantProcesses returns the processes with the given PIDs and all of
+// their descendants, ordered by PID
+func descendantProcesses(processes []memorySnapshotProcess, roots []int) []memorySnapshotProcess {
+	children := map[int][]int{}
+	byPID := map[int]memorySnapshotProcess{}
+	for _, p := range processes {
+		byPID[p.PID] = p
+		if p.PPID != p.PID {
+			children[p.PPID] = append(children[p.PPID], p.PID)
+		}
+	}
+	seen := map[int]bool{}
+	result := []memorySnapshotProcess{}
+	pending := append([]int{}, roots...)
+	for len(pending) > 0 {
+		pid := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if seen[pid] {
+			continue
+		}
+		seen[pid] = true
+		if p, exists := byPID[pid]; exists {
+			result = append(result, p)
+		}
+		pending = append(pending, children[pid]...)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].PID < result[j].PID
+	})
+	return result
+}
@@ -0,0 +1,53 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestDescendantProcesses(t *testing.T) {
+	processes := []memorySnapshotProcess{
+		{PID: 1, PPID: 0},
+		{PID: 10, PPID: 1},
+		{PID: 11, PPID: 10},
+		{PID: 12, PPID: 11},
+		{PID: 20, PPID: 1},
+		{PID: 21, PPID: 20},
+	}
+	got := []int{}
+	for _, p := range descendantProcesses(processes, []int{10, 99}) {
+		got = append(got, p.PID)
+	}
+	if expected := []int{10, 11, 12}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Was expecting processes %v but got %v", expected, got)
+	}
+}
+
+func TestMemoryThresholdCrossed(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			MemoryWatchdogMaxTaskRSSMB:   100,
+			MemoryWatchdogMinAvailableMB: 50,
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	for _, test := range []struct {
+		taskRSS   uint64
+		available uint64
+		crossed   bool
+	}{
+		{taskRSS: 99 << 20, available: 51 << 20, crossed: false},
+		{taskRSS: 101 << 20, available: 51 << 20, crossed: true},
+		{taskRSS: 1 << 20, available: 49 << 20, crossed: true},
+	} {
+		if reason := memoryThresholdCrossed(test.taskRSS, test.available); (reason != "") != test.crossed {
+			t.Errorf("Task RSS %v, available %v: was expecting threshold crossed to be %v, but got reason %q", test.taskRSS, test.available, test.crossed, reason)
+		}
+	}
+}
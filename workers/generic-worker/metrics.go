@@ -8,6 +8,12 @@ import (
 )
 
 func logEvent(eventType string, task *TaskRun, timestamp time.Time) {
+	logEventWithFields(eventType, task, timestamp, nil)
+}
+
+// logEventWithFields logs an event like logEvent, with additional event
+// specific fields
+func logEventWithFields(eventType string, task *TaskRun, timestamp time.Time, extra map[string]interface{}) {
 	fields := map[string]interface{}{
 		"eventType":    eventType,
 		"worker":       "generic-worker",
@@ -23,6 +29,10 @@ func logEvent(eventType string, task *TaskRun, timestamp time.Time) {
 		fields["runId"] = task.RunID
 	}
 
+	for k, v := range extra {
+		fields[k] = v
+	}
+
 	j, err := json.Marshal(fields)
 	if err != nil {
 		log.Printf("Error encoding working metrics: %v", err)
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"sync"
 	"time"
 
@@ -25,6 +26,9 @@ type (
 		Status    TaskStatus              `json:"-"`
 		Commands  []*process.Command      `json:"-"`
 		// not exported
+		// guards Artifacts, since features may upload artifacts while the
+		// task commands run
+		artifactsMux   sync.Mutex
 		logMux         sync.RWMutex
 		logWriter      io.Writer
 		queueMux       sync.RWMutex
@@ -42,6 +46,71 @@ type (
 		// be useful for the user. Normally this map would get appended to by
 		// features when they are started.
 		featureArtifacts map[string]string
+		// The concrete tasks that index namespaces referenced in
+		// task.payload.fetches resolved to when the task started, so that
+		// they can be recorded in the chain of trust certificate.
+		resolvedFetches []ResolvedFetch
+		// Resources consumed by the task, for cost accounting.
+		resourceUsage ResourceUsage
+		// Set by the Result Cache feature to the taskId of an identical
+		// earlier task whose artifacts have been reused, in which case the
+		// task commands are not run.
+		resultCacheTaskID string
+		// Set by the Result Cache feature to the hash of the task, once the
+		// task has run successfully, for the task history database and the
+		// index (see recordResultCache).
+		resultCacheHash string
+		// Set by the Supersede feature to the tasks that the task
+		// supersedes, for the task history database.
+		supersedes []string
+		// Number of mounts whose content was, and was not, already cached
+		// by the worker, for the task history database.
+		cacheHits   int
+		cacheMisses int
+		// Bandwidth throttles that downloads and uploads made on behalf of
+		// the task are subject to.
+		downloadThrottles []*Throttle
+		uploadThrottles   []*Throttle
+		// Functions that features register in Start() to be called when the
+		// task is aborted, before the task commands are killed.
+		beforeKill []func()
+		// Functions that features register in Start() to be called before
+		// and after each task command is executed.
+		beforeCommand []func(index int)
+		afterCommand  []func(index int, result *process.Result)
+		// Compiled task.payload.rerun.logPatterns.
+		rerunPatterns []*regexp.Regexp
+		// env vars that features set with setVariable, for the task
+		// environment artifact
+		featureEnv map[string]string
+		// secret values that are redacted from the task log, and from the
+		// task environment artifact
+		redactions []string
+		// CPU architecture that the task runs as, from
+		// task.payload.architectures, or the native architecture of the
+		// worker.
+		architecture string
+		// Ports leased to the task, for the duration of the task.
+		leasedPorts []*portLease
+		// Violations of the payload schema, if the task payload is invalid,
+		// which are published as a task artifact.
+		payloadViolations []PayloadViolation
+		// SHA256 of the machine inventory published when the task started,
+		// if machine inventory is enabled, for the chain of trust
+		// certificate.
+		machineInventorySHA256 string
+		// Resolved settings of task.payload.reproducible, if present, for
+		// the chain of trust certificate.
+		reproducible *ReproducibleSettings
+		// Key IDs of the artifacts that the Artifact Signing feature
+		// signed, by artifact name, for the chain of trust certificate.
+		artifactSignatures map[string]string
+		// Records the significant actions of the task, if the worker config
+		// enables audit trails.
+		auditTrail *AuditTrail
+		// Uploaded artifacts that are copied to the artifact mirror once
+		// the task has been resolved, guarded by artifactsMux.
+		mirroredArtifacts []*MirroredArtifact
 	}
 
 	TaskStatus       string
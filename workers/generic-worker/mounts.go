@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -42,6 +45,13 @@ var (
 	lastQueriedPurgeCacheService time.Time
 )
 
+const (
+	// scope required by tasks in order to mount a writable cache
+	cacheScope scopes.Pattern = "generic-worker:cache:<cacheName>"
+	// scope required by tasks in order to mount non-public artifacts
+	artifactScope scopes.Pattern = "queue:get-artifact:<artifactName>"
+)
+
 type (
 	CacheMap map[string]*Cache
 )
@@ -61,6 +71,9 @@ type Cache struct {
 	Created time.Time `json:"created"`
 	// the full path to the cache on disk (could be file or directory)
 	Location string `json:"location"`
+	// whether a writable directory cache is stored as a cache archive (see
+	// cache_archive.go) at Location, rather than as a directory
+	Archive bool `json:"archive,omitempty"`
 	// the number of times this cache has been included in a MountEntry on a
 	// task run on this worker
 	Hits int `json:"hits"`
@@ -72,6 +85,17 @@ type Cache struct {
 	Key string `json:"key"`
 	// SHA256 of content, if a file (not used for directories)
 	SHA256 string `json:"sha256"`
+	// HTTP validators of url content, for checking whether the content has
+	// changed since it was downloaded
+	Validators *HTTPValidators `json:"validators,omitempty"`
+}
+
+// HTTPValidators are the response headers of a download that allow later
+// requests for the same url to be made conditional on the content having
+// changed. See https://tools.ietf.org/html/rfc7232
+type HTTPValidators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
 }
 
 // Rating determines how valuable the file cache is compared to other file
@@ -91,8 +115,9 @@ func (cache *Cache) Expunge(task *TaskRun) error {
 	if task != nil {
 		task.Infof("[mounts] Deleting cache %v file(s) at %v", cache.Key, cache.Location)
 	}
-	// delete the cache on the file system
-	return os.RemoveAll(cache.Location)
+	// delete the cache on the file system, which may contain paths that are
+	// too long for Windows without the extended-length prefix
+	return os.RemoveAll(fileutil.LongPath(cache.Location))
 }
 
 // Represents the Mounts feature as a whole - one global instance
@@ -169,7 +194,7 @@ type TaskMount struct {
 	// payload errors are detected when creating feature but only reported when
 	// feature starts, so need to keep hold of any error raised...
 	payloadError      error
-	requiredScopes    scopes.Required
+	requiredScopes    scopes.AllOf
 	referencedTaskIDs map[string]bool // simple implementation of set of strings
 }
 
@@ -179,7 +204,7 @@ type MountEntry interface {
 	Mount(task *TaskRun) error
 	Unmount(task *TaskRun) error
 	FSContent() (FSContent, error)
-	RequiredScopes() []string
+	RequiredScopes() scopes.Expression
 }
 
 // FSContent represents file system content - it is based on the auto-generated
@@ -187,9 +212,9 @@ type MountEntry interface {
 // URLContent, RawContent or Base64Content concrete types. This is the
 // interface which represents these underlying concrete types.
 type FSContent interface {
-	// Keep it simple and just return a []string, rather than scopes.Required
-	// since currently no easy way to "AND" scopes.Required types.
-	RequiredScopes() []string
+	// Scopes required in order to use the content, in addition to the scopes
+	// required by the mount.
+	RequiredScopes() scopes.Expression
 	// Download the content, and return the absolute location of the file. No
 	// archive extraction is performed.
 	Download(task *TaskRun) (file string, sha256 string, err error)
@@ -205,25 +230,25 @@ type FSContent interface {
 }
 
 // No scopes required to mount files/dirs in a task
-func (uc *URLContent) RequiredScopes() []string {
-	return []string{}
+func (uc *URLContent) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
 }
 
 // Scopes queue:get-artifact:<artifact-name> required for non public/ artifacts
-func (ac *ArtifactContent) RequiredScopes() []string {
+func (ac *ArtifactContent) RequiredScopes() scopes.Expression {
 	if strings.HasPrefix(ac.Artifact, "public/") {
-		return []string{}
+		return scopes.AllOf{}
 	}
-	return []string{"queue:get-artifact:" + ac.Artifact}
+	return artifactScope.Scope("artifactName", ac.Artifact)
 }
 
 //No scopes required to mount files in a task
-func (rc *RawContent) RequiredScopes() []string {
-	return []string{}
+func (rc *RawContent) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
 }
 
-func (bc *Base64Content) RequiredScopes() []string {
-	return []string{}
+func (bc *Base64Content) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
 }
 
 // Since mounts are protected by scopes per mount, no reason to have
@@ -260,6 +285,24 @@ func (feature *MountsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 		default:
 			tm.payloadError = fmt.Errorf("Unrecognised mount entry in payload - %#v", m)
 		}
+		for _, key := range []string{"directory", "file"} {
+			if path, isString := m[key].(string); isString && tm.payloadError == nil {
+				if err := fileutil.ValidatePath(path); err != nil {
+					tm.payloadError = fmt.Errorf("Invalid %v of task mount %v: %v", key, i, err)
+				}
+			}
+		}
+		if paths, isArray := m["paths"].([]interface{}); isArray && tm.payloadError == nil {
+			for _, p := range paths {
+				// the payload schema ensures that paths are strings
+				path, _ := p.(string)
+				if !withinTaskDirectory(path) {
+					tm.payloadError = fmt.Errorf("Invalid paths of task mount %v: %q is not a relative path inside the cache directory", i, path)
+				} else if err := fileutil.ValidatePath(path); err != nil {
+					tm.payloadError = fmt.Errorf("Invalid paths of task mount %v: %v", i, err)
+				}
+			}
+		}
 	}
 	tm.initRequiredScopes()
 	tm.initReferencedTaskIDs()
@@ -279,16 +322,16 @@ func (taskMount *TaskMount) Unmarshal(rm json.RawMessage, m MountEntry) {
 // we do this in advance in case there is an error, we can report it upfront
 // when we initialise, rather than later when we go to check what scopes are
 // needed.
-func (taskMount *TaskMount) RequiredScopes() scopes.Required {
+func (taskMount *TaskMount) RequiredScopes() scopes.Expression {
 	return taskMount.requiredScopes
 }
 
 // loops through all referenced mounts and checks what scopes are required to
 // mount them
 func (taskMount *TaskMount) initRequiredScopes() {
-	requiredScopes := []string{}
+	requiredScopes := scopes.AllOf{}
 	for _, mount := range taskMount.mounts {
-		requiredScopes = append(requiredScopes, mount.RequiredScopes()...)
+		requiredScopes = append(requiredScopes, mount.RequiredScopes())
 		fsContent, err := mount.FSContent()
 		if err != nil {
 			taskMount.payloadError = err
@@ -296,10 +339,10 @@ func (taskMount *TaskMount) initRequiredScopes() {
 		}
 		// A writable cache might not be preloaded so might have no initial content
 		if fsContent != nil {
-			requiredScopes = append(requiredScopes, fsContent.RequiredScopes()...)
+			requiredScopes = append(requiredScopes, fsContent.RequiredScopes())
 		}
 	}
-	taskMount.requiredScopes = scopes.Required{requiredScopes}
+	taskMount.requiredScopes = requiredScopes
 }
 
 // loops through all referenced mounts and keeps a list of referenced TaskIDs
@@ -370,6 +413,7 @@ func (taskMount *TaskMount) Start() *CommandExecutionError {
 		if err != nil {
 			return Failure(fmt.Errorf("[mounts] %s", err))
 		}
+		taskMount.task.auditMount(mount)
 		taskMount.mounted = append(taskMount.mounted, mount)
 	}
 	return nil
@@ -394,8 +438,8 @@ func (taskMount *TaskMount) Stop(err *ExecutionErrors) {
 
 // Writable caches require scope generic-worker:cache:<cacheName>. Preloaded
 // caches from an artifact may also require scopes - handled separately.
-func (w *WritableDirectoryCache) RequiredScopes() []string {
-	return []string{"generic-worker:cache:" + w.CacheName}
+func (w *WritableDirectoryCache) RequiredScopes() scopes.Expression {
+	return cacheScope.Scope("cacheName", w.CacheName)
 }
 
 // FSContent returns either a *URLContent *ArtifactContent, *RawContent or *Base64Content
@@ -410,8 +454,8 @@ func (w *WritableDirectoryCache) FSContent() (FSContent, error) {
 
 // No scopes directly required for a ReadOnlyDirectory (scopes may be required
 // for its content though - handled separately)
-func (r *ReadOnlyDirectory) RequiredScopes() []string {
-	return []string{}
+func (r *ReadOnlyDirectory) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
 }
 
 // FSContent returns either a *URLContent, *ArtifactContent, *RawContent or
@@ -422,8 +466,8 @@ func (r *ReadOnlyDirectory) FSContent() (FSContent, error) {
 
 // No scopes directly required for a FileMount (scopes may be required for its
 // content though - handled separately)
-func (f *FileMount) RequiredScopes() []string {
-	return []string{}
+func (f *FileMount) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
 }
 
 // FSContent returns either a *URLContent, *ArtifactContent, *RawContent or
@@ -434,24 +478,40 @@ func (f *FileMount) FSContent() (FSContent, error) {
 
 func (w *WritableDirectoryCache) Mount(task *TaskRun) error {
 	target := filepath.Join(taskContext.TaskDir, w.Directory)
+	cache, dirCacheExists := directoryCaches[w.CacheName]
+	if len(w.Paths) > 0 || dirCacheExists && cache.Archive {
+		err := checkZstd()
+		if err != nil {
+			return fmt.Errorf("Cannot mount writable directory cache %v: %v", w.CacheName, err)
+		}
+	}
 	// cache already there?
-	if _, dirCacheExists := directoryCaches[w.CacheName]; dirCacheExists {
+	if dirCacheExists {
 		// bump counter
-		directoryCaches[w.CacheName].Hits++
-		// move it into place...
-		src := directoryCaches[w.CacheName].Location
-		parentDir := filepath.Dir(target)
-		task.Infof("[mounts] Moving existing writable directory cache %v from %v to %v", w.CacheName, src, target)
-		MkdirAllOrDie(task, parentDir, 0700)
-		err := RenameCrossDevice(src, target)
-		if err != nil {
-			panic(fmt.Errorf("[mounts] Not able to rename dir %v as %v: %v", src, target, err))
+		cache.Hits++
+		task.cacheHits++
+		if cache.Archive {
+			err := w.extractArchive(task, cache, target)
+			if err != nil {
+				return err
+			}
+		} else {
+			// move it into place...
+			src := cache.Location
+			parentDir := filepath.Dir(target)
+			task.Infof("[mounts] Moving existing writable directory cache %v from %v to %v", w.CacheName, src, target)
+			MkdirAllOrDie(task, parentDir, 0700)
+			err := RenameCrossDevice(src, target)
+			if err != nil {
+				panic(fmt.Errorf("[mounts] Not able to rename dir %v as %v: %v", src, target, err))
+			}
 		}
 	} else {
 		// new cache, let's initialise it...
 		basename := slugid.Nice()
 		file := filepath.Join(config.CachesDir, basename)
 		task.Infof("[mounts] No existing writable directory cache '%v' - creating %v", w.CacheName, file)
+		task.cacheMisses++
 		directoryCaches[w.CacheName] = &Cache{
 			Hits:     1,
 			Created:  time.Now(),
@@ -486,8 +546,59 @@ func (w *WritableDirectoryCache) Mount(task *TaskRun) error {
 	return nil
 }
 
+// extractArchive extracts the paths of the task mount from the cache archive
+// of the given cache to the target directory, or the whole cache archive if
+// the task mount has no paths, in which case the cache is stored as a
+// directory again when the task has finished.
+func (w *WritableDirectoryCache) extractArchive(task *TaskRun, cache *Cache, target string) error {
+	if len(w.Paths) > 0 {
+		task.Infof("[mounts] Extracting paths %q of archived writable directory cache %v from %v to %v", w.Paths, w.CacheName, cache.Location, target)
+	} else {
+		task.Infof("[mounts] Extracting archived writable directory cache %v from %v to %v", w.CacheName, cache.Location, target)
+	}
+	err := MkdirAll(task, target, 0700)
+	if err != nil {
+		return err
+	}
+	ca, err := openCacheArchive(cache.Location)
+	if err != nil {
+		return w.expungeArchive(task, cache, err)
+	}
+	extracted, err := ca.extract(target, w.Paths)
+	closeErr := ca.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return w.expungeArchive(task, cache, err)
+	}
+	task.Infof("[mounts] Extracted %v of %v entries of archived writable directory cache %v", extracted, len(ca.index.Entries), w.CacheName)
+	if len(w.Paths) == 0 {
+		err = os.Remove(cache.Location)
+		if err != nil {
+			panic(err)
+		}
+		cache.Location = filepath.Join(config.CachesDir, slugid.Nice())
+		cache.Archive = false
+	}
+	return nil
+}
+
+// expungeArchive removes a cache archive that cannot be extracted, since it
+// is of no use to later tasks either
+func (w *WritableDirectoryCache) expungeArchive(task *TaskRun, cache *Cache, err error) error {
+	expungeErr := cache.Expunge(task)
+	if expungeErr != nil {
+		panic(expungeErr)
+	}
+	return fmt.Errorf("Could not extract archived writable directory cache %v: %v", w.CacheName, err)
+}
+
 func (w *WritableDirectoryCache) Unmount(task *TaskRun) error {
 	cache := directoryCaches[w.CacheName]
+	if len(w.Paths) > 0 {
+		return w.archive(task, cache)
+	}
 	cacheDir := cache.Location
 	taskCacheDir := filepath.Join(taskContext.TaskDir, w.Directory)
 	task.Infof("[mounts] Preserving cache: Moving %q to %q", taskCacheDir, cacheDir)
@@ -536,6 +647,49 @@ func (w *WritableDirectoryCache) Unmount(task *TaskRun) error {
 	return nil
 }
 
+// archive preserves a cache that was mounted with paths as a cache archive
+// (see cache_archive.go) of the cache directory of the task, together with
+// the other paths of the previous cache archive, if there was one.
+func (w *WritableDirectoryCache) archive(task *TaskRun, cache *Cache) error {
+	taskCacheDir := filepath.Join(taskContext.TaskDir, w.Directory)
+	file := filepath.Join(config.CachesDir, slugid.Nice()+".tar.zst")
+	task.Infof("[mounts] Preserving cache: Archiving %q to %q", taskCacheDir, file)
+	var old *cacheArchive
+	var err error
+	if cache.Archive {
+		old, err = openCacheArchive(cache.Location)
+	}
+	if err == nil {
+		err = writeCacheArchive(file, taskCacheDir, old, w.Paths)
+	}
+	if old != nil {
+		old.Close()
+	}
+	if err != nil {
+		// as when the cache directory cannot be moved (see Unmount), assume
+		// that this is a task problem, such as the task replacing files of
+		// the cache while archiving them, or removing the cache directory
+		removeErr := os.RemoveAll(file)
+		expungeErr := cache.Expunge(task)
+		if removeErr != nil {
+			panic(removeErr)
+		}
+		if expungeErr != nil {
+			panic(expungeErr)
+		}
+		return Failure(fmt.Errorf("Could not persist cache %q due to %v", cache.Key, err))
+	}
+	if cache.Archive {
+		err = os.Remove(cache.Location)
+		if err != nil {
+			panic(err)
+		}
+	}
+	cache.Location = file
+	cache.Archive = true
+	return nil
+}
+
 func (r *ReadOnlyDirectory) Mount(task *TaskRun) error {
 	c, err := FSContentFrom(r.Content)
 	if err != nil {
@@ -615,10 +769,17 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 		}
 		if requiredSHA256 == "" {
 			task.Warnf("[mounts] No SHA256 specified in task mounts for %v - SHA256 from downloaded file %v is %v.", cacheKey, file, sha256)
+			// without a required SHA256, url content may have changed since
+			// it was downloaded, so check with the server
+			if uc, isURL := fsContent.(*URLContent); isURL && fileCaches[cacheKey].Validators != nil {
+				file = uc.revalidate(fileCaches[cacheKey], task)
+			}
+			task.cacheHits++
 			return
 		}
 		if requiredSHA256 == sha256 {
 			task.Infof("[mounts] Found existing download for %v (%v) with correct SHA256 %v", cacheKey, file, sha256)
+			task.cacheHits++
 			return
 		}
 		task.Infof("Found existing download of %v (%v) with SHA256 %v but task definition explicitly requires %v so deleting it", cacheKey, file, sha256, requiredSHA256)
@@ -627,18 +788,25 @@ func ensureCached(fsContent FSContent, task *TaskRun) (file string, err error) {
 			panic(fmt.Errorf("Could not delete cache entry %v: %v", fileCaches[cacheKey], err))
 		}
 	}
-	file, sha256, err = fsContent.Download(task)
+	task.cacheMisses++
+	var validators *HTTPValidators
+	if uc, isURL := fsContent.(*URLContent); isURL {
+		file, sha256, validators, err = uc.download(task)
+	} else {
+		file, sha256, err = fsContent.Download(task)
+	}
 	if err != nil {
 		task.Errorf("Could not download %v to %v due to %v", fsContent.UniqueKey(), file, err)
 		return
 	}
 	fileCaches[cacheKey] = &Cache{
-		Location: file,
-		Hits:     1,
-		Created:  time.Now(),
-		Owner:    fileCaches,
-		Key:      cacheKey,
-		SHA256:   sha256,
+		Location:   file,
+		Hits:       1,
+		Created:    time.Now(),
+		Owner:      fileCaches,
+		Key:        cacheKey,
+		SHA256:     sha256,
+		Validators: validators,
 	}
 	if requiredSHA256 == "" {
 		task.Warnf("[mounts] Download %v of %v has SHA256 %v but task payload does not declare a required value, so content authenticity cannot be verified", file, fsContent, sha256)
@@ -667,20 +835,45 @@ func extract(fsContent FSContent, format string, dir string, task *TaskRun) erro
 		return err
 	}
 	task.Infof("[mounts] Extracting %v file %v to '%v'", format, cacheFile, dir)
+	// archives such as node_modules trees often contain paths that are too
+	// long for Windows without the extended-length prefix
+	dir = fileutil.LongPath(dir)
 	switch format {
 	case "zip":
 		return archiver.Zip.Open(cacheFile, dir)
-	case "tar.gz":
-		return archiver.TarGz.Open(cacheFile, dir)
+	case "tar.gz", "tar.bz2":
+		return extractTar(cacheFile, format, dir)
 	case "rar":
 		return archiver.Rar.Open(cacheFile, dir)
-	case "tar.bz2":
-		return archiver.TarBz2.Open(cacheFile, dir)
 	}
 	log.Fatalf("Unsupported format %v", format)
 	return fmt.Errorf("Unsupported archive format %v", format)
 }
 
+// extractTar extracts a tar.gz or tar.bz2 archive with fileutil.ExtractTar,
+// rather than archiver, so that sparse files and hard links in it, such as
+// in disk images and incremental build outputs, don't inflate the directory
+func extractTar(archive, format, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = bufio.NewReader(f)
+	switch format {
+	case "tar.gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("%s: create new gzip reader: %v", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	case "tar.bz2":
+		r = bzip2.NewReader(r)
+	}
+	return fileutil.ExtractTar(r, dir)
+}
+
 // FSContentFrom returns either a *ArtifactContent or *URLContent or *RawContent or *Base64Content based on the content
 // (json.RawMessage)
 func FSContentFrom(c json.RawMessage) (FSContent, error) {
@@ -722,12 +915,27 @@ func (ac *ArtifactContent) Download(task *TaskRun) (file string, sha256 string,
 	basename := slugid.Nice()
 	file = filepath.Join(config.DownloadsDir, basename)
 	var signedURL *url.URL
-	signedURL, err = queue.GetLatestArtifact_SignedURL(ac.TaskID, ac.Artifact, time.Minute*30)
-	if err != nil {
-		return
+	delay := signedURLRetryDelay
+	for attempt := 1; ; attempt++ {
+		signedURL, err = queue.GetLatestArtifact_SignedURL(ac.TaskID, ac.Artifact, signedURLDuration())
+		if err != nil {
+			return
+		}
+		sha256, err = downloadURLToFile(signedURL.String(), ac.String(), file, task)
+		if err == nil || !signedURLExpired(err) {
+			return
+		}
+		// The signed url expired before the download completed, or was
+		// already expired according to the server's clock. Since the clock
+		// skew has now been observed, a fresh signed url should be valid.
+		if attempt == maxSignedURLAttempts {
+			task.Errorf("[mounts] Signed URL for %v expired on %v attempts; giving up", ac, attempt)
+			return
+		}
+		task.Warnf("[mounts] Signed URL for %v expired (clock skew %v); requesting a fresh one in %v", ac, clockSkew.Get(), delay)
+		time.Sleep(delay)
+		delay *= 2
 	}
-	sha256, err = downloadURLToFile(signedURL.String(), ac.String(), file, task)
-	return
 }
 
 func (ac *ArtifactContent) String() string {
@@ -750,12 +958,54 @@ func (ac *ArtifactContent) TaskDependencies() []string {
 // global config file.  The filename is a random slugid, and the absolute path
 // of the file is returned.
 func (uc *URLContent) Download(task *TaskRun) (file string, sha256 string, err error) {
+	file, sha256, _, err = uc.download(task)
+	return
+}
+
+// download is like Download, but also returns the HTTP validators of the
+// response, so that the downloaded content can be revalidated later
+func (uc *URLContent) download(task *TaskRun) (file string, sha256 string, validators *HTTPValidators, err error) {
 	basename := slugid.Nice()
 	file = filepath.Join(config.DownloadsDir, basename)
-	sha256, err = downloadURLToFile(uc.URL, uc.String(), file, task)
+	sha256, _, validators, err = conditionalDownloadURLToFile(uc.URL, uc.String(), file, task, nil)
 	return
 }
 
+// revalidate makes a conditional request for the url, so that if the content
+// is unchanged since the given cache entry was downloaded, the server only
+// needs to respond with 304 Not Modified. If the content has changed, it is
+// downloaded, and replaces the cache entry. The location of the current
+// content is returned. If the server cannot be reached, the existing download
+// is used.
+func (uc *URLContent) revalidate(cache *Cache, task *TaskRun) (file string) {
+	newFile := filepath.Join(config.DownloadsDir, slugid.Nice())
+	sha256, notModified, validators, err := conditionalDownloadURLToFile(uc.URL, uc.String(), newFile, task, cache.Validators)
+	if err != nil {
+		_ = os.RemoveAll(newFile)
+		task.Warnf("[mounts] Could not check whether existing download %v of %v is current, so using it anyway: %v", cache.Location, uc, err)
+		return cache.Location
+	}
+	if notModified {
+		task.Infof("[mounts] Existing download %v of %v is current", cache.Location, uc)
+		return cache.Location
+	}
+	task.Infof("[mounts] Content of %v has changed since %v was downloaded, so replacing it with %v", uc, cache.Location, newFile)
+	err = cache.Expunge(task)
+	if err != nil {
+		panic(fmt.Errorf("Could not delete cache entry %v: %v", cache, err))
+	}
+	fileCaches[cache.Key] = &Cache{
+		Location:   newFile,
+		Hits:       cache.Hits,
+		Created:    time.Now(),
+		Owner:      fileCaches,
+		Key:        cache.Key,
+		SHA256:     sha256,
+		Validators: validators,
+	}
+	return newFile
+}
+
 func (uc *URLContent) String() string {
 	return "url " + uc.URL
 }
@@ -774,29 +1024,112 @@ func (uc *URLContent) TaskDependencies() []string {
 
 // Utility function to aggressively download a url to a file location
 func downloadURLToFile(url, contentSource, file string, task *TaskRun) (sha256 string, err error) {
+	sha256, _, _, err = conditionalDownloadURLToFile(url, contentSource, file, task, nil)
+	return
+}
+
+// conditionalDownloadURLToFile is like downloadURLToFile, but if validators
+// are given, the server is asked to only return the content if it has
+// changed. If it hasn't, notModified is true and file is not written. The
+// HTTP validators of the downloaded content are returned, if the server
+// provided any.
+func conditionalDownloadURLToFile(url, contentSource, file string, task *TaskRun, validators *HTTPValidators) (sha256 string, notModified bool, newValidators *HTTPValidators, err error) {
 	var contentSize int64
+	if validators == nil {
+		var multipart bool
+		multipart, contentSize, newValidators, err = multipartDownloadURLToFile(url, contentSource, file, task)
+		if multipart {
+			if err == nil {
+				sha256 = downloadedFileSHA256(contentSource, file, contentSize, task)
+			}
+			return
+		}
+	}
+	progress := newDownloadProgress()
 	// httpbackoff.Get(url) is not sufficient as that only guarantees we have
 	// an http response to read from, but does not retry if we lose
 	// connectivity while reading from it. Therefore include the reading of the
-	// response body inside the retry function.
+	// response body inside the retry function. If the connection drops part
+	// way through, the next attempt resumes from the end of the last chunk
+	// that was written intact, if the server supports range requests.
 	retryFunc := func() (resp *http.Response, tempError error, permError error) {
-		task.Infof("[mounts] Downloading %v to %v", contentSource, file)
-		resp, err := http.Get(url)
+		offset := progress.resumeOffset(file)
+		if offset > 0 {
+			task.Infof("[mounts] Resuming download of %v to %v from byte %v", contentSource, file, offset)
+		} else {
+			task.Infof("[mounts] Downloading %v to %v", contentSource, file)
+		}
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			// permanent error!
+			return nil, nil, err
+		}
+		if offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+			req.Header.Set("If-Range", progress.validator)
+		} else if validators != nil {
+			if validators.ETag != "" {
+				req.Header.Set("If-None-Match", validators.ETag)
+			}
+			if validators.LastModified != "" {
+				req.Header.Set("If-Modified-Since", validators.LastModified)
+			}
+		}
+		resp, err = http.DefaultClient.Do(req)
+		clockSkew.observe(resp)
 		// assume all errors should result in a retry
 		if err != nil {
 			task.Warnf("[mounts] Download of %v failed on this attempt: %v", contentSource, err)
 			// temporary error!
 			return resp, err, nil
 		}
+		if resp.StatusCode == http.StatusNotModified {
+			notModified = true
+			return resp, nil, nil
+		}
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+			resp.Body.Close()
+			progress = newDownloadProgress()
+			task.Warnf("[mounts] Server could not resume download of %v from byte %v; restarting download", contentSource, offset)
+			// temporary error!
+			return resp, fmt.Errorf("%v: %v", contentSource, resp.Status), nil
+		}
+		if resp.StatusCode/100 != 2 {
+			// httpbackoff reads the response body, and decides whether to
+			// retry
+			return resp, nil, nil
+		}
 		defer resp.Body.Close()
-		f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+		if !progress.start(resp, offset) {
+			if resp.StatusCode == http.StatusPartialContent {
+				task.Warnf("[mounts] Server responded with unexpected range %q for download of %v from byte %v; restarting download", resp.Header.Get("Content-Range"), contentSource, offset)
+				// temporary error!
+				return resp, fmt.Errorf("%v: unexpected partial content", contentSource), nil
+			}
+			if offset > 0 {
+				task.Warnf("[mounts] Server did not resume download of %v from byte %v; restarting download", contentSource, offset)
+			}
+			offset = 0
+		}
+		f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE, 0600)
+		if err == nil {
+			err = f.Truncate(offset)
+			if err == nil {
+				_, err = f.Seek(offset, io.SeekStart)
+			}
+			if err != nil {
+				f.Close()
+			}
+		}
 		if err != nil {
 			task.Errorf("[mounts] Could not open file %v: %v", file, err)
 			// permanent error!
 			return resp, nil, err
 		}
 		defer f.Close()
-		contentSize, err = io.Copy(f, resp.Body)
+		var written int64
+		written, err = io.Copy(io.MultiWriter(f, progress), task.downloadReader(resp.Body))
+		contentSize = offset + written
 		if err != nil {
 			task.Warnf("[mounts] Could not write http response from %v to file %v on this attempt: %v", contentSource, file, err)
 			// likely a temporary error - network blip
@@ -806,18 +1139,36 @@ func downloadURLToFile(url, contentSource, file string, task *TaskRun) (sha256 s
 	}
 	var resp *http.Response
 	resp, _, err = httpbackoff.Retry(retryFunc)
+	if notModified {
+		// httpbackoff treats 304 as a bad response code
+		resp.Body.Close()
+		return "", true, validators, nil
+	}
 	if err != nil {
 		task.Errorf("[mounts] Could not fetch from %v into file %v: %v", contentSource, file, err)
 		return
 	}
 	defer resp.Body.Close()
-	sha256, err = fileutil.CalculateSHA256(file)
+	sha256 = downloadedFileSHA256(contentSource, file, contentSize, task)
+	if etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"); etag != "" || lastModified != "" {
+		newValidators = &HTTPValidators{
+			ETag:         etag,
+			LastModified: lastModified,
+		}
+	}
+	return
+}
+
+// downloadedFileSHA256 returns the SHA256 of the whole of file, that
+// contentSize bytes have just been downloaded to from contentSource
+func downloadedFileSHA256(contentSource, file string, contentSize int64, task *TaskRun) string {
+	sha256, err := fileutil.CalculateSHA256(file)
 	if err != nil {
 		task.Infof("[mounts] Downloaded %v bytes from %v to %v but cannot calculate SHA256", contentSize, contentSource, file)
 		panic(fmt.Sprintf("Internal worker bug! Cannot calculate SHA256 of file %v that I just downloaded: %v", file, err))
 	}
 	task.Infof("[mounts] Downloaded %v bytes with SHA256 %v from %v to %v", contentSize, sha256, contentSource, file)
-	return
+	return sha256
 }
 
 //RawContent to file
@@ -1,9 +1,81 @@
-// +build simple docker
+// +build simple docker kubernetes
 
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
 
 func grantingDenying(t *testing.T, filetype string, taskPath ...string) (granting, denying []string) {
 	return []string{}, []string{}
 }
+
+func TestWritableDirectoryCachePaths(t *testing.T) {
+	skipWithoutZstd(t)
+	taskDir, cleanup := cacheArchiveTestDir(t)
+	defer cleanup()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			CachesDir: filepath.Join(taskDir, "caches"),
+		},
+	}
+	defer func() { config = nil }()
+	oldDirectoryCaches := directoryCaches
+	directoryCaches = CacheMap{}
+	defer func() { directoryCaches = oldDirectoryCaches }()
+	if err := os.MkdirAll(config.CachesDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(taskDir, "build")
+	// runTask mounts the cache with the given paths, checks that the
+	// expected files were mounted, writes the given files, and unmounts
+	// the cache again
+	runTask := func(paths []string, expected, write map[string]string) {
+		t.Helper()
+		if err := os.RemoveAll(target); err != nil {
+			t.Fatal(err)
+		}
+		task := taskWithPayload(`{}`)
+		w := &WritableDirectoryCache{
+			CacheName: "build",
+			Directory: "build",
+			Paths:     paths,
+		}
+		if err := w.Mount(task); err != nil {
+			t.Fatalf("Could not mount cache with paths %q: %v", paths, err)
+		}
+		// MkdirAllTaskUser doesn't create directories with the docker and
+		// kubernetes engines
+		if err := os.MkdirAll(target, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if got := readTestFiles(t, target); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("Was expecting cache mounted with paths %q to have files %q, but got %q", paths, expected, got)
+		}
+		writeTestFiles(t, target, write)
+		if err := w.Unmount(task); err != nil {
+			t.Fatalf("Could not unmount cache with paths %q: %v", paths, err)
+		}
+		if cache := directoryCaches["build"]; cache.Archive != (len(paths) > 0) {
+			t.Fatalf("Was expecting cache unmounted with paths %q to be archived: %v", paths, len(paths) > 0)
+		}
+	}
+	runTask(nil, map[string]string{}, map[string]string{"src/a.go": "a", "deps/b.bin": "b"})
+	// a cache directory is mounted whole, since it is not archived yet
+	runTask([]string{"src"}, map[string]string{"src/a.go": "a", "deps/b.bin": "b"}, map[string]string{"src/a.go": "changed"})
+	archive := directoryCaches["build"].Location
+	runTask([]string{"deps"}, map[string]string{"deps/b.bin": "b"}, map[string]string{"deps/c.bin": "c"})
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting previous cache archive %v to be removed, but got %v", archive, err)
+	}
+	archive = directoryCaches["build"].Location
+	runTask(nil, map[string]string{"src/a.go": "changed", "deps/b.bin": "b", "deps/c.bin": "c"}, map[string]string{})
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting cache archive %v to be removed when mounting the whole cache, but got %v", archive, err)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -553,3 +555,62 @@ func TestWritableDirectoryCacheNoSHA256(t *testing.T) {
 		},
 	)
 }
+
+// TestURLMountRevalidation checks that cached url content without a required
+// SHA256 is revalidated with a conditional request, and only downloaded again
+// if it has changed.
+func TestURLMountRevalidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config = &gwconfig.Config{}
+	config.DownloadsDir = dir
+	fileCaches = CacheMap{}
+	defer func() {
+		config = nil
+		fileCaches = nil
+	}()
+
+	content, etag := "version one", `"v1"`
+	fullResponses := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fullResponses++
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	task := &TaskRun{}
+	uc := &URLContent{URL: server.URL}
+	fetch := func() (file string, text string) {
+		file, err := ensureCached(uc, task)
+		if err != nil {
+			t.Fatalf("Could not download %v: %v", uc, err)
+		}
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Could not read %v: %v", file, err)
+		}
+		return file, string(b)
+	}
+
+	first, text := fetch()
+	if text != "version one" || fullResponses != 1 {
+		t.Fatalf("Was expecting one full download of %q but got %v full downloads of %q", "version one", fullResponses, text)
+	}
+	second, text := fetch()
+	if second != first || text != "version one" || fullResponses != 1 {
+		t.Fatalf("Was expecting unchanged content to be reused from %v without a full download, but got %v with %v full downloads", first, second, fullResponses)
+	}
+	content, etag = "version two", `"v2"`
+	third, text := fetch()
+	if third == first || text != "version two" || fullResponses != 2 {
+		t.Fatalf("Was expecting changed content to be downloaded again, but got %q from %v with %v full downloads", text, third, fullResponses)
+	}
+}
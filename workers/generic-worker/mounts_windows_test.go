@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -43,6 +44,23 @@ func TestRenameCrossDevice(t *testing.T) {
 	}
 }
 
+func TestMountWithReservedFileName(t *testing.T) {
+	defer setup(t)()
+	mounts := []MountEntry{
+		&FileMount{
+			File:    filepath.Join("out", "nul.txt"),
+			Content: json.RawMessage(`{"raw": "not a device"}`),
+		},
+	}
+	payload := GenericWorkerPayload{
+		Mounts:     toMountArray(t, &mounts),
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+	td := testTask(t)
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
 func exists(path string) (bool, error) {
 	_, err := os.Stat(path)
 	if err == nil {
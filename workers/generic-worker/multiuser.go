@@ -4,13 +4,9 @@ package main
 
 import (
 	"encoding/json"
-	"errors"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
 
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
@@ -19,6 +15,9 @@ import (
 
 const (
 	engine = "multiuser"
+	// the task directory mustn't exist before the worker logs in to the task
+	// user, since it may be the home directory of the task user
+	standbyTaskDirectories = false
 )
 
 func secure(configFile string) {
@@ -28,6 +27,15 @@ func secure(configFile string) {
 	}
 }
 
+// adaptEngineToContainer runs tasks as the current user in containerized
+// worker mode, since task users can't be created inside a container
+func adaptEngineToContainer() {
+	if !config.RunTasksAsCurrentUser {
+		log.Print("Running tasks as the current user, since task users can't be created in containerized worker mode")
+		config.RunTasksAsCurrentUser = true
+	}
+}
+
 func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 	reboot = true
 	_, err := os.Stat("next-task-user.json")
@@ -44,17 +52,15 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 		if err != nil {
 			panic(err)
 		}
-		err = runtime.WaitForLoginCompletion(5 * time.Minute)
-		if err != nil {
-			panic(err)
-		}
-		interactiveUsername, err := runtime.InteractiveUsername()
+		err = waitForTaskUserLogon(taskUserCredentials)
 		if err != nil {
-			panic(err)
-		}
-		if taskUserCredentials.Name != interactiveUsername {
-			panic(fmt.Errorf("Interactive username %v does not match task user %v from next-task-user.json file", interactiveUsername, taskUserCredentials.Name))
+			reboot, err = retryTaskUserLogon(taskUserCredentials, err)
+			if err != nil {
+				panic(err)
+			}
+			return
 		}
+		resetTaskUserLogonFailures()
 		reboot = false
 		pd, err := process.NewPlatformData(config.RunTasksAsCurrentUser)
 		if err != nil {
@@ -63,7 +69,7 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 
 		taskContext = &TaskContext{
 			User:    taskUserCredentials,
-			TaskDir: filepath.Join(config.TasksDir, interactiveUsername),
+			TaskDir: filepath.Join(config.TasksDir, taskUserCredentials.Name),
 			pd:      pd,
 		}
 
@@ -84,6 +90,13 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 		if err != nil {
 			panic(err)
 		}
+		if config.CaseSensitiveTaskDirectories {
+			log.Printf("Making task directory %v case sensitive", taskContext.TaskDir)
+			err = fileutil.EnableCaseSensitivity(taskContext.TaskDir)
+			if err != nil {
+				panic(err)
+			}
+		}
 		if script := config.RunAfterUserCreation; script != "" {
 			// See https://bugzil.la/1559210
 			// Regardless of whether we are running tasks as current user or
@@ -140,27 +153,42 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 
 	nextTaskUser := &runtime.OSUser{
 		Name:     taskDirName,
-		Password: runtime.GeneratePassword(),
+		Password: runtime.GeneratePassword(int(config.TaskUserPasswordLength)),
 	}
-	err = nextTaskUser.CreateNew(false)
+	// With warm standby, the next task user is created while the current
+	// task runs, since user creation is slow on Windows. The worker waits
+	// for it to complete before preparing the next task, or exiting.
+	if config.WarmStandby && !reboot {
+		standby.run("create task user "+nextTaskUser.Name, func() error {
+			return createNextTaskUser(nextTaskUser)
+		})
+		return
+	}
+	err = createNextTaskUser(nextTaskUser)
 	if err != nil {
 		panic(err)
 	}
+	return
+}
+
+// createNextTaskUser creates the given task user, and configures the worker
+// to log in to it after the next reboot
+func createNextTaskUser(nextTaskUser *runtime.OSUser) error {
+	err := createTaskUser(nextTaskUser)
+	if err != nil {
+		return err
+	}
 	PreRebootSetup(nextTaskUser)
 	// configure worker to auto-login to this newly generated user account
 	err = runtime.SetAutoLogin(nextTaskUser)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	err = fileutil.WriteToFileAsJSON(nextTaskUser, "next-task-user.json")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	err = fileutil.SecureFiles("next-task-user.json")
-	if err != nil {
-		panic(err)
-	}
-	return
+	return fileutil.SecureFiles("next-task-user.json")
 }
 
 // Only return critical errors
@@ -169,38 +197,14 @@ func purgeOldTasks() error {
 		log.Printf("WARNING: Not purging previous task directories/users since config setting cleanUpTaskDirs is false")
 		return nil
 	}
-	deleteTaskDirs(runtime.UserHomeDirectoriesParent(), taskContext.User.Name, runtime.AutoLogonUser())
-	deleteTaskDirs(config.TasksDir, taskContext.User.Name, runtime.AutoLogonUser())
 	// regardless of whether we are running as current user or not, we should purge old task users
-	err := deleteExistingOSUsers()
+	err := collectOrphanedTaskUsers()
 	if err != nil {
 		log.Printf("Could not delete old task users:\n%v", err)
 	}
 	return nil
 }
 
-func deleteExistingOSUsers() (err error) {
-	log.Print("Looking for existing task users to delete...")
-	userAccounts, err := runtime.ListUserAccounts()
-	if err != nil {
-		return
-	}
-	allErrors := []string{}
-	for _, username := range userAccounts {
-		if strings.HasPrefix(username, "task_") && username != taskContext.User.Name && username != runtime.AutoLogonUser() {
-			log.Print("Attempting to remove user " + username + "...")
-			err2 := runtime.DeleteUser(username)
-			if err2 != nil {
-				allErrors = append(allErrors, fmt.Sprintf("Could not remove user account %v: %v", username, err2))
-			}
-		}
-	}
-	if len(allErrors) > 0 {
-		err = errors.New(strings.Join(allErrors, "\n"))
-	}
-	return
-}
-
 func StoredUserCredentials() (*runtime.OSUser, error) {
 	credsFile, err := os.Open("current-task-user.json")
 	if err != nil {
@@ -22,10 +22,43 @@ func (task *TaskRun) formatCommand(index int) string {
 
 func platformFeatures() []Feature {
 	return []Feature{
+		&CommandTraceFeature{},
+		&CrashDumpsFeature{},
+		&MemoryWatchdogFeature{},
+		&FileCountWatchdogFeature{},
+		&ProgressFeature{},
+		&AnnotationsFeature{},
+		&TestResultsFeature{},
+		&ScreenCaptureFeature{},
+		&AndroidEmulatorFeature{},
+		&IOSSimulatorFeature{},
+		&KeychainFeature{},
+		&TCCFeature{},
+		&ServicesFeature{},
+		// must come before TaskIsolation, which mounts the hosts file it
+		// writes
+		&HostAliasesFeature{},
+		// wraps the task commands, so must start after features that
+		// modify them
+		&TaskIsolationFeature{},
+		// wraps the task commands (including the sandbox of TaskIsolation)
+		// in a network namespace, so must start after TaskIsolation
+		&TaskNetworkFeature{},
+		// runs the task commands in an empty network namespace instead of
+		// the network namespace of TaskNetwork, for tasks without network
+		// access
+		&DisableNetworkFeature{},
 		// keep chain of trust as low down as possible, as it checks permissions
 		// of signing key file, and a feature could change them, so we want these
 		// checks as late as possible
 		&ChainOfTrustFeature{},
+		// must come after chain of trust, so that it is stopped first, in
+		// order for the SBOM to be covered by the chain of trust certificate
+		&SBOMFeature{},
+		// must come after chain of trust, so that it is stopped first, in
+		// order for the signatures to be recorded in the chain of trust
+		// certificate
+		&ArtifactSigningFeature{},
 	}
 }
 
@@ -54,6 +87,7 @@ func (task *TaskRun) generateCommand(index int) error {
 	task.logMux.RLock()
 	defer task.logMux.RUnlock()
 	task.Commands[index].DirectOutput(task.logWriter)
+	task.Commands[index].TagOutputStreams = task.Payload.TagOutputStreams
 	return nil
 }
 
@@ -64,6 +98,7 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 // Set an environment variable in each command.  This can be called from a feature's
 // NewTaskFeature method to set variables for the task.
 func (task *TaskRun) setVariable(variable string, value string) error {
+	task.recordVariable(variable, value)
 	for i := range task.Commands {
 		task.Commands[i].SetEnv(variable, value)
 	}
@@ -125,6 +160,7 @@ func (task *TaskRun) EnvVars() []string {
 	taskEnv["TASK_ID"] = task.TaskID
 	taskEnv["RUN_ID"] = strconv.Itoa(int(task.RunID))
 	taskEnv["TASKCLUSTER_ROOT_URL"] = config.RootURL
+	taskEnv["TASK_ARCHITECTURE"] = task.architecture
 	if config.RunTasksAsCurrentUser {
 		taskEnv["TASK_USER_CREDENTIALS"] = filepath.Join(cwd, "current-task-user.json")
 	}
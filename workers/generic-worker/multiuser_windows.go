@@ -14,6 +14,7 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
@@ -29,16 +30,48 @@ func (task *TaskRun) formatCommand(index int) string {
 
 func platformFeatures() []Feature {
 	return []Feature{
+		// validates the config settings for task users, which are created
+		// before the first task is claimed
+		&TaskUserPolicyFeature{},
+		&DefenderExclusionsFeature{},
+		&RegistrySandboxFeature{},
 		&RDPFeature{},
 		&RunAsAdministratorFeature{}, // depends on (must appear later in list than) OSGroups feature
+		&PerformanceCaptureFeature{},
+		&CrashDumpsFeature{},
+		&MemoryWatchdogFeature{},
+		&FileCountWatchdogFeature{},
+		&ProgressFeature{},
+		&AnnotationsFeature{},
+		&TestResultsFeature{},
+		&OutputEncodingFeature{},
+		// must come before ScreenCapture, so that screen recordings have the
+		// requested resolution
+		&DisplayFeature{},
+		&ScreenCaptureFeature{},
+		&AndroidEmulatorFeature{},
+		// replaces the task commands, so must start after features that
+		// modify them
+		&TaskIsolationFeature{},
+		&DisableNetworkFeature{},
 		// keep chain of trust as low down as possible, as it checks permissions
 		// of signing key file, and a feature could change them, so we want these
 		// checks as late as possible
 		&ChainOfTrustFeature{},
+		// must come after chain of trust, so that it is stopped first, in
+		// order for the SBOM to be covered by the chain of trust certificate
+		&SBOMFeature{},
+		// must come after chain of trust, so that it is stopped first, in
+		// order for the signatures to be recorded in the chain of trust
+		// certificate
+		&ArtifactSigningFeature{},
 	}
 }
 
 func deleteDir(path string) error {
+	// so that paths longer than MAX_PATH, and files with reserved names such
+	// as nul, can be deleted
+	path = fileutil.LongPath(path)
 	log.Print("Trying to remove directory '" + path + "' via os.RemoveAll(path) call...")
 	err := os.RemoveAll(path)
 	if err == nil {
@@ -69,6 +102,8 @@ func (task *TaskRun) generateCommand(index int) error {
 	task.logMux.RLock()
 	defer task.logMux.RUnlock()
 	command.DirectOutput(task.logWriter)
+	command.TagOutputStreams = task.Payload.TagOutputStreams
+	command.OutputEncoding = task.Payload.OutputEncoding
 	task.Commands[index] = command
 	return nil
 }
@@ -95,25 +130,11 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 	// If this is first command, take env from task payload, and cd into home
 	// directory
 	if index == 0 {
-		envVars := map[string]string{}
-		for k, v := range task.Payload.Env {
-			envVars[k] = v
-		}
-		for envVar, envValue := range envVars {
-			// log.Printf("Setting env var: %v=%v", envVar, envValue)
-			contents += "set " + envVar + "=" + envValue + "\r\n"
-		}
-		contents += "set TASK_ID=" + task.TaskID + "\r\n"
-		contents += "set RUN_ID=" + strconv.Itoa(int(task.RunID)) + "\r\n"
-		contents += "set TASKCLUSTER_ROOT_URL=" + config.RootURL + "\r\n"
-		if config.RunTasksAsCurrentUser {
-			contents += "set TASK_USER_CREDENTIALS=" + filepath.Join(cwd, "current-task-user.json") + "\r\n"
-		}
-		if config.WorkerLocation != "" {
+		for _, envVar := range task.EnvVars() {
 			// Note, in contrast to other shells, the cmd shell set command
 			// expects literal bytes between the `=` character and the line
 			// ending, i.e. no string escaping required!
-			contents += "set TASKCLUSTER_WORKER_LOCATION=" + config.WorkerLocation + "\r\n"
+			contents += "set " + envVar + "\r\n"
 		}
 		contents += "cd \"" + taskContext.TaskDir + "\"" + "\r\n"
 
@@ -200,9 +221,33 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 	return nil
 }
 
+// EnvVars returns the environment variables that the wrapper script of the
+// first task command sets, in order, so that the values set by the worker
+// take precedence over those in the task payload
+func (task *TaskRun) EnvVars() []string {
+	taskEnvArray := []string{}
+	for _, k := range sortedKeys(task.Payload.Env) {
+		taskEnvArray = append(taskEnvArray, k+"="+task.Payload.Env[k])
+	}
+	taskEnvArray = append(taskEnvArray,
+		"TASK_ID="+task.TaskID,
+		"RUN_ID="+strconv.Itoa(int(task.RunID)),
+		"TASKCLUSTER_ROOT_URL="+config.RootURL,
+		"TASK_ARCHITECTURE="+task.architecture,
+	)
+	if config.RunTasksAsCurrentUser {
+		taskEnvArray = append(taskEnvArray, "TASK_USER_CREDENTIALS="+filepath.Join(cwd, "current-task-user.json"))
+	}
+	if config.WorkerLocation != "" {
+		taskEnvArray = append(taskEnvArray, "TASKCLUSTER_WORKER_LOCATION="+config.WorkerLocation)
+	}
+	return taskEnvArray
+}
+
 // Set an environment variable in each command.  This can be called from a feature's
 // NewTaskFeature method to set variables for the task.
 func (task *TaskRun) setVariable(variable string, value string) error {
+	task.recordVariable(variable, value)
 	for i := range task.Commands {
 		newEnv := []string{fmt.Sprintf("%s=%s", variable, value)}
 		combined, err := win32.MergeEnvLists(&task.Commands[i].Cmd.Env, &newEnv)
@@ -255,11 +300,11 @@ func makeDirUnreadableForUser(dir string, user *gwruntime.OSUser) error {
 // https://msdn.microsoft.com/en-us/library/windows/desktop/aa365240(v=vs.85).aspx
 func RenameCrossDevice(oldpath, newpath string) (err error) {
 	var to, from *uint16
-	from, err = syscall.UTF16PtrFromString(oldpath)
+	from, err = syscall.UTF16PtrFromString(fileutil.LongPath(oldpath))
 	if err != nil {
 		return
 	}
-	to, err = syscall.UTF16PtrFromString(newpath)
+	to, err = syscall.UTF16PtrFromString(fileutil.LongPath(newpath))
 	if err != nil {
 		return
 	}
@@ -540,9 +585,13 @@ func GrantSIDFullControlOfInteractiveWindowsStationAndDesktop(sid string) (err e
 }
 
 func PreRebootSetup(nextTaskUser *runtime.OSUser) {
+	// must happen before the user first logs in below
+	err := applyTaskUserPolicy(nextTaskUser)
+	if err != nil {
+		panic(err)
+	}
 	// set APPDATA
 	var loginInfo *process.LoginInfo
-	var err error
 	loginInfo, err = process.NewLoginInfo(nextTaskUser.Name, nextTaskUser.Password)
 	if err != nil {
 		panic(err)
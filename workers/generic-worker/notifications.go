@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v3"
+	"github.com/taskcluster/httpbackoff/v3"
+	tcurls "github.com/taskcluster/taskcluster-lib-urls"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcnotify"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// notificationTimeout is the time allowed for sending the notifications of a
+// task resolution, including retries
+const notificationTimeout = 2 * time.Minute
+
+// pendingNotifications tracks notifications that are being sent in the
+// background, so that the worker can wait for them before exiting
+var pendingNotifications sync.WaitGroup
+
+// Represents the Notifications feature as a whole - one global instance.
+// Notifications are configured per worker type (in the worker config) rather
+// than per task, for worker pools where the task submitter is unable to add
+// notify routes to their tasks.
+type NotificationsFeature struct {
+	notify *tcnotify.Notify
+}
+
+// TaskResolution is the JSON document POSTed to config.NotifyWebhookURL when
+// a task resolves
+type TaskResolution struct {
+	TaskID         string `json:"taskId"`
+	RunID          uint   `json:"runId"`
+	State          string `json:"state"`
+	ReasonResolved string `json:"reasonResolved"`
+	ProvisionerID  string `json:"provisionerId"`
+	WorkerType     string `json:"workerType"`
+	WorkerGroup    string `json:"workerGroup"`
+	WorkerID       string `json:"workerId"`
+	TaskURL        string `json:"taskUrl"`
+}
+
+type NotificationsTask struct {
+	task                     *TaskRun
+	notify                   *tcnotify.Notify
+	taskStatusChangeListener *TaskStatusChangeListener
+}
+
+func (feature *NotificationsFeature) Name() string {
+	return "Notifications"
+}
+
+func (feature *NotificationsFeature) Initialise() error {
+	feature.notify = config.Notify()
+	return nil
+}
+
+func (feature *NotificationsFeature) PersistState() error {
+	return nil
+}
+
+// Notifications are enabled by the worker config, not the task payload
+func (feature *NotificationsFeature) IsEnabled(task *TaskRun) bool {
+	return len(config.NotifyOnStatuses) > 0
+}
+
+func (feature *NotificationsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &NotificationsTask{
+		task:   task,
+		notify: feature.notify,
+	}
+}
+
+func (n *NotificationsTask) RequiredScopes() scopes.Expression {
+	// notifications are sent using the worker's credentials, and are
+	// configured by the worker type owner, so no task scopes required
+	return scopes.AllOf{}
+}
+
+func (n *NotificationsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (n *NotificationsTask) Start() *CommandExecutionError {
+	n.taskStatusChangeListener = &TaskStatusChangeListener{
+		Name: "notifications",
+		Callback: func(ts TaskStatus) {
+			var state string
+			switch ts {
+			case succeeded:
+				state = "completed"
+			case failed:
+				state = "failed"
+			case errored:
+				state = "exception"
+			default:
+				return
+			}
+			for _, status := range config.NotifyOnStatuses {
+				if status == state {
+					// the status manager lock is held during the callback,
+					// so notifications are sent once the update completes
+					pendingNotifications.Add(1)
+					go func() {
+						defer pendingNotifications.Done()
+						n.sendNotifications(state)
+					}()
+					return
+				}
+			}
+		},
+	}
+	n.task.StatusManager.RegisterListener(n.taskStatusChangeListener)
+	return nil
+}
+
+// Note, the listener is deliberately not deregistered here, since the task is
+// only resolved after all task features have been stopped. The status manager
+// is discarded with the task, so the listener does not outlive the task.
+func (n *NotificationsTask) Stop(err *ExecutionErrors) {
+}
+
+// sendNotifications sends the notifications of the task resolution, giving
+// up after notificationTimeout. Failures are only logged, since the task has
+// already been resolved.
+func (n *NotificationsTask) sendNotifications(state string) {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	resolution := &TaskResolution{
+		TaskID:         n.task.TaskID,
+		RunID:          n.task.RunID,
+		State:          state,
+		ReasonResolved: n.task.StatusManager.ReasonResolved(),
+		ProvisionerID:  config.ProvisionerID,
+		WorkerType:     config.WorkerType,
+		WorkerGroup:    config.WorkerGroup,
+		WorkerID:       config.WorkerID,
+		TaskURL:        tcurls.UI(config.RootURL, "tasks/"+n.task.TaskID),
+	}
+	message := fmt.Sprintf("Task %v run %v resolved as %v/%v on worker %v/%v (worker type %v/%v)", resolution.TaskID, resolution.RunID, resolution.State, resolution.ReasonResolved, resolution.WorkerGroup, resolution.WorkerID, resolution.ProvisionerID, resolution.WorkerType)
+	notify := *n.notify
+	notify.Context = ctx
+	if config.NotifyEmailAddress != "" {
+		err := notify.Email(&tcnotify.SendEmailRequest{
+			Address: config.NotifyEmailAddress,
+			Subject: fmt.Sprintf("Task %v %v", resolution.TaskID, resolution.State),
+			Content: message,
+			Link: tcnotify.Link{
+				Href: resolution.TaskURL,
+				Text: "Inspect Task",
+			},
+		})
+		if err != nil {
+			log.Printf("WARNING: could not send notification email to %v: %v", config.NotifyEmailAddress, err)
+		}
+	}
+	if config.NotifyMatrixRoomID != "" {
+		err := notify.Matrix(&tcnotify.SendMatrixNoticeRequest{
+			RoomID: config.NotifyMatrixRoomID,
+			Body:   message + " - " + resolution.TaskURL,
+		})
+		if err != nil {
+			log.Printf("WARNING: could not send matrix notice to room %v: %v", config.NotifyMatrixRoomID, err)
+		}
+	}
+	if config.NotifyWebhookURL != "" {
+		body, err := json.Marshal(resolution)
+		if err != nil {
+			panic(err)
+		}
+		err = postWebhook(ctx, config.NotifyWebhookURL, body)
+		if err != nil {
+			log.Printf("WARNING: could not POST task resolution to webhook %v: %v", config.NotifyWebhookURL, err)
+		}
+	}
+}
+
+// postWebhook POSTs the given JSON document to the given url, retrying
+// transient failures until ctx is done
+func postWebhook(ctx context.Context, url string, body []byte) error {
+	b := backoff.NewExponentialBackOff()
+	if deadline, ok := ctx.Deadline(); ok {
+		b.MaxElapsedTime = time.Until(deadline)
+	}
+	client := &httpbackoff.Client{
+		BackOffSettings: b,
+	}
+	resp, _, err := client.Retry(func() (*http.Response, error, error) {
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+		return resp, err, nil
+	})
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
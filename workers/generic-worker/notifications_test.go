@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPostWebhook(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != `{"taskId":"abc"}` || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected webhook request with content type %q and body %q", r.Header.Get("Content-Type"), body)
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	err := postWebhook(context.Background(), server.URL, []byte(`{"taskId":"abc"}`))
+	if err != nil || requests != 2 {
+		t.Fatalf("Expected webhook to succeed on retry, but got %v after %v request(s)", err, requests)
+	}
+
+	// a webhook that keeps failing is given up on when the deadline passes
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	start := time.Now()
+	err = postWebhook(ctx, failing.URL, []byte(`{"taskId":"abc"}`))
+	if err == nil || time.Since(start) > 10*time.Second {
+		t.Fatalf("Expected webhook to fail by the deadline, but got %v after %v", err, time.Since(start))
+	}
+}
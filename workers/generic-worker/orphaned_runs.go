@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// file, in the current directory of the worker, that records the run that the
+// worker is running, so that if the worker restarts unexpectedly, it can
+// clean up after the run rather than leaving it to expire
+const inFlightRunFile = "in-flight-run.json"
+
+// inFlightRun is the state of the run that the worker is running, as stored
+// in inFlightRunFile
+type inFlightRun struct {
+	TaskID string `json:"taskId"`
+	RunID  uint   `json:"runId"`
+	// task directory of the run, which contains the task log
+	TaskDir string `json:"taskDir"`
+	// expiry of the task, which is also the expiry of the task log artifact
+	Expires tcclient.Time `json:"expires"`
+	// the task credentials are only valid until the claim of the run expires
+	TakenUntil  tcclient.Time         `json:"takenUntil"`
+	Credentials *tcclient.Credentials `json:"credentials"`
+}
+
+// recordInFlightRun records the given run, whose claim expires at takenUntil,
+// in inFlightRunFile. It is called when the run is claimed, and every time it
+// is reclaimed, so that the stored task credentials are current.
+func recordInFlightRun(task *TaskRun, takenUntil tcclient.Time) error {
+	task.queueMux.RLock()
+	credentials := *task.Queue.Credentials
+	task.queueMux.RUnlock()
+	run := &inFlightRun{
+		TaskID:      task.TaskID,
+		RunID:       task.RunID,
+		TaskDir:     taskContext.TaskDir,
+		Expires:     task.Definition.Expires,
+		TakenUntil:  takenUntil,
+		Credentials: &credentials,
+	}
+	err := fileutil.WriteToFileAsJSON(run, inFlightRunFile)
+	if err != nil {
+		return err
+	}
+	return fileutil.SecureFiles(inFlightRunFile)
+}
+
+// clearInFlightRun records that the worker is no longer running a run, once
+// the run has been resolved
+func clearInFlightRun() error {
+	err := os.Remove(inFlightRunFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// recoverOrphanedRun cleans up after the run that the worker was running when
+// it last stopped, if it stopped unexpectedly (e.g. it crashed, or the machine
+// lost power) before resolving the run. The partial task log is uploaded, and
+// the run is resolved as exception/worker-shutdown, so that the queue retries
+// the task straight away, rather than when the claim expires. The task
+// directory of the run is deleted along with other old task directories.
+func recoverOrphanedRun() {
+	data, err := ioutil.ReadFile(inFlightRunFile)
+	if err != nil {
+		// worker stopped cleanly
+		return
+	}
+	defer func() {
+		if err := clearInFlightRun(); err != nil {
+			log.Printf("WARNING: could not delete %v: %v", inFlightRunFile, err)
+		}
+	}()
+	var run inFlightRun
+	err = json.Unmarshal(data, &run)
+	if err != nil {
+		log.Printf("WARNING: could not read orphaned run from %v: %v", inFlightRunFile, err)
+		return
+	}
+	log.Printf("Worker stopped unexpectedly while running task %v run %v - resolving it as exception/worker-shutdown", run.TaskID, run.RunID)
+	logEvent("orphanedRun", &TaskRun{TaskID: run.TaskID, RunID: run.RunID}, time.Now())
+	// the task credentials only work until the claim expires, after which the
+	// queue resolves the run as exception/claim-expired anyway
+	if time.Now().After(time.Time(run.TakenUntil)) {
+		log.Printf("Claim of task %v run %v expired at %v, so it has already been resolved", run.TaskID, run.RunID, run.TakenUntil)
+		return
+	}
+	task := run.taskRun()
+	err = run.uploadLog(task)
+	if err != nil {
+		log.Printf("WARNING: could not upload task log of task %v run %v: %v", run.TaskID, run.RunID, err)
+	}
+	_, err = task.Queue.ReportException(run.TaskID, strconv.Itoa(int(run.RunID)), &tcqueue.TaskExceptionRequest{
+		Reason: string(workerShutdown),
+	})
+	if err != nil {
+		log.Printf("WARNING: could not resolve task %v run %v as exception/worker-shutdown: %v", run.TaskID, run.RunID, err)
+		return
+	}
+	log.Printf("Resolved task %v run %v as exception/worker-shutdown", run.TaskID, run.RunID)
+}
+
+// taskRun returns a TaskRun for the orphaned run, with just enough state to
+// upload artifacts and resolve the run with the task credentials
+func (run *inFlightRun) taskRun() *TaskRun {
+	queue := tcqueue.New(run.Credentials, config.RootURL)
+	queue.HTTPRetry = config.HTTPRetry
+	// if queueRootURL is configured, this takes precedence over rootURL
+	if config.QueueRootURL != "" {
+		queue.RootURL = config.QueueRootURL
+	}
+	task := &TaskRun{
+		TaskID:    run.TaskID,
+		RunID:     run.RunID,
+		Queue:     queue,
+		Artifacts: map[string]TaskArtifact{},
+	}
+	task.Definition.Expires = run.Expires
+	return task
+}
+
+// uploadLog appends a note to the partial task log of the orphaned run, and
+// uploads it
+func (run *inFlightRun) uploadLog(task *TaskRun) (err error) {
+	// uploadArtifact panics on unexpected responses from the queue, which
+	// mustn't stop the worker from starting
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	logFile := filepath.Join(run.TaskDir, logPath)
+	file, err := os.OpenFile(logFile, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(file, "[taskcluster:error] Worker stopped unexpectedly while running the task, so the task log is incomplete. Resolving task as exception/%v.\n", workerShutdown)
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	// artifact paths are relative to the task directory
+	defer func(taskDir string) {
+		taskContext.TaskDir = taskDir
+	}(taskContext.TaskDir)
+	taskContext.TaskDir = run.TaskDir
+	if e := task.uploadLog(logName, logPath); e != nil {
+		return e
+	}
+	return nil
+}
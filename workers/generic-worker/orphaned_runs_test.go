@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func orphanedTaskRun(rootURL string) *TaskRun {
+	task := &TaskRun{
+		TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		RunID:  2,
+		Queue:  tcqueue.New(&tcclient.Credentials{ClientID: "task-client", AccessToken: "task-token"}, rootURL),
+	}
+	task.Definition.Expires = tcclient.Time(time.Now().Add(time.Hour))
+	return task
+}
+
+func TestOrphanedRunResolved(t *testing.T) {
+	resolved := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/queue/v1/task/KTBKfEgxR5GdfIIREQIvFQ/runs/2/exception" {
+			t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resolved++
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			RootURL: server.URL,
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	// task directory without a task log, so only the run is resolved
+	taskDir, err := ioutil.TempDir("", "orphaned-run")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(taskDir)
+	defer func(dir string) {
+		taskContext.TaskDir = dir
+	}(taskContext.TaskDir)
+	taskContext.TaskDir = taskDir
+	defer os.Remove(inFlightRunFile)
+
+	err = recordInFlightRun(orphanedTaskRun(server.URL), tcclient.Time(time.Now().Add(time.Hour)))
+	if err != nil {
+		t.Fatalf("Could not record in-flight run: %v", err)
+	}
+	recoverOrphanedRun()
+	if resolved != 1 {
+		t.Fatalf("Was expecting orphaned run to be resolved once, but was resolved %v times", resolved)
+	}
+	if _, err := os.Stat(inFlightRunFile); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting %v to be deleted after recovering orphaned run", inFlightRunFile)
+	}
+}
+
+func TestOrphanedRunClaimExpired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request %v %v", r.Method, r.URL.Path)
+	}))
+	defer server.Close()
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			RootURL: server.URL,
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	defer os.Remove(inFlightRunFile)
+
+	err := recordInFlightRun(orphanedTaskRun(server.URL), tcclient.Time(time.Now().Add(-time.Minute)))
+	if err != nil {
+		t.Fatalf("Could not record in-flight run: %v", err)
+	}
+	recoverOrphanedRun()
+	if _, err := os.Stat(inFlightRunFile); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting %v to be deleted after recovering orphaned run", inFlightRunFile)
+	}
+
+	// nothing to recover when the worker stopped cleanly
+	recoverOrphanedRun()
+}
@@ -4,6 +4,9 @@ import (
 	"github.com/taskcluster/taskcluster/v28/internal/scopes"
 )
 
+// scope required by tasks in order to be added to an OS group
+const osGroupScope scopes.Pattern = "generic-worker:os-group:<provisionerId>/<workerType>/<osGroup>"
+
 // one instance overall - represents feature
 type OSGroupsFeature struct {
 }
@@ -43,10 +46,10 @@ func (osGroups *OSGroups) ReservedArtifacts() []string {
 	return []string{}
 }
 
-func (osGroups *OSGroups) RequiredScopes() scopes.Required {
-	requiredScopes := make([]string, len(osGroups.Task.Payload.OSGroups))
+func (osGroups *OSGroups) RequiredScopes() scopes.Expression {
+	requiredScopes := make(scopes.AllOf, len(osGroups.Task.Payload.OSGroups))
 	for i, osGroup := range osGroups.Task.Payload.OSGroups {
-		requiredScopes[i] = "generic-worker:os-group:" + config.ProvisionerID + "/" + config.WorkerType + "/" + osGroup
+		requiredScopes[i] = workerScope(osGroupScope, "osGroup", osGroup)
 	}
-	return scopes.Required{requiredScopes}
+	return requiredScopes
 }
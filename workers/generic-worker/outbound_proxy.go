@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// proxyBypassRule is a parsed entry of config setting proxyBypass
+type proxyBypassRule struct {
+	// all destinations
+	any bool
+	// domain, which also matches its subdomains
+	domain string
+	// IP address or CIDR range
+	network *net.IPNet
+	// only matches this port, if non-empty
+	port string
+}
+
+// NewProxyFunc returns the function that the default HTTP transport uses to
+// choose the proxy of each request, from config settings proxyURL,
+// proxyUsername, proxyPassword and proxyBypass. It returns nil if proxyURL is
+// not set, in which case the proxy environment variables apply.
+func NewProxyFunc(c *gwconfig.Config) (func(*http.Request) (*url.URL, error), error) {
+	if c.ProxyURL == "" {
+		if c.ProxyUsername != "" || c.ProxyPassword != "" || len(c.ProxyBypass) > 0 {
+			return nil, fmt.Errorf("Config settings \"proxyUsername\", \"proxyPassword\" and \"proxyBypass\" require config setting \"proxyURL\"")
+		}
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Config setting \"proxyURL\" is not a valid URL: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("Config setting \"proxyURL\" has scheme %q but only \"http\", \"https\" and \"socks5\" are supported", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("Config setting \"proxyURL\" %q has no host", c.ProxyURL)
+	}
+	if proxyURL.User != nil {
+		return nil, fmt.Errorf("Config setting \"proxyURL\" must not include credentials - use config settings \"proxyUsername\" and \"proxyPassword\" instead")
+	}
+	switch {
+	case c.ProxyUsername != "":
+		proxyURL.User = url.UserPassword(c.ProxyUsername, c.ProxyPassword)
+	case c.ProxyPassword != "":
+		return nil, fmt.Errorf("Config setting \"proxyPassword\" requires config setting \"proxyUsername\"")
+	}
+	rules := make([]proxyBypassRule, len(c.ProxyBypass))
+	for i, entry := range c.ProxyBypass {
+		rules[i], err = parseProxyBypassRule(entry)
+		if err != nil {
+			return nil, fmt.Errorf("Config setting \"proxyBypass\" has invalid entry %q: %v", entry, err)
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		host := strings.ToLower(req.URL.Hostname())
+		port := req.URL.Port()
+		if port == "" {
+			port = "80"
+			if req.URL.Scheme == "https" || req.URL.Scheme == "wss" {
+				port = "443"
+			}
+		}
+		ip := net.ParseIP(host)
+		if host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil, nil
+		}
+		for _, rule := range rules {
+			if rule.matches(host, ip, port) {
+				return nil, nil
+			}
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+func parseProxyBypassRule(entry string) (rule proxyBypassRule, err error) {
+	host := entry
+	if h, p, e := net.SplitHostPort(entry); e == nil {
+		host, rule.port = h, p
+	}
+	switch {
+	case host == "":
+		err = fmt.Errorf("no host")
+	case host == "*":
+		rule.any = true
+	case strings.Contains(host, "/"):
+		_, rule.network, err = net.ParseCIDR(host)
+	case net.ParseIP(host) != nil:
+		ip := net.ParseIP(host)
+		bits := 8 * len(ip)
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		rule.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		rule.domain = strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(host, "*"), "."))
+	}
+	return
+}
+
+func (rule proxyBypassRule) matches(host string, ip net.IP, port string) bool {
+	if rule.port != "" && rule.port != port {
+		return false
+	}
+	switch {
+	case rule.any:
+		return true
+	case rule.network != nil:
+		return ip != nil && rule.network.Contains(ip)
+	default:
+		return host == rule.domain || strings.HasSuffix(host, "."+rule.domain)
+	}
+}
+
+// configureProxy applies config settings proxyURL, proxyUsername,
+// proxyPassword and proxyBypass to the default HTTP transport, which the
+// Taskcluster clients, downloads and artifact uploads all use
+func configureProxy(c *gwconfig.Config) error {
+	proxy, err := NewProxyFunc(c)
+	if err != nil || proxy == nil {
+		return err
+	}
+	http.DefaultTransport.(*http.Transport).Proxy = proxy
+	return nil
+}
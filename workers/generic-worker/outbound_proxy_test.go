@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestProxyBypass(t *testing.T) {
+	c := &gwconfig.Config{}
+	c.ProxyURL = "socks5://proxy.example.com:1080"
+	c.ProxyBypass = []string{"internal.example.com", ".corp", "10.0.0.0/8", "192.168.1.1", "mirror.example.com:8443"}
+	proxy, err := NewProxyFunc(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		url     string
+		proxied bool
+	}{
+		{"https://queue.taskcluster.example.com/api", true},
+		{"https://internal.example.com/x", false},
+		{"https://artifacts.internal.example.com/x", false},
+		{"https://notinternal.example.com/x", true},
+		{"http://build.corp/x", false},
+		{"http://10.1.2.3/x", false},
+		{"http://11.1.2.3/x", true},
+		{"http://192.168.1.1:8080/x", false},
+		{"https://mirror.example.com:8443/x", false},
+		{"https://mirror.example.com/x", true},
+		{"http://localhost:60023/log", false},
+		{"http://127.0.0.1/x", false},
+	} {
+		req, err := http.NewRequest("GET", test.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		proxyURL, err := proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (proxyURL != nil) != test.proxied {
+			t.Errorf("Was expecting request to %v to be proxied=%v, but got proxy %v", test.url, test.proxied, proxyURL)
+		}
+	}
+}
+
+func TestProxyAuthentication(t *testing.T) {
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic d29ya2VyOnMzY3JldA==" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		_, _ = w.Write([]byte("proxied " + r.URL.String()))
+	}))
+	defer proxyServer.Close()
+	c := &gwconfig.Config{}
+	c.ProxyURL = proxyServer.URL
+	c.ProxyUsername = "worker"
+	c.ProxyPassword = "s3cret"
+	proxy, err := NewProxyFunc(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy: proxy,
+		},
+	}
+	resp, err := client.Get("http://queue.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Was expecting proxy to accept credentials, but got %v", resp.Status)
+	}
+}
+
+func TestProxyConfigErrors(t *testing.T) {
+	if proxy, err := NewProxyFunc(&gwconfig.Config{}); proxy != nil || err != nil {
+		t.Fatalf("Was not expecting a proxy without config setting proxyURL, but got error %v", err)
+	}
+	for _, c := range []gwconfig.Config{
+		{PublicConfig: gwconfig.PublicConfig{ProxyUsername: "worker"}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyBypass: []string{"example.com"}}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyURL: "ftp://proxy.example.com"}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyURL: "http://"}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyURL: (&url.URL{Scheme: "http", User: url.User("worker"), Host: "proxy"}).String()}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyURL: "http://proxy", ProxyBypass: []string{"10.0.0.0/33"}}},
+		{PublicConfig: gwconfig.PublicConfig{ProxyURL: "http://proxy"}, PrivateConfig: gwconfig.PrivateConfig{ProxyPassword: "s3cret"}},
+	} {
+		c := c
+		if _, err := NewProxyFunc(&c); err == nil {
+			t.Errorf("Was expecting an error for invalid proxy config settings %#v", c.PublicConfig)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+type (
+	// OutputEncodingFeature warns in the task log when output of a task
+	// command could not be converted to UTF-8 from its encoding (see
+	// task.payload.outputEncoding), and was replaced. It doesn't need to be
+	// enabled by tasks, since output is always converted.
+	OutputEncodingFeature struct {
+	}
+
+	OutputEncodingTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *OutputEncodingFeature) Name() string {
+	return "Output Encoding"
+}
+
+func (feature *OutputEncodingFeature) Initialise() error {
+	return nil
+}
+
+func (feature *OutputEncodingFeature) PersistState() error {
+	return nil
+}
+
+func (feature *OutputEncodingFeature) IsEnabled(task *TaskRun) bool {
+	return true
+}
+
+func (feature *OutputEncodingFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &OutputEncodingTask{
+		task: task,
+	}
+}
+
+func (et *OutputEncodingTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (et *OutputEncodingTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (et *OutputEncodingTask) Start() *CommandExecutionError {
+	et.task.afterCommand = append(et.task.afterCommand, func(index int, result *process.Result) {
+		for _, warning := range result.OutputWarnings {
+			et.task.Warnf("[output] Command %v: %v", index, warning)
+		}
+	})
+	return nil
+}
+
+func (et *OutputEncodingTask) Stop(err *ExecutionErrors) {
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func outputEncodingTestLog(t *testing.T) string {
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	return string(bytes)
+}
+
+func TestUTF16Output(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    []string{"cmd /u /c echo hello utf-16"},
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext := outputEncodingTestLog(t)
+	if !strings.Contains(logtext, "hello utf-16") {
+		t.Fatalf("Was expecting UTF-16 output to be converted to UTF-8:\n%v", logtext)
+	}
+	if strings.Contains(logtext, "[output]") {
+		t.Fatalf("Was not expecting a warning about invalid output:\n%v", logtext)
+	}
+}
+
+func TestInvalidUTF8Output(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command: []string{
+			`powershell -Command "[Console]::OpenStandardOutput().Write([byte[]](0x61, 0xff, 0x62, 0x0a), 0, 4)"`,
+		},
+		MaxRunTime:     30,
+		OutputEncoding: "utf-8",
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext := outputEncodingTestLog(t)
+	for _, expected := range []string{"a\uFFFDb", "[output] Command 0: output contained byte sequences that are not valid UTF-8"} {
+		if !strings.Contains(logtext, expected) {
+			t.Fatalf("Was expecting log to contain %q but it didn't:\n%v", expected, logtext)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func outputStreamsCommand() [][]string {
+	return [][]string{
+		{
+			"/bin/bash",
+			"-c",
+			"echo out1; sleep 0.2; echo err1 >&2; sleep 0.2; printf partial; sleep 0.2; echo err2 >&2; sleep 0.2; echo out2",
+		},
+	}
+}
+
+func outputStreamsTestLog(t *testing.T) string {
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	return string(bytes)
+}
+
+func TestUntaggedOutputStreams(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    outputStreamsCommand(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext := outputStreamsTestLog(t)
+	if !strings.Contains(logtext, "out1\nerr1\npartialerr2\nout2\n") {
+		t.Fatalf("Was expecting stdout and stderr in the order they were written:\n%v", logtext)
+	}
+	if strings.Contains(logtext, "[stdout] ") {
+		t.Fatalf("Was not expecting lines to be tagged:\n%v", logtext)
+	}
+}
+
+func TestTaggedOutputStreams(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:          outputStreamsCommand(),
+		MaxRunTime:       30,
+		TagOutputStreams: true,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	logtext := outputStreamsTestLog(t)
+	expected := "[stdout] out1\n[stderr] err1\n[stdout] partial\n[stderr] err2\n[stdout] out2\n"
+	if !strings.Contains(logtext, expected) {
+		t.Fatalf("Was expecting tagged lines %q in log:\n%v", expected, logtext)
+	}
+}
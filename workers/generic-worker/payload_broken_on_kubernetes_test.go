@@ -0,0 +1,237 @@
+// +build !kubernetes
+
+// The payloads of these tests are not valid on the kubernetes engine, whose
+// payloads require an image, and have a single command.
+
+package main
+
+import (
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+// Valid payload should pass validation
+func TestValidPayload(t *testing.T) {
+	ensureValidPayload(t, taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [`+rawHelloGoodbye()+`]
+}`))
+}
+
+// This little hack is to make sure we get a timestamp which is truncated to
+// the millisecond
+func NowMillis(t *testing.T) (now time.Time) {
+	var err error
+	now, err = time.Parse(time.RFC3339, tcclient.Time(time.Now()).String())
+	if err != nil {
+		t.Fatalf("Error parsing timestamp - %v", err)
+	}
+	return
+}
+
+// If an artifact expires before task deadline we should get a Malformed Payload
+func TestArtifactExpiresBeforeDeadline(t *testing.T) {
+	now := NowMillis(t)
+	task := taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "file",
+      "path": "public/some/artifact",
+      "expires": "` + tcclient.Time(now.Add(time.Minute*5)).String() + `"
+    }
+  ]
+}`)
+	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
+	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
+	ensureMalformedPayload(t, task)
+}
+
+// If artifact expires with task deadline, we should not get a Malformed Payload
+func TestArtifactExpiresWithDeadline(t *testing.T) {
+	now := NowMillis(t)
+	task := taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "file",
+      "path": "public/some/artifact",
+      "expires": "` + tcclient.Time(now.Add(time.Minute*10)).String() + `"
+    }
+  ]
+}`)
+	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
+	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
+	ensureValidPayload(t, task)
+}
+
+// If artifact expires after task deadline, but before task expiry, we should not get a Malformed Payload
+func TestArtifactExpiresBetweenDeadlineAndTaskExpiry(t *testing.T) {
+	now := NowMillis(t)
+	task := taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "file",
+      "path": "public/some/artifact",
+      "expires": "` + tcclient.Time(now.Add(time.Minute*15)).String() + `"
+    }
+  ]
+}`)
+	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
+	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
+	ensureValidPayload(t, task)
+}
+
+// If artifact expires with task expiry, we should not get a Malformed Payload
+func TestArtifactExpiresWithTask(t *testing.T) {
+	now := NowMillis(t)
+	task := taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "file",
+      "path": "public/some/artifact",
+      "expires": "` + tcclient.Time(now.Add(time.Minute*20)).String() + `"
+    }
+  ]
+}`)
+	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
+	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
+	ensureValidPayload(t, task)
+}
+
+// If an artifact expires after task expiry we should get a Malformed Payload
+func TestArtifactExpiresAfterTaskExpiry(t *testing.T) {
+	now := NowMillis(t)
+	task := taskWithPayload(`{
+  "env": {
+    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+  },
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "file",
+      "path": "public/some/artifact",
+      "expires": "` + tcclient.Time(now.Add(time.Minute*25)).String() + `"
+    }
+  ]
+}`)
+	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
+	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
+	ensureMalformedPayload(t, task)
+}
+
+func TestInvalidPayload(t *testing.T) {
+	defer setup(t)()
+
+	td := testTask(t)
+	td.Payload = json.RawMessage(`
+{
+  "command": [` + rawHelloGoodbye() + `],
+  "maxRunTime": 60,
+  "mounts": [
+    {
+      "content": {
+        "sha356": "9ded97d830bef3734ea6de70df0159656d6a63e01484175b34d72b8db326bda0",
+        "url": "https://storage.googleapis.com/golang/go1.10.8.windows-386.zip"
+      },
+      "directory": "go1.10.8",
+      "format": "zip"
+    }
+  ]
+}`)
+
+	_ = submitAndAssert(t, td, GenericWorkerPayload{}, "exception", "malformed-payload")
+}
+
+// Payloads that are valid according to the payload schema, but can't work on
+// this worker, should be reported with hints
+func TestPayloadLint(t *testing.T) {
+	foreignPath := `C:\\Users\\task\\public`
+	if runtime.GOOS == "windows" {
+		foreignPath = "/home/task/public"
+	}
+	task := taskWithPayload(`{
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "artifacts": [
+    {
+      "type": "directory",
+      "path": "public",
+      "name": "public"
+    },
+    {
+      "type": "directory",
+      "path": "` + foreignPath + `",
+      "name": "public/foreign"
+    }
+  ],
+  "mounts": [
+    {
+      "cacheName": "allowed",
+      "directory": "allowed"
+    },
+    {
+      "cacheName": "forbidden",
+      "directory": "forbidden"
+    }
+  ]
+}`)
+	task.Definition.Scopes = []string{"generic-worker:cache:allowed"}
+	ensureMalformedPayload(t, task)
+	violations := map[string]PayloadViolation{}
+	for _, v := range task.payloadViolations {
+		violations[v.Pointer] = v
+	}
+	if len(violations) != 2 {
+		t.Fatalf("Was expecting 2 payload violations but got %#v", task.payloadViolations)
+	}
+	for pointer, violationType := range map[string]string{
+		"/artifacts/1/path":   "platform_incompatible_path",
+		"/mounts/1/cacheName": "missing_cache_scope",
+	} {
+		if v := violations[pointer]; v.Type != violationType || v.Hint == "" {
+			t.Errorf("Was expecting a payload violation of type %v with a hint at %q but got %#v", violationType, pointer, v)
+		}
+	}
+
+	// assume: scopes are left to the scope checks of the mounts feature
+	task.Definition.Scopes = []string{"assume:project:test"}
+	task.payloadViolations = nil
+	task.Definition.Payload = json.RawMessage(`{
+  "maxRunTime": 3,
+  "command": [` + rawHelloGoodbye() + `],
+  "mounts": [
+    {
+      "cacheName": "forbidden",
+      "directory": "forbidden"
+    }
+  ]
+}`)
+	ensureValidPayload(t, task)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+)
+
+// validatePayloadSize checks that the raw task payload doesn't exceed config
+// setting maxPayloadBytes. This happens before the payload is logged and
+// validated against the payload schema, so that pathological payloads are
+// rejected before the worker spends resources on them.
+func (task *TaskRun) validatePayloadSize() *CommandExecutionError {
+	if max := config.MaxPayloadBytes; max != 0 && uint(len(task.Definition.Payload)) > max {
+		return MalformedPayloadError(fmt.Errorf("Malformed payload: task payload is %v bytes, which exceeds the limit of %v bytes of this worker (config setting maxPayloadBytes)", len(task.Definition.Payload), max))
+	}
+	return nil
+}
+
+// validatePayloadLimits checks the task payload against config settings
+// maxTaskCommands, maxTaskArtifacts and maxTaskEnvBytes
+func (task *TaskRun) validatePayloadLimits() *CommandExecutionError {
+	if max := config.MaxTaskCommands; max != 0 && uint(len(task.Payload.Command)) > max {
+		return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.command has %v commands, which exceeds the limit of %v commands of this worker (config setting maxTaskCommands)", len(task.Payload.Command), max))
+	}
+	if max := config.MaxTaskArtifacts; max != 0 && uint(len(task.Payload.Artifacts)) > max {
+		return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.artifacts has %v artifacts, which exceeds the limit of %v artifacts of this worker (config setting maxTaskArtifacts)", len(task.Payload.Artifacts), max))
+	}
+	if max := config.MaxTaskEnvBytes; max != 0 {
+		if size := envBytes(task.Payload.Env); size > max {
+			return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.env is %v bytes, which exceeds the limit of %v bytes of this worker (config setting maxTaskEnvBytes)", size, max))
+		}
+	}
+	return nil
+}
+
+// envBytes returns the size of env in NAME=value form, which is how it is
+// passed to task commands
+func envBytes(env map[string]string) uint {
+	size := uint(0)
+	for name, value := range env {
+		size += uint(len(name) + len("=") + len(value))
+	}
+	return size
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestPayloadLimits(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			MaxPayloadBytes:  100,
+			MaxTaskArtifacts: 1,
+			MaxTaskEnvBytes:  10,
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	for _, test := range []struct {
+		payload string
+		valid   bool
+	}{
+		{
+			payload: `{"command": [], "env": {"ABC": "123456"}, "artifacts": [{}]}`,
+			valid:   true,
+		},
+		{
+			payload: `{"command": [], "env": {"ABCD": "123456"}}`,
+		},
+		{
+			payload: `{"command": [], "artifacts": [{}, {}]}`,
+		},
+		{
+			payload: `{"command": [], "env": {"A": "1", "B": "2", "C": "3", "D": "4", "E": "5", "F": "6"}, "artifacts": []}`,
+		},
+	} {
+		task := &TaskRun{
+			Definition: tcqueue.TaskDefinitionResponse{
+				Payload: json.RawMessage(test.payload),
+			},
+		}
+		err := json.Unmarshal(task.Definition.Payload, &task.Payload)
+		if err != nil {
+			t.Fatalf("%v: %v", test.payload, err)
+		}
+		cee := task.validatePayloadSize()
+		if cee == nil {
+			cee = task.validatePayloadLimits()
+		}
+		if valid := cee == nil; valid != test.valid {
+			t.Errorf("%v: expected valid %v but got error %v", test.payload, test.valid, cee)
+		}
+		if cee != nil && cee.Reason != malformedPayload {
+			t.Errorf("%v: expected reason %v but got %v", test.payload, malformedPayload, cee.Reason)
+		}
+	}
+}
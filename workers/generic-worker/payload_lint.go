@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+var (
+	// payload values that are file paths, as JSON pointers where "*" matches
+	// any array index
+	payloadPaths = []string{
+		"/artifacts/*/path",
+		"/fetches/*/path",
+		"/mounts/*/directory",
+		"/mounts/*/file",
+		"/secrets/*/file",
+		"/testResults/paths/*",
+		"/writeFiles/*/path",
+	}
+
+	// e.g. C:\Users, C:/Users or \\server\share
+	windowsPath = regexp.MustCompile(`^([A-Za-z]:[\\/]|\\\\)`)
+)
+
+// lintPayload checks the task payload, which is valid according to the
+// payload schema, for constructs that cannot work on this worker, such as
+// paths of another platform, or caches that the task has no scopes for, so
+// that the task is resolved as malformed-payload before anything runs. All
+// problems found are recorded as payload violations, with hints on how to
+// fix them.
+func (task *TaskRun) lintPayload() *CommandExecutionError {
+	var payload interface{}
+	if err := json.Unmarshal(task.Definition.Payload, &payload); err != nil {
+		return MalformedPayloadError(err)
+	}
+	violations := []PayloadViolation{}
+	for _, pattern := range payloadPaths {
+		for pointer, value := range payloadValues(payload, pattern) {
+			if path, isString := value.(string); isString {
+				if v := lintPath(pointer, path); v != nil {
+					violations = append(violations, *v)
+				}
+			}
+		}
+	}
+	violations = append(violations, task.lintCacheScopes()...)
+	if len(violations) == 0 {
+		return nil
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		return violations[i].Pointer < violations[j].Pointer
+	})
+	task.Error("TASK FAIL since the task payload cannot work on this worker. See errors:")
+	for _, v := range violations {
+		task.Errorf("- %v: %v", v.Pointer, v.Message)
+		task.Errorf("  Hint: %v", v.Hint)
+	}
+	task.payloadViolations = violations
+	return MalformedPayloadError(fmt.Errorf("Linting of payload failed for task %v", task.TaskID))
+}
+
+// payloadValues returns the values in the given payload that match the given
+// JSON pointer pattern (see payloadPaths), by JSON pointer
+func payloadValues(payload interface{}, pattern string) map[string]interface{} {
+	values := map[string]interface{}{}
+	var walk func(value interface{}, pointer string, tokens []string)
+	walk = func(value interface{}, pointer string, tokens []string) {
+		if len(tokens) == 0 {
+			values[pointer] = value
+			return
+		}
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if child, exists := v[tokens[0]]; exists {
+				walk(child, pointer+"/"+tokens[0], tokens[1:])
+			}
+		case []interface{}:
+			if tokens[0] == "*" {
+				for i, child := range v {
+					walk(child, pointer+"/"+strconv.Itoa(i), tokens[1:])
+				}
+			}
+		}
+	}
+	walk(payload, "", strings.Split(pattern, "/")[1:])
+	return values
+}
+
+// lintPath returns a violation if the given payload path is a path of
+// another platform, e.g. a Windows path in the payload of a Linux task
+func lintPath(pointer, path string) *PayloadViolation {
+	if runtime.GOOS == "windows" {
+		if !strings.HasPrefix(path, "/") {
+			return nil
+		}
+		return &PayloadViolation{
+			Pointer: pointer,
+			Type:    "platform_incompatible_path",
+			Message: fmt.Sprintf("%q looks like an absolute path of a Unix-like platform, but this worker runs on windows", path),
+			Hint:    "Use a path relative to the task directory, with \\ or / as separator, or run the task on a worker pool of the platform that it was written for.",
+			Details: map[string]interface{}{
+				"path": path,
+			},
+		}
+	}
+	if !windowsPath.MatchString(path) && !strings.Contains(path, `\`) {
+		return nil
+	}
+	return &PayloadViolation{
+		Pointer: pointer,
+		Type:    "platform_incompatible_path",
+		Message: fmt.Sprintf("%q looks like a Windows path, but this worker runs on %v", path, runtime.GOOS),
+		Hint:    "Use a path relative to the task directory, with / as separator, or run the task on a Windows worker pool.",
+		Details: map[string]interface{}{
+			"path": path,
+		},
+	}
+}
+
+// lintCacheScopes returns a violation for each writable directory cache of
+// the task whose scope the task does not have. Only the scopes of the task
+// as they are are considered, so tasks with assume: scopes are left to the
+// scope checks of the mounts feature, which expand them.
+func (task *TaskRun) lintCacheScopes() []PayloadViolation {
+	given := scopes.Given(task.Definition.Scopes)
+	for _, scope := range given {
+		if strings.HasPrefix(scope, "assume:") {
+			return nil
+		}
+	}
+	violations := []PayloadViolation{}
+	for i, mount := range task.Payload.Mounts {
+		var m struct {
+			CacheName string `json:"cacheName"`
+		}
+		if err := json.Unmarshal(mount, &m); err != nil || m.CacheName == "" {
+			continue
+		}
+		scope := scopes.Scope("generic-worker:cache:" + m.CacheName)
+		if missing, _ := given.Missing(scope, nil); missing == nil {
+			continue
+		}
+		violations = append(violations, PayloadViolation{
+			Pointer: fmt.Sprintf("/mounts/%v/cacheName", i),
+			Type:    "missing_cache_scope",
+			Message: fmt.Sprintf("Cache %v requires scope %v, which the task does not have", m.CacheName, scope),
+			Hint:    fmt.Sprintf("Add scope %v to task.scopes; whoever creates the task needs it too.", scope),
+			Details: map[string]interface{}{
+				"cacheName": m.CacheName,
+				"scope":     string(scope),
+			},
+		})
+	}
+	return violations
+}
+
+// addRemediationHints adds hints to the given payload schema violations
+// that are common mistakes, such as using payload properties or features
+// that this engine of generic-worker doesn't support
+func addRemediationHints(violations []PayloadViolation) {
+	for i, v := range violations {
+		if v.Type != "additional_property_not_allowed" {
+			continue
+		}
+		property, _ := v.Details["property"].(string)
+		var what string
+		var supported []string
+		switch v.Pointer {
+		case "":
+			what, supported = "Payload property", schemaProperties()
+		case "/features":
+			what, supported = "Feature", schemaProperties("features")
+		default:
+			continue
+		}
+		violations[i].Hint = fmt.Sprintf("%v %q is not supported by the %v engine of generic-worker on %v. Check its spelling, or run the task on a worker pool with an engine that supports it. Supported here: %v.", what, property, engine, runtime.GOOS, strings.Join(supported, ", "))
+	}
+}
+
+// schemaProperties returns the sorted names of the properties of the object
+// at the given property path in the payload schema, e.g. ("features")
+func schemaProperties(path ...string) []string {
+	type object struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var schema object
+	if err := json.Unmarshal([]byte(taskPayloadSchema()), &schema); err != nil {
+		panic(err)
+	}
+	for _, property := range path {
+		var child object
+		if err := json.Unmarshal(schema.Properties[property], &child); err != nil {
+			return nil
+		}
+		schema = child
+	}
+	names := []string{}
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
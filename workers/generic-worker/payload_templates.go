@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templateExpression matches template expressions such as {{taskId}} and
+// {{cachePath "name"}}. Text between {{ and }} that does not match, such as
+// {{.ID}} of a docker format string, is left as is.
+var templateExpression = regexp.MustCompile(`{{\s*([a-zA-Z]+)(?:\s+("(?:[^"\\]|\\.)*"))?\s*}}`)
+
+// payloadTemplates expands the template expressions of a task payload
+type payloadTemplates struct {
+	task *TaskRun
+	// cache name -> directory of writable directory cache mount
+	caches  map[string]string
+	fetches []Fetch
+}
+
+func (task *TaskRun) payloadTemplates() *payloadTemplates {
+	pt := &payloadTemplates{
+		task:    task,
+		caches:  map[string]string{},
+		fetches: task.Payload.Fetches,
+	}
+	for _, m := range task.Payload.Mounts {
+		var mount struct {
+			CacheName string `json:"cacheName"`
+			Directory string `json:"directory"`
+		}
+		// invalid mounts are reported by the Mounts feature
+		if err := json.Unmarshal(m, &mount); err == nil && mount.CacheName != "" {
+			pt.caches[mount.CacheName] = mount.Directory
+		}
+	}
+	return pt
+}
+
+// value returns the value of template expression {{name}}, and whether name
+// is such a template expression
+func (pt *payloadTemplates) value(name string) (string, bool) {
+	switch name {
+	case "taskId":
+		return pt.task.TaskID, true
+	case "runId":
+		return strconv.Itoa(int(pt.task.RunID)), true
+	case "taskGroupId":
+		return pt.task.Definition.TaskGroupID, true
+	case "workerGroup":
+		return config.WorkerGroup, true
+	case "workerId":
+		return config.WorkerID, true
+	case "workerPoolId":
+		return config.ProvisionerID + "/" + config.WorkerType, true
+	}
+	return "", false
+}
+
+// expand returns s with its template expressions expanded
+func (pt *payloadTemplates) expand(s string) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	var err error
+	expanded := templateExpression.ReplaceAllStringFunc(s, func(expr string) string {
+		if err != nil {
+			return expr
+		}
+		var value string
+		var known bool
+		value, known, err = pt.evaluate(templateExpression.FindStringSubmatch(expr))
+		if !known {
+			return expr
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// evaluate returns the value of the given submatches of templateExpression,
+// and whether the expression is a known template expression
+func (pt *payloadTemplates) evaluate(match []string) (string, bool, error) {
+	name, quoted := match[1], match[2]
+	if value, isValue := pt.value(name); isValue {
+		if quoted != "" {
+			return "", true, fmt.Errorf("template expression %v does not take an argument", match[0])
+		}
+		return value, true, nil
+	}
+	var lookup func(string) (string, error)
+	switch name {
+	case "cachePath":
+		lookup = pt.cachePath
+	case "fetchPath":
+		lookup = pt.fetchPath
+	default:
+		return "", false, nil
+	}
+	if quoted == "" {
+		return "", true, fmt.Errorf("template expression %v requires a quoted argument, e.g. {{%v \"name\"}}", match[0], name)
+	}
+	arg, err := strconv.Unquote(quoted)
+	if err != nil {
+		return "", true, fmt.Errorf("template expression %v has invalid argument %v: %v", match[0], quoted, err)
+	}
+	value, err := lookup(arg)
+	return value, true, err
+}
+
+func (pt *payloadTemplates) cachePath(cacheName string) (string, error) {
+	directory, found := pt.caches[cacheName]
+	if !found {
+		return "", fmt.Errorf("task.payload.mounts has no writable directory cache with cache name %q", cacheName)
+	}
+	return directory, nil
+}
+
+func (pt *payloadTemplates) fetchPath(artifact string) (string, error) {
+	matches := []string{}
+	for _, fetch := range pt.fetches {
+		if fetch.Artifact == artifact || path.Base(fetch.Artifact) == artifact {
+			matches = append(matches, fetch.Path)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("task.payload.fetches has no artifact with name %q", artifact)
+	case 1:
+		return matches[0], nil
+	}
+	return "", fmt.Errorf("task.payload.fetches has %v artifacts with name %q, so the full artifact name is needed", len(matches), artifact)
+}
+
+// expandTemplates expands the template expressions in the task commands, the
+// values of the task environment variables, and the paths of the task
+// artifacts, if task.payload.features.payloadTemplates is enabled, since
+// existing tasks may pass such text to their commands as is. The task
+// definition keeps the unexpanded payload.
+func (task *TaskRun) expandTemplates() *CommandExecutionError {
+	if !task.Payload.Features.PayloadTemplates {
+		return nil
+	}
+	pt := task.payloadTemplates()
+	var err error
+	expand := func(s *string, location string) {
+		if err != nil {
+			return
+		}
+		var e error
+		*s, e = pt.expand(*s)
+		if e != nil {
+			err = fmt.Errorf("Malformed payload: %v: %v", location, e)
+		}
+	}
+	task.expandCommandTemplates(expand)
+	for name, value := range task.Payload.Env {
+		expand(&value, "task.payload.env."+name)
+		task.Payload.Env[name] = value
+	}
+	for i := range task.Payload.Artifacts {
+		expand(&task.Payload.Artifacts[i].Path, fmt.Sprintf("task.payload.artifacts[%v].path", i))
+	}
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+// +build darwin linux freebsd
+
+package main
+
+import (
+	"fmt"
+)
+
+func (task *TaskRun) expandCommandTemplates(expand func(s *string, location string)) {
+	for i := range task.Payload.Command {
+		for j := range task.Payload.Command[i] {
+			expand(&task.Payload.Command[i][j], fmt.Sprintf("task.payload.command[%v][%v]", i, j))
+		}
+	}
+}
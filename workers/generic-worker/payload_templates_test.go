@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func templatesTestTask() *TaskRun {
+	return &TaskRun{
+		TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		RunID:  2,
+		Definition: tcqueue.TaskDefinitionResponse{
+			TaskGroupID: "dv2VTKUYQ5eE8k_XuB3Emw",
+		},
+		Payload: GenericWorkerPayload{
+			Env: map[string]string{
+				"CACHE":  `{{cachePath "cargo-registry"}}`,
+				"FORMAT": "{{.ID}} {{ workerPoolId }}",
+			},
+			Artifacts: []Artifact{
+				{Path: "logs/{{taskId}}-{{runId}}.log"},
+			},
+			Mounts: []json.RawMessage{
+				json.RawMessage(`{"cacheName": "cargo-registry", "directory": "cargo/registry"}`),
+				json.RawMessage(`{"file": "x", "content": {"raw": "y"}}`),
+			},
+			Fetches: []Fetch{
+				{TaskID: "T", Artifact: "public/build/toolchain.tar.gz", Path: "toolchain"},
+				{TaskID: "T", Artifact: "public/build/sources.tar.gz", Path: "src"},
+				{TaskID: "U", Artifact: "public/tests/sources.tar.gz", Path: "test-src"},
+			},
+		},
+	}
+}
+
+func TestExpandTemplates(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	config.ProvisionerID = "proj-example"
+	config.WorkerType = "linux"
+	task := templatesTestTask()
+	if cee := task.expandTemplates(); cee != nil {
+		t.Fatal(cee)
+	}
+	if path := task.Payload.Artifacts[0].Path; path != "logs/{{taskId}}-{{runId}}.log" {
+		t.Fatalf("Was expecting templates not to be expanded unless enabled, but got %q", path)
+	}
+	task.Payload.Features.PayloadTemplates = true
+	if cee := task.expandTemplates(); cee != nil {
+		t.Fatal(cee)
+	}
+	if env := task.Payload.Env["CACHE"]; env != "cargo/registry" {
+		t.Fatalf("Was expecting CACHE to be the directory of the cache, but got %q", env)
+	}
+	if env := task.Payload.Env["FORMAT"]; env != "{{.ID}} proj-example/linux" {
+		t.Fatalf("Was expecting unknown template expression to be left as is, but got %q", env)
+	}
+	if path := task.Payload.Artifacts[0].Path; path != "logs/KTBKfEgxR5GdfIIREQIvFQ-2.log" {
+		t.Fatalf("Was expecting artifact path to be expanded, but got %q", path)
+	}
+
+	pt := task.payloadTemplates()
+	for expr, expected := range map[string]string{
+		`{{fetchPath "toolchain.tar.gz"}}`:            "toolchain",
+		`{{fetchPath "public/tests/sources.tar.gz"}}`: "test-src",
+		`{{taskGroupId}}/{{ taskId }}`:                "dv2VTKUYQ5eE8k_XuB3Emw/KTBKfEgxR5GdfIIREQIvFQ",
+	} {
+		if value, err := pt.expand(expr); err != nil || value != expected {
+			t.Errorf("Was expecting %v to expand to %q, but got %q, %v", expr, expected, value, err)
+		}
+	}
+	for _, expr := range []string{
+		`{{fetchPath "sources.tar.gz"}}`,
+		`{{fetchPath "missing"}}`,
+		`{{cachePath "missing"}}`,
+		`{{cachePath}}`,
+		`{{taskId "x"}}`,
+	} {
+		if value, err := pt.expand(expr); err == nil {
+			t.Errorf("Was expecting %v to be invalid, but it expanded to %q", expr, value)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+)
+
+func (task *TaskRun) expandCommandTemplates(expand func(s *string, location string)) {
+	for i := range task.Payload.Command {
+		expand(&task.Payload.Command[i], fmt.Sprintf("task.payload.command[%v]", i))
+	}
+}
@@ -4,11 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"runtime"
+	"strings"
 	"testing"
-	"time"
 
 	"github.com/taskcluster/slugid-go/slugid"
-	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
 	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
 	"github.com/xeipuuv/gojsonschema"
 )
@@ -88,168 +87,69 @@ func TestExtraFieldsNotAllowed(t *testing.T) {
 }`))
 }
 
-// At least one command must be specified
-func TestNoCommandsSpecified(t *testing.T) {
-	ensureMalformedPayload(t, taskWithPayload(`{
-  "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
-  },
-  "maxRunTime": 3,
-  "command": []
-}`))
-}
-
-// Valid payload should pass validation
-func TestValidPayload(t *testing.T) {
-	ensureValidPayload(t, taskWithPayload(`{
-  "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
-  },
-  "maxRunTime": 3,
-  "command": [`+rawHelloGoodbye()+`]
-}`))
-}
-
-// This little hack is to make sure we get a timestamp which is truncated to
-// the millisecond
-func NowMillis(t *testing.T) (now time.Time) {
-	var err error
-	now, err = time.Parse(time.RFC3339, tcclient.Time(time.Now()).String())
-	if err != nil {
-		t.Fatalf("Error parsing timestamp - %v", err)
-	}
-	return
-}
-
-// If an artifact expires before task deadline we should get a Malformed Payload
-func TestArtifactExpiresBeforeDeadline(t *testing.T) {
-	now := NowMillis(t)
+// Schema violations should be recorded with JSON pointers to the offending
+// values, for publishing in artifact public/payload-validation.json
+func TestPayloadViolations(t *testing.T) {
 	task := taskWithPayload(`{
   "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
+    "GITHUB_PULL_REQUEST": 37,
+    "a/b~c": 38
   },
   "maxRunTime": 3,
-  "command": [` + rawHelloGoodbye() + `],
-  "artifacts": [
-    {
-      "type": "file",
-      "path": "public/some/artifact",
-      "expires": "` + tcclient.Time(now.Add(time.Minute*5)).String() + `"
-    }
-  ]
+  "extraField": "This field is not allowed!",
+  "command": [` + rawHelloGoodbye() + `]
 }`)
-	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
-	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
 	ensureMalformedPayload(t, task)
+	violations := map[string]PayloadViolation{}
+	for _, v := range task.payloadViolations {
+		violations[v.Pointer] = v
+	}
+	for pointer, violationType := range map[string]string{
+		"/env/GITHUB_PULL_REQUEST": "invalid_type",
+		"/env/a~1b~0c":             "invalid_type",
+		"":                         "additional_property_not_allowed",
+	} {
+		v, found := violations[pointer]
+		if !found {
+			t.Fatalf("Was expecting a payload violation with pointer %q but got violations %#v", pointer, task.payloadViolations)
+		}
+		if v.Type != violationType || v.Message == "" {
+			t.Errorf("Was expecting a payload violation of type %v with a message at %q but got %#v", violationType, pointer, v)
+		}
+	}
+	if violations[""].Details["property"] != "extraField" {
+		t.Errorf("Was expecting the additional property violation to name property extraField but got %#v", violations[""])
+	}
 }
 
-// If artifact expires with task deadline, we should not get a Malformed Payload
-func TestArtifactExpiresWithDeadline(t *testing.T) {
-	now := NowMillis(t)
-	task := taskWithPayload(`{
-  "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
-  },
-  "maxRunTime": 3,
-  "command": [` + rawHelloGoodbye() + `],
-  "artifacts": [
-    {
-      "type": "file",
-      "path": "public/some/artifact",
-      "expires": "` + tcclient.Time(now.Add(time.Minute*10)).String() + `"
-    }
-  ]
-}`)
-	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
-	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
-	ensureValidPayload(t, task)
-}
-
-// If artifact expires after task deadline, but before task expiry, we should not get a Malformed Payload
-func TestArtifactExpiresBetweenDeadlineAndTaskExpiry(t *testing.T) {
-	now := NowMillis(t)
-	task := taskWithPayload(`{
-  "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
-  },
-  "maxRunTime": 3,
-  "command": [` + rawHelloGoodbye() + `],
-  "artifacts": [
-    {
-      "type": "file",
-      "path": "public/some/artifact",
-      "expires": "` + tcclient.Time(now.Add(time.Minute*15)).String() + `"
-    }
-  ]
-}`)
-	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
-	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
-	ensureValidPayload(t, task)
-}
-
-// If artifact expires with task expiry, we should not get a Malformed Payload
-func TestArtifactExpiresWithTask(t *testing.T) {
-	now := NowMillis(t)
-	task := taskWithPayload(`{
+// At least one command must be specified
+func TestNoCommandsSpecified(t *testing.T) {
+	ensureMalformedPayload(t, taskWithPayload(`{
   "env": {
     "XPI_NAME": "dist/example_add-on-0.0.1.zip"
   },
   "maxRunTime": 3,
-  "command": [` + rawHelloGoodbye() + `],
-  "artifacts": [
-    {
-      "type": "file",
-      "path": "public/some/artifact",
-      "expires": "` + tcclient.Time(now.Add(time.Minute*20)).String() + `"
-    }
-  ]
-}`)
-	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
-	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
-	ensureValidPayload(t, task)
+  "command": []
+}`))
 }
 
-// If an artifact expires after task expiry we should get a Malformed Payload
-func TestArtifactExpiresAfterTaskExpiry(t *testing.T) {
-	now := NowMillis(t)
+// Unsupported features should be reported with a hint
+func TestUnsupportedFeatureHint(t *testing.T) {
 	task := taskWithPayload(`{
-  "env": {
-    "XPI_NAME": "dist/example_add-on-0.0.1.zip"
-  },
   "maxRunTime": 3,
   "command": [` + rawHelloGoodbye() + `],
-  "artifacts": [
-    {
-      "type": "file",
-      "path": "public/some/artifact",
-      "expires": "` + tcclient.Time(now.Add(time.Minute*25)).String() + `"
-    }
-  ]
+  "features": {
+    "noSuchFeature": true
+  }
 }`)
-	task.Definition.Deadline = tcclient.Time(now.Add(time.Minute * 10))
-	task.Definition.Expires = tcclient.Time(now.Add(time.Minute * 20))
 	ensureMalformedPayload(t, task)
-}
-
-func TestInvalidPayload(t *testing.T) {
-	defer setup(t)()
-
-	td := testTask(t)
-	td.Payload = json.RawMessage(`
-{
-  "command": [` + rawHelloGoodbye() + `],
-  "maxRunTime": 60,
-  "mounts": [
-    {
-      "content": {
-        "sha356": "9ded97d830bef3734ea6de70df0159656d6a63e01484175b34d72b8db326bda0",
-        "url": "https://storage.googleapis.com/golang/go1.10.8.windows-386.zip"
-      },
-      "directory": "go1.10.8",
-      "format": "zip"
-    }
-  ]
-}`)
-
-	_ = submitAndAssert(t, td, GenericWorkerPayload{}, "exception", "malformed-payload")
+	for _, v := range task.payloadViolations {
+		if v.Pointer == "/features" && v.Type == "additional_property_not_allowed" {
+			if !strings.Contains(v.Hint, `"noSuchFeature"`) || !strings.Contains(v.Hint, engine) {
+				t.Fatalf("Was expecting hint to name feature and engine, but got %q", v.Hint)
+			}
+			return
+		}
+	}
+	t.Fatalf("Was expecting a payload violation of the features but got %#v", task.payloadViolations)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const payloadValidationArtifactName = "public/payload-validation.json"
+
+var (
+	// path, relative to task directory, of the payload validation report
+	payloadValidationPath = filepath.Join("generic-worker", "payload-validation.json")
+)
+
+type (
+	// PayloadViolation is a violation of the payload schema by the task
+	// payload
+	PayloadViolation struct {
+		// JSON pointer (RFC 6901) to the value in the task payload that
+		// violates the schema, e.g. "/env/GITHUB_PULL_REQUEST", or "" for the
+		// payload itself
+		Pointer string `json:"pointer"`
+		// Type of violation, e.g. "invalid_type" or "required"
+		Type string `json:"type"`
+		// Description of the violation in English
+		Message string `json:"message"`
+		// Additional information about the violation, such as the name of a
+		// missing property, which depends on the type of violation
+		Details map[string]interface{} `json:"details,omitempty"`
+		// How to fix the violation, if known
+		Hint string `json:"hint,omitempty"`
+	}
+
+	// PayloadValidationReport is the content of artifact
+	// public/payload-validation.json
+	PayloadValidationReport struct {
+		TaskID     string             `json:"taskId"`
+		RunID      uint               `json:"runId"`
+		Violations []PayloadViolation `json:"violations"`
+	}
+)
+
+func payloadViolations(result *gojsonschema.Result) []PayloadViolation {
+	violations := make([]PayloadViolation, len(result.Errors()))
+	for i, e := range result.Errors() {
+		details := map[string]interface{}{}
+		for k, v := range e.Details() {
+			// context and field are already represented by the pointer
+			if k != "context" && k != "field" {
+				details[k] = v
+			}
+		}
+		violations[i] = PayloadViolation{
+			Pointer: jsonPointer(e.Context()),
+			Type:    e.Type(),
+			Message: e.Description(),
+			Details: details,
+		}
+	}
+	return violations
+}
+
+// jsonPointer returns the JSON pointer that corresponds to the given
+// gojsonschema context, which is rooted at "(root)"
+func jsonPointer(context *gojsonschema.JsonContext) string {
+	if context == nil {
+		return ""
+	}
+	// use a delimiter that cannot occur in the task payload, so that
+	// property names containing "." or "/" are not split
+	tokens := strings.Split(context.String("\x00"), "\x00")
+	pointer := ""
+	for _, token := range tokens[1:] {
+		pointer += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+	}
+	return pointer
+}
+
+// uploadPayloadViolations publishes the payload violations of the task
+// as artifact public/payload-validation.json, for tooling to interpret
+func (task *TaskRun) uploadPayloadViolations() *CommandExecutionError {
+	report, err := json.MarshalIndent(
+		&PayloadValidationReport{
+			TaskID:     task.TaskID,
+			RunID:      task.RunID,
+			Violations: task.payloadViolations,
+		},
+		"",
+		"  ",
+	)
+	if err != nil {
+		panic(err)
+	}
+	file := filepath.Join(taskContext.TaskDir, payloadValidationPath)
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		panic(err)
+	}
+	err = ioutil.WriteFile(file, report, 0644)
+	if err != nil {
+		panic(err)
+	}
+	task.Errorf("See artifact %v for details of the payload violations", payloadValidationArtifactName)
+	return task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    payloadValidationArtifactName,
+				Expires: task.Definition.Expires,
+			},
+			ContentType:     "application/json; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            payloadValidationPath,
+		},
+	)
+}
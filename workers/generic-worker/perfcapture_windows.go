@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+const (
+	perfCountersArtifactName = "public/performance/counters.csv"
+	etwTraceArtifactName     = "public/performance/trace.etl"
+)
+
+var (
+	// paths relative to task directory
+	perfCountersPath = filepath.Join("generic-worker", "counters.csv")
+	etwTracePath     = filepath.Join("generic-worker", "trace.etl")
+)
+
+// scope required by tasks in order to use the feature
+const performanceCaptureScope scopes.Pattern = "generic-worker:performance-capture:<provisionerId>/<workerType>"
+
+type PerformanceCaptureFeature struct {
+}
+
+func (feature *PerformanceCaptureFeature) Name() string {
+	return "Performance Capture"
+}
+
+func (feature *PerformanceCaptureFeature) PayloadName() string {
+	return "performanceCapture"
+}
+
+func (feature *PerformanceCaptureFeature) ScopePattern() scopes.Pattern {
+	return performanceCaptureScope
+}
+
+func (feature *PerformanceCaptureFeature) Initialise() error {
+	return nil
+}
+
+func (feature *PerformanceCaptureFeature) PersistState() error {
+	return nil
+}
+
+// Performance capture is only enabled when task.payload.performanceCapture
+// requests counters and/or an ETW trace
+func (feature *PerformanceCaptureFeature) IsEnabled(task *TaskRun) bool {
+	capture := task.Payload.PerformanceCapture
+	return len(capture.Counters) > 0 || capture.EtwProfile != ""
+}
+
+type PerformanceCaptureTask struct {
+	task *TaskRun
+	// name of the logman data collector, if counters are being sampled
+	collector string
+	// whether an ETW trace is being recorded
+	tracing bool
+}
+
+func (feature *PerformanceCaptureFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &PerformanceCaptureTask{
+		task: task,
+	}
+}
+
+func (pc *PerformanceCaptureTask) RequiredScopes() scopes.Expression {
+	return workerScope(performanceCaptureScope)
+}
+
+func (pc *PerformanceCaptureTask) ReservedArtifacts() []string {
+	return []string{
+		perfCountersArtifactName,
+		etwTraceArtifactName,
+	}
+}
+
+// Start begins sampling counters and recording a trace. Captures are purely
+// diagnostic, so failures are logged rather than failing the task.
+func (pc *PerformanceCaptureTask) Start() *CommandExecutionError {
+	capture := pc.task.Payload.PerformanceCapture
+	err := os.MkdirAll(filepath.Join(taskContext.TaskDir, "generic-worker"), 0755)
+	if err != nil {
+		panic(err)
+	}
+	if len(capture.Counters) > 0 {
+		pc.startCounters(capture.Counters, capture.SampleInterval)
+	}
+	if capture.EtwProfile != "" {
+		pc.startTrace(capture.EtwProfile)
+	}
+	return nil
+}
+
+func (pc *PerformanceCaptureTask) startCounters(counters []string, sampleInterval int64) {
+	if sampleInterval < 1 {
+		sampleInterval = 1
+	}
+	collector := "generic-worker-" + pc.task.TaskID
+	// remove any collector left over from an earlier worker crash
+	_, _ = host.CombinedOutput("logman", "delete", collector)
+	args := []string{"create", "counter", collector, "-c"}
+	args = append(args, counters...)
+	args = append(args,
+		"-si", strconv.FormatInt(sampleInterval, 10),
+		"-f", "csv",
+		"-o", filepath.Join(taskContext.TaskDir, perfCountersPath),
+		// don't append a version number to the output file name
+		"--v",
+		"-ow",
+		"-y",
+	)
+	out, err := host.CombinedOutput("logman", args...)
+	if err != nil {
+		pc.task.Warnf("[performance] Could not create performance counter collector: %v\n%v", err, out)
+		return
+	}
+	out, err = host.CombinedOutput("logman", "start", collector)
+	if err != nil {
+		pc.task.Warnf("[performance] Could not start performance counter collector: %v\n%v", err, out)
+		_, _ = host.CombinedOutput("logman", "delete", collector)
+		return
+	}
+	pc.collector = collector
+	pc.task.Infof("[performance] Sampling %v performance counter(s) every %v second(s)", len(counters), sampleInterval)
+}
+
+func (pc *PerformanceCaptureTask) startTrace(profile string) {
+	// only one WPR session can run at a time, so cancel any session left over
+	// from an earlier worker crash
+	_, _ = host.CombinedOutput("wpr", "-cancel")
+	out, err := host.CombinedOutput("wpr", "-start", profile, "-filemode")
+	if err != nil {
+		pc.task.Warnf("[performance] Could not start ETW trace with profile %v: %v\n%v", profile, err, out)
+		return
+	}
+	pc.tracing = true
+	pc.task.Infof("[performance] Recording ETW trace with profile %v", profile)
+}
+
+func (pc *PerformanceCaptureTask) Stop(err *ExecutionErrors) {
+	if pc.collector != "" {
+		out, e := host.CombinedOutput("logman", "stop", pc.collector)
+		if e != nil {
+			pc.task.Warnf("[performance] Could not stop performance counter collector: %v\n%v", e, out)
+		}
+		_, _ = host.CombinedOutput("logman", "delete", pc.collector)
+		pc.uploadCapture(err, perfCountersArtifactName, perfCountersPath, "text/csv; charset=utf-8")
+	}
+	if pc.tracing {
+		out, e := host.CombinedOutput("wpr", "-stop", filepath.Join(taskContext.TaskDir, etwTracePath))
+		if e != nil {
+			pc.task.Warnf("[performance] Could not stop ETW trace: %v\n%v", e, out)
+			_, _ = host.CombinedOutput("wpr", "-cancel")
+		}
+		pc.uploadCapture(err, etwTraceArtifactName, etwTracePath, "application/octet-stream")
+	}
+}
+
+// uploadCapture uploads the capture file at the given path (relative to the
+// task directory), if it was written
+func (pc *PerformanceCaptureTask) uploadCapture(err *ExecutionErrors, name, path, contentType string) {
+	if _, e := os.Stat(filepath.Join(taskContext.TaskDir, path)); e != nil {
+		pc.task.Warnf("[performance] No capture to upload as %v: %v", name, e)
+		return
+	}
+	err.add(pc.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    name,
+				Expires: pc.task.Definition.Expires,
+			},
+			ContentType:     contentType,
+			ContentEncoding: "gzip",
+			Path:            path,
+		},
+	))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestPerformanceCaptureMissingScopes(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 10,
+		PerformanceCapture: PerformanceCapture{
+			Counters: []string{
+				`\Processor(_Total)\% Processor Time`,
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestPerformanceCounters(t *testing.T) {
+	defer setup(t)()
+	if config.RunTasksAsCurrentUser {
+		t.Skip("Skipping since running as current user...")
+	}
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		PerformanceCapture: PerformanceCapture{
+			Counters: []string{
+				`\Processor(_Total)\% Processor Time`,
+				`\Memory\Available MBytes`,
+			},
+			SampleInterval: 1,
+		},
+	}
+	td := testTask(t)
+	td.Scopes = []string{
+		"generic-worker:performance-capture:" + td.ProvisionerID + "/" + td.WorkerType,
+	}
+
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	artifacts, err := testQueue.ListArtifacts(taskID, "0", "", "")
+	if err != nil {
+		t.Fatalf("Error listing artifacts: %v", err)
+	}
+	for _, artifact := range artifacts.Artifacts {
+		if artifact.Name == perfCountersArtifactName {
+			return
+		}
+	}
+	t.Fatalf("Was expecting artifact %v in task %v", perfCountersArtifactName, taskID)
+}
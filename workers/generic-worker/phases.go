@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const phasesArtifactName = "public/phases.json"
+
+// path, relative to task directory, of the phases summary
+var phasesPath = filepath.Join("generic-worker", "phases.json")
+
+type (
+	// PhaseResult is an entry of artifact public/phases.json
+	PhaseResult struct {
+		Name string `json:"name"`
+		// index of the first command of the phase
+		FirstCommand int   `json:"firstCommand"`
+		Commands     int64 `json:"commands"`
+		// one of "completed", "failed", "aborted" or "skipped"
+		State string `json:"state"`
+		// exit code of the last command of the phase that was run
+		ExitCode        *int64         `json:"exitCode,omitempty"`
+		Started         *tcclient.Time `json:"started,omitempty"`
+		Resolved        *tcclient.Time `json:"resolved,omitempty"`
+		DurationSeconds float64        `json:"durationSeconds"`
+	}
+
+	PhasesFeature struct {
+	}
+
+	PhasesTask struct {
+		task   *TaskRun
+		phases []*PhaseResult
+		// index into phases of each task command
+		commandPhase []int
+		// when the phase that is currently running started
+		started time.Time
+	}
+)
+
+func (feature *PhasesFeature) Name() string {
+	return "Phases"
+}
+
+func (feature *PhasesFeature) Initialise() error {
+	return nil
+}
+
+func (feature *PhasesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *PhasesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Phases) > 0
+}
+
+func (feature *PhasesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &PhasesTask{
+		task: task,
+	}
+}
+
+func (pt *PhasesTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (pt *PhasesTask) ReservedArtifacts() []string {
+	return []string{
+		phasesArtifactName,
+	}
+}
+
+func (pt *PhasesTask) Start() *CommandExecutionError {
+	err := pt.initPhases(len(pt.task.Payload.Command))
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	pt.task.beforeCommand = append(pt.task.beforeCommand, pt.commandStarting)
+	pt.task.afterCommand = append(pt.task.afterCommand, func(index int, result *process.Result) {
+		exitCode := int64(result.ExitCode())
+		failed := result.Failed() && !pt.task.IsSuccessExitCode(exitCode)
+		pt.commandFinished(index, exitCode, failed, pt.task.StatusManager.AbortException() != nil)
+	})
+	return nil
+}
+
+// Stop publishes the phases summary. A phase that was running when the task
+// ended (e.g. because the task was aborted between commands) is reported as
+// aborted.
+func (pt *PhasesTask) Stop(err *ExecutionErrors) {
+	if pt.phases == nil {
+		return
+	}
+	for _, phase := range pt.phases {
+		if phase.Started != nil && phase.Resolved == nil {
+			pt.finishPhase(phase, "aborted")
+		}
+	}
+	data, e := json.MarshalIndent(
+		map[string]interface{}{
+			"phases": pt.phases,
+		},
+		"",
+		"  ",
+	)
+	if e != nil {
+		panic(e)
+	}
+	file := filepath.Join(taskContext.TaskDir, phasesPath)
+	e = os.MkdirAll(filepath.Dir(file), 0700)
+	if e != nil {
+		panic(e)
+	}
+	e = ioutil.WriteFile(file, data, 0644)
+	if e != nil {
+		panic(e)
+	}
+	err.add(pt.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    phasesArtifactName,
+				Expires: pt.task.Definition.Expires,
+			},
+			ContentType:     "application/json; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            phasesPath,
+		},
+	))
+}
+
+// initPhases checks that the phases in the task payload cover the given
+// number of task commands, and that their names are unique
+func (pt *PhasesTask) initPhases(commands int) error {
+	names := map[string]bool{}
+	phases := []*PhaseResult{}
+	commandPhase := []int{}
+	for i, phase := range pt.task.Payload.Phases {
+		if names[phase.Name] {
+			return fmt.Errorf("Phase name %q appears more than once in task.payload.phases", phase.Name)
+		}
+		names[phase.Name] = true
+		phases = append(phases, &PhaseResult{
+			Name:         phase.Name,
+			FirstCommand: len(commandPhase),
+			Commands:     phase.Commands,
+			State:        "skipped",
+		})
+		for j := int64(0); j < phase.Commands; j++ {
+			commandPhase = append(commandPhase, i)
+		}
+	}
+	if len(commandPhase) != commands {
+		return fmt.Errorf("The phases in task.payload.phases have %v commands in total, but the task has %v commands", len(commandPhase), commands)
+	}
+	pt.phases = phases
+	pt.commandPhase = commandPhase
+	return nil
+}
+
+func (pt *PhasesTask) commandStarting(index int) {
+	phase := pt.phases[pt.commandPhase[index]]
+	if phase.FirstCommand != index {
+		return
+	}
+	pt.started = time.Now()
+	started := tcclient.Time(pt.started)
+	phase.Started = &started
+	pt.task.Log("", stepMarker("Started", phase.Name, 0, 0, pt.started))
+}
+
+func (pt *PhasesTask) commandFinished(index int, exitCode int64, failed, aborted bool) {
+	phase := pt.phases[pt.commandPhase[index]]
+	phase.ExitCode = &exitCode
+	switch {
+	case aborted:
+		pt.finishPhase(phase, "aborted")
+	case failed:
+		pt.finishPhase(phase, "failed")
+	case index == phase.FirstCommand+int(phase.Commands)-1:
+		pt.finishPhase(phase, "completed")
+	}
+}
+
+func (pt *PhasesTask) finishPhase(phase *PhaseResult, state string) {
+	now := time.Now()
+	resolved := tcclient.Time(now)
+	phase.Resolved = &resolved
+	phase.State = state
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	duration := now.Round(0).Sub(pt.started.Round(0))
+	phase.DurationSeconds = duration.Seconds()
+	// buildbot result codes, which Treeherder understands
+	results := 0
+	switch state {
+	case "failed":
+		results = 2
+	case "aborted":
+		results = 4
+	}
+	pt.task.Log("", stepMarker("Finished", phase.Name, results, duration, now))
+}
+
+// stepMarker returns a log line that Treeherder's log parser recognises as
+// the start or end of a step
+func stepMarker(markerType, name string, results int, elapsed time.Duration, at time.Time) string {
+	return fmt.Sprintf("========= %v %v (results: %v, elapsed: %v secs) (at %v) =========", markerType, name, results, int(elapsed.Seconds()), at.UTC().Format("2006-01-02 15:04:05.000000"))
+}
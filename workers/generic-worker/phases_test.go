@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func newPhasesTask(phases ...Phase) (*PhasesTask, *bytes.Buffer) {
+	log := &bytes.Buffer{}
+	task := &TaskRun{
+		logWriter: log,
+	}
+	task.Payload.Phases = phases
+	return &PhasesTask{task: task}, log
+}
+
+func TestPhasesMustCoverCommands(t *testing.T) {
+	pt, _ := newPhasesTask(Phase{Name: "build", Commands: 2}, Phase{Name: "test", Commands: 1})
+	if err := pt.initPhases(4); err == nil {
+		t.Fatal("Was expecting an error since phases cover 3 of 4 commands")
+	}
+	pt, _ = newPhasesTask(Phase{Name: "build", Commands: 1}, Phase{Name: "build", Commands: 1})
+	if err := pt.initPhases(2); err == nil {
+		t.Fatal("Was expecting an error since phase name build is not unique")
+	}
+}
+
+func TestPhaseResults(t *testing.T) {
+	pt, log := newPhasesTask(Phase{Name: "setup", Commands: 1}, Phase{Name: "build", Commands: 2}, Phase{Name: "test", Commands: 1})
+	if err := pt.initPhases(4); err != nil {
+		t.Fatalf("Could not initialise phases: %v", err)
+	}
+	pt.commandStarting(0)
+	pt.commandFinished(0, 0, false, false)
+	pt.commandStarting(1)
+	pt.commandFinished(1, 0, false, false)
+	pt.commandStarting(2)
+	pt.commandFinished(2, 3, true, false)
+
+	expected := []struct {
+		state    string
+		exitCode int64
+	}{
+		{"completed", 0},
+		{"failed", 3},
+		{"skipped", -1},
+	}
+	for i, e := range expected {
+		phase := pt.phases[i]
+		if phase.State != e.state {
+			t.Fatalf("Was expecting phase %v to be %v, but it is %v", phase.Name, e.state, phase.State)
+		}
+		if e.exitCode < 0 {
+			if phase.ExitCode != nil || phase.Started != nil {
+				t.Fatalf("Was expecting phase %v not to have run, but it has exit code %v", phase.Name, *phase.ExitCode)
+			}
+			continue
+		}
+		if phase.ExitCode == nil || *phase.ExitCode != e.exitCode {
+			t.Fatalf("Was expecting phase %v to have exit code %v, but got %v", phase.Name, e.exitCode, phase.ExitCode)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Was expecting 4 step markers in log, but got:\n%v", log.String())
+	}
+	for i, prefix := range []string{
+		"========= Started setup (results: 0, elapsed: 0 secs) (at ",
+		"========= Finished setup (results: 0, elapsed: ",
+		"========= Started build (results: 0, elapsed: 0 secs) (at ",
+		"========= Finished build (results: 2, elapsed: ",
+	} {
+		if !strings.HasPrefix(lines[i], prefix) || !strings.HasSuffix(lines[i], ") =========") {
+			t.Fatalf("Was expecting log line %v to be a step marker starting with %q, but got %q", i, prefix, lines[i])
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+type (
+	PortLeasesFeature struct {
+	}
+
+	PortLeasesTask struct {
+		task *TaskRun
+	}
+
+	// portLeaser leases ports from a range, recording each lease as a file in
+	// a directory that is shared by all workers on the host
+	portLeaser struct {
+		dir     string
+		minPort uint16
+		maxPort uint16
+	}
+
+	// portLease is a port that has been leased to a task
+	portLease struct {
+		PortLease
+		Port uint16
+		// path of the lease file
+		file string
+	}
+
+	// portLeaseRecord is the content of a lease file
+	portLeaseRecord struct {
+		TaskID   string        `json:"taskId"`
+		RunID    uint          `json:"runId"`
+		WorkerID string        `json:"workerId"`
+		Expires  tcclient.Time `json:"expires"`
+	}
+)
+
+func (feature *PortLeasesFeature) Name() string {
+	return "Port Leases"
+}
+
+func (feature *PortLeasesFeature) Initialise() error {
+	return nil
+}
+
+func (feature *PortLeasesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *PortLeasesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.PortLeases) > 0
+}
+
+func (feature *PortLeasesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &PortLeasesTask{
+		task: task,
+	}
+}
+
+func (plt *PortLeasesTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (plt *PortLeasesTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (plt *PortLeasesTask) Start() *CommandExecutionError {
+	names := map[string]bool{}
+	for _, pl := range plt.task.Payload.PortLeases {
+		if names[pl.Name] {
+			return MalformedPayloadError(fmt.Errorf("Port lease name %q appears more than once in task.payload.portLeases", pl.Name))
+		}
+		names[pl.Name] = true
+	}
+	leaser := &portLeaser{
+		dir:     config.PortLeasesDir,
+		minPort: config.PortLeaseMinPort,
+		maxPort: config.PortLeaseMaxPort,
+	}
+	record := &portLeaseRecord{
+		TaskID:   plt.task.TaskID,
+		RunID:    plt.task.RunID,
+		WorkerID: config.WorkerID,
+		// the task cannot run beyond its deadline, so leases of a worker
+		// that dies without releasing them become available again then
+		Expires: plt.task.Definition.Deadline,
+	}
+	for _, pl := range plt.task.Payload.PortLeases {
+		lease, err := leaser.lease(pl, record)
+		if err != nil {
+			return ResourceUnavailable(fmt.Errorf("[port leases] Could not lease %v port for %v: %v", lease.protocol(), pl.Name, err))
+		}
+		plt.task.leasedPorts = append(plt.task.leasedPorts, lease)
+		err = plt.task.setVariable(pl.Name, strconv.Itoa(int(lease.Port)))
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[port leases] Could not set environment variable %v: %v", pl.Name, err))
+		}
+		plt.task.Infof("[port leases] Leased %v port %v as %v", lease.protocol(), lease.Port, pl.Name)
+	}
+	return nil
+}
+
+func (plt *PortLeasesTask) Stop(err *ExecutionErrors) {
+	for _, lease := range plt.task.leasedPorts {
+		if e := os.Remove(lease.file); e != nil {
+			plt.task.Warnf("[port leases] Could not release %v port %v: %v", lease.protocol(), lease.Port, e)
+			continue
+		}
+		plt.task.Infof("[port leases] Released %v port %v", lease.protocol(), lease.Port)
+	}
+	plt.task.leasedPorts = nil
+}
+
+// lease leases the lowest port in the range that isn't leased to another
+// task, and that nothing is currently listening on
+func (leaser *portLeaser) lease(pl PortLease, record *portLeaseRecord) (*portLease, error) {
+	lease := &portLease{
+		PortLease: pl,
+	}
+	if leaser.minPort == 0 || leaser.minPort > leaser.maxPort {
+		return lease, fmt.Errorf("invalid port lease range %v-%v in worker config", leaser.minPort, leaser.maxPort)
+	}
+	err := os.MkdirAll(leaser.dir, 0755)
+	if err != nil {
+		return lease, err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		panic(err)
+	}
+	for port := int(leaser.minPort); port <= int(leaser.maxPort); port++ {
+		lease.Port = uint16(port)
+		lease.file = filepath.Join(leaser.dir, fmt.Sprintf("%v-%v.json", lease.protocol(), port))
+		if !leaser.claim(lease.file, data) {
+			continue
+		}
+		if portFree(lease.protocol(), lease.Port) {
+			return lease, nil
+		}
+		_ = os.Remove(lease.file)
+	}
+	return lease, fmt.Errorf("all ports %v-%v are in use", leaser.minPort, leaser.maxPort)
+}
+
+// claim atomically creates the lease file with the given content, returning
+// false if another task holds an unexpired lease on the file
+func (leaser *portLeaser) claim(file string, data []byte) bool {
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = f.Write(data)
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(file)
+				return false
+			}
+			return true
+		}
+		if !os.IsExist(err) || !leaseExpired(file) {
+			return false
+		}
+		// expired lease of a worker that didn't release it
+		_ = os.Remove(file)
+	}
+	return false
+}
+
+func leaseExpired(file string) bool {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	var record portLeaseRecord
+	// a lease file that can't be parsed may be being written by another
+	// worker, so is considered to be held
+	if json.Unmarshal(data, &record) != nil {
+		return false
+	}
+	return time.Now().After(time.Time(record.Expires))
+}
+
+// portFree returns whether nothing is listening on the given port
+func portFree(protocol string, port uint16) bool {
+	address := ":" + strconv.Itoa(int(port))
+	if protocol == "udp" {
+		conn, err := net.ListenPacket("udp", address)
+		if err != nil {
+			return false
+		}
+		return conn.Close() == nil
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return false
+	}
+	return listener.Close() == nil
+}
+
+func (lease *portLease) protocol() string {
+	if lease.Protocol == "" {
+		return "tcp"
+	}
+	return lease.Protocol
+}
+
+// leasedPortEnv returns the environment variables that hold the given leased
+// ports, as NAME=VALUE strings
+func leasedPortEnv(leasedPorts []*portLease) []string {
+	env := []string{}
+	for _, lease := range leasedPorts {
+		env = append(env, lease.Name+"="+strconv.Itoa(int(lease.Port)))
+	}
+	return env
+}
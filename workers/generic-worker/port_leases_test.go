@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+func TestPortLeasesDoNotClash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "port-leases")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// find a free range of three ports, and occupy the first one
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	defer listener.Close()
+	occupied := uint16(listener.Addr().(*net.TCPAddr).Port)
+	if occupied > 65533 {
+		t.Skip("Listening port too high to test a range above it")
+	}
+	leaser := &portLeaser{
+		dir:     dir,
+		minPort: occupied,
+		maxPort: occupied + 2,
+	}
+	record := &portLeaseRecord{
+		TaskID:  "task-a",
+		Expires: tcclient.Time(time.Now().Add(time.Hour)),
+	}
+
+	first, err := leaser.lease(PortLease{Name: "A"}, record)
+	if err != nil {
+		t.Fatalf("Could not lease port: %v", err)
+	}
+	if first.Port == occupied {
+		t.Fatalf("Leased port %v that is being listened on", occupied)
+	}
+	second, err := leaser.lease(PortLease{Name: "B"}, record)
+	if err == nil && second.Port == first.Port {
+		t.Fatalf("Leased port %v twice", first.Port)
+	}
+	// leases are per protocol
+	udp, err := leaser.lease(PortLease{Name: "C", Protocol: "udp"}, record)
+	if err != nil {
+		t.Fatalf("Could not lease udp port: %v", err)
+	}
+	if env := leasedPortEnv([]*portLease{first, udp}); env[0] != "A="+strconv.Itoa(int(first.Port)) || env[1] != "C="+strconv.Itoa(int(udp.Port)) {
+		t.Fatalf("Unexpected environment variables %q", env)
+	}
+}
+
+func TestExpiredPortLeaseIsReused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "port-leases")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatalf("Could not listen: %v", err)
+	}
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+	listener.Close()
+	leaser := &portLeaser{
+		dir:     dir,
+		minPort: port,
+		maxPort: port,
+	}
+	expired := &portLeaseRecord{
+		TaskID:  "task-a",
+		Expires: tcclient.Time(time.Now().Add(-time.Minute)),
+	}
+	if _, err := leaser.lease(PortLease{Name: "A"}, expired); err != nil {
+		t.Fatalf("Could not lease port: %v", err)
+	}
+	current := &portLeaseRecord{
+		TaskID:  "task-b",
+		Expires: tcclient.Time(time.Now().Add(time.Hour)),
+	}
+	if _, err := leaser.lease(PortLease{Name: "A"}, current); err != nil {
+		t.Fatalf("Could not lease port with expired lease: %v", err)
+	}
+	if _, err := leaser.lease(PortLease{Name: "A"}, current); err == nil {
+		t.Fatalf("Leased port %v with unexpired lease", port)
+	}
+}
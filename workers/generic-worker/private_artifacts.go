@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const (
+	publicArtifactPrefix = "public/"
+	// prefix that replaces publicArtifactPrefix in artifact names when config
+	// setting forcePrivateArtifacts is enabled
+	privateArtifactPrefix = "private/"
+)
+
+// PrivateArtifactsFeature validates artifacts that the task payload marks as
+// private. Publishing all artifacts as private (config setting
+// forcePrivateArtifacts) happens when artifacts are uploaded, so that it
+// also applies to artifacts that features create.
+type PrivateArtifactsFeature struct {
+}
+
+func (feature *PrivateArtifactsFeature) Name() string {
+	return "Private Artifacts"
+}
+
+func (feature *PrivateArtifactsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *PrivateArtifactsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *PrivateArtifactsFeature) IsEnabled(task *TaskRun) bool {
+	for _, artifact := range task.Payload.Artifacts {
+		if artifact.Private {
+			return true
+		}
+	}
+	return false
+}
+
+type PrivateArtifactsTask struct {
+	task *TaskRun
+}
+
+func (feature *PrivateArtifactsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &PrivateArtifactsTask{
+		task: task,
+	}
+}
+
+// RequiredScopes returns the scopes to download each private artifact. A
+// private artifact that the task itself couldn't download would be of no use
+// to the tasks that it creates to consume it.
+func (pa *PrivateArtifactsTask) RequiredScopes() scopes.Expression {
+	requiredScopes := scopes.AllOf{}
+	for _, artifact := range pa.task.Payload.Artifacts {
+		if !artifact.Private {
+			continue
+		}
+		scope := "queue:get-artifact:" + payloadArtifactName(artifact.Name, artifact.Path)
+		if artifact.Type == "directory" {
+			scope += "/*"
+		}
+		requiredScopes = append(requiredScopes, scopes.Scope(scope))
+	}
+	return requiredScopes
+}
+
+func (pa *PrivateArtifactsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (pa *PrivateArtifactsTask) Start() *CommandExecutionError {
+	for _, artifact := range pa.task.Payload.Artifacts {
+		if name := payloadArtifactName(artifact.Name, artifact.Path); artifact.Private && strings.HasPrefix(name, publicArtifactPrefix) {
+			return MalformedPayloadError(fmt.Errorf("Artifact %v is marked as private, so its name must not begin %v", name, publicArtifactPrefix))
+		}
+	}
+	return nil
+}
+
+func (pa *PrivateArtifactsTask) Stop(err *ExecutionErrors) {
+}
+
+// payloadArtifactName returns the name that a payload artifact is published
+// under, which defaults to its path
+func payloadArtifactName(name, path string) string {
+	if name == "" {
+		return canonicalPath(path)
+	}
+	return name
+}
+
+// publishedArtifactName returns the name that an artifact is published
+// under, taking config setting forcePrivateArtifacts into account
+func publishedArtifactName(name string) string {
+	if config.ForcePrivateArtifacts && strings.HasPrefix(name, publicArtifactPrefix) {
+		return privateArtifactPrefix + strings.TrimPrefix(name, publicArtifactPrefix)
+	}
+	return name
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func privateArtifactsTask(t *testing.T, artifacts string) *TaskRun {
+	task := &TaskRun{}
+	err := json.Unmarshal([]byte(`{"artifacts": `+artifacts+`}`), &task.Payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestPrivateArtifactsRequiredScopes(t *testing.T) {
+	task := privateArtifactsTask(t, `[
+		{"type": "file", "path": "public/build/a.txt"},
+		{"type": "file", "path": "build/b.txt", "name": "project/b.txt", "private": true},
+		{"type": "directory", "path": "build/dir", "private": true}
+	]`)
+	feature := &PrivateArtifactsFeature{}
+	if !feature.IsEnabled(task) {
+		t.Fatal("Was expecting Private Artifacts feature to be enabled")
+	}
+	taskFeature := feature.NewTaskFeature(task)
+	expected := "queue:get-artifact:project/b.txt, and\nqueue:get-artifact:build/dir/*"
+	if requiredScopes := taskFeature.RequiredScopes().String(); requiredScopes != expected {
+		t.Errorf("Was expecting required scopes:\n%v\nbut got:\n%v", expected, requiredScopes)
+	}
+	if err := taskFeature.Start(); err != nil {
+		t.Errorf("Was expecting private artifacts to be valid, but got %v", err)
+	}
+}
+
+func TestPrivateArtifactWithPublicName(t *testing.T) {
+	task := privateArtifactsTask(t, `[{"type": "file", "path": "public/build/a.txt", "private": true}]`)
+	err := (&PrivateArtifactsFeature{}).NewTaskFeature(task).Start()
+	if err == nil || err.Reason != malformedPayload {
+		t.Errorf("Was expecting malformed-payload for private artifact with public name, but got %v", err)
+	}
+}
+
+func TestForcePrivateArtifacts(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	for _, forcePrivateArtifacts := range []bool{false, true} {
+		config.ForcePrivateArtifacts = forcePrivateArtifacts
+		for name, private := range map[string]string{
+			"public/logs/live_backing.log": "private/logs/live_backing.log",
+			"project/b.txt":                "project/b.txt",
+			"publicity/c.txt":              "publicity/c.txt",
+		} {
+			expected := name
+			if forcePrivateArtifacts {
+				expected = private
+			}
+			if published := publishedArtifactName(name); published != expected {
+				t.Errorf("forcePrivateArtifacts %v: was expecting artifact %v to be published as %v but got %v", forcePrivateArtifacts, name, expected, published)
+			}
+		}
+	}
+}
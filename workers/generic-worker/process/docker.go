@@ -15,6 +15,15 @@ import (
 	"golang.org/x/net/context"
 )
 
+const (
+	// DefaultImage is the docker image that task commands run in, unless
+	// another image is set with SetImage
+	DefaultImage = "ubuntu"
+	// ContainerLabel is the label of the containers that task commands run
+	// in, so that the worker can garbage collect them
+	ContainerLabel = "net.taskcluster.generic-worker"
+)
+
 type PlatformData struct{}
 
 func (pd *PlatformData) ReleaseResources() error {
@@ -33,16 +42,27 @@ type Command struct {
 	cmd              []string
 	workingDirectory string
 	env              []string
+	image            string
 }
 
 func (c *Command) SetEnv(envVar, value string) {
 	c.env = append(c.env, envVar+"="+value)
 }
 
+// SetImage sets the docker image that the command runs in
+func (c *Command) SetImage(image string) {
+	c.image = image
+}
+
 func (c *Command) DirectOutput(writer io.Writer) {
 	c.writer = writer
 }
 
+// Reset prepares the command to be executed again, which is a no-op, since
+// each execution runs a new container
+func (c *Command) Reset() {
+}
+
 func (c *Command) String() string {
 	return shell.Escape(c.cmd...)
 }
@@ -50,16 +70,8 @@ func (c *Command) String() string {
 func (c *Command) Execute() (r *Result) {
 	r = &Result{}
 
-	// TODO these need to be configurable
-	dockerPath, err := exec.LookPath("docker")
-	if err != nil {
-		dockerPath = "/usr/bin/docker"
-		log.Printf("Could not find docker in PATH, defaulting to %v", dockerPath)
-	}
-	image := "ubuntu"
-
 	// TODO scary injection potential here
-	cmd := exec.CommandContext(c.ctx, dockerPath, append([]string{"run", image}, c.cmd...)...)
+	cmd := exec.CommandContext(c.ctx, DockerPath(), append([]string{"run", "--label", ContainerLabel, c.image}, c.cmd...)...)
 	// something went horribly wrong
 	if cmd == nil {
 		r.SystemError = fmt.Errorf("nil command")
@@ -74,7 +86,7 @@ func (c *Command) Execute() (r *Result) {
 	startTime := time.Now()
 
 	log.Printf("Running Docker command: %v", c.String())
-	err = cmd.Run()
+	err := cmd.Run()
 	if err != nil {
 		log.Printf("Docker command %v failed: %v", c.String(), err.Error())
 		r.SystemError = err
@@ -121,6 +133,7 @@ func NewCommand(commandLine []string, workingDirectory string, env []string) (*C
 		cmd:              commandLine,
 		workingDirectory: workingDirectory,
 		env:              env,
+		image:            DefaultImage,
 	}
 	return c, nil
 }
@@ -128,3 +141,14 @@ func NewCommand(commandLine []string, workingDirectory string, env []string) (*C
 func (c *Command) Kill() ([]byte, error) {
 	return nil, nil
 }
+
+// DockerPath returns the path of the docker client
+func DockerPath() string {
+	// TODO this needs to be configurable
+	dockerPath, err := exec.LookPath("docker")
+	if err != nil {
+		dockerPath = "/usr/bin/docker"
+		log.Printf("Could not find docker in PATH, defaulting to %v", dockerPath)
+	}
+	return dockerPath
+}
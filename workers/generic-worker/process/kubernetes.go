@@ -0,0 +1,772 @@
+// +build kubernetes
+
+package process
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/shell"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"golang.org/x/net/context"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// mount path, in the task pod, of the volume that holds the task
+	// directory
+	podTaskDir = "/task"
+	// port that the init container and the sidecar of a task pod listen on
+	// to receive and send the content of the task directory
+	syncPort = 8080
+	// file that the task container creates in the task directory when the
+	// task command has exited, so that the sidecar knows it can send the
+	// artifacts
+	doneMarker = ".taskcluster-done"
+)
+
+var (
+	// how often the state of the task pod is polled
+	pollInterval = 2 * time.Second
+	// how long to keep trying to connect to the init container or sidecar of
+	// a task pod, once it is running
+	syncTimeout = 2 * time.Minute
+)
+
+type PlatformData struct{}
+
+func (pd *PlatformData) ReleaseResources() error {
+	return nil
+}
+
+type Result struct {
+	SystemError error
+	// set if the task container could not be run, e.g. because the image
+	// could not be pulled
+	failure  error
+	exitCode int64
+	Duration time.Duration
+}
+
+// Cluster is the Kubernetes cluster that task Jobs are created in, accessed
+// with the service account of the pod that the worker runs in
+type Cluster struct {
+	APIServer string
+	Namespace string
+	client    *http.Client
+}
+
+// Job is the Kubernetes Job of a task
+type Job struct {
+	Name        string
+	Annotations map[string]string
+	Image       string
+	Requests    map[string]string
+	Limits      map[string]string
+	// paths, relative to the task directory, that are copied from the task
+	// pod to the task directory on the worker when the task command has
+	// exited
+	Artifacts []string
+	// paths, relative to the task directory, that are not copied into the
+	// task pod
+	Exclude []string
+	// image of the init container and sidecar that copy the task directory
+	// to and from the task pod
+	SidecarImage          string
+	ActiveDeadlineSeconds int64
+	// secret that the worker sends to the init container and sidecar of the
+	// task pod before copying the task directory, since they listen on the
+	// pod IP, so that other pods can't inject files into the task, or read
+	// its artifacts; set for each execution
+	SyncToken string
+}
+
+type Command struct {
+	ctx              context.Context
+	cancel           context.CancelFunc
+	writer           io.Writer
+	cluster          *Cluster
+	job              *Job
+	cmd              []string
+	workingDirectory string
+	env              []string
+	// name of the Job of the first execution of the command; later
+	// executions append their attempt number to it
+	jobName string
+	attempt int
+}
+
+// NewCluster returns the cluster that the worker pod runs in. If apiServer is
+// empty, the API server of the cluster is taken from the environment, and if
+// namespace is empty, the namespace of the worker pod is used.
+func NewCluster(apiServer, namespace string) (*Cluster, error) {
+	if apiServer == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("env vars KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT are not set, so the worker does not appear to run in a Kubernetes pod")
+		}
+		apiServer = "https://" + net.JoinHostPort(host, port)
+	}
+	if namespace == "" {
+		ns, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, fmt.Errorf("could not read namespace of worker pod: %v", err)
+		}
+		namespace = strings.TrimSpace(string(ns))
+	}
+	ca, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read CA certificate of service account: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("could not parse CA certificate of service account")
+	}
+	return &Cluster{
+		APIServer: strings.TrimSuffix(apiServer, "/"),
+		Namespace: namespace,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy: http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{
+					RootCAs: roots,
+				},
+			},
+		},
+	}, nil
+}
+
+// request makes a request to the Kubernetes API. The service account token is
+// read for every request, since the kubelet rotates it.
+func (c *Cluster) request(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	token, err := ioutil.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("could not read service account token: %v", err)
+	}
+	req, err := http.NewRequest(method, c.APIServer+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &apiError{
+			method:     method,
+			path:       path,
+			statusCode: resp.StatusCode,
+			message:    strings.TrimSpace(string(message)),
+		}
+	}
+	return resp, nil
+}
+
+// call makes a request to the Kubernetes API, and unmarshals the response
+// into result, if not nil
+func (c *Cluster) call(ctx context.Context, method, path string, body, result interface{}) error {
+	resp, err := c.request(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *Cluster) jobsPath() string {
+	return "/apis/batch/v1/namespaces/" + url.PathEscape(c.Namespace) + "/jobs"
+}
+
+func (c *Cluster) podsPath() string {
+	return "/api/v1/namespaces/" + url.PathEscape(c.Namespace) + "/pods"
+}
+
+// deleteJob deletes the given Job and its pod
+func (c *Cluster) deleteJob(name string) error {
+	err := c.call(context.Background(), "DELETE", c.jobsPath()+"/"+url.PathEscape(name)+"?propagationPolicy=Background", nil, nil)
+	if e, ok := err.(*apiError); ok && e.statusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// jobPod returns the pod of the given Job, or nil if it doesn't exist (yet)
+func (c *Cluster) jobPod(ctx context.Context, name string) (*pod, error) {
+	var pods struct {
+		Items []pod `json:"items"`
+	}
+	err := c.call(ctx, "GET", c.podsPath()+"?labelSelector="+url.QueryEscape("job-name="+name), nil, &pods)
+	if err != nil || len(pods.Items) == 0 {
+		return nil, err
+	}
+	return &pods.Items[0], nil
+}
+
+type apiError struct {
+	method     string
+	path       string
+	statusCode int
+	message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("Kubernetes API request %v %v failed with HTTP status %v: %v", e.method, e.path, e.statusCode, e.message)
+}
+
+type (
+	pod struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Status struct {
+			Phase                 string            `json:"phase"`
+			PodIP                 string            `json:"podIP"`
+			InitContainerStatuses []containerStatus `json:"initContainerStatuses"`
+			ContainerStatuses     []containerStatus `json:"containerStatuses"`
+		} `json:"status"`
+	}
+
+	containerStatus struct {
+		Name  string `json:"name"`
+		State struct {
+			Waiting *struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"waiting"`
+			Running    *struct{} `json:"running"`
+			Terminated *struct {
+				ExitCode int64  `json:"exitCode"`
+				Reason   string `json:"reason"`
+			} `json:"terminated"`
+		} `json:"state"`
+	}
+)
+
+// container returns the status of the named container of the pod, or nil if
+// it has no status yet
+func (p *pod) container(name string) *containerStatus {
+	statuses := append(append([]containerStatus{}, p.Status.InitContainerStatuses...), p.Status.ContainerStatuses...)
+	for i := range statuses {
+		if statuses[i].Name == name {
+			return &statuses[i]
+		}
+	}
+	return nil
+}
+
+// unstartableReasons are the reasons of waiting containers that won't start
+// without the task being changed
+var unstartableReasons = map[string]bool{
+	"CreateContainerConfigError": true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+}
+
+// startFailure returns why the named container won't start, or nil if it is
+// starting normally
+func (p *pod) startFailure(name string) error {
+	status := p.container(name)
+	if status == nil || status.State.Waiting == nil || !unstartableReasons[status.State.Waiting.Reason] {
+		return nil
+	}
+	return fmt.Errorf("Container %v of pod %v could not be started: %v: %v", name, p.Metadata.Name, status.State.Waiting.Reason, status.State.Waiting.Message)
+}
+
+// Manifest returns the Kubernetes Job that runs the given command line in the
+// task container, with the given environment variables (in NAME=value form,
+// where later definitions of a variable override earlier ones)
+func (job *Job) Manifest(commandLine []string, env []string) map[string]interface{} {
+	vars := map[string]string{}
+	for _, e := range env {
+		spl := strings.SplitN(e, "=", 2)
+		if len(spl) == 2 {
+			vars[spl[0]] = spl[1]
+		}
+	}
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	podEnv := []interface{}{}
+	for _, name := range names {
+		podEnv = append(podEnv, map[string]interface{}{
+			"name":  name,
+			"value": vars[name],
+		})
+	}
+	taskDirMount := []interface{}{
+		map[string]interface{}{
+			"name":      "task",
+			"mountPath": podTaskDir,
+		},
+	}
+	resources := map[string]interface{}{}
+	if len(job.Requests) > 0 {
+		resources["requests"] = job.Requests
+	}
+	if len(job.Limits) > 0 {
+		resources["limits"] = job.Limits
+	}
+	command := commandLine
+	if len(job.Artifacts) > 0 {
+		// let the sidecar know when the task command has exited, whatever
+		// its exit code
+		command = append([]string{"/bin/sh", "-c", `"$@"; code=$?; touch ` + shell.Escape(podTaskDir+"/"+doneMarker) + `; exit $code`, "sh"}, commandLine...)
+	}
+	containers := []interface{}{
+		map[string]interface{}{
+			"name":         "task",
+			"image":        job.Image,
+			"command":      command,
+			"workingDir":   podTaskDir,
+			"env":          podEnv,
+			"resources":    resources,
+			"volumeMounts": taskDirMount,
+		},
+	}
+	syncEnv := []interface{}{
+		map[string]interface{}{
+			"name":  "SYNC_TOKEN",
+			"value": job.SyncToken,
+		},
+	}
+	if len(job.Artifacts) > 0 {
+		// connections that don't start with the sync token are dropped, and
+		// the sidecar listens again; nc sends what is written to the fifo
+		containers = append(containers, map[string]interface{}{
+			"name":  "artifacts",
+			"image": job.SidecarImage,
+			"command": []string{
+				"/bin/sh",
+				"-c",
+				fmt.Sprintf(`while [ ! -e %v ]; do sleep 1; done; mkfifo /tmp/artifacts; until nc -l -p %v </tmp/artifacts | (read -r token; [ "$token" = "$SYNC_TOKEN" ] || exit 1; cd %v && tar -cf - -- %v 2>/dev/null; exit 0) >/tmp/artifacts; do :; done`, shell.Escape(podTaskDir+"/"+doneMarker), syncPort, podTaskDir, shell.Escape(job.Artifacts...)),
+			},
+			"env":          syncEnv,
+			"volumeMounts": taskDirMount,
+		})
+	}
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"initContainers": []interface{}{
+			map[string]interface{}{
+				"name":  "mounts",
+				"image": job.SidecarImage,
+				// exit code 199 means the connection didn't start with
+				// the sync token
+				"command": []string{
+					"/bin/sh",
+					"-c",
+					fmt.Sprintf(`while :; do nc -l -p %v | (read -r token; [ "$token" = "$SYNC_TOKEN" ] || exit 199; tar -xf - -C %v); code=$?; [ $code = 199 ] || exit $code; done`, syncPort, podTaskDir),
+				},
+				"env":          syncEnv,
+				"volumeMounts": taskDirMount,
+			},
+		},
+		"containers": containers,
+		"volumes": []interface{}{
+			map[string]interface{}{
+				"name":     "task",
+				"emptyDir": map[string]interface{}{},
+			},
+		},
+	}
+	return map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":        job.Name,
+			"annotations": job.Annotations,
+		},
+		"spec": map[string]interface{}{
+			"backoffLimit":          0,
+			"activeDeadlineSeconds": job.ActiveDeadlineSeconds,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": job.Annotations,
+				},
+				"spec": podSpec,
+			},
+		},
+	}
+}
+
+func (c *Command) SetEnv(envVar, value string) {
+	c.env = append(c.env, envVar+"="+value)
+}
+
+func (c *Command) DirectOutput(writer io.Writer) {
+	c.writer = writer
+}
+
+// Reset prepares the command to be executed again. Each execution creates a
+// new Job, with a name of its own, since the Job of the previous execution
+// (and its pod) may still be being deleted.
+func (c *Command) Reset() {
+	c.attempt++
+	c.job.Name = fmt.Sprintf("%v-%v", c.jobName, c.attempt+1)
+}
+
+func (c *Command) String() string {
+	return shell.Escape(c.cmd...)
+}
+
+func (c *Command) Execute() (r *Result) {
+	r = &Result{}
+	startTime := time.Now()
+	defer func() {
+		r.Duration = time.Since(startTime)
+	}()
+
+	c.job.SyncToken, r.SystemError = newSyncToken()
+	if r.SystemError != nil {
+		return
+	}
+	log.Printf("Creating Kubernetes Job %v/%v to run command: %v", c.cluster.Namespace, c.job.Name, c.String())
+	err := c.cluster.call(c.ctx, "POST", c.cluster.jobsPath(), c.job.Manifest(c.cmd, c.env), nil)
+	if err != nil {
+		r.SystemError = err
+		return
+	}
+	defer func() {
+		err := c.cluster.deleteJob(c.job.Name)
+		if err != nil {
+			log.Printf("WARNING: could not delete Kubernetes Job %v: %v", c.job.Name, err)
+		}
+	}()
+
+	// copy the task directory into the task pod
+	p, err := c.waitForPod(func(p *pod) (bool, error) {
+		if err := p.startFailure("mounts"); err != nil {
+			return false, err
+		}
+		status := p.container("mounts")
+		return p.Status.PodIP != "" && status != nil && status.State.Running != nil, nil
+	})
+	if err == nil {
+		err = c.sync(p.Status.PodIP, func(conn net.Conn) error {
+			return writeTar(conn, c.workingDirectory, c.job.Exclude)
+		})
+	}
+	if err == nil {
+		p, err = c.waitForPod(func(p *pod) (bool, error) {
+			if err := p.startFailure("task"); err != nil {
+				return false, err
+			}
+			status := p.container("task")
+			return status != nil && (status.State.Running != nil || status.State.Terminated != nil), nil
+		})
+	}
+	if err != nil {
+		if _, isStartFailure := err.(*startFailure); isStartFailure {
+			r.failure = err
+		} else {
+			r.SystemError = err
+		}
+		return
+	}
+
+	logs, err := c.cluster.request(c.ctx, "GET", c.cluster.podsPath()+"/"+url.PathEscape(p.Metadata.Name)+"/log?container=task&follow=true", nil)
+	if err != nil {
+		r.SystemError = err
+		return
+	}
+	_, err = io.Copy(c.writer, logs.Body)
+	logs.Body.Close()
+	if err != nil {
+		log.Printf("WARNING: could not stream logs of pod %v: %v", p.Metadata.Name, err)
+	}
+
+	p, err = c.waitForPod(func(p *pod) (bool, error) {
+		status := p.container("task")
+		return status != nil && status.State.Terminated != nil, nil
+	})
+	if err != nil {
+		r.SystemError = err
+		return
+	}
+	r.exitCode = p.container("task").State.Terminated.ExitCode
+
+	if len(c.job.Artifacts) > 0 {
+		// copy the artifacts from the task pod; if this fails, the missing
+		// artifacts are reported when they are uploaded
+		err = c.sync(p.Status.PodIP, func(conn net.Conn) error {
+			return extractTar(conn, c.workingDirectory)
+		})
+		if err != nil {
+			fmt.Fprintf(c.writer, "[kubernetes] Could not copy artifacts from pod %v: %v\n", p.Metadata.Name, err)
+		}
+	}
+	return
+}
+
+type startFailure struct {
+	error
+}
+
+// waitForPod polls the pod of the Job until ready returns true, or an error
+func (c *Command) waitForPod(ready func(p *pod) (bool, error)) (*pod, error) {
+	seen := false
+	for {
+		p, err := c.cluster.jobPod(c.ctx, c.job.Name)
+		if err == nil {
+			switch {
+			case p != nil:
+				seen = true
+				var done bool
+				done, err = ready(p)
+				if err != nil {
+					return nil, &startFailure{err}
+				}
+				if done {
+					return p, nil
+				}
+			case seen:
+				return nil, fmt.Errorf("pod of Kubernetes Job %v no longer exists", c.job.Name)
+			}
+		} else {
+			log.Printf("WARNING: could not query pod of Kubernetes Job %v: %v", c.job.Name, err)
+		}
+		select {
+		case <-c.ctx.Done():
+			return nil, c.ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// sync connects to the init container or sidecar of the task pod, retrying
+// until it is listening, and transfers the task directory with the given
+// function, after sending the sync token of the Job
+func (c *Command) sync(podIP string, transfer func(conn net.Conn) error) error {
+	address := net.JoinHostPort(podIP, fmt.Sprint(syncPort))
+	deadline := time.Now().Add(syncTimeout)
+	for {
+		conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(c.ctx, "tcp", address)
+		if err == nil {
+			defer conn.Close()
+			if _, err := io.WriteString(conn, c.job.SyncToken+"\n"); err != nil {
+				return err
+			}
+			return transfer(conn)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("could not connect to %v: %v", address, err)
+		}
+		select {
+		case <-c.ctx.Done():
+			return c.ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// newSyncToken returns a random token for the init container and sidecar of
+// a task pod to authenticate the worker with
+func newSyncToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeTar writes the content of dir as a tar archive, apart from the given
+// relative paths. Files with several hard links in dir are written once, and
+// as hard links after that, so that they don't take extra space in the pod.
+func writeTar(w io.Writer, dir string, exclude []string) error {
+	tw := tar.NewWriter(w)
+	// relative path of the first file written of each file with hard links
+	linked := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		for _, e := range exclude {
+			if rel == filepath.Clean(e) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if id, isLinked := fileutil.HardLinkID(info); isLinked {
+			if first, written := linked[id]; written {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+				return tw.WriteHeader(hdr)
+			}
+			linked[id] = hdr.Name
+		}
+		err = tw.WriteHeader(hdr)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractTar extracts the directories, regular files and hard links of a tar
+// archive into dir, rejecting entries that would be written outside of it
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("tar entry %q is outside of the task directory", hdr.Name)
+		}
+		path := filepath.Join(dir, rel)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0777)
+		case tar.TypeReg, tar.TypeGNUSparse:
+			err = extractFile(tr, path, hdr.FileInfo().Mode().Perm())
+		case tar.TypeLink:
+			err = fileutil.ExtractHardLink(dir, path, hdr.Linkname)
+		default:
+			log.Printf("Not extracting tar entry %q of type %q", hdr.Name, hdr.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string, perm os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+	// remove any existing file first, so that a symlink isn't followed
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	_, err = fileutil.WriteSparse(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (r *Result) ExitCode() int64 {
+	return r.exitCode
+}
+
+func (r *Result) CrashCause() error {
+	return r.SystemError
+}
+
+func (r *Result) Crashed() bool {
+	return r.SystemError != nil
+}
+
+func (r *Result) FailureCause() error {
+	if r.failure != nil {
+		return r.failure
+	}
+	return fmt.Errorf("Exit code %v", r.exitCode)
+}
+
+func (r *Result) Failed() bool {
+	return r.failure != nil || r.exitCode != 0
+}
+
+func NewCommand(cluster *Cluster, job *Job, commandLine []string, workingDirectory string, env []string) (*Command, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	// Reset changes the name of the Job
+	j := *job
+	c := &Command{
+		ctx:              ctx,
+		cancel:           cancel,
+		writer:           os.Stdout,
+		cluster:          cluster,
+		job:              &j,
+		jobName:          job.Name,
+		cmd:              commandLine,
+		workingDirectory: workingDirectory,
+		env:              env,
+	}
+	return c, nil
+}
+
+// Kill deletes the Job of the command, which terminates its pod
+func (c *Command) Kill() ([]byte, error) {
+	c.cancel()
+	return nil, c.cluster.deleteJob(c.job.Name)
+}
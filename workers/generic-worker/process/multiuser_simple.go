@@ -22,6 +22,15 @@ type Command struct {
 	// return even if cmd.Wait() is blocked. This is useful since cmd.Wait()
 	// sometimes does not return promptly.
 	abort chan struct{}
+	// writer that stdout and stderr are directed to, see DirectOutput
+	output io.Writer
+	// TagOutputStreams prefixes each line of output with the stream that it
+	// was written to, i.e. [stdout] or [stderr]
+	TagOutputStreams bool
+	// OutputEncoding is the encoding of the output of the command, which is
+	// converted to UTF-8, see newOutputDecoder. It is only supported on
+	// Windows, and is ignored on other platforms.
+	OutputEncoding string
 }
 
 type Result struct {
@@ -31,6 +40,15 @@ type Result struct {
 	Aborted     bool
 	KernelTime  time.Duration
 	UserTime    time.Duration
+	// MaxRSSBytes is the peak resident set size of the process, and
+	// ReadBytes and WriteBytes are the bytes it read from and wrote to
+	// storage. They are zero on platforms that do not report them (Windows).
+	MaxRSSBytes uint64
+	ReadBytes   uint64
+	WriteBytes  uint64
+	// OutputWarnings describe output of the command that could not be
+	// converted to UTF-8, and was replaced
+	OutputWarnings []string
 }
 
 // ExitCode returns the exit code, or
@@ -57,10 +75,27 @@ func (r *Result) ExitCode() int {
 func (c *Command) Execute() (r *Result) {
 	r = &Result{}
 	started := time.Now()
+	var seq *outputSequencer
 	c.mutex.Lock()
+	if c.output != nil {
+		seq = newOutputSequencer(c.output, c.TagOutputStreams)
+		if c.TagOutputStreams {
+			c.Stdout = seq.stream("stdout", newOutputDecoder(c.OutputEncoding))
+			c.Stderr = seq.stream("stderr", newOutputDecoder(c.OutputEncoding))
+		} else {
+			// a single stream shares one pipe for stdout and stderr, which
+			// preserves the exact order of the output
+			c.Stdout = seq.stream("output", newOutputDecoder(c.OutputEncoding))
+			c.Stderr = c.Stdout
+		}
+	}
 	err := c.Start()
 	c.mutex.Unlock()
 	if err != nil {
+		if seq != nil {
+			seq.close()
+			seq.wait()
+		}
 		r.SystemError = err
 		return
 	}
@@ -68,12 +103,21 @@ func (c *Command) Execute() (r *Result) {
 	// wait for command to complete in separate go routine, so we handle abortion in parallel to command termination
 	go func() {
 		err := c.Wait()
+		// Wait returns once the output of the command has been read
+		if seq != nil {
+			seq.close()
+		}
 		exitErr <- err
 	}()
 	select {
 	case err = <-exitErr:
+		if seq != nil {
+			seq.wait()
+			r.OutputWarnings = seq.warnings()
+		}
 		r.UserTime = c.ProcessState.UserTime()
 		r.KernelTime = c.ProcessState.SystemTime()
+		setResourceUsage(r, c.ProcessState)
 		if err != nil {
 			if exiterr, ok := err.(*exec.ExitError); ok {
 				r.ExitError = exiterr
@@ -91,6 +135,36 @@ func (c *Command) Execute() (r *Result) {
 	return
 }
 
+// PID returns the process ID of the command, or 0 if it hasn't been started
+func (c *Command) PID() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.Process == nil {
+		return 0
+	}
+	return c.Process.Pid
+}
+
+// Reset prepares the command to be executed again, after it has been
+// executed, e.g. in order to retry a failed command. Since an exec.Cmd can
+// only be started once, it is replaced by a copy of its configuration.
+func (c *Command) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.Cmd = &exec.Cmd{
+		Path:        c.Path,
+		Args:        c.Args,
+		Env:         c.Env,
+		Dir:         c.Dir,
+		Stdin:       c.Stdin,
+		Stdout:      c.Stdout,
+		Stderr:      c.Stderr,
+		ExtraFiles:  c.ExtraFiles,
+		SysProcAttr: c.SysProcAttr,
+	}
+	c.abort = make(chan struct{})
+}
+
 func (c *Command) String() string {
 	return fmt.Sprintf("%q", c.Args)
 }
@@ -127,7 +201,8 @@ func (r *Result) Verdict() string {
 	}
 }
 
+// DirectOutput directs the standard output and standard error of the command
+// to writer, in the order that the command writes them
 func (c *Command) DirectOutput(writer io.Writer) {
-	c.Stdout = writer
-	c.Stderr = writer
+	c.output = writer
 }
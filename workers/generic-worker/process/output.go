@@ -0,0 +1,176 @@
+// +build multiuser simple
+
+package process
+
+import (
+	"bytes"
+	"io"
+)
+
+// outputChunk is output that a command has written to one of its output
+// streams
+type outputChunk struct {
+	// "stdout" or "stderr", or "output" if both streams share a pipe
+	stream string
+	data   []byte
+}
+
+// outputSequencer writes the output of a command's standard output and
+// standard error to a single writer, in the order that the worker reads it.
+// When lines are tagged with the stream that they were written to, each
+// stream has its own pipe and reader, which feed a single channel, so that
+// output of the two streams is never interleaved within a chunk, and is
+// written in the order that it was read. Otherwise both streams share a
+// single pipe, so the output is written in exactly the order that the
+// command wrote it.
+type outputSequencer struct {
+	writer io.Writer
+	tag    bool
+	chunks chan *outputChunk
+	// closed once all chunks have been written
+	done chan struct{}
+	// whether the last chunk written ended a line, and to which stream, for
+	// tagging lines
+	atLineStart bool
+	lastStream  string
+	streams     []*outputStream
+}
+
+// outputDecoder converts the output of a command to UTF-8
+type outputDecoder interface {
+	// decode returns the given output as UTF-8, holding back a trailing
+	// incomplete character until more output is written
+	decode(p []byte) []byte
+	// flush returns the output that has been held back as UTF-8, replacing
+	// an incomplete character
+	flush() []byte
+	// warning describes output that was invalid in its encoding, and was
+	// replaced, or is "" if the output was valid
+	warning() string
+}
+
+// outputStream is the writer of one output stream of a command
+type outputStream struct {
+	name      string
+	sequencer *outputSequencer
+	// converts the output of the stream to UTF-8, if not nil
+	decoder outputDecoder
+}
+
+func newOutputSequencer(writer io.Writer, tag bool) *outputSequencer {
+	seq := &outputSequencer{
+		writer:      writer,
+		tag:         tag,
+		chunks:      make(chan *outputChunk, 64),
+		done:        make(chan struct{}),
+		atLineStart: true,
+	}
+	go seq.run()
+	return seq
+}
+
+// stream returns a new output stream with the given name, whose output is
+// converted to UTF-8 by decoder, unless it is nil
+func (seq *outputSequencer) stream(name string, decoder outputDecoder) io.Writer {
+	s := &outputStream{
+		name:      name,
+		sequencer: seq,
+		decoder:   decoder,
+	}
+	seq.streams = append(seq.streams, s)
+	return s
+}
+
+// Write queues a copy of p, since the caller may reuse it
+func (s *outputStream) Write(p []byte) (int, error) {
+	var data []byte
+	if s.decoder != nil {
+		data = s.decoder.decode(p)
+	} else {
+		data = make([]byte, len(p))
+		copy(data, p)
+	}
+	s.queue(data)
+	return len(p), nil
+}
+
+func (s *outputStream) queue(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	s.sequencer.chunks <- &outputChunk{
+		stream: s.name,
+		data:   data,
+	}
+}
+
+// close must be called once no more output will be written to the streams,
+// i.e. once the command has exited, and its output has been read
+func (seq *outputSequencer) close() {
+	for _, s := range seq.streams {
+		if s.decoder != nil {
+			s.queue(s.decoder.flush())
+		}
+	}
+	close(seq.chunks)
+}
+
+// warnings describes output that could not be converted to UTF-8, and was
+// replaced
+func (seq *outputSequencer) warnings() []string {
+	warnings := []string{}
+	for _, s := range seq.streams {
+		if s.decoder == nil {
+			continue
+		}
+		if w := s.decoder.warning(); w != "" {
+			warnings = append(warnings, s.name+" "+w)
+		}
+	}
+	return warnings
+}
+
+// wait returns once all output has been written
+func (seq *outputSequencer) wait() {
+	<-seq.done
+}
+
+func (seq *outputSequencer) run() {
+	defer close(seq.done)
+	for chunk := range seq.chunks {
+		if !seq.tag {
+			_, _ = seq.writer.Write(chunk.data)
+			continue
+		}
+		seq.writeTagged(chunk)
+	}
+	if !seq.atLineStart {
+		_, _ = seq.writer.Write([]byte("\n"))
+	}
+}
+
+// writeTagged writes the given chunk, prefixing each line with the stream it
+// was written to. A line that is still incomplete when the other stream
+// writes output is ended, so that every line has a single source.
+func (seq *outputSequencer) writeTagged(chunk *outputChunk) {
+	if !seq.atLineStart && chunk.stream != seq.lastStream {
+		_, _ = seq.writer.Write([]byte("\n"))
+		seq.atLineStart = true
+	}
+	seq.lastStream = chunk.stream
+	out := &bytes.Buffer{}
+	data := chunk.data
+	for len(data) > 0 {
+		line := data
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line = data[:i+1]
+		}
+		if seq.atLineStart {
+			out.WriteString("[" + chunk.stream + "] ")
+		}
+		out.Write(line)
+		seq.atLineStart = line[len(line)-1] == '\n'
+		data = data[len(line):]
+	}
+	_, _ = seq.writer.Write(out.Bytes())
+}
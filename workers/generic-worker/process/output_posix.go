@@ -0,0 +1,9 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package process
+
+// newOutputDecoder returns nil, since output is written to the task log as
+// is, rather than converted to UTF-8, on posix platforms
+func newOutputDecoder(encoding string) outputDecoder {
+	return nil
+}
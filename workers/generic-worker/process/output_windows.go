@@ -0,0 +1,330 @@
+// +build multiuser
+
+package process
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
+	"golang.org/x/sys/windows"
+)
+
+// newOutputDecoder returns a decoder of output in the given encoding, which is
+// one of:
+//
+//   "utf-8":    output is UTF-8
+//   "utf-16le": output is UTF-16 little endian, as written e.g. by `cmd /u`
+//   "oem":      output is in the OEM code page, which console programs write
+//               by default
+//   "ansi":     output is in the ANSI code page
+//   "auto":     output is UTF-16 little endian if it starts with a byte order
+//               mark, or looks like ASCII encoded as UTF-16, otherwise UTF-8
+//               until it is not valid UTF-8, after which it is taken to be in
+//               the OEM code page
+//
+// An empty encoding is "auto".
+func newOutputDecoder(encoding string) outputDecoder {
+	switch encoding {
+	case "utf-8":
+		return &utf8Decoder{}
+	case "utf-16le":
+		return &utf16Decoder{}
+	case "oem":
+		return newCodePageDecoder(win32.GetOEMCP())
+	case "ansi":
+		return newCodePageDecoder(windows.GetACP())
+	default:
+		return &autoDecoder{}
+	}
+}
+
+// utf8Decoder replaces invalid UTF-8
+type utf8Decoder struct {
+	pending []byte
+	invalid bool
+}
+
+func (d *utf8Decoder) decode(p []byte) []byte {
+	data := append(d.pending, p...)
+	// hold back a trailing incomplete character, which is at most
+	// utf8.UTFMax-1 bytes long
+	end := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				end = i
+			}
+			break
+		}
+	}
+	d.pending = append([]byte{}, data[end:]...)
+	return d.valid(data[:end])
+}
+
+func (d *utf8Decoder) flush() []byte {
+	data := d.pending
+	d.pending = nil
+	return d.valid(data)
+}
+
+// valid returns data, with each invalid byte replaced with U+FFFD
+func (d *utf8Decoder) valid(data []byte) []byte {
+	if utf8.Valid(data) {
+		return data
+	}
+	d.invalid = true
+	out := make([]byte, 0, len(data)+utf8.UTFMax)
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			out = append(out, string(utf8.RuneError)...)
+		} else {
+			out = append(out, data[:size]...)
+		}
+		data = data[size:]
+	}
+	return out
+}
+
+func (d *utf8Decoder) warning() string {
+	if d.invalid {
+		return "contained byte sequences that are not valid UTF-8, which were replaced with U+FFFD"
+	}
+	return ""
+}
+
+// utf16Decoder converts UTF-16 little endian to UTF-8, dropping a leading
+// byte order mark
+type utf16Decoder struct {
+	pending []byte
+	started bool
+	invalid bool
+}
+
+func (d *utf16Decoder) decode(p []byte) []byte {
+	data := append(d.pending, p...)
+	end := len(data) &^ 1
+	// hold back a trailing high surrogate, since the low surrogate that
+	// completes it may not have been written yet
+	if end >= 2 {
+		if u := uint16(data[end-2]) | uint16(data[end-1])<<8; u >= 0xd800 && u < 0xdc00 {
+			end -= 2
+		}
+	}
+	d.pending = append([]byte{}, data[end:]...)
+	return d.utf8(data[:end])
+}
+
+func (d *utf16Decoder) flush() []byte {
+	data := d.pending
+	d.pending = nil
+	out := d.utf8(data[:len(data)&^1])
+	if len(data)%2 == 1 {
+		d.invalid = true
+		out = append(out, string(utf8.RuneError)...)
+	}
+	return out
+}
+
+func (d *utf16Decoder) utf8(data []byte) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+	}
+	if !d.started && len(units) > 0 {
+		d.started = true
+		if units[0] == 0xfeff {
+			units = units[1:]
+		}
+	}
+	return d.runes(utf16.Decode(units))
+}
+
+func (d *utf16Decoder) runes(runes []rune) []byte {
+	out := make([]byte, 0, len(runes))
+	for _, r := range runes {
+		if r == utf8.RuneError {
+			// utf16.Decode replaces unpaired surrogates with U+FFFD, which
+			// can't be told apart from U+FFFD in the output, so either is
+			// reported
+			d.invalid = true
+		}
+		out = append(out, string(r)...)
+	}
+	return out
+}
+
+func (d *utf16Decoder) warning() string {
+	if d.invalid {
+		return "contained byte sequences that are not valid UTF-16LE, which were replaced with U+FFFD"
+	}
+	return ""
+}
+
+// codePageDecoder converts output in a Windows code page to UTF-8
+type codePageDecoder struct {
+	codePage uint32
+	pending  []byte
+	invalid  bool
+}
+
+func newCodePageDecoder(codePage uint32) *codePageDecoder {
+	return &codePageDecoder{
+		codePage: codePage,
+	}
+}
+
+func (d *codePageDecoder) decode(p []byte) []byte {
+	data := append(d.pending, p...)
+	d.pending = nil
+	if len(data) == 0 {
+		return nil
+	}
+	runes, err := d.convert(data, win32.MB_ERR_INVALID_CHARS)
+	if err == nil {
+		return runes
+	}
+	// the last byte may be the lead byte of a double byte character, whose
+	// trail byte hasn't been written yet
+	if len(data) > 1 {
+		if runes, err := d.convert(data[:len(data)-1], win32.MB_ERR_INVALID_CHARS); err == nil {
+			d.pending = data[len(data)-1:]
+			return runes
+		}
+	}
+	return d.replace(data)
+}
+
+func (d *codePageDecoder) flush() []byte {
+	data := d.pending
+	d.pending = nil
+	if len(data) == 0 {
+		return nil
+	}
+	if runes, err := d.convert(data, win32.MB_ERR_INVALID_CHARS); err == nil {
+		return runes
+	}
+	return d.replace(data)
+}
+
+// replace converts data, letting Windows replace the characters that are not
+// valid in the code page
+func (d *codePageDecoder) replace(data []byte) []byte {
+	d.invalid = true
+	runes, err := d.convert(data, 0)
+	if err != nil {
+		// should not happen, since invalid characters are replaced
+		return []byte(string(utf8.RuneError))
+	}
+	return runes
+}
+
+// convert returns data, in the code page of d, as UTF-8
+func (d *codePageDecoder) convert(data []byte, flags uint32) ([]byte, error) {
+	n, err := windows.MultiByteToWideChar(d.codePage, flags, &data[0], int32(len(data)), nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	units := make([]uint16, n)
+	n, err = windows.MultiByteToWideChar(d.codePage, flags, &data[0], int32(len(data)), &units[0], n)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(string(utf16.Decode(units[:n]))), nil
+}
+
+func (d *codePageDecoder) warning() string {
+	if d.invalid {
+		return fmt.Sprintf("contained byte sequences that are not valid in code page %v, which were replaced", d.codePage)
+	}
+	return ""
+}
+
+// autoDecoder detects whether output is UTF-16, UTF-8, or in the OEM code
+// page, see newOutputDecoder
+type autoDecoder struct {
+	decoder outputDecoder
+	// output that has been written before the encoding was detected
+	pending []byte
+}
+
+func (d *autoDecoder) decode(p []byte) []byte {
+	if d.decoder == nil {
+		data := append(d.pending, p...)
+		// at least two bytes are needed to detect UTF-16
+		if len(data) < 2 {
+			d.pending = data
+			return nil
+		}
+		d.pending = nil
+		if looksLikeUTF16(data) {
+			d.decoder = &utf16Decoder{}
+		} else {
+			d.decoder = &utf8Decoder{}
+		}
+		p = data
+	}
+	u, isUTF8 := d.decoder.(*utf8Decoder)
+	if !isUTF8 {
+		return d.decoder.decode(p)
+	}
+	before := u.pending
+	data := u.decode(p)
+	if !u.invalid {
+		return data
+	}
+	// output is not UTF-8, so convert output that hasn't been written yet from
+	// the OEM code page instead
+	d.decoder = newCodePageDecoder(win32.GetOEMCP())
+	return d.decoder.decode(append(before, p...))
+}
+
+func (d *autoDecoder) flush() []byte {
+	if d.decoder == nil {
+		data := d.pending
+		d.pending = nil
+		d.decoder = &utf8Decoder{}
+		return append(d.decode(data), d.flush()...)
+	}
+	u, isUTF8 := d.decoder.(*utf8Decoder)
+	if !isUTF8 {
+		return d.decoder.flush()
+	}
+	before := u.pending
+	data := u.flush()
+	if !u.invalid {
+		return data
+	}
+	// an incomplete UTF-8 character at the end of the output is a character
+	// in the OEM code page
+	d.decoder = newCodePageDecoder(win32.GetOEMCP())
+	return append(d.decoder.decode(before), d.decoder.flush()...)
+}
+
+func (d *autoDecoder) warning() string {
+	if _, isUTF8 := d.decoder.(*utf8Decoder); isUTF8 || d.decoder == nil {
+		return ""
+	}
+	return d.decoder.warning()
+}
+
+// looksLikeUTF16 returns true if data starts with a UTF-16 little endian byte
+// order mark, or if its first characters look like ASCII encoded as UTF-16
+// little endian, i.e. every other byte is 0
+func looksLikeUTF16(data []byte) bool {
+	if data[0] == 0xff && data[1] == 0xfe {
+		return true
+	}
+	n := len(data) &^ 1
+	if n > 64 {
+		n = 64
+	}
+	for i := 0; i < n; i += 2 {
+		if data[i] == 0 || data[i+1] != 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package process
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// setResourceUsage sets the peak memory and storage I/O of the result from
+// the rusage of the exited process
+func setResourceUsage(r *Result, state *os.ProcessState) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return
+	}
+	// ru_maxrss is in bytes on macOS, but in kilobytes elsewhere
+	r.MaxRSSBytes = uint64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		r.MaxRSSBytes *= 1024
+	}
+	// block operations are counted in 512 byte units
+	r.ReadBytes = uint64(rusage.Inblock) * 512
+	r.WriteBytes = uint64(rusage.Oublock) * 512
+}
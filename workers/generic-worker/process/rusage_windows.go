@@ -0,0 +1,13 @@
+// +build multiuser
+
+package process
+
+import (
+	"os"
+)
+
+// setResourceUsage does nothing, since the process handle that the peak
+// memory and I/O counters of the process could be queried from has been
+// closed once the process has been waited for
+func setResourceUsage(r *Result, state *os.ProcessState) {
+}
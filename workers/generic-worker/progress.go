@@ -0,0 +1,265 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const (
+	progressArtifactName = "public/progress.json"
+	// largest progress report that tasks may POST
+	maxProgressReportBytes = 64 * 1024
+)
+
+var (
+	// file, relative to task directory, that the latest progress report is
+	// written to before it is uploaded
+	progressFile = filepath.Join("generic-worker", "progress.json")
+)
+
+type (
+	// ProgressFeature offers tasks a local HTTP endpoint, advertised in
+	// environment variable TASKCLUSTER_PROGRESS_URL, that task commands POST
+	// progress reports to. The latest report is published as artifact
+	// public/progress.json, which is updated periodically while the task
+	// runs, so that dashboards can show the progress of long running tasks.
+	ProgressFeature struct {
+	}
+
+	ProgressTask struct {
+		task     *TaskRun
+		server   *http.Server
+		listener net.Listener
+		// closed by Stop
+		stop chan struct{}
+		done chan struct{}
+		// guards report and reported
+		sync.Mutex
+		// latest progress report, or nil if none has been received
+		report *progressReport
+		// true if report has been uploaded
+		reported bool
+	}
+
+	// progressReport is the progress of a task, as reported by the task
+	progressReport struct {
+		// percentage of the task that has completed, between 0 and 100
+		Percentage float64 `json:"percentage"`
+		// description of what the task is currently doing
+		Step string `json:"step,omitempty"`
+		// when the task expects to complete
+		ETA *tcclient.Time `json:"eta,omitempty"`
+		// when the report was received, set by the worker
+		Updated tcclient.Time `json:"updated"`
+	}
+)
+
+func (feature *ProgressFeature) Name() string {
+	return "Progress"
+}
+
+func (feature *ProgressFeature) PayloadName() string {
+	return "progress"
+}
+
+func (feature *ProgressFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *ProgressFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ProgressFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ProgressFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.Progress
+}
+
+func (feature *ProgressFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ProgressTask{
+		task: task,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+func (pt *ProgressTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (pt *ProgressTask) ReservedArtifacts() []string {
+	return []string{
+		progressArtifactName,
+	}
+}
+
+func (pt *ProgressTask) Start() *CommandExecutionError {
+	if config.ProgressUpdateIntervalSecs == 0 {
+		return MalformedPayloadError(fmt.Errorf("[progress] Task payload feature progress is enabled, but config setting progressUpdateIntervalSecs is 0"))
+	}
+	listener, err := net.Listen("tcp", "localhost:"+strconv.Itoa(int(config.ProgressPort)))
+	if err != nil {
+		return ResourceUnavailable(fmt.Errorf("[progress] Could not listen on port %v for progress reports: %v", config.ProgressPort, err))
+	}
+	pt.listener = listener
+	err = pt.task.setVariable("TASKCLUSTER_PROGRESS_URL", fmt.Sprintf("http://localhost:%v/progress", config.ProgressPort))
+	if err != nil {
+		_ = listener.Close()
+		return executionError(internalError, errored, fmt.Errorf("[progress] Could not set environment variable TASKCLUSTER_PROGRESS_URL: %v", err))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/progress", pt.handle)
+	pt.server = &http.Server{
+		Handler: mux,
+	}
+	go func() {
+		if err := pt.server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("WARNING: progress endpoint of task %v stopped: %v", pt.task.TaskID, err)
+		}
+	}()
+	go func() {
+		defer close(pt.done)
+		ticker := time.NewTicker(time.Duration(config.ProgressUpdateIntervalSecs) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-pt.stop:
+				return
+			case <-ticker.C:
+				if e := pt.upload(); e != nil {
+					pt.task.Warnf("[progress] Could not publish progress: %v", e)
+				}
+			}
+		}
+	}()
+	pt.task.Infof("[progress] Task commands can report progress by POSTing to $TASKCLUSTER_PROGRESS_URL, which is published as artifact %v every %v seconds", progressArtifactName, config.ProgressUpdateIntervalSecs)
+	return nil
+}
+
+// Stop publishes the latest progress report, if it hasn't been already, so
+// that the artifact reflects the progress of the task when it finished
+func (pt *ProgressTask) Stop(err *ExecutionErrors) {
+	if pt.server == nil {
+		return
+	}
+	if e := pt.server.Shutdown(context.Background()); e != nil {
+		pt.task.Warnf("[progress] Could not stop progress endpoint: %v", e)
+	}
+	close(pt.stop)
+	<-pt.done
+	err.add(pt.upload())
+}
+
+// handle receives a progress report from the task, or returns the latest
+// progress report
+func (pt *ProgressTask) handle(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		pt.Lock()
+		report := pt.report
+		pt.Unlock()
+		if report == nil {
+			http.Error(w, "No progress reported yet", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	case http.MethodPost, http.MethodPut:
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxProgressReportBytes))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Could not read progress report: %v", err), http.StatusBadRequest)
+			return
+		}
+		report, err := parseProgressReport(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pt.Lock()
+		pt.report = report
+		pt.reported = false
+		pt.Unlock()
+		pt.task.Infof("[progress] %v", report)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseProgressReport parses and validates a progress report POSTed by a
+// task
+func parseProgressReport(body []byte) (*progressReport, error) {
+	report := &progressReport{}
+	err := json.Unmarshal(body, report)
+	if err != nil {
+		return nil, fmt.Errorf("Progress report is not valid JSON: %v", err)
+	}
+	if report.Percentage < 0 || report.Percentage > 100 {
+		return nil, fmt.Errorf("Progress report has percentage %v, which is not between 0 and 100", report.Percentage)
+	}
+	report.Updated = tcclient.Time(time.Now())
+	return report, nil
+}
+
+func (report *progressReport) String() string {
+	s := strconv.FormatFloat(report.Percentage, 'f', -1, 64) + "%"
+	if report.Step != "" {
+		s += " - " + report.Step
+	}
+	if report.ETA != nil {
+		s += fmt.Sprintf(" (ETA %v)", report.ETA)
+	}
+	return s
+}
+
+// upload publishes the latest progress report, unless it has already been
+// published, or no progress has been reported
+func (pt *ProgressTask) upload() *CommandExecutionError {
+	pt.Lock()
+	report, reported := pt.report, pt.reported
+	pt.Unlock()
+	if report == nil || reported {
+		return nil
+	}
+	err := fileutil.WriteToFileAsJSON(report, filepath.Join(taskContext.TaskDir, progressFile))
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[progress] Could not write %v: %v", progressFile, err))
+	}
+	cee := pt.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    progressArtifactName,
+				Expires: pt.task.Definition.Expires,
+			},
+			ContentType: "application/json",
+			Path:        progressFile,
+		},
+	)
+	if cee != nil {
+		return cee
+	}
+	pt.Lock()
+	// the task may have reported further progress in the meantime
+	pt.reported = pt.report == report
+	pt.Unlock()
+	return nil
+}
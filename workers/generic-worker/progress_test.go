@@ -0,0 +1,90 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseProgressReport(t *testing.T) {
+	for _, test := range []struct {
+		body  string
+		valid bool
+		text  string
+	}{
+		{`{"percentage": 42.5, "step": "Linking", "eta": "2020-06-01T14:30:00.000Z"}`, true, "42.5% - Linking (ETA 2020-06-01T14:30:00.000Z)"},
+		{`{"percentage": 100}`, true, "100%"},
+		{`{"percentage": 101}`, false, ""},
+		{`{"percentage": -1}`, false, ""},
+		{`{"percentage": "half"}`, false, ""},
+		{`not json`, false, ""},
+	} {
+		report, err := parseProgressReport([]byte(test.body))
+		if test.valid != (err == nil) {
+			t.Errorf("Was expecting progress report %v to be valid: %v, but got error %v", test.body, test.valid, err)
+			continue
+		}
+		if test.valid && report.String() != test.text {
+			t.Errorf("Was expecting progress report %v to be logged as %q but got %q", test.body, test.text, report.String())
+		}
+	}
+}
+
+func TestProgressEndpoint(t *testing.T) {
+	pt := &ProgressTask{
+		task: &TaskRun{
+			logWriter: &bytes.Buffer{},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(pt.handle))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Was expecting HTTP 404 before any progress is reported, but got %v", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"percentage": 150}`))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Was expecting HTTP 400 for invalid progress report, but got %v", resp.StatusCode)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"percentage": 25, "step": "Compiling"}`))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Was expecting HTTP 204 for valid progress report, but got %v", resp.StatusCode)
+	}
+
+	resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer resp.Body.Close()
+	report := &progressReport{}
+	err = json.NewDecoder(resp.Body).Decode(report)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if report.Percentage != 25 || report.Step != "Compiling" {
+		t.Fatalf("Was expecting latest progress report to be 25%% - Compiling, but got %v", report)
+	}
+	if !strings.Contains(pt.task.logWriter.(*bytes.Buffer).String(), "[progress] 25% - Compiling") {
+		t.Fatal("Was expecting progress report to be written to task log")
+	}
+}
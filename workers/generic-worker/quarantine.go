@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// QuarantineChecker tracks whether the worker has been quarantined in the
+// queue, so that it doesn't claim tasks while it is
+type QuarantineChecker struct {
+	queue       *tcqueue.Queue
+	interval    time.Duration
+	lastChecked time.Time
+	// zero if the worker is not quarantined
+	until time.Time
+}
+
+func NewQuarantineChecker(queue *tcqueue.Queue, interval time.Duration) *QuarantineChecker {
+	return &QuarantineChecker{
+		queue:    queue,
+		interval: interval,
+	}
+}
+
+// Quarantined returns whether the worker is currently quarantined, querying
+// the queue if it hasn't done so within the check interval. While the worker
+// is known to be quarantined, the queue isn't queried again until the
+// quarantine is due to end.
+func (qc *QuarantineChecker) Quarantined() bool {
+	if qc.interval == 0 {
+		return false
+	}
+	now := time.Now()
+	if now.Before(qc.until) {
+		return true
+	}
+	// Round(0) forces wall time calculation instead of monotonic time in case machine slept etc
+	if now.Round(0).Sub(qc.lastChecked.Round(0)) < qc.interval {
+		return false
+	}
+	qc.lastChecked = now
+	until, err := quarantinedUntil(qc.queue)
+	if err != nil {
+		log.Printf("WARNING: Could not check whether worker is quarantined: %v", err)
+		return false
+	}
+	wasQuarantined := !qc.until.IsZero()
+	qc.until = time.Time{}
+	if now.Before(until) {
+		qc.until = until
+		log.Printf("Worker is quarantined until %v - not claiming tasks", tcclient.Time(until))
+		logEventWithFields("workerQuarantined", nil, now, map[string]interface{}{
+			"quarantineUntil": until.Unix(),
+		})
+		return true
+	}
+	if wasQuarantined {
+		log.Print("Worker quarantine has ended - claiming tasks again")
+		logEvent("workerQuarantineEnded", nil, now)
+	}
+	return false
+}
+
+// Recheck causes the next call to Quarantined to query the queue, e.g. after
+// the worker has quarantined itself
+func (qc *QuarantineChecker) Recheck() {
+	qc.lastChecked = time.Time{}
+}
+
+// Until returns when the quarantine of the worker ends, or the zero time if
+// the worker is not quarantined
+func (qc *QuarantineChecker) Until() time.Time {
+	if time.Now().Before(qc.until) {
+		return qc.until
+	}
+	return time.Time{}
+}
+
+// quarantinedUntil returns the quarantineUntil time of the worker in the
+// queue, which is in the past if the worker isn't quarantined
+func quarantinedUntil(queue *tcqueue.Queue) (time.Time, error) {
+	worker, err := queue.GetWorker(config.ProvisionerID, config.WorkerType, config.WorkerGroup, config.WorkerID)
+	if err != nil {
+		// the queue only knows about workers once they have claimed work
+		if apiCallException, isAPICallException := err.(*tcclient.APICallException); isAPICallException {
+			if badHTTPResponseCode, isBadHTTPResponseCode := apiCallException.RootCause.(httpbackoff.BadHttpResponseCode); isBadHTTPResponseCode && badHTTPResponseCode.HttpResponseCode == 404 {
+				return time.Time{}, nil
+			}
+		}
+		return time.Time{}, err
+	}
+	return time.Time(worker.QuarantineUntil), nil
+}
+
+// quarantine quarantines the worker in the queue for the given duration; a
+// zero duration ends any current quarantine
+func quarantine(queue *tcqueue.Queue, duration time.Duration) error {
+	if duration < 0 {
+		return fmt.Errorf("quarantine duration %v is negative", duration)
+	}
+	until := time.Now().Add(duration)
+	_, err := queue.QuarantineWorker(config.ProvisionerID, config.WorkerType, config.WorkerGroup, config.WorkerID, &tcqueue.QuarantineWorkerRequest{
+		QuarantineUntil: tcclient.Time(until),
+	})
+	if err != nil {
+		return err
+	}
+	if duration == 0 {
+		log.Printf("Ended quarantine of worker %v/%v", config.WorkerGroup, config.WorkerID)
+	} else {
+		log.Printf("Quarantined worker %v/%v until %v", config.WorkerGroup, config.WorkerID, tcclient.Time(until))
+	}
+	return nil
+}
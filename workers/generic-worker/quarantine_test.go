@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestQuarantineChecker(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			ProvisionerID: "test-provisioner",
+			WorkerGroup:   "test-worker-group",
+			WorkerID:      "test-worker-id",
+			WorkerType:    "test-worker-type",
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	requests := 0
+	// the queue doesn't know about the worker until it first responds
+	quarantineUntil := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/api/queue/v1/provisioners/test-provisioner/worker-types/test-worker-type/workers/test-worker-group/test-worker-id" {
+			t.Errorf("Unexpected request %v", r.URL.Path)
+		}
+		if quarantineUntil == "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code": "ResourceNotFound", "message": "Worker not found"}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"quarantineUntil": %q}`, quarantineUntil)
+	}))
+	defer server.Close()
+	qc := NewQuarantineChecker(tcqueue.New(nil, server.URL), time.Nanosecond)
+
+	if qc.Quarantined() {
+		t.Fatal("Worker unknown to the queue should not be quarantined")
+	}
+	until := time.Now().Add(time.Hour).Round(time.Millisecond)
+	quarantineUntil = tcclient.Time(until).String()
+	if !qc.Quarantined() {
+		t.Fatal("Was expecting worker to be quarantined")
+	}
+	if !qc.Until().Equal(until) {
+		t.Fatalf("Was expecting worker to be quarantined until %v, but got %v", until, qc.Until())
+	}
+	// the queue is not queried again until the quarantine ends
+	if !qc.Quarantined() || requests != 2 {
+		t.Fatalf("Was expecting worker to still be quarantined after 2 requests, but got %v requests", requests)
+	}
+
+	qc.until = time.Now().Add(-time.Second)
+	quarantineUntil = tcclient.Time(time.Now().Add(-time.Second)).String()
+	if qc.Quarantined() || !qc.Until().IsZero() {
+		t.Fatal("Was expecting quarantine to have ended")
+	}
+}
@@ -14,6 +14,9 @@ var (
 	rdpInfoPath = filepath.Join("generic-worker", "rdp.json")
 )
 
+// scope required by tasks in order to use the feature
+const rdpScope scopes.Pattern = "generic-worker:allow-rdp:<provisionerId>/<workerType>"
+
 type RDPFeature struct {
 }
 
@@ -21,6 +24,14 @@ func (feature *RDPFeature) Name() string {
 	return "RDP"
 }
 
+func (feature *RDPFeature) PayloadName() string {
+	return "rdpInfo"
+}
+
+func (feature *RDPFeature) ScopePattern() scopes.Pattern {
+	return rdpScope
+}
+
 func (feature *RDPFeature) Initialise() error {
 	return nil
 }
@@ -52,12 +63,8 @@ func (feature *RDPFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 	}
 }
 
-func (l *RDPTask) RequiredScopes() scopes.Required {
-	return scopes.Required{
-		{
-			"generic-worker:allow-rdp:" + l.task.Definition.ProvisionerID + "/" + l.task.Definition.WorkerType,
-		},
-	}
+func (l *RDPTask) RequiredScopes() scopes.Expression {
+	return workerScope(rdpScope)
 }
 
 func (l *RDPTask) ReservedArtifacts() []string {
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
+	"golang.org/x/sys/windows/registry"
+)
+
+var (
+	registryChangesPath = filepath.Join("generic-worker", "registry-changes.json")
+	registryChangesName = "public/registry-changes.json"
+)
+
+type (
+	// RegistrySandboxFeature restores the registry settings of the task user,
+	// and the registry keys of config setting registrySandboxKeys, after each
+	// task (see config setting registrySandbox)
+	RegistrySandboxFeature struct {
+	}
+
+	RegistrySandboxTask struct {
+		task   *TaskRun
+		roots  []registryRoot
+		before RegistrySnapshot
+	}
+
+	// registryRoot is a registry key that is snapshotted, with all of its
+	// subkeys
+	registryRoot struct {
+		// how keys under the root are reported, e.g. HKEY_CURRENT_USER
+		name string
+		key  registry.Key
+		path string
+	}
+)
+
+func (feature *RegistrySandboxFeature) Name() string {
+	return "Registry Sandbox"
+}
+
+func (feature *RegistrySandboxFeature) Initialise() error {
+	for _, key := range config.RegistrySandboxKeys {
+		if _, err := localMachineRegistryRoot(key); err != nil {
+			return fmt.Errorf("config setting registrySandboxKeys has invalid entry %q: %v", key, err)
+		}
+	}
+	return nil
+}
+
+func (feature *RegistrySandboxFeature) PersistState() error {
+	return nil
+}
+
+func (feature *RegistrySandboxFeature) IsEnabled(task *TaskRun) bool {
+	return config.RegistrySandbox
+}
+
+func (feature *RegistrySandboxFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &RegistrySandboxTask{
+		task: task,
+	}
+}
+
+func (rs *RegistrySandboxTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (rs *RegistrySandboxTask) ReservedArtifacts() []string {
+	return []string{
+		registryChangesName,
+	}
+}
+
+func (rs *RegistrySandboxTask) Start() *CommandExecutionError {
+	sid, err := registrySandboxUserSID()
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[registry-sandbox] Could not look up SID of task user: %v", err))
+	}
+	rs.roots = []registryRoot{
+		{
+			name: "HKEY_CURRENT_USER",
+			key:  registry.USERS,
+			path: sid,
+		},
+	}
+	for _, key := range config.RegistrySandboxKeys {
+		// already validated by Initialise
+		root, _ := localMachineRegistryRoot(key)
+		rs.roots = append(rs.roots, root)
+	}
+	rs.before, err = rs.snapshot()
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[registry-sandbox] Could not snapshot registry: %v", err))
+	}
+	rs.task.Infof("[registry-sandbox] Snapshotted %v registry keys", len(rs.before))
+	return nil
+}
+
+func (rs *RegistrySandboxTask) Stop(err *ExecutionErrors) {
+	after, e := rs.snapshot()
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[registry-sandbox] Could not snapshot registry: %v", e)))
+		return
+	}
+	changes := diffRegistry(rs.before, after)
+	rs.task.Infof("[registry-sandbox] Restoring %v registry change(s) made by task", len(changes))
+	e = rs.restore(changes)
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[registry-sandbox] Could not restore registry: %v", e)))
+	}
+	e = fileutil.WriteToFileAsJSON(changes, filepath.Join(taskContext.TaskDir, registryChangesPath))
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[registry-sandbox] Could not write %v: %v", registryChangesPath, e)))
+		return
+	}
+	err.add(rs.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    registryChangesName,
+				Expires: rs.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            registryChangesPath,
+		},
+	))
+}
+
+// registrySandboxUserSID returns the SID of the user that task commands run
+// as, whose registry hive is mounted under HKEY_USERS while they are logged in
+func registrySandboxUserSID() (string, error) {
+	if config.RunTasksAsCurrentUser {
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	}
+	u, err := user.Lookup(taskContext.User.Name)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// localMachineRegistryRoot returns the root for an entry of config setting
+// registrySandboxKeys, such as HKLM\SOFTWARE\Policies
+func localMachineRegistryRoot(key string) (registryRoot, error) {
+	for _, prefix := range []string{`HKLM\`, `HKEY_LOCAL_MACHINE\`} {
+		if len(key) > len(prefix) && strings.EqualFold(key[:len(prefix)], prefix) {
+			path := strings.Trim(key[len(prefix):], `\`)
+			if path == "" {
+				break
+			}
+			return registryRoot{
+				name: `HKEY_LOCAL_MACHINE\` + path,
+				key:  registry.LOCAL_MACHINE,
+				path: path,
+			}, nil
+		}
+	}
+	return registryRoot{}, fmt.Errorf(`should be a key under HKEY_LOCAL_MACHINE, such as "HKLM\SOFTWARE\Policies"`)
+}
+
+func (rs *RegistrySandboxTask) snapshot() (RegistrySnapshot, error) {
+	snapshot := RegistrySnapshot{}
+	for _, root := range rs.roots {
+		err := snapshotRegistryKey(snapshot, root.key, root.path, root.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return snapshot, nil
+}
+
+// snapshotRegistryKey adds the values of the key with the given path under
+// root, and of all its subkeys, to snapshot. Keys that don't exist, or that
+// the worker isn't allowed to read, are skipped.
+func snapshotRegistryKey(snapshot RegistrySnapshot, root registry.Key, path, name string) error {
+	k, err := registry.OpenKey(root, path, registry.READ|registry.WOW64_64KEY)
+	switch err {
+	case nil:
+	case syscall.ERROR_FILE_NOT_FOUND, syscall.ERROR_ACCESS_DENIED:
+		return nil
+	default:
+		return fmt.Errorf("could not open registry key %v: %v", name, err)
+	}
+	defer k.Close()
+	valueNames, err := k.ReadValueNames(-1)
+	if err != nil {
+		return fmt.Errorf("could not read value names of registry key %v: %v", name, err)
+	}
+	values := map[string]RegistryValue{}
+	for _, valueName := range valueNames {
+		value, err := readRegistryValue(k, valueName)
+		if err != nil {
+			return fmt.Errorf("could not read value %v of registry key %v: %v", registryValueName(valueName), name, err)
+		}
+		values[valueName] = value
+	}
+	snapshot[name] = values
+	subkeys, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return fmt.Errorf("could not read subkeys of registry key %v: %v", name, err)
+	}
+	for _, subkey := range subkeys {
+		err = snapshotRegistryKey(snapshot, root, path+`\`+subkey, name+`\`+subkey)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readRegistryValue(k registry.Key, name string) (RegistryValue, error) {
+	for {
+		n, _, err := k.GetValue(name, nil)
+		if err != nil {
+			return RegistryValue{}, err
+		}
+		buf := make([]byte, n)
+		n, valueType, err := k.GetValue(name, buf)
+		// the value may have grown since its size was read
+		if err == syscall.ERROR_MORE_DATA {
+			continue
+		}
+		if err != nil {
+			return RegistryValue{}, err
+		}
+		return RegistryValue{Type: valueType, Data: buf[:n]}, nil
+	}
+}
+
+// resolve returns the root and path of the given reported key
+func (rs *RegistrySandboxTask) resolve(key string) (registry.Key, string) {
+	for _, root := range rs.roots {
+		if key == root.name {
+			return root.key, root.path
+		}
+		if strings.HasPrefix(key, root.name+`\`) {
+			return root.key, root.path + key[len(root.name):]
+		}
+	}
+	panic(fmt.Sprintf("registry key %v is not under a snapshotted root", key))
+}
+
+// restore undoes the given changes. Removed keys are recreated parents
+// first, since changes are sorted by key, and added keys are deleted with
+// all of their subkeys.
+func (rs *RegistrySandboxTask) restore(changes []RegistryChange) error {
+	addedKeys := map[string]bool{}
+	failures := []string{}
+	for _, change := range changes {
+		if change.Change == "added" && change.Value == "" {
+			addedKeys[change.Key] = true
+		}
+	}
+	for _, change := range changes {
+		var err error
+		root, path := rs.resolve(change.Key)
+		switch {
+		case change.Value != "":
+			err = rs.restoreValue(root, path, change)
+		case change.Change == "removed":
+			err = rs.restoreKey(root, path, change.Key)
+		case !addedKeys[registryParentKey(change.Key)]:
+			var subkey *uint16
+			subkey, err = syscall.UTF16PtrFromString(path)
+			if err == nil {
+				err = win32.RegDeleteTree(syscall.Handle(root), subkey)
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("could not restore %v registry key %v value %q: %v", change.Change, change.Key, change.Value, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%v", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+func registryParentKey(key string) string {
+	if i := strings.LastIndex(key, `\`); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+func (rs *RegistrySandboxTask) restoreKey(root registry.Key, path, name string) error {
+	k, _, err := registry.CreateKey(root, path, registry.ALL_ACCESS|registry.WOW64_64KEY)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	for valueName, value := range rs.before[name] {
+		err = setRegistryValue(k, valueName, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rs *RegistrySandboxTask) restoreValue(root registry.Key, path string, change RegistryChange) error {
+	valueName := change.Value
+	if valueName == registryDefaultValueName {
+		valueName = ""
+	}
+	k, err := registry.OpenKey(root, path, registry.SET_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	if change.Change == "added" {
+		return k.DeleteValue(valueName)
+	}
+	return setRegistryValue(k, valueName, rs.before[change.Key][valueName])
+}
+
+// setRegistryValue sets a value with its original type and raw data, which
+// the registry package can't do for all value types
+func setRegistryValue(k registry.Key, name string, value RegistryValue) error {
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var data *byte
+	if len(value.Data) > 0 {
+		data = &value.Data[0]
+	}
+	return win32.RegSetValueEx(syscall.Handle(k), namePtr, value.Type, data, uint32(len(value.Data)))
+}
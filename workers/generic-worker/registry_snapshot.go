@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+)
+
+// how the default (unnamed) value of a registry key is reported, as in regedit
+const registryDefaultValueName = "(Default)"
+
+type (
+	// RegistryValue is the type and raw data of a registry value
+	RegistryValue struct {
+		Type uint32
+		Data []byte
+	}
+
+	// RegistrySnapshot maps the path of each registry key, e.g.
+	// HKEY_CURRENT_USER\Software\Example, to its values
+	RegistrySnapshot map[string]map[string]RegistryValue
+
+	// RegistryChange is a registry key or value that a task added, removed
+	// or modified, as published in the public/registry-changes.json artifact
+	RegistryChange struct {
+		// "added", "removed" or "modified"
+		Change string `json:"change"`
+		Key    string `json:"key"`
+		// empty if the key itself was added or removed
+		Value string `json:"value,omitempty"`
+	}
+)
+
+// diffRegistry returns the changes from snapshot before to snapshot after,
+// sorted by key and value. A key that was added or removed is reported
+// without its values, but each of its subkeys is reported too.
+func diffRegistry(before, after RegistrySnapshot) []RegistryChange {
+	changes := []RegistryChange{}
+	for key, beforeValues := range before {
+		afterValues, exists := after[key]
+		if !exists {
+			changes = append(changes, RegistryChange{Change: "removed", Key: key})
+			continue
+		}
+		for name, beforeValue := range beforeValues {
+			afterValue, exists := afterValues[name]
+			switch {
+			case !exists:
+				changes = append(changes, RegistryChange{Change: "removed", Key: key, Value: registryValueName(name)})
+			case afterValue.Type != beforeValue.Type || !bytes.Equal(afterValue.Data, beforeValue.Data):
+				changes = append(changes, RegistryChange{Change: "modified", Key: key, Value: registryValueName(name)})
+			}
+		}
+		for name := range afterValues {
+			if _, exists := beforeValues[name]; !exists {
+				changes = append(changes, RegistryChange{Change: "added", Key: key, Value: registryValueName(name)})
+			}
+		}
+	}
+	for key := range after {
+		if _, exists := before[key]; !exists {
+			changes = append(changes, RegistryChange{Change: "added", Key: key})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Key != changes[j].Key {
+			return changes[i].Key < changes[j].Key
+		}
+		return changes[i].Value < changes[j].Value
+	})
+	return changes
+}
+
+func registryValueName(name string) string {
+	if name == "" {
+		return registryDefaultValueName
+	}
+	return name
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRegistry(t *testing.T) {
+	before := RegistrySnapshot{
+		`HKEY_CURRENT_USER`: {},
+		`HKEY_CURRENT_USER\Software\Example`: {
+			"":         {Type: 1, Data: []byte("a\x00")},
+			"Size":     {Type: 4, Data: []byte{1, 0, 0, 0}},
+			"Obsolete": {Type: 3, Data: []byte{0xff}},
+			"Kept":     {Type: 1, Data: []byte("k\x00")},
+		},
+		`HKEY_CURRENT_USER\Software\Removed`:        {},
+		`HKEY_CURRENT_USER\Software\Removed\Subkey`: {"Value": {Type: 1}},
+	}
+	after := RegistrySnapshot{
+		`HKEY_CURRENT_USER`: {},
+		`HKEY_CURRENT_USER\Software\Example`: {
+			"":     {Type: 1, Data: []byte("b\x00")},
+			"Size": {Type: 11, Data: []byte{1, 0, 0, 0, 0, 0, 0, 0}},
+			"New":  {Type: 1, Data: []byte("n\x00")},
+			"Kept": {Type: 1, Data: []byte("k\x00")},
+		},
+		`HKEY_CURRENT_USER\Software\Added`: {"Value": {Type: 1}},
+	}
+	expected := []RegistryChange{
+		{Change: "added", Key: `HKEY_CURRENT_USER\Software\Added`},
+		{Change: "modified", Key: `HKEY_CURRENT_USER\Software\Example`, Value: "(Default)"},
+		{Change: "added", Key: `HKEY_CURRENT_USER\Software\Example`, Value: "New"},
+		{Change: "removed", Key: `HKEY_CURRENT_USER\Software\Example`, Value: "Obsolete"},
+		{Change: "modified", Key: `HKEY_CURRENT_USER\Software\Example`, Value: "Size"},
+		{Change: "removed", Key: `HKEY_CURRENT_USER\Software\Removed`},
+		{Change: "removed", Key: `HKEY_CURRENT_USER\Software\Removed\Subkey`},
+	}
+	if changes := diffRegistry(before, after); !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("Was expecting registry changes\n%#v\nbut got\n%#v", expected, changes)
+	}
+	if changes := diffRegistry(after, after); len(changes) != 0 {
+		t.Fatalf("Was expecting no changes between identical snapshots, but got %#v", changes)
+	}
+}
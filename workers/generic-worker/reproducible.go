@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+type (
+	ReproducibleFeature struct {
+	}
+
+	ReproducibleTask struct {
+		task *TaskRun
+	}
+
+	// ReproducibleSettings are the resolved settings of
+	// task.payload.reproducible, which are recorded in the chain of trust
+	// certificate of the task
+	ReproducibleSettings struct {
+		SourceDateEpoch int64  `json:"sourceDateEpoch"`
+		Timezone        string `json:"timezone"`
+		Locale          string `json:"locale"`
+		Faketime        bool   `json:"faketime"`
+	}
+)
+
+func (feature *ReproducibleFeature) Name() string {
+	return "Reproducible"
+}
+
+func (feature *ReproducibleFeature) PayloadName() string {
+	return "reproducible"
+}
+
+func (feature *ReproducibleFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *ReproducibleFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ReproducibleFeature) PersistState() error {
+	return nil
+}
+
+// IsEnabled returns whether task.payload.reproducible is present. All of its
+// properties are optional, so the raw payload is checked, since an empty
+// object would otherwise be indistinguishable from an absent one.
+func (feature *ReproducibleFeature) IsEnabled(task *TaskRun) bool {
+	var payload struct {
+		Reproducible *json.RawMessage `json:"reproducible"`
+	}
+	if json.Unmarshal(task.Definition.Payload, &payload) != nil {
+		return false
+	}
+	return payload.Reproducible != nil
+}
+
+func (feature *ReproducibleFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ReproducibleTask{
+		task: task,
+	}
+}
+
+func (rt *ReproducibleTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (rt *ReproducibleTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (rt *ReproducibleTask) Start() *CommandExecutionError {
+	settings := reproducibleSettings(rt.task)
+	env := map[string]string{
+		"SOURCE_DATE_EPOCH": strconv.FormatInt(settings.SourceDateEpoch, 10),
+		"TZ":                settings.Timezone,
+		"LANG":              settings.Locale,
+		"LC_ALL":            settings.Locale,
+	}
+	if settings.Faketime {
+		faketime, err := faketimeEnv(rt.task, settings)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[reproducible] %v", err))
+		}
+		for name, value := range faketime {
+			env[name] = value
+		}
+	}
+	for _, name := range sortedKeys(env) {
+		err := rt.task.setVariable(name, env[name])
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[reproducible] Could not set environment variable %v: %v", name, err))
+		}
+		rt.task.Infof("[reproducible] %v=%v", name, env[name])
+	}
+	rt.task.reproducible = settings
+	return nil
+}
+
+func (rt *ReproducibleTask) Stop(err *ExecutionErrors) {
+}
+
+// reproducibleSettings returns task.payload.reproducible with defaults
+// applied
+func reproducibleSettings(task *TaskRun) *ReproducibleSettings {
+	payload := task.Payload.Reproducible
+	settings := &ReproducibleSettings{
+		SourceDateEpoch: payload.SourceDateEpoch,
+		Timezone:        payload.Timezone,
+		Locale:          payload.Locale,
+		Faketime:        payloadFaketime(task),
+	}
+	if settings.SourceDateEpoch == 0 {
+		// the same for every run of the task
+		settings.SourceDateEpoch = time.Time(task.Definition.Created).Unix()
+	}
+	if settings.Timezone == "" {
+		settings.Timezone = "UTC"
+	}
+	if settings.Locale == "" {
+		settings.Locale = "C.UTF-8"
+	}
+	return settings
+}
@@ -0,0 +1,44 @@
+// +build darwin,!docker,!kubernetes linux,!docker,!kubernetes freebsd
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+)
+
+func payloadFaketime(task *TaskRun) bool {
+	return task.Payload.Reproducible.Faketime
+}
+
+// faketimeEnv returns the environment variables that preload libfaketime into
+// the task commands, with a clock that starts at the source date epoch
+func faketimeEnv(task *TaskRun, settings *ReproducibleSettings) (map[string]string, error) {
+	if config.FaketimeLibrary == "" {
+		return nil, fmt.Errorf("task.payload.reproducible.faketime is true but this worker does not support faketime, since config setting faketimeLibrary is not set")
+	}
+	if _, err := os.Stat(config.FaketimeLibrary); err != nil {
+		return nil, fmt.Errorf("task.payload.reproducible.faketime is true but libfaketime (config setting faketimeLibrary) is not available: %v", err)
+	}
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("task.payload.reproducible.timezone %q is not a known timezone: %v", settings.Timezone, err)
+	}
+	env := map[string]string{
+		// libfaketime interprets the start time in the timezone of the
+		// process, which is the task timezone
+		"FAKETIME": time.Unix(settings.SourceDateEpoch, 0).In(location).Format("@2006-01-02 15:04:05"),
+	}
+	preload := "LD_PRELOAD"
+	if runtime.GOOS == "darwin" {
+		preload = "DYLD_INSERT_LIBRARIES"
+		env["DYLD_FORCE_FLAT_NAMESPACE"] = "1"
+	}
+	env[preload] = config.FaketimeLibrary
+	if existing := task.Payload.Env[preload]; existing != "" {
+		env[preload] += ":" + existing
+	}
+	return env, nil
+}
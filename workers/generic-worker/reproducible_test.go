@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func TestReproducibleSettings(t *testing.T) {
+	created := time.Date(2020, time.March, 4, 5, 6, 7, 0, time.UTC)
+	feature := &ReproducibleFeature{}
+	for _, test := range []struct {
+		payload  string
+		enabled  bool
+		settings ReproducibleSettings
+	}{
+		{
+			payload: `{"maxRunTime": 60}`,
+		},
+		{
+			payload: `{"reproducible": {}}`,
+			enabled: true,
+			settings: ReproducibleSettings{
+				SourceDateEpoch: created.Unix(),
+				Timezone:        "UTC",
+				Locale:          "C.UTF-8",
+			},
+		},
+		{
+			payload: `{"reproducible": {"sourceDateEpoch": 1000, "timezone": "Europe/Berlin", "locale": "de_DE.UTF-8"}}`,
+			enabled: true,
+			settings: ReproducibleSettings{
+				SourceDateEpoch: 1000,
+				Timezone:        "Europe/Berlin",
+				Locale:          "de_DE.UTF-8",
+			},
+		},
+	} {
+		task := &TaskRun{
+			Definition: tcqueue.TaskDefinitionResponse{
+				Created: tcclient.Time(created),
+				Payload: json.RawMessage(test.payload),
+			},
+		}
+		err := json.Unmarshal(task.Definition.Payload, &task.Payload)
+		if err != nil {
+			t.Fatalf("%v: %v", test.payload, err)
+		}
+		if enabled := feature.IsEnabled(task); enabled != test.enabled {
+			t.Errorf("%v: expected enabled %v but got %v", test.payload, test.enabled, enabled)
+		}
+		if !test.enabled {
+			continue
+		}
+		if settings := reproducibleSettings(task); *settings != test.settings {
+			t.Errorf("%v: expected settings %#v but got %#v", test.payload, test.settings, *settings)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// +build docker kubernetes windows
+
+package main
+
+import (
+	"fmt"
+)
+
+// task.payload.reproducible.faketime is not in the payload schema of this
+// engine/platform
+func payloadFaketime(task *TaskRun) bool {
+	return false
+}
+
+func faketimeEnv(task *TaskRun, settings *ReproducibleSettings) (map[string]string, error) {
+	return nil, fmt.Errorf("faketime is not supported by this worker")
+}
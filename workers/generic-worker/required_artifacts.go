@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkRequiredArtifacts returns a task failure listing the artifacts of
+// task.payload.requiredArtifacts that the task has not published, either
+// because they were never uploaded, or because an error artifact was uploaded
+// in their place
+func (task *TaskRun) checkRequiredArtifacts() *CommandExecutionError {
+	missing := []string{}
+	task.artifactsMux.Lock()
+	for _, name := range task.Payload.RequiredArtifacts {
+		artifact, uploaded := task.Artifacts[publishedArtifactName(name)]
+		if _, isError := artifact.(*ErrorArtifact); !uploaded || isError {
+			missing = append(missing, "  "+name)
+		}
+	}
+	task.artifactsMux.Unlock()
+	if len(missing) == 0 {
+		return nil
+	}
+	return Failure(fmt.Errorf("The task did not publish %v of the artifacts listed in task.payload.requiredArtifacts:\n%v", len(missing), strings.Join(missing, "\n")))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestCheckRequiredArtifacts(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	task := &TaskRun{
+		Artifacts: map[string]TaskArtifact{
+			"public/build/target.tar.gz": &S3Artifact{
+				BaseArtifact: &BaseArtifact{
+					Name: "public/build/target.tar.gz",
+				},
+			},
+			"public/build/tests.zip": &ErrorArtifact{
+				BaseArtifact: &BaseArtifact{
+					Name: "public/build/tests.zip",
+				},
+			},
+		},
+	}
+	if fail := task.checkRequiredArtifacts(); fail != nil {
+		t.Fatalf("Task without required artifacts should not fail, but got %v", fail)
+	}
+	task.Payload.RequiredArtifacts = []string{"public/build/target.tar.gz"}
+	if fail := task.checkRequiredArtifacts(); fail != nil {
+		t.Fatalf("Task that published its required artifact should not fail, but got %v", fail)
+	}
+	task.Payload.RequiredArtifacts = []string{"public/build/target.tar.gz", "public/build/tests.zip", "public/build/symbols.zip"}
+	fail := task.checkRequiredArtifacts()
+	if fail == nil || fail.TaskStatus != failed {
+		t.Fatalf("Was expecting task failure, but got %v", fail)
+	}
+	message := fail.Cause.Error()
+	if !strings.Contains(message, "  public/build/tests.zip\n  public/build/symbols.zip") || strings.Contains(message, "target.tar.gz") {
+		t.Fatalf("Failure should list exactly the missing required artifacts, but got: %v", message)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+var (
+	resourceUsagePath = filepath.Join("generic-worker", "resource-usage.json")
+	resourceUsageName = "public/resource-usage.json"
+)
+
+type (
+	// ResourceMeasurements are the resources consumed by a task command, or
+	// by all of the task commands. Measurements that the platform or engine
+	// does not report are zero.
+	ResourceMeasurements struct {
+		WallTimeSeconds   float64 `json:"wallTimeSeconds"`
+		UserTimeSeconds   float64 `json:"userTimeSeconds"`
+		SystemTimeSeconds float64 `json:"systemTimeSeconds"`
+		// peak resident set size
+		MaxRSSBytes uint64 `json:"maxRssBytes"`
+		// bytes read from and written to storage
+		ReadBytes  uint64 `json:"readBytes"`
+		WriteBytes uint64 `json:"writeBytes"`
+	}
+
+	CommandResourceUsage struct {
+		Command  int   `json:"command"`
+		ExitCode int64 `json:"exitCode"`
+		ResourceMeasurements
+	}
+
+	// TaskResourceUsage is the content of the public/resource-usage.json
+	// artifact
+	TaskResourceUsage struct {
+		TaskID   string                  `json:"taskId"`
+		RunID    uint                    `json:"runId"`
+		Engine   string                  `json:"engine"`
+		Platform string                  `json:"platform"`
+		Commands []*CommandResourceUsage `json:"commands"`
+		// sum of the measurements of the commands, apart from maxRssBytes,
+		// which is the peak of the commands
+		Total ResourceMeasurements `json:"total"`
+	}
+
+	ResourceUsageFeature struct {
+	}
+
+	ResourceUsageTask struct {
+		task  *TaskRun
+		usage *TaskResourceUsage
+	}
+)
+
+func (feature *ResourceUsageFeature) Name() string {
+	return "Resource Usage"
+}
+
+func (feature *ResourceUsageFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ResourceUsageFeature) PersistState() error {
+	return nil
+}
+
+// Resource usage is measured for all tasks if enabled by the worker config
+func (feature *ResourceUsageFeature) IsEnabled(task *TaskRun) bool {
+	return config.EnableResourceUsage
+}
+
+func (feature *ResourceUsageFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ResourceUsageTask{
+		task: task,
+		usage: &TaskResourceUsage{
+			TaskID:   task.TaskID,
+			RunID:    task.RunID,
+			Engine:   engine,
+			Platform: runtime.GOOS + "/" + runtime.GOARCH,
+			Commands: []*CommandResourceUsage{},
+		},
+	}
+}
+
+func (ru *ResourceUsageTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (ru *ResourceUsageTask) ReservedArtifacts() []string {
+	return []string{
+		resourceUsageName,
+	}
+}
+
+func (ru *ResourceUsageTask) Start() *CommandExecutionError {
+	ru.task.afterCommand = append(ru.task.afterCommand, ru.commandFinished)
+	return nil
+}
+
+// commandFinished records the resources consumed by the final attempt of
+// task command index
+func (ru *ResourceUsageTask) commandFinished(index int, result *process.Result) {
+	usage := &CommandResourceUsage{
+		Command:              index,
+		ExitCode:             int64(result.ExitCode()),
+		ResourceMeasurements: *commandResourceUsage(result),
+	}
+	ru.usage.Commands = append(ru.usage.Commands, usage)
+	ru.usage.Total.add(&usage.ResourceMeasurements)
+	fields := usage.fields()
+	fields["command"] = index
+	logEventWithFields("commandResourceUsage", ru.task, time.Now(), fields)
+}
+
+func (ru *ResourceUsageTask) Stop(err *ExecutionErrors) {
+	total := &ru.usage.Total
+	ru.task.Infof("[resource-usage] Wall time: %.3fs, user time: %.3fs, system time: %.3fs, peak RSS: %v bytes, bytes read: %v, bytes written: %v", total.WallTimeSeconds, total.UserTimeSeconds, total.SystemTimeSeconds, total.MaxRSSBytes, total.ReadBytes, total.WriteBytes)
+	logEventWithFields("taskResourceUsage", ru.task, time.Now(), total.fields())
+	file := filepath.Join(taskContext.TaskDir, resourceUsagePath)
+	e := fileutil.WriteToFileAsJSON(ru.usage, file)
+	if e != nil {
+		panic(e)
+	}
+	err.add(ru.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    resourceUsageName,
+				Expires: ru.task.Definition.Expires,
+			},
+			ContentType:     "application/json",
+			ContentEncoding: "gzip",
+			Path:            resourceUsagePath,
+		},
+	))
+}
+
+func (rm *ResourceMeasurements) add(other *ResourceMeasurements) {
+	rm.WallTimeSeconds += other.WallTimeSeconds
+	rm.UserTimeSeconds += other.UserTimeSeconds
+	rm.SystemTimeSeconds += other.SystemTimeSeconds
+	if other.MaxRSSBytes > rm.MaxRSSBytes {
+		rm.MaxRSSBytes = other.MaxRSSBytes
+	}
+	rm.ReadBytes += other.ReadBytes
+	rm.WriteBytes += other.WriteBytes
+}
+
+// fields returns the measurements as metric fields
+func (rm *ResourceMeasurements) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"wallTimeSeconds":   rm.WallTimeSeconds,
+		"userTimeSeconds":   rm.UserTimeSeconds,
+		"systemTimeSeconds": rm.SystemTimeSeconds,
+		"maxRssBytes":       rm.MaxRSSBytes,
+		"readBytes":         rm.ReadBytes,
+		"writeBytes":        rm.WriteBytes,
+	}
+}
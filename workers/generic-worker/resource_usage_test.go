@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestResourceUsageArtifact(t *testing.T) {
+	defer setup(t)()
+	config.EnableResourceUsage = true
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, resourceUsagePath))
+	if err != nil {
+		t.Fatalf("Could not read resource usage file: %v", err)
+	}
+	var usage TaskResourceUsage
+	err = json.Unmarshal(bytes, &usage)
+	if err != nil {
+		t.Fatalf("Could not interpret resource usage file as JSON: %v\n%s", err, bytes)
+	}
+	if len(usage.Commands) != len(payload.Command) {
+		t.Fatalf("Was expecting resource usage of %v commands, but got:\n%s", len(payload.Command), bytes)
+	}
+	if usage.Total.WallTimeSeconds <= 0 {
+		t.Fatalf("Was expecting a positive wall time, but got %v", usage.Total.WallTimeSeconds)
+	}
+}
+
+func TestResourceMeasurementsTotal(t *testing.T) {
+	total := &ResourceMeasurements{}
+	total.add(&ResourceMeasurements{WallTimeSeconds: 1, UserTimeSeconds: 0.5, MaxRSSBytes: 2048, ReadBytes: 512})
+	total.add(&ResourceMeasurements{WallTimeSeconds: 2, SystemTimeSeconds: 0.25, MaxRSSBytes: 1024, WriteBytes: 1024})
+	expected := ResourceMeasurements{
+		WallTimeSeconds:   3,
+		UserTimeSeconds:   0.5,
+		SystemTimeSeconds: 0.25,
+		MaxRSSBytes:       2048,
+		ReadBytes:         512,
+		WriteBytes:        1024,
+	}
+	if *total != expected {
+		t.Fatalf("Was expecting total %#v but got %#v", expected, *total)
+	}
+}
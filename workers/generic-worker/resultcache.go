@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	tcurls "github.com/taskcluster/taskcluster-lib-urls"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcindex"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const resultCacheScope scopes.Pattern = "generic-worker:result-cache:<provisionerId>/<workerType>"
+
+// index namespace under which successful task runs are recorded, followed by
+// <provisionerId>.<workerType>.<hash>
+var resultCacheNamespacePrefix = "generic-worker.result-cache"
+
+// Represents the Result Cache feature as a whole - one global instance
+type ResultCacheFeature struct {
+	index *tcindex.Index
+}
+
+// ResultCacheEntry is the data stored in the index entry of a successful task
+// run, alongside its taskId
+type ResultCacheEntry struct {
+	RunID uint `json:"runId"`
+}
+
+// resultCacheKey is the normalised content that is hashed to determine
+// whether two tasks are identical
+type resultCacheKey struct {
+	Payload interface{} `json:"payload"`
+	// task.scopes and task.routes, sorted, since they affect what the task
+	// commands can do, e.g. via the taskcluster proxy
+	Scopes []string `json:"scopes"`
+	Routes []string `json:"routes"`
+	// SHA256 of mounted and fetched content, keyed by FSContent.UniqueKey()
+	Content map[string]string `json:"content"`
+}
+
+func (feature *ResultCacheFeature) Name() string {
+	return "Result Cache"
+}
+
+func (feature *ResultCacheFeature) PayloadName() string {
+	return "resultCache"
+}
+
+func (feature *ResultCacheFeature) ScopePattern() scopes.Pattern {
+	return resultCacheScope
+}
+
+func (feature *ResultCacheFeature) Initialise() error {
+	feature.index = config.Index()
+	return nil
+}
+
+func (feature *ResultCacheFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ResultCacheFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Features.ResultCache
+}
+
+// Represents the Result Cache feature for an individual task (one per task)
+type ResultCacheTask struct {
+	task  *TaskRun
+	index *tcindex.Index
+	// hash of payload and mounted content, calculated when feature starts
+	hash string
+}
+
+func (feature *ResultCacheFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ResultCacheTask{
+		task:  task,
+		index: feature.index,
+	}
+}
+
+// Tasks that reuse the results of other tasks, and whose results other tasks
+// reuse, require the result cache scope for the worker type
+func (rc *ResultCacheTask) RequiredScopes() scopes.Expression {
+	return workerScope(resultCacheScope)
+}
+
+func (rc *ResultCacheTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+// Start runs after the Mounts and Fetches features have placed all content in
+// the task directory, so that its SHA256 is known.
+func (rc *ResultCacheTask) Start() *CommandExecutionError {
+	rc.hash = rc.calculateHash()
+	namespace := rc.namespace()
+	rc.task.Infof("[result-cache] Task hash is %v", rc.hash)
+	var taskID string
+	var entry ResultCacheEntry
+	indexedTask, err := rc.index.FindTask(namespace)
+	if err == nil {
+		if err := json.Unmarshal(indexedTask.Data, &entry); err != nil {
+			rc.task.Warnf("[result-cache] Ignoring index entry %v with unexpected data %v: %v", namespace, string(indexedTask.Data), err)
+			return nil
+		}
+		taskID = indexedTask.TaskID
+	} else {
+		// the index entry may not have been written, e.g. if the index was
+		// unavailable, so also check the runs of this worker
+		record := rc.historyRecord()
+		if record == nil {
+			rc.task.Infof("[result-cache] No earlier successful run found in index namespace %v", namespace)
+			return nil
+		}
+		rc.task.Infof("[result-cache] No earlier successful run found in index namespace %v, but this worker ran an identical task", namespace)
+		taskID, entry.RunID = record.TaskID, record.RunID
+	}
+	rc.task.Infof("[result-cache] Identical task %v run %v completed successfully - exposing its artifacts rather than running task commands", taskID, entry.RunID)
+	e := rc.exposeArtifacts(taskID, entry.RunID)
+	if e != nil {
+		return e
+	}
+	rc.task.resultCacheTaskID = taskID
+	return nil
+}
+
+// historyRecord returns the most recent run in the task history database of
+// an identical task that completed successfully, and whose artifacts have not
+// expired, or nil if there is none
+func (rc *ResultCacheTask) historyRecord() *TaskHistoryRecord {
+	records, err := taskHistory.Query(func(record *TaskHistoryRecord) bool {
+		return record.ResultCacheHash == rc.hash && record.Result == "completed" && time.Time(record.Expires).After(time.Now())
+	}, 1)
+	if err != nil {
+		rc.task.Warnf("[result-cache] Could not read task history database: %v", err)
+		return nil
+	}
+	if len(records) == 0 {
+		return nil
+	}
+	return records[0]
+}
+
+// Stop records the hash of a task that ran successfully, rather than reusing
+// the results of another task. Features that stop later can still fail the
+// task, so the task is only recorded in the index once it has resolved as
+// completed (see recordResultCache).
+func (rc *ResultCacheTask) Stop(err *ExecutionErrors) {
+	if rc.hash == "" || rc.task.resultCacheTaskID != "" || err.Occurred() {
+		return
+	}
+	rc.task.resultCacheHash = rc.hash
+}
+
+func (rc *ResultCacheTask) namespace() string {
+	return resultCacheNamespace(rc.hash)
+}
+
+func resultCacheNamespace(hash string) string {
+	return resultCacheNamespacePrefix + "." + config.ProvisionerID + "." + config.WorkerType + "." + hash
+}
+
+// recordResultCache records a task that has resolved as completed in the
+// index, so that later identical tasks can reuse its artifacts. The task log
+// has already been uploaded, so problems are only reported in the worker log.
+func (task *TaskRun) recordResultCache() {
+	if task.resultCacheHash == "" {
+		return
+	}
+	namespace := resultCacheNamespace(task.resultCacheHash)
+	data, err := json.Marshal(&ResultCacheEntry{RunID: task.RunID})
+	if err != nil {
+		panic(err)
+	}
+	_, err = config.Index().InsertTask(
+		namespace,
+		&tcindex.InsertTaskRequest{
+			TaskID:  task.TaskID,
+			Data:    json.RawMessage(data),
+			Expires: task.Definition.Expires,
+		},
+	)
+	if err != nil {
+		// the task itself has succeeded, so just log the problem
+		log.Printf("WARNING: [result-cache] Could not record task %v in index namespace %v: %v", task.TaskID, namespace, err)
+		return
+	}
+	log.Printf("[result-cache] Recorded task %v in index namespace %v", task.TaskID, namespace)
+}
+
+// calculateHash returns the SHA256 of the normalised task payload, scopes and
+// routes, together with the SHA256 of all mounted and fetched content
+func (rc *ResultCacheTask) calculateHash() string {
+	// round trip through interface{} so that raw json in the payload (such as
+	// mounts) is normalised
+	b, err := json.Marshal(rc.task.Payload)
+	if err != nil {
+		panic(fmt.Sprintf("Internal worker bug! Cannot marshal %#v to json: %v", rc.task.Payload, err))
+	}
+	key := resultCacheKey{
+		Scopes:  sortedCopy(rc.task.Definition.Scopes),
+		Routes:  sortedCopy(rc.task.Definition.Routes),
+		Content: rc.task.contentDigests(),
+	}
+	err = json.Unmarshal(b, &key.Payload)
+	if err != nil {
+		panic(fmt.Sprintf("Internal worker bug! Cannot unmarshal %v: %v", string(b), err))
+	}
+	b, err = json.Marshal(&key)
+	if err != nil {
+		panic(fmt.Sprintf("Internal worker bug! Cannot marshal %#v to json: %v", key, err))
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// contentDigests returns the SHA256 of the content of each mount and fetch,
+// taken from the file caches that the content was downloaded into. Writable
+// directory caches are not included, since their content is not immutable.
+func (task *TaskRun) contentDigests() map[string]string {
+	digests := map[string]string{}
+	add := func(c FSContent) {
+		key := c.UniqueKey()
+		digests[key] = ""
+		if cache, inCache := fileCaches[key]; inCache {
+			digests[key] = cache.SHA256
+		}
+	}
+	for _, m := range task.Payload.Mounts {
+		var mount struct {
+			Content json.RawMessage `json:"content"`
+		}
+		// mounts have already been validated by the Mounts feature
+		if err := json.Unmarshal(m, &mount); err != nil || len(mount.Content) == 0 {
+			continue
+		}
+		if c, err := FSContentFrom(mount.Content); err == nil {
+			add(c)
+		}
+	}
+	for _, fetch := range task.Payload.Fetches {
+		if fetch.TaskID != "" {
+			add(&ArtifactContent{TaskID: fetch.TaskID, Artifact: fetch.Artifact})
+		}
+	}
+	for _, rf := range task.resolvedFetches {
+		add(&ArtifactContent{TaskID: rf.TaskID, Artifact: rf.Artifact})
+	}
+	return digests
+}
+
+// exposeArtifacts creates a redirect artifact for every artifact of the given
+// task run, other than those that features of this task will create
+func (rc *ResultCacheTask) exposeArtifacts(taskID string, runID uint) *CommandExecutionError {
+	continuationToken := ""
+	for {
+		resp, err := queue.ListArtifacts(taskID, strconv.Itoa(int(runID)), continuationToken, "")
+		if err != nil {
+			return ResourceUnavailable(fmt.Errorf("[result-cache] Could not list artifacts of task %v run %v: %v", taskID, runID, err))
+		}
+		for _, a := range resp.Artifacts {
+			if feature := rc.task.featureArtifacts[a.Name]; feature != "" {
+				continue
+			}
+			// artifacts cannot outlive the task that they belong to
+			expires := a.Expires
+			if time.Time(rc.task.Definition.Expires).Before(time.Time(expires)) {
+				expires = rc.task.Definition.Expires
+			}
+			e := rc.task.uploadArtifact(
+				&RedirectArtifact{
+					BaseArtifact: &BaseArtifact{
+						Name:    a.Name,
+						Expires: expires,
+					},
+					ContentType: a.ContentType,
+					URL:         tcurls.API(queue.RootURL, "queue", "v1", fmt.Sprintf("task/%v/runs/%v/artifacts/%v", taskID, runID, a.Name)),
+				},
+			)
+			if e != nil {
+				return e
+			}
+		}
+		if resp.ContinuationToken == "" {
+			return nil
+		}
+		continuationToken = resp.ContinuationToken
+	}
+}
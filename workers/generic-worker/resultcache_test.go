@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func TestResultCacheHash(t *testing.T) {
+	hashWithScopes := func(mount string, scopes ...string) string {
+		rc := &ResultCacheTask{
+			task: &TaskRun{
+				Definition: tcqueue.TaskDefinitionResponse{
+					Scopes: scopes,
+				},
+				Payload: GenericWorkerPayload{
+					Mounts: []json.RawMessage{json.RawMessage(mount)},
+				},
+			},
+		}
+		return rc.calculateHash()
+	}
+	hash := func(mount string) string {
+		return hashWithScopes(mount)
+	}
+	original := hash(`{"file": "a.txt", "content": {"raw": "hello"}}`)
+	reformatted := hash(`{"content":{"raw":"hello"},"file":"a.txt"}`)
+	modified := hash(`{"file": "a.txt", "content": {"raw": "goodbye"}}`)
+	if original != reformatted {
+		t.Fatalf("Was expecting formatting of payload not to affect hash, but got %v and %v", original, reformatted)
+	}
+	if original == modified {
+		t.Fatalf("Was expecting different mount content to give different hashes, but both were %v", original)
+	}
+	scoped := hashWithScopes(`{"file": "a.txt", "content": {"raw": "hello"}}`, "secrets:get:a", "secrets:get:b")
+	reordered := hashWithScopes(`{"file": "a.txt", "content": {"raw": "hello"}}`, "secrets:get:b", "secrets:get:a")
+	if scoped == original || scoped != reordered {
+		t.Fatalf("Was expecting task scopes, but not their order, to affect hash, but got %v, %v and %v", original, scoped, reordered)
+	}
+}
+
+func TestResultCacheReusesArtifacts(t *testing.T) {
+	defer setup(t)()
+
+	payload := GenericWorkerPayload{
+		Mounts: toMountArray(t, &[]FileMount{
+			{
+				File:    "result.txt",
+				Content: json.RawMessage(`{"raw": "deterministic output"}`),
+			},
+		}),
+		Artifacts: []Artifact{
+			{
+				Path:    "result.txt",
+				Expires: inAnHour,
+				Type:    "file",
+				Name:    "public/result.txt",
+			},
+		},
+		// make sure task hash is unique to this test run
+		Env: map[string]string{
+			"RESULT_CACHE_TEST": slugid.Nice(),
+		},
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+	payload.Features.ResultCache = true
+
+	td := testTask(t)
+	td.Scopes = []string{"generic-worker:result-cache:" + td.ProvisionerID + "/" + td.WorkerType}
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	td = testTask(t)
+	td.Scopes = []string{"generic-worker:result-cache:" + td.ProvisionerID + "/" + td.WorkerType}
+	taskID := submitAndAssert(t, td, payload, "completed", "completed")
+
+	bytes, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		t.Fatalf("Error when trying to read log file: %v", err)
+	}
+	logtext := string(bytes)
+	if !strings.Contains(logtext, "[result-cache] Identical task") {
+		t.Fatalf("Was expecting second task to reuse result of first task, but it didn't:\n%v", logtext)
+	}
+	b, _, _, _ := getArtifactContent(t, taskID, "public/result.txt")
+	if string(b) != "deterministic output" {
+		t.Fatalf("Was expecting reused artifact to contain %q but it contains %q", "deterministic output", string(b))
+	}
+}
+
+func TestResultCacheMissingScopes(t *testing.T) {
+	defer setup(t)()
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 180,
+	}
+	payload.Features.ResultCache = true
+
+	td := testTask(t)
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
 )
 
+// scope required by tasks in order to use the feature
+const runAsAdministratorScope scopes.Pattern = "generic-worker:run-as-administrator:<provisionerId>/<workerType>"
+
 type RunAsAdministratorFeature struct {
 }
 
@@ -14,6 +17,14 @@ func (feature *RunAsAdministratorFeature) Name() string {
 	return "Run As Administrator"
 }
 
+func (feature *RunAsAdministratorFeature) PayloadName() string {
+	return "runAsAdministrator"
+}
+
+func (feature *RunAsAdministratorFeature) ScopePattern() scopes.Pattern {
+	return runAsAdministratorScope
+}
+
 func (feature *RunAsAdministratorFeature) Initialise() error {
 	return nil
 }
@@ -40,10 +51,8 @@ func (feature *RunAsAdministratorFeature) NewTaskFeature(task *TaskRun) TaskFeat
 	}
 }
 
-func (l *RunAsAdministratorTask) RequiredScopes() scopes.Required {
-	return scopes.Required{{
-		"generic-worker:run-as-administrator:" + config.ProvisionerID + "/" + config.WorkerType,
-	}}
+func (l *RunAsAdministratorTask) RequiredScopes() scopes.Expression {
+	return workerScope(runAsAdministratorScope)
 }
 
 func (l *RunAsAdministratorTask) Start() *CommandExecutionError {
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"io"
 	"os"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
 )
 
 func copyFileContents(src, dst string) (err error) {
@@ -21,7 +22,8 @@ func copyFileContents(src, dst string) (err error) {
 			err = cerr
 		}
 	}()
-	if _, err = io.Copy(out, in); err != nil {
+	// keep sparse files, such as disk images, sparse
+	if _, err = fileutil.WriteSparse(out, in); err != nil {
 		return
 	}
 	err = out.Sync()
@@ -4,15 +4,27 @@ import (
 	"github.com/dchest/uniuri"
 )
 
+// passwordPrefix ensures that generated passwords contain a special character
+// (_), lowercase and uppercase letters, and a number
+const passwordPrefix = "pWd0_"
+
+// MinPasswordLength is the shortest password that GeneratePassword generates
+const MinPasswordLength = len(passwordPrefix) + 8
+
+// GeneratePassword returns a random password of the given length, which is
+// raised to MinPasswordLength if it is shorter.
+//
 // Uses [A-Za-z0-9] characters (default set) to avoid strange escaping problems
 // that could potentially affect security. Prefixed with `pWd0_` to ensure
 // password contains a special character (_), lowercase and uppercase letters,
 // and a number. This is useful if the OS has a strict password policy
-// requiring all of these. The total password length is 29 characters (24 of
-// which are random). 29 characters should not be too long for the OS. The 24
-// random characters of [A-Za-z0-9] provide (26+26+10)^24 possible permutations
-// (approx 143 bits of randomness). Randomisation is not seeded, so results
-// should not be reproducible.
-func GeneratePassword() string {
-	return "pWd0_" + uniuri.NewLen(24)
+// requiring all of these. With the default length of 29 characters (24 of
+// which are random), the random characters of [A-Za-z0-9] provide
+// (26+26+10)^24 possible permutations (approx 143 bits of randomness).
+// Randomisation is not seeded, so results should not be reproducible.
+func GeneratePassword(length int) string {
+	if length < MinPasswordLength {
+		length = MinPasswordLength
+	}
+	return passwordPrefix + uniuri.NewLen(length-len(passwordPrefix))
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -116,6 +117,15 @@ func InteractiveUsername() (string, error) {
 	return cachedInteractiveUsername, nil
 }
 
+// VerifyProfile checks that the home directory of the given user exists
+func VerifyProfile(username string) error {
+	homeDir := filepath.Join(UserHomeDirectoriesParent(), username)
+	if _, err := os.Stat(homeDir); err != nil {
+		return fmt.Errorf("Home directory %v of user %v not found: %v", homeDir, username, err)
+	}
+	return nil
+}
+
 func AutoLogonUser() (username string) {
 	var err error
 	username, err = kc.AutoLoginUsername()
@@ -125,6 +135,12 @@ func AutoLogonUser() (username string) {
 	return
 }
 
+// DeleteOrphanedProfiles does nothing, since the only state of a user profile
+// is the home directory of the user
+func DeleteOrphanedProfiles(match func(profileDirName string) bool) (deleted int, err error) {
+	return 0, nil
+}
+
 func SetAutoLogin(user *OSUser) error {
 	return kc.SetAutoLogin(user.Name, []byte(user.Password))
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -78,6 +80,21 @@ func InteractiveUsername() (string, error) {
 	return gdm3.InteractiveUsername()
 }
 
+// VerifyProfile checks that the home directory of the given user exists
+func VerifyProfile(username string) error {
+	homeDir := filepath.Join(UserHomeDirectoriesParent(), username)
+	if _, err := os.Stat(homeDir); err != nil {
+		return fmt.Errorf("Home directory %v of user %v not found: %v", homeDir, username, err)
+	}
+	return nil
+}
+
+// DeleteOrphanedProfiles does nothing, since the only state of a user profile
+// is the home directory of the user
+func DeleteOrphanedProfiles(match func(profileDirName string) bool) (deleted int, err error) {
+	return 0, nil
+}
+
 func SetAutoLogin(user *OSUser) error {
 	source, err := ioutil.ReadFile(gdm3CustomConfFile)
 	if err != nil {
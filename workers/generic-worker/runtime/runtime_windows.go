@@ -3,7 +3,9 @@ package runtime
 import (
 	"fmt"
 	"log"
+	"os"
 	"os/user"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -98,9 +100,34 @@ func UserHomeDirectoriesParent() string {
 	return win32.ProfilesDirectory()
 }
 
+// WaitForLoginCompletion waits for a user to log in to the console session,
+// and for Winlogon to load the registry hive of their user profile, since
+// until it has, processes of the user can't use HKEY_CURRENT_USER
 func WaitForLoginCompletion(timeout time.Duration) error {
-	_, err := win32.InteractiveUserToken(timeout)
-	return err
+	deadline := time.Now().Add(timeout)
+	userToken, err := win32.InteractiveUserToken(timeout)
+	if err != nil {
+		return err
+	}
+	tokenUser, err := userToken.GetTokenUser()
+	if err != nil {
+		return fmt.Errorf("Could not look up user of interactive user token: %v", err)
+	}
+	sid, err := tokenUser.User.Sid.String()
+	if err != nil {
+		return fmt.Errorf("Could not convert SID of interactive user to string: %v", err)
+	}
+	for {
+		k, err := registry.OpenKey(registry.USERS, sid, registry.QUERY_VALUE)
+		if err == nil {
+			k.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Registry hive of interactive user (SID %v) not loaded after %v: %v", sid, timeout, err)
+		}
+		time.Sleep(time.Second / 10)
+	}
 }
 
 func InteractiveUsername() (string, error) {
@@ -119,6 +146,83 @@ func InteractiveUsername() (string, error) {
 	return account, nil
 }
 
+// VerifyProfile checks that the interactive user, who should be the given
+// user, has logged in with their own user profile, rather than with a
+// temporary profile, which Windows falls back to if it can't load the user
+// profile
+func VerifyProfile(username string) error {
+	userToken, err := win32.InteractiveUserToken(time.Minute)
+	if err != nil {
+		return err
+	}
+	profileDir, err := win32.ProfileDirectory(userToken)
+	if err != nil {
+		return fmt.Errorf("Could not look up profile directory of user %v: %v", username, err)
+	}
+	// profile directories can have a suffix, e.g. C:\Users\task_1234.000
+	name := strings.ToLower(filepath.Base(profileDir))
+	expected := strings.ToLower(username)
+	if name != expected && !strings.HasPrefix(name, expected+".") {
+		return fmt.Errorf("User %v logged in with temporary profile %v", username, profileDir)
+	}
+	_, err = os.Stat(filepath.Join(profileDir, "NTUSER.DAT"))
+	if err != nil {
+		return fmt.Errorf("Profile directory %v of user %v has no registry hive: %v", profileDir, username, err)
+	}
+	return nil
+}
+
+// DeleteOrphanedProfiles deletes the user profiles whose user account no
+// longer exists, and whose profile directory name match returns true for.
+// Deleting a user account doesn't delete its profile, so profiles are
+// orphaned if the worker stops after deleting a task user, but before
+// deleting its profile.
+func DeleteOrphanedProfiles(match func(profileDirName string) bool) (deleted int, err error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`, registry.ENUMERATE_SUB_KEYS|registry.WOW64_64KEY)
+	if err != nil {
+		return 0, fmt.Errorf("Could not open registry key ProfileList: %v", err)
+	}
+	defer k.Close()
+	sids, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return 0, fmt.Errorf("Could not read subkeys of registry key ProfileList: %v", err)
+	}
+	failures := []string{}
+	for _, sid := range sids {
+		profileDir, err := profileImagePath(k, sid)
+		if err != nil || !match(filepath.Base(profileDir)) {
+			continue
+		}
+		if _, err := user.LookupId(sid); err == nil {
+			continue
+		}
+		log.Printf("Deleting orphaned profile %v of deleted user (SID %v)", profileDir, sid)
+		sidPtr, err := syscall.UTF16PtrFromString(sid)
+		if err == nil {
+			err = win32.DeleteProfile(sidPtr, nil, nil)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Could not delete orphaned profile %v (SID %v): %v", profileDir, sid, err))
+			continue
+		}
+		deleted++
+	}
+	if len(failures) > 0 {
+		err = fmt.Errorf("%v", strings.Join(failures, "\n"))
+	}
+	return deleted, err
+}
+
+func profileImagePath(profileList registry.Key, sid string) (string, error) {
+	k, err := registry.OpenKey(profileList, sid, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return "", err
+	}
+	defer k.Close()
+	path, _, err := k.GetStringValue("ProfileImagePath")
+	return path, err
+}
+
 func AutoLogonUser() (username string) {
 	// Set flag registry.WOW64_64KEY since Windows 10 ARM machines will otherwise read from:
 	// HKEY_LOCAL_MACHINE\SOFTWARE\WOW6432Node\Microsoft\Windows NT\CurrentVersion\Winlogon
@@ -0,0 +1,269 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pborman/uuid"
+	tcurls "github.com/taskcluster/taskcluster-lib-urls"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+var (
+	// artifact names of the SBOM, by format
+	sbomArtifactNames = map[string]string{
+		"cyclonedx": "public/sbom.cdx.json",
+		"spdx":      "public/sbom.spdx.json",
+	}
+	// file, relative to task directory, that the SBOM is written to before it
+	// is uploaded
+	sbomFile = filepath.Join("generic-worker", "sbom.json")
+)
+
+type (
+	// SBOMFeature publishes a software bill of materials of tasks that
+	// configure task.payload.sbom, listing the content mounted and fetched
+	// into the task, and the packages in the manifests that the task
+	// commands write
+	SBOMFeature struct {
+	}
+
+	SBOMTask struct {
+		task *TaskRun
+	}
+
+	// sbomPackage is a package listed in a package manifest, or content
+	// mounted or fetched into the task
+	sbomPackage struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+		PURL    string `json:"purl,omitempty"`
+		// SHA256 of mounted and fetched content, which is never set in
+		// package manifests
+		SHA256 string `json:"-"`
+	}
+)
+
+func (feature *SBOMFeature) Name() string {
+	return "SBOM"
+}
+
+func (feature *SBOMFeature) Initialise() error {
+	return nil
+}
+
+func (feature *SBOMFeature) PersistState() error {
+	return nil
+}
+
+func (feature *SBOMFeature) IsEnabled(task *TaskRun) bool {
+	return task.Payload.Sbom.Format != ""
+}
+
+func (feature *SBOMFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &SBOMTask{
+		task: task,
+	}
+}
+
+func (st *SBOMTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (st *SBOMTask) ReservedArtifacts() []string {
+	return []string{
+		sbomArtifactNames[st.task.Payload.Sbom.Format],
+	}
+}
+
+func (st *SBOMTask) Start() *CommandExecutionError {
+	for _, manifest := range st.task.Payload.Sbom.Manifests {
+		if !withinTaskDirectory(manifest) {
+			return MalformedPayloadError(fmt.Errorf("[sbom] task.payload.sbom.manifests entry %q must be relative to, and inside, the task directory", manifest))
+		}
+	}
+	return nil
+}
+
+// Stop publishes the SBOM of the task, which is uploaded before chain of
+// trust certificates are created, so that it is covered by them
+func (st *SBOMTask) Stop(err *ExecutionErrors) {
+	format := st.task.Payload.Sbom.Format
+	packages, e := st.packages()
+	if e != nil {
+		err.add(Failure(fmt.Errorf("[sbom] %v", e)))
+		return
+	}
+	var sbom interface{}
+	switch format {
+	case "cyclonedx":
+		sbom = st.cycloneDX(packages, time.Now())
+	case "spdx":
+		sbom = st.spdx(packages, time.Now())
+	}
+	e = fileutil.WriteToFileAsJSON(sbom, filepath.Join(taskContext.TaskDir, sbomFile))
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[sbom] Could not write %v: %v", sbomFile, e)))
+		return
+	}
+	st.task.Infof("[sbom] Publishing %v SBOM with %v packages as %v", format, len(packages), sbomArtifactNames[format])
+	err.add(st.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    sbomArtifactNames[format],
+				Expires: st.task.Definition.Expires,
+			},
+			ContentType: "application/json",
+			Path:        sbomFile,
+		},
+	))
+}
+
+// packages returns the content mounted and fetched into the task, sorted,
+// followed by the packages of each manifest
+func (st *SBOMTask) packages() ([]*sbomPackage, error) {
+	packages := []*sbomPackage{}
+	digests := st.task.contentDigests()
+	keys := make([]string, 0, len(digests))
+	for key := range digests {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		packages = append(packages, &sbomPackage{
+			Name:   key,
+			SHA256: digests[key],
+		})
+	}
+	for _, manifest := range st.task.Payload.Sbom.Manifests {
+		manifestPackages, err := readPackageManifest(filepath.Join(taskContext.TaskDir, manifest))
+		if err != nil {
+			return nil, fmt.Errorf("Could not read package manifest %v: %v", manifest, err)
+		}
+		packages = append(packages, manifestPackages...)
+	}
+	return packages, nil
+}
+
+func readPackageManifest(file string) ([]*sbomPackage, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	packages := []*sbomPackage{}
+	err = json.Unmarshal(data, &packages)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range packages {
+		if p == nil || p.Name == "" {
+			return nil, fmt.Errorf("package %v has no name", i)
+		}
+	}
+	return packages, nil
+}
+
+// cycloneDX returns the given packages as a CycloneDX 1.4 SBOM
+func (st *SBOMTask) cycloneDX(packages []*sbomPackage, now time.Time) map[string]interface{} {
+	components := []map[string]interface{}{}
+	for _, p := range packages {
+		component := map[string]interface{}{
+			"type": "library",
+			"name": p.Name,
+		}
+		if p.Version != "" {
+			component["version"] = p.Version
+		}
+		if p.PURL != "" {
+			component["purl"] = p.PURL
+		}
+		if p.SHA256 != "" {
+			component["type"] = "file"
+			component["hashes"] = []map[string]string{
+				{
+					"alg":     "SHA-256",
+					"content": p.SHA256,
+				},
+			}
+		}
+		components = append(components, component)
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.4",
+		"serialNumber": "urn:uuid:" + uuid.NewRandom().String(),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": now.UTC().Format(time.RFC3339),
+			"tools": []map[string]string{
+				{
+					"vendor":  "Taskcluster",
+					"name":    "generic-worker",
+					"version": version,
+				},
+			},
+			"component": map[string]interface{}{
+				"type":    "application",
+				"name":    st.task.Definition.Metadata.Name,
+				"bom-ref": st.task.TaskID + "/" + strconv.Itoa(int(st.task.RunID)),
+			},
+		},
+		"components": components,
+	}
+}
+
+// spdx returns the given packages as an SPDX 2.3 document
+func (st *SBOMTask) spdx(packages []*sbomPackage, now time.Time) map[string]interface{} {
+	spdxPackages := []map[string]interface{}{}
+	for i, p := range packages {
+		spdxPackage := map[string]interface{}{
+			"name":             p.Name,
+			"SPDXID":           "SPDXRef-Package-" + strconv.Itoa(i+1),
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+		}
+		if p.Version != "" {
+			spdxPackage["versionInfo"] = p.Version
+		}
+		if p.PURL != "" {
+			spdxPackage["externalRefs"] = []map[string]string{
+				{
+					"referenceCategory": "PACKAGE-MANAGER",
+					"referenceType":     "purl",
+					"referenceLocator":  p.PURL,
+				},
+			}
+		}
+		if p.SHA256 != "" {
+			spdxPackage["checksums"] = []map[string]string{
+				{
+					"algorithm":     "SHA256",
+					"checksumValue": p.SHA256,
+				},
+			}
+		}
+		spdxPackages = append(spdxPackages, spdxPackage)
+	}
+	runID := strconv.Itoa(int(st.task.RunID))
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              strings.TrimSpace(st.task.Definition.Metadata.Name + " (task " + st.task.TaskID + " run " + runID + ")"),
+		"documentNamespace": tcurls.API(config.RootURL, "queue", "v1", fmt.Sprintf("task/%v/runs/%v/artifacts/%v", st.task.TaskID, runID, sbomArtifactNames["spdx"])) + "#" + uuid.NewRandom().String(),
+		"creationInfo": map[string]interface{}{
+			"created":  now.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: generic-worker-" + version},
+		},
+		"packages": spdxPackages,
+	}
+}
@@ -0,0 +1,73 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestReadPackageManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sbom")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := filepath.Join(dir, "packages.json")
+	err = ioutil.WriteFile(manifest, []byte(`[{"name": "requests", "version": "2.25.1", "purl": "pkg:pypi/requests@2.25.1"}, {"name": "gcc"}]`), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	packages, err := readPackageManifest(manifest)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(packages) != 2 || packages[0].PURL != "pkg:pypi/requests@2.25.1" || packages[1].Name != "gcc" {
+		t.Fatalf("Unexpected packages in manifest: %#v", packages)
+	}
+	err = ioutil.WriteFile(manifest, []byte(`[{"version": "1.0"}]`), 0644)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := readPackageManifest(manifest); err == nil {
+		t.Fatal("Was expecting package without name to be invalid")
+	}
+}
+
+func TestSBOMFormats(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			RootURL: "https://tc.example.com",
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	st := &SBOMTask{
+		task: &TaskRun{
+			TaskID: "KTBKfEgxR5GdfIIREQIvFQ",
+		},
+	}
+	packages := []*sbomPackage{
+		{Name: "artifact:KTBKfEgxR5GdfIIREQIvFQ:public/toolchain.tar.gz", SHA256: "ab12"},
+		{Name: "requests", Version: "2.25.1", PURL: "pkg:pypi/requests@2.25.1"},
+	}
+	bom := st.cycloneDX(packages, time.Now())
+	components := bom["components"].([]map[string]interface{})
+	if len(components) != 2 || components[0]["type"] != "file" || components[1]["purl"] != "pkg:pypi/requests@2.25.1" {
+		t.Fatalf("Unexpected CycloneDX components: %#v", components)
+	}
+	doc := st.spdx(packages, time.Now())
+	spdxPackages := doc["packages"].([]map[string]interface{})
+	if len(spdxPackages) != 2 || spdxPackages[1]["SPDXID"] != "SPDXRef-Package-2" || spdxPackages[1]["versionInfo"] != "2.25.1" {
+		t.Fatalf("Unexpected SPDX packages: %#v", spdxPackages)
+	}
+	if _, hasChecksums := spdxPackages[0]["checksums"]; !hasChecksums {
+		t.Fatal("Was expecting SPDX package of mounted content to have a checksum")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/cron"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// file in the current directory of the worker recording when each maintenance
+// window last started, so that a window isn't run again after the worker
+// reboots within it
+const maintenanceWindowsFile = "maintenance-windows.json"
+
+// MaintenanceWindows runs the configured maintenance windows. When a window
+// starts, the worker stops claiming tasks, and once its task (if any) has
+// been resolved, runs the commands of the window, reboots if they require it,
+// and then resumes claiming.
+type MaintenanceWindows struct {
+	windows   []gwconfig.MaintenanceWindow
+	schedules []*cron.Schedule
+	logDir    string
+	stateFile string
+	// window name -> start of the window that last ran
+	lastStarted map[string]time.Time
+}
+
+// NewMaintenanceWindows returns the maintenance windows of the given config,
+// whose schedules have already been validated by config.Validate(), and
+// writes the output of window <name> to <logDir>/<name>.log.
+func NewMaintenanceWindows(windows []gwconfig.MaintenanceWindow, logDir, stateFile string) *MaintenanceWindows {
+	mw := &MaintenanceWindows{
+		windows:     windows,
+		schedules:   make([]*cron.Schedule, len(windows)),
+		logDir:      logDir,
+		stateFile:   stateFile,
+		lastStarted: map[string]time.Time{},
+	}
+	for i, window := range windows {
+		mw.schedules[i], _ = cron.Parse(window.Schedule)
+	}
+	data, err := ioutil.ReadFile(stateFile)
+	if err == nil {
+		err = json.Unmarshal(data, &mw.lastStarted)
+		if err != nil {
+			log.Printf("WARNING: could not read %v: %v", stateFile, err)
+		}
+	}
+	return mw
+}
+
+// Due returns the window that is open at the given time, with when it
+// started and ends, if it hasn't already run, or nil otherwise
+func (mw *MaintenanceWindows) Due(now time.Time) (*gwconfig.MaintenanceWindow, time.Time, time.Time) {
+	now = now.UTC()
+	for i, window := range mw.windows {
+		duration := time.Duration(window.DurationMins) * time.Minute
+		started := mw.schedules[i].Latest(now, now.Add(-duration))
+		if started.IsZero() || !now.Before(started.Add(duration)) {
+			continue
+		}
+		// schedules such as "* 2 * * *" match every minute of a window that
+		// has already run
+		if last, ran := mw.lastStarted[window.Name]; ran && started.Before(last.Add(duration)) {
+			continue
+		}
+		return &mw.windows[i], started, started.Add(duration)
+	}
+	return nil, time.Time{}, time.Time{}
+}
+
+// Run runs the commands of the given window, one after another, killing them
+// when the window ends. It returns whether a reboot is required.
+func (mw *MaintenanceWindows) Run(window *gwconfig.MaintenanceWindow, started, ends time.Time) (rebootRequired bool) {
+	now := time.Now()
+	log.Printf("Maintenance window %q started at %v: not claiming tasks until %v", window.Name, started, ends)
+	logEventWithFields("maintenanceWindowStarted", nil, now, map[string]interface{}{
+		"maintenanceWindow": window.Name,
+	})
+	mw.lastStarted[window.Name] = started
+	err := fileutil.WriteToFileAsJSON(mw.lastStarted, mw.stateFile)
+	if err != nil {
+		log.Printf("WARNING: could not record start of maintenance window %q in %v, so it may be run again: %v", window.Name, mw.stateFile, err)
+	}
+
+	var output io.Writer = ioutil.Discard
+	if logFile, err := mw.logFile(window); err != nil {
+		log.Printf("WARNING: could not create log file of maintenance window %q, so its output is discarded: %v", window.Name, err)
+	} else {
+		defer logFile.Close()
+		output = logFile
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), ends)
+	defer cancel()
+	failed := 0
+	for i, command := range window.Commands {
+		if ctx.Err() != nil {
+			log.Printf("WARNING: maintenance window %q ended before command %v %q could run", window.Name, i, command)
+			failed++
+			continue
+		}
+		exitCode, err := runMaintenanceCommand(ctx, command, output)
+		switch {
+		case err != nil:
+			log.Printf("WARNING: maintenance window %q command %v %q failed: %v", window.Name, i, command, err)
+			failed++
+		case rebootExitCode(window, exitCode):
+			log.Printf("Maintenance window %q command %v %q exited with exit code %v, so a reboot is required", window.Name, i, command, exitCode)
+			rebootRequired = true
+		case exitCode != 0:
+			log.Printf("WARNING: maintenance window %q command %v %q exited with exit code %v", window.Name, i, command, exitCode)
+			failed++
+		}
+	}
+	duration := time.Since(now)
+	log.Printf("Maintenance window %q completed in %v, with %v failed command(s)", window.Name, duration, failed)
+	logEventWithFields("maintenanceWindowFinished", nil, time.Now(), map[string]interface{}{
+		"maintenanceWindow": window.Name,
+		"durationSecs":      int64(duration / time.Second),
+		"failedCommands":    failed,
+		"rebootRequired":    rebootRequired,
+	})
+	return
+}
+
+func (mw *MaintenanceWindows) logFile(window *gwconfig.MaintenanceWindow) (*os.File, error) {
+	err := os.MkdirAll(mw.logDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(filepath.Join(mw.logDir, window.Name+".log"))
+}
+
+func rebootExitCode(window *gwconfig.MaintenanceWindow, exitCode int64) bool {
+	for _, code := range window.RebootExitCodes {
+		if exitCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// runMaintenanceCommand runs the given command, killing it, and any processes
+// it spawns, if the context is done first, and returns its exit code
+func runMaintenanceCommand(ctx context.Context, command []string, output io.Writer) (int64, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	setMaintenanceProcessGroup(cmd)
+	err := cmd.Start()
+	if err != nil {
+		return 0, err
+	}
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err = <-exited:
+	case <-ctx.Done():
+		killErr := killMaintenanceJob(cmd)
+		if killErr != nil {
+			log.Printf("WARNING: could not kill maintenance command %q: %v", command, killErr)
+		}
+		<-exited
+		return 0, ctx.Err()
+	}
+	if exitErr, isExitErr := err.(*exec.ExitError); isExitErr {
+		return int64(exitErr.ExitCode()), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestMaintenanceWindowDue(t *testing.T) {
+	logDir, teardown := maintenanceLogDir(t)
+	defer teardown()
+	window := gwconfig.MaintenanceWindow{
+		Name:         "weekly",
+		Schedule:     "0 2 * * 6",
+		DurationMins: 60,
+	}
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	stateFile := filepath.Join(logDir, maintenanceWindowsFile)
+	mw := NewMaintenanceWindows([]gwconfig.MaintenanceWindow{window}, logDir, stateFile)
+
+	// Saturday
+	started := time.Date(2020, 2, 29, 2, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		now time.Time
+		due bool
+	}{
+		{started.Add(-time.Minute), false},
+		{started, true},
+		{started.Add(59 * time.Minute), true},
+		{started.Add(time.Hour), false},
+		{started.Add(24 * time.Hour), false},
+	} {
+		if due, _, _ := mw.Due(test.now); (due != nil) != test.due {
+			t.Errorf("Was expecting window to be due=%v at %v", test.due, test.now)
+		}
+	}
+
+	due, dueStarted, ends := mw.Due(started.Add(30 * time.Minute))
+	if !dueStarted.Equal(started) || !ends.Equal(started.Add(time.Hour)) {
+		t.Fatalf("Was expecting window from %v to %v, but got %v to %v", started, started.Add(time.Hour), dueStarted, ends)
+	}
+	// the window ended long ago, so its commands don't run
+	if mw.Run(due, dueStarted, ends) {
+		t.Fatal("Was not expecting window without commands to require a reboot")
+	}
+	if due, _, _ := mw.Due(started.Add(31 * time.Minute)); due != nil {
+		t.Fatal("Was not expecting window to be due again after it ran")
+	}
+	// the worker rebooted
+	mw = NewMaintenanceWindows([]gwconfig.MaintenanceWindow{window}, logDir, stateFile)
+	if due, _, _ := mw.Due(started.Add(32 * time.Minute)); due != nil {
+		t.Fatal("Was not expecting window to be due again after worker restarted")
+	}
+	// next week
+	if due, _, _ := mw.Due(started.Add(7 * 24 * time.Hour)); due == nil {
+		t.Fatal("Was expecting window to be due next week")
+	}
+}
+
+func TestMaintenanceWindowRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Maintenance window test commands are posix shell commands")
+	}
+	logDir, teardown := maintenanceLogDir(t)
+	defer teardown()
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	window := gwconfig.MaintenanceWindow{
+		Name: "updates",
+		Commands: [][]string{
+			{"sh", "-c", "echo updating"},
+			{"sh", "-c", "exit 3"},
+			longRunningMaintenanceCommand(),
+			{"sh", "-c", "echo too late"},
+		},
+		RebootExitCodes: []int64{3},
+	}
+	mw := NewMaintenanceWindows([]gwconfig.MaintenanceWindow{window}, logDir, filepath.Join(logDir, maintenanceWindowsFile))
+	start := time.Now()
+	if !mw.Run(&window, start, start.Add(2*time.Second)) {
+		t.Fatal("Was expecting exit code 3 to require a reboot")
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Fatalf("Was expecting command to be killed when the window ended, but window took %v", d)
+	}
+	output, err := ioutil.ReadFile(filepath.Join(logDir, "updates.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "updating") || strings.Contains(string(output), "too late") {
+		t.Fatalf("Was expecting only the commands before the window ended to run, but got output:\n%s", output)
+	}
+}
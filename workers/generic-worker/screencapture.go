@@ -0,0 +1,256 @@
+// +build multiuser
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	screenshotArtifactName = "public/screencapture/screenshot.png"
+	// length of each screen recording segment
+	recordingSegmentSeconds = 10
+	// frames per second of screen recordings
+	recordingFrameRate = 5
+)
+
+var (
+	// directory, relative to task directory, that screen captures are
+	// written to
+	screenCaptureDir = filepath.Join("generic-worker", "screencapture")
+	// how long to wait for a screenshot to be taken, or a screen recording
+	// to terminate, before giving up
+	screenCaptureTimeout = 30 * time.Second
+)
+
+type ScreenCaptureFeature struct {
+}
+
+func (feature *ScreenCaptureFeature) Name() string {
+	return "Screen Capture"
+}
+
+func (feature *ScreenCaptureFeature) PayloadName() string {
+	return "screenCapture"
+}
+
+func (feature *ScreenCaptureFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *ScreenCaptureFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ScreenCaptureFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ScreenCaptureFeature) IsEnabled(task *TaskRun) bool {
+	sc := task.Payload.ScreenCapture
+	return sc.Screenshot || sc.RecordingSeconds > 0
+}
+
+type ScreenCaptureTask struct {
+	sync.Mutex
+	task *TaskRun
+	// true once a screenshot has been taken (or attempted), or the feature
+	// has stopped, so that at most one screenshot is taken
+	screenshotTaken bool
+	// the ffmpeg process recording the screen, or nil if not recording
+	recorder *process.Command
+	// closed when the recorder exits
+	recorded chan struct{}
+	// true once Stop has started killing the recorder
+	stopping bool
+}
+
+func (feature *ScreenCaptureFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ScreenCaptureTask{
+		task: task,
+	}
+}
+
+func (sct *ScreenCaptureTask) RequiredScopes() scopes.Expression {
+	// only the task user's own desktop is captured
+	return scopes.AllOf{}
+}
+
+func (sct *ScreenCaptureTask) ReservedArtifacts() []string {
+	artifacts := []string{screenshotArtifactName}
+	for i := 0; i < sct.recordingSegments(); i++ {
+		artifacts = append(artifacts, recordingArtifactName(i))
+	}
+	return artifacts
+}
+
+// recordingSegments returns how many recording segments are kept, including
+// the segment currently being recorded, or 0 if recording is not enabled
+func (sct *ScreenCaptureTask) recordingSegments() int {
+	seconds := int(sct.task.Payload.ScreenCapture.RecordingSeconds)
+	if seconds <= 0 {
+		return 0
+	}
+	return (seconds+recordingSegmentSeconds-1)/recordingSegmentSeconds + 1
+}
+
+func recordingArtifactName(index int) string {
+	return "public/screencapture/recording-" + strconv.Itoa(index) + ".ts"
+}
+
+func (sct *ScreenCaptureTask) Start() *CommandExecutionError {
+	err := MkdirAllTaskUser(filepath.Join(taskContext.TaskDir, screenCaptureDir), 0700)
+	if err != nil {
+		panic(err)
+	}
+	if sct.task.Payload.ScreenCapture.Screenshot {
+		// capture the desktop while the aborted task processes are still
+		// running
+		sct.task.beforeKill = append(sct.task.beforeKill, sct.takeScreenshot)
+	}
+	if sct.recordingSegments() > 0 {
+		sct.startRecording()
+	}
+	return nil
+}
+
+// takeScreenshot takes a screenshot of the task user's desktop, unless one has
+// already been taken. Failures are logged, since the screenshot is purely
+// diagnostic.
+func (sct *ScreenCaptureTask) takeScreenshot() {
+	sct.Lock()
+	defer sct.Unlock()
+	if sct.screenshotTaken {
+		return
+	}
+	sct.screenshotTaken = true
+	file := filepath.Join(taskContext.TaskDir, screenCaptureDir, "screenshot.png")
+	cmd, err := process.NewCommand(screenshotCommand(file), taskContext.TaskDir, screenCaptureEnv(sct.task), taskContext.pd)
+	if err != nil {
+		sct.task.Warnf("[screencapture] Could not create screenshot process: %v", err)
+		return
+	}
+	result := make(chan *process.Result, 1)
+	go func() {
+		result <- cmd.Execute()
+	}()
+	select {
+	case r := <-result:
+		if !r.Succeeded() {
+			sct.task.Warnf("[screencapture] Could not take screenshot: %v", r)
+			return
+		}
+		sct.task.Info("[screencapture] Took screenshot of desktop")
+	case <-time.After(screenCaptureTimeout):
+		_, _ = cmd.Kill()
+		sct.task.Warnf("[screencapture] Timed out taking screenshot after %v", screenCaptureTimeout)
+	}
+}
+
+// startRecording starts ffmpeg recording the task user's desktop as a ring of
+// segment files, so that only the most recent recording is kept
+func (sct *ScreenCaptureTask) startRecording() {
+	pattern := filepath.Join(taskContext.TaskDir, screenCaptureDir, "recording-%03d.ts")
+	cmdLine := append([]string{"ffmpeg", "-nostdin", "-loglevel", "error", "-framerate", strconv.Itoa(recordingFrameRate)}, recordingInput()...)
+	cmdLine = append(cmdLine,
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-pix_fmt", "yuv420p",
+		"-f", "segment",
+		"-segment_time", strconv.Itoa(recordingSegmentSeconds),
+		"-segment_wrap", strconv.Itoa(sct.recordingSegments()),
+		// transport stream segments remain playable when ffmpeg is killed
+		"-segment_format", "mpegts",
+		"-reset_timestamps", "1",
+		pattern,
+	)
+	cmd, err := process.NewCommand(cmdLine, taskContext.TaskDir, screenCaptureEnv(sct.task), taskContext.pd)
+	if err != nil {
+		sct.task.Warnf("[screencapture] Could not create screen recording process: %v", err)
+		return
+	}
+	sct.recorder = cmd
+	sct.recorded = make(chan struct{})
+	go func() {
+		defer close(sct.recorded)
+		r := cmd.Execute()
+		sct.Lock()
+		defer sct.Unlock()
+		if !sct.stopping {
+			sct.task.Warnf("[screencapture] Screen recording terminated unexpectedly: %v", r)
+		}
+	}()
+	sct.task.Infof("[screencapture] Recording desktop, keeping the most recent %v seconds", sct.task.Payload.ScreenCapture.RecordingSeconds)
+}
+
+func (sct *ScreenCaptureTask) Stop(err *ExecutionErrors) {
+	if sct.recorder != nil {
+		sct.Lock()
+		sct.stopping = true
+		sct.Unlock()
+		_, _ = sct.recorder.Kill()
+		select {
+		case <-sct.recorded:
+		case <-time.After(screenCaptureTimeout):
+			sct.task.Warnf("[screencapture] Timed out waiting for screen recording to terminate")
+		}
+	}
+	if err.Occurred() && sct.task.Payload.ScreenCapture.Screenshot {
+		sct.takeScreenshot()
+	}
+	sct.Lock()
+	// no more screenshots once the feature has stopped
+	sct.screenshotTaken = true
+	sct.Unlock()
+	if !err.Occurred() {
+		return
+	}
+	sct.uploadCapture(err, screenshotArtifactName, filepath.Join(screenCaptureDir, "screenshot.png"), "image/png")
+	segments, e := filepath.Glob(filepath.Join(taskContext.TaskDir, screenCaptureDir, "recording-*.ts"))
+	if e != nil || len(segments) == 0 {
+		return
+	}
+	// segment files are reused in a ring, so order them by time of writing
+	sort.Slice(segments, func(i, j int) bool {
+		return modTime(segments[i]).Before(modTime(segments[j]))
+	})
+	for i, segment := range segments {
+		sct.uploadCapture(err, recordingArtifactName(i), filepath.Join(screenCaptureDir, filepath.Base(segment)), "video/mp2t")
+	}
+}
+
+// uploadCapture uploads the capture file at the given path (relative to the
+// task directory), if it was written
+func (sct *ScreenCaptureTask) uploadCapture(err *ExecutionErrors, name, path, contentType string) {
+	if fi, e := os.Stat(filepath.Join(taskContext.TaskDir, path)); e != nil || fi.Size() == 0 {
+		return
+	}
+	err.add(sct.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    name,
+				Expires: sct.task.Definition.Expires,
+			},
+			ContentType: contentType,
+			// already compressed
+			ContentEncoding: "identity",
+			Path:            path,
+		},
+	))
+}
+
+func modTime(file string) time.Time {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
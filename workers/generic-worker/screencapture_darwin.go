@@ -0,0 +1,15 @@
+// +build multiuser
+
+package main
+
+func screenshotCommand(file string) []string {
+	return []string{"/usr/sbin/screencapture", "-x", file}
+}
+
+func recordingInput() []string {
+	return []string{"-f", "avfoundation", "-capture_cursor", "1", "-i", "Capture screen 0"}
+}
+
+func screenCaptureEnv(task *TaskRun) []string {
+	return task.EnvVars()
+}
@@ -0,0 +1,16 @@
+// +build multiuser
+
+package main
+
+func screenshotCommand(file string) []string {
+	// ImageMagick
+	return []string{"import", "-window", "root", file}
+}
+
+func recordingInput() []string {
+	return []string{"-f", "x11grab", "-i", ":0"}
+}
+
+func screenCaptureEnv(task *TaskRun) []string {
+	return task.EnvVars()
+}
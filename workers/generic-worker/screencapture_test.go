@@ -0,0 +1,35 @@
+// +build multiuser
+
+package main
+
+import (
+	"testing"
+)
+
+func TestScreenCaptureReservedArtifacts(t *testing.T) {
+	for recordingSeconds, expected := range map[int64][]string{
+		0: {
+			"public/screencapture/screenshot.png",
+		},
+		25: {
+			"public/screencapture/screenshot.png",
+			"public/screencapture/recording-0.ts",
+			"public/screencapture/recording-1.ts",
+			"public/screencapture/recording-2.ts",
+			"public/screencapture/recording-3.ts",
+		},
+	} {
+		task := &TaskRun{}
+		task.Payload.ScreenCapture.RecordingSeconds = recordingSeconds
+		sct := (&ScreenCaptureFeature{}).NewTaskFeature(task)
+		actual := sct.ReservedArtifacts()
+		if len(actual) != len(expected) {
+			t.Fatalf("Was expecting %v reserved artifacts for %v seconds of recording but got %v: %v", len(expected), recordingSeconds, len(actual), actual)
+		}
+		for i := range expected {
+			if actual[i] != expected[i] {
+				t.Errorf("Was expecting reserved artifact %v to be %v but got %v", i, expected[i], actual[i])
+			}
+		}
+	}
+}
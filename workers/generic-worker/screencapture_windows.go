@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+)
+
+func screenshotCommand(file string) []string {
+	script := strings.Join([]string{
+		`Add-Type -AssemblyName System.Windows.Forms,System.Drawing`,
+		`$screen = [System.Windows.Forms.SystemInformation]::VirtualScreen`,
+		`$bitmap = New-Object System.Drawing.Bitmap $screen.Width, $screen.Height`,
+		`$graphics = [System.Drawing.Graphics]::FromImage($bitmap)`,
+		`$graphics.CopyFromScreen($screen.Left, $screen.Top, 0, 0, $bitmap.Size)`,
+		`$bitmap.Save('` + strings.Replace(file, `'`, `''`, -1) + `', [System.Drawing.Imaging.ImageFormat]::Png)`,
+	}, "; ")
+	return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", script}
+}
+
+func recordingInput() []string {
+	return []string{"-f", "gdigrab", "-i", "desktop"}
+}
+
+func screenCaptureEnv(task *TaskRun) []string {
+	// use the default environment of the task user
+	return nil
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const (
+	// replaces secret values in the task log
+	redactedSecret = "[REDACTED]"
+	// lines of multi-line secret values shorter than this are not redacted
+	// individually, since they are unlikely to be sensitive (such as a lone
+	// brace of a JSON object) and would otherwise mangle the task log
+	minRedactedLineLength = 4
+	// size beyond which the task log is written even without a newline, so
+	// that redaction doesn't hold back output indefinitely
+	maxRedactionBuffer = 64 * 1024
+)
+
+// SecretsFeature fetches the secrets in task.payload.secrets from the secrets
+// service using the task credentials, and injects them into the task as
+// environment variables or files. Secret values are redacted from the task
+// log.
+type SecretsFeature struct {
+}
+
+func (feature *SecretsFeature) Name() string {
+	return "Secrets"
+}
+
+func (feature *SecretsFeature) PayloadName() string {
+	return "secrets"
+}
+
+func (feature *SecretsFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *SecretsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *SecretsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *SecretsFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Secrets) > 0
+}
+
+type SecretsTask struct {
+	task *TaskRun
+	// absolute paths of the secret files that have been written
+	files []string
+	// wraps the task log writer while the task runs
+	redactor *redactingWriter
+}
+
+func (feature *SecretsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &SecretsTask{
+		task: task,
+	}
+}
+
+// RequiredScopes returns the scopes to get each secret. The secrets service
+// enforces these anyway, since the secrets are fetched with the task
+// credentials, but checking them up front resolves the task as
+// malformed-payload rather than failing part way through.
+func (st *SecretsTask) RequiredScopes() scopes.Expression {
+	requiredScopes := scopes.AllOf{}
+	for _, secret := range st.task.Payload.Secrets {
+		requiredScopes = append(requiredScopes, scopes.Scope("secrets:get:"+secret.Name))
+	}
+	return requiredScopes
+}
+
+func (st *SecretsTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (st *SecretsTask) Start() *CommandExecutionError {
+	for _, secret := range st.task.Payload.Secrets {
+		if (secret.Env == "") == (secret.File == "") {
+			return MalformedPayloadError(fmt.Errorf("[secrets] Secret %v must have exactly one of env and file", secret.Name))
+		}
+		if secret.File != "" && !withinTaskDirectory(secret.File) {
+			return MalformedPayloadError(fmt.Errorf("[secrets] File %v of secret %v is outside of the task directory", secret.File, secret.Name))
+		}
+	}
+	secretsClient := st.task.Secrets()
+	redactions := []string{}
+	values := make([]string, len(st.task.Payload.Secrets))
+	for i, secret := range st.task.Payload.Secrets {
+		value, e := fetchSecret(secretsClient, secret.Name, secret.Key)
+		if e != nil {
+			return e
+		}
+		values[i] = value
+		st.task.audit(auditSecretFetched, map[string]interface{}{
+			"name": secret.Name,
+			"key":  secret.Key,
+		})
+		redactions = append(redactions, secretRedactions(value)...)
+	}
+	// redact the task log before anything can log the values
+	st.task.redactions = redactions
+	st.redactor = newRedactingWriter(st.task.logWriter, redactions)
+	st.updateTaskLogWriter(st.redactor)
+	for i, secret := range st.task.Payload.Secrets {
+		if secret.Env != "" {
+			err := st.task.setVariable(secret.Env, values[i])
+			if err != nil {
+				return executionError(internalError, errored, fmt.Errorf("[secrets] Could not set env var %v for secret %v: %v", secret.Env, secret.Name, err))
+			}
+			st.task.Infof("[secrets] Injected secret %v as env var %v", secret.Name, secret.Env)
+			continue
+		}
+		file, err := resolveTaskPath(secret.File)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[secrets] Could not write secret %v to file %v: %v", secret.Name, secret.File, err))
+		}
+		st.files = append(st.files, file)
+		err = os.MkdirAll(filepath.Dir(file), 0700)
+		if err == nil {
+			err = writeTaskFile(file, []byte(values[i]), 0600)
+		}
+		if err == nil {
+			err = makeFileReadWritableForTaskUser(st.task, file)
+		}
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[secrets] Could not write secret %v to file %v: %v", secret.Name, secret.File, err))
+		}
+		st.task.Infof("[secrets] Injected secret %v as file %v", secret.Name, secret.File)
+	}
+	return nil
+}
+
+// Stop deletes the secret files, and stops redacting the task log
+func (st *SecretsTask) Stop(err *ExecutionErrors) {
+	for _, file := range st.files {
+		if e := os.Remove(file); e != nil && !os.IsNotExist(e) {
+			st.task.Warnf("[secrets] Could not delete secret file %v: %v", file, e)
+		}
+	}
+	if st.redactor == nil {
+		return
+	}
+	if e := st.redactor.Flush(); e != nil {
+		st.task.Warnf("[secrets] Could not write task log: %v", e)
+	}
+	st.updateTaskLogWriter(st.redactor.w)
+}
+
+func (st *SecretsTask) updateTaskLogWriter(logWriter io.Writer) {
+	st.task.logMux.Lock()
+	defer st.task.logMux.Unlock()
+	st.task.logWriter = logWriter
+	setCommandLogWriters(st.task.Commands, logWriter)
+}
+
+// Secrets returns a secrets client with the task credentials
+func (task *TaskRun) Secrets() *tcsecrets.Secrets {
+	secrets := tcsecrets.New(task.Queue.Credentials, config.RootURL)
+	secrets.HTTPRetry = config.HTTPRetry
+	// if secretsRootURL is configured, this takes precedence over rootURL
+	if config.SecretsRootURL != "" {
+		secrets.RootURL = config.SecretsRootURL
+	}
+	return secrets
+}
+
+// fetchSecret returns the value of the secret with the given name, or of the
+// given property of it, if key is not empty. String values are returned as
+// is, other values as JSON.
+func fetchSecret(secretsClient *tcsecrets.Secrets, name, key string) (string, *CommandExecutionError) {
+	secret, err := secretsClient.Get(name)
+	if err != nil {
+		if apiCallException, isAPICallException := err.(*tcclient.APICallException); isAPICallException {
+			if badHTTPResponseCode, isBadHTTPResponseCode := apiCallException.RootCause.(httpbackoff.BadHttpResponseCode); isBadHTTPResponseCode && badHTTPResponseCode.HttpResponseCode == 404 {
+				return "", MalformedPayloadError(fmt.Errorf("[secrets] Secret %v does not exist", name))
+			}
+		}
+		return "", ResourceUnavailable(fmt.Errorf("[secrets] Could not get secret %v: %v", name, err))
+	}
+	value := secret.Secret
+	if key != "" {
+		var properties map[string]json.RawMessage
+		if json.Unmarshal(value, &properties) != nil || properties[key] == nil {
+			return "", MalformedPayloadError(fmt.Errorf("[secrets] Secret %v has no key %v", name, key))
+		}
+		value = properties[key]
+	}
+	var s string
+	if json.Unmarshal(value, &s) == nil {
+		return s, nil
+	}
+	return string(value), nil
+}
+
+// secretRedactions returns the strings to redact from the task log for the
+// given secret value: the value itself, and each line of it, since tasks often
+// log multi-line secrets (such as keys) line by line
+func secretRedactions(value string) []string {
+	if value == "" {
+		return nil
+	}
+	redactions := []string{value}
+	if !strings.Contains(value, "\n") {
+		return redactions
+	}
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); len(line) >= minRedactedLineLength {
+			redactions = append(redactions, line)
+		}
+	}
+	return redactions
+}
+
+// withinTaskDirectory returns whether the given path, relative to the task
+// directory, is inside the task directory
+func withinTaskDirectory(path string) bool {
+	if filepath.IsAbs(path) {
+		return false
+	}
+	clean := filepath.Clean(path)
+	return clean != "." && clean != ".." && !strings.HasPrefix(clean, ".."+string(filepath.Separator))
+}
+
+// resolveTaskPath returns the absolute path of the given file, relative to the
+// task directory, with symbolic links in its parent directories resolved. It
+// returns an error if the file would be outside of the task directory, for
+// example because a mounted archive or writable cache contains a symbolic
+// link to a directory elsewhere on the worker, so that the worker doesn't
+// write files outside of the task directory on behalf of the task.
+func resolveTaskPath(file string) (string, error) {
+	if !withinTaskDirectory(file) {
+		return "", fmt.Errorf("%v is not inside the task directory", file)
+	}
+	taskDir, err := filepath.EvalSymlinks(taskContext.TaskDir)
+	if err != nil {
+		return "", err
+	}
+	dir := taskDir
+	parts := strings.Split(filepath.Clean(file), string(filepath.Separator))
+	for i, part := range parts[:len(parts)-1] {
+		next := filepath.Join(dir, part)
+		info, err := os.Lstat(next)
+		if os.IsNotExist(err) {
+			// nothing below a missing directory can be a symbolic link
+			return filepath.Join(append([]string{dir}, parts[i:]...)...), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			next, err = filepath.EvalSymlinks(next)
+			if err != nil {
+				return "", err
+			}
+			if rel, err := filepath.Rel(taskDir, next); err != nil || !(rel == "." || withinTaskDirectory(rel)) {
+				return "", fmt.Errorf("%v is a symbolic link to %v, which is outside of the task directory", filepath.Join(parts[:i+1]...), next)
+			}
+		}
+		dir = next
+	}
+	return filepath.Join(dir, parts[len(parts)-1]), nil
+}
+
+// writeTaskFile writes a new file to the given path, as returned by
+// resolveTaskPath, replacing any existing file. A symbolic link at the path
+// is replaced rather than followed.
+func writeTaskFile(file string, content []byte, mode os.FileMode) (err error) {
+	err = os.RemoveAll(file)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = f.Write(content)
+	return
+}
+
+// redactingWriter replaces secret values in what is written to it before
+// writing it to the underlying writer. Output is held back until the end of
+// the line, so that secrets split across writes are still redacted.
+type redactingWriter struct {
+	sync.Mutex
+	w          io.Writer
+	redactions []string
+	pending    []byte
+}
+
+func newRedactingWriter(w io.Writer, redactions []string) *redactingWriter {
+	redactions = append([]string{}, redactions...)
+	// redact longer values first, so that values containing other values are
+	// redacted whole
+	sort.SliceStable(redactions, func(i, j int) bool {
+		return len(redactions[i]) > len(redactions[j])
+	})
+	return &redactingWriter{
+		w:          w,
+		redactions: redactions,
+	}
+}
+
+func (rw *redactingWriter) Write(p []byte) (int, error) {
+	rw.Lock()
+	defer rw.Unlock()
+	rw.pending = append(rw.pending, p...)
+	n := bytes.LastIndexByte(rw.pending, '\n') + 1
+	if len(rw.pending) > maxRedactionBuffer {
+		n = len(rw.pending)
+	}
+	if n == 0 {
+		return len(p), nil
+	}
+	err := rw.write(rw.pending[:n])
+	rw.pending = append([]byte{}, rw.pending[n:]...)
+	return len(p), err
+}
+
+// Flush writes output that has been held back waiting for the end of the line
+func (rw *redactingWriter) Flush() error {
+	rw.Lock()
+	defer rw.Unlock()
+	err := rw.write(rw.pending)
+	rw.pending = nil
+	return err
+}
+
+func (rw *redactingWriter) write(p []byte) error {
+	if len(p) == 0 {
+		return nil
+	}
+	for _, redaction := range rw.redactions {
+		p = bytes.Replace(p, []byte(redaction), []byte(redactedSecret), -1)
+	}
+	_, err := rw.w.Write(p)
+	return err
+}
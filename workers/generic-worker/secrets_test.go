@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcsecrets"
+)
+
+func TestRedactingWriter(t *testing.T) {
+	var buf bytes.Buffer
+	rw := newRedactingWriter(&buf, secretRedactions("-----BEGIN KEY-----\nc2VjcmV0\n-----END KEY-----"))
+	for _, s := range []string{"token c2Vj", "cmV0 used\n", "-----BEGIN KEY-----\nc2VjcmV0\n-----END KEY-----\n", "no newline"} {
+		_, err := rw.Write([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if buf.String() != "token [REDACTED] used\n[REDACTED]\n" {
+		t.Errorf("Unexpected redacted output %q", buf.String())
+	}
+	err := rw.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "token [REDACTED] used\n[REDACTED]\nno newline" {
+		t.Errorf("Unexpected redacted output %q after flush", buf.String())
+	}
+}
+
+func TestFetchSecret(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/secrets/v1/secret/project/test" {
+			w.WriteHeader(404)
+			return
+		}
+		fmt.Fprint(w, `{"expires": "2100-01-01T00:00:00.000Z", "secret": {"token": "abc123", "config": {"a": 1}}}`)
+	}))
+	defer s.Close()
+	secretsClient := tcsecrets.New(nil, s.URL)
+	for _, test := range []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{"project/test", "token", "abc123"},
+		{"project/test", "config", `{"a": 1}`},
+		{"project/test", "", `{"token": "abc123", "config": {"a": 1}}`},
+	} {
+		value, err := fetchSecret(secretsClient, test.name, test.key)
+		if err != nil {
+			t.Fatalf("Could not fetch secret %v key %q: %v", test.name, test.key, err)
+		}
+		if value != test.expected {
+			t.Errorf("Was expecting secret %v key %q to be %v but got %v", test.name, test.key, test.expected, value)
+		}
+	}
+	for _, test := range []struct {
+		name string
+		key  string
+	}{
+		{"project/missing", ""},
+		{"project/test", "missing"},
+	} {
+		_, err := fetchSecret(secretsClient, test.name, test.key)
+		if err == nil || err.Reason != malformedPayload {
+			t.Errorf("Was expecting malformed-payload for secret %v key %q but got %v", test.name, test.key, err)
+		}
+	}
+}
+
+func TestWithinTaskDirectory(t *testing.T) {
+	for path, within := range map[string]bool{
+		"secrets/token":   true,
+		"a/../token":      true,
+		"..token":         true,
+		"../token":        false,
+		"a/../../token":   false,
+		"/etc/passwd":     false,
+		".":               false,
+		"secrets/../../x": false,
+	} {
+		if withinTaskDirectory(path) != within {
+			t.Errorf("Was expecting withinTaskDirectory(%q) to be %v", path, within)
+		}
+	}
+}
+
+func TestResolveTaskPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Creating symbolic links requires a privilege on Windows")
+	}
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskDir := filepath.Join(dir, "task")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(taskDir, "real"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"inside":   filepath.Join(taskDir, "real"),
+		"outside":  outside,
+		"relative": "..",
+		"file":     filepath.Join(outside, "file"),
+	} {
+		if err := os.Symlink(target, filepath.Join(taskDir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: taskDir,
+	}
+	defer func() {
+		taskContext = oldTaskContext
+	}()
+	for file, expected := range map[string]string{
+		filepath.Join("inside", "secret"):          filepath.Join(taskDir, "real", "secret"),
+		filepath.Join("missing", "a", "secret"):    filepath.Join(taskDir, "missing", "a", "secret"),
+		filepath.Join("real", "..", "inside", "x"): filepath.Join(taskDir, "real", "x"),
+		// replaced rather than followed by writeTaskFile
+		"file":                                   filepath.Join(taskDir, "file"),
+		filepath.Join("outside", "secret"):       "",
+		filepath.Join("relative", "secret"):      "",
+		filepath.Join("inside", "..", "..", "x"): "",
+	} {
+		actual, err := resolveTaskPath(file)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("Was expecting %v to be rejected, but it resolved to %v", file, actual)
+			}
+			continue
+		}
+		if err != nil || actual != expected {
+			t.Errorf("Was expecting %v to resolve to %v but got %v (%v)", file, expected, actual, err)
+		}
+	}
+
+	// a symbolic link at the file itself is replaced, not followed
+	err = writeTaskFile(filepath.Join(taskDir, "file"), []byte("secret"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "file")); !os.IsNotExist(err) {
+		t.Fatalf("Was not expecting file to be written outside of task directory, but Lstat returned %v", err)
+	}
+	info, err := os.Lstat(filepath.Join(taskDir, "file"))
+	if err != nil || !info.Mode().IsRegular() {
+		t.Fatalf("Was expecting symbolic link to be replaced by regular file, but got %v (%v)", info, err)
+	}
+}
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/taskcluster/httpbackoff/v3"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const (
+	// file that self-update rollout state is persisted in, between worker runs
+	selfUpdateStateFile = "self-update.json"
+	// time allowed for config setting selfUpdateHealthCheck to run
+	selfUpdateHealthCheckTimeout = time.Minute
+)
+
+// SelfUpdateManifest is the document served at config.SelfUpdateManifestURL
+// which describes the release of generic-worker that workers should be
+// running.
+type SelfUpdateManifest struct {
+	Version string `json:"version"`
+	// Binaries are keyed by "<GOOS>/<GOARCH>/<engine>", e.g.
+	// "linux/amd64/multiuser"
+	Binaries map[string]*SelfUpdateBinary `json:"binaries"`
+	// If nil, all workers are updated
+	Rollout *SelfUpdateRollout `json:"rollout,omitempty"`
+}
+
+// SelfUpdateRollout restricts which workers update to the version in the
+// manifest, and when they should roll back to the version they were running
+// before.
+type SelfUpdateRollout struct {
+	// Percentage (0-100) of workers that should update. Workers are assigned
+	// to a bucket based on their workerGroup, workerId and the version being
+	// rolled out.
+	Percentage *uint `json:"percentage,omitempty"`
+	// Workers with any of these labels in config.SelfUpdateLabels update
+	// regardless of Percentage. If Labels are given but Percentage is not,
+	// only workers with a matching label update.
+	Labels []string `json:"labels,omitempty"`
+	// Roll back if the first RollbackAfterFailedTasks tasks run by the new
+	// version that don't succeed all fail because of the worker (see
+	// CircuitBreaker.infraFailure). Zero means never roll back for failed
+	// tasks.
+	RollbackAfterFailedTasks uint `json:"rollbackAfterFailedTasks,omitempty"`
+	// Roll back if the worker is started more than RollbackAfterStarts times
+	// on the new version without successfully completing a task. Zero means
+	// never roll back for failed starts.
+	RollbackAfterStarts uint `json:"rollbackAfterStarts,omitempty"`
+	// Roll back if config setting selfUpdateHealthCheck fails
+	// RollbackAfterFailedHealthChecks times while the new version is on
+	// probation. Zero means never roll back for failed health checks.
+	RollbackAfterFailedHealthChecks uint `json:"rollbackAfterFailedHealthChecks,omitempty"`
+}
+
+// SelfUpdateState is persisted between worker runs in selfUpdateStateFile, in
+// order to track whether the version that the worker last updated to is
+// healthy.
+type SelfUpdateState struct {
+	// Non-nil until the version the worker updated to has successfully
+	// completed a task
+	Probation *SelfUpdateProbation `json:"probation,omitempty"`
+	// Versions that have been rolled back, that this worker will not update
+	// to again
+	RejectedVersions []string `json:"rejectedVersions,omitempty"`
+}
+
+type SelfUpdateProbation struct {
+	Version                         string `json:"version"`
+	PreviousVersion                 string `json:"previousVersion"`
+	RollbackAfterFailedTasks        uint   `json:"rollbackAfterFailedTasks"`
+	RollbackAfterStarts             uint   `json:"rollbackAfterStarts"`
+	RollbackAfterFailedHealthChecks uint   `json:"rollbackAfterFailedHealthChecks"`
+	FailedTasks                     uint   `json:"failedTasks"`
+	Starts                          uint   `json:"starts"`
+	FailedHealthChecks              uint   `json:"failedHealthChecks"`
+}
+
+type SelfUpdateBinary struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	// Base64 encoded ed25519 signature of the version and SHA256 of the
+	// binary (see selfUpdateSignedMessage), which must verify against
+	// config.SelfUpdateEd25519PublicKey
+	Signature string `json:"signature"`
+}
+
+// selfUpdateSignedMessage returns the message that the signature of a binary
+// in the self-update manifest signs. It includes the version, so that a
+// tampered manifest can't pass off an older signed binary as a different
+// version (and can't roll workers back to a version that has been rolled
+// back on them).
+func selfUpdateSignedMessage(version, sha256 string) []byte {
+	return []byte(version + "\n" + sha256)
+}
+
+func selfUpdateBinaryKey() string {
+	return runtime.GOOS + "/" + runtime.GOARCH + "/" + engine
+}
+
+func fetchSelfUpdateManifest(url string) (*SelfUpdateManifest, error) {
+	resp, _, err := httpbackoff.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	manifest := new(SelfUpdateManifest)
+	err = json.NewDecoder(resp.Body).Decode(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("Could not interpret self-update manifest from %v as JSON: %v", url, err)
+	}
+	return manifest, nil
+}
+
+// selfUpdate checks the self-update manifest, and if a different version of
+// generic-worker is published there, replaces the running generic-worker
+// binary with it. It returns true if the binary was replaced, in which case
+// the worker should exit so that it can be restarted. This should only be
+// called between tasks.
+func selfUpdate() bool {
+	manifest, err := fetchSelfUpdateManifest(config.SelfUpdateManifestURL)
+	if err != nil {
+		log.Printf("WARNING: could not fetch self-update manifest: %v", err)
+		return false
+	}
+	if manifest.Version == version {
+		log.Printf("No self-update required - already running version %v", version)
+		return false
+	}
+	state := loadSelfUpdateState()
+	if state.rejected(manifest.Version) {
+		log.Printf("Not updating to version %v since it was previously rolled back on this worker", manifest.Version)
+		return false
+	}
+	if !inSelfUpdateRollout(manifest.Rollout, manifest.Version) {
+		log.Printf("Not updating to version %v since this worker is not included in its rollout", manifest.Version)
+		return false
+	}
+	key := selfUpdateBinaryKey()
+	binary := manifest.Binaries[key]
+	if binary == nil {
+		log.Printf("WARNING: self-update manifest for version %v does not include a binary for %v - not updating", manifest.Version, key)
+		return false
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("WARNING: could not determine location of generic-worker binary - not updating: %v", err)
+		return false
+	}
+	log.Printf("Updating generic-worker from version %v to version %v...", version, manifest.Version)
+	err = installSelfUpdate(manifest.Version, binary, exe)
+	if err != nil {
+		log.Printf("WARNING: could not update generic-worker to version %v: %v", manifest.Version, err)
+		return false
+	}
+	log.Printf("Replaced %v with generic-worker version %v", exe, manifest.Version)
+	state.Probation = nil
+	if r := manifest.Rollout; r != nil && (r.RollbackAfterFailedTasks > 0 || r.RollbackAfterStarts > 0 || r.RollbackAfterFailedHealthChecks > 0) {
+		state.Probation = &SelfUpdateProbation{
+			Version:                         manifest.Version,
+			PreviousVersion:                 version,
+			RollbackAfterFailedTasks:        r.RollbackAfterFailedTasks,
+			RollbackAfterStarts:             r.RollbackAfterStarts,
+			RollbackAfterFailedHealthChecks: r.RollbackAfterFailedHealthChecks,
+		}
+	}
+	state.save()
+	return true
+}
+
+// selfUpdateStarted should be called when the worker starts. If the running
+// version is on probation after a self-update, and has now been started too
+// many times without completing a task, or has failed too many health checks,
+// the previous binary is restored and true is returned, in which case the
+// worker should exit so that it can be restarted.
+func selfUpdateStarted() bool {
+	state := loadSelfUpdateState()
+	p := state.Probation
+	if p == nil {
+		return false
+	}
+	if p.Version != version {
+		// binary has been replaced by something other than self-update
+		log.Printf("Abandoning self-update probation of version %v since running version %v", p.Version, version)
+		state.Probation = nil
+		state.save()
+		return false
+	}
+	rollback := p.started()
+	if rollback {
+		log.Printf("Version %v has been started %v times without completing a task", p.Version, p.Starts)
+	} else {
+		rollback = p.healthChecked(runSelfUpdateHealthCheck())
+	}
+	if rollback {
+		rollback = state.rollback()
+	}
+	state.save()
+	return rollback
+}
+
+// selfUpdateTaskResolved should be called after every task the worker runs,
+// with whether the task succeeded, and whether it failed because of the
+// worker. If the running version is on probation after a self-update, and
+// has now failed its first tasks, or too many health checks, the previous
+// binary is restored and true is returned, in which case the worker should
+// exit so that it can be restarted.
+func selfUpdateTaskResolved(success, workerFailure bool) bool {
+	state := loadSelfUpdateState()
+	if state.Probation == nil {
+		return false
+	}
+	rollback := state.taskResolved(success, workerFailure)
+	if !rollback && state.Probation != nil {
+		rollback = state.Probation.healthChecked(runSelfUpdateHealthCheck())
+	}
+	if rollback {
+		rollback = state.rollback()
+	}
+	state.save()
+	return rollback
+}
+
+func inSelfUpdateRollout(rollout *SelfUpdateRollout, newVersion string) bool {
+	if rollout == nil {
+		return true
+	}
+	for _, label := range config.SelfUpdateLabels {
+		for _, l := range rollout.Labels {
+			if label == l {
+				return true
+			}
+		}
+	}
+	if rollout.Percentage == nil {
+		return len(rollout.Labels) == 0
+	}
+	return selfUpdateRolloutBucket(newVersion) < *rollout.Percentage
+}
+
+// selfUpdateRolloutBucket returns a number in the range 0-99 for this worker.
+// The version is included so that the same workers are not always the first
+// to receive new releases.
+func selfUpdateRolloutBucket(newVersion string) uint {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(config.WorkerGroup + "/" + config.WorkerID + "/" + newVersion))
+	return uint(h.Sum32() % 100)
+}
+
+func loadSelfUpdateState() *SelfUpdateState {
+	state := new(SelfUpdateState)
+	b, err := ioutil.ReadFile(selfUpdateStateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("WARNING: could not read %v: %v", selfUpdateStateFile, err)
+		}
+		return state
+	}
+	err = json.Unmarshal(b, state)
+	if err != nil {
+		log.Printf("WARNING: could not interpret %v as JSON: %v", selfUpdateStateFile, err)
+		return new(SelfUpdateState)
+	}
+	return state
+}
+
+func (s *SelfUpdateState) save() {
+	err := fileutil.WriteToFileAsJSON(s, selfUpdateStateFile)
+	if err == nil {
+		err = fileutil.SecureFiles(selfUpdateStateFile)
+	}
+	if err != nil {
+		log.Printf("WARNING: could not save self-update state to %v: %v", selfUpdateStateFile, err)
+	}
+}
+
+func (s *SelfUpdateState) rejected(newVersion string) bool {
+	for _, v := range s.RejectedVersions {
+		if v == newVersion {
+			return true
+		}
+	}
+	return false
+}
+
+// started records a start of the version on probation, and returns true if
+// it should be rolled back
+func (p *SelfUpdateProbation) started() bool {
+	p.Starts++
+	return p.RollbackAfterStarts > 0 && p.Starts > p.RollbackAfterStarts
+}
+
+// taskResolved records the outcome of a task run by the version on probation,
+// and returns true if it should be rolled back. A successful task ends the
+// probation. Only failures caused by the worker count towards a rollback,
+// since tasks may fail whichever version of the worker runs them.
+func (s *SelfUpdateState) taskResolved(success, workerFailure bool) bool {
+	p := s.Probation
+	if success {
+		log.Printf("Version %v has successfully completed a task - self-update confirmed", p.Version)
+		s.Probation = nil
+		return false
+	}
+	if !workerFailure {
+		return false
+	}
+	p.FailedTasks++
+	if p.RollbackAfterFailedTasks > 0 && p.FailedTasks >= p.RollbackAfterFailedTasks {
+		log.Printf("Version %v has failed its first %v tasks", p.Version, p.FailedTasks)
+		return true
+	}
+	return false
+}
+
+// healthChecked records the result of a health check of the version on
+// probation, and returns true if it should be rolled back
+func (p *SelfUpdateProbation) healthChecked(err error) bool {
+	if err == nil {
+		return false
+	}
+	p.FailedHealthChecks++
+	log.Printf("WARNING: health check %v of version %v failed: %v", p.FailedHealthChecks, p.Version, err)
+	if p.RollbackAfterFailedHealthChecks > 0 && p.FailedHealthChecks >= p.RollbackAfterFailedHealthChecks {
+		log.Printf("Version %v has failed %v health checks", p.Version, p.FailedHealthChecks)
+		return true
+	}
+	return false
+}
+
+// runSelfUpdateHealthCheck runs config setting selfUpdateHealthCheck, if set,
+// returning an error if it fails, or takes longer than
+// selfUpdateHealthCheckTimeout
+func runSelfUpdateHealthCheck() error {
+	command := config.SelfUpdateHealthCheck
+	if len(command) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), selfUpdateHealthCheckTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%q: %v (output: %q)", command, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// rollback restores the binary that was running before the version on
+// probation was installed, and records that the version on probation should
+// not be updated to again. It returns true if the binary was restored.
+func (s *SelfUpdateState) rollback() bool {
+	p := s.Probation
+	s.Probation = nil
+	s.RejectedVersions = append(s.RejectedVersions, p.Version)
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("WARNING: could not determine location of generic-worker binary - not rolling back: %v", err)
+		return false
+	}
+	log.Printf("Rolling back generic-worker from version %v to version %v...", p.Version, p.PreviousVersion)
+	err = rollbackSelfUpdate(exe)
+	if err != nil {
+		log.Printf("WARNING: could not roll back generic-worker to version %v: %v", p.PreviousVersion, err)
+		return false
+	}
+	log.Printf("Restored generic-worker version %v to %v", p.PreviousVersion, exe)
+	return true
+}
+
+// installSelfUpdate downloads the given binary of the given version, verifies
+// its SHA256 and signature, and then replaces exe with it. The previous binary is kept
+// alongside, with file extension ".old" appended. The running binary is
+// renamed rather than overwritten, since on Windows a running executable
+// cannot be modified.
+func installSelfUpdate(version string, binary *SelfUpdateBinary, exe string) error {
+	newExe := exe + ".new"
+	oldExe := exe + ".old"
+	err := downloadSelfUpdate(binary.URL, newExe)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(newExe)
+	err = verifySelfUpdate(version, binary, newExe)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(newExe, 0755)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(oldExe)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(exe, oldExe)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(newExe, exe)
+	if err != nil {
+		// put the original binary back in place
+		if restoreErr := os.Rename(oldExe, exe); restoreErr != nil {
+			panic(fmt.Errorf("Could not restore %v from %v after failed self-update: %v", exe, oldExe, restoreErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// rollbackSelfUpdate restores the binary that installSelfUpdate replaced. The
+// rolled back binary is kept alongside, with file extension ".failed"
+// appended.
+func rollbackSelfUpdate(exe string) error {
+	oldExe := exe + ".old"
+	failedExe := exe + ".failed"
+	_, err := os.Stat(oldExe)
+	if err != nil {
+		return fmt.Errorf("Could not find previous binary %v: %v", oldExe, err)
+	}
+	err = os.RemoveAll(failedExe)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(exe, failedExe)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(oldExe, exe)
+	if err != nil {
+		// put the updated binary back in place
+		if restoreErr := os.Rename(failedExe, exe); restoreErr != nil {
+			panic(fmt.Errorf("Could not restore %v from %v after failed rollback: %v", exe, failedExe, restoreErr))
+		}
+		return err
+	}
+	return nil
+}
+
+func downloadSelfUpdate(url, file string) error {
+	resp, _, err := httpbackoff.Get(url)
+	if err != nil {
+		return fmt.Errorf("Could not download %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+	f, err := os.OpenFile(file, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, resp.Body)
+	if err != nil {
+		return fmt.Errorf("Could not write %v to file %v: %v", url, file, err)
+	}
+	return nil
+}
+
+func verifySelfUpdate(version string, binary *SelfUpdateBinary, file string) error {
+	sha256, err := fileutil.CalculateSHA256(file)
+	if err != nil {
+		return err
+	}
+	if sha256 != binary.SHA256 {
+		return fmt.Errorf("Downloaded binary %v has SHA256 %v but manifest requires %v", binary.URL, sha256, binary.SHA256)
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(config.SelfUpdateEd25519PublicKey)
+	if err != nil || len(publicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("Config setting selfUpdateEd25519PublicKey is not a base64 encoded ed25519 public key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(binary.Signature)
+	if err != nil {
+		return fmt.Errorf("Signature of binary %v in self-update manifest is not base64 encoded: %v", binary.URL, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey), selfUpdateSignedMessage(version, sha256), signature) {
+		return fmt.Errorf("Signature of downloaded binary %v for version %v is not valid", binary.URL, version)
+	}
+	return nil
+}
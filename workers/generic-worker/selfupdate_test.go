@@ -0,0 +1,258 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// version of the binary served by selfUpdateTestSetup
+const selfUpdateTestVersion = "99.0.0"
+
+// selfUpdateTestSetup serves newBinary over http, and returns a fake
+// "current" binary to be updated, together with a SelfUpdateBinary for
+// newBinary as version selfUpdateTestVersion, signed with a freshly generated
+// key (the public key of which is set in the config).
+func selfUpdateTestSetup(t *testing.T, newBinary []byte) (exe string, binary *SelfUpdateBinary, teardown func()) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate ed25519 key pair: %v", err)
+	}
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			SelfUpdateEd25519PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(newBinary)
+	}))
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("Could not create temp directory: %v", err)
+	}
+	exe = filepath.Join(dir, "generic-worker")
+	err = ioutil.WriteFile(exe, []byte("current binary"), 0755)
+	if err != nil {
+		t.Fatalf("Could not write %v: %v", exe, err)
+	}
+	hash := sha256.Sum256(newBinary)
+	binary = &SelfUpdateBinary{
+		URL:       server.URL + "/generic-worker",
+		SHA256:    hex.EncodeToString(hash[:]),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, selfUpdateSignedMessage(selfUpdateTestVersion, hex.EncodeToString(hash[:])))),
+	}
+	return exe, binary, func() {
+		server.Close()
+		_ = os.RemoveAll(dir)
+		config = nil
+	}
+}
+
+func TestInstallSelfUpdate(t *testing.T) {
+	exe, binary, teardown := selfUpdateTestSetup(t, []byte("new binary"))
+	defer teardown()
+
+	err := installSelfUpdate(selfUpdateTestVersion, binary, exe)
+	if err != nil {
+		t.Fatalf("Could not install self-update: %v", err)
+	}
+	for file, expected := range map[string]string{
+		exe:          "new binary",
+		exe + ".old": "current binary",
+	} {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Could not read %v: %v", file, err)
+		}
+		if string(content) != expected {
+			t.Fatalf("Was expecting %v to contain %q but it contains %q", file, expected, string(content))
+		}
+	}
+}
+
+func TestSelfUpdateInvalidSignature(t *testing.T) {
+	exe, binary, teardown := selfUpdateTestSetup(t, []byte("new binary"))
+	defer teardown()
+
+	// sign different content
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate ed25519 key pair: %v", err)
+	}
+	binary.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(otherKey, selfUpdateSignedMessage(selfUpdateTestVersion, binary.SHA256)))
+
+	err = installSelfUpdate(selfUpdateTestVersion, binary, exe)
+	if err == nil || !strings.Contains(err.Error(), "is not valid") {
+		t.Fatalf("Was expecting an invalid signature error, but got: %v", err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatalf("Could not read %v: %v", exe, err)
+	}
+	if string(content) != "current binary" {
+		t.Fatalf("Binary should not have been replaced, but now contains %q", string(content))
+	}
+}
+
+// A signed binary can't be installed as a different version than the one it
+// was signed for
+func TestSelfUpdateSignatureCoversVersion(t *testing.T) {
+	exe, binary, teardown := selfUpdateTestSetup(t, []byte("new binary"))
+	defer teardown()
+
+	err := installSelfUpdate("98.0.0", binary, exe)
+	if err == nil || !strings.Contains(err.Error(), "is not valid") {
+		t.Fatalf("Was expecting an invalid signature error, but got: %v", err)
+	}
+	content, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatalf("Could not read %v: %v", exe, err)
+	}
+	if string(content) != "current binary" {
+		t.Fatalf("Binary should not have been replaced, but now contains %q", string(content))
+	}
+}
+
+func TestSelfUpdateInvalidSHA256(t *testing.T) {
+	exe, binary, teardown := selfUpdateTestSetup(t, []byte("new binary"))
+	defer teardown()
+
+	binary.SHA256 = strings.Repeat("0", 64)
+
+	err := installSelfUpdate(selfUpdateTestVersion, binary, exe)
+	if err == nil || !strings.Contains(err.Error(), "but manifest requires") {
+		t.Fatalf("Was expecting a SHA256 mismatch error, but got: %v", err)
+	}
+}
+
+func TestSelfUpdateRollout(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			SelfUpdateLabels: []string{"canary"},
+			WorkerGroup:      "test-worker-group",
+			WorkerID:         "test-worker-id",
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	zero := uint(0)
+	hundred := uint(100)
+	for _, test := range []struct {
+		name     string
+		rollout  *SelfUpdateRollout
+		expected bool
+	}{
+		{"no rollout", nil, true},
+		{"matching label", &SelfUpdateRollout{Labels: []string{"canary"}, Percentage: &zero}, true},
+		{"non-matching label", &SelfUpdateRollout{Labels: []string{"beta"}}, false},
+		{"zero percent", &SelfUpdateRollout{Percentage: &zero}, false},
+		{"hundred percent", &SelfUpdateRollout{Labels: []string{"beta"}, Percentage: &hundred}, true},
+	} {
+		if actual := inSelfUpdateRollout(test.rollout, "1.2.3"); actual != test.expected {
+			t.Errorf("%v: was expecting inSelfUpdateRollout to return %v but got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestSelfUpdateProbation(t *testing.T) {
+	state := &SelfUpdateState{
+		Probation: &SelfUpdateProbation{
+			Version:                  "1.2.3",
+			RollbackAfterFailedTasks: 2,
+			RollbackAfterStarts:      1,
+		},
+	}
+	if state.Probation.started() {
+		t.Fatal("Should not roll back on first start")
+	}
+	if state.taskResolved(false, true) {
+		t.Fatal("Should not roll back after one failed task")
+	}
+	if state.taskResolved(false, false) || state.taskResolved(false, false) {
+		t.Fatal("Should not roll back after tasks that failed without the worker being at fault")
+	}
+	if !state.taskResolved(false, true) {
+		t.Fatal("Should roll back after two failed tasks")
+	}
+	if !state.Probation.started() {
+		t.Fatal("Should roll back on second start")
+	}
+	if state.taskResolved(true, false) {
+		t.Fatal("Should not roll back after a successful task")
+	}
+	if state.Probation != nil {
+		t.Fatal("Probation should end after a successful task")
+	}
+}
+
+func TestSelfUpdateHealthCheck(t *testing.T) {
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			SelfUpdateHealthCheck: []string{"go", "version"},
+		},
+	}
+	defer func() {
+		config = nil
+	}()
+	p := &SelfUpdateProbation{
+		Version:                         "1.2.3",
+		RollbackAfterFailedHealthChecks: 2,
+	}
+	if p.healthChecked(runSelfUpdateHealthCheck()) || p.FailedHealthChecks != 0 {
+		t.Fatalf("Passing health check should not count as a failure, but %v failures recorded", p.FailedHealthChecks)
+	}
+	config.SelfUpdateHealthCheck = []string{"go", "no-such-command"}
+	err := runSelfUpdateHealthCheck()
+	if err == nil {
+		t.Fatal("Was expecting health check to fail")
+	}
+	if p.healthChecked(err) {
+		t.Fatal("Should not roll back after one failed health check")
+	}
+	if !p.healthChecked(err) {
+		t.Fatal("Should roll back after two failed health checks")
+	}
+}
+
+func TestRollbackSelfUpdate(t *testing.T) {
+	exe, binary, teardown := selfUpdateTestSetup(t, []byte("new binary"))
+	defer teardown()
+
+	err := installSelfUpdate(selfUpdateTestVersion, binary, exe)
+	if err != nil {
+		t.Fatalf("Could not install self-update: %v", err)
+	}
+	err = rollbackSelfUpdate(exe)
+	if err != nil {
+		t.Fatalf("Could not roll back self-update: %v", err)
+	}
+	for file, expected := range map[string]string{
+		exe:             "current binary",
+		exe + ".failed": "new binary",
+	} {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Could not read %v: %v", file, err)
+		}
+		if string(content) != expected {
+			t.Fatalf("Was expecting %v to contain %q but it contains %q", file, expected, string(content))
+		}
+	}
+	err = rollbackSelfUpdate(exe)
+	if err == nil {
+		t.Fatal("Was expecting rollback to fail when there is no previous binary")
+	}
+}
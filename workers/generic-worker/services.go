@@ -0,0 +1,332 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+const (
+	defaultServiceHealthCheckTimeoutSeconds = 60
+	// how long to wait for a service to exit after it has been killed
+	serviceStopTimeout = 30 * time.Second
+)
+
+// directory, relative to task directory, that service logs are written to
+var servicesDir = filepath.Join("generic-worker", "services")
+
+// ServicesFeature runs the auxiliary services listed in task.payload.services
+// alongside the task commands
+type ServicesFeature struct {
+}
+
+func (feature *ServicesFeature) Name() string {
+	return "Services"
+}
+
+func (feature *ServicesFeature) PayloadName() string {
+	return "services"
+}
+
+func (feature *ServicesFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
+func (feature *ServicesFeature) Initialise() error {
+	return nil
+}
+
+func (feature *ServicesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ServicesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.Services) > 0
+}
+
+type ServicesTask struct {
+	task     *TaskRun
+	services []*runningService
+}
+
+// runningService is a service process or container that has been started
+type runningService struct {
+	Service
+	// the process of a process service, or the docker client of a container
+	// service
+	command *process.Command
+	// name of the docker container of a container service
+	container string
+	// closed once the service has exited and its log file is closed
+	exited chan struct{}
+	// only to be read once exited is closed
+	result *process.Result
+}
+
+func (feature *ServicesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ServicesTask{
+		task: task,
+	}
+}
+
+func (st *ServicesTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (st *ServicesTask) ReservedArtifacts() []string {
+	artifacts := []string{}
+	for _, service := range st.task.Payload.Services {
+		artifacts = append(artifacts, serviceLogArtifactName(service.Name))
+	}
+	return artifacts
+}
+
+// Start starts the services in order, waiting for each to pass its health
+// check (if it has one) before starting the next, so that services can
+// depend on earlier ones
+func (st *ServicesTask) Start() *CommandExecutionError {
+	err := validateServices(st.task.Payload.Services, st.task.Payload.PortLeases)
+	if err != nil {
+		return MalformedPayloadError(err)
+	}
+	err = os.MkdirAll(filepath.Join(taskContext.TaskDir, servicesDir), 0700)
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[services] Could not create directory for service logs: %v", err))
+	}
+	for _, service := range st.task.Payload.Services {
+		rs, err := st.startService(service)
+		if err != nil {
+			return executionError(internalError, errored, fmt.Errorf("[services] Could not start service %v: %v", service.Name, err))
+		}
+		st.services = append(st.services, rs)
+		if service.HealthCheck.TCPPort == 0 && service.HealthCheck.HTTPURL == "" {
+			st.task.Infof("[services] Started service %v", service.Name)
+			continue
+		}
+		started := time.Now()
+		err = rs.waitUntilHealthy()
+		if err != nil {
+			return Failure(fmt.Errorf("[services] Service %v did not become healthy: %v", service.Name, err))
+		}
+		st.task.Infof("[services] Service %v is healthy after %v", service.Name, time.Since(started))
+	}
+	return nil
+}
+
+// Stop kills the services in reverse order, and publishes their logs
+func (st *ServicesTask) Stop(err *ExecutionErrors) {
+	for i := len(st.services) - 1; i >= 0; i-- {
+		rs := st.services[i]
+		select {
+		case <-rs.exited:
+			st.task.Warnf("[services] Service %v exited before the task completed: %v", rs.Name, rs.result)
+		default:
+			rs.kill(st.task)
+			select {
+			case <-rs.exited:
+			case <-time.After(serviceStopTimeout):
+				st.task.Warnf("[services] Service %v did not exit within %v of being killed", rs.Name, serviceStopTimeout)
+				continue
+			}
+		}
+		err.add(st.task.uploadArtifact(
+			&S3Artifact{
+				BaseArtifact: &BaseArtifact{
+					Name:    serviceLogArtifactName(rs.Name),
+					Expires: st.task.Definition.Expires,
+				},
+				ContentType:     "text/plain; charset=utf-8",
+				ContentEncoding: "gzip",
+				Path:            serviceLogPath(rs.Name),
+			},
+		))
+	}
+}
+
+func (st *ServicesTask) startService(service Service) (*runningService, error) {
+	rs := &runningService{
+		Service: service,
+		exited:  make(chan struct{}),
+	}
+	var commandLine, env []string
+	if service.Image == "" {
+		commandLine = service.Command
+		env = append(append(st.task.EnvVars(), leasedPortEnv(st.task.leasedPorts)...), envList(service.Env)...)
+	} else {
+		docker, err := exec.LookPath("docker")
+		if err != nil {
+			return nil, fmt.Errorf("docker is not installed on the worker: %v", err)
+		}
+		rs.container = "taskcluster-" + st.task.TaskID + "-" + service.Name
+		commandLine = dockerRunCommand(docker, rs.container, service, st.task.leasedPorts, st.task.Payload.HostAliases)
+		env = os.Environ()
+	}
+	log, err := os.Create(filepath.Join(taskContext.TaskDir, serviceLogPath(service.Name)))
+	if err != nil {
+		return nil, err
+	}
+	if service.Image == "" {
+		rs.command, err = newServiceCommand(commandLine, env)
+	} else {
+		// the docker client runs as the worker, since the task user
+		// typically isn't allowed to use docker
+		rs.command, err = newWorkerCommand(commandLine, env)
+	}
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+	rs.command.DirectOutput(log)
+	started := make(chan struct{})
+	go func() {
+		defer close(rs.exited)
+		defer log.Close()
+		close(started)
+		rs.result = rs.command.Execute()
+	}()
+	<-started
+	return rs, nil
+}
+
+// waitUntilHealthy polls the health check of the service until it passes, the
+// service exits, or the health check times out
+func (rs *runningService) waitUntilHealthy() error {
+	timeout := time.Duration(rs.HealthCheck.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = defaultServiceHealthCheckTimeoutSeconds * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-rs.exited:
+			return fmt.Errorf("service exited: %v", rs.result)
+		default:
+		}
+		err := rs.checkHealth()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("health check did not pass within %v: %v", timeout, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (rs *runningService) checkHealth() error {
+	if rs.HealthCheck.TCPPort != 0 {
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(int(rs.HealthCheck.TCPPort))), 5*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(rs.HealthCheck.HTTPURL)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GET %v returned status code %v", rs.HealthCheck.HTTPURL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (rs *runningService) kill(task *TaskRun) {
+	if rs.container != "" {
+		// the container outlives the docker client if just the client is
+		// killed
+		if out, err := exec.Command("docker", "rm", "--force", rs.container).CombinedOutput(); err != nil {
+			task.Warnf("[services] Could not remove container %v of service %v: %v\n%s", rs.container, rs.Name, err, out)
+		}
+	}
+	if out, err := rs.command.Kill(); err != nil {
+		task.Warnf("[services] Could not kill service %v: %v\n%v", rs.Name, err, out)
+	}
+}
+
+func validateServices(services []Service, portLeases []PortLease) error {
+	leases := map[string]bool{}
+	for _, pl := range portLeases {
+		leases[pl.Name] = true
+	}
+	names := map[string]bool{}
+	for _, service := range services {
+		if names[service.Name] {
+			return fmt.Errorf("Service name %q appears more than once in task.payload.services", service.Name)
+		}
+		names[service.Name] = true
+		if service.Image == "" && len(service.Command) == 0 {
+			return fmt.Errorf("Service %v must specify command or image", service.Name)
+		}
+		if service.Image == "" && (len(service.Ports) > 0 || len(service.LeasedPorts) > 0) {
+			return fmt.Errorf("Service %v can only publish ports if it is a container service", service.Name)
+		}
+		for _, name := range service.LeasedPorts {
+			if !leases[name] {
+				return fmt.Errorf("Service %v publishes leased port %v, which isn't in task.payload.portLeases", service.Name, name)
+			}
+		}
+		if service.HealthCheck.TCPPort != 0 && service.HealthCheck.HTTPURL != "" {
+			return fmt.Errorf("Health check of service %v may specify only one of tcpPort and httpUrl", service.Name)
+		}
+	}
+	return nil
+}
+
+// dockerRunCommand returns the command line that runs the container of a
+// container service in the foreground, so that its output is written to the
+// service log. The ports leased to the task are passed to the container in
+// environment variables, and the host aliases of the task are added to its
+// hosts file, as they are for task commands.
+func dockerRunCommand(docker, container string, service Service, leasedPorts []*portLease, hostAliases []HostAlias) []string {
+	args := []string{docker, "run", "--rm", "--name", container}
+	for _, port := range service.Ports {
+		args = append(args, "--publish", fmt.Sprintf("127.0.0.1:%v:%v", port, port))
+	}
+	for _, name := range service.LeasedPorts {
+		for _, lease := range leasedPorts {
+			if lease.Name == name {
+				args = append(args, "--publish", fmt.Sprintf("127.0.0.1:%v:%v/%v", lease.Port, lease.Port, lease.protocol()))
+			}
+		}
+	}
+	for _, alias := range hostAliases {
+		args = append(args, "--add-host", alias.Hostname+":"+alias.IP)
+	}
+	for _, e := range append(leasedPortEnv(leasedPorts), envList(service.Env)...) {
+		args = append(args, "--env", e)
+	}
+	args = append(args, service.Image)
+	return append(args, service.Command...)
+}
+
+// envList converts env to a list of NAME=VALUE strings, sorted by name
+func envList(env map[string]string) []string {
+	list := []string{}
+	for name, value := range env {
+		list = append(list, name+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func serviceLogPath(name string) string {
+	return filepath.Join(servicesDir, name+".log")
+}
+
+func serviceLogArtifactName(name string) string {
+	return "public/logs/services/" + name + ".log"
+}
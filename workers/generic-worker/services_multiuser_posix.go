@@ -0,0 +1,19 @@
+// +build multiuser,darwin multiuser,linux
+
+package main
+
+import (
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// newServiceCommand returns a command that runs a process service as the task
+// user, in the task directory
+func newServiceCommand(commandLine []string, env []string) (*process.Command, error) {
+	return process.NewCommand(commandLine, taskContext.TaskDir, env, taskContext.pd)
+}
+
+// newWorkerCommand returns a command that runs as the worker user, in the task
+// directory
+func newWorkerCommand(commandLine []string, env []string) (*process.Command, error) {
+	return process.NewCommand(commandLine, taskContext.TaskDir, env, &process.PlatformData{})
+}
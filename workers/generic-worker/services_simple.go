@@ -0,0 +1,19 @@
+// +build simple
+
+package main
+
+import (
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// newServiceCommand returns a command that runs a process service in the task
+// directory
+func newServiceCommand(commandLine []string, env []string) (*process.Command, error) {
+	return process.NewCommand(commandLine, taskContext.TaskDir, env)
+}
+
+// newWorkerCommand returns a command that runs in the task directory. With the
+// simple engine, this is the same as a process service command.
+func newWorkerCommand(commandLine []string, env []string) (*process.Command, error) {
+	return newServiceCommand(commandLine, env)
+}
@@ -0,0 +1,54 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateServices(t *testing.T) {
+	for _, services := range [][]Service{
+		{{Name: "db", Image: "postgres"}, {Name: "db", Command: []string{"true"}}},
+		{{Name: "db"}},
+		{{Name: "db", Command: []string{"true"}, Ports: []int64{5432}}},
+		{{Name: "db", Image: "postgres", HealthCheck: HealthCheck{TCPPort: 5432, HTTPURL: "http://localhost:5432"}}},
+		{{Name: "db", Image: "postgres", LeasedPorts: []string{"DB_PORT"}}},
+	} {
+		if err := validateServices(services, nil); err == nil {
+			t.Fatalf("Was expecting services %#v to be invalid", services)
+		}
+	}
+	if err := validateServices([]Service{{Name: "db", Image: "postgres", LeasedPorts: []string{"DB_PORT"}}, {Name: "web", Command: []string{"true"}}}, []PortLease{{Name: "DB_PORT"}}); err != nil {
+		t.Fatalf("Was expecting services to be valid, but got: %v", err)
+	}
+}
+
+func TestDockerRunCommand(t *testing.T) {
+	service := Service{
+		Name:        "db",
+		Image:       "postgres:12",
+		Command:     []string{"postgres", "-c", "fsync=off"},
+		Env:         map[string]string{"POSTGRES_USER": "test", "PGDATA": "/tmp/pg"},
+		Ports:       []int64{5432},
+		LeasedPorts: []string{"METRICS_PORT"},
+	}
+	leasedPorts := []*portLease{
+		{PortLease: PortLease{Name: "METRICS_PORT", Protocol: "udp"}, Port: 20001},
+		{PortLease: PortLease{Name: "WEB_PORT"}, Port: 20000},
+	}
+	expected := []string{
+		"docker", "run", "--rm", "--name", "taskcluster-abc-db",
+		"--publish", "127.0.0.1:5432:5432",
+		"--publish", "127.0.0.1:20001:20001/udp",
+		"--add-host", "staging.example.com:127.0.0.2",
+		"--env", "METRICS_PORT=20001",
+		"--env", "WEB_PORT=20000",
+		"--env", "PGDATA=/tmp/pg",
+		"--env", "POSTGRES_USER=test",
+		"postgres:12", "postgres", "-c", "fsync=off",
+	}
+	if actual := dockerRunCommand("docker", "taskcluster-abc-db", service, leasedPorts, []HostAlias{{Hostname: "staging.example.com", IP: "127.0.0.2"}}); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Was expecting %q but got %q", expected, actual)
+	}
+}
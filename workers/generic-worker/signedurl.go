@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+)
+
+var (
+	// how long signed urls for artifact downloads should be valid for,
+	// according to the server's clock
+	signedURLValidity = 30 * time.Minute
+	// how many times to request a fresh signed url if a download fails
+	// because the signed url has expired
+	maxSignedURLAttempts = 3
+	// how long to wait before the first retry with a fresh signed url; this
+	// doubles with each attempt
+	signedURLRetryDelay = 5 * time.Second
+
+	clockSkew ClockSkew
+)
+
+// ClockSkew tracks the difference between the server clock, as reported in
+// the Date header of http responses, and the local clock. Signed urls are
+// generated using the local clock, so if the local clock is behind, they can
+// already have expired by the time the server receives them.
+type ClockSkew struct {
+	sync.Mutex
+	// server time minus local time, from the most recent response
+	skew time.Duration
+}
+
+// observe records the clock skew from the Date header of the given response,
+// if it has one
+func (c *ClockSkew) observe(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	serverTime, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.skew = time.Until(serverTime)
+}
+
+// Get returns the most recently observed clock skew
+func (c *ClockSkew) Get() time.Duration {
+	c.Lock()
+	defer c.Unlock()
+	return c.skew
+}
+
+// signedURLDuration returns the duration to sign urls for, so that they are
+// valid for signedURLValidity according to the server's clock. The Date header
+// only has a resolution of one second, so small skews are ignored.
+func signedURLDuration() time.Duration {
+	if skew := clockSkew.Get(); skew > time.Second {
+		return signedURLValidity + skew
+	}
+	return signedURLValidity
+}
+
+// signedURLExpired returns true if the given download error was caused by
+// the signed url having expired, rather than a lack of permission to access
+// the content, in which case requesting a fresh signed url may help. The
+// queue ("Access expired"), S3 ("Request has expired") and GCS
+// ("ExpiredToken") all report expiry in the response body.
+func signedURLExpired(err error) bool {
+	badResponse, isBadResponse := err.(httpbackoff.BadHttpResponseCode)
+	if !isBadResponse {
+		return false
+	}
+	switch badResponse.HttpResponseCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return strings.Contains(strings.ToLower(badResponse.Message), "expired")
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/httpbackoff/v3"
+)
+
+func TestSignedURLExpired(t *testing.T) {
+	for _, test := range []struct {
+		err     error
+		expired bool
+	}{
+		{httpbackoff.BadHttpResponseCode{HttpResponseCode: 403, Message: "<Error><Code>AccessDenied</Code><Message>Request has expired</Message></Error>"}, true},
+		{httpbackoff.BadHttpResponseCode{HttpResponseCode: 401, Message: `{"code":"AuthenticationFailed","message":"Access expired"}`}, true},
+		{httpbackoff.BadHttpResponseCode{HttpResponseCode: 400, Message: "<Error><Code>ExpiredToken</Code></Error>"}, false},
+		{httpbackoff.BadHttpResponseCode{HttpResponseCode: 403, Message: "<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>"}, false},
+		{httpbackoff.BadHttpResponseCode{HttpResponseCode: 404, Message: "expired"}, false},
+		{errors.New("Request has expired"), false},
+	} {
+		if actual := signedURLExpired(test.err); actual != test.expired {
+			t.Errorf("Was expecting signedURLExpired(%#v) to be %v but it was %v", test.err, test.expired, actual)
+		}
+	}
+}
+
+func TestSignedURLDuration(t *testing.T) {
+	defer func() {
+		clockSkew = ClockSkew{}
+	}()
+	resp := &http.Response{
+		Header: http.Header{},
+	}
+	resp.Header.Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	clockSkew.observe(resp)
+	duration := signedURLDuration()
+	if duration < signedURLValidity+59*time.Minute || duration > signedURLValidity+time.Hour {
+		t.Fatalf("Was expecting signed url duration to be extended by an hour of clock skew, but got %v", duration)
+	}
+
+	// responses without a valid Date header should not affect the skew
+	resp.Header.Set("Date", "yesterday")
+	clockSkew.observe(resp)
+	clockSkew.observe(nil)
+	if clockSkew.Get() < 59*time.Minute {
+		t.Fatalf("Was expecting clock skew to be unchanged, but got %v", clockSkew.Get())
+	}
+
+	// a local clock that is ahead does not need signed urls to be extended
+	resp.Header.Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	clockSkew.observe(resp)
+	if duration := signedURLDuration(); duration != signedURLValidity {
+		t.Fatalf("Was expecting signed url duration %v but got %v", signedURLValidity, duration)
+	}
+}
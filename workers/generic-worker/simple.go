@@ -2,7 +2,11 @@
 
 package main
 
-import "log"
+import (
+	"log"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
 
 const (
 	engine = "simple"
@@ -11,3 +15,47 @@ const (
 func secure(configFile string) {
 	log.Printf("WARNING: can't secure generic-worker config file %q", configFile)
 }
+
+func platformFeatures() []Feature {
+	return []Feature{
+		&CommandTraceFeature{},
+		&CrashDumpsFeature{},
+		&MemoryWatchdogFeature{},
+		&FileCountWatchdogFeature{},
+		&ProgressFeature{},
+		&AnnotationsFeature{},
+		&TestResultsFeature{},
+		&SBOMFeature{},
+		&AndroidEmulatorFeature{},
+		&IOSSimulatorFeature{},
+		&KeychainFeature{},
+		&TCCFeature{},
+		&ServicesFeature{},
+		// must come before TaskIsolation, which mounts the hosts file it
+		// writes
+		&HostAliasesFeature{},
+		// wraps the task commands, so must start after features that
+		// modify them
+		&TaskIsolationFeature{},
+		// wraps the task commands (including the sandbox of TaskIsolation)
+		// in a network namespace, so must start after TaskIsolation
+		&TaskNetworkFeature{},
+		// runs the task commands in an empty network namespace instead of
+		// the network namespace of TaskNetwork, for tasks without network
+		// access
+		&DisableNetworkFeature{},
+	}
+}
+
+func (task *TaskRun) generateCommand(index int) error {
+	var err error
+	task.Commands[index], err = process.NewCommand(task.Payload.Command[index], taskContext.TaskDir, task.EnvVars())
+	if err != nil {
+		return err
+	}
+	task.logMux.RLock()
+	defer task.logMux.RUnlock()
+	task.Commands[index].DirectOutput(task.logWriter)
+	task.Commands[index].TagOutputStreams = task.Payload.TagOutputStreams
+	return nil
+}
@@ -1,4 +1,4 @@
-// +build simple docker
+// +build simple docker kubernetes
 
 package main
 
@@ -12,13 +12,21 @@ import (
 
 	"github.com/taskcluster/shell"
 	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
-	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
 )
 
 func (task *TaskRun) formatCommand(index int) string {
 	return shell.Escape(task.Payload.Command[index]...)
 }
 
+// adaptEngineToContainer doesn't need to do anything, since tasks already
+// run as the current user
+func adaptEngineToContainer() {
+}
+
+// the task directory can be created before the task that uses it is claimed
+// (see config setting warmStandby)
+const standbyTaskDirectories = true
+
 func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 	taskContext = &TaskContext{
 		TaskDir: filepath.Join(config.TasksDir, taskDirName),
@@ -30,10 +38,6 @@ func PlatformTaskEnvironmentSetup(taskDirName string) (reboot bool) {
 	return false
 }
 
-func platformFeatures() []Feature {
-	return []Feature{}
-}
-
 func deleteDir(path string) error {
 	log.Print("Removing directory '" + path + "'...")
 	err := host.Run("/bin/chmod", "-R", "u+w", path)
@@ -50,18 +54,6 @@ func deleteDir(path string) error {
 	return nil
 }
 
-func (task *TaskRun) generateCommand(index int) error {
-	var err error
-	task.Commands[index], err = process.NewCommand(task.Payload.Command[index], taskContext.TaskDir, task.EnvVars())
-	if err != nil {
-		return err
-	}
-	task.logMux.RLock()
-	defer task.logMux.RUnlock()
-	task.Commands[index].DirectOutput(task.logWriter)
-	return nil
-}
-
 func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 	return nil
 }
@@ -69,6 +61,7 @@ func (task *TaskRun) prepareCommand(index int) *CommandExecutionError {
 // Set an environment variable in each command.  This can be called from a feature's
 // NewTaskFeature method to set variables for the task.
 func (task *TaskRun) setVariable(variable string, value string) error {
+	task.recordVariable(variable, value)
 	for i := range task.Commands {
 		task.Commands[i].SetEnv(variable, value)
 	}
@@ -143,6 +136,7 @@ func (task *TaskRun) EnvVars() []string {
 	taskEnv["TASK_ID"] = task.TaskID
 	taskEnv["RUN_ID"] = strconv.Itoa(int(task.RunID))
 	taskEnv["TASKCLUSTER_ROOT_URL"] = config.RootURL
+	taskEnv["TASK_ARCHITECTURE"] = task.architecture
 
 	if config.WorkerLocation != "" {
 		taskEnv["TASKCLUSTER_WORKER_LOCATION"] = config.WorkerLocation
@@ -1,4 +1,4 @@
-// +build simple docker
+// +build simple docker kubernetes
 
 package main
 
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sysinfo "github.com/elastic/go-sysinfo"
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+)
+
+// number of recent task runs shown on the status page
+const statusPageHistoryLength = 10
+
+type (
+	// StatusPage serves a read-only web page (see config setting
+	// statusPagePort) that shows what the worker is doing, for operators
+	// logged in to the worker. Without a token, it is only served on
+	// localhost, otherwise it is served on the public IP of the worker, and
+	// requests must include the token.
+	StatusPage struct {
+		control  *WorkerControl
+		token    string
+		server   *http.Server
+		listener net.Listener
+		// guards caches
+		sync.Mutex
+		// caches of the worker, when last refreshed
+		caches []*statusPageCache
+	}
+
+	// statusPageStatus is the content of the status page
+	statusPageStatus struct {
+		*controlStatus
+		WorkerPoolID      string               `json:"workerPoolId"`
+		WorkerGroup       string               `json:"workerGroup"`
+		WorkerID          string               `json:"workerId"`
+		ConfigFingerprint string               `json:"configFingerprint"`
+		Disk              []*statusPageDisk    `json:"disk"`
+		Memory            *statusPageMemory    `json:"memory,omitempty"`
+		Caches            []*statusPageCache   `json:"caches"`
+		History           []*TaskHistoryRecord `json:"history"`
+		Generated         tcclient.Time        `json:"generated"`
+	}
+
+	statusPageDisk struct {
+		Directory string `json:"directory"`
+		FreeBytes uint64 `json:"freeBytes"`
+	}
+
+	statusPageMemory struct {
+		TotalBytes     uint64 `json:"totalBytes"`
+		AvailableBytes uint64 `json:"availableBytes"`
+	}
+
+	statusPageCache struct {
+		// "file" (url mounts) or "directory" (writable directory caches)
+		Type     string        `json:"type"`
+		Key      string        `json:"key"`
+		Location string        `json:"location"`
+		Hits     int           `json:"hits"`
+		Created  tcclient.Time `json:"created"`
+	}
+)
+
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"bytes": func(n uint64) string {
+		return strconv.FormatFloat(float64(n)/(1024*1024*1024), 'f', 1, 64) + " GiB"
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>generic-worker {{.WorkerGroup}}/{{.WorkerID}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>generic-worker {{.WorkerGroup}}/{{.WorkerID}}</h1>
+<table>
+<tr><th>Worker pool</th><td>{{.WorkerPoolID}}</td></tr>
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th>Health</th><td>{{.Health}}{{if .DegradedReason}} ({{.DegradedReason}}){{end}}</td></tr>
+<tr><th>Paused</th><td>{{.Paused}}</td></tr>
+<tr><th>Shutdown requested</th><td>{{.ShutdownRequested}}</td></tr>
+{{if .QuarantinedUntil}}<tr><th>Quarantined until</th><td>{{.QuarantinedUntil}}</td></tr>{{end}}
+{{if .MaintenanceWindow}}<tr><th>Maintenance window</th><td>{{.MaintenanceWindow}}</td></tr>{{end}}
+<tr><th>Tasks resolved</th><td>{{.TasksResolved}}</td></tr>
+<tr><th>Config fingerprint</th><td><code>{{.ConfigFingerprint}}</code></td></tr>
+</table>
+<h2>Current task</h2>
+{{with .Task}}<p>Task {{.TaskID}} run {{.RunID}}, started {{.Started}}</p>{{else}}<p>None</p>{{end}}
+<h2>Headroom</h2>
+<table>
+<tr><th>Directory</th><th>Free disk space</th></tr>
+{{range .Disk}}<tr><td>{{.Directory}}</td><td>{{bytes .FreeBytes}}</td></tr>
+{{end}}</table>
+{{with .Memory}}<p>Memory: {{bytes .AvailableBytes}} available of {{bytes .TotalBytes}}</p>{{end}}
+<h2>Recent tasks</h2>
+<table>
+<tr><th>Task</th><th>Run</th><th>Resolved</th><th>Result</th><th>Duration (s)</th><th>Cache hits/misses</th></tr>
+{{range .History}}<tr><td>{{.TaskID}}</td><td>{{.RunID}}</td><td>{{.Resolved}}</td><td>{{.Result}}{{if .Reason}} ({{.Reason}}){{end}}</td><td>{{printf "%.0f" .DurationSeconds}}</td><td>{{.CacheHits}}/{{.CacheMisses}}</td></tr>
+{{end}}</table>
+<h2>Caches</h2>
+<table>
+<tr><th>Type</th><th>Key</th><th>Location</th><th>Hits</th><th>Created</th></tr>
+{{range .Caches}}<tr><td>{{.Type}}</td><td>{{.Key}}</td><td>{{.Location}}</td><td>{{.Hits}}</td><td>{{.Created}}</td></tr>
+{{end}}</table>
+<p>Generated {{.Generated}} - also available as <a href="status.json">json</a>.</p>
+</body>
+</html>
+`))
+
+func NewStatusPage(control *WorkerControl, token string) *StatusPage {
+	return &StatusPage{
+		control: control,
+		token:   token,
+		caches:  []*statusPageCache{},
+	}
+}
+
+// Serve serves the status page on the given port in the background, until
+// Close is called
+func (sp *StatusPage) Serve(port uint16) error {
+	host := "localhost"
+	if sp.token != "" {
+		host = config.PublicIP.String()
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("could not listen on %v for status page: %v", address, err)
+	}
+	sp.listener = listener
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", sp.handle)
+	sp.server = &http.Server{
+		Handler: mux,
+	}
+	log.Printf("Serving status page on http://%v/", address)
+	go func() {
+		if err := sp.server.Serve(listener); err != http.ErrServerClosed {
+			log.Printf("WARNING: status page stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (sp *StatusPage) Close() {
+	if sp.server != nil {
+		_ = sp.server.Close()
+	}
+}
+
+// RefreshCaches records the current caches of the worker for the status
+// page. Since the caches are only changed by the main loop of the worker,
+// the main loop calls it whenever the caches may have changed, rather than
+// the status page reading them while they change.
+func (sp *StatusPage) RefreshCaches() {
+	caches := []*statusPageCache{}
+	for _, c := range []struct {
+		cacheType string
+		caches    CacheMap
+	}{
+		{"file", fileCaches},
+		{"directory", directoryCaches},
+	} {
+		for _, cache := range c.caches {
+			caches = append(caches, &statusPageCache{
+				Type:     c.cacheType,
+				Key:      cache.Key,
+				Location: cache.Location,
+				Hits:     cache.Hits,
+				Created:  tcclient.Time(cache.Created),
+			})
+		}
+	}
+	sort.Slice(caches, func(i, j int) bool {
+		if caches[i].Type != caches[j].Type {
+			return caches[i].Type < caches[j].Type
+		}
+		return caches[i].Key < caches[j].Key
+	})
+	sp.Lock()
+	defer sp.Unlock()
+	sp.caches = caches
+}
+
+func (sp *StatusPage) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sp.authorized(r) {
+		http.Error(w, "Missing or invalid token - pass it in query parameter token, or as a bearer token", http.StatusUnauthorized)
+		return
+	}
+	switch r.URL.Path {
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, sp.status()); err != nil {
+			log.Printf("WARNING: Could not render status page: %v", err)
+		}
+	case "/status.json":
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(sp.status()); err != nil {
+			log.Printf("WARNING: Could not write status: %v", err)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (sp *StatusPage) authorized(r *http.Request) bool {
+	if sp.token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(sp.token)) == 1
+}
+
+func (sp *StatusPage) status() *statusPageStatus {
+	sp.control.mutex.Lock()
+	control := sp.control.status()
+	sp.control.mutex.Unlock()
+	sp.Lock()
+	caches := sp.caches
+	sp.Unlock()
+	status := &statusPageStatus{
+		controlStatus: control,
+		WorkerPoolID:  config.ProvisionerID + "/" + config.WorkerType,
+		WorkerGroup:   config.WorkerGroup,
+		WorkerID:      config.WorkerID,
+		Disk:          []*statusPageDisk{},
+		Caches:        caches,
+		Generated:     tcclient.Time(time.Now()),
+	}
+	fingerprint, err := publicConfigFingerprint()
+	if err != nil {
+		log.Printf("WARNING: Could not calculate config fingerprint: %v", err)
+	}
+	status.ConfigFingerprint = fingerprint
+	for _, dir := range []string{config.TasksDir, config.CachesDir, config.DownloadsDir} {
+		free, err := freeDiskSpaceBytes(dir)
+		if err != nil {
+			continue
+		}
+		status.Disk = append(status.Disk, &statusPageDisk{
+			Directory: dir,
+			FreeBytes: free,
+		})
+	}
+	if host, err := sysinfo.Host(); err == nil {
+		if memory, err := host.Memory(); err == nil {
+			status.Memory = &statusPageMemory{
+				TotalBytes:     memory.Total,
+				AvailableBytes: memory.Available,
+			}
+		}
+	}
+	status.History, err = taskHistory.Query(nil, statusPageHistoryLength)
+	if err != nil {
+		log.Printf("WARNING: Could not read task history database for status page: %v", err)
+		status.History = []*TaskHistoryRecord{}
+	}
+	return status
+}
+
+// publicConfigFingerprint returns the hash of the public config of the
+// worker, so that operators can tell whether its config has changed
+func publicConfigFingerprint() (string, error) {
+	data, err := json.Marshal(&config.PublicConfig)
+	if err != nil {
+		return "", err
+	}
+	settings := map[string]interface{}{}
+	err = json.Unmarshal(data, &settings)
+	if err != nil {
+		return "", err
+	}
+	return configHash(settings)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestStatusPage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "status-page")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	config.TasksDir = dir
+	config.WorkerID = "test-worker"
+	oldHistory, oldFileCaches := taskHistory, fileCaches
+	defer func() { taskHistory, fileCaches = oldHistory, oldFileCaches }()
+	taskHistory = &TaskHistory{
+		file: filepath.Join(dir, taskHistoryFile),
+	}
+	err = taskHistory.Add(&TaskHistoryRecord{TaskID: "earlier-task", Result: "failed"}, 10)
+	if err != nil {
+		t.Fatalf("Could not add task history record: %v", err)
+	}
+	fileCaches = CacheMap{
+		"https://example.com/toolchain.tar.gz": &Cache{
+			Key:      "https://example.com/toolchain.tar.gz",
+			Location: filepath.Join(dir, "toolchain"),
+			Hits:     3,
+			Created:  time.Now(),
+		},
+	}
+
+	control := NewWorkerControl("", 7)
+	control.TaskStarted(&TaskRun{TaskID: "current-task", RunID: 1})
+	statusPage := NewStatusPage(control, "secret")
+	statusPage.RefreshCaches()
+	server := httptest.NewServer(http.HandlerFunc(statusPage.handle))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/status.json")
+	if err != nil {
+		t.Fatalf("Could not get status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected status %v without token, but got %v", http.StatusUnauthorized, resp.StatusCode)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/status.json", nil)
+	if err != nil {
+		t.Fatalf("Could not create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not get status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %v, but got %v", http.StatusOK, resp.StatusCode)
+	}
+	var status struct {
+		WorkerID          string `json:"workerId"`
+		TasksResolved     uint   `json:"tasksResolved"`
+		ConfigFingerprint string `json:"configFingerprint"`
+		Task              *struct {
+			TaskID string `json:"taskId"`
+		} `json:"task"`
+		Disk    []*statusPageDisk    `json:"disk"`
+		Caches  []*statusPageCache   `json:"caches"`
+		History []*TaskHistoryRecord `json:"history"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		t.Fatalf("Could not decode status: %v", err)
+	}
+	if status.WorkerID != "test-worker" || status.TasksResolved != 7 || status.ConfigFingerprint == "" {
+		t.Fatalf("Unexpected worker status %#v", status)
+	}
+	if status.Task == nil || status.Task.TaskID != "current-task" {
+		t.Fatalf("Expected current task current-task, but got %#v", status.Task)
+	}
+	if len(status.Disk) != 1 || status.Disk[0].Directory != dir {
+		t.Fatalf("Expected free disk space of %v, but got %#v", dir, status.Disk)
+	}
+	if len(status.Caches) != 1 || status.Caches[0].Type != "file" || status.Caches[0].Hits != 3 {
+		t.Fatalf("Expected toolchain file cache, but got %#v", status.Caches)
+	}
+	if len(status.History) != 1 || status.History[0].TaskID != "earlier-task" {
+		t.Fatalf("Expected earlier-task in history, but got %#v", status.History)
+	}
+
+	resp, err = http.Get(server.URL + "/?token=secret")
+	if err != nil {
+		t.Fatalf("Could not get status page: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status %v for status page, but got %v", http.StatusOK, resp.StatusCode)
+	}
+}
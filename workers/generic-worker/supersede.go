@@ -55,9 +55,9 @@ func (feature *SupersedeFeature) NewTaskFeature(task *TaskRun) TaskFeature {
 	}
 }
 
-func (l *SupersedeTask) RequiredScopes() scopes.Required {
+func (l *SupersedeTask) RequiredScopes() scopes.Expression {
 	// let's not require any scopes, as I see no reason to control access to this feature
-	return scopes.Required{}
+	return scopes.AllOf{}
 }
 
 func (l *SupersedeTask) Start() *CommandExecutionError {
@@ -69,8 +69,7 @@ func (l *SupersedeTask) Start() *CommandExecutionError {
 	if err != nil {
 		// if problem with superseder service, let's run all tasks, and not resolve them all as exception
 		l.task.Warnf("[supersede] Problem accessing supersederUrl: %v", err)
-		l.task.Warn("[supersede] Not able to see if this task has been superseded!")
-		return nil
+		return l.supersededByHistory()
 	}
 	decoder := json.NewDecoder(resp.Body)
 	var supersedes SupersedesServiceResponse
@@ -78,45 +77,72 @@ func (l *SupersedeTask) Start() *CommandExecutionError {
 	if err != nil {
 		// if problem with superseder service, let's run all tasks, and not resolve them all as exception
 		l.task.Warnf("[supersede] Not able to interpret response from supersederUrl %v as json list of task IDs: %v", supersederURL, err)
-		l.task.Warn("[supersede] Not able to see if this task has been superseded!")
-		return nil
+		return l.supersededByHistory()
 	}
 	taskIDs := supersedes.TaskIDs
 	if len(taskIDs) < 1 {
 		return nil
 	}
-	if l.task.TaskID != taskIDs[0] {
-		supersededByFile := filepath.Join(taskContext.TaskDir, supersededByPath)
-		err = fileutil.WriteToFileAsJSON(
-			map[string]string{
-				"taskId": taskIDs[0],
-			},
-			supersededByFile,
-		)
-		if err != nil {
-			panic(err)
+	if l.task.TaskID == taskIDs[0] {
+		l.task.supersedes = taskIDs[1:]
+	} else {
+		return l.supersededBy(taskIDs[0])
+	}
+	return nil
+}
+
+// supersededByHistory checks, when the superseder service could not be
+// asked, whether a task that this worker has run superseded the task,
+// according to the task history database
+func (l *SupersedeTask) supersededByHistory() *CommandExecutionError {
+	records, err := taskHistory.Query(func(record *TaskHistoryRecord) bool {
+		for _, taskID := range record.Supersedes {
+			if taskID == l.task.TaskID {
+				return true
+			}
 		}
-		e := l.task.uploadArtifact(
-			&S3Artifact{
-				BaseArtifact: &BaseArtifact{
-					Name:    supersededByName,
-					Expires: l.task.Definition.Expires,
-				},
-				Path:            supersededByPath,
-				ContentEncoding: "gzip",
-				ContentType:     "application/json",
+		return false
+	}, 1)
+	if err != nil || len(records) == 0 {
+		l.task.Warn("[supersede] Not able to see if this task has been superseded!")
+		return nil
+	}
+	l.task.Infof("[supersede] Task %v that this worker ran superseded this task, according to its supersederUrl", records[0].TaskID)
+	return l.supersededBy(records[0].TaskID)
+}
+
+// supersededBy publishes artifact public/superseded-by.json naming the given
+// task, and returns the error that resolves the task as superseded
+func (l *SupersedeTask) supersededBy(taskID string) *CommandExecutionError {
+	supersededByFile := filepath.Join(taskContext.TaskDir, supersededByPath)
+	err := fileutil.WriteToFileAsJSON(
+		map[string]string{
+			"taskId": taskID,
+		},
+		supersededByFile,
+	)
+	if err != nil {
+		panic(err)
+	}
+	e := l.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    supersededByName,
+				Expires: l.task.Definition.Expires,
 			},
-		)
-		if e != nil {
-			panic(e)
-		}
-		return &CommandExecutionError{
-			TaskStatus: aborted,
-			Cause:      fmt.Errorf("Task %v has been superseded by task %v", l.task.TaskID, taskIDs[0]),
-			Reason:     superseded,
-		}
+			Path:            supersededByPath,
+			ContentEncoding: "gzip",
+			ContentType:     "application/json",
+		},
+	)
+	if e != nil {
+		panic(e)
+	}
+	return &CommandExecutionError{
+		TaskStatus: aborted,
+		Cause:      fmt.Errorf("Task %v has been superseded by task %v", l.task.TaskID, taskID),
+		Reason:     superseded,
 	}
-	return nil
 }
 
 func (l *SupersedeTask) Stop(*ExecutionErrors) {
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// not public, since redaction cannot catch every sensitive value in the
+// environment of a task
+const taskEnvironmentArtifactName = "private/task-environment.json"
+
+var (
+	// path, relative to task directory, of the task environment
+	taskEnvironmentPath = filepath.Join("generic-worker", "task-environment.json")
+	// the task directory listing stops after this many entries, so that
+	// huge build trees don't produce huge artifacts
+	maxTaskEnvironmentFiles = 10000
+	// values of env vars with matching names are redacted
+	sensitiveEnvVarName = regexp.MustCompile(`(?i)secret|token|passw(or)?d|credential|access_?key|private_?key|api_?key`)
+)
+
+type (
+	// TaskEnvironment is the content of artifact
+	// private/task-environment.json
+	TaskEnvironment struct {
+		// set if the environment was captured because the task failed
+		Failed bool `json:"failed"`
+		// env vars of the task commands, with sensitive values redacted
+		Env              map[string]string      `json:"env"`
+		WorkingDirectory string                 `json:"workingDirectory"`
+		Files            []*TaskEnvironmentFile `json:"files"`
+		// set if the listing stopped after maxTaskEnvironmentFiles entries
+		FilesTruncated bool                    `json:"filesTruncated,omitempty"`
+		Caches         []*TaskEnvironmentCache `json:"caches"`
+	}
+
+	// TaskEnvironmentFile is an entry of the task directory listing
+	TaskEnvironmentFile struct {
+		Path     string    `json:"path"`
+		Mode     string    `json:"mode"`
+		Size     int64     `json:"size"`
+		Modified time.Time `json:"modified"`
+		// target of a symbolic link
+		Link string `json:"link,omitempty"`
+	}
+
+	// TaskEnvironmentCache describes the cached content of a mount of the
+	// task, so that differences in cache versions between workers are
+	// visible
+	TaskEnvironmentCache struct {
+		// "directory" for writable directory caches, otherwise "file"
+		Type    string    `json:"type"`
+		Key     string    `json:"key"`
+		Mount   string    `json:"mount"`
+		Created time.Time `json:"created"`
+		Hits    int       `json:"hits"`
+		SHA256  string    `json:"sha256,omitempty"`
+	}
+
+	TaskEnvironmentFeature struct {
+	}
+
+	TaskEnvironmentTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *TaskEnvironmentFeature) Name() string {
+	return "Task Environment"
+}
+
+func (feature *TaskEnvironmentFeature) Initialise() error {
+	return nil
+}
+
+func (feature *TaskEnvironmentFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskEnvironmentFeature) IsEnabled(task *TaskRun) bool {
+	return config.TaskEnvironmentCapture != "never"
+}
+
+func (feature *TaskEnvironmentFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskEnvironmentTask{
+		task: task,
+	}
+}
+
+func (te *TaskEnvironmentTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (te *TaskEnvironmentTask) ReservedArtifacts() []string {
+	return []string{
+		taskEnvironmentArtifactName,
+	}
+}
+
+func (te *TaskEnvironmentTask) Start() *CommandExecutionError {
+	return nil
+}
+
+// Stop captures the environment of the task, if it failed, or if config
+// setting taskEnvironmentCapture is "always". This happens before mounts are
+// unmounted, so that writable directory caches are still in the task
+// directory. The capture is purely informational, so problems publishing it
+// are logged rather than failing the task.
+func (te *TaskEnvironmentTask) Stop(err *ExecutionErrors) {
+	// nothing ran if the result cache reused an earlier task
+	if te.task.resultCacheTaskID != "" || (!err.Occurred() && config.TaskEnvironmentCapture != "always") {
+		return
+	}
+	environment := te.task.captureEnvironment(err.Occurred())
+	data, e := json.MarshalIndent(environment, "", "  ")
+	if e != nil {
+		panic(e)
+	}
+	file := filepath.Join(taskContext.TaskDir, taskEnvironmentPath)
+	e = os.MkdirAll(filepath.Dir(file), 0700)
+	if e == nil {
+		e = ioutil.WriteFile(file, data, 0644)
+	}
+	if e != nil {
+		te.task.Warnf("[environment] Could not write task environment: %v", e)
+		return
+	}
+	uploadErr := te.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    taskEnvironmentArtifactName,
+				Expires: te.task.Definition.Expires,
+			},
+			ContentType:     "application/json; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            taskEnvironmentPath,
+		},
+	)
+	if uploadErr != nil {
+		te.task.Warnf("[environment] Could not upload task environment: %v", uploadErr)
+		return
+	}
+	te.task.Infof("[environment] Published environment variables, task directory listing and cache versions of the task (%v bytes) as %v", len(data), taskEnvironmentArtifactName)
+}
+
+// recordVariable records an env var that a feature sets with setVariable,
+// for the task environment artifact
+func (task *TaskRun) recordVariable(variable, value string) {
+	if task.featureEnv == nil {
+		task.featureEnv = map[string]string{}
+	}
+	task.featureEnv[variable] = value
+}
+
+func (task *TaskRun) captureEnvironment(failed bool) *TaskEnvironment {
+	environment := &TaskEnvironment{
+		Failed:           failed,
+		Env:              map[string]string{},
+		WorkingDirectory: taskContext.TaskDir,
+		Files:            []*TaskEnvironmentFile{},
+		Caches:           []*TaskEnvironmentCache{},
+	}
+	// later values take precedence
+	for _, envVar := range task.EnvVars() {
+		if parts := strings.SplitN(envVar, "=", 2); len(parts) == 2 {
+			environment.Env[parts[0]] = parts[1]
+		}
+	}
+	for name, value := range task.featureEnv {
+		environment.Env[name] = value
+	}
+	for name, value := range environment.Env {
+		environment.Env[name] = task.redactEnvVar(name, value)
+	}
+	environment.Files, environment.FilesTruncated = listTaskDirectory(taskContext.TaskDir, maxTaskEnvironmentFiles)
+	environment.Caches = task.mountedCaches()
+	return environment
+}
+
+// redactEnvVar returns the value of the given env var, with secret values
+// that the task fetched redacted, or redactedSecret if its name suggests
+// that it holds a secret
+func (task *TaskRun) redactEnvVar(name, value string) string {
+	if value != "" && sensitiveEnvVarName.MatchString(name) {
+		return redactedSecret
+	}
+	for _, secret := range task.redactions {
+		value = strings.Replace(value, secret, redactedSecret, -1)
+	}
+	return value
+}
+
+// listTaskDirectory lists the files and directories under dir, stopping
+// after max entries
+func listTaskDirectory(dir string, max int) (files []*TaskEnvironmentFile, truncated bool) {
+	files = []*TaskEnvironmentFile{}
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || path == dir {
+			return nil
+		}
+		if len(files) == max {
+			truncated = true
+			return filepath.SkipDir
+		}
+		rel, _ := filepath.Rel(dir, path)
+		file := &TaskEnvironmentFile{
+			Path:     filepath.ToSlash(rel),
+			Mode:     info.Mode().String(),
+			Size:     info.Size(),
+			Modified: info.ModTime(),
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			file.Link, _ = os.Readlink(path)
+		}
+		files = append(files, file)
+		return nil
+	})
+	return
+}
+
+// mountedCaches returns the caches of the mounts of the task
+func (task *TaskRun) mountedCaches() []*TaskEnvironmentCache {
+	caches := []*TaskEnvironmentCache{}
+	for _, m := range task.Payload.Mounts {
+		var mount struct {
+			CacheName string          `json:"cacheName"`
+			Directory string          `json:"directory"`
+			File      string          `json:"file"`
+			Content   json.RawMessage `json:"content"`
+		}
+		if json.Unmarshal(m, &mount) != nil {
+			continue
+		}
+		var cache *Cache
+		entry := &TaskEnvironmentCache{
+			Type:  "file",
+			Mount: mount.File,
+		}
+		switch {
+		case mount.CacheName != "":
+			entry.Type = "directory"
+			entry.Key = mount.CacheName
+			entry.Mount = mount.Directory
+			cache = directoryCaches[mount.CacheName]
+		case mount.Content != nil:
+			fsContent, err := FSContentFrom(mount.Content)
+			if err != nil {
+				continue
+			}
+			if mount.Directory != "" {
+				entry.Mount = mount.Directory
+			}
+			entry.Key = fsContent.UniqueKey()
+			cache = fileCaches[entry.Key]
+		}
+		if cache == nil {
+			continue
+		}
+		entry.Created = cache.Created
+		entry.Hits = cache.Hits
+		entry.SHA256 = cache.SHA256
+		caches = append(caches, entry)
+	}
+	return caches
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+// file, in the working directory of the worker, of the task history
+// database, with one json encoded TaskHistoryRecord per line, oldest first
+const taskHistoryFile = "task-history.jsonl"
+
+// taskHistory is the task history database of the worker, see config setting
+// taskHistoryMaxRuns
+var taskHistory = &TaskHistory{
+	file: taskHistoryFile,
+}
+
+type (
+	// TaskHistory is a local database of the task runs that the worker has
+	// resolved. Records are appended to a file, which is compacted to the
+	// most recent maxRuns records once it holds twice as many.
+	TaskHistory struct {
+		file string
+		// number of records in file, once counted
+		records int
+		counted bool
+	}
+
+	// TaskHistoryRecord is a task run that the worker resolved
+	TaskHistoryRecord struct {
+		TaskID      string        `json:"taskId"`
+		RunID       uint          `json:"runId"`
+		TaskGroupID string        `json:"taskGroupId"`
+		Started     tcclient.Time `json:"started"`
+		Resolved    tcclient.Time `json:"resolved"`
+		// expiry of the task, after which its artifacts no longer exist
+		Expires         tcclient.Time `json:"expires"`
+		DurationSeconds float64       `json:"durationSeconds"`
+		// "completed", "failed" or "exception"
+		Result string `json:"result"`
+		// reason of an exception, e.g. "malformed-payload"
+		Reason          string  `json:"reason,omitempty"`
+		CPUTimeSeconds  float64 `json:"cpuTimeSeconds"`
+		BytesDownloaded int64   `json:"bytesDownloaded"`
+		BytesUploaded   int64   `json:"bytesUploaded"`
+		// mounts that were, and were not, already in the caches of the
+		// worker
+		CacheHits   int `json:"cacheHits"`
+		CacheMisses int `json:"cacheMisses"`
+		// url mounts of the task
+		Mounts []*URLContent `json:"mounts,omitempty"`
+		// hash of the task, if it ran with the Result Cache feature
+		ResultCacheHash string `json:"resultCacheHash,omitempty"`
+		// identical earlier task whose artifacts the Result Cache feature
+		// reused, if any
+		ResultCacheTaskID string `json:"resultCacheTaskId,omitempty"`
+		// tasks that the task superseded, according to its supersederUrl
+		Supersedes []string `json:"supersedes,omitempty"`
+	}
+)
+
+// newTaskHistoryRecord returns the history record of the given task run,
+// which started at the given time, and resolved with the given errors
+func newTaskHistoryRecord(task *TaskRun, started time.Time, errors *ExecutionErrors) *TaskHistoryRecord {
+	resolved := time.Now()
+	task.resourceUsage.Lock()
+	defer task.resourceUsage.Unlock()
+	record := &TaskHistoryRecord{
+		TaskID:            task.TaskID,
+		RunID:             task.RunID,
+		TaskGroupID:       task.Definition.TaskGroupID,
+		Started:           tcclient.Time(started),
+		Resolved:          tcclient.Time(resolved),
+		Expires:           task.Definition.Expires,
+		DurationSeconds:   resolved.Sub(started).Seconds(),
+		Result:            "completed",
+		CPUTimeSeconds:    task.resourceUsage.CPUTime.Seconds(),
+		BytesDownloaded:   task.resourceUsage.BytesDownloaded,
+		BytesUploaded:     task.resourceUsage.BytesUploaded,
+		CacheHits:         task.cacheHits,
+		CacheMisses:       task.cacheMisses,
+		Mounts:            urlMounts(task),
+		ResultCacheHash:   task.resultCacheHash,
+		ResultCacheTaskID: task.resultCacheTaskID,
+		Supersedes:        task.supersedes,
+	}
+	// as in task.resolve
+	switch {
+	case task.StatusManager != nil && task.StatusManager.LastKnownStatus() == cancelled:
+		record.Result, record.Reason = "exception", "canceled"
+	case !errors.Occurred():
+	case (*errors)[0].TaskStatus == failed:
+		record.Result = "failed"
+	default:
+		record.Result, record.Reason = "exception", string((*errors)[0].Reason)
+	}
+	return record
+}
+
+// recordTaskHistory adds the given task run to the task history database,
+// unless config setting taskHistoryMaxRuns is 0. Problems are only logged,
+// since the history is not essential for running tasks.
+func recordTaskHistory(task *TaskRun, started time.Time, errors *ExecutionErrors) {
+	if config.TaskHistoryMaxRuns == 0 {
+		return
+	}
+	err := taskHistory.Add(newTaskHistoryRecord(task, started, errors), int(config.TaskHistoryMaxRuns))
+	if err != nil {
+		log.Printf("WARNING: Could not record task %v run %v in %v: %v", task.TaskID, task.RunID, taskHistory.file, err)
+	}
+}
+
+// Add appends the given record to the history, compacting it to the most
+// recent maxRuns records if it has grown to twice that
+func (history *TaskHistory) Add(record *TaskHistoryRecord, maxRuns int) error {
+	if !history.counted {
+		records, err := history.Records()
+		if err != nil {
+			return err
+		}
+		history.records, history.counted = len(records), true
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, statErr := os.Stat(history.file)
+	f, err := os.OpenFile(history.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if os.IsNotExist(statErr) {
+		err = fileutil.SecureFiles(history.file)
+		if err != nil {
+			return err
+		}
+	}
+	history.records++
+	if history.records < 2*maxRuns {
+		return nil
+	}
+	return history.compact(maxRuns)
+}
+
+// compact keeps only the most recent maxRuns records
+func (history *TaskHistory) compact(maxRuns int) error {
+	records, err := history.Records()
+	if err != nil {
+		return err
+	}
+	if len(records) > maxRuns {
+		records = records[len(records)-maxRuns:]
+	}
+	var content bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		content.Write(append(line, '\n'))
+	}
+	// replace the file in one step, so that readers never see a partial
+	// history
+	tempFile := history.file + ".tmp"
+	err = ioutil.WriteFile(tempFile, content.Bytes(), 0600)
+	if err == nil {
+		err = fileutil.SecureFiles(tempFile)
+	}
+	if err == nil {
+		err = os.Rename(tempFile, history.file)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile)
+		return err
+	}
+	history.records = len(records)
+	return nil
+}
+
+// Records returns all records of the history, oldest first. Lines that
+// cannot be read, such as a record that was being written when the worker
+// stopped, are skipped.
+func (history *TaskHistory) Records() ([]*TaskHistoryRecord, error) {
+	records := []*TaskHistoryRecord{}
+	f, err := os.Open(history.file)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	// mounts can make records long
+	scanner.Buffer(nil, 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		record := &TaskHistoryRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			log.Printf("WARNING: Skipping line %v of %v: %v", line, history.file, err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// Query returns the records that match the given filter, most recent first,
+// up to limit records, or all of them if limit is 0
+func (history *TaskHistory) Query(filter func(*TaskHistoryRecord) bool, limit int) ([]*TaskHistoryRecord, error) {
+	records, err := history.Records()
+	if err != nil {
+		return nil, err
+	}
+	matches := []*TaskHistoryRecord{}
+	for i := len(records) - 1; i >= 0 && (limit == 0 || len(matches) < limit); i-- {
+		if filter == nil || filter(records[i]) {
+			matches = append(matches, records[i])
+		}
+	}
+	return matches, nil
+}
+
+// queryTaskHistory writes the records of the task history database of the
+// worker in the current directory that match the given task ID and result,
+// if not empty, as a json array, most recent first, to stdout
+func queryTaskHistory(taskID, result, limit string) error {
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return fmt.Errorf("Invalid limit %q", limit)
+	}
+	records, err := taskHistory.Query(func(record *TaskHistoryRecord) bool {
+		return (taskID == "" || record.TaskID == taskID) && (result == "" || record.Result == result)
+	}, n)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTaskHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "task-history")
+	if err != nil {
+		t.Fatalf("Could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	history := &TaskHistory{
+		file: filepath.Join(dir, taskHistoryFile),
+	}
+	taskIDs := []string{"task-0", "task-1", "task-2", "task-3", "task-4", "task-5"}
+	results := []string{"completed", "failed", "completed", "exception", "completed"}
+	for i, result := range results {
+		record := &TaskHistoryRecord{
+			TaskID: taskIDs[i],
+			Result: result,
+		}
+		err := history.Add(record, 3)
+		if err != nil {
+			t.Fatalf("Could not add record %v: %v", i, err)
+		}
+	}
+
+	// not compacted until there are twice as many records as maxRuns
+	records, err := history.Records()
+	if err != nil {
+		t.Fatalf("Could not read records: %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expected 5 records, but got %v", len(records))
+	}
+
+	// a partially written record is skipped
+	f, err := os.OpenFile(history.file, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Could not open %v: %v", history.file, err)
+	}
+	_, err = f.WriteString(`{"taskId":"trunc` + "\n")
+	f.Close()
+	if err != nil {
+		t.Fatalf("Could not write to %v: %v", history.file, err)
+	}
+	completed, err := history.Query(func(record *TaskHistoryRecord) bool {
+		return record.Result == "completed"
+	}, 2)
+	if err != nil {
+		t.Fatalf("Could not query records: %v", err)
+	}
+	if len(completed) != 2 || completed[0].TaskID != taskIDs[4] || completed[1].TaskID != taskIDs[2] {
+		t.Fatalf("Expected the two most recent completed runs, most recent first, but got %#v", completed)
+	}
+
+	err = history.Add(&TaskHistoryRecord{TaskID: taskIDs[5], Result: "completed"}, 3)
+	if err != nil {
+		t.Fatalf("Could not add record: %v", err)
+	}
+	records, err = history.Records()
+	if err != nil {
+		t.Fatalf("Could not read records: %v", err)
+	}
+	if len(records) != 3 || records[0].TaskID != taskIDs[3] || records[2].TaskID != taskIDs[5] {
+		t.Fatalf("Expected history to be compacted to the 3 most recent records, but got %#v", records)
+	}
+}
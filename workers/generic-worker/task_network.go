@@ -0,0 +1,135 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+const taskNetworkArtifactName = "public/network-traffic.json"
+
+var taskNetworkPath = filepath.Join("generic-worker", "network-traffic.json")
+
+// TaskNetworkFeature runs the commands of each task in a network namespace of
+// its own, with NAT to the network of the host (see config setting
+// taskNetworkNamespace), and records the network traffic of the task, so that
+// tasks that hammer external services can be detected
+type TaskNetworkFeature struct {
+}
+
+// TaskNetworkTraffic is the network traffic of a task, as published in
+// artifact public/network-traffic.json
+type TaskNetworkTraffic struct {
+	// bytes received by the task
+	BytesIn uint64 `json:"bytesIn"`
+	// bytes sent by the task
+	BytesOut uint64 `json:"bytesOut"`
+}
+
+func (feature *TaskNetworkFeature) Name() string {
+	return "Task Network"
+}
+
+func (feature *TaskNetworkFeature) Initialise() error {
+	if !config.TaskNetworkNamespace {
+		return nil
+	}
+	return initialiseTaskNetwork()
+}
+
+func (feature *TaskNetworkFeature) PersistState() error {
+	return nil
+}
+
+// IsEnabled returns whether the task gets a network namespace, which is only
+// needed if the task has network access at all (see DisableNetworkFeature)
+func (feature *TaskNetworkFeature) IsEnabled(task *TaskRun) bool {
+	return config.TaskNetworkNamespace && !networkDisabled(task) && (config.TaskIsolation == "" || task.Payload.Features.Network)
+}
+
+type TaskNetworkTask struct {
+	task *TaskRun
+	// nil until the network namespace has been created
+	network *taskNetwork
+}
+
+func (feature *TaskNetworkFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskNetworkTask{
+		task: task,
+	}
+}
+
+func (tn *TaskNetworkTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (tn *TaskNetworkTask) ReservedArtifacts() []string {
+	return []string{
+		taskNetworkArtifactName,
+	}
+}
+
+func (tn *TaskNetworkTask) Start() *CommandExecutionError {
+	network, err := newTaskNetwork()
+	if err != nil {
+		return executionError(internalError, errored, fmt.Errorf("[network] Could not create network namespace for task: %v", err))
+	}
+	tn.network = network
+	for _, c := range tn.task.Commands {
+		network.wrap(c.Cmd)
+	}
+	tn.task.Infof("[network] Running task commands in network namespace %v", network.namespace)
+	return nil
+}
+
+func (tn *TaskNetworkTask) Stop(err *ExecutionErrors) {
+	if tn.network == nil {
+		return
+	}
+	traffic, e := tn.network.traffic()
+	if e != nil {
+		tn.task.Warnf("[network] Could not read network traffic of task: %v", e)
+	}
+	if e := tn.network.remove(); e != nil {
+		tn.task.Warnf("[network] Could not remove network namespace %v: %v", tn.network.namespace, e)
+	}
+	if traffic == nil {
+		return
+	}
+	tn.task.Infof("[network] Task received %v bytes and sent %v bytes", traffic.BytesIn, traffic.BytesOut)
+	logEventWithFields("taskNetworkTraffic", tn.task, time.Now(), map[string]interface{}{
+		"bytesIn":  traffic.BytesIn,
+		"bytesOut": traffic.BytesOut,
+	})
+	data, e := json.MarshalIndent(traffic, "", "  ")
+	if e != nil {
+		panic(e)
+	}
+	file := filepath.Join(taskContext.TaskDir, taskNetworkPath)
+	e = os.MkdirAll(filepath.Dir(file), 0700)
+	if e != nil {
+		panic(e)
+	}
+	e = ioutil.WriteFile(file, data, 0644)
+	if e != nil {
+		panic(e)
+	}
+	err.add(tn.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    taskNetworkArtifactName,
+				Expires: tn.task.Definition.Expires,
+			},
+			ContentType:     "application/json; charset=utf-8",
+			ContentEncoding: "gzip",
+			Path:            taskNetworkPath,
+		},
+	))
+}
@@ -0,0 +1,267 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+)
+
+const (
+	// only one task runs at a time, so the names of the network namespace
+	// and of the veth pair that connects it to the host can be fixed
+	taskNetworkNamespace     = "generic-worker-task"
+	taskNetworkHostInterface = "gw-task-host"
+	taskNetworkTaskInterface = "gw-task"
+)
+
+var (
+	ipCommand       string
+	iptablesCommand string
+	// only needed for commands that run as a different user
+	setprivCommand string
+)
+
+// taskNetwork is the network namespace of a task, connected to the host by a
+// veth pair, with NAT to the network of the host, unless network access of
+// the task is disabled
+type taskNetwork struct {
+	namespace string
+	// if true, the network namespace has no connection to the host (see
+	// disable_network_linux.go)
+	disabled      bool
+	hostInterface string
+	taskInterface string
+	subnet        string
+	hostAddress   string
+	taskAddress   string
+}
+
+func initialiseTaskNetwork() (err error) {
+	if config.TaskIsolation == qemuIsolation {
+		return fmt.Errorf("Config setting taskNetworkNamespace is not supported when taskIsolation is %q, since QEMU VMs have their own network", qemuIsolation)
+	}
+	if _, _, err = taskNetworkAddresses(config.TaskNetworkSubnet); err != nil {
+		return err
+	}
+	err = findNetworkNamespaceTools()
+	if err != nil {
+		return fmt.Errorf("Config setting taskNetworkNamespace is enabled, but %v", err)
+	}
+	// for NAT between the network namespace and the network of the host
+	err = ioutil.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not enable IP forwarding for config setting taskNetworkNamespace: %v", err)
+	}
+	return nil
+}
+
+// findNetworkNamespaceTools checks that network namespaces can be created,
+// and finds the commands that create them
+func findNetworkNamespaceTools() (err error) {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("network namespaces require generic-worker to run as root")
+	}
+	ipCommand, err = exec.LookPath("ip")
+	if err != nil {
+		return fmt.Errorf("ip (iproute2) is not installed: %v", err)
+	}
+	iptablesCommand, err = exec.LookPath("iptables")
+	if err != nil {
+		return fmt.Errorf("iptables is not installed: %v", err)
+	}
+	if engine == "multiuser" {
+		setprivCommand, err = exec.LookPath("setpriv")
+		if err != nil {
+			return fmt.Errorf("setpriv (util-linux) is not installed: %v", err)
+		}
+	}
+	return nil
+}
+
+// taskNetworkAddresses returns the addresses, in CIDR notation, of the host
+// end and the task end of the veth pair in the given IPv4 subnet, which are
+// the first two addresses of the subnet
+func taskNetworkAddresses(subnet string) (hostAddress, taskAddress string, err error) {
+	ip, ipNet, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return "", "", fmt.Errorf("Config setting taskNetworkSubnet %q is not a valid subnet: %v", subnet, err)
+	}
+	ones, bits := ipNet.Mask.Size()
+	if ip.To4() == nil || bits != 32 || ones > 30 {
+		return "", "", fmt.Errorf("Config setting taskNetworkSubnet %q must be an IPv4 subnet of at least 4 addresses (/30)", subnet)
+	}
+	address := func(offset byte) string {
+		a := append(net.IP{}, ipNet.IP.To4()...)
+		a[3] += offset
+		return a.String() + "/" + strconv.Itoa(ones)
+	}
+	return address(1), address(2), nil
+}
+
+func newTaskNetwork() (*taskNetwork, error) {
+	hostAddress, taskAddress, err := taskNetworkAddresses(config.TaskNetworkSubnet)
+	if err != nil {
+		return nil, err
+	}
+	network := &taskNetwork{
+		namespace:     taskNetworkNamespace,
+		hostInterface: taskNetworkHostInterface,
+		taskInterface: taskNetworkTaskInterface,
+		subnet:        config.TaskNetworkSubnet,
+		hostAddress:   hostAddress,
+		taskAddress:   taskAddress,
+	}
+	// left behind if the worker didn't stop cleanly
+	if _, err := os.Stat(filepath.Join("/run/netns", network.namespace)); err == nil {
+		_ = network.remove()
+	}
+	err = network.writeResolvConf()
+	if err == nil {
+		err = host.RunBatch(false, network.setupCommands()...)
+	}
+	if err != nil {
+		_ = network.remove()
+		return nil, err
+	}
+	return network, nil
+}
+
+// setupCommands returns the commands that create the network namespace
+func (network *taskNetwork) setupCommands() [][]string {
+	inNamespace := func(command ...string) []string {
+		return append([]string{ipCommand, "netns", "exec", network.namespace}, command...)
+	}
+	hostIP := strings.Split(network.hostAddress, "/")[0]
+	return [][]string{
+		{ipCommand, "netns", "add", network.namespace},
+		{ipCommand, "link", "add", network.hostInterface, "type", "veth", "peer", "name", network.taskInterface},
+		{ipCommand, "link", "set", network.taskInterface, "netns", network.namespace},
+		{ipCommand, "addr", "add", network.hostAddress, "dev", network.hostInterface},
+		{ipCommand, "link", "set", network.hostInterface, "up"},
+		inNamespace(ipCommand, "link", "set", "lo", "up"),
+		inNamespace(ipCommand, "addr", "add", network.taskAddress, "dev", network.taskInterface),
+		inNamespace(ipCommand, "link", "set", network.taskInterface, "up"),
+		inNamespace(ipCommand, "route", "add", "default", "via", hostIP),
+		append([]string{iptablesCommand, "-t", "nat", "-A"}, network.natRule()...),
+		append([]string{iptablesCommand, "-I"}, network.forwardOutRule()...),
+		append([]string{iptablesCommand, "-I"}, network.forwardInRule()...),
+	}
+}
+
+func (network *taskNetwork) natRule() []string {
+	return []string{"POSTROUTING", "-s", network.subnet, "!", "-o", network.hostInterface, "-j", "MASQUERADE"}
+}
+
+func (network *taskNetwork) forwardOutRule() []string {
+	return []string{"FORWARD", "-i", network.hostInterface, "-j", "ACCEPT"}
+}
+
+func (network *taskNetwork) forwardInRule() []string {
+	return []string{"FORWARD", "-o", network.hostInterface, "-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "ACCEPT"}
+}
+
+// writeResolvConf gives the network namespace the upstream DNS servers of
+// systemd-resolved, if it is used, since its stub resolver on 127.0.0.53 is
+// not reachable from the network namespace. `ip netns exec` bind mounts the
+// file over /etc/resolv.conf.
+func (network *taskNetwork) writeResolvConf() error {
+	resolvConf, err := ioutil.ReadFile("/run/systemd/resolve/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Join("/etc/netns", network.namespace)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "resolv.conf"), resolvConf, 0644)
+}
+
+// wrap makes the given command run in the network namespace. Entering the
+// network namespace requires root, so if the command runs as a different
+// user, setpriv switches to the user once inside it.
+func (network *taskNetwork) wrap(cmd *exec.Cmd) {
+	args := []string{ipCommand, "netns", "exec", network.namespace}
+	if cmd.SysProcAttr != nil && cmd.SysProcAttr.Credential != nil {
+		// the SysProcAttr may be shared with other commands of the task
+		sysProcAttr := *cmd.SysProcAttr
+		args = append(args, setprivArgs(setprivCommand, sysProcAttr.Credential)...)
+		sysProcAttr.Credential = nil
+		cmd.SysProcAttr = &sysProcAttr
+	}
+	cmd.Args = append(append(args, cmd.Path), cmd.Args[1:]...)
+	cmd.Path = ipCommand
+}
+
+// setprivArgs returns the setpriv command line (up to, but not including, the
+// command to run) that runs a command with the given credential
+func setprivArgs(setpriv string, credential *syscall.Credential) []string {
+	args := []string{
+		setpriv,
+		"--reuid=" + strconv.Itoa(int(credential.Uid)),
+		"--regid=" + strconv.Itoa(int(credential.Gid)),
+	}
+	if len(credential.Groups) == 0 {
+		args = append(args, "--clear-groups")
+	} else {
+		groups := make([]string, len(credential.Groups))
+		for i, gid := range credential.Groups {
+			groups[i] = strconv.Itoa(int(gid))
+		}
+		args = append(args, "--groups="+strings.Join(groups, ","))
+	}
+	return append(args, "--")
+}
+
+// traffic returns the network traffic of the task so far, from the
+// statistics of the host end of the veth pair, which receives what the task
+// sends, and vice versa
+func (network *taskNetwork) traffic() (*TaskNetworkTraffic, error) {
+	statistic := func(name string) (uint64, error) {
+		data, err := ioutil.ReadFile(filepath.Join("/sys/class/net", network.hostInterface, "statistics", name))
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+	bytesIn, err := statistic("tx_bytes")
+	if err != nil {
+		return nil, err
+	}
+	bytesOut, err := statistic("rx_bytes")
+	if err != nil {
+		return nil, err
+	}
+	return &TaskNetworkTraffic{
+		BytesIn:  bytesIn,
+		BytesOut: bytesOut,
+	}, nil
+}
+
+// remove deletes the network namespace, together with the veth pair and
+// firewall rules. Any processes of the task that are still running lose
+// their network.
+func (network *taskNetwork) remove() error {
+	if network.disabled {
+		return host.Run(ipCommand, "netns", "delete", network.namespace)
+	}
+	return host.RunBatch(
+		true,
+		append([]string{iptablesCommand, "-D"}, network.forwardInRule()...),
+		append([]string{iptablesCommand, "-D"}, network.forwardOutRule()...),
+		append([]string{iptablesCommand, "-t", "nat", "-D"}, network.natRule()...),
+		// deleting one end of a veth pair deletes both ends
+		[]string{ipCommand, "link", "delete", network.hostInterface},
+		[]string{ipCommand, "netns", "delete", network.namespace},
+	)
+}
@@ -0,0 +1,102 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestTaskNetworkAddresses(t *testing.T) {
+	hostAddress, taskAddress, err := taskNetworkAddresses("10.254.254.0/30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hostAddress != "10.254.254.1/30" || taskAddress != "10.254.254.2/30" {
+		t.Errorf("Was expecting addresses 10.254.254.1/30 and 10.254.254.2/30 but got %v and %v", hostAddress, taskAddress)
+	}
+	for _, subnet := range []string{"10.254.254.0/31", "fd00::/64", "10.254.254.0"} {
+		if _, _, err := taskNetworkAddresses(subnet); err == nil {
+			t.Errorf("Was expecting subnet %v to be rejected", subnet)
+		}
+	}
+}
+
+func TestTaskNetworkWrap(t *testing.T) {
+	oldIPCommand, oldSetprivCommand := ipCommand, setprivCommand
+	ipCommand, setprivCommand = "/sbin/ip", "/usr/bin/setpriv"
+	defer func() {
+		ipCommand, setprivCommand = oldIPCommand, oldSetprivCommand
+	}()
+	network := &taskNetwork{
+		namespace: taskNetworkNamespace,
+	}
+	// commands of a task share the SysProcAttr of the task user
+	sysProcAttr := &syscall.SysProcAttr{
+		Credential: &syscall.Credential{
+			Uid:    1001,
+			Gid:    1002,
+			Groups: []uint32{20, 30},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		cmd := exec.Command("/bin/echo", "hello")
+		cmd.SysProcAttr = sysProcAttr
+		network.wrap(cmd)
+		expected := []string{"/sbin/ip", "netns", "exec", "generic-worker-task", "/usr/bin/setpriv", "--reuid=1001", "--regid=1002", "--groups=20,30", "--", "/bin/echo", "hello"}
+		if cmd.Path != "/sbin/ip" || !reflect.DeepEqual(cmd.Args, expected) {
+			t.Errorf("Was expecting command %v to be %q but got %v %q", i, expected, cmd.Path, cmd.Args)
+		}
+		if cmd.SysProcAttr.Credential != nil {
+			t.Errorf("Was expecting command %v to start as root, in order to enter the network namespace", i)
+		}
+	}
+	cmd := exec.Command("/bin/echo", "hello")
+	network.wrap(cmd)
+	if args := strings.Join(cmd.Args, " "); args != "/sbin/ip netns exec generic-worker-task /bin/echo hello" {
+		t.Errorf("Unexpected command %q", args)
+	}
+}
+
+func TestTaskNetworkSetupCommands(t *testing.T) {
+	oldIPCommand, oldIPTablesCommand := ipCommand, iptablesCommand
+	ipCommand, iptablesCommand = "ip", "iptables"
+	defer func() {
+		ipCommand, iptablesCommand = oldIPCommand, oldIPTablesCommand
+	}()
+	network := &taskNetwork{
+		namespace:     taskNetworkNamespace,
+		hostInterface: taskNetworkHostInterface,
+		taskInterface: taskNetworkTaskInterface,
+		subnet:        "10.254.254.0/30",
+		hostAddress:   "10.254.254.1/30",
+		taskAddress:   "10.254.254.2/30",
+	}
+	commands := []string{}
+	for _, command := range network.setupCommands() {
+		commands = append(commands, strings.Join(command, " "))
+	}
+	for _, expected := range []string{
+		"ip netns add generic-worker-task",
+		"ip link add gw-task-host type veth peer name gw-task",
+		"ip netns exec generic-worker-task ip route add default via 10.254.254.1",
+		"iptables -t nat -A POSTROUTING -s 10.254.254.0/30 ! -o gw-task-host -j MASQUERADE",
+	} {
+		found := false
+		for _, command := range commands {
+			found = found || command == expected
+		}
+		if !found {
+			t.Errorf("Was expecting setup command %q, but got %q", expected, commands)
+		}
+	}
+	for _, name := range []string{taskNetworkHostInterface, taskNetworkTaskInterface} {
+		// IFNAMSIZ - 1
+		if len(name) > 15 {
+			t.Errorf("Interface name %v is too long", name)
+		}
+	}
+}
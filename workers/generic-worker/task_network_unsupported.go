@@ -0,0 +1,32 @@
+// +build darwin,multiuser darwin,simple freebsd,simple
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+type taskNetwork struct {
+	namespace string
+}
+
+func initialiseTaskNetwork() error {
+	return fmt.Errorf("Config setting taskNetworkNamespace is not supported on %v", runtime.GOOS)
+}
+
+func newTaskNetwork() (*taskNetwork, error) {
+	return nil, fmt.Errorf("Network namespaces are not supported on %v", runtime.GOOS)
+}
+
+func (network *taskNetwork) wrap(cmd *exec.Cmd) {
+}
+
+func (network *taskNetwork) traffic() (*TaskNetworkTraffic, error) {
+	return nil, fmt.Errorf("Network namespaces are not supported on %v", runtime.GOOS)
+}
+
+func (network *taskNetwork) remove() error {
+	return nil
+}
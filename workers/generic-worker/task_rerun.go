@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/process"
+)
+
+// validateRerunPolicy checks that task.payload.rerun has at least one failure
+// signature, and compiles its log patterns
+func (task *TaskRun) validateRerunPolicy() *CommandExecutionError {
+	policy := task.Payload.Rerun
+	if policy.MaxReruns == 0 {
+		return nil
+	}
+	if len(policy.ExitCodes) == 0 && len(policy.LogPatterns) == 0 {
+		return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.rerun needs exitCodes or logPatterns, so that intermittent failures can be recognised"))
+	}
+	task.rerunPatterns = make([]*regexp.Regexp, len(policy.LogPatterns))
+	for i, pattern := range policy.LogPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("Malformed payload: task.payload.rerun.logPatterns contains invalid regular expression %q: %v", pattern, err))
+		}
+		task.rerunPatterns[i] = re
+	}
+	return nil
+}
+
+// executeCommands executes the task commands, and reruns all of them if
+// they fail with a failure signature of task.payload.rerun, returning the
+// error of the final attempt
+func (task *TaskRun) executeCommands() *CommandExecutionError {
+	maxAttempts := task.Payload.Rerun.MaxReruns + 1
+	var failedResult *process.Result
+	if maxAttempts > 1 {
+		task.afterCommand = append(task.afterCommand, func(index int, result *process.Result) {
+			failedResult = nil
+			if result.Failed() {
+				failedResult = result
+			}
+		})
+	}
+	for attempt := int64(1); ; attempt++ {
+		logOffset := task.logSize()
+		if maxAttempts > 1 {
+			task.Infof("=== Task Attempt %v of %v ===", attempt, maxAttempts)
+		}
+		var cee *CommandExecutionError
+		for i := range task.Payload.Command {
+			if cee = task.ExecuteCommand(i); cee != nil {
+				break
+			}
+		}
+		if cee == nil || cee.TaskStatus != failed || failedResult == nil || attempt >= maxAttempts || task.StatusManager.AbortException() != nil {
+			return cee
+		}
+		signature := task.failureSignature(int64(failedResult.ExitCode()), logOffset)
+		if signature == "" {
+			return cee
+		}
+		task.Warnf("=== Task Attempt %v of %v Failed ===", attempt, maxAttempts)
+		task.Warnf("Task failed with intermittent failure signature %v - rerunning task commands", signature)
+		logEventWithFields("taskRerun", task, time.Now(), map[string]interface{}{
+			"attempt":     attempt,
+			"maxAttempts": maxAttempts,
+			"signature":   signature,
+		})
+		for _, command := range task.Commands {
+			command.Reset()
+		}
+	}
+}
+
+// failureSignature returns a description of the failure signature of
+// task.payload.rerun that a failed attempt of the task commands matches, or
+// "" if it doesn't match any. logOffset is the size of the task log when the
+// attempt started.
+func (task *TaskRun) failureSignature(exitCode int64, logOffset int64) string {
+	for _, code := range task.Payload.Rerun.ExitCodes {
+		if exitCode == code {
+			return fmt.Sprintf("exit code %v", exitCode)
+		}
+	}
+	if len(task.rerunPatterns) == 0 {
+		return ""
+	}
+	file, err := os.Open(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		task.Warnf("Could not read task log to check for intermittent failures: %v", err)
+		return ""
+	}
+	defer file.Close()
+	if _, err = file.Seek(logOffset, 0); err != nil {
+		task.Warnf("Could not read task log to check for intermittent failures: %v", err)
+		return ""
+	}
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		for _, re := range task.rerunPatterns {
+			if re.MatchString(line) {
+				return fmt.Sprintf("log pattern %q", re.String())
+			}
+		}
+		if err != nil {
+			return ""
+		}
+	}
+}
+
+// logSize returns the number of bytes written to the task log so far
+func (task *TaskRun) logSize() int64 {
+	info, err := os.Stat(filepath.Join(taskContext.TaskDir, logPath))
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
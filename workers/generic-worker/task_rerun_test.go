@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRerunFailureSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: dir,
+	}
+	defer func() {
+		taskContext = oldTaskContext
+	}()
+	err = os.MkdirAll(filepath.Dir(filepath.Join(dir, logPath)), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstAttempt := "connection reset by peer\r\nexit status 1\n"
+	err = ioutil.WriteFile(filepath.Join(dir, logPath), []byte(firstAttempt+"test failed\nexit status 1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task := &TaskRun{
+		rerunPatterns: []*regexp.Regexp{regexp.MustCompile(`^connection reset by peer$`)},
+	}
+	task.Payload.Rerun.ExitCodes = []int64{75}
+	if signature := task.failureSignature(75, 0); signature != "exit code 75" {
+		t.Fatalf("Was expecting exit code 75 to be a failure signature, but got %q", signature)
+	}
+	if signature := task.failureSignature(1, 0); signature != `log pattern "^connection reset by peer$"` {
+		t.Fatalf("Was expecting log pattern to be a failure signature, but got %q", signature)
+	}
+	// only the log of the failed attempt counts
+	if signature := task.failureSignature(1, int64(len(firstAttempt))); signature != "" {
+		t.Fatalf("Was not expecting a failure signature in log of second attempt, but got %q", signature)
+	}
+}
+
+func TestRerunOnExitCode(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(123),
+		MaxRunTime: 30,
+		Rerun: TaskRerunPolicy{
+			MaxReruns: 2,
+			ExitCodes: []int64{123},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	logtext := retryTestLog(t)
+	for _, expected := range []string{
+		"=== Task Attempt 1 of 3 ===",
+		"=== Task Attempt 2 of 3 ===",
+		"=== Task Attempt 3 of 3 ===",
+		"Task failed with intermittent failure signature exit code 123 - rerunning task commands",
+	} {
+		if !strings.Contains(logtext, expected) {
+			t.Fatalf("Was expecting log to contain %q but it doesn't:\n%v", expected, logtext)
+		}
+	}
+	if strings.Contains(logtext, "Attempt 3 of 3 Failed") {
+		t.Fatalf("Was expecting task commands to be run at most 3 times, but log says otherwise:\n%v", logtext)
+	}
+}
+
+func TestRerunOnLogPattern(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    append(helloGoodbye()[:1], returnExitCode(1)...),
+		MaxRunTime: 30,
+		Rerun: TaskRerunPolicy{
+			MaxReruns:   1,
+			LogPatterns: []string{`hello w.rld`},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	if logtext := retryTestLog(t); !strings.Contains(logtext, `Task failed with intermittent failure signature log pattern "hello w.rld"`) {
+		t.Fatalf("Was expecting task commands to be rerun because of log pattern, but they weren't:\n%v", logtext)
+	}
+}
+
+func TestRerunIgnoresOtherFailures(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(456),
+		MaxRunTime: 30,
+		Rerun: TaskRerunPolicy{
+			MaxReruns:   2,
+			ExitCodes:   []int64{123},
+			LogPatterns: []string{`no such pattern`},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "failed", "failed")
+
+	if logtext := retryTestLog(t); strings.Contains(logtext, "rerunning") || strings.Contains(logtext, "Attempt 2 of 3") {
+		t.Fatalf("Was not expecting task with exit code 456 to be rerun:\n%v", logtext)
+	}
+}
+
+func TestRerunWithoutFailureSignatures(t *testing.T) {
+	defer setup(t)()
+	payload := GenericWorkerPayload{
+		Command:    returnExitCode(0),
+		MaxRunTime: 30,
+		Rerun: TaskRerunPolicy{
+			MaxReruns: 1,
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
@@ -0,0 +1,126 @@
+// +build multiuser
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+// taskUserName matches the names of the task users that the worker creates,
+// see PlatformTaskEnvironmentSetup
+var taskUserName = regexp.MustCompile(`^task_[0-9]+$`)
+
+// taskUserOfDir returns the task user that the given task directory, home
+// directory or profile directory belongs to, or "" if it doesn't belong to a
+// task user. Profile directories can have a suffix, e.g. task_1234.000 or
+// task_1234.HOSTNAME.
+func taskUserOfDir(dirName string) string {
+	name := strings.SplitN(dirName, ".", 2)[0]
+	if !taskUserName.MatchString(name) {
+		return ""
+	}
+	return name
+}
+
+// protectedTaskUsers returns the task users that must not be deleted: the
+// user of the current task environment, the user that the worker logs in to
+// after the next reboot, and the users of the task user credential files
+func protectedTaskUsers() map[string]bool {
+	protected := map[string]bool{
+		runtime.AutoLogonUser(): true,
+	}
+	if taskContext != nil && taskContext.User != nil {
+		protected[taskContext.User.Name] = true
+	}
+	for _, credsFile := range []string{"current-task-user.json", "next-task-user.json"} {
+		b, err := ioutil.ReadFile(credsFile)
+		if err != nil {
+			continue
+		}
+		var user runtime.OSUser
+		if err := json.Unmarshal(b, &user); err == nil {
+			protected[user.Name] = true
+		}
+	}
+	delete(protected, "")
+	return protected
+}
+
+// collectOrphanedTaskUsers deletes the task users, and the task directories,
+// home directories and user profiles of task users, that are left over from
+// previous tasks, including those of worker runs that crashed. Only users and
+// directories named like task users, that are not protected, are deleted.
+// The number deleted is reported in the orphanedTaskUsersCollected metric.
+// It runs (via purgeOldTasks) when the worker starts, after each task, and
+// periodically while the worker is idle.
+func collectOrphanedTaskUsers() error {
+	log.Print("Looking for existing task users to delete...")
+	protected := protectedTaskUsers()
+	orphaned := func(name string) bool {
+		return name != "" && !protected[name]
+	}
+	allErrors := []string{}
+	users := 0
+	userAccounts, err := runtime.ListUserAccounts()
+	if err != nil {
+		allErrors = append(allErrors, fmt.Sprintf("Could not list user accounts: %v", err))
+	}
+	for _, username := range userAccounts {
+		if !taskUserName.MatchString(username) || !orphaned(username) {
+			continue
+		}
+		log.Print("Attempting to remove user " + username + "...")
+		err := runtime.DeleteUser(username)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Could not remove user account %v: %v", username, err))
+			continue
+		}
+		users++
+	}
+	directories := 0
+	for _, parentDir := range []string{runtime.UserHomeDirectoriesParent(), config.TasksDir} {
+		taskDirs, err := taskDirsIn(parentDir)
+		if err != nil {
+			allErrors = append(allErrors, fmt.Sprintf("Could not read directory %v: %v", parentDir, err))
+			continue
+		}
+		for _, taskDir := range taskDirs {
+			if !orphaned(taskUserOfDir(filepath.Base(taskDir))) {
+				continue
+			}
+			err := deleteDir(taskDir)
+			if err != nil {
+				allErrors = append(allErrors, fmt.Sprintf("Could not delete directory %v: %v", taskDir, err))
+				continue
+			}
+			directories++
+		}
+	}
+	profiles, err := runtime.DeleteOrphanedProfiles(func(profileDirName string) bool {
+		return orphaned(taskUserOfDir(profileDirName))
+	})
+	if err != nil {
+		allErrors = append(allErrors, err.Error())
+	}
+	if users+directories+profiles > 0 || len(allErrors) > 0 {
+		logEventWithFields("orphanedTaskUsersCollected", nil, time.Now(), map[string]interface{}{
+			"users":       users,
+			"directories": directories,
+			"profiles":    profiles,
+			"failures":    len(allErrors),
+		})
+	}
+	if len(allErrors) > 0 {
+		return fmt.Errorf("%v", strings.Join(allErrors, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// +build multiuser
+
+package main
+
+import (
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+func TestTaskUserOfDir(t *testing.T) {
+	for dirName, expected := range map[string]string{
+		"task_1234567890":          "task_1234567890",
+		"task_1234567890.000":      "task_1234567890",
+		"task_1234567890.HOSTNAME": "task_1234567890",
+		"task_":                    "",
+		"task_abc":                 "",
+		"task_1234567890x":         "",
+		"mytask_1234567890":        "",
+		"Administrator":            "",
+	} {
+		if actual := taskUserOfDir(dirName); actual != expected {
+			t.Errorf("Expected directory %q to belong to task user %q, but got %q", dirName, expected, actual)
+		}
+	}
+}
+
+func TestProtectedTaskUsers(t *testing.T) {
+	defer func(tc *TaskContext) {
+		taskContext = tc
+	}(taskContext)
+	taskContext = &TaskContext{}
+	if protected := protectedTaskUsers(); protected[""] {
+		t.Fatalf("Empty username should not be protected: %v", protected)
+	}
+	taskContext = &TaskContext{
+		User: &runtime.OSUser{
+			Name: "task_1234567890",
+		},
+	}
+	if protected := protectedTaskUsers(); !protected["task_1234567890"] {
+		t.Fatalf("Expected user of current task environment to be protected, but got %v", protected)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/win32"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// TaskUserPolicyFeature validates the task user policy config settings
+// (taskUserGroups, taskUserPasswordLength, taskUserProfilesDir and
+// taskUserRights) when the worker starts, so that a policy that can't be
+// applied fails the worker before it claims tasks, rather than when the next
+// task user is created. It doesn't do anything for individual tasks.
+type TaskUserPolicyFeature struct {
+}
+
+func (feature *TaskUserPolicyFeature) Name() string {
+	return "Task User Policy"
+}
+
+func (feature *TaskUserPolicyFeature) Initialise() error {
+	minLength, err := win32.MinimumPasswordLength()
+	if err != nil {
+		return fmt.Errorf("could not query minimum password length of local security policy: %v", err)
+	}
+	if length := passwordLength(); length < int(minLength) {
+		return fmt.Errorf("config setting taskUserPasswordLength is %v, but the local security policy requires passwords of at least %v characters", length, minLength)
+	}
+	for _, group := range config.TaskUserGroups {
+		if _, err := host.CombinedOutput("net", "localgroup", group); err != nil {
+			return fmt.Errorf("group %q of config setting taskUserGroups does not exist: %v", group, err)
+		}
+	}
+	for _, right := range config.TaskUserRights {
+		if !win32.ValidUserRight(right) {
+			return fmt.Errorf("%q of config setting taskUserRights is not a user right", right)
+		}
+	}
+	if config.TaskUserProfilesDir != "" {
+		err = setProfilesDirectory(config.TaskUserProfilesDir)
+		if err != nil {
+			return fmt.Errorf("could not set profiles directory to %v (config setting taskUserProfilesDir): %v", config.TaskUserProfilesDir, err)
+		}
+	}
+	return nil
+}
+
+func (feature *TaskUserPolicyFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TaskUserPolicyFeature) IsEnabled(task *TaskRun) bool {
+	return false
+}
+
+func (feature *TaskUserPolicyFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TaskUserPolicyTask{}
+}
+
+type TaskUserPolicyTask struct {
+}
+
+func (tupt *TaskUserPolicyTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (tupt *TaskUserPolicyTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (tupt *TaskUserPolicyTask) Start() *CommandExecutionError {
+	return nil
+}
+
+func (tupt *TaskUserPolicyTask) Stop(err *ExecutionErrors) {
+}
+
+// passwordLength returns the length of the passwords that
+// runtime.GeneratePassword generates for task users
+func passwordLength() int {
+	if length := int(config.TaskUserPasswordLength); length > runtime.MinPasswordLength {
+		return length
+	}
+	return runtime.MinPasswordLength
+}
+
+// setProfilesDirectory sets the directory that Windows creates the profiles of
+// new users in, which takes effect for users who haven't yet logged in
+func setProfilesDirectory(dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	k, _, err := registry.CreateKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows NT\CurrentVersion\ProfileList`, registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+	return k.SetExpandStringValue("ProfilesDirectory", dir)
+}
+
+// applyTaskUserPolicy adds a newly created task user to the groups of config
+// setting taskUserGroups, and assigns it the user rights of config setting
+// taskUserRights. This must happen before the user first logs in, since group
+// memberships and user rights are only included in new logon sessions.
+func applyTaskUserPolicy(user *runtime.OSUser) error {
+	for _, group := range config.TaskUserGroups {
+		_, err := host.RunIgnoreError("The specified account name is already a member of the group", "net", "localgroup", group, user.Name, "/add")
+		if err != nil {
+			return fmt.Errorf("could not add task user %v to group %v: %v", user.Name, group, err)
+		}
+	}
+	if len(config.TaskUserRights) == 0 {
+		return nil
+	}
+	sid, _, _, err := windows.LookupSID("", user.Name)
+	if err != nil {
+		return fmt.Errorf("could not look up SID of task user %v: %v", user.Name, err)
+	}
+	err = win32.AddAccountRights(sid, config.TaskUserRights)
+	if err != nil {
+		return fmt.Errorf("could not assign user rights %v to task user %v: %v", config.TaskUserRights, user.Name, err)
+	}
+	log.Printf("Assigned user rights %v to task user %v", config.TaskUserRights, user.Name)
+	return nil
+}
@@ -0,0 +1,105 @@
+// +build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+func TestPasswordLength(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	for configured, expected := range map[uint]int{
+		0:                                   runtime.MinPasswordLength,
+		uint(runtime.MinPasswordLength - 1): runtime.MinPasswordLength,
+		64:                                  64,
+	} {
+		config.TaskUserPasswordLength = configured
+		if length := passwordLength(); length != expected {
+			t.Errorf("Was expecting taskUserPasswordLength %v to give passwords of length %v, but got %v", configured, expected, length)
+		}
+	}
+}
+
+func TestTaskUserPolicyValidation(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() { config = nil }()
+	feature := &TaskUserPolicyFeature{}
+	if err := feature.Initialise(); err != nil {
+		t.Fatalf("Was expecting an empty task user policy to be valid, but got: %v", err)
+	}
+	for _, test := range []struct {
+		groups []string
+		rights []string
+		err    string
+	}{
+		{[]string{"no-such-group-for-generic-worker"}, nil, "does not exist"},
+		{nil, []string{"SeNoSuchRight"}, "is not a user right"},
+	} {
+		config.TaskUserGroups = test.groups
+		config.TaskUserRights = test.rights
+		err := feature.Initialise()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("Was expecting groups %v and rights %v to fail with %q, but got: %v", test.groups, test.rights, test.err, err)
+		}
+	}
+	config.TaskUserGroups = []string{"Users"}
+	config.TaskUserRights = []string{"SeBatchLogonRight", "SeIncreaseWorkingSetPrivilege"}
+	if err := feature.Initialise(); err != nil {
+		t.Fatalf("Was expecting task user policy to be valid, but got: %v", err)
+	}
+}
+
+func TestApplyTaskUserPolicy(t *testing.T) {
+	suffix := time.Now().UnixNano() % 1000000
+	group := fmt.Sprintf("gw_policy_%v", suffix)
+	_, err := host.CombinedOutput("net", "localgroup", group, "/add")
+	if err != nil {
+		t.Fatalf("Could not create group %v: %v", group, err)
+	}
+	defer func() {
+		_, _ = host.CombinedOutput("net", "localgroup", group, "/delete")
+	}()
+	user := &runtime.OSUser{
+		Name:     fmt.Sprintf("gw_policy_user_%v", suffix),
+		Password: runtime.GeneratePassword(runtime.MinPasswordLength),
+	}
+	err = user.CreateNew(false)
+	if err != nil {
+		t.Fatalf("Could not create user %v: %v", user.Name, err)
+	}
+	defer func() {
+		_ = runtime.DeleteUser(user.Name)
+	}()
+
+	config = &gwconfig.Config{
+		PublicConfig: gwconfig.PublicConfig{
+			TaskUserGroups: []string{group},
+			TaskUserRights: []string{"SeBatchLogonRight"},
+		},
+	}
+	defer func() { config = nil }()
+	err = applyTaskUserPolicy(user)
+	if err != nil {
+		t.Fatalf("Could not apply task user policy: %v", err)
+	}
+	// applying the policy again is harmless
+	err = applyTaskUserPolicy(user)
+	if err != nil {
+		t.Fatalf("Could not apply task user policy a second time: %v", err)
+	}
+	out, err := host.CombinedOutput("net", "localgroup", group)
+	if err != nil {
+		t.Fatalf("Could not list members of group %v: %v", group, err)
+	}
+	if !strings.Contains(out, user.Name) {
+		t.Fatalf("Was expecting user %v to be a member of group %v, but members are:\n%v", user.Name, group, out)
+	}
+}
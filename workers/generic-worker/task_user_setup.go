@@ -0,0 +1,145 @@
+// +build multiuser
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+// file that holds the number of failed attempts to log in to the next task
+// user, since the worker reboots between attempts
+const taskUserLogonAttemptsFile = "task-user-logon-attempts.txt"
+
+// how long to wait after the first failed attempt to create a task user; the
+// wait grows linearly with each further failed attempt
+var taskUserCreationRetryInterval = 5 * time.Second
+
+// taskUserSetupAttempts returns how many times the worker attempts to create,
+// or to log in to, a task user (config setting taskUserSetupAttempts)
+func taskUserSetupAttempts() uint {
+	if config.TaskUserSetupAttempts == 0 {
+		return 1
+	}
+	return config.TaskUserSetupAttempts
+}
+
+// createTaskUser creates the given task user. If an attempt fails, whatever
+// it created is deleted before the next attempt, since user creation fails if
+// the user already exists. If all attempts fail, the worker is quarantined.
+func createTaskUser(user *runtime.OSUser) error {
+	attempts := taskUserSetupAttempts()
+	var err error
+	for attempt := uint(1); attempt <= attempts; attempt++ {
+		err = user.CreateNew(false)
+		if err == nil {
+			return nil
+		}
+		log.Printf("WARNING: Attempt %v/%v to create task user %v failed: %v", attempt, attempts, user.Name, err)
+		if attempt < attempts {
+			_ = runtime.DeleteUser(user.Name)
+			time.Sleep(time.Duration(attempt) * taskUserCreationRetryInterval)
+		}
+	}
+	err = fmt.Errorf("Could not create task user %v in %v attempt(s): %v", user.Name, attempts, err)
+	quarantineAfterTaskUserSetupFailure(err)
+	return err
+}
+
+// waitForTaskUserLogon checks that the worker has logged in to the given task
+// user, with a usable user profile
+func waitForTaskUserLogon(user *runtime.OSUser) error {
+	err := runtime.WaitForLoginCompletion(5 * time.Minute)
+	if err != nil {
+		return err
+	}
+	interactiveUsername, err := runtime.InteractiveUsername()
+	if err != nil {
+		return err
+	}
+	if user.Name != interactiveUsername {
+		return fmt.Errorf("Interactive username %v does not match task user %v from next-task-user.json file", interactiveUsername, user.Name)
+	}
+	return runtime.VerifyProfile(user.Name)
+}
+
+// retryTaskUserLogon handles a failed logon to the given task user after a
+// reboot. It returns true if the worker should reboot to attempt the logon
+// again, or else an error once all attempts have failed, in which case the
+// worker is quarantined.
+func retryTaskUserLogon(user *runtime.OSUser, logonErr error) (reboot bool, err error) {
+	attempts := taskUserSetupAttempts()
+	failures := taskUserLogonFailures() + 1
+	log.Printf("WARNING: Attempt %v/%v to log in to task user %v failed: %v", failures, attempts, user.Name, logonErr)
+	logEventWithFields("taskUserLogonFailed", nil, time.Now(), map[string]interface{}{
+		"attempt":  failures,
+		"attempts": attempts,
+	})
+	if failures >= attempts {
+		resetTaskUserLogonFailures()
+		err = fmt.Errorf("Could not log in to task user %v in %v attempt(s): %v", user.Name, attempts, logonErr)
+		quarantineAfterTaskUserSetupFailure(err)
+		return false, err
+	}
+	err = ioutil.WriteFile(taskUserLogonAttemptsFile, []byte(strconv.Itoa(int(failures))), 0600)
+	if err == nil {
+		err = fileutil.SecureFiles(taskUserLogonAttemptsFile)
+	}
+	if err != nil {
+		return false, fmt.Errorf("Could not write %v: %v", taskUserLogonAttemptsFile, err)
+	}
+	// Winlogon can clear the auto logon settings after a failed logon
+	err = runtime.SetAutoLogin(user)
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Rebooting to attempt logon to task user %v again", user.Name)
+	return true, nil
+}
+
+// taskUserLogonFailures returns the number of failed attempts to log in to
+// the next task user
+func taskUserLogonFailures() uint {
+	b, err := ioutil.ReadFile(taskUserLogonAttemptsFile)
+	if err != nil {
+		return 0
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || i < 0 {
+		return 0
+	}
+	return uint(i)
+}
+
+func resetTaskUserLogonFailures() {
+	err := os.Remove(taskUserLogonAttemptsFile)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: Could not delete %v: %v", taskUserLogonAttemptsFile, err)
+	}
+}
+
+// quarantineAfterTaskUserSetupFailure quarantines the worker for
+// config.TaskUserSetupQuarantineSecs, since it can't run tasks without a task
+// user
+func quarantineAfterTaskUserSetupFailure(setupErr error) {
+	duration := time.Duration(config.TaskUserSetupQuarantineSecs) * time.Second
+	logEventWithFields("taskUserSetupFailed", nil, time.Now(), map[string]interface{}{
+		"quarantineSecs": int64(duration / time.Second),
+	})
+	if duration == 0 {
+		return
+	}
+	log.Printf("WARNING: %v - quarantining worker for %v", setupErr, duration)
+	err := quarantine(config.Queue(), duration)
+	if err != nil {
+		log.Printf("WARNING: Could not quarantine worker: %v", err)
+	}
+}
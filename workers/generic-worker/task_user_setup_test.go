@@ -0,0 +1,54 @@
+// +build multiuser
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+func TestTaskUserLogonFailures(t *testing.T) {
+	defer resetTaskUserLogonFailures()
+	if failures := taskUserLogonFailures(); failures != 0 {
+		t.Fatalf("Was expecting no logon failures without file %v, but got %v", taskUserLogonAttemptsFile, failures)
+	}
+	for content, expected := range map[string]uint{
+		"2\n":  2,
+		"-1":   0,
+		"junk": 0,
+	} {
+		err := ioutil.WriteFile(taskUserLogonAttemptsFile, []byte(content), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if failures := taskUserLogonFailures(); failures != expected {
+			t.Errorf("Was expecting %v logon failures for file content %q, but got %v", expected, content, failures)
+		}
+	}
+}
+
+func TestRetryTaskUserLogonGivesUp(t *testing.T) {
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	config.TaskUserSetupAttempts = 3
+	config.TaskUserSetupQuarantineSecs = 0
+	err := ioutil.WriteFile(taskUserLogonAttemptsFile, []byte("2"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resetTaskUserLogonFailures()
+	reboot, err := retryTaskUserLogon(&runtime.OSUser{Name: "task_1234"}, errors.New("logon timed out"))
+	if reboot || err == nil {
+		t.Fatalf("Was expecting worker to give up after third failed logon, but got reboot=%v, error %v", reboot, err)
+	}
+	if _, err := os.Stat(taskUserLogonAttemptsFile); !os.IsNotExist(err) {
+		t.Fatalf("Was expecting %v to be deleted after giving up, but got %v", taskUserLogonAttemptsFile, err)
+	}
+}
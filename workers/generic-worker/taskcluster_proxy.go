@@ -19,6 +19,14 @@ func (feature *TaskclusterProxyFeature) Name() string {
 	return "Taskcluster Proxy"
 }
 
+func (feature *TaskclusterProxyFeature) PayloadName() string {
+	return "taskclusterProxy"
+}
+
+func (feature *TaskclusterProxyFeature) ScopePattern() scopes.Pattern {
+	return ""
+}
+
 func (feature *TaskclusterProxyFeature) Initialise() error {
 	return nil
 }
@@ -47,9 +55,9 @@ func (feature *TaskclusterProxyFeature) NewTaskFeature(task *TaskRun) TaskFeatur
 	}
 }
 
-func (l *TaskclusterProxyTask) RequiredScopes() scopes.Required {
+func (l *TaskclusterProxyTask) RequiredScopes() scopes.Expression {
 	// let's not require any scopes, to be consistent with docker-worker
-	return scopes.Required{}
+	return scopes.AllOf{}
 }
 
 func (l *TaskclusterProxyTask) Start() *CommandExecutionError {
@@ -79,6 +87,10 @@ func (l *TaskclusterProxyTask) Start() *CommandExecutionError {
 		return executionError(internalError, errored, fmt.Errorf("Could not start taskcluster proxy: %s", err))
 	}
 	l.taskclusterProxy = taskclusterProxy
+	l.task.audit(auditCredentialsUsed, map[string]interface{}{
+		"clientId": l.task.TaskClaimResponse.Credentials.ClientID,
+		"purpose":  "taskcluster-proxy",
+	})
 	l.taskStatusChangeListener = &TaskStatusChangeListener{
 		Name: "taskcluster-proxy",
 		Callback: func(ts TaskStatus) {
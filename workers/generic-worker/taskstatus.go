@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"strconv"
@@ -33,6 +34,7 @@ const (
 	internalError       TaskUpdateReason = "internal-error"
 	superseded          TaskUpdateReason = "superseded"
 	intermittentTask    TaskUpdateReason = "intermittent-task"
+	canceled            TaskUpdateReason = "canceled"
 )
 
 type TaskStatusChangeListener struct {
@@ -54,6 +56,15 @@ type TaskStatusManager struct {
 	reclaimingDone <-chan struct{}
 	// true if reclaims are no longer taking place for this task
 	finishedReclaiming bool
+	// expiry of each renewed claim, for the claim expiry watchdog
+	claimRenewed chan tcclient.Time
+	// closed when the claim expiry watchdog should stop
+	stopWatchingClaim chan struct{}
+	// true if the claim expiry watchdog has been stopped
+	finishedWatchingClaim bool
+	// context of artifact uploads, which the claim expiry watchdog cancels
+	uploads       context.Context
+	cancelUploads context.CancelFunc
 }
 
 func (tsm *TaskStatusManager) DeregisterListener(listener *TaskStatusChangeListener) {
@@ -185,6 +196,10 @@ func (tsm *TaskStatusManager) reclaim() error {
 				log.Printf("SERIOUS BUG: invalid credentials in queue claim response body: %v", err)
 			}
 			log.Printf("Reclaimed task %v successfully.", task.TaskID)
+			tsm.notifyClaimRenewed(tcrsp.TakenUntil)
+			if err := recordInFlightRun(task, tcrsp.TakenUntil); err != nil {
+				log.Printf("WARNING: could not record in-flight run: %v", err)
+			}
 			return nil
 		},
 		claimed,
@@ -224,11 +239,24 @@ func (tsm *TaskStatusManager) Abort(cee *CommandExecutionError) error {
 	)
 }
 
+// Cancel kills the task commands of a task whose run has been cancelled via
+// the queue. The run has already been resolved by the queue, so the task is
+// not resolved again, but features are stopped and artifacts and logs are
+// still uploaded as normal.
 func (tsm *TaskStatusManager) Cancel() error {
 	return tsm.updateStatus(
 		cancelled,
 		func(task *TaskRun) error {
-			//TODO: implement cancelling of tasks
+			task.Errorf("Task has been cancelled")
+			task.kill()
+			// the queue has resolved the run, so won't retry the task when
+			// the claim expires
+			tsm.stopWatchingClaimExpiry()
+			tsm.abortException = &CommandExecutionError{
+				Cause:      fmt.Errorf("Task cancelled"),
+				Reason:     canceled,
+				TaskStatus: cancelled,
+			}
 			return nil
 		},
 		claimed,
@@ -237,6 +265,18 @@ func (tsm *TaskStatusManager) Cancel() error {
 	)
 }
 
+// ReasonResolved returns the reason that the queue reported for the
+// resolution of the task run, or "" if the run hasn't been resolved
+func (tsm *TaskStatusManager) ReasonResolved() string {
+	tsm.Lock()
+	defer tsm.Unlock()
+	runs := tsm.status.Runs
+	if int(tsm.task.RunID) < len(runs) {
+		return runs[tsm.task.RunID].ReasonResolved
+	}
+	return ""
+}
+
 func (tsm *TaskStatusManager) LastKnownStatus() TaskStatus {
 	tsm.Lock()
 	defer tsm.Unlock()
@@ -315,6 +355,7 @@ func NewTaskStatusManager(task *TaskRun) *TaskStatusManager {
 
 	stopReclaiming := make(chan struct{})
 	reclaimingDone := make(chan struct{})
+	uploads, cancelUploads := context.WithCancel(context.Background())
 
 	tsm := &TaskStatusManager{
 		task:                  task,
@@ -323,6 +364,14 @@ func NewTaskStatusManager(task *TaskRun) *TaskStatusManager {
 		statusChangeListeners: map[*TaskStatusChangeListener]bool{},
 		stopReclaiming:        stopReclaiming,
 		reclaimingDone:        reclaimingDone,
+		claimRenewed:          make(chan tcclient.Time, 1),
+		stopWatchingClaim:     make(chan struct{}),
+		uploads:               uploads,
+		cancelUploads:         cancelUploads,
+	}
+
+	if config.ClaimExpiryMarginSecs > 0 {
+		go tsm.watchClaimExpiry(tsm.takenUntil, time.Second*time.Duration(config.ClaimExpiryMarginSecs))
 	}
 
 	// Reclaiming Tasks
@@ -336,6 +385,18 @@ func NewTaskStatusManager(task *TaskRun) *TaskStatusManager {
 
 	go func() {
 		defer close(reclaimingDone)
+		// Cancelling Tasks
+		// ----------------
+		// A task run that is cancelled is resolved by the queue, but the
+		// worker is not notified, and would only discover it at the next
+		// reclaim. Therefore the task status is also checked periodically, so
+		// that cancelled tasks can be aborted promptly.
+		var checkForCancellation <-chan time.Time
+		if config.CheckForCancellationEverySecs > 0 {
+			ticker := time.NewTicker(time.Second * time.Duration(config.CheckForCancellationEverySecs))
+			defer ticker.Stop()
+			checkForCancellation = ticker.C
+		}
 		for {
 			var waitTimeUntilReclaim time.Duration
 			if reclaimEvery5Seconds {
@@ -356,28 +417,62 @@ func NewTaskStatusManager(task *TaskRun) *TaskStatusManager {
 				}
 			}
 			log.Printf("Reclaiming task %v in %v", task.TaskID, waitTimeUntilReclaim)
-			select {
-			case <-stopReclaiming:
-				return
-			case <-time.After(waitTimeUntilReclaim):
-				log.Printf("About to reclaim task %v...", task.TaskID)
-				err := tsm.reclaim()
-				if err != nil {
-					log.Printf("ERROR: Encountered exception when reclaiming task %v - giving up retrying: %v", task.TaskID, err)
+			reclaimTimer := time.After(waitTimeUntilReclaim)
+		wait:
+			for {
+				select {
+				case <-stopReclaiming:
 					return
+				case <-checkForCancellation:
+					if tsm.runCancelled() {
+						log.Printf("Task %v run %v has been cancelled - aborting", task.TaskID, task.RunID)
+						// Cancel() blocks until any concurrent status
+						// update completes, which may itself be waiting for
+						// this go routine to exit, so it can't be called
+						// here directly. Since the run is resolved, there is
+						// no point in reclaiming any more.
+						go func() {
+							_ = tsm.Cancel()
+						}()
+						return
+					}
+				case <-reclaimTimer:
+					log.Printf("About to reclaim task %v...", task.TaskID)
+					err := tsm.reclaim()
+					if err != nil {
+						log.Printf("ERROR: Encountered exception when reclaiming task %v - giving up retrying: %v", task.TaskID, err)
+						return
+					}
+					log.Printf("Successfully reclaimed task %v", task.TaskID)
+					break wait
 				}
-				log.Printf("Successfully reclaimed task %v", task.TaskID)
 			}
 		}
 	}()
 	return tsm
 }
 
+// runCancelled queries the queue to see whether the task run has been
+// cancelled. Unlike UpdateStatus, it neither takes tsm.Lock() nor updates the
+// task status.
+func (tsm *TaskStatusManager) runCancelled() bool {
+	// no scopes required for this endpoint, so can use global Queue object
+	tsr, err := queue.Status(tsm.task.TaskID)
+	if err != nil {
+		log.Printf("WARNING: could not query status of task %v to check for cancellation: %v", tsm.task.TaskID, err)
+		return false
+	}
+	runs := tsr.Status.Runs
+	return int(tsm.task.RunID) < len(runs) && runs[tsm.task.RunID].ReasonResolved == "canceled"
+}
+
 // stopReclaims() must be called when tsm.Lock() is held by caller
 func (tsm *TaskStatusManager) stopReclaims() {
 	if !tsm.finishedReclaiming {
 		close(tsm.stopReclaiming)
 		<-tsm.reclaimingDone
+		tsm.stopWatchingClaimExpiry()
+		tsm.cancelUploads()
 		tsm.finishedReclaiming = true
 	}
 }
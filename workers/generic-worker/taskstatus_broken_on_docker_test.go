@@ -1,4 +1,4 @@
-// +build !docker
+// +build !docker,!kubernetes
 
 package main
 
@@ -54,3 +54,32 @@ func TestReclaimCancelledTask(t *testing.T) {
 		t.Fatalf("Task should have expired long before the max run time (300s) but took %v", duration)
 	}
 }
+
+func TestCancelledTaskAbortedPromptly(t *testing.T) {
+	defer setup(t)()
+	td, payload := cancelTask(t)
+	payload.Command = append(payload.Command, sleep(300)...)
+	// claim is not reclaimed during the task, so cancellation can only be
+	// detected by checking the task status
+	config.CheckForCancellationEverySecs = 5
+	start := time.Now()
+	taskID := submitAndAssert(t, td, payload, "exception", "canceled")
+	end := time.Now()
+
+	expectedArtifacts := ExpectedArtifacts{
+		"public/logs/live_backing.log": {
+			Extracts: []string{
+				"Task has been cancelled",
+			},
+			ContentType:     "text/plain; charset=utf-8",
+			ContentEncoding: "gzip",
+			Expires:         td.Expires,
+		},
+	}
+
+	expectedArtifacts.Validate(t, taskID, 0)
+
+	if duration := end.Sub(start); duration.Seconds() > 120 {
+		t.Fatalf("Task should have been aborted soon after being cancelled, but took %v", duration)
+	}
+}
@@ -0,0 +1,75 @@
+// +build multiuser,darwin multiuser,linux simple
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// TCCFeature grants the macOS privacy (TCC) permissions configured in
+// tccGrants, so that tasks (e.g. UI automation) don't hang on permission
+// dialogs that nobody will answer. Permissions held in the system TCC
+// database are granted once, when the worker starts, and those held in the
+// per-user TCC database are granted to the task user before each task.
+type TCCFeature struct {
+}
+
+func (feature *TCCFeature) Name() string {
+	return "TCC Permissions"
+}
+
+func (feature *TCCFeature) Initialise() error {
+	if len(config.TCCGrants) == 0 {
+		return nil
+	}
+	for i, grant := range config.TCCGrants {
+		if grant.Service == "" || grant.Client == "" {
+			return fmt.Errorf("Config setting tccGrants entry %v must specify both service and client", i)
+		}
+	}
+	return grantSystemTCCPermissions(config.TCCGrants)
+}
+
+func (feature *TCCFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TCCFeature) IsEnabled(task *TaskRun) bool {
+	return len(config.TCCGrants) > 0
+}
+
+type TCCTask struct {
+	task *TaskRun
+}
+
+func (feature *TCCFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TCCTask{
+		task: task,
+	}
+}
+
+func (l *TCCTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (l *TCCTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (l *TCCTask) Start() *CommandExecutionError {
+	granted, err := grantUserTCCPermissions(config.TCCGrants)
+	if err != nil {
+		// the task may not need the permissions, so let it try
+		l.task.Warnf("[tcc] Could not grant TCC permissions to task user: %v", err)
+		return nil
+	}
+	for _, grant := range granted {
+		l.task.Infof("[tcc] Granted %v permission to %v", grant.Service, grant.Client)
+	}
+	return nil
+}
+
+func (l *TCCTask) Stop(err *ExecutionErrors) {
+}
@@ -0,0 +1,121 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/host"
+	gwruntime "github.com/taskcluster/taskcluster/v28/workers/generic-worker/runtime"
+)
+
+const (
+	systemTCCDatabase = "/Library/Application Support/com.apple.TCC/TCC.db"
+	// relative to the home directory of the user
+	userTCCDatabase = "Library/Application Support/com.apple.TCC/TCC.db"
+)
+
+// TCC services whose permissions are held in the system TCC database, rather
+// than the per-user database
+var systemTCCServices = map[string]bool{
+	"Accessibility":        true,
+	"DeveloperTool":        true,
+	"ListenEvent":          true,
+	"PostEvent":            true,
+	"ScreenCapture":        true,
+	"SystemPolicyAllFiles": true,
+}
+
+// grantSystemTCCPermissions requires the worker to have Full Disk Access,
+// since the system TCC database is protected by System Integrity Protection
+func grantSystemTCCPermissions(grants []gwconfig.TCCGrant) error {
+	system, _ := partitionTCCGrants(grants)
+	if len(system) == 0 {
+		return nil
+	}
+	err := grantTCCPermissions(systemTCCDatabase, "", system)
+	if err != nil {
+		return fmt.Errorf("Could not grant TCC permissions in %v - does generic-worker have Full Disk Access? %v", systemTCCDatabase, err)
+	}
+	for _, grant := range system {
+		log.Printf("Granted TCC permission %v to %v", grant.Service, grant.Client)
+	}
+	return nil
+}
+
+func grantUserTCCPermissions(grants []gwconfig.TCCGrant) ([]gwconfig.TCCGrant, error) {
+	_, user := partitionTCCGrants(grants)
+	if len(user) == 0 {
+		return nil, nil
+	}
+	home := os.Getenv("HOME")
+	username := ""
+	// taskContext.User is nil if running tasks as current user
+	if taskContext.User != nil {
+		username = taskContext.User.Name
+		home = filepath.Join(gwruntime.UserHomeDirectoriesParent(), username)
+	}
+	db := filepath.Join(home, userTCCDatabase)
+	// the database is created by tccd when the user first logs in
+	if _, err := os.Stat(db); err != nil {
+		return nil, err
+	}
+	return user, grantTCCPermissions(db, username, user)
+}
+
+func partitionTCCGrants(grants []gwconfig.TCCGrant) (system, user []gwconfig.TCCGrant) {
+	for _, grant := range grants {
+		if systemTCCServices[grant.Service] {
+			system = append(system, grant)
+		} else {
+			user = append(user, grant)
+		}
+	}
+	return
+}
+
+// grantTCCPermissions adds the given grants to TCC database db. If username
+// is not empty, the database is modified as that user, so that any files
+// sqlite creates are owned by the user, rather than the worker.
+func grantTCCPermissions(db, username string, grants []gwconfig.TCCGrant) error {
+	sqlite := []string{"/usr/bin/sqlite3", db}
+	if username != "" {
+		sqlite = append([]string{"/usr/bin/sudo", "-u", username}, sqlite...)
+	}
+	columns, err := host.CombinedOutput(sqlite[0], append(sqlite[1:], "PRAGMA table_info(access);")...)
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, columns)
+	}
+	statements := []string{}
+	for _, grant := range grants {
+		service := sqlString("kTCCService" + grant.Service)
+		client := sqlString(grant.Client)
+		// 0: bundle identifier, 1: absolute path
+		clientType := 0
+		if strings.HasPrefix(grant.Client, "/") {
+			clientType = 1
+		}
+		// the access table schema changed in macOS 11
+		if strings.Contains(columns, "|auth_value|") {
+			statements = append(statements, fmt.Sprintf("INSERT OR REPLACE INTO access (service, client, client_type, auth_value, auth_reason, auth_version, flags, last_modified) VALUES (%v, %v, %v, 2, 4, 1, 0, CAST(strftime('%%s', 'now') AS INTEGER));", service, client, clientType))
+		} else {
+			statements = append(statements, fmt.Sprintf("INSERT OR REPLACE INTO access (service, client, client_type, allowed, prompt_count) VALUES (%v, %v, %v, 1, 1);", service, client, clientType))
+		}
+	}
+	out, err := host.CombinedOutput(sqlite[0], append(sqlite[1:], strings.Join(statements, " "))...)
+	if err != nil {
+		return fmt.Errorf("%v\n%v", err, out)
+	}
+	// tccd caches permissions, and is restarted by launchd
+	_, _ = host.CombinedOutput("/usr/bin/killall", "tccd")
+	return nil
+}
+
+func sqlString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,18 @@
+// +build linux,multiuser linux,simple freebsd,simple
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func grantSystemTCCPermissions(grants []gwconfig.TCCGrant) error {
+	return fmt.Errorf("Config setting tccGrants is not supported on %v", runtime.GOOS)
+}
+
+func grantUserTCCPermissions(grants []gwconfig.TCCGrant) ([]gwconfig.TCCGrant, error) {
+	return nil, fmt.Errorf("TCC permissions are not supported on %v", runtime.GOOS)
+}
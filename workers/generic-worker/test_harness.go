@@ -0,0 +1,26 @@
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/testharness"
+)
+
+// runTestHarness runs a mock queue and artifact storage on the given port of
+// the loopback interface, until the process is interrupted
+func runTestHarness(port string) error {
+	h, err := testharness.New(net.JoinHostPort("localhost", port))
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	log.Printf("Test harness running with root URL %v - press Ctrl-C to stop", h.RootURL)
+	sigInterrupt := make(chan os.Signal, 1)
+	signal.Notify(sigInterrupt, os.Interrupt)
+	<-sigInterrupt
+	log.Print("Stopping test harness")
+	return nil
+}
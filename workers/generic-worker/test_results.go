@@ -0,0 +1,236 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/fileutil"
+)
+
+const (
+	testResultsArtifactName = "public/test-results.json"
+	// number of slowest tests listed in the summary
+	slowestTests = 10
+	// maximum number of failed tests listed in the summary, and in the task
+	// log
+	maxFailedTests = 100
+)
+
+var (
+	// file, relative to task directory, that the summary is written to before
+	// it is uploaded
+	testResultsFile = filepath.Join("generic-worker", "test-results.json")
+)
+
+type (
+	// TestResultsFeature summarizes the JUnit XML reports listed in
+	// task.payload.testResults in artifact public/test-results.json
+	TestResultsFeature struct {
+	}
+
+	TestResultsTask struct {
+		task *TaskRun
+	}
+
+	// testResultsSummary is the content of artifact public/test-results.json
+	testResultsSummary struct {
+		// paths of the parsed reports, relative to the task directory
+		Reports []string `json:"reports"`
+		Tests   uint     `json:"tests"`
+		Passed  uint     `json:"passed"`
+		Failed  uint     `json:"failed"`
+		Errored uint     `json:"errored"`
+		Skipped uint     `json:"skipped"`
+		// total duration of the tests
+		DurationSecs float64 `json:"durationSecs"`
+		// slowest tests, slowest first
+		Slowest []*testResult `json:"slowest"`
+		// tests that failed or errored, up to maxFailedTests
+		Failures []*testResult `json:"failures"`
+	}
+
+	testResult struct {
+		Test string `json:"test"`
+		// path of the report, relative to the task directory
+		Report       string  `json:"report"`
+		DurationSecs float64 `json:"durationSecs"`
+		Message      string  `json:"message,omitempty"`
+	}
+)
+
+func (feature *TestResultsFeature) Name() string {
+	return "Test Results"
+}
+
+func (feature *TestResultsFeature) Initialise() error {
+	return nil
+}
+
+func (feature *TestResultsFeature) PersistState() error {
+	return nil
+}
+
+func (feature *TestResultsFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.TestResults.Paths) > 0
+}
+
+func (feature *TestResultsFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &TestResultsTask{
+		task: task,
+	}
+}
+
+func (trt *TestResultsTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (trt *TestResultsTask) ReservedArtifacts() []string {
+	return []string{
+		testResultsArtifactName,
+	}
+}
+
+func (trt *TestResultsTask) Start() *CommandExecutionError {
+	for _, pattern := range trt.task.Payload.TestResults.Paths {
+		if filepath.IsAbs(pattern) || strings.HasPrefix(filepath.Clean(pattern), "..") {
+			return MalformedPayloadError(fmt.Errorf("[test results] task.payload.testResults.paths entry %q must be relative to the task directory", pattern))
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return MalformedPayloadError(fmt.Errorf("[test results] task.payload.testResults.paths entry %q is not a valid pattern: %v", pattern, err))
+		}
+	}
+	return nil
+}
+
+// Stop parses the reports that the task commands have written, and publishes
+// the summary
+func (trt *TestResultsTask) Stop(err *ExecutionErrors) {
+	reports, e := trt.reports()
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[test results] Could not find test results: %v", e)))
+		return
+	}
+	failIfMissing := trt.task.Payload.TestResults.FailIfMissing
+	if len(reports) == 0 {
+		trt.task.Warnf("[test results] No test results match task.payload.testResults.paths %v", trt.task.Payload.TestResults.Paths)
+		if failIfMissing {
+			err.add(Failure(fmt.Errorf("[test results] No test results found, but task.payload.testResults.failIfMissing is true")))
+		}
+		return
+	}
+	summary := &testResultsSummary{
+		Reports:  []string{},
+		Slowest:  []*testResult{},
+		Failures: []*testResult{},
+	}
+	var all []*testResult
+	for _, report := range reports {
+		suite, e := readJUnitReport(filepath.Join(taskContext.TaskDir, report))
+		if e != nil {
+			trt.task.Warnf("[test results] Could not parse %v: %v", report, e)
+			if failIfMissing {
+				err.add(Failure(fmt.Errorf("[test results] Could not parse %v, and task.payload.testResults.failIfMissing is true: %v", report, e)))
+			}
+			continue
+		}
+		summary.Reports = append(summary.Reports, report)
+		all = append(all, summary.add(suite, report)...)
+	}
+	summary.Slowest = slowest(all, slowestTests)
+	trt.task.Infof("[test results] %v tests: %v passed, %v failed, %v errored, %v skipped", summary.Tests, summary.Passed, summary.Failed, summary.Errored, summary.Skipped)
+	for _, failure := range summary.Failures {
+		trt.task.Infof("[test results] FAILED %v (%v): %v", failure.Test, failure.Report, failure.Message)
+	}
+	e = fileutil.WriteToFileAsJSON(summary, filepath.Join(taskContext.TaskDir, testResultsFile))
+	if e != nil {
+		err.add(executionError(internalError, errored, fmt.Errorf("[test results] Could not write %v: %v", testResultsFile, e)))
+		return
+	}
+	err.add(trt.task.uploadArtifact(
+		&S3Artifact{
+			BaseArtifact: &BaseArtifact{
+				Name:    testResultsArtifactName,
+				Expires: trt.task.Definition.Expires,
+			},
+			ContentType: "application/json",
+			Path:        testResultsFile,
+		},
+	))
+}
+
+// reports returns the paths, relative to the task directory, of the files
+// matching task.payload.testResults.paths, sorted and without duplicates
+func (trt *TestResultsTask) reports() ([]string, error) {
+	found := map[string]bool{}
+	reports := []string{}
+	for _, pattern := range trt.task.Payload.TestResults.Paths {
+		matches, err := filepath.Glob(filepath.Join(taskContext.TaskDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			report, err := filepath.Rel(taskContext.TaskDir, match)
+			if err != nil {
+				return nil, err
+			}
+			if !found[report] {
+				found[report] = true
+				reports = append(reports, report)
+			}
+		}
+	}
+	sort.Strings(reports)
+	return reports, nil
+}
+
+// add counts the test cases of the given suite, parsed from the given report,
+// and returns their results
+func (summary *testResultsSummary) add(suite *junitSuite, report string) []*testResult {
+	results := []*testResult{}
+	suite.eachCase(func(c *junitCase) {
+		result := &testResult{
+			Test:         c.test(),
+			Report:       report,
+			DurationSecs: c.duration(),
+		}
+		results = append(results, result)
+		summary.Tests++
+		summary.DurationSecs += result.DurationSecs
+		switch {
+		case len(c.Failures) > 0:
+			summary.Failed++
+		case len(c.Errors) > 0:
+			summary.Errored++
+		case len(c.Skipped) > 0:
+			summary.Skipped++
+			return
+		default:
+			summary.Passed++
+			return
+		}
+		if len(summary.Failures) < maxFailedTests {
+			problems := c.problems()
+			result.Message = problems[0].message()
+			summary.Failures = append(summary.Failures, result)
+		}
+	})
+	return results
+}
+
+// slowest returns the n slowest of the given test results, slowest first
+func slowest(results []*testResult, n int) []*testResult {
+	sorted := make([]*testResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].DurationSecs > sorted[j].DurationSecs
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
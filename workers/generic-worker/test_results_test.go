@@ -0,0 +1,86 @@
+// +build multiuser simple
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTestResultsSummary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test-results")
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(taskDir string) {
+		taskContext.TaskDir = taskDir
+	}(taskContext.TaskDir)
+	taskContext.TaskDir = dir
+	err = os.MkdirAll(filepath.Join(dir, "results"), 0755)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	for file, report := range map[string]string{
+		"results/TEST-lexer.xml": `<testsuite name="lexer">
+  <testcase classname="Lexer" name="testTokens" time="0.5"/>
+  <testcase classname="Lexer" name="testUnicode" time="2.25">
+    <failure message="expected 3 tokens, got 2"/>
+  </testcase>
+  <testcase classname="Lexer" name="testEmoji" time="0">
+    <skipped/>
+  </testcase>
+</testsuite>`,
+		"results/TEST-parser.xml": `<testsuites>
+  <testsuite name="parser">
+    <testcase classname="Parser" name="testCrash" time="1,200.5">
+      <error>NullPointerException</error>
+    </testcase>
+  </testsuite>
+</testsuites>`,
+		"results/notes.txt": "not a report",
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, file), []byte(report), 0644)
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+	trt := &TestResultsTask{
+		task: &TaskRun{},
+	}
+	trt.task.Payload.TestResults.Paths = []string{"results/TEST-*.xml", "results/TEST-lexer.xml", "missing/*.xml"}
+	reports, err := trt.reports()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	expectedReports := []string{filepath.Join("results", "TEST-lexer.xml"), filepath.Join("results", "TEST-parser.xml")}
+	if !reflect.DeepEqual(reports, expectedReports) {
+		t.Fatalf("Was expecting reports %v but got %v", expectedReports, reports)
+	}
+
+	summary := &testResultsSummary{}
+	var all []*testResult
+	for _, report := range reports {
+		suite, err := readJUnitReport(filepath.Join(dir, report))
+		if err != nil {
+			t.Fatalf("%v", err)
+		}
+		all = append(all, summary.add(suite, report)...)
+	}
+	if summary.Tests != 4 || summary.Passed != 1 || summary.Failed != 1 || summary.Errored != 1 || summary.Skipped != 1 {
+		t.Fatalf("Unexpected test counts: %#v", summary)
+	}
+	if summary.DurationSecs != 1203.25 {
+		t.Fatalf("Was expecting total duration 1203.25s but got %vs", summary.DurationSecs)
+	}
+	if len(summary.Failures) != 2 || summary.Failures[0].Message != "expected 3 tokens, got 2" || summary.Failures[1].Message != "NullPointerException" {
+		t.Fatalf("Unexpected failures: %#v", summary.Failures)
+	}
+	slow := slowest(all, 2)
+	if len(slow) != 2 || slow[0].Test != "Parser.testCrash" || slow[1].Test != "Lexer.testUnicode" {
+		t.Fatalf("Unexpected slowest tests: %#v", slow)
+	}
+}
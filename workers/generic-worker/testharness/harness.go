@@ -0,0 +1,187 @@
+// Package testharness runs an in-process mock of the Taskcluster services
+// that generic-worker depends on: the queue, and the storage that artifacts
+// are uploaded to. It allows engines, features and worker configs to be
+// integration-tested without a real Taskcluster deployment.
+//
+// A worker is pointed at the harness by setting config setting rootURL to
+// Harness.RootURL. The harness accepts any credentials, and doesn't check
+// scopes. Tasks are created, and their results inspected, either with the
+// methods of Harness, or with a queue client from Harness.Queue, or any other
+// Taskcluster client.
+//
+// The mock queue implements the queue API methods that the worker calls,
+// and the ones needed to create tasks and inspect their results, with the
+// following simplifications: tasks don't expire or exceed their deadline,
+// claims don't expire, and artifacts can only have storage types "s3",
+// "reference" and "error".
+package testharness
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+// Harness is a running mock Taskcluster deployment
+type Harness struct {
+	// RootURL is the root URL of the mock deployment, for config setting
+	// rootURL of the worker under test
+	RootURL string
+	// ClaimDuration is the duration of task claims, and of reclaims
+	ClaimDuration time.Duration
+
+	listener net.Listener
+	server   *http.Server
+
+	mu sync.Mutex
+	// task ID -> task
+	tasks map[string]*mockTask
+	// IDs of the tasks that have a pending run, in the order that the runs
+	// became pending
+	pending []string
+	// <provisionerId>/<workerType>/<workerGroup>/<workerId> -> worker
+	workers map[string]*tcqueue.WorkerResponse
+}
+
+type mockTask struct {
+	definition tcqueue.TaskDefinitionResponse
+	status     tcqueue.TaskStatusStructure
+	// run ID -> artifact name -> artifact
+	artifacts []map[string]*Artifact
+}
+
+// Artifact is an artifact that a task run has created
+type Artifact struct {
+	Name string
+	// "s3", "reference" or "error"
+	StorageType string
+	ContentType string
+	Expires     tcclient.Time
+	// URL that a reference artifact redirects to
+	URL string
+	// Reason and Message of an error artifact
+	Reason  string
+	Message string
+	// Content of an s3 artifact as uploaded, so still compressed if
+	// ContentEncoding is "gzip", or nil if it hasn't been uploaded
+	Content         []byte
+	ContentEncoding string
+}
+
+// New starts a harness that listens on the given address, such as
+// "localhost:0" for an unused port on the loopback interface
+func New(addr string) (*Harness, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	h := &Harness{
+		RootURL:       "http://" + listener.Addr().String(),
+		ClaimDuration: 20 * time.Minute,
+		listener:      listener,
+		tasks:         map[string]*mockTask{},
+		workers:       map[string]*tcqueue.WorkerResponse{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(queuePrefix, h.serveQueue)
+	mux.HandleFunc(objectsPrefix, h.serveObject)
+	h.server = &http.Server{
+		Handler: mux,
+	}
+	go func() {
+		_ = h.server.Serve(listener)
+	}()
+	return h, nil
+}
+
+// Close stops the harness
+func (h *Harness) Close() error {
+	return h.server.Close()
+}
+
+// Queue returns a client of the mock queue
+func (h *Harness) Queue() *tcqueue.Queue {
+	return tcqueue.New(
+		&tcclient.Credentials{
+			ClientID:    "test-harness",
+			AccessToken: "test-harness",
+		},
+		h.RootURL,
+	)
+}
+
+// CreateTask creates a task, like queue method createTask
+func (h *Harness) CreateTask(taskID string, definition *tcqueue.TaskDefinitionRequest) (*tcqueue.TaskStatusStructure, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status, err := h.createTask(taskID, definition)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Status returns the status of the given task
+func (h *Harness) Status(taskID string) (*tcqueue.TaskStatusStructure, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, exists := h.tasks[taskID]
+	if !exists {
+		return nil, fmt.Errorf("task %v not found", taskID)
+	}
+	status := t.copyStatus()
+	return &status, nil
+}
+
+// WaitForResolution waits for the given task to resolve, and returns its
+// status, or returns an error if the task isn't resolved within the timeout
+func (h *Harness) WaitForResolution(taskID string, timeout time.Duration) (*tcqueue.TaskStatusStructure, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := h.Status(taskID)
+		if err != nil {
+			return nil, err
+		}
+		switch status.State {
+		case "completed", "failed", "exception":
+			return status, nil
+		}
+		if time.Now().After(deadline) {
+			return status, fmt.Errorf("task %v not resolved after %v; state is %v", taskID, timeout, status.State)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Artifacts returns the artifacts of the given task run, sorted by name
+func (h *Harness) Artifacts(taskID string, runID int) ([]Artifact, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	t, exists := h.tasks[taskID]
+	if !exists {
+		return nil, fmt.Errorf("task %v not found", taskID)
+	}
+	if runID < 0 || runID >= len(t.artifacts) {
+		return nil, fmt.Errorf("task %v has no run %v", taskID, runID)
+	}
+	artifacts := []Artifact{}
+	for _, artifact := range t.artifacts[runID] {
+		artifacts = append(artifacts, *artifact)
+	}
+	sort.Slice(artifacts, func(i, j int) bool {
+		return artifacts[i].Name < artifacts[j].Name
+	})
+	return artifacts, nil
+}
+
+func (t *mockTask) copyStatus() tcqueue.TaskStatusStructure {
+	status := t.status
+	status.Runs = append([]tcqueue.RunInformation{}, t.status.Runs...)
+	return status
+}
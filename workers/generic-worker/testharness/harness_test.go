@@ -0,0 +1,217 @@
+package testharness
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+func newTask() *tcqueue.TaskDefinitionRequest {
+	return &tcqueue.TaskDefinitionRequest{
+		Metadata: tcqueue.TaskMetadata{
+			Description: "Test harness task",
+			Name:        "Test harness task",
+			Owner:       "test@example.com",
+			Source:      "https://example.com",
+		},
+		Payload:       json.RawMessage(`{"command": [["true"]], "maxRunTime": 10}`),
+		ProvisionerID: "test-provisioner",
+		WorkerType:    "test-worker-type",
+	}
+}
+
+func startHarness(t *testing.T) *Harness {
+	h, err := New("localhost:0")
+	if err != nil {
+		t.Fatalf("Could not start test harness: %v", err)
+	}
+	return h
+}
+
+func TestTaskLifecycle(t *testing.T) {
+	h := startHarness(t)
+	defer h.Close()
+	queue := h.Queue()
+
+	taskID := "KTBKfEgxR5GdfIIREQIvFQ"
+	tsr, err := queue.CreateTask(taskID, newTask())
+	if err != nil {
+		t.Fatalf("Could not create task: %v", err)
+	}
+	if tsr.Status.State != "pending" {
+		t.Fatalf("Expected new task to be pending, but it is %v", tsr.Status.State)
+	}
+
+	claims, err := queue.ClaimWork("test-provisioner", "test-worker-type", &tcqueue.ClaimWorkRequest{
+		Tasks:       4,
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker-id",
+	})
+	if err != nil {
+		t.Fatalf("Could not claim work: %v", err)
+	}
+	if len(claims.Tasks) != 1 || claims.Tasks[0].Status.TaskID != taskID {
+		t.Fatalf("Expected to claim task %v, but claimed %#v", taskID, claims.Tasks)
+	}
+	if _, err := queue.ReclaimTask(taskID, "0"); err != nil {
+		t.Fatalf("Could not reclaim task: %v", err)
+	}
+
+	// the worker uses the task credentials of the claim
+	taskQueue := tcqueue.New(
+		&tcclient.Credentials{
+			ClientID:    claims.Tasks[0].Credentials.ClientID,
+			AccessToken: claims.Tasks[0].Credentials.AccessToken,
+		},
+		h.RootURL,
+	)
+	par := tcqueue.PostArtifactRequest(json.RawMessage(`{"storageType": "s3", "contentType": "text/plain", "expires": "2100-01-01T00:00:00.000Z"}`))
+	resp, err := taskQueue.CreateArtifact(taskID, "0", "public/logs/live_backing.log", &par)
+	if err != nil {
+		t.Fatalf("Could not create artifact: %v", err)
+	}
+	var s3Artifact tcqueue.S3ArtifactResponse
+	if err := json.Unmarshal(*resp, &s3Artifact); err != nil {
+		t.Fatalf("Invalid response to create artifact: %v", err)
+	}
+	req, err := http.NewRequest("PUT", s3Artifact.PutURL, bytes.NewBufferString("hello world"))
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	putResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not upload artifact: %v", err)
+	}
+	putResp.Body.Close()
+	if putResp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected artifact upload to return 200, but got %v", putResp.Status)
+	}
+	if _, err := taskQueue.ReportCompleted(taskID, "0"); err != nil {
+		t.Fatalf("Could not report task completed: %v", err)
+	}
+	if _, err := taskQueue.ReportCompleted(taskID, "0"); err == nil {
+		t.Fatal("Expected reporting a resolved run to fail")
+	}
+
+	status, err := h.WaitForResolution(taskID, time.Second)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if status.State != "completed" || status.Runs[0].WorkerID != "test-worker-id" {
+		t.Fatalf("Expected task to be completed by test-worker-id, but got %#v", status)
+	}
+	artifacts, err := h.Artifacts(taskID, 0)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(artifacts) != 1 || string(artifacts[0].Content) != "hello world" {
+		t.Fatalf("Expected uploaded artifact, but got %#v", artifacts)
+	}
+
+	// artifacts can be downloaded with the queue client, via a redirect
+	u, err := queue.GetLatestArtifact_SignedURL(taskID, "public/logs/live_backing.log", time.Minute)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	getResp, err := http.Get(u.String())
+	if err != nil {
+		t.Fatalf("Could not download artifact: %v", err)
+	}
+	defer getResp.Body.Close()
+	content, err := ioutil.ReadAll(getResp.Body)
+	if err != nil || string(content) != "hello world" {
+		t.Fatalf("Expected to download artifact content %q, but got %q (%v)", "hello world", content, err)
+	}
+}
+
+func TestDependenciesAndRetries(t *testing.T) {
+	h := startHarness(t)
+	defer h.Close()
+
+	if _, err := h.CreateTask("first", newTask()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	dependent := newTask()
+	dependent.Dependencies = []string{"first"}
+	if _, err := h.CreateTask("second", dependent); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if status, _ := h.Status("second"); status.State != "unscheduled" {
+		t.Fatalf("Expected dependent task to be unscheduled, but it is %v", status.State)
+	}
+
+	queue := h.Queue()
+	claim := func() []tcqueue.TaskClaim {
+		claims, err := queue.ClaimWork("test-provisioner", "test-worker-type", &tcqueue.ClaimWorkRequest{
+			Tasks:       1,
+			WorkerGroup: "test-worker-group",
+			WorkerID:    "test-worker-id",
+		})
+		if err != nil {
+			t.Fatalf("Could not claim work: %v", err)
+		}
+		return claims.Tasks
+	}
+	if claims := claim(); len(claims) != 1 || claims[0].Status.TaskID != "first" {
+		t.Fatalf("Expected to claim task first, but claimed %#v", claims)
+	}
+	if claims := claim(); len(claims) != 0 {
+		t.Fatalf("Expected no task to be claimable, but claimed %#v", claims)
+	}
+	if _, err := queue.ReportException("first", "0", &tcqueue.TaskExceptionRequest{Reason: "worker-shutdown"}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	claims := claim()
+	if len(claims) != 1 || claims[0].Status.TaskID != "first" || claims[0].RunID != 1 {
+		t.Fatalf("Expected to claim retry of task first, but claimed %#v", claims)
+	}
+	if claims[0].Status.Runs[1].ReasonCreated != "retry" {
+		t.Fatalf("Expected run 1 to be a retry, but got %#v", claims[0].Status.Runs[1])
+	}
+	if _, err := queue.ReportCompleted("first", "1"); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if claims := claim(); len(claims) != 1 || claims[0].Status.TaskID != "second" {
+		t.Fatalf("Expected to claim dependent task, but claimed %#v", claims)
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	h := startHarness(t)
+	defer h.Close()
+	queue := h.Queue()
+
+	if _, err := queue.GetWorker("test-provisioner", "test-worker-type", "test-worker-group", "test-worker-id"); err == nil {
+		t.Fatal("Expected unknown worker not to be found")
+	}
+	request := &tcqueue.ClaimWorkRequest{
+		Tasks:       1,
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker-id",
+	}
+	// workers become known when they first claim work
+	if _, err := queue.ClaimWork("test-provisioner", "test-worker-type", request); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := queue.QuarantineWorker("test-provisioner", "test-worker-type", "test-worker-group", "test-worker-id", &tcqueue.QuarantineWorkerRequest{
+		QuarantineUntil: tcclient.Time(time.Now().Add(time.Hour)),
+	}); err != nil {
+		t.Fatalf("%v", err)
+	}
+	if _, err := h.CreateTask("task", newTask()); err != nil {
+		t.Fatalf("%v", err)
+	}
+	claims, err := queue.ClaimWork("test-provisioner", "test-worker-type", request)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	if len(claims.Tasks) != 0 {
+		t.Fatalf("Expected quarantined worker not to claim tasks, but claimed %#v", claims.Tasks)
+	}
+}
@@ -0,0 +1,85 @@
+package testharness
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const objectsPrefix = "/objects/"
+
+// objectURL returns the URL that the content of the given s3 artifact is
+// uploaded to, and downloaded from
+func (h *Harness) objectURL(taskID string, run int, name string) string {
+	return h.RootURL + objectsPrefix + url.PathEscape(taskID) + "/" + strconv.Itoa(run) + "/" + url.PathEscape(name)
+}
+
+// serveObject serves the content of s3 artifacts, at the URLs returned by
+// objectURL. Content is uploaded with PUT and downloaded with GET.
+func (h *Harness) serveObject(w http.ResponseWriter, r *http.Request) {
+	segments := strings.SplitN(strings.TrimPrefix(r.URL.EscapedPath(), objectsPrefix), "/", 3)
+	if len(segments) != 3 {
+		http.NotFound(w, r)
+		return
+	}
+	taskID, err1 := url.PathUnescape(segments[0])
+	name, err2 := url.PathUnescape(segments[2])
+	run, err3 := strconv.Atoi(segments[1])
+	if err1 != nil || err2 != nil || err3 != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		content, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("could not read request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		artifact := h.object(taskID, run, name)
+		if artifact == nil {
+			http.Error(w, fmt.Sprintf("artifact %v of run %v of task %v has not been created", name, run, taskID), http.StatusForbidden)
+			return
+		}
+		artifact.Content = content
+		artifact.ContentEncoding = r.Header.Get("Content-Encoding")
+	case "GET", "HEAD":
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		artifact := h.object(taskID, run, name)
+		if artifact == nil || artifact.Content == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", artifact.ContentType)
+		if artifact.ContentEncoding != "" {
+			w.Header().Set("Content-Encoding", artifact.ContentEncoding)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(artifact.Content)))
+		if r.Method == "GET" {
+			_, _ = w.Write(artifact.Content)
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// object returns the given s3 artifact, or nil if it doesn't exist. The
+// caller must hold h.mu.
+func (h *Harness) object(taskID string, run int, name string) *Artifact {
+	t, exists := h.tasks[taskID]
+	if !exists || run < 0 || run >= len(t.artifacts) {
+		return nil
+	}
+	artifact := t.artifacts[run][name]
+	if artifact == nil || artifact.StorageType != "s3" {
+		return nil
+	}
+	return artifact
+}
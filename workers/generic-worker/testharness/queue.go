@@ -0,0 +1,617 @@
+package testharness
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tcclient "github.com/taskcluster/taskcluster/v28/clients/client-go"
+	"github.com/taskcluster/taskcluster/v28/clients/client-go/tcqueue"
+)
+
+const queuePrefix = "/api/queue/v1/"
+
+// apiError is an error that the mock queue responds with
+type apiError struct {
+	statusCode int
+	message    string
+}
+
+func (err *apiError) Error() string {
+	return err.message
+}
+
+func badRequest(format string, v ...interface{}) error {
+	return &apiError{http.StatusBadRequest, fmt.Sprintf(format, v...)}
+}
+
+func notFound(format string, v ...interface{}) error {
+	return &apiError{http.StatusNotFound, fmt.Sprintf(format, v...)}
+}
+
+func conflict(format string, v ...interface{}) error {
+	return &apiError{http.StatusConflict, fmt.Sprintf(format, v...)}
+}
+
+// redirect is a response that redirects to url
+type redirect struct {
+	url string
+}
+
+// serveQueue serves the queue API methods that the mock queue implements
+func (h *Harness) serveQueue(w http.ResponseWriter, r *http.Request) {
+	// url path segments are escaped by tcclient, since e.g. artifact names
+	// contain slashes
+	route := []string{}
+	for _, segment := range strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), queuePrefix), "/") {
+		unescaped, err := url.QueryUnescape(segment)
+		if err != nil {
+			writeResponse(w, badRequest("invalid url path segment %q: %v", segment, err))
+			return
+		}
+		route = append(route, unescaped)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeResponse(w, badRequest("could not read request body: %v", err))
+		return
+	}
+	h.mu.Lock()
+	response := h.call(r.Method, route, body)
+	h.mu.Unlock()
+	writeResponse(w, response)
+}
+
+// call calls the queue API method with the given http method and route, and
+// returns its response object, or an error
+func (h *Harness) call(method string, route []string, body []byte) interface{} {
+	match := func(m string, pattern ...string) bool {
+		if m != method || len(pattern) != len(route) {
+			return false
+		}
+		for i, p := range pattern {
+			if p != "*" && p != route[i] {
+				return false
+			}
+		}
+		return true
+	}
+	switch {
+	case match("GET", "ping"):
+		return map[string]interface{}{"alive": true}
+	case match("PUT", "task", "*"):
+		var definition tcqueue.TaskDefinitionRequest
+		if err := json.Unmarshal(body, &definition); err != nil {
+			return badRequest("invalid task definition: %v", err)
+		}
+		status, err := h.createTask(route[1], &definition)
+		if err != nil {
+			return err
+		}
+		return &tcqueue.TaskStatusResponse{Status: status}
+	case match("GET", "task", "*"):
+		t, err := h.task(route[1])
+		if err != nil {
+			return err
+		}
+		return &t.definition
+	case match("GET", "task", "*", "status"):
+		t, err := h.task(route[1])
+		if err != nil {
+			return err
+		}
+		return &tcqueue.TaskStatusResponse{Status: t.copyStatus()}
+	case match("POST", "task", "*", "cancel"):
+		return h.cancelTask(route[1])
+	case match("POST", "claim-work", "*", "*"):
+		var request tcqueue.ClaimWorkRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			return badRequest("invalid claim work request: %v", err)
+		}
+		return h.claimWork(route[1], route[2], &request)
+	case match("POST", "task", "*", "runs", "*", "reclaim"):
+		return h.reclaimTask(route[1], route[3])
+	case match("POST", "task", "*", "runs", "*", "completed"):
+		return h.resolveRun(route[1], route[3], "completed", "completed")
+	case match("POST", "task", "*", "runs", "*", "failed"):
+		return h.resolveRun(route[1], route[3], "failed", "failed")
+	case match("POST", "task", "*", "runs", "*", "exception"):
+		var request tcqueue.TaskExceptionRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			return badRequest("invalid task exception request: %v", err)
+		}
+		return h.resolveRun(route[1], route[3], "exception", request.Reason)
+	case match("POST", "task", "*", "runs", "*", "artifacts", "*"):
+		return h.createArtifact(route[1], route[3], route[5], body)
+	case match("GET", "task", "*", "runs", "*", "artifacts", "*"):
+		return h.getArtifact(route[1], route[3], route[5])
+	case match("GET", "task", "*", "artifacts", "*"):
+		return h.getArtifact(route[1], "latest", route[3])
+	case match("GET", "task", "*", "runs", "*", "artifacts"):
+		return h.listArtifacts(route[1], route[3])
+	case match("GET", "task", "*", "artifacts"):
+		return h.listArtifacts(route[1], "latest")
+	case match("GET", "provisioners", "*", "worker-types", "*", "workers", "*", "*"):
+		worker, exists := h.workers[strings.Join([]string{route[1], route[3], route[5], route[6]}, "/")]
+		if !exists {
+			return notFound("worker %v/%v not found", route[5], route[6])
+		}
+		return worker
+	case match("PUT", "provisioners", "*", "worker-types", "*", "workers", "*", "*"):
+		var request tcqueue.QuarantineWorkerRequest
+		if err := json.Unmarshal(body, &request); err != nil {
+			return badRequest("invalid quarantine worker request: %v", err)
+		}
+		worker, exists := h.workers[strings.Join([]string{route[1], route[3], route[5], route[6]}, "/")]
+		if !exists {
+			return notFound("worker %v/%v not found", route[5], route[6])
+		}
+		worker.QuarantineUntil = request.QuarantineUntil
+		return worker
+	}
+	return notFound("the mock queue does not implement %v %v", method, queuePrefix+strings.Join(route, "/"))
+}
+
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	switch r := response.(type) {
+	case *redirect:
+		w.Header().Set("Location", r.url)
+		w.WriteHeader(http.StatusSeeOther)
+		return
+	case *apiError:
+		response = map[string]interface{}{
+			"code":    http.StatusText(r.statusCode),
+			"message": r.message,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(r.statusCode)
+	case error:
+		response = map[string]interface{}{
+			"code":    "InternalServerError",
+			"message": r.Error(),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+	}
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("WARNING: Could not write response of mock queue: %v", err)
+	}
+}
+
+func (h *Harness) task(taskID string) (*mockTask, error) {
+	t, exists := h.tasks[taskID]
+	if !exists {
+		return nil, notFound("task %v not found", taskID)
+	}
+	return t, nil
+}
+
+func (h *Harness) createTask(taskID string, definition *tcqueue.TaskDefinitionRequest) (tcqueue.TaskStatusStructure, error) {
+	if taskID == "" {
+		return tcqueue.TaskStatusStructure{}, badRequest("task ID is empty")
+	}
+	if _, exists := h.tasks[taskID]; exists {
+		return tcqueue.TaskStatusStructure{}, conflict("task %v already exists", taskID)
+	}
+	if definition.ProvisionerID == "" || definition.WorkerType == "" {
+		return tcqueue.TaskStatusStructure{}, badRequest("task %v has no provisionerId or workerType", taskID)
+	}
+	d := tcqueue.TaskDefinitionResponse{
+		Created:       definition.Created,
+		Deadline:      definition.Deadline,
+		Dependencies:  definition.Dependencies,
+		Expires:       definition.Expires,
+		Extra:         definition.Extra,
+		Metadata:      definition.Metadata,
+		Payload:       definition.Payload,
+		Priority:      definition.Priority,
+		ProvisionerID: definition.ProvisionerID,
+		Requires:      definition.Requires,
+		Retries:       definition.Retries,
+		Routes:        definition.Routes,
+		SchedulerID:   definition.SchedulerID,
+		Scopes:        definition.Scopes,
+		Tags:          definition.Tags,
+		TaskGroupID:   definition.TaskGroupID,
+		WorkerType:    definition.WorkerType,
+	}
+	// defaults of the queue
+	now := time.Now()
+	if time.Time(d.Created).IsZero() {
+		d.Created = tcclient.Time(now)
+	}
+	if time.Time(d.Deadline).IsZero() {
+		d.Deadline = tcclient.Time(now.Add(24 * time.Hour))
+	}
+	if time.Time(d.Expires).IsZero() {
+		d.Expires = tcclient.Time(time.Time(d.Deadline).AddDate(1, 0, 0))
+	}
+	if d.Dependencies == nil {
+		d.Dependencies = []string{}
+	}
+	if d.Extra == nil {
+		d.Extra = json.RawMessage(`{}`)
+	}
+	if d.Payload == nil {
+		d.Payload = json.RawMessage(`{}`)
+	}
+	if d.Priority == "" {
+		d.Priority = "lowest"
+	}
+	if d.Requires == "" {
+		d.Requires = "all-completed"
+	}
+	if d.Retries == 0 {
+		d.Retries = 5
+	}
+	if d.Routes == nil {
+		d.Routes = []string{}
+	}
+	if d.SchedulerID == "" {
+		d.SchedulerID = "-"
+	}
+	if d.Scopes == nil {
+		d.Scopes = []string{}
+	}
+	if d.Tags == nil {
+		d.Tags = map[string]string{}
+	}
+	if d.TaskGroupID == "" {
+		d.TaskGroupID = taskID
+	}
+	t := &mockTask{
+		definition: d,
+		status: tcqueue.TaskStatusStructure{
+			Deadline:      d.Deadline,
+			Expires:       d.Expires,
+			ProvisionerID: d.ProvisionerID,
+			RetriesLeft:   d.Retries,
+			Runs:          []tcqueue.RunInformation{},
+			SchedulerID:   d.SchedulerID,
+			State:         "unscheduled",
+			TaskGroupID:   d.TaskGroupID,
+			TaskID:        taskID,
+			WorkerType:    d.WorkerType,
+		},
+	}
+	h.tasks[taskID] = t
+	if h.dependenciesSatisfied(t) {
+		h.addRun(taskID, "scheduled")
+	}
+	return t.copyStatus(), nil
+}
+
+// dependenciesSatisfied returns true if the given task can be scheduled,
+// according to its dependencies and requires setting
+func (h *Harness) dependenciesSatisfied(t *mockTask) bool {
+	for _, dependency := range t.definition.Dependencies {
+		d, exists := h.tasks[dependency]
+		if !exists {
+			return false
+		}
+		switch d.status.State {
+		case "completed":
+		case "failed", "exception":
+			if t.definition.Requires != "all-resolved" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// addRun adds a pending run to the given task
+func (h *Harness) addRun(taskID, reasonCreated string) {
+	t := h.tasks[taskID]
+	t.status.Runs = append(t.status.Runs, tcqueue.RunInformation{
+		ReasonCreated: reasonCreated,
+		RunID:         int64(len(t.status.Runs)),
+		Scheduled:     tcclient.Time(time.Now()),
+		State:         "pending",
+	})
+	t.status.State = "pending"
+	t.artifacts = append(t.artifacts, map[string]*Artifact{})
+	h.pending = append(h.pending, taskID)
+}
+
+// run returns the given run of the given task, which is the most recent run
+// if runID is "latest"
+func (h *Harness) run(taskID, runID string) (*mockTask, int, error) {
+	t, err := h.task(taskID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if runID == "latest" {
+		if len(t.status.Runs) == 0 {
+			return nil, 0, notFound("task %v has no runs", taskID)
+		}
+		return t, len(t.status.Runs) - 1, nil
+	}
+	run, err := strconv.Atoi(runID)
+	if err != nil || run < 0 || run >= len(t.status.Runs) {
+		return nil, 0, notFound("task %v has no run %v", taskID, runID)
+	}
+	return t, run, nil
+}
+
+// runningRun returns the given run of the given task, or a conflict error if
+// the run is not running
+func (h *Harness) runningRun(taskID, runID string) (*mockTask, int, error) {
+	t, run, err := h.run(taskID, runID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if state := t.status.Runs[run].State; state != "running" {
+		return nil, 0, conflict("run %v of task %v is %v, not running", run, taskID, state)
+	}
+	return t, run, nil
+}
+
+func (h *Harness) claimWork(provisionerID, workerType string, request *tcqueue.ClaimWorkRequest) interface{} {
+	now := time.Now()
+	workerKey := strings.Join([]string{provisionerID, workerType, request.WorkerGroup, request.WorkerID}, "/")
+	worker, exists := h.workers[workerKey]
+	if !exists {
+		worker = &tcqueue.WorkerResponse{
+			Actions:       []tcqueue.WorkerAction{},
+			Expires:       tcclient.Time(now.AddDate(1, 0, 0)),
+			FirstClaim:    tcclient.Time(now),
+			ProvisionerID: provisionerID,
+			RecentTasks:   []tcqueue.TaskRun{},
+			WorkerGroup:   request.WorkerGroup,
+			WorkerID:      request.WorkerID,
+			WorkerType:    workerType,
+		}
+		h.workers[workerKey] = worker
+	}
+	response := &tcqueue.ClaimWorkResponse{
+		Tasks: []tcqueue.TaskClaim{},
+	}
+	if time.Time(worker.QuarantineUntil).After(now) {
+		return response
+	}
+	stillPending := []string{}
+	for _, taskID := range h.pending {
+		t := h.tasks[taskID]
+		if int64(len(response.Tasks)) >= request.Tasks || t.definition.ProvisionerID != provisionerID || t.definition.WorkerType != workerType {
+			stillPending = append(stillPending, taskID)
+			continue
+		}
+		run := len(t.status.Runs) - 1
+		takenUntil := tcclient.Time(now.Add(h.ClaimDuration))
+		t.status.Runs[run].State = "running"
+		t.status.Runs[run].Started = tcclient.Time(now)
+		t.status.Runs[run].TakenUntil = takenUntil
+		t.status.Runs[run].WorkerGroup = request.WorkerGroup
+		t.status.Runs[run].WorkerID = request.WorkerID
+		t.status.State = "running"
+		worker.RecentTasks = append(worker.RecentTasks, tcqueue.TaskRun{
+			RunID:  int64(run),
+			TaskID: taskID,
+		})
+		response.Tasks = append(response.Tasks, tcqueue.TaskClaim{
+			Credentials: taskCredentials(taskID, run),
+			RunID:       int64(run),
+			Status:      t.copyStatus(),
+			TakenUntil:  takenUntil,
+			Task:        t.definition,
+			WorkerGroup: request.WorkerGroup,
+			WorkerID:    request.WorkerID,
+		})
+	}
+	h.pending = stillPending
+	return response
+}
+
+// taskCredentials returns the temporary credentials of a task run, which the
+// harness accepts like any other credentials
+func taskCredentials(taskID string, run int) tcqueue.TaskCredentials {
+	return tcqueue.TaskCredentials{
+		AccessToken: "test-harness",
+		ClientID:    fmt.Sprintf("task-client/%v/%v", taskID, run),
+	}
+}
+
+func (h *Harness) reclaimTask(taskID, runID string) interface{} {
+	t, run, err := h.runningRun(taskID, runID)
+	if err != nil {
+		return err
+	}
+	takenUntil := tcclient.Time(time.Now().Add(h.ClaimDuration))
+	t.status.Runs[run].TakenUntil = takenUntil
+	return &tcqueue.TaskReclaimResponse{
+		Credentials: taskCredentials(taskID, run),
+		RunID:       int64(run),
+		Status:      t.copyStatus(),
+		TakenUntil:  takenUntil,
+		WorkerGroup: t.status.Runs[run].WorkerGroup,
+		WorkerID:    t.status.Runs[run].WorkerID,
+	}
+}
+
+// resolveRun resolves the given run. Like the queue, a run resolved with
+// exception worker-shutdown or intermittent-task is retried, if the task has
+// retries left.
+func (h *Harness) resolveRun(taskID, runID, state, reason string) interface{} {
+	t, run, err := h.runningRun(taskID, runID)
+	if err != nil {
+		return err
+	}
+	t.status.Runs[run].State = state
+	t.status.Runs[run].ReasonResolved = reason
+	t.status.Runs[run].Resolved = tcclient.Time(time.Now())
+	t.status.Runs[run].TakenUntil = tcclient.Time{}
+	t.status.State = state
+	retryReasons := map[string]string{
+		"worker-shutdown":   "retry",
+		"intermittent-task": "task-retry",
+	}
+	if reasonCreated, retry := retryReasons[reason]; retry && state == "exception" && t.status.RetriesLeft > 0 {
+		t.status.RetriesLeft--
+		h.addRun(taskID, reasonCreated)
+	} else {
+		h.scheduleDependents()
+	}
+	return &tcqueue.TaskStatusResponse{Status: t.copyStatus()}
+}
+
+// scheduleDependents schedules the unscheduled tasks whose dependencies are
+// now satisfied
+func (h *Harness) scheduleDependents() {
+	taskIDs := []string{}
+	for taskID, t := range h.tasks {
+		if t.status.State == "unscheduled" && h.dependenciesSatisfied(t) {
+			taskIDs = append(taskIDs, taskID)
+		}
+	}
+	// in a predictable order
+	sort.Strings(taskIDs)
+	for _, taskID := range taskIDs {
+		h.addRun(taskID, "scheduled")
+	}
+}
+
+func (h *Harness) cancelTask(taskID string) interface{} {
+	t, err := h.task(taskID)
+	if err != nil {
+		return err
+	}
+	now := tcclient.Time(time.Now())
+	switch t.status.State {
+	case "unscheduled":
+		t.status.Runs = append(t.status.Runs, tcqueue.RunInformation{
+			ReasonCreated: "exception",
+			RunID:         int64(len(t.status.Runs)),
+			Scheduled:     now,
+		})
+		t.artifacts = append(t.artifacts, map[string]*Artifact{})
+	case "pending", "running":
+		stillPending := []string{}
+		for _, id := range h.pending {
+			if id != taskID {
+				stillPending = append(stillPending, id)
+			}
+		}
+		h.pending = stillPending
+	default:
+		// already resolved
+		return &tcqueue.TaskStatusResponse{Status: t.copyStatus()}
+	}
+	run := len(t.status.Runs) - 1
+	t.status.Runs[run].State = "exception"
+	t.status.Runs[run].ReasonResolved = "canceled"
+	t.status.Runs[run].Resolved = now
+	t.status.Runs[run].TakenUntil = tcclient.Time{}
+	t.status.State = "exception"
+	h.scheduleDependents()
+	return &tcqueue.TaskStatusResponse{Status: t.copyStatus()}
+}
+
+func (h *Harness) createArtifact(taskID, runID, name string, body []byte) interface{} {
+	t, run, err := h.runningRun(taskID, runID)
+	if err != nil {
+		return err
+	}
+	var request struct {
+		StorageType string        `json:"storageType"`
+		ContentType string        `json:"contentType"`
+		Expires     tcclient.Time `json:"expires"`
+		URL         string        `json:"url"`
+		Reason      string        `json:"reason"`
+		Message     string        `json:"message"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return badRequest("invalid artifact request: %v", err)
+	}
+	artifact := &Artifact{
+		Name:        name,
+		StorageType: request.StorageType,
+		ContentType: request.ContentType,
+		Expires:     request.Expires,
+		URL:         request.URL,
+		Reason:      request.Reason,
+		Message:     request.Message,
+	}
+	if existing, exists := t.artifacts[run][name]; exists {
+		// like the queue, an artifact can only be created again with the
+		// same storage type, e.g. to upload it again after a failed upload
+		if existing.StorageType != artifact.StorageType {
+			return conflict("artifact %v of run %v of task %v already exists with storage type %v", name, run, taskID, existing.StorageType)
+		}
+		artifact.Content, artifact.ContentEncoding = existing.Content, existing.ContentEncoding
+	}
+	var response interface{}
+	switch artifact.StorageType {
+	case "s3":
+		response = &tcqueue.S3ArtifactResponse{
+			ContentType: artifact.ContentType,
+			Expires:     artifact.Expires,
+			PutURL:      h.objectURL(taskID, run, name),
+			StorageType: "s3",
+		}
+	case "reference":
+		response = &tcqueue.RedirectArtifactResponse{
+			StorageType: "reference",
+		}
+	case "error":
+		response = &tcqueue.ErrorArtifactResponse{
+			StorageType: "error",
+		}
+	default:
+		return badRequest("the mock queue does not support artifacts with storage type %q", artifact.StorageType)
+	}
+	t.artifacts[run][name] = artifact
+	return response
+}
+
+func (h *Harness) getArtifact(taskID, runID, name string) interface{} {
+	t, run, err := h.run(taskID, runID)
+	if err != nil {
+		return err
+	}
+	artifact, exists := t.artifacts[run][name]
+	if !exists {
+		return notFound("artifact %v of run %v of task %v not found", name, run, taskID)
+	}
+	switch artifact.StorageType {
+	case "reference":
+		return &redirect{url: artifact.URL}
+	case "error":
+		return &apiError{http.StatusFailedDependency, fmt.Sprintf("%v: %v", artifact.Reason, artifact.Message)}
+	}
+	return &redirect{url: h.objectURL(taskID, run, name)}
+}
+
+func (h *Harness) listArtifacts(taskID, runID string) interface{} {
+	t, run, err := h.run(taskID, runID)
+	if err != nil {
+		return err
+	}
+	response := &tcqueue.ListArtifactsResponse{
+		Artifacts: []tcqueue.Artifact{},
+	}
+	for _, artifact := range t.artifacts[run] {
+		response.Artifacts = append(response.Artifacts, tcqueue.Artifact{
+			ContentType: artifact.ContentType,
+			Expires:     artifact.Expires,
+			Name:        artifact.Name,
+			StorageType: artifact.StorageType,
+		})
+	}
+	sort.Slice(response.Artifacts, func(i, j int) bool {
+		return response.Artifacts[i].Name < response.Artifacts[j].Name
+	})
+	return response
+}
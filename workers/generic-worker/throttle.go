@@ -0,0 +1,194 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+var (
+	// worker-global throttles, or nil if no global limit is configured
+	globalDownloadThrottle *Throttle
+	globalUploadThrottle   *Throttle
+
+	// largest read made by a throttled reader, so that transfers are smooth
+	// rather than bursty
+	maxThrottledReadSize = 32 * 1024
+)
+
+// Throttle limits the rate of data transfer across all readers that share it.
+// It allows bursts of up to one second's worth of data.
+type Throttle struct {
+	sync.Mutex
+	bytesPerSec int64
+	// time at which all data transferred so far is within the limit
+	next time.Time
+	// total bytes transferred, and total time spent waiting
+	bytes  int64
+	waited time.Duration
+}
+
+// ThrottleState is a snapshot of a Throttle, for reporting in metrics
+type ThrottleState struct {
+	BytesPerSec int64   `json:"bytesPerSec"`
+	Bytes       int64   `json:"bytes"`
+	WaitedSecs  float64 `json:"waitedSecs"`
+}
+
+// NewThrottle returns a Throttle limiting transfers to the given number of
+// bytes per second, or nil (no limit) if bytesPerSec is zero.
+func NewThrottle(bytesPerSec int64) *Throttle {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return &Throttle{
+		bytesPerSec: bytesPerSec,
+	}
+}
+
+// wait blocks until n more bytes may be transferred within the limit
+func (t *Throttle) wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.Lock()
+	now := time.Now()
+	if earliest := now.Add(-time.Second); t.next.Before(earliest) {
+		t.next = earliest
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / t.bytesPerSec))
+	t.bytes += int64(n)
+	delay := t.next.Sub(now)
+	if delay > 0 {
+		t.waited += delay
+	}
+	t.Unlock()
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+func (t *Throttle) State() *ThrottleState {
+	if t == nil {
+		return nil
+	}
+	t.Lock()
+	defer t.Unlock()
+	return &ThrottleState{
+		BytesPerSec: t.bytesPerSec,
+		Bytes:       t.bytes,
+		WaitedSecs:  t.waited.Seconds(),
+	}
+}
+
+// ThrottledReader reads from an underlying reader, subject to the limits of
+// all of the given throttles
+type ThrottledReader struct {
+	reader    io.Reader
+	throttles []*Throttle
+}
+
+// throttledReader returns r unchanged if there are no throttles
+func throttledReader(r io.Reader, throttles []*Throttle) io.Reader {
+	if len(throttles) == 0 {
+		return r
+	}
+	return &ThrottledReader{
+		reader:    r,
+		throttles: throttles,
+	}
+}
+
+func (tr *ThrottledReader) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledReadSize {
+		p = p[:maxThrottledReadSize]
+	}
+	n, err := tr.reader.Read(p)
+	for _, t := range tr.throttles {
+		t.wait(n)
+	}
+	return n, err
+}
+
+// Represents the Bandwidth Throttling feature as a whole - one global
+// instance
+type ThrottleFeature struct {
+}
+
+func (feature *ThrottleFeature) Name() string {
+	return "Bandwidth Throttling"
+}
+
+func (feature *ThrottleFeature) Initialise() error {
+	globalDownloadThrottle = NewThrottle(int64(config.MaxDownloadBytesPerSec))
+	globalUploadThrottle = NewThrottle(int64(config.MaxUploadBytesPerSec))
+	return nil
+}
+
+func (feature *ThrottleFeature) PersistState() error {
+	return nil
+}
+
+func (feature *ThrottleFeature) IsEnabled(task *TaskRun) bool {
+	return globalDownloadThrottle != nil ||
+		globalUploadThrottle != nil ||
+		injectedUploadThrottle != nil ||
+		task.Payload.BandwidthLimits.MaxDownloadBytesPerSec > 0 ||
+		task.Payload.BandwidthLimits.MaxUploadBytesPerSec > 0
+}
+
+// Represents the Bandwidth Throttling feature for an individual task (one per
+// task)
+type ThrottleTask struct {
+	task *TaskRun
+	// limits from the task payload, or nil if not set
+	download *Throttle
+	upload   *Throttle
+}
+
+func (feature *ThrottleFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &ThrottleTask{
+		task:     task,
+		download: NewThrottle(task.Payload.BandwidthLimits.MaxDownloadBytesPerSec),
+		upload:   NewThrottle(task.Payload.BandwidthLimits.MaxUploadBytesPerSec),
+	}
+}
+
+func (tt *ThrottleTask) RequiredScopes() scopes.Expression {
+	// task limits can only reduce bandwidth, so no scopes required
+	return scopes.AllOf{}
+}
+
+func (tt *ThrottleTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+func (tt *ThrottleTask) Start() *CommandExecutionError {
+	tt.task.downloadThrottles = nonNilThrottles(globalDownloadThrottle, tt.download)
+	tt.task.uploadThrottles = nonNilThrottles(globalUploadThrottle, tt.upload, injectedUploadThrottle)
+	return nil
+}
+
+// Stop reports the state of the throttles, including time spent waiting
+// because of them. Note, the throttles stay in place on the task, since the
+// task log is uploaded after features have stopped.
+func (tt *ThrottleTask) Stop(err *ExecutionErrors) {
+	logEventWithFields("bandwidthThrottle", tt.task, time.Now(), map[string]interface{}{
+		"globalDownload": globalDownloadThrottle.State(),
+		"globalUpload":   globalUploadThrottle.State(),
+		"taskDownload":   tt.download.State(),
+		"taskUpload":     tt.upload.State(),
+	})
+}
+
+func nonNilThrottles(throttles ...*Throttle) []*Throttle {
+	result := []*Throttle{}
+	for _, t := range throttles {
+		if t != nil {
+			result = append(result, t)
+		}
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestThrottledReader(t *testing.T) {
+	data := make([]byte, 1536*1024)
+	throttle := NewThrottle(1024 * 1024)
+	start := time.Now()
+	n, err := io.Copy(ioutil.Discard, throttledReader(bytes.NewReader(data), []*Throttle{throttle}))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Could not read from throttled reader: %v", err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("Was expecting to read %v bytes but read %v", len(data), n)
+	}
+	// first second's worth of data is allowed as a burst, so remaining half
+	// a second's worth should be throttled
+	if elapsed < 400*time.Millisecond {
+		t.Fatalf("Was expecting throttled read to take at least 400ms, but it took %v", elapsed)
+	}
+	state := throttle.State()
+	if state.Bytes != int64(len(data)) {
+		t.Fatalf("Was expecting throttle to record %v bytes but it recorded %v", len(data), state.Bytes)
+	}
+	if state.WaitedSecs <= 0 {
+		t.Fatalf("Was expecting throttle to record time spent waiting, but it recorded %v", state.WaitedSecs)
+	}
+}
+
+func TestNoThrottle(t *testing.T) {
+	if NewThrottle(0) != nil {
+		t.Fatal("Was expecting a zero limit to mean no throttle")
+	}
+	r := bytes.NewReader([]byte("hello"))
+	if throttledReader(r, nonNilThrottles(nil, nil)) != r {
+		t.Fatal("Was expecting reader not to be wrapped when there are no throttles")
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+// NewTLSConfig returns the TLS config for HTTPS connections made by the
+// worker, which trusts the CA certificates of config setting caBundle in
+// addition to those of the system, and presents the client certificate of
+// config settings clientCertificate and clientKey. It returns nil if none of
+// these config settings are set.
+func NewTLSConfig(c *gwconfig.Config) (*tls.Config, error) {
+	if c.CABundle == "" && c.ClientCertificate == "" && c.ClientKey == "" {
+		return nil, nil
+	}
+	if (c.ClientCertificate == "") != (c.ClientKey == "") {
+		return nil, fmt.Errorf("Config settings \"clientCertificate\" and \"clientKey\" must either both be set, or both be empty")
+	}
+	tlsConfig := &tls.Config{}
+	if c.CABundle != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("Could not load the CA certificates of the system, to add the certificates of config setting \"caBundle\" to: %v", err)
+		}
+		pem, err := ioutil.ReadFile(c.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read config setting \"caBundle\" file %v: %v", c.CABundle, err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("Config setting \"caBundle\" file %v does not contain any PEM encoded certificates", c.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.ClientCertificate != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCertificate, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("Could not load client certificate %v with key %v (config settings \"clientCertificate\" and \"clientKey\"): %v", c.ClientCertificate, c.ClientKey, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// configureTLS applies the TLS config of the worker to the default HTTP
+// transport, which the Taskcluster clients, downloads and artifact uploads
+// all use
+func configureTLS(c *gwconfig.Config) error {
+	tlsConfig, err := NewTLSConfig(c)
+	if err != nil || tlsConfig == nil {
+		return err
+	}
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = tlsConfig
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func writePEM(t *testing.T, file, blockType string, bytes []byte) {
+	t.Helper()
+	err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsClient returns an HTTP client with the TLS config of the given worker
+// config
+func tlsClient(t *testing.T, c *gwconfig.Config) *http.Client {
+	t.Helper()
+	tlsConfig, err := NewTLSConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// client certificate for mutual TLS
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "generic-worker"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCertificate := filepath.Join(dir, "client.pem")
+	clientKey := filepath.Join(dir, "client-key.pem")
+	writePEM(t, clientCertificate, "CERTIFICATE", certDER)
+	writePEM(t, clientKey, "EC PRIVATE KEY", keyDER)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 || r.TLS.PeerCertificates[0].Subject.CommonName != "generic-worker" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequestClientCert,
+	}
+	server.StartTLS()
+	defer server.Close()
+	caBundle := filepath.Join(dir, "ca-bundle.pem")
+	writePEM(t, caBundle, "CERTIFICATE", server.Certificate().Raw)
+
+	// without caBundle the server certificate is not trusted
+	if _, err := tlsClient(t, &gwconfig.Config{}).Get(server.URL); err == nil {
+		t.Fatal("Was expecting server certificate not to be trusted without caBundle")
+	}
+
+	c := &gwconfig.Config{}
+	c.CABundle = caBundle
+	resp, err := tlsClient(t, c).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Was expecting server certificate to be trusted with caBundle, but got: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("Was expecting server to reject request without client certificate, but got %v", resp.Status)
+	}
+
+	c.ClientCertificate = clientCertificate
+	c.ClientKey = clientKey
+	resp, err = tlsClient(t, c).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Was expecting server to accept client certificate, but got %v", resp.Status)
+	}
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	if tlsConfig, err := NewTLSConfig(&gwconfig.Config{}); tlsConfig != nil || err != nil {
+		t.Fatalf("Was not expecting a TLS config without TLS config settings, but got %v, %v", tlsConfig, err)
+	}
+	for _, c := range []gwconfig.PublicConfig{
+		{ClientCertificate: "client.pem"},
+		{ClientKey: "client-key.pem"},
+		{CABundle: filepath.Join("testdata", "does-not-exist.pem")},
+		{CABundle: filepath.Join("testdata", "config", "valid.json")},
+	} {
+		if _, err := NewTLSConfig(&gwconfig.Config{PublicConfig: c}); err == nil {
+			t.Errorf("Was expecting an error for invalid TLS config settings %#v", c)
+		}
+	}
+}
@@ -19,6 +19,10 @@ const (
 	CANT_CREATE_ED25519_KEYPAIR ExitCode = 75
 	CANT_SAVE_CONFIG            ExitCode = 76
 	CANT_CONNECT_PROTOCOL_PIPE  ExitCode = 78
+	WORKER_UPDATED              ExitCode = 79
+	WORKER_ROLLED_BACK          ExitCode = 80
+	CONFIG_DRIFT                ExitCode = 81
+	CREDENTIALS_EXPIRED         ExitCode = 82
 )
 
 func usage(versionName string) string {
@@ -35,7 +39,12 @@ and reports back results to the queue.
                                             [--worker-runner-protocol-pipe PIPE]
                                             [--configure-for-aws | --configure-for-gcp | --configure-for-azure]` + installServiceSummary() + `
     generic-worker show-payload-schema
-    generic-worker new-ed25519-keypair      --file ED25519-PRIVATE-KEY-FILE` + customTargetsSummary() + `
+    generic-worker new-ed25519-keypair      --file ED25519-PRIVATE-KEY-FILE
+    generic-worker quarantine               [--config         CONFIG-FILE]
+                                            --duration DURATION
+    generic-worker task-history             [--task-id TASK-ID] [--result RESULT]
+                                            [--limit LIMIT]
+    generic-worker test-harness             [--port PORT]` + customTargetsSummary() + `
     generic-worker --help
     generic-worker --version
 
@@ -52,7 +61,26 @@ and reports back results to the queue.
     new-ed25519-keypair                     This will generate a fresh, new ed25519
                                             compliant private/public key pair. The public
                                             key will be written to stdout and the private
-                                            key will be written to the specified file.` + customTargets() + `
+                                            key will be written to the specified file.
+    quarantine                              Quarantines the worker in the queue, so that it
+                                            claims no tasks for the given duration, giving
+                                            operators a clean way to drain a bad machine. The
+                                            worker finishes any task it is running. A duration
+                                            of 0 ends the quarantine. The credentials in the
+                                            config file require scope
+                                            queue:quarantine-worker:<provisionerId>/
+                                            <workerType>/<workerGroup>/<workerId>.
+    task-history                            Outputs, as json, the task runs that the worker
+                                            resolved, most recent first, from the task history
+                                            database (see config setting taskHistoryMaxRuns)
+                                            in the current directory, which must be the
+                                            working directory of the worker.
+    test-harness                            Runs a mock taskcluster queue, and storage for
+                                            artifacts, until interrupted, for integration
+                                            testing workers and their configs without a real
+                                            taskcluster deployment. Point a worker at it by
+                                            setting config setting rootURL to the root URL
+                                            that it logs. Any credentials are accepted.` + customTargets() + `
 
   Options:
     --config CONFIG-FILE                    Json configuration file to use. See
@@ -83,7 +111,17 @@ and reports back results to the queue.
     --file PRIVATE-KEY-FILE                 The path to the file to write the private key
                                             to. The parent directory must already exist.
                                             If the file exists it will be overwritten,
-                                            otherwise it will be created.` + sidSID() + `
+                                            otherwise it will be created.
+    --duration DURATION                     How long to quarantine the worker for, such as
+                                            2h or 30m.
+    --task-id TASK-ID                       Only output runs of the given task.
+    --result RESULT                         Only output runs with the given result:
+                                            completed, failed or exception.
+    --limit LIMIT                           The maximum number of runs to output, or 0 for
+                                            all of them. [default: 0]
+    --port PORT                             The port for the test harness to listen on, on
+                                            the loopback interface. 0 means any unused port.
+                                            [default: 0]` + sidSID() + `
     --help                                  Display this help text.
     --version                               The release version of the generic-worker.
 
@@ -97,9 +135,11 @@ and reports back results to the queue.
         =========================
 
           accessToken                       Taskcluster access token used by generic worker
-                                            to talk to taskcluster queue.
+                                            to talk to taskcluster queue. Not required if
+                                            credentialProvider is not "static".
           clientId                          Taskcluster client ID used by generic worker to
-                                            talk to taskcluster queue.
+                                            talk to taskcluster queue. Not required if
+                                            credentialProvider is not "static".
           ed25519SigningKeyLocation         The ed25519 signing key for signing artifacts with.
           publicIP                          The IP address for clients to be directed to
                                             for serving live logs; see
@@ -116,28 +156,358 @@ and reports back results to the queue.
         ** OPTIONAL ** properties
         =========================
 
+          androidEmulatorAVD                The name of the Android Virtual Device that is
+                                            booted for tasks that enable
+                                            task.payload.features.androidEmulator. Required
+                                            if enabledFeatures includes "androidEmulator".
+          androidEmulatorBootTimeoutSecs    The maximum number of seconds to wait for the
+                                            Android emulator to finish booting, before the
+                                            task is resolved as exception. [default: 300]
+          androidEmulatorPort               The console port of the Android emulator. The
+                                            emulator's adb port is one higher.
+                                            [default: 5554]
+          androidEmulatorSnapshot           The snapshot of androidEmulatorAVD that the
+                                            emulator is booted from for each task. If empty,
+                                            the emulator cold boots. Either way, the emulator
+                                            state is not saved when the task completes.
+                                            [default: ""]
+          androidSDKRoot                    The directory of the Android SDK, containing the
+                                            emulator and platform-tools directories. If empty,
+                                            the ANDROID_SDK_ROOT environment variable of the
+                                            worker is used. [default: ""]
+          apiCircuitBreakerCooldownSecs     How many seconds Taskcluster API calls fail
+                                            immediately for, without being made, once
+                                            apiCircuitBreakerThreshold is reached. After that,
+                                            calls are made again, and the first to succeed
+                                            closes the circuit breaker. [default: 60]
+          apiCircuitBreakerThreshold        If non-zero, the number of consecutive Taskcluster
+                                            API calls that fail with intermittent errors,
+                                            after exhausting their retries, before the worker
+                                            stops making API calls for
+                                            apiCircuitBreakerCooldownSecs, and reports
+                                            "degraded" health on its control socket, rather
+                                            than retrying every call during an outage of the
+                                            deployment. [default: 5]
+          apiRetryBudgetSecs                The maximum number of seconds that each Taskcluster
+                                            API call is retried for, when it fails with a
+                                            network error, or HTTP status 5xx or 429, with
+                                            exponential backoff, waiting at least as long as
+                                            the Retry-After header of the response requests.
+                                            [default: 300]
+          artifactMirror                    If non-empty, every artifact file that is uploaded
+                                            is also copied to this secondary store, under
+                                            <taskId>/<runId>/<artifact name>. One of:
+                                              s3://<bucket>/<prefix> (Amazon S3, or any
+                                                S3-compatible store, see artifactMirrorEndpoint)
+                                              gs://<bucket>/<prefix> (Google Cloud Storage,
+                                                using HMAC keys)
+                                              file://<directory> (e.g. a mounted NAS path)
+                                            Artifacts are mirrored once the task has been
+                                            resolved, for at most 15 minutes per task. Failures
+                                            to mirror an artifact are retried (see
+                                            artifactMirrorRetries) and logged, but do not affect
+                                            the task resolution. [default: ""]
+          artifactMirrorAccessKeyId         The access key ID for s3 and gs artifact mirrors. If
+                                            not set, s3 mirrors use the default AWS credential
+                                            chain. [default: ""]
+          artifactMirrorEndpoint            The endpoint of an S3-compatible artifact mirror,
+                                            if not Amazon S3. [default: ""]
+          artifactMirrorRegion              The region of an s3 artifact mirror.
+                                            [default: "us-east-1"]
+          artifactMirrorRetries             The number of times to retry mirroring an artifact
+                                            before giving up. [default: 5]
+          artifactMirrorSecretAccessKey     The secret access key for s3 and gs artifact
+                                            mirrors. [default: ""]` + artifactSigningKeysUsage() + `
           authRootURL                       The root URL for taskcluster auth API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
+          autoscalerHook                    If non-empty, the autoscaler that is told when the
+                                            worker starts a task ("started-task"), resolves a
+                                            task ("finished-task"), has no task to run
+                                            ("became-idle") and quarantines itself or hits an
+                                            internal error ("unhealthy"), so that it never
+                                            terminates the worker while it runs a task. One of:
+                                              "aws"      The EC2 Auto Scaling group of instance
+                                                         instanceId in region. The instance is
+                                                         protected from scale in from when it
+                                                         starts a task until it becomes idle,
+                                                         and is set unhealthy when the worker
+                                                         is unhealthy. The worker needs AWS
+                                                         credentials allowing
+                                                         autoscaling:DescribeAutoScalingInstances,
+                                                         autoscaling:SetInstanceProtection and
+                                                         autoscaling:SetInstanceHealth, e.g.
+                                                         from the instance profile.
+                                              "command"  autoscalerHookCommand, with the event
+                                                         appended as its last argument.
+                                            Failures to signal the autoscaler are logged as
+                                            warnings. [default: ""]
+          autoscalerHookCommand             The command (and its arguments) that is run for
+                                            each lifecycle event, if autoscalerHook is
+                                            "command". It is killed if it takes more than a
+                                            minute. [default: []]
           availabilityZone                  The EC2 availability zone of the worker.
+          caBundle                          If non-empty, a file of PEM encoded CA certificates
+                                            that are trusted for HTTPS connections made by the
+                                            worker (e.g. to Taskcluster services, to download
+                                            mounts and fetches, and to artifact mirrors), in
+                                            addition to the CA certificates of the system. This
+                                            is needed in networks that intercept TLS. It does
+                                            not apply to connections made while loading the
+                                            worker config from the cloud provider, nor to
+                                            those made by tasks. [default: ""]
           cachesDir                         The directory where task caches should be stored on
                                             the worker. The directory will be created if it does
                                             not exist. This may be a relative path to the
                                             current directory, or an absolute path.
-                                            [default: "caches"]
+                                            [default: "caches"]` + caseSensitiveTaskDirectoriesUsage() + `
           certificate                       Taskcluster certificate, when using temporary
                                             credentials only.
+          checkDependencyArtifacts          If true, before downloading task.payload.mounts
+                                            and task.payload.fetches, the worker checks with
+                                            HEAD requests that the upstream artifacts that
+                                            they refer to exist. The task resolves as
+                                            malformed-payload, listing every missing
+                                            dependency artifact, if any do not, rather than
+                                            failing part way through its downloads.
+                                            [default: false]
+          checkForCancellationEverySecs     The number of seconds between consecutive checks of
+                                            the status of a running task, to see if it has been
+                                            cancelled. If so, task processes are killed, the
+                                            task log and artifacts gathered so far are uploaded,
+                                            and the worker moves on to the next task. A value
+                                            of 0 disables these checks, in which case a
+                                            cancellation is only noticed when the task is next
+                                            reclaimed. [default: 30]
+          checkForConfigDriftEverySecs      The number of seconds between consecutive
+                                            comparisons of the running config with the desired
+                                            config of the worker pool, when config setting
+                                            configDriftPolicy is non-empty. [default: 1800]
           checkForNewDeploymentEverySecs    The number of seconds between consecutive calls
                                             to the provisioner, to check if there has been a
                                             new deployment of the current worker type. If a
                                             new deployment is discovered, worker will shut
                                             down. See deploymentId property. [default: 1800]
+          checkForQuarantineEverySecs       The number of seconds between consecutive checks,
+                                            when not running a task, of whether the worker has
+                                            been quarantined in the queue (for example with
+                                            'generic-worker quarantine'). A quarantined worker
+                                            claims no tasks until its quarantine ends, and
+                                            does not reach its idle timeout in the meantime.
+                                            A value of 0 disables these checks. [default: 60]
+          checkForSelfUpdateEverySecs       The number of seconds between consecutive checks of
+                                            the self-update manifest, when not running a task.
+                                            See selfUpdateManifestURL property. [default: 3600]
+          chunkedArtifactUploads            Whether to upload artifacts with chunked transfer
+                                            encoding. Artifacts are compressed while they are
+                                            uploaded, rather than being compressed to a
+                                            temporary file first. Unless this is true, the
+                                            content of a compressed artifact is compressed
+                                            twice, since the length of the upload must first
+                                            be calculated. Only set to true if the artifact
+                                            storage of the deployment supports chunked
+                                            uploads (S3 presigned URLs do not).
+                                            [default: false]
+          circuitBreakerPatterns            Regular expressions that identify, in addition to
+                                            the built-in signatures, error messages of tasks
+                                            that indicate a problem with the worker rather
+                                            than the task. See circuitBreakerThreshold.
+                                            [default: []]
+          circuitBreakerQuarantineSecs      How many seconds the worker quarantines itself for
+                                            when circuitBreakerThreshold is reached.
+                                            [default: 86400]
+          circuitBreakerThreshold           If non-zero, the number of consecutive tasks that
+                                            must fail with problems that look like problems
+                                            with the worker (task exceptions with reason
+                                            internal-error or resource-unavailable, unless
+                                            task.payload.onExitStatus chose the reason, mount
+                                            failures caused by disk or network problems,
+                                            worker crashes such as failures to create task
+                                            users, and errors matching
+                                            circuitBreakerPatterns) before the worker
+                                            quarantines itself in the queue (see
+                                            circuitBreakerQuarantineSecs), so that a broken
+                                            machine doesn't resolve every pending task. A
+                                            workerCircuitBreakerTripped event is logged when
+                                            this happens. The credentials of the worker
+                                            require scope queue:quarantine-worker:<provisionerId>/
+                                            <workerType>/<workerGroup>/<workerId>. [default: 0]
+          claimExpiryMarginSecs             If non-zero, the number of seconds before the claim
+                                            of a running task expires at which the task is
+                                            aborted, along with any artifact uploads in
+                                            progress, if the claim could not be renewed. The
+                                            task is then resolved as exception with reason
+                                            worker-shutdown before its claim expires, so that
+                                            the queue retries it straight away, rather than
+                                            scheduling a new run while this worker is still
+                                            running it. A claimExpiring event is logged when
+                                            this happens. Must be less than 180, since claims
+                                            are renewed 3 minutes before they expire.
+                                            [default: 60]
+          claimFilterRoutes                 Routes that every task must have in order to be
+                                            run by this worker. See claimFilterTags.
+                                            [default: []]
+          claimFilterTags                   Tags (key/value pairs) that every task must have
+                                            in order to be run by this worker. This allows
+                                            workers with special hardware to share a worker
+                                            type with other workers, e.g. during a migration.
+                                            A claimed task that doesn't match claimFilterRoutes
+                                            and claimFilterTags is declined: its run is
+                                            resolved as exception with reason
+                                            resource-unavailable and the task is rerun, so
+                                            that a new pending run is available to other
+                                            workers, without counting against the retries of
+                                            the task. The credentials of the worker require
+                                            scope queue:rerun-task:* (or scopes for the
+                                            rerunTask API calls of the affected tasks).
+                                            [default: {}]
           cleanUpTaskDirs                   Whether to delete the home directories of the task
                                             users after the task completes. Normally you would
                                             want to do this to avoid filling up disk space,
                                             but for one-off troubleshooting, it can be useful
                                             to (temporarily) leave home directories in place.
                                             Accepted values: true or false. [default: true]
+          clientCertificate                 If non-empty, a file containing the PEM encoded
+                                            client certificate (optionally followed by its
+                                            intermediate certificates) that the worker presents
+                                            to servers that request one, for mutual TLS with
+                                            internal services. Requires clientKey.
+                                            [default: ""]
+          clientKey                         If non-empty, a file containing the PEM encoded
+                                            private key of clientCertificate. Requires
+                                            clientCertificate. [default: ""]
+          cloudMetadata                     If non-empty, the cloud that the worker runs on
+                                            ("aws", "azure" or "gcp"), whose instance
+                                            metadata service provides the config settings
+                                            workerId (the instance ID), workerGroup (the
+                                            region), instanceId, instanceType, imageId,
+                                            region, availabilityZone, publicIP, privateIP
+                                            and workerLocation that the config file doesn't
+                                            set. The instance metadata is also included in
+                                            the worker type metadata. Not needed when the
+                                            worker is configured with --configure-for-aws,
+                                            --configure-for-azure or --configure-for-gcp,
+                                            which already use instance metadata.
+                                            [default: ""]
+          configDriftPolicy                 What to do between tasks when the public config
+                                            settings of the latest worker config of the worker
+                                            pool in worker-manager differ from the running
+                                            config of the worker (which can happen without
+                                            a change of deploymentId). Every detected drift is
+                                            logged as a "configDrift" WORKER_METRICS event,
+                                            with hashes of both configs and the settings that
+                                            differ. One of:
+                                              ""            Don't check for config drift.
+                                              "report"      Only log the drift.
+                                              "restart"     Exit with exit code 81, so that the
+                                                            worker is restarted and picks up the
+                                                            desired config.
+                                              "reconfigure" Apply the desired settings to the
+                                                            running config, if the result is
+                                                            valid. Only these settings are
+                                                            applied: checkForConfigDriftEverySecs,
+                                                            checkForNewDeploymentEverySecs,
+                                                            checkForSelfUpdateEverySecs,
+                                                            idleTimeoutSecs, numberOfTasksToRun,
+                                                            requiredDiskSpaceMegabytes,
+                                                            shutdownMachineOnIdle and
+                                                            shutdownMachineOnInternalError.
+                                                            Other settings take effect when the
+                                                            worker is next restarted.
+                                            See also checkForConfigDriftEverySecs.
+                                            [default: ""]
+          confirmIndexRoutes                Whether to confirm, after a task has completed
+                                            successfully, that it has been indexed under each
+                                            of its "index.<namespace>" routes, since a missing
+                                            index entry breaks downstream tasks that look up
+                                            the task by namespace. Failures are logged as
+                                            "indexRouteMissing" WORKER_METRICS events, and
+                                            don't affect the resolution of the task. One of:
+                                              ""       Don't confirm index routes.
+                                              "verify" Wait for the index service to index
+                                                       the task, and report namespaces that
+                                                       it is not indexed under (unless a
+                                                       task of higher rank is indexed there).
+                                              "insert" Insert the task into the index using
+                                                       the task credentials, as the index
+                                                       service would, which requires task
+                                                       scope index:insert-task:<namespace>.
+                                            [default: ""]
+          containerHostHelperURL            In containerized worker mode, the base URL of an
+                                            HTTP service on the host that reboots or shuts
+                                            down the host when the worker POSTs a JSON object
+                                            with workerGroup, workerId and cause to
+                                            <containerHostHelperURL>/reboot or
+                                            <containerHostHelperURL>/shutdown. If not set,
+                                            the worker exits instead, so that the container
+                                            runtime can restart or remove it. [default: ""]
+          containerMode                     Whether the worker runs in containerized worker
+                                            mode, for running the worker itself inside a
+                                            container, such as on Kubernetes. One of "auto"
+                                            (detect whether the worker is running inside a
+                                            container, on Linux), "enabled" or "disabled".
+                                            In containerized worker mode, the multiuser
+                                            engine runs tasks as the current user, since task
+                                            users can't be created, a warning is logged if
+                                            tasksDir, cachesDir or downloadsDir are not
+                                            volumes bind-mounted from the host, and reboots
+                                            and shutdowns are requested from the host helper
+                                            (see containerHostHelperURL). Devices that tasks
+                                            need, such as /dev/kvm, must be passed through to
+                                            the container. [default: "auto"]
+          controlSocket                     If non-empty, the path of a Unix domain socket (or
+                                            on Windows, the name of a named pipe, such as
+                                            \\.\pipe\generic-worker) on which the worker
+                                            accepts control commands, so that host agents and
+                                            operators can query the current task, pause and
+                                            resume claiming, dump diagnostics or request a
+                                            graceful shutdown, without killing the worker.
+                                            Each command is a line of JSON such as
+                                            {"token": "...", "command": "status"}, to which
+                                            the worker replies with a line of JSON. Only the
+                                            worker user (or on Windows, SYSTEM and
+                                            Administrators) can connect, and controlToken must
+                                            be set. [default: ""]
+          controlToken                      The secret that each command sent to controlSocket
+                                            must include, in property "token".
+          credentialProvider                How the worker acquires its Taskcluster
+                                            credentials. One of:
+                                              "static"          Config settings clientId,
+                                                                accessToken and certificate.
+                                              "file"            The JSON file credentialsFile,
+                                                                with properties clientId,
+                                                                accessToken, and optionally
+                                                                certificate and expires. An
+                                                                external agent may replace
+                                                                the file with new credentials
+                                                                at any time, which are used
+                                                                from the next task.
+                                              "worker-manager"  Registering the worker with
+                                                                worker-manager, using the
+                                                                static provider
+                                                                workerManagerProviderId and
+                                                                workerManagerStaticSecret.
+                                              "aws"             Registering the worker with
+                                                                worker-manager, using the AWS
+                                                                provider workerManagerProviderId
+                                                                and the instance identity
+                                                                document of the instance.
+                                              "gcp"             Registering the worker with
+                                                                worker-manager, using the GCP
+                                                                provider workerManagerProviderId
+                                                                and the instance identity token
+                                                                of the instance.
+                                            Credentials that expire are renewed between tasks,
+                                            an hour (or a quarter of their lifetime, if that is
+                                            sooner) before they expire. If they expire without
+                                            being renewed, the worker exits with exit code 82.
+                                            For "worker-manager", "aws" and "gcp", the worker
+                                            pool is provisionerId/workerType, and the worker
+                                            is registered as workerGroup/workerId.
+                                            [default: "static"]
+          credentialsFile                   The path of the JSON file providing the
+                                            Taskcluster credentials of the worker, if
+                                            credentialProvider is "file". [default: ""]
           deploymentId                      If running with --configure-for-aws, then between
                                             tasks, at a chosen maximum frequency (see
                                             checkForNewDeploymentEverySecs property), the
@@ -147,6 +517,18 @@ and reports back results to the queue.
                                             different to the worker's current deploymentId, the
                                             worker will shut itself down. See
                                             https://bugzil.la/1298010
+          disableNetwork                    If true, all tasks run without network access, as
+                                            if task.payload.features.disableNetwork were
+                                            enabled, and tasks that enable
+                                            task.payload.features.network are resolved as
+                                            malformed-payload. On Linux, task commands run in
+                                            an empty network namespace (unless taskIsolation
+                                            already isolates them from the network), on macOS
+                                            taskIsolation must be sandboxExec, and on Windows
+                                            outbound connections of the task user are blocked
+                                            by a Windows Firewall rule. Not supported on
+                                            FreeBSD.
+                                            [default: false]
           disableReboots                    If true, no system reboot will be initiated by
                                             generic-worker program, but it will still return
                                             with exit code 67 if the system needs rebooting.
@@ -155,20 +537,163 @@ and reports back results to the queue.
                                             script to check for exit code 67, perform steps
                                             (such as formatting a hard drive) and then
                                             rebooting in the run-generic-worker.bat script.
-                                            [default: false]
+                                            [default: false]` + dockerUsage() + `
+          downloadConnections               The number of parallel range requests that large
+                                            URL and artifact mounts are downloaded with (see
+                                            multipartDownloadMinMB). 1 downloads all content
+                                            with a single request. [default: 4]
           downloadsDir                      The directory to cache downloaded files for
                                             populating preloaded caches and readonly mounts. The
                                             directory will be created if it does not exist. This
                                             may be a relative path to the current directory, or
                                             an absolute path. [default: "downloads"]
+          enableAuditTrail                  If true, significant actions of each task (the task
+                                            credentials used, content mounted, secrets fetched,
+                                            commands started and artifacts uploaded) are
+                                            recorded in an append-only audit trail, in which
+                                            each entry includes the SHA256 of the previous one.
+                                            The audit trail is published in the task artifact
+                                            public/logs/audit-trail.jsonl, and the SHA256 of its
+                                            last entry is included in the chain of trust
+                                            certificate. [default: false]
+          enableCostAccounting              If true, the resources consumed by each task (wall
+                                            time, CPU time, bytes downloaded and uploaded) are
+                                            published in the task artifact public/cost.json
+                                            together with an estimated cost based on
+                                            instanceHourlyCost, and are logged as worker
+                                            metrics. [default: false]
+          enableMachineInventory            If true, an inventory of the worker's hardware and
+                                            software (CPU model, memory, free disk space, OS
+                                            build, driver versions and the toolchain versions
+                                            listed in machineInventoryManifest) is collected
+                                            when each task starts, summarised in the task log,
+                                            and published in the task artifact
+                                            public/machine-inventory.json. The SHA256 of the
+                                            inventory is included in the chain of trust
+                                            certificate. [default: false]
+          enableResourceUsage               If true, the resources consumed by each task command
+                                            (wall time, user and system CPU time, peak memory,
+                                            and bytes read from and written to storage) are
+                                            published in the task artifact
+                                            public/resource-usage.json, and are logged as
+                                            worker metrics. CPU time, memory and storage are
+                                            not measured by the docker and kubernetes engines,
+                                            and memory and storage are not measured on
+                                            Windows. [default: false]
+          enabledFeatures                   The payload features that tasks may use on this
+                                            worker, so that worker pool owners can control
+                                            which capabilities their workers expose. A task
+                                            that uses a payload feature that is not listed
+                                            resolves as malformed-payload. The available
+                                            features, and scopes that tasks require in order
+                                            to use them, are:
+                                              androidEmulator     generic-worker:android-emulator:
+                                                                  <provisionerId>/<workerType>
+                                              chainOfTrust        (no scopes)
+                                              commandTrace        generic-worker:command-trace:
+                                                                  <provisionerId>/<workerType>
+                                              crashDumps          (no scopes)
+                                              display             (no scopes)
+                                              hostAliases         generic-worker:host-aliases:
+                                                                  <provisionerId>/<workerType>
+                                              iosSimulator        generic-worker:ios-simulator:
+                                                                  <provisionerId>/<workerType>
+                                              keychain            secrets:get:<name> for the
+                                                                  secret of each certificate
+                                              performanceCapture  generic-worker:performance-
+                                                                  capture:<provisionerId>/
+                                                                  <workerType>
+                                              progress            (no scopes)
+                                              rdpInfo             generic-worker:allow-rdp:
+                                                                  <provisionerId>/<workerType>
+                                              reproducible        (no scopes)
+                                              resultCache         generic-worker:result-cache:
+                                                                  <provisionerId>/<workerType>
+                                              runAsAdministrator  generic-worker:run-as-
+                                                                  administrator:<provisionerId>/
+                                                                  <workerType>
+                                              screenCapture       (no scopes)
+                                              secrets             secrets:get:<name> for each
+                                                                  secret
+                                              services            (no scopes)
+                                              signArtifacts       generic-worker:signing-key:
+                                                                  <provisionerId>/<workerType>/
+                                                                  <key> for each key
+                                              taskclusterProxy    (no scopes)
+                                            Not all features are available on all platforms.
+                                            Only these features are gated. Other payload
+                                            properties, such as mounts, fetches, writeFiles,
+                                            phases, rerun, retryPolicies, portLeases,
+                                            testResults, annotations, sbom and the network
+                                            settings, are available to all tasks, subject to
+                                            the scopes that they require.
+                                            [default: ["chainOfTrust", "rdpInfo",
+                                            "runAsAdministrator", "taskclusterProxy"]]
+          faketimeLibrary                   The path to the libfaketime shared library
+                                            (e.g. /usr/lib/x86_64-linux-gnu/faketime/
+                                            libfaketime.so.1) that is preloaded into task
+                                            commands when task.payload.reproducible.faketime
+                                            is true, so that they see a fixed clock starting
+                                            at SOURCE_DATE_EPOCH. Tasks that request faketime
+                                            resolve as malformed-payload if this is not set.
+                                            Not supported on Windows, nor by the docker
+                                            engine. [default: ""]
+          fileCountWatchdogIntervalSecs     How often, in seconds, the file count watchdog
+                                            counts the files in the task directory. See
+                                            fileCountWatchdogMaxTaskFiles. [default: 30]
+          fileCountWatchdogMaxTaskFiles     If non-zero, the maximum number of files
+                                            (including directories and links) in the task
+                                            directory, which includes mounted caches, since
+                                            some filers fall over when tasks create millions
+                                            of tiny files. When it is exceeded, the
+                                            directories with the most files are listed in the
+                                            task log, and the task is aborted, or fails if it
+                                            has already finished. Not supported by the docker
+                                            and kubernetes engines. [default: 0]
+          forcePrivateArtifacts             If true, artifacts whose names begin "public/"
+                                            (including the task log and artifacts that worker
+                                            features publish) are published with names
+                                            beginning "private/" instead, so that downloading
+                                            them requires scopes. Intended for worker pools
+                                            that run tasks with sensitive output. Tasks (and
+                                            tools) that fetch artifacts of tasks from such a
+                                            worker pool by name need to use the "private/"
+                                            names. [default: false]
           idleTimeoutSecs                   How many seconds to wait without getting a new
                                             task to perform, before the worker process exits.
                                             An integer, >= 0. A value of 0 means "never reach
                                             the idle state" - i.e. continue running
                                             indefinitely. See also shutdownMachineOnIdle.
                                             [default: 0]
+          imageId                           The ID of the machine image (e.g. the AMI) that
+                                            the worker instance was launched from. Used by
+                                            chain of trust.
+          indexRootURL                      The root URL for taskcluster index API calls.
+                                            If not provided, the value from config property
+                                            rootURL is used. Intended for development/testing.
+          instanceHourlyCost                The hourly cost of the worker instance, used by
+                                            cost accounting (see enableCostAccounting) to
+                                            estimate the cost of each task. If non-zero, it
+                                            overrides the cost from instancePricingURL.
+                                            [default: 0]
           instanceID                        The EC2 instance ID of the worker. Used by chain of trust.
+          instancePricingURL                If non-empty, and enableCostAccounting is true, a
+                                            URL of a JSON document of the hourly costs of
+                                            instance types, such as one generated from the
+                                            cloud provider's pricing data, of the form:
+                                            {"<region>/<instanceType>": <cost>,
+                                            "<instanceType>": <cost>, ...}
+                                            The cost of the instanceType and region of the
+                                            worker (typically from the cloud metadata, see
+                                            cloudMetadata) is looked up when the worker starts,
+                                            falling back to the entry for the instance type in
+                                            all regions. [default: ""]
           instanceType                      The EC2 instance Type of the worker. Used by chain of trust.
+          iosSimulatorBootTimeoutSecs       The maximum number of seconds to wait for the iOS
+                                            simulator of a task that sets
+                                            task.payload.iosSimulator to finish booting,
+                                            before the task is resolved as exception. Only
+                                            used on macOS. [default: 300]` + kubernetesUsage() + `
           livelogCertificate                SSL certificate to be used by livelog for hosting
                                             logs over https. If not set, http will be used.
           livelogExecutable                 Filepath of LiveLog executable to use; see
@@ -184,19 +709,195 @@ and reports back results to the queue.
                                             stateless dns server; see
                                             https://github.com/taskcluster/stateless-dns-server
                                             Optional if stateless DNS is not in use.
+          machineInventoryManifest          The path to a JSON file mapping toolchain names to
+                                            the command that outputs the installed version,
+                                            e.g. {"go": ["go", "version"]}, for inclusion in
+                                            the machine inventory (see
+                                            enableMachineInventory). [default: ""]
+          maintenanceAfterIdleSecs          The number of seconds the worker must have been
+                                            idle before it starts running maintenanceJobs.
+                                            [default: 60]
+          maintenanceJobs                   Jobs to run in the background while the worker is
+                                            idle, one at a time, e.g. cache garbage collection,
+                                            docker image pruning, SSD trimming or OS update
+                                            checks. Each job is an object with properties:
+                                              "name": name of the job (required)
+                                              "command": command to run (required), e.g.
+                                                  ["docker", "image", "prune", "-af"],
+                                                  ["fstrim", "-av"] or
+                                                  ["usoclient.exe", "StartScan"]
+                                              "intervalSecs": minimum number of seconds
+                                                  between runs of the job
+                                              "maxRunTimeSecs": time budget for each run,
+                                                  after which the job is killed (0 means
+                                                  no limit)
+                                            A running job is killed as soon as a task is
+                                            claimed, and is run again when the worker is next
+                                            idle. The output of each job is written to
+                                            maintenance/<name>.log in the worker's current
+                                            directory. [default: []]
+          maintenanceWindows                Scheduled periods during which the worker stops
+                                            claiming tasks, and once its current task (if any)
+                                            has been resolved, runs maintenance commands such
+                                            as OS updates or driver installs. Each window is an
+                                            object with properties:
+                                              "name": name of the window (required)
+                                              "schedule": cron expression of when the window
+                                                  starts, in UTC (required), with fields
+                                                  minute, hour, day of month, month and day
+                                                  of week, e.g. "0 2 * * 6" for 02:00 every
+                                                  Saturday
+                                              "durationMins": length of the window (required)
+                                              "commands": commands to run one after another,
+                                                  e.g. [["apt-get", "-y", "upgrade"]]
+                                              "rebootExitCodes": exit codes of the commands
+                                                  that mean that the worker should reboot at
+                                                  the end of the window (see disableReboots)
+                                            A window is skipped if the worker is still running
+                                            a task when it ends, and commands still running
+                                            when it ends are killed. The output of the commands
+                                            is written to maintenance-windows/<name>.log in the
+                                            worker's current directory. Each window logs
+                                            "maintenanceWindowStarted" and
+                                            "maintenanceWindowFinished" WORKER_METRICS events,
+                                            and while it runs, the status of the worker (see
+                                            controlSocket) has property "maintenanceWindow".
+                                            [default: []]
+          maxDownloadBytesPerSec            If non-zero, the maximum number of bytes per second
+                                            that the worker downloads for mounts and fetches,
+                                            across all downloads. Tasks may set a lower limit
+                                            in task.payload.bandwidthLimits. [default: 0]
+          maxPayloadBytes                   If non-zero, the maximum size in bytes of the task
+                                            payload. Tasks with larger payloads resolve as
+                                            malformed-payload before their payload is
+                                            validated. [default: 0]
+          maxTaskArtifacts                  If non-zero, the maximum number of artifacts in
+                                            task.payload.artifacts. Tasks with more artifacts
+                                            resolve as malformed-payload. [default: 0]
+          maxTaskArtifactsMB                If non-zero, the maximum total size in megabytes
+                                            of the artifacts of task.payload.artifacts. Tasks
+                                            may set a lower limit in
+                                            task.payload.maxArtifactsMB. If the artifacts of
+                                            a task are larger, none of them are uploaded, and
+                                            the task resolves as failed, listing its largest
+                                            artifacts. [default: 0]
+          maxTaskCommands                   If non-zero, the maximum number of commands in
+                                            task.payload.command. Tasks with more commands
+                                            resolve as malformed-payload. [default: 0]
+          maxTaskEnvBytes                   If non-zero, the maximum total size in bytes of
+                                            task.payload.env, counting each variable as
+                                            NAME=value. Tasks with larger environments
+                                            resolve as malformed-payload. [default: 0]
+          maxUploadBytesPerSec              If non-zero, the maximum number of bytes per second
+                                            that the worker uploads for artifacts, across all
+                                            uploads. Tasks may set a lower limit in
+                                            task.payload.bandwidthLimits. [default: 0]
+          memoryWatchdogIntervalSecs        How often, in seconds, the memory watchdog samples
+                                            the memory usage of the task and the available
+                                            memory of the system. See
+                                            memoryWatchdogMaxTaskRSSMB and
+                                            memoryWatchdogMinAvailableMB. [default: 5]
+          memoryWatchdogMaxTaskRSSMB        If non-zero, the maximum combined resident memory,
+                                            in megabytes, of the processes of a task. When it
+                                            is exceeded, a warning is written to the task log,
+                                            a snapshot of the processes of the task and the
+                                            memory of the system is uploaded as artifact
+                                            public/logs/memory-snapshot.json, and the task is
+                                            aborted, so that the kernel doesn't start killing
+                                            processes (possibly including the worker).
+                                            [default: 0]
+          memoryWatchdogMinAvailableMB      If non-zero, the task is aborted like with
+                                            memoryWatchdogMaxTaskRSSMB when the available
+                                            memory of the system, in megabytes, falls below
+                                            this value. [default: 0]
+          multipartDownloadMinMB            Content of at least this many megabytes is
+                                            downloaded with downloadConnections parallel range
+                                            requests, if the server supports range requests.
+                                            The SHA256 of the whole file is calculated once
+                                            all parts are downloaded. [default: 256]
+          notifyEmailAddress                If non-empty, an email will be sent to this address
+                                            via the taskcluster notify service whenever a task
+                                            resolves with one of the statuses listed in
+                                            notifyOnStatuses. Requires scope
+                                            notify:email:<notifyEmailAddress>. [default: ""]
+          notifyMatrixRoomId                If non-empty, a notice will be sent to this matrix
+                                            room via the taskcluster notify service whenever a
+                                            task resolves with one of the statuses listed in
+                                            notifyOnStatuses. Requires scope
+                                            notify:matrix-room:<notifyMatrixRoomId>.
+                                            [default: ""]
+          notifyOnStatuses                  A list of task resolution statuses for which
+                                            notifications should be sent (see
+                                            notifyEmailAddress, notifyMatrixRoomId and
+                                            notifyWebhookURL). Allowed values are "completed",
+                                            "failed" and "exception". If empty, no
+                                            notifications are sent. [default: []]
+          notifyRootURL                     The root URL for taskcluster notify API calls.
+                                            If not provided, the value from config property
+                                            rootURL is used. Intended for development/testing.
+          notifyWebhookURL                  If non-empty, a JSON document describing the task
+                                            resolution will be POSTed to this URL whenever a
+                                            task resolves with one of the statuses listed in
+                                            notifyOnStatuses. [default: ""]
           numberOfTasksToRun                If zero, run tasks indefinitely. Otherwise, after
                                             this many tasks, exit. [default: 0]
+          portLeaseMaxPort                  The highest port number that may be leased to
+                                            tasks that set task.payload.portLeases.
+                                            [default: 29999]
+          portLeaseMinPort                  The lowest port number that may be leased to tasks
+                                            that set task.payload.portLeases. The range should
+                                            not overlap the ephemeral port range of the OS.
+                                            [default: 20000]
+          portLeasesDir                     The directory in which port leases are recorded.
+                                            Workers that run on the same host and share this
+                                            directory never lease the same port to concurrent
+                                            tasks. [default: "generic-worker-port-leases" in
+                                            the OS temp directory]
           privateIP                         The private IP of the worker, used by chain of trust.
+          progressPort                      The port number of the local HTTP endpoint that
+                                            tasks which enable task.payload.features.progress
+                                            POST progress reports to. [default: 60099]
+          progressUpdateIntervalSecs        How often, in seconds, the latest progress report
+                                            of a task that enables
+                                            task.payload.features.progress is published as
+                                            artifact public/progress.json. [default: 60]
           provisionerId                     The taskcluster provisioner which is taking care
                                             of provisioning environments with generic-worker
                                             running on them. [default: "test-provisioner"]
+          proxyBypass                       Destinations that HTTPS and HTTP connections made
+                                            by the worker connect to directly rather than via
+                                            proxyURL. Each entry is a host name, which also
+                                            matches its subdomains (e.g. "example.com" matches
+                                            "example.com" and "www.example.com"), an IP
+                                            address, a CIDR range (e.g. "10.0.0.0/8"), or "*"
+                                            for all destinations, optionally followed by
+                                            ":<port>" to only match that port. Connections to
+                                            localhost and loopback addresses never use the
+                                            proxy. [default: []]
+          proxyPassword                     The password that the worker authenticates to
+                                            proxyURL with, if proxyUsername is set. Since it
+                                            is a secret, it is best provided by the secret
+                                            worker config of the worker pool. [default: ""]
+          proxyURL                          If non-empty, the URL of the proxy ("http://",
+                                            "https://" or "socks5://") that connections made
+                                            by the worker (e.g. to Taskcluster services, to
+                                            download mounts and fetches, and to upload
+                                            artifacts) use, apart from those that match
+                                            proxyBypass. Otherwise the environment variables
+                                            HTTPS_PROXY, HTTP_PROXY and NO_PROXY are honoured.
+                                            It does not apply to connections made while
+                                            loading the worker config from the cloud provider,
+                                            nor to those made by tasks. [default: ""]
+          proxyUsername                     If non-empty, the user name that the worker
+                                            authenticates to proxyURL with, together with
+                                            proxyPassword. [default: ""]
           purgeCacheRootURL                 The root URL for taskcluster purge cache API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
           queueRootURL                      The root URL for taskcluster queue API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
-          region                            The EC2 region of the worker. Used by chain of trust.
+          region                            The EC2 region of the worker. Used by chain of trust.` + registrySandboxUsage() + `
           requiredDiskSpaceMegabytes        The garbage collector will ensure at least this
                                             number of megabytes of disk space are available
                                             when each task starts. If it cannot free enough
@@ -218,6 +919,50 @@ and reports back results to the queue.
           secretsRootURL                    The root URL for taskcluster secrets API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
+          selfUpdateEd25519PublicKey        The base64 encoded ed25519 public key which
+                                            generic-worker binaries published in the
+                                            self-update manifest must be signed with. Required
+                                            if selfUpdateManifestURL is set.
+          selfUpdateHealthCheck             The command (and its arguments) that checks the
+                                            health of a version of generic-worker that the
+                                            worker has updated to, while it is on probation
+                                            (see selfUpdateManifestURL property). It is run
+                                            when the worker starts, and after each task, and
+                                            fails if it exits with a non-zero exit code, or
+                                            takes more than a minute. [default: []]
+          selfUpdateLabels                  Labels of the self-update rollout rings that this
+                                            worker belongs to, e.g. ["canary"]. See
+                                            selfUpdateManifestURL property. [default: []]
+          selfUpdateManifestURL             If non-empty, a URL of a JSON document describing
+                                            the generic-worker release that this worker should
+                                            run, of the form:
+                                            {"version": "<VERSION>", "binaries": {"<GOOS>/<GOARCH>/<ENGINE>":
+                                            {"url": "<URL>", "sha256": "<SHA256>", "signature": "<SIG>"}}}
+                                            where <SIG> is the base64 encoded ed25519 signature
+                                            of "<VERSION>\n<SHA256>", so that a binary can only
+                                            be installed as the version that it was signed
+                                            for. Between tasks (see
+                                            checkForSelfUpdateEverySecs) if the version differs
+                                            from the running version, the binary is downloaded,
+                                            verified and swapped in place of the running binary,
+                                            and the worker exits with exit code 79 so that it
+                                            can be restarted. The manifest may also contain a
+                                            "rollout" property, of the form:
+                                            {"percentage": <0-100>, "labels": ["<LABEL>", ...],
+                                            "rollbackAfterFailedTasks": <N>,
+                                            "rollbackAfterStarts": <M>,
+                                            "rollbackAfterFailedHealthChecks": <H>}
+                                            in which case only workers with a matching label
+                                            (see selfUpdateLabels) or within the given
+                                            percentage of workers are updated. If N tasks run
+                                            by the new version fail because of the worker (as
+                                            for circuitBreakerThreshold) before one succeeds,
+                                            or the worker is started M times without the new
+                                            version completing a task, or the new version
+                                            fails H health checks (see selfUpdateHealthCheck)
+                                            before completing a task, the worker restores its
+                                            previous binary, exits with exit code 80, and will
+                                            not update to that version again. [default: ""]
           sentryProject                     The project name used in https://sentry.io for
                                             reporting worker crashes. Permission to publish
                                             crash reports is granted via the scope
@@ -239,6 +984,18 @@ and reports back results to the queue.
                                             for machines running in production, such as on AWS
                                             EC2 spot instances. Use with caution!
                                             [default: false]
+          statusPagePort                    If non-zero, the port of a read-only web page,
+                                            with a json version at /status.json, that shows
+                                            the current task, recent task runs (see
+                                            taskHistoryMaxRuns), cache contents, free disk
+                                            space and memory, and a fingerprint of the public
+                                            config of the worker, for operators logged in to
+                                            the worker. Unless statusPageToken is set, the page
+                                            is only served on localhost. [default: 0]
+          statusPageToken                   If set, the status page (see statusPagePort) is
+                                            served on publicIP instead of localhost, and
+                                            requests must include this secret, as bearer
+                                            token or in query parameter "token".
           subdomain                         Subdomain to use in stateless dns name for live
                                             logs; see
                                             https://github.com/taskcluster/stateless-dns-server
@@ -248,8 +1005,33 @@ and reports back results to the queue.
                                             [default: "taskcluster-proxy"]
           taskclusterProxyPort              Port number for taskcluster-proxy HTTP requests.
                                             [default: 80]
+          taskEnvironmentCapture            When to publish the environment that the task
+                                            commands ran in, as the task artifact
+                                            private/task-environment.json, to help find out why
+                                            a task fails on the worker but not elsewhere: its
+                                            env vars (with secret values, and the values of
+                                            env vars whose names suggest secrets, redacted),
+                                            a listing of the task directory, and the versions
+                                            of the caches mounted by the task. One of "never",
+                                            "on-failure" and "always". [default: "on-failure"]
+          taskHistoryMaxRuns                The number of most recent task runs to keep in the
+                                            task history database of the worker, which records
+                                            the duration, result, resource usage and cache
+                                            hits of each task run that the worker resolves.
+                                            The Result Cache, Supersede and Warm Standby
+                                            features use it, and target task-history queries
+                                            it. 0 disables the database. [default: 1000]` + taskIsolationUsage() + `
           tasksDir                          The location where task directories should be
-                                            created on the worker. [default: ` + fmt.Sprintf("%q", defaultTasksDir()) + `]
+                                            created on the worker. [default: ` + fmt.Sprintf("%q", defaultTasksDir()) + `]` + taskUserPolicyUsage() + tccGrantsUsage() + `
+          warmStandby                       If true, while a task runs, the worker prepares
+                                            for the next task: it creates the next task user
+                                            (multiuser engine) or task directory (other
+                                            engines), and downloads the url mounts that at
+                                            least half of the recent tasks in the task history
+                                            database (see taskHistoryMaxRuns) used, and that
+                                            are not already cached. The worker waits for these
+                                            preparations to complete before it prepares the
+                                            next task, or exits. [default: false]` + windowsDefenderExclusionsUsage() + `
           workerGroup                       Typically this would be an aws region - an
                                             identifier to uniquely identify which pool of
                                             workers this worker logically belongs to.
@@ -272,9 +1054,15 @@ and reports back results to the queue.
                                             Otherwise TASKCLUSTER_WORKER_LOCATION environment
                                             variable will not be implicitly set in task commands.
                                             [default: ""]
+          workerManagerProviderId           The worker-manager provider that the worker
+                                            registers with, if credentialProvider is
+                                            "worker-manager", "aws" or "gcp". [default: ""]
           workerManagerRootURL              The root URL for taskcluster worker manager API calls.
                                             If not provided, the value from config property
                                             rootURL is used. Intended for development/testing.
+          workerManagerStaticSecret         The secret of the worker in the static provider
+                                            workerManagerProviderId of worker-manager, if
+                                            credentialProvider is "worker-manager".
           workerTypeMetaData                This arbitrary json blob will be included at the
                                             top of each task log. Providing information here,
                                             such as a URL to the code/config used to set up the
@@ -318,7 +1106,9 @@ and reports back results to the queue.
     70     A new deploymentId has been issued in the AWS worker type configuration, meaning
            this worker environment is no longer up-to-date. Typcially workers should
            terminate.
-    71     The worker was terminated via an interrupt signal (e.g. Ctrl-C pressed).
+    71     The worker was terminated via an interrupt signal (e.g. Ctrl-C pressed), or
+           a graceful shutdown was requested via its control socket (see
+           controlSocket).
     72     The worker is running on spot infrastructure in AWS EC2 and has been served a
            spot termination notice, and therefore has shut down.
     73     The config provided to the worker is invalid.` + exitCode74() + `
@@ -326,5 +1116,17 @@ and reports back results to the queue.
     76     Not able to save generic-worker config file after fetching it from AWS provisioner
            or Google Cloud metadata.` + exitCode77() + `
     78     Not able to connect to --worker-runner-protocol-pipe.
+    79     The worker has replaced its own binary with a different release of
+           generic-worker published in the self-update manifest (see config setting
+           selfUpdateManifestURL), and should be restarted.
+    80     The worker has rolled back to its previous generic-worker binary, since the
+           release it updated to failed its first tasks or failed to start (see config
+           setting selfUpdateManifestURL), and should be restarted.
+    81     The config of the worker differs from the desired config of its worker pool
+           in worker-manager, and config setting configDriftPolicy is "restart", so the
+           worker should be restarted in order to pick up the desired config.
+    82     The worker could not acquire Taskcluster credentials from its credential
+           provider (see config setting credentialProvider), or its credentials have
+           expired and could not be renewed.
 `
 }
@@ -0,0 +1,44 @@
+// +build multiuser simple
+
+package main
+
+func taskIsolationUsage() string {
+	return `
+          taskIsolation                     If "sandboxExec", task commands are run with
+                                            sandbox-exec, using the sandbox profile given by
+                                            taskIsolationSandboxProfile, for worker pools
+                                            that run untrusted code. The default profile
+                                            only allows writing to the task directory
+                                            (including mounted caches and fetched content)
+                                            and temporary directories, and denies network
+                                            access, unless the task enables
+                                            task.payload.features.network, which requires
+                                            scope generic-worker:network:<provisionerId>/<workerType>.
+                                            [default: ""]
+          taskIsolationSandboxProfile       The path to a sandbox profile to use instead of
+                                            the default one, when taskIsolation is
+                                            "sandboxExec". The parameters TASK_DIR (the task
+                                            directory) and ALLOW_NETWORK ("true" or "false")
+                                            are available to the profile via (param ...).
+                                            [default: ""]`
+}
+
+func tccGrantsUsage() string {
+	return `
+          tccGrants                         macOS privacy (TCC) permissions to grant without
+                                            prompting, so that tasks (such as UI automation)
+                                            don't hang on permission dialogs. Each grant is an
+                                            object with properties:
+                                              "service": TCC service, without kTCCService
+                                                  prefix, e.g. "ScreenCapture" or
+                                                  "Accessibility" (required)
+                                              "client": bundle identifier or absolute path
+                                                  of the program to grant the permission
+                                                  to, e.g. "com.apple.Terminal" (required)
+                                            Permissions held in the system TCC database (such
+                                            as ScreenCapture and Accessibility) are granted
+                                            when the worker starts, which requires the worker
+                                            to have Full Disk Access. Other permissions are
+                                            granted to the task user before each task.
+                                            [default: []]`
+}
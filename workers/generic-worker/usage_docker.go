@@ -0,0 +1,33 @@
+// +build docker
+
+package main
+
+func dockerUsage() string {
+	return `
+          dockerPinnedImages                Docker images that are never garbage collected,
+                                            such as images that are expensive to pull and
+                                            used by most tasks. Other images that tasks have
+                                            run in are removed, least recently used first,
+                                            when the free space of the docker root directory
+                                            falls below requiredDiskSpaceMegabytes.
+                                            [default: []]
+          dockerPullAttempts                The number of times the worker attempts to pull
+                                            the docker image of a task, before resolving the
+                                            task as exception. Failures that can't be
+                                            transient, such as missing images, are not
+                                            retried. Retries wait with exponential backoff,
+                                            and at least a minute if the registry rate
+                                            limited the pull. [default: 5]
+          dockerRegistryMirrors             Pull-through mirrors of Docker Hub, such as
+                                            "mirror.gcr.io", that images from Docker Hub are
+                                            pulled from, in order, before falling back to
+                                            Docker Hub itself, in order to avoid Docker Hub
+                                            rate limits. [default: []]
+          dockerRegistrySecrets             Maps docker registry host names (such as
+                                            "ghcr.io", or "docker.io" for Docker Hub) to
+                                            the name of the secret in the secrets service
+                                            with the credentials to log in to the registry
+                                            with, as string properties username and
+                                            password. Secrets are read with the worker
+                                            credentials at startup. [default: {}]`
+}
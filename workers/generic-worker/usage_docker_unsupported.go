@@ -0,0 +1,7 @@
+// +build !docker
+
+package main
+
+func dockerUsage() string {
+	return ""
+}
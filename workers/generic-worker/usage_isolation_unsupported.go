@@ -0,0 +1,11 @@
+// +build freebsd linux,docker darwin,docker linux,kubernetes darwin,kubernetes
+
+package main
+
+func taskIsolationUsage() string {
+	return ""
+}
+
+func tccGrantsUsage() string {
+	return ""
+}
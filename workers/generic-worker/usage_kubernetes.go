@@ -0,0 +1,29 @@
+// +build kubernetes
+
+package main
+
+func kubernetesUsage() string {
+	return `
+          kubernetesAPIServer               The URL of the Kubernetes API server that task
+                                            Jobs are created with. If empty, the API server
+                                            of the cluster that the worker runs in is used,
+                                            as advertised by env vars
+                                            KUBERNETES_SERVICE_HOST and
+                                            KUBERNETES_SERVICE_PORT. The worker always
+                                            authenticates with its pod service account.
+                                            [default: ""]
+          kubernetesNamespace               The namespace that task Jobs are created in. If
+                                            empty, the namespace of the worker pod is used.
+                                            [default: ""]
+          kubernetesSidecarImage            The container image of the init container that
+                                            copies the task directory into the pod of a task,
+                                            and of the sidecar that collects its artifacts
+                                            once the task command has exited. It must provide
+                                            /bin/sh, tar, mkfifo and nc. Both listen on port
+                                            8080 of the pod IP, and only transfer files once
+                                            the worker has sent them a random token of the
+                                            Job. Other pods that can connect to them can still
+                                            hold up the task, so a NetworkPolicy should only
+                                            allow the worker pod to connect to task pods.
+                                            [default: "busybox"]`
+}
@@ -0,0 +1,7 @@
+// +build !kubernetes
+
+package main
+
+func kubernetesUsage() string {
+	return ""
+}
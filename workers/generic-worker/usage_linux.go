@@ -0,0 +1,82 @@
+// +build multiuser simple
+
+package main
+
+func taskIsolationUsage() string {
+	return `
+          taskIsolation                     If non-empty, task commands are run in an isolated
+                                            environment, for worker pools that run untrusted
+                                            code. One of:
+                                              "bubblewrap": a bubblewrap (bwrap) sandbox,
+                                                  which gives cheap isolation without
+                                                  containers. The sandbox has a tmpfs root,
+                                                  private /tmp, /proc and /dev, and
+                                                  read-only bind mounts of the system
+                                                  directories (/usr, /etc, /opt etc). The
+                                                  task directory is bind mounted read-write
+                                                  at the same path. bwrap must be in the
+                                                  worker's PATH, and unprivileged user
+                                                  namespaces must be enabled.
+                                              "qemu": a QEMU VM that is booted for each
+                                                  task from taskIsolationVMImage (or from
+                                                  task.payload.vmImage), with a
+                                                  copy-on-write overlay, so the image is not
+                                                  modified. Commands are run in the VM over
+                                                  SSH. The task directory is copied to the
+                                                  same path in the VM before the commands
+                                                  run, and copied back after each command.
+                                                  The serial console of the VM is published
+                                                  as artifact public/logs/vm-console.log.
+                                                  qemu-system-x86_64, qemu-img and ssh must
+                                                  be in the worker's PATH, and KVM should be
+                                                  available.
+                                            Either way, the task directory (including mounted
+                                            caches and fetched content) has the same path in
+                                            the isolated environment, so artifacts are
+                                            collected from it as usual. There is no network
+                                            access, unless the task enables
+                                            task.payload.features.network, which requires
+                                            scope generic-worker:network:<provisionerId>/<workerType>.
+                                            [default: ""]
+          taskIsolationVMImage              The disk image (in any format supported by
+                                            qemu-img) that QEMU task VMs boot from, unless the
+                                            task specifies task.payload.vmImage. If empty,
+                                            tasks must specify task.payload.vmImage when
+                                            taskIsolation is "qemu". [default: ""]
+          taskIsolationVMMemoryMB           The memory of QEMU task VMs, in megabytes.
+                                            [default: 4096]
+          taskIsolationVMProcessorCount     The number of virtual processors of QEMU task
+                                            VMs. [default: 2]
+          taskIsolationVMSSHKey             The path of the SSH private key that is used to
+                                            connect to QEMU task VMs. Required if
+                                            taskIsolation is "qemu".
+          taskIsolationVMUsername           The user of QEMU task VMs that commands are run
+                                            as, via SSH. The user must be able to create the
+                                            task directory path in the VM (e.g. root).
+                                            Required if taskIsolation is "qemu".
+          taskNetworkNamespace              If true, the commands of each task with network
+                                            access are run in a network namespace of their
+                                            own, connected to the host by a veth pair with
+                                            NAT to the network of the host, and the bytes the
+                                            task receives and sends are published in artifact
+                                            public/network-traffic.json and logged as a
+                                            "taskNetworkTraffic" WORKER_METRICS event. This
+                                            makes it possible to detect tasks that hammer
+                                            external services. Requires generic-worker to run
+                                            as root, with ip (iproute2), iptables and (for the
+                                            multiuser engine) setpriv in its PATH. Tasks
+                                            cannot connect to services that listen on
+                                            loopback addresses of the host. Not supported
+                                            when taskIsolation is "qemu". [default: false]
+          taskNetworkSubnet                 The IPv4 subnet, of at least 4 addresses, of the
+                                            veth pair that connects the network namespace of
+                                            the task to the host, when taskNetworkNamespace is
+                                            true. The host gets the first address of the
+                                            subnet, and the task the second. Must not overlap
+                                            with networks that tasks connect to.
+                                            [default: "10.254.254.0/30"]`
+}
+
+func tccGrantsUsage() string {
+	return ""
+}
@@ -12,6 +12,26 @@ func runTasksAsCurrentUserUsage() string {
                                             the current OS user will be used. [default: false]`
 }
 
+func artifactSigningKeysUsage() string {
+	return `
+          artifactSigningKeys               The keys that tasks may sign their artifacts with
+                                            (see task.payload.signArtifacts), by key ID. Each
+                                            key has exactly one of:
+                                              "file"     The path of a file with the base64
+                                                         encoded ed25519 private key seed, as
+                                                         written by target new-ed25519-keypair,
+                                                         for ed25519 signatures.
+                                              "command"  A command line, run as the worker
+                                                         user, that reads the content to sign
+                                                         from standard input and writes the
+                                                         signature to standard output, e.g. with
+                                                         a key held in a hardware security
+                                                         module.
+                                            Using key <key> requires scope
+                                            generic-worker:signing-key:<provisionerId>/<workerType>/<key>.
+                                            [default: {}]`
+}
+
 func exitCode77() string {
 	return `
     77     Not able to apply required file access permissions to the generic-worker config
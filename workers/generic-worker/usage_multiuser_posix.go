@@ -0,0 +1,17 @@
+// +build multiuser,darwin multiuser,linux
+
+package main
+
+func taskUserPolicyUsage() string {
+	return `
+          taskUserPasswordLength            The length of the generated passwords of task
+                                            users. Lengths below 13 are raised to 13.
+                                            [default: 29]
+          taskUserSetupAttempts             How many times the worker attempts to create a
+                                            task user, and to log in to it (rebooting between
+                                            logon attempts), before giving up. [default: 3]
+          taskUserSetupQuarantineSecs       How many seconds the worker quarantines itself for
+                                            when it gives up creating or logging in to a task
+                                            user, so that it doesn't claim tasks it can't run.
+                                            0 disables quarantine. [default: 3600]`
+}
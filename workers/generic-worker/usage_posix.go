@@ -29,3 +29,15 @@ func exitCode74() string {
 func sidSID() string {
 	return ""
 }
+
+func registrySandboxUsage() string {
+	return ""
+}
+
+func caseSensitiveTaskDirectoriesUsage() string {
+	return ""
+}
+
+func windowsDefenderExclusionsUsage() string {
+	return ""
+}
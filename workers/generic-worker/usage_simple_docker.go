@@ -1,4 +1,4 @@
-// +build simple docker
+// +build simple docker kubernetes
 
 package main
 
@@ -6,6 +6,14 @@ func runTasksAsCurrentUserUsage() string {
 	return ``
 }
 
+func artifactSigningKeysUsage() string {
+	return ""
+}
+
 func exitCode77() string {
 	return ""
 }
+
+func taskUserPolicyUsage() string {
+	return ""
+}
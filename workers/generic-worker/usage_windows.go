@@ -54,6 +54,134 @@ func exitCode74() string {
            desktop.`
 }
 
+func taskIsolationUsage() string {
+	return `
+          taskIsolation                     If non-empty, task commands are run inside an
+                                            ephemeral environment that is created for each
+                                            task and destroyed afterwards, for worker pools
+                                            that run untrusted code. One of:
+                                              "windowsSandbox": a Windows Sandbox, with
+                                                  the task directory mapped into it
+                                              "hyperV": a Hyper-V VM created from
+                                                  taskIsolationVMImage, with the task
+                                                  directory copied in before each command
+                                                  and copied back out after it
+                                              "windowsContainer": a Docker Windows
+                                                  container of the image (and with the
+                                                  process or Hyper-V isolation mode) of
+                                                  task.payload.container, with the task
+                                                  directory mounted into it. Images must
+                                                  match the Windows build of the worker
+                                                  (process isolation), or must not be of a
+                                                  later build (Hyper-V isolation).
+                                            In each case, the task directory (including mounted
+                                            caches and fetched content) has the same path
+                                            inside the environment, and artifacts are
+                                            collected from it as usual. Commands run as the
+                                            built-in user of the environment, so the osGroups,
+                                            rdpInfo and runAsAdministrator payload features
+                                            are not supported, and services on the worker's
+                                            localhost (such as taskcluster-proxy) are not
+                                            reachable. [default: ""]
+          taskIsolationVMImage              The base VHDX image of Hyper-V task VMs. Each task
+                                            VM gets a differencing disk of this image, so it
+                                            is not modified. Required if taskIsolation is
+                                            "hyperV".
+          taskIsolationVMMemoryMB           The startup memory of Hyper-V task VMs, in
+                                            megabytes. [default: 4096]
+          taskIsolationVMPassword           The password of taskIsolationVMUsername.
+          taskIsolationVMProcessorCount     The number of virtual processors of Hyper-V task
+                                            VMs. [default: 2]
+          taskIsolationVMSwitch             The Hyper-V virtual switch to connect task VMs to.
+                                            If empty, task VMs have no network. [default: ""]
+          taskIsolationVMUsername           An administrator account of taskIsolationVMImage,
+                                            that commands are run as, via PowerShell Direct.
+                                            Required if taskIsolation is "hyperV".`
+}
+
+func taskUserPolicyUsage() string {
+	return `
+          taskUserGroups                    Local groups that task users are added to when
+                                            they are created, in addition to "Remote Desktop
+                                            Users". The groups must exist when the worker
+                                            starts. [default: []]
+          taskUserPasswordLength            The length of the generated passwords of task
+                                            users. Lengths below 13 are raised to 13. The
+                                            length must be no shorter than the minimum
+                                            password length of the local security policy,
+                                            which is checked when the worker starts.
+                                            Passwords always contain lowercase and uppercase
+                                            letters, a digit and a special character.
+                                            [default: 29]
+          taskUserProfilesDir               If non-empty, the directory that the profiles of
+                                            new users (including task users) are created in,
+                                            e.g. on a separate disk. The worker creates the
+                                            directory if needed, and sets it as the profiles
+                                            directory of the machine when it starts.
+                                            [default: ""]
+          taskUserRights                    User rights that task users are assigned when they
+                                            are created, such as "SeBatchLogonRight" or
+                                            "SeCreateSymbolicLinkPrivilege". The names are
+                                            validated when the worker starts. [default: []]
+          taskUserSetupAttempts             How many times the worker attempts to create a
+                                            task user, and to log in to it (rebooting between
+                                            logon attempts), before giving up. [default: 3]
+          taskUserSetupQuarantineSecs       How many seconds the worker quarantines itself for
+                                            when it gives up creating or logging in to a task
+                                            user, so that it doesn't claim tasks it can't run.
+                                            0 disables quarantine. [default: 3600]`
+}
+
+func tccGrantsUsage() string {
+	return ""
+}
+
+func registrySandboxUsage() string {
+	return `
+          registrySandbox                   If true, the registry settings of the task user
+                                            (HKEY_CURRENT_USER) are restored after each task to
+                                            how they were before the task, so that tasks that
+                                            change registry settings don't affect later tasks
+                                            that run as the same user. [default: false]
+          registrySandboxKeys               Registry keys under HKEY_LOCAL_MACHINE, such as
+                                            "HKLM\SOFTWARE\Policies", that are also restored
+                                            after each task if registrySandbox is true. The
+                                            changes that tasks make to the registry are
+                                            published in the public/registry-changes.json
+                                            artifact. [default: []]`
+}
+
+func caseSensitiveTaskDirectoriesUsage() string {
+	return `
+          caseSensitiveTaskDirectories      If true, task directories are made case sensitive
+                                            when they are created, so that tasks and mounts
+                                            can create files whose names only differ in case,
+                                            as found in node_modules trees and git
+                                            repositories. Directories created inside task
+                                            directories inherit the flag. Requires NTFS on
+                                            Windows 10 version 1803 or later, and the Windows
+                                            Subsystem for Linux feature on versions before
+                                            1903. [default: false]`
+}
+
+func windowsDefenderExclusionsUsage() string {
+	return `
+          windowsDefenderExclusions         If true, the task directories in the tasks
+                                            directory (see tasksDir), the caches directory (see
+                                            cachesDir) and the downloads directory (see
+                                            downloadsDir) are excluded from Windows Defender
+                                            scanning while the worker runs, and from Windows
+                                            Search indexing, since scanning files that tasks
+                                            write slows builds down considerably. Other
+                                            directories in the tasks directory, such as the
+                                            profiles of other users, are still scanned. The
+                                            worker fails to start if the caches or downloads
+                                            directory is the root of a volume, or contains the
+                                            profiles, Windows or Program Files directory. The
+                                            Defender exclusions are removed again when the
+                                            worker exits. [default: false]`
+}
+
 func sidSID() string {
 	return `
     --sid SID                               A SID to be granted full control of the
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+// number of recent tasks that predictions are based on
+const warmStandbyHistoryLength = 10
+
+// standby holds the preparations for the next task that are made while the
+// current task runs (see config setting warmStandby)
+var standby = &WarmStandby{}
+
+type (
+	// WarmStandbyFeature prepares the environment of the next task while the
+	// current task runs, see config setting warmStandby
+	WarmStandbyFeature struct {
+	}
+
+	WarmStandbyTask struct {
+		task *TaskRun
+	}
+
+	// WarmStandby runs preparations for the next task in the background
+	WarmStandby struct {
+		wg sync.WaitGroup
+		sync.Mutex
+		// name of the pre-created directory for the next task, if any
+		taskDirName string
+		// cache key -> prefetched url mount content
+		prefetched map[string]*Cache
+		err        error
+		// number of preparations still running
+		pending int
+	}
+
+	// WarmStandbyHistory lists the url mounts of the most recent tasks, oldest
+	// first
+	WarmStandbyHistory struct {
+		Tasks [][]*URLContent
+	}
+)
+
+func (feature *WarmStandbyFeature) Name() string {
+	return "Warm Standby"
+}
+
+func (feature *WarmStandbyFeature) Initialise() error {
+	return nil
+}
+
+func (feature *WarmStandbyFeature) PersistState() error {
+	return nil
+}
+
+func (feature *WarmStandbyFeature) IsEnabled(task *TaskRun) bool {
+	return config.WarmStandby
+}
+
+func (feature *WarmStandbyFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &WarmStandbyTask{
+		task: task,
+	}
+}
+
+func (ws *WarmStandbyTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (ws *WarmStandbyTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+// Start downloads in the background the url mounts that the next task is
+// likely to need, according to the mounts of this task and of the recent
+// tasks in the task history database, and creates the directory for the next
+// task, if the engine allows it. Since the task mounts are already in place,
+// this doesn't delay the task.
+func (ws *WarmStandbyTask) Start() *CommandExecutionError {
+	history := loadWarmStandbyHistory(ws.task)
+	history.add(urlMounts(ws.task))
+	predicted := []*URLContent{}
+	for _, uc := range history.predict() {
+		if _, inCache := fileCaches[uc.UniqueKey()]; !inCache {
+			predicted = append(predicted, uc)
+		}
+	}
+	if len(predicted) > 0 {
+		ws.task.Infof("[warm-standby] Prefetching %v mount(s) for the next task in the background", len(predicted))
+		standby.run("prefetch mounts", func() error {
+			standby.prefetch(predicted)
+			return nil
+		})
+	}
+	if standbyTaskDirectories {
+		taskDirName := "task_" + strconv.Itoa(int(time.Now().Unix()))
+		// the name is taken from the clock, so is the same as the current
+		// task directory if the task started in the same second
+		if taskDirName != filepath.Base(taskContext.TaskDir) {
+			standby.run("create task directory", func() error {
+				return standby.createTaskDir(taskDirName)
+			})
+		}
+	}
+	return nil
+}
+
+func (ws *WarmStandbyTask) Stop(err *ExecutionErrors) {
+}
+
+// run runs the given preparation for the next task in the background. A
+// panic is reported as an error by Collect.
+func (standby *WarmStandby) run(description string, prepare func() error) {
+	standby.wg.Add(1)
+	standby.Lock()
+	standby.pending++
+	standby.Unlock()
+	go func() {
+		defer standby.wg.Done()
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%v", r)
+			}
+			standby.Lock()
+			defer standby.Unlock()
+			standby.pending--
+			if err != nil && standby.err == nil {
+				standby.err = fmt.Errorf("Could not %v for next task: %v", description, err)
+			}
+		}()
+		err = prepare()
+	}()
+}
+
+// Pending returns true if preparations for the next task are still running
+func (standby *WarmStandby) Pending() bool {
+	standby.Lock()
+	defer standby.Unlock()
+	return standby.pending > 0
+}
+
+// Wait waits for the preparations for the next task to complete, leaving
+// their results for Collect. Task users and directories of the next task are
+// only protected from purgeOldTasks once their preparation completes.
+func (standby *WarmStandby) Wait() {
+	standby.wg.Wait()
+}
+
+// Collect waits for the preparations for the next task to complete, and adds
+// the prefetched mounts to the file caches. It returns the name of the
+// directory that was created for the next task, if any, and the first error
+// of a preparation. It must be called from the goroutine that runs tasks.
+func (standby *WarmStandby) Collect() (taskDirName string, err error) {
+	standby.wg.Wait()
+	standby.Lock()
+	defer standby.Unlock()
+	for key, cache := range standby.prefetched {
+		if _, inCache := fileCaches[key]; inCache {
+			// a task downloaded the content in the meantime
+			err := os.Remove(cache.Location)
+			if err != nil {
+				log.Printf("WARNING: Could not delete prefetched file %v: %v", cache.Location, err)
+			}
+			continue
+		}
+		cache.Owner = fileCaches
+		fileCaches[key] = cache
+	}
+	taskDirName, err = standby.taskDirName, standby.err
+	standby.taskDirName, standby.prefetched, standby.err = "", nil, nil
+	return
+}
+
+// prefetch downloads the given url mounts. Since a prediction may be wrong,
+// failed downloads are only logged.
+func (standby *WarmStandby) prefetch(contents []*URLContent) {
+	task := &TaskRun{
+		logWriter:         log.Writer(),
+		downloadThrottles: nonNilThrottles(globalDownloadThrottle),
+	}
+	for _, uc := range contents {
+		file, sha256, validators, err := uc.download(task)
+		if err != nil {
+			log.Printf("WARNING: [warm-standby] Could not prefetch %v: %v", uc, err)
+			_ = os.Remove(file)
+			continue
+		}
+		if uc.Sha256 != "" && uc.Sha256 != sha256 {
+			log.Printf("WARNING: [warm-standby] Prefetched %v has SHA256 %v but recent tasks required %v", uc, sha256, uc.Sha256)
+			_ = os.Remove(file)
+			continue
+		}
+		standby.Lock()
+		if standby.prefetched == nil {
+			standby.prefetched = map[string]*Cache{}
+		}
+		standby.prefetched[uc.UniqueKey()] = &Cache{
+			Location:   file,
+			Created:    time.Now(),
+			Key:        uc.UniqueKey(),
+			SHA256:     sha256,
+			Validators: validators,
+		}
+		standby.Unlock()
+	}
+}
+
+// createTaskDir creates the given task directory, with the directory for the
+// task log
+func (standby *WarmStandby) createTaskDir(taskDirName string) error {
+	taskDir := filepath.Join(config.TasksDir, taskDirName)
+	err := os.MkdirAll(taskDir, 0777)
+	if err == nil {
+		err = os.MkdirAll(filepath.Join(taskDir, filepath.Dir(logPath)), 0700)
+	}
+	if err != nil {
+		return err
+	}
+	standby.Lock()
+	defer standby.Unlock()
+	standby.taskDirName = taskDirName
+	return nil
+}
+
+// urlMounts returns the url content of the read only directory and file
+// mounts of the given task
+func urlMounts(task *TaskRun) []*URLContent {
+	contents := []*URLContent{}
+	for _, m := range task.Payload.Mounts {
+		var mount struct {
+			Content json.RawMessage `json:"content"`
+		}
+		// invalid mounts are reported by the Mounts feature
+		if err := json.Unmarshal(m, &mount); err != nil || mount.Content == nil {
+			continue
+		}
+		fsContent, err := FSContentFrom(mount.Content)
+		if uc, isURL := fsContent.(*URLContent); err == nil && isURL {
+			contents = append(contents, uc)
+		}
+	}
+	return contents
+}
+
+// loadWarmStandbyHistory returns the url mounts of the most recent tasks in
+// the task history database, apart from the given task
+func loadWarmStandbyHistory(task *TaskRun) *WarmStandbyHistory {
+	history := &WarmStandbyHistory{}
+	records, err := taskHistory.Query(nil, warmStandbyHistoryLength)
+	if err != nil {
+		task.Warnf("[warm-standby] Could not read task history database: %v", err)
+		return history
+	}
+	for i := len(records) - 1; i >= 0; i-- {
+		history.add(records[i].Mounts)
+	}
+	return history
+}
+
+// add adds the url mounts of a task to the history, dropping the oldest task
+// once the history is full
+func (history *WarmStandbyHistory) add(contents []*URLContent) {
+	history.Tasks = append(history.Tasks, contents)
+	if len(history.Tasks) > warmStandbyHistoryLength {
+		history.Tasks = history.Tasks[len(history.Tasks)-warmStandbyHistoryLength:]
+	}
+}
+
+// predict returns the url mounts that at least two, and at least half, of
+// the recent tasks had, in the order in which they first appear, with the
+// required SHA256 of the most recent task that had them
+func (history *WarmStandbyHistory) predict() []*URLContent {
+	counts := map[string]int{}
+	latest := map[string]*URLContent{}
+	keys := []string{}
+	for _, contents := range history.Tasks {
+		seen := map[string]bool{}
+		for _, uc := range contents {
+			key := uc.UniqueKey()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			if counts[key] == 0 {
+				keys = append(keys, key)
+			}
+			counts[key]++
+			latest[key] = uc
+		}
+	}
+	threshold := (len(history.Tasks) + 1) / 2
+	if threshold < 2 {
+		threshold = 2
+	}
+	predicted := []*URLContent{}
+	for _, key := range keys {
+		if counts[key] >= threshold {
+			predicted = append(predicted, latest[key])
+		}
+	}
+	return predicted
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/taskcluster/taskcluster/v28/workers/generic-worker/gwconfig"
+)
+
+func TestWarmStandbyPredict(t *testing.T) {
+	history := &WarmStandbyHistory{}
+	toolchain := &URLContent{URL: "https://example.com/toolchain.tar.gz"}
+	for i := 0; i < 12; i++ {
+		contents := []*URLContent{
+			{URL: fmt.Sprintf("https://example.com/task-%v.zip", i)},
+		}
+		if i%3 != 0 {
+			contents = append(contents, toolchain)
+		}
+		history.add(contents)
+	}
+	if len(history.Tasks) != warmStandbyHistoryLength {
+		t.Fatalf("Expected history of %v tasks, but got %v", warmStandbyHistoryLength, len(history.Tasks))
+	}
+	predicted := history.predict()
+	if len(predicted) != 1 || predicted[0].URL != toolchain.URL {
+		t.Fatalf("Expected only %v to be predicted, but got %v", toolchain.URL, predicted)
+	}
+
+	// a single task is not a history
+	history = &WarmStandbyHistory{}
+	history.add([]*URLContent{toolchain})
+	if predicted := history.predict(); len(predicted) != 0 {
+		t.Fatalf("Expected no predictions from a single task, but got %v", predicted)
+	}
+}
+
+func TestWarmStandbyPrefetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	defer os.RemoveAll(dir)
+	config = &gwconfig.Config{}
+	defer func() {
+		config = nil
+	}()
+	config.DownloadsDir = dir
+	defer func(caches CacheMap) {
+		fileCaches = caches
+	}(fileCaches)
+	fileCaches = CacheMap{}
+
+	ws := &WarmStandby{}
+	ws.run("prefetch mounts", func() error {
+		ws.prefetch([]*URLContent{
+			{URL: server.URL + "/toolchain"},
+			{URL: server.URL + "/missing"},
+		})
+		return nil
+	})
+	taskDirName, err := ws.Collect()
+	if err != nil || taskDirName != "" {
+		t.Fatalf("Expected no error and no task directory, but got %q and %v", taskDirName, err)
+	}
+	if len(fileCaches) != 1 {
+		t.Fatalf("Expected only the successful prefetch to be cached, but got %v", fileCaches)
+	}
+	cache := fileCaches["urlcontent:"+server.URL+"/toolchain"]
+	if cache == nil {
+		t.Fatalf("Prefetched content not cached: %v", fileCaches)
+	}
+	b, err := ioutil.ReadFile(cache.Location)
+	if err != nil || string(b) != "content of /toolchain" {
+		t.Fatalf("Prefetched file %v has content %q (%v)", cache.Location, b, err)
+	}
+
+	ws.run("create task user", func() error {
+		panic("user creation failed")
+	})
+	ws.Wait()
+	if ws.Pending() {
+		t.Fatalf("Expected no pending preparations after Wait")
+	}
+	_, err = ws.Collect()
+	if err == nil || err.Error() != "Could not create task user for next task: user creation failed" {
+		t.Fatalf("Expected panic of preparation to be reported, but got %v", err)
+	}
+	if _, err = ws.Collect(); err != nil {
+		t.Fatalf("Expected error to be reported only once, but got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package win32
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	netapi32 = NewLazyDLL("netapi32.dll")
+
+	procLsaOpenPolicy         = advapi32.NewProc("LsaOpenPolicy")
+	procLsaAddAccountRights   = advapi32.NewProc("LsaAddAccountRights")
+	procLsaClose              = advapi32.NewProc("LsaClose")
+	procLsaNtStatusToWinError = advapi32.NewProc("LsaNtStatusToWinError")
+	procNetUserModalsGet      = netapi32.NewProc("NetUserModalsGet")
+	procNetApiBufferFree      = netapi32.NewProc("NetApiBufferFree")
+)
+
+const (
+	POLICY_CREATE_ACCOUNT = 0x00000010
+	POLICY_LOOKUP_NAMES   = 0x00000800
+)
+
+// https://docs.microsoft.com/en-us/windows/win32/api/lsalookup/ns-lsalookup-lsa_unicode_string
+type LSA_UNICODE_STRING struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/lsalookup/ns-lsalookup-lsa_object_attributes
+type LSA_OBJECT_ATTRIBUTES struct {
+	Length                   uint32
+	RootDirectory            syscall.Handle
+	ObjectName               *LSA_UNICODE_STRING
+	Attributes               uint32
+	SecurityDescriptor       uintptr
+	SecurityQualityOfService uintptr
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/ns-lmaccess-user_modals_info_0
+type USER_MODALS_INFO_0 struct {
+	MinPasswdLen    uint32
+	MaxPasswdAge    uint32
+	MinPasswdAge    uint32
+	ForceLogoff     uint32
+	PasswordHistLen uint32
+}
+
+// logonRights are the user rights that are not privileges, so are not known
+// to LookupPrivilegeValue
+var logonRights = map[string]bool{
+	"SeBatchLogonRight":                 true,
+	"SeDenyBatchLogonRight":             true,
+	"SeDenyInteractiveLogonRight":       true,
+	"SeDenyNetworkLogonRight":           true,
+	"SeDenyRemoteInteractiveLogonRight": true,
+	"SeDenyServiceLogonRight":           true,
+	"SeInteractiveLogonRight":           true,
+	"SeNetworkLogonRight":               true,
+	"SeRemoteInteractiveLogonRight":     true,
+	"SeServiceLogonRight":               true,
+}
+
+// ValidUserRight returns whether name is the name of a user right (a
+// privilege or a logon right) that LsaAddAccountRights accepts
+func ValidUserRight(name string) bool {
+	if logonRights[name] {
+		return true
+	}
+	namePtr, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return false
+	}
+	var luid windows.LUID
+	return windows.LookupPrivilegeValue(nil, namePtr, &luid) == nil
+}
+
+func lsaUnicodeString(s string) (LSA_UNICODE_STRING, error) {
+	buffer, err := syscall.UTF16FromString(s)
+	if err != nil {
+		return LSA_UNICODE_STRING{}, err
+	}
+	// lengths are in bytes, and exclude the terminating null character
+	return LSA_UNICODE_STRING{
+		Length:        uint16((len(buffer) - 1) * 2),
+		MaximumLength: uint16(len(buffer) * 2),
+		Buffer:        &buffer[0],
+	}, nil
+}
+
+func lsaError(function string, status uintptr) error {
+	r1, _, _ := procLsaNtStatusToWinError.Call(status)
+	return fmt.Errorf("%v failed: %v", function, syscall.Errno(r1))
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/ntsecapi/nf-ntsecapi-lsaaddaccountrights
+//
+// AddAccountRights assigns the given user rights to the account with the
+// given SID, via the local security authority
+func AddAccountRights(sid *windows.SID, rights []string) error {
+	if len(rights) == 0 {
+		return nil
+	}
+	userRights := make([]LSA_UNICODE_STRING, len(rights))
+	for i, right := range rights {
+		var err error
+		userRights[i], err = lsaUnicodeString(right)
+		if err != nil {
+			return err
+		}
+	}
+	var objectAttributes LSA_OBJECT_ATTRIBUTES
+	var policy syscall.Handle
+	r1, _, _ := procLsaOpenPolicy.Call(
+		0,
+		uintptr(unsafe.Pointer(&objectAttributes)),
+		uintptr(POLICY_CREATE_ACCOUNT|POLICY_LOOKUP_NAMES),
+		uintptr(unsafe.Pointer(&policy)),
+	)
+	if r1 != 0 {
+		return lsaError("LsaOpenPolicy", r1)
+	}
+	defer procLsaClose.Call(uintptr(policy))
+	r1, _, _ = procLsaAddAccountRights.Call(
+		uintptr(policy),
+		uintptr(unsafe.Pointer(sid)),
+		uintptr(unsafe.Pointer(&userRights[0])),
+		uintptr(len(userRights)),
+	)
+	if r1 != 0 {
+		return lsaError("LsaAddAccountRights", r1)
+	}
+	return nil
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/lmaccess/nf-lmaccess-netusermodalsget
+//
+// MinimumPasswordLength returns the minimum password length of the local
+// security policy
+func MinimumPasswordLength() (uint32, error) {
+	var info *USER_MODALS_INFO_0
+	r1, _, _ := procNetUserModalsGet.Call(
+		0,
+		0,
+		uintptr(unsafe.Pointer(&info)),
+	)
+	if r1 != 0 {
+		return 0, fmt.Errorf("NetUserModalsGet failed: %v", syscall.Errno(r1))
+	}
+	defer procNetApiBufferFree.Call(uintptr(unsafe.Pointer(info)))
+	return info.MinPasswdLen, nil
+}
@@ -51,6 +51,9 @@ var (
 	procGetUserObjectInformationW    = user32.NewProc("GetUserObjectInformationW")
 	procDeleteProfileW               = userenv.NewProc("DeleteProfileW")
 	procGetDiskFreeSpaceExW          = kernel32.NewProc("GetDiskFreeSpaceExW")
+	procGetOEMCP                     = kernel32.NewProc("GetOEMCP")
+	procRegSetValueExW               = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteTreeW               = advapi32.NewProc("RegDeleteTreeW")
 
 	FOLDERID_LocalAppData   = syscall.GUID{Data1: 0xF1B32785, Data2: 0x6FBA, Data3: 0x4FCF, Data4: [8]byte{0x9D, 0x55, 0x7B, 0x8E, 0x7F, 0x15, 0x70, 0x91}}
 	FOLDERID_RoamingAppData = syscall.GUID{Data1: 0x3EB685DB, Data2: 0x65F9, Data3: 0x4CF6, Data4: [8]byte{0xA0, 0x3A, 0xE3, 0xEF, 0x65, 0x72, 0x9F, 0x3D}}
@@ -77,6 +80,9 @@ const (
 
 	ERROR_OLD_WIN_VERSION syscall.Errno = 1150
 
+	// https://docs.microsoft.com/en-us/windows/win32/api/stringapiset/nf-stringapiset-multibytetowidechar
+	MB_ERR_INVALID_CHARS uint32 = 0x00000008
+
 	// https://msdn.microsoft.com/en-us/library/windows/hardware/ff556838(v=vs.85).aspx
 	// TOKEN_INFORMATION_CLASS enumeration
 	TokenUser                            TOKEN_INFORMATION_CLASS = 1
@@ -674,6 +680,13 @@ func GetCurrentThreadId() uint32 {
 	return uint32(r1)
 }
 
+// GetOEMCP returns the OEM code page of the operating system, which console
+// programs write output in by default
+func GetOEMCP() uint32 {
+	r1, _, _ := procGetOEMCP.Call()
+	return uint32(r1)
+}
+
 func GetThreadDesktop(threadId uint32) (Hdesk, error) {
 	r1, _, e1 := procGetThreadDesktop.Call(
 		uintptr(threadId))
@@ -814,3 +827,52 @@ func DeleteProfile(
 	}
 	return
 }
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winreg/nf-winreg-regsetvalueexw
+// LSTATUS RegSetValueExW(
+//   HKEY       hKey,
+//   LPCWSTR    lpValueName,
+//   DWORD      Reserved,
+//   DWORD      dwType,
+//   const BYTE *lpData,
+//   DWORD      cbData
+// );
+func RegSetValueEx(
+	hKey syscall.Handle,
+	lpValueName *uint16,
+	dwType uint32,
+	lpData *byte,
+	cbData uint32,
+) (err error) {
+	r1, _, _ := procRegSetValueExW.Call(
+		uintptr(hKey),
+		uintptr(unsafe.Pointer(lpValueName)),
+		0,
+		uintptr(dwType),
+		uintptr(unsafe.Pointer(lpData)),
+		uintptr(cbData),
+	)
+	if r1 != 0 {
+		err = os.NewSyscallError("RegSetValueExW", syscall.Errno(r1))
+	}
+	return
+}
+
+// https://docs.microsoft.com/en-us/windows/win32/api/winreg/nf-winreg-regdeletetreew
+// LSTATUS RegDeleteTreeW(
+//   HKEY    hKey,
+//   LPCWSTR lpSubKey
+// );
+func RegDeleteTree(
+	hKey syscall.Handle,
+	lpSubKey *uint16,
+) (err error) {
+	r1, _, _ := procRegDeleteTreeW.Call(
+		uintptr(hKey),
+		uintptr(unsafe.Pointer(lpSubKey)),
+	)
+	if r1 != 0 {
+		err = os.NewSyscallError("RegDeleteTreeW", syscall.Errno(r1))
+	}
+	return
+}
@@ -39,60 +39,80 @@ func (userData *WorkerManagerUserData) UpdateConfig(c *gwconfig.Config, provider
 	c.WorkerGroup = userData.WorkerGroup
 	c.RootURL = userData.RootURL
 
+	reg, err := registerWorker(c, userData.WorkerPoolID, userData.ProviderID, providerType)
+	if err != nil {
+		return err
+	}
+
+	c.AccessToken = reg.Credentials.AccessToken
+	c.Certificate = reg.Credentials.Certificate
+	c.ClientID = reg.Credentials.ClientID
+
+	// TODO: process reg.Expires
+
+	return Bootstrap(c, &userData.WorkerConfig, "worker-pool")
+}
+
+// registerWorker registers the worker of the given config with
+// worker-manager, with the given proof of its identity, in exchange for
+// Taskcluster credentials
+func registerWorker(c *gwconfig.Config, workerPoolID, providerID string, workerIdentityProof interface{}) (*tcworkermanager.RegisterWorkerResponse, error) {
 	// We need a worker manager client for fetching taskcluster credentials.
 	// Ensure auth is disabled in client, since we don't have credentials yet.
 	wm := c.WorkerManager()
 	wm.Authenticate = false
 	wm.Credentials = nil
 
-	workerIdentityProof, err := json.Marshal(providerType)
+	proof, err := json.Marshal(workerIdentityProof)
 	if err != nil {
-		return fmt.Errorf("Could not marshal provider type %#v: %v", providerType, err)
+		return nil, fmt.Errorf("Could not marshal provider type %#v: %v", workerIdentityProof, err)
 	}
 
 	reg, err := wm.RegisterWorker(&tcworkermanager.RegisterWorkerRequest{
-		WorkerPoolID:        userData.WorkerPoolID,
-		ProviderID:          userData.ProviderID,
-		WorkerGroup:         userData.WorkerGroup,
+		WorkerPoolID:        workerPoolID,
+		ProviderID:          providerID,
+		WorkerGroup:         c.WorkerGroup,
 		WorkerID:            c.WorkerID,
-		WorkerIdentityProof: json.RawMessage(workerIdentityProof),
+		WorkerIdentityProof: json.RawMessage(proof),
 	})
 
 	if err != nil {
-		return fmt.Errorf("Could not register worker: %v", err)
+		return nil, fmt.Errorf("Could not register worker: %v", err)
 	}
-
-	c.AccessToken = reg.Credentials.AccessToken
-	c.Certificate = reg.Credentials.Certificate
-	c.ClientID = reg.Credentials.ClientID
-
-	// TODO: process reg.Expires
-
-	return Bootstrap(c, &userData.WorkerConfig, "worker-pool")
+	return reg, nil
 }
 
 func WMDeploymentID() (string, error) {
 	log.Print("Checking if there is a new deploymentId...")
+	workerConfig, err := WMWorkerConfig()
+	if err != nil {
+		return "", err
+	}
+	publicHostSetup, err := workerConfig.PublicHostSetup()
+	if err != nil {
+		return "", fmt.Errorf("WARNING: Can't extract public host setup from latest userdata for worker type %v - not shutting down as latest user data is probably botched: %v", config.WorkerType, err)
+	}
+	return publicHostSetup.Config.DeploymentID, nil
+}
+
+// WMWorkerConfig fetches the latest worker config of the worker pool from
+// worker-manager
+func WMWorkerConfig() (*BootstrapConfig, error) {
 	wm := config.WorkerManager()
 	wpfd, err := wm.WorkerPool(config.ProvisionerID + "/" + config.WorkerType)
 	if err != nil {
-		return "", fmt.Errorf("**** Can't reach worker-manager to see if there is a new deploymentId: %v", err)
+		return nil, fmt.Errorf("**** Can't reach worker-manager to fetch the latest worker pool configuration: %v", err)
 	}
 	workerManagerConfig := new(WorkerManagerConfig)
 	err = json.Unmarshal(wpfd.Config, &workerManagerConfig)
 	if err != nil {
-		return "", errors.New("WARNING: Can't decode /userData portion of worker type definition - probably somebody has botched a worker type update - not shutting down as in such a case, that would kill entire pool!")
+		return nil, errors.New("WARNING: Can't decode /userData portion of worker type definition - probably somebody has botched a worker type update - not shutting down as in such a case, that would kill entire pool!")
 	}
 
 	if len(workerManagerConfig.LaunchConfigs) < 1 {
-		return "", errors.New("WARNING: No launchConfigs in worker pool configuration - probably somebody has botched a worker type update - not shutting down as in such a case, that would kill entire pool!")
-	}
-
-	publicHostSetup, err := workerManagerConfig.LaunchConfigs[0].WorkerConfig.PublicHostSetup()
-	if err != nil {
-		return "", fmt.Errorf("WARNING: Can't extract public host setup from latest userdata for worker type %v - not shutting down as latest user data is probably botched: %v", config.WorkerType, err)
+		return nil, errors.New("WARNING: No launchConfigs in worker pool configuration - probably somebody has botched a worker type update - not shutting down as in such a case, that would kill entire pool!")
 	}
-	return publicHostSetup.Config.DeploymentID, nil
+	return &workerManagerConfig.LaunchConfigs[0].WorkerConfig, nil
 }
 
 type WorkerManagerLaunchConfig struct {
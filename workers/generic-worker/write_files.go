@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/taskcluster/taskcluster/v28/internal/scopes"
+)
+
+type (
+	// WriteFilesFeature creates the files of task.payload.writeFiles in the
+	// task directory before the task commands run
+	WriteFilesFeature struct {
+	}
+
+	WriteFilesTask struct {
+		task *TaskRun
+	}
+)
+
+func (feature *WriteFilesFeature) Name() string {
+	return "Write Files"
+}
+
+func (feature *WriteFilesFeature) Initialise() error {
+	return nil
+}
+
+func (feature *WriteFilesFeature) PersistState() error {
+	return nil
+}
+
+func (feature *WriteFilesFeature) IsEnabled(task *TaskRun) bool {
+	return len(task.Payload.WriteFiles) > 0
+}
+
+func (feature *WriteFilesFeature) NewTaskFeature(task *TaskRun) TaskFeature {
+	return &WriteFilesTask{
+		task: task,
+	}
+}
+
+func (wf *WriteFilesTask) RequiredScopes() scopes.Expression {
+	return scopes.AllOf{}
+}
+
+func (wf *WriteFilesTask) ReservedArtifacts() []string {
+	return []string{}
+}
+
+// Start validates all of the files before writing any of them, so that a
+// malformed entry doesn't leave a partially populated task directory
+func (wf *WriteFilesTask) Start() *CommandExecutionError {
+	contents := make([][]byte, len(wf.task.Payload.WriteFiles))
+	modes := make([]os.FileMode, len(wf.task.Payload.WriteFiles))
+	for i, file := range wf.task.Payload.WriteFiles {
+		if !withinTaskDirectory(file.Path) {
+			return MalformedPayloadError(fmt.Errorf("[writeFiles] File %v must be relative to, and inside, the task directory", file.Path))
+		}
+		var err error
+		contents[i], err = fileContent(&file)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[writeFiles] File %v: %v", file.Path, err))
+		}
+		modes[i], err = fileMode(&file)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[writeFiles] File %v has invalid mode %q: %v", file.Path, file.Mode, err))
+		}
+	}
+	for i, file := range wf.task.Payload.WriteFiles {
+		path, err := resolveTaskPath(file.Path)
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[writeFiles] Could not write file %v: %v", file.Path, err))
+		}
+		err = MkdirAllTaskUser(filepath.Dir(path), 0700)
+		if err == nil {
+			// replace any existing file, so that the mode is applied even
+			// if the file already existed
+			err = writeTaskFile(path, contents[i], modes[i])
+		}
+		if err == nil {
+			// the umask of the worker may have masked the mode
+			err = os.Chmod(path, modes[i])
+		}
+		if err == nil {
+			err = makeFileReadWritableForTaskUser(wf.task, path)
+		}
+		if err != nil {
+			return MalformedPayloadError(fmt.Errorf("[writeFiles] Could not write file %v: %v", file.Path, err))
+		}
+		wf.task.Infof("[writeFiles] Wrote %v bytes to %v with mode %#o", len(contents[i]), file.Path, modes[i])
+	}
+	return nil
+}
+
+func (wf *WriteFilesTask) Stop(err *ExecutionErrors) {
+}
+
+// fileContent returns the content of the given file, which has at most one
+// of content and base64
+func fileContent(file *FileToWrite) ([]byte, error) {
+	switch {
+	case file.Content != "" && file.Base64 != "":
+		return nil, fmt.Errorf("only one of content and base64 may be set")
+	case file.Base64 != "":
+		content, err := base64.StdEncoding.DecodeString(file.Base64)
+		if err != nil {
+			return nil, fmt.Errorf("base64 is not valid base64: %v", err)
+		}
+		return content, nil
+	}
+	return []byte(file.Content), nil
+}
+
+// fileMode returns the mode of the given file, which is 0644 if not set
+func fileMode(file *FileToWrite) (os.FileMode, error) {
+	if file.Mode == "" {
+		return 0644, nil
+	}
+	mode, err := strconv.ParseUint(file.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("should be octal permissions, such as \"0755\"")
+	}
+	return os.FileMode(mode), nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFiles(t *testing.T) {
+	defer setup(t)()
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		WriteFiles: []FileToWrite{
+			{
+				Path:    filepath.Join("scripts", "build.sh"),
+				Content: "#!/bin/sh\necho \"it's $HOME\"\n",
+				Mode:    "0755",
+			},
+			{
+				Path:   "data.bin",
+				Base64: "AAEC/w==",
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "completed", "completed")
+
+	script := filepath.Join(taskContext.TaskDir, "scripts", "build.sh")
+	content, err := ioutil.ReadFile(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != payload.WriteFiles[0].Content {
+		t.Fatalf("Was expecting script content %q but got %q", payload.WriteFiles[0].Content, content)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0755 {
+			t.Fatalf("Was expecting script to have mode 0755 but has mode %#o", info.Mode().Perm())
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(taskContext.TaskDir, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "\x00\x01\x02\xff" {
+		t.Fatalf("Was expecting decoded binary content, but got %q", data)
+	}
+}
+
+func TestWriteFilesMalformed(t *testing.T) {
+	defer setup(t)()
+
+	payload := GenericWorkerPayload{
+		Command:    helloGoodbye(),
+		MaxRunTime: 30,
+		WriteFiles: []FileToWrite{
+			{
+				Path:    filepath.Join("..", "outside.txt"),
+				Content: "hello",
+			},
+		},
+	}
+	td := testTask(t)
+
+	_ = submitAndAssert(t, td, payload, "exception", "malformed-payload")
+}
+
+func TestFileContentAndMode(t *testing.T) {
+	for _, file := range []FileToWrite{
+		{Path: "a", Content: "x", Base64: "eA=="},
+		{Path: "a", Base64: "not base64!"},
+	} {
+		if _, err := fileContent(&file); err == nil {
+			t.Errorf("Was expecting invalid content of %#v to be rejected", file)
+		}
+	}
+	if content, err := fileContent(&FileToWrite{Path: "empty"}); err != nil || len(content) != 0 {
+		t.Fatalf("Was expecting an empty file, but got %q, %v", content, err)
+	}
+	for mode, expected := range map[string]os.FileMode{"": 0644, "0600": 0600, "755": 0755} {
+		if m, err := fileMode(&FileToWrite{Mode: mode}); err != nil || m != expected {
+			t.Errorf("Was expecting mode %q to be %#o, but got %#o, %v", mode, expected, m, err)
+		}
+	}
+	if _, err := fileMode(&FileToWrite{Mode: "0999"}); err == nil {
+		t.Error("Was expecting mode 0999 to be rejected")
+	}
+}
+
+func TestWriteFilesThroughSymlinkOutsideTaskDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Creating symbolic links requires a privilege on Windows")
+	}
+	dir, err := ioutil.TempDir("", t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	taskDir := filepath.Join(dir, "task")
+	outside := filepath.Join(dir, "etc")
+	for _, d := range []string{filepath.Join(taskDir, "cache"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// for example a symbolic link in a mounted archive or writable cache
+	if err := os.Symlink(outside, filepath.Join(taskDir, "cache", "x")); err != nil {
+		t.Fatal(err)
+	}
+	oldTaskContext := taskContext
+	taskContext = &TaskContext{
+		TaskDir: taskDir,
+	}
+	defer func() {
+		taskContext = oldTaskContext
+	}()
+	task := &TaskRun{}
+	task.Payload.WriteFiles = []FileToWrite{
+		{
+			Path:    filepath.Join("cache", "x", "passwd"),
+			Content: "root::0:0::/:/bin/sh\n",
+		},
+	}
+	wf := &WriteFilesTask{
+		task: task,
+	}
+	if cee := wf.Start(); cee == nil || cee.Reason != malformedPayload {
+		t.Fatalf("Was expecting malformed-payload when writing file through symbolic link to outside of task directory, but got %v", cee)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "passwd")); !os.IsNotExist(err) {
+		t.Fatalf("Was not expecting file to be written outside of task directory, but Lstat returned %v", err)
+	}
+}